@@ -0,0 +1,109 @@
+// fake-cf runs a fake Cloud Controller and UAA which serve generated audit
+// events, for running paas-auditor locally and load testing it
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+func main() {
+	var (
+		listen          = flag.String("listen", "127.0.0.1:8090", "address to listen on")
+		clientID        = flag.String("client-id", "paas-auditor", "client ID to issue tokens to")
+		clientSecret    = flag.String("client-secret", "fake-secret", "client secret to issue tokens to")
+		seed            = flag.Int64("seed", 1, "seed for the generated events")
+		events          = flag.Int("events", 10000, "number of events to start with")
+		history         = flag.Duration("history", 30*24*time.Hour, "how far back the events to start with go")
+		arrivalInterval = flag.Duration("arrival-interval", time.Second, "how often new events arrive, or 0 for none")
+		arrivals        = flag.Int("arrivals", 5, "number of events which arrive each interval")
+		latency         = flag.Duration("latency", 0, "delay before every response")
+		tokenTTL        = flag.Duration("token-ttl", time.Hour, "how long tokens are valid for")
+		faultRate       = flag.Float64("fault-rate", 0, "chance, from 0 to 1, of a request for events failing")
+		faults          = flag.String("faults", "", "comma separated faults to fail requests with, from "+faultNames()+", default all")
+	)
+	flag.Parse()
+
+	logger := lager.NewLogger("fake-cf")
+	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.INFO))
+
+	randomFaults := h.Faults
+	if *faults != "" {
+		randomFaults = []h.Fault{}
+		for _, name := range strings.Split(*faults, ",") {
+			fault := h.Fault(strings.TrimSpace(name))
+			if !isFault(fault) {
+				fmt.Fprintf(os.Stderr, "unknown fault %q, must be one of %s\n", fault, faultNames())
+				os.Exit(2)
+			}
+			randomFaults = append(randomFaults, fault)
+		}
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Fatal("failed to listen", err)
+	}
+	fakeCF := h.NewFakeCFWithListener(listener, *clientID, *clientSecret)
+	defer fakeCF.Close()
+	fakeCF.Latency = *latency
+	fakeCF.TokenTTL = *tokenTTL
+	fakeCF.FaultRate = *faultRate
+	fakeCF.RandomFaults = randomFaults
+
+	generator := h.NewEventGenerator(*seed)
+	fakeCF.AddResources(generator.Resources()...)
+	if *events > 0 {
+		interval := *history / time.Duration(*events)
+		fakeCF.AddEvents(generator.Generate(*events, time.Now().Add(-*history), interval)...)
+	}
+	if *arrivalInterval > 0 {
+		fakeCF.StartArrivals(generator, *arrivalInterval, *arrivals)
+	}
+
+	logger.Info("started", lager.Data{
+		"url":    fakeCF.URL,
+		"events": *events,
+		"env": fmt.Sprintf(
+			"CF_API_ADDRESS=%s CF_CLIENT_ID=%s CF_CLIENT_SECRET=%s",
+			fakeCF.URL, *clientID, *clientSecret,
+		),
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	logger.Info("stopping", lager.Data{
+		"events":            len(fakeCF.Events()),
+		"v2_event_requests": fakeCF.Requests("/v2/events"),
+		"v3_event_requests": fakeCF.Requests("/v3/audit_events"),
+		"token_requests":    fakeCF.Requests("/oauth/token"),
+	})
+}
+
+func isFault(fault h.Fault) bool {
+	for _, f := range h.Faults {
+		if f == fault {
+			return true
+		}
+	}
+	return false
+}
+
+func faultNames() string {
+	names := []string{}
+	for _, fault := range h.Faults {
+		names = append(names, string(fault))
+	}
+	return strings.Join(names, ", ")
+}
@@ -1,6 +1,6 @@
 module github.com/alphagov/paas-auditor
 
-go 1.15
+go 1.16
 
 require (
 	code.cloudfoundry.org/lager v0.0.0-20180322215153-25ee72f227fe
@@ -3,20 +3,32 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/alphagov/paas-auditor/pkg/alerts"
+	"github.com/alphagov/paas-auditor/pkg/api"
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/checkpoints"
 	"github.com/alphagov/paas-auditor/pkg/collectors"
 	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 	inf "github.com/alphagov/paas-auditor/pkg/informer"
+	"github.com/alphagov/paas-auditor/pkg/leader"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+	"github.com/alphagov/paas-auditor/pkg/partitions"
 	"github.com/alphagov/paas-auditor/pkg/shippers"
 
+	"code.cloudfoundry.org/lager"
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -38,38 +50,149 @@ func main() {
 		cfg.Logger.Fatal("failed to connect to database", err)
 	}
 	eventDB := db.NewEventStore(ctx, pq, cfg.Logger)
+	defer eventDB.Close()
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, eventDB, os.Args[1:]))
+	}
+
 	if err := eventDB.Init(); err != nil {
 		cfg.Logger.Fatal("failed to initialise database", err)
 	}
 
-	cfClient, err := cfclient.NewClient(cfg.CFClientConfig)
-	if err != nil {
-		cfg.Logger.Fatal("failed to create CF client", err)
+	if err := checkUnnamedFoundation(cfg, eventDB); err != nil {
+		cfg.Logger.Fatal("unnamed foundation has been renamed", err)
 	}
 
-	fetcherCfg := fetchers.FetcherConfig{
-		CFClient:           cfClient,
-		Logger:             cfg.Logger.Session("cf-audit-event-fetcher"),
-		PaginationWaitTime: cfg.PaginationWaitTime,
+	// Each role's loop writes through a store fenced by the role's leader
+	// lease, so that a leader which has lost its lease without noticing
+	// cannot overwrite the writes of the instance which took over
+	leases := map[string]*db.Lease{}
+	leaderDB := func(role string) *db.EventStore {
+		lease := db.NewLease(role, cfg.InstanceID)
+		leases[role] = lease
+		return eventDB.WithLease(lease)
 	}
-	fetcher := func(pullEventsSince time.Time, resultsChan chan fetchers.CFAuditEventResult) {
-		fetchers.FetchCFAuditEvents(&fetcherCfg, pullEventsSince, resultsChan)
+
+	var backfillPolicy *collectors.BackfillPolicy
+	if !cfg.BackfillDisabled {
+		if err := cfg.BackfillPolicy.Validate(); err != nil {
+			cfg.Logger.Fatal("invalid backfill policy", err)
+		}
+		backfillPolicy = &cfg.BackfillPolicy
 	}
 
-	collector := collectors.NewCFAuditEventCollector(cfg.CollectorSchedule, cfg.Logger, fetcher, eventDB)
+	// The events API authenticates the users of each foundation with its UAA,
+	// and looks up their roles with its Cloud Controller. Foundations which
+	// share a UAA share a Verifier.
+	authHTTPClient := &http.Client{Timeout: 10 * time.Second}
+	authFoundations := make([]auth.Foundation, len(cfg.Foundations))
+	verifiers := map[string]*auth.Verifier{}
+	cfCollectors := make([]*collectors.CFAuditEventCollector, len(cfg.Foundations))
+	backfillers := make([]*collectors.Backfiller, len(cfg.Foundations))
+	foundationNames := make([]string, len(cfg.Foundations))
+	for i, foundation := range cfg.Foundations {
+		client, err := cfclient.NewClient(foundation.CFClientConfig)
+		if err != nil {
+			cfg.Logger.Fatal("failed to create CF client", err, lager.Data{"foundation": foundation.Name})
+		}
+
+		uaaURL := foundation.UAAURL
+		if uaaURL == "" {
+			uaaURL = client.Endpoint.TokenEndpoint
+		}
+		uaaURL = strings.TrimSuffix(uaaURL, "/")
+		verifier, ok := verifiers[uaaURL]
+		if !ok {
+			verifier = auth.NewVerifier(
+				auth.NewTokenKeys(uaaURL, auth.DefaultTokenKeysMinRefreshInterval, authHTTPClient, cfg.Logger),
+				uaaURL+"/oauth/token",
+				cfg.APITokenAudience,
+			)
+			verifiers[uaaURL] = verifier
+		}
+		authFoundations[i] = auth.Foundation{
+			Name:     foundation.Name,
+			Verifier: verifier,
+			OrgRoles: auth.NewOrgRoles(foundation.CFClientConfig.ApiAddress, authHTTPClient, auth.DefaultOrgRolesCacheTTL),
+		}
 
-	shipper := shippers.NewCFAuditEventsToSplunkShipper(
-		cfg.ShipperSchedule,
-		cfg.Logger,
-		eventDB,
-		cfg.DeployEnv,
-		cfg.SplunkAPIKey, cfg.SplunkURL,
-	)
+		fetcherCfg := fetchers.FetcherConfig{
+			CFClient:           client,
+			Logger:             cfg.Logger.Session("cf-audit-event-fetcher", lager.Data{"foundation": foundation.Name}),
+			PaginationWaitTime: cfg.PaginationWaitTime,
+		}
+		fetcher, err := fetchers.NewCFAuditEventFetcher(&fetcherCfg, foundation.AuditEventsAPIVersion)
+		if err != nil {
+			cfg.Logger.Fatal("failed to create CF audit event fetcher", err, lager.Data{"foundation": foundation.Name})
+		}
+
+		// Enrichers are not safe for concurrent use, so the collector and
+		// the backfiller each have their own
+		newEnricher := func(eventDB db.EventDB) *enrichers.Enricher {
+			if cfg.EnrichmentDisabled {
+				return nil
+			}
+			return enrichers.NewEnricher(
+				foundation.Name,
+				cfg.EnrichmentCacheTTL,
+				cfg.Logger,
+				enrichers.NewCFResolver(client, client.Endpoint.TokenEndpoint, client.Config.HttpClient),
+				eventDB,
+			)
+		}
+
+		collectorDB := leaderDB(foundationRole("collector", foundation.Name))
+		cfCollectors[i] = collectors.NewCFAuditEventCollector(
+			foundation.Name,
+			cfg.CollectorSchedule,
+			cfg.CollectorRetryPolicy,
+			backfillPolicy,
+			cfg.Logger,
+			fetcher,
+			newEnricher(collectorDB),
+			collectorDB,
+		)
+
+		if backfillPolicy != nil {
+			pager, err := fetchers.NewCFAuditEventPager(client, foundation.AuditEventsAPIVersion)
+			if err != nil {
+				cfg.Logger.Fatal("failed to create CF audit event pager", err, lager.Data{"foundation": foundation.Name})
+			}
+			backfillerDB := leaderDB(foundationRole("backfiller", foundation.Name))
+			backfillers[i] = collectors.NewBackfiller(
+				foundation.Name,
+				cfg.CollectorSchedule,
+				*backfillPolicy,
+				cfg.Logger,
+				pager,
+				newEnricher(backfillerDB),
+				backfillerDB,
+			)
+		}
+		foundationNames[i] = foundation.Name
+	}
+
+	shipperRunners := make([]*shippers.Runner, len(cfg.Sinks))
+	for i, sink := range cfg.Sinks {
+		shipper, err := shippers.NewShipper(sink, cfg.DeployEnv)
+		if err != nil {
+			cfg.Logger.Fatal("failed to create shipper", err)
+		}
+		shipperRunners[i] = shippers.NewRunner(
+			sink,
+			cfg.ShipperSchedule,
+			cfg.Logger,
+			leaderDB("shipper-"+sink.Name),
+			shipper,
+		)
+	}
 
 	informer := inf.NewInformer(
 		cfg.InformerSchedule,
+		foundationNames,
 		cfg.Logger,
-		eventDB,
+		leaderDB("informer"),
 	)
 
 	mux := http.NewServeMux()
@@ -80,6 +203,86 @@ func main() {
 
 	mux.Handle("/metrics", promhttp.Handler())
 
+	authenticator := auth.NewAuthenticator(cfg.Logger, authFoundations, cfg.APIAdminScopes)
+	// Erasing changes stored events, so it needs its own, narrower, scopes
+	erasureAuthenticator := auth.NewAuthenticator(cfg.Logger, authFoundations, cfg.APIErasureScopes)
+
+	eventsHandler := authenticator.Middleware(api.NewEventsHandler(cfg.Logger, eventDB))
+	mux.Handle(api.EventsPath, eventsHandler)
+	mux.Handle(api.EventsPath+"/", eventsHandler)
+	mux.Handle(api.ResourceNamesPath+"/", authenticator.Middleware(api.NewResourceNamesHandler(cfg.Logger, eventDB)))
+	mux.Handle(api.ErasuresPath, erasureAuthenticator.Middleware(api.NewErasuresHandler(cfg.Logger, eventDB)))
+
+	var checkpointer *checkpoints.Checkpointer
+	if cfg.CheckpointSigningKey != "" {
+		signer, err := checkpoints.NewSigner(cfg.CheckpointSigningKey)
+		if err != nil {
+			cfg.Logger.Fatal("failed to read CHECKPOINT_SIGNING_KEY", err)
+		}
+		cfg.Logger.Info("checkpoints-enabled", lager.Data{
+			"key_id":     checkpoints.KeyID(signer.PublicKey()),
+			"public_key": base64.StdEncoding.EncodeToString(signer.PublicKey()),
+		})
+		checkpointer = checkpoints.NewCheckpointer(cfg.CheckpointSchedule, cfg.Logger, leaderDB("checkpointer"), signer)
+		mux.Handle(api.LatestCheckpointPath, api.NewCheckpointHandler(cfg.Logger, eventDB, signer.PublicKey()))
+	} else {
+		cfg.Logger.Info("checkpoints-disabled", lager.Data{
+			"reason": "CHECKPOINT_SIGNING_KEY is not set",
+		})
+	}
+
+	var archiver *archive.Archiver
+	if cfg.ArchiveS3Config.Bucket != "" {
+		cfg.Logger.Info("archiving-enabled", lager.Data{
+			"endpoint": cfg.ArchiveS3Config.Endpoint,
+			"bucket":   cfg.ArchiveS3Config.Bucket,
+		})
+		store := archive.NewS3Client(cfg.ArchiveS3Config, &http.Client{Timeout: 5 * time.Minute})
+		archiver = archive.NewArchiver(cfg.ArchiveSchedule, cfg.ArchivePolicy, cfg.Logger, leaderDB("archiver"), store)
+
+		// Do not let the retention policy remove events before they are archived
+		cfg.PartitionPolicy.RequireArchived = true
+	} else {
+		cfg.Logger.Info("archiving-disabled", lager.Data{
+			"reason": "ARCHIVE_S3_BUCKET is not set",
+		})
+	}
+
+	var alertEngine *alerts.Engine
+	if len(cfg.AlertRules) > 0 {
+		cfg.Logger.Info("alerting-enabled", lager.Data{"rules": len(cfg.AlertRules)})
+		alertEngine = alerts.NewEngine(cfg.AlertEngineSchedule, cfg.AlertRules, cfg.Logger, leaderDB("alert-engine"))
+	} else {
+		cfg.Logger.Info("alerting-disabled", lager.Data{
+			"reason": "ALERT_RULES_FILE is not set",
+		})
+	}
+
+	notifierRunners := make([]*notifiers.Runner, len(cfg.Notifications.Channels))
+	for i, channel := range cfg.Notifications.Channels {
+		notifier, err := notifiers.NewNotifier(channel, cfg.DeployEnv)
+		if err != nil {
+			cfg.Logger.Fatal("failed to create notifier", err)
+		}
+		notifierRunners[i], err = notifiers.NewRunner(
+			channel,
+			cfg.Notifications.Silences,
+			cfg.DeployEnv,
+			cfg.NotifierSchedule,
+			cfg.Logger,
+			leaderDB("notifier-"+channel.Name),
+			notifier,
+		)
+		if err != nil {
+			cfg.Logger.Fatal("failed to create notifier", err)
+		}
+	}
+
+	if err := cfg.PartitionPolicy.Validate(); err != nil {
+		cfg.Logger.Fatal("invalid partition retention policy", err)
+	}
+	partitionMaintainer := partitions.NewMaintainer(cfg.PartitionMaintainerSchedule, cfg.PartitionPolicy, cfg.Logger, leaderDB("partition-maintainer"))
+
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.ListenPort),
 		Handler: mux,
@@ -87,11 +290,54 @@ func main() {
 
 	var wg sync.WaitGroup
 
+	runAsLeader := func(role string, run func(context.Context) error) error {
+		return leader.NewElector(
+			leases[role], cfg.LeaderLeaseTTL, cfg.Logger, eventDB,
+		).Run(ctx, run)
+	}
+
+	for i, collector := range cfCollectors {
+		name := foundationNames[i]
+		cfg.Logger.Info("starting-collector", lager.Data{"foundation": name})
+
+		role := foundationRole("collector", name)
+
+		wg.Add(1)
+		go func(collector *collectors.CFAuditEventCollector) {
+			err := runAsLeader(role, collector.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-collector", err, lager.Data{"foundation": name})
+			}
+			shutdown()
+			os.Exit(1)
+		}(collector)
+	}
+
+	for i, backfiller := range backfillers {
+		if backfiller == nil {
+			continue
+		}
+		name := foundationNames[i]
+		cfg.Logger.Info("starting-backfiller", lager.Data{"foundation": name})
+
+		role := foundationRole("backfiller", name)
+
+		wg.Add(1)
+		go func(backfiller *collectors.Backfiller) {
+			err := runAsLeader(role, backfiller.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-backfiller", err, lager.Data{"foundation": name})
+			}
+			shutdown()
+			os.Exit(1)
+		}(backfiller)
+	}
+
 	wg.Add(1)
 	go func() {
-		err := collector.Run(ctx)
+		err := runAsLeader("informer", informer.Run)
 		if err != nil {
-			cfg.Logger.Error("err-fatal-collector", err)
+			cfg.Logger.Error("err-fatal-informer", err)
 		}
 		shutdown()
 		os.Exit(1)
@@ -99,28 +345,80 @@ func main() {
 
 	wg.Add(1)
 	go func() {
-		err := informer.Run(ctx)
+		err := runAsLeader("partition-maintainer", partitionMaintainer.Run)
 		if err != nil {
-			cfg.Logger.Error("err-fatal-informer", err)
+			cfg.Logger.Error("err-fatal-partition-maintainer", err)
 		}
 		shutdown()
 		os.Exit(1)
 	}()
 
-	if cfg.SplunkAPIKey != "" && cfg.SplunkURL != "" {
-		cfg.Logger.Info("creds-present-starting-shipper")
+	if archiver != nil {
+		wg.Add(1)
+		go func() {
+			err := runAsLeader("archiver", archiver.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-archiver", err)
+			}
+			shutdown()
+			os.Exit(1)
+		}()
+	}
+
+	if checkpointer != nil {
+		wg.Add(1)
+		go func() {
+			err := runAsLeader("checkpointer", checkpointer.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-checkpointer", err)
+			}
+			shutdown()
+			os.Exit(1)
+		}()
+	}
 
+	if alertEngine != nil {
 		wg.Add(1)
 		go func() {
-			err := shipper.Run(ctx)
+			err := runAsLeader("alert-engine", alertEngine.Run)
 			if err != nil {
-				cfg.Logger.Error("err-fatal-shipper", err)
+				cfg.Logger.Error("err-fatal-alert-engine", err)
 			}
 			shutdown()
 			os.Exit(1)
 		}()
 	}
 
+	for i, runner := range shipperRunners {
+		name := cfg.Sinks[i].Name
+		cfg.Logger.Info("starting-shipper", lager.Data{"shipper": name})
+
+		wg.Add(1)
+		go func(runner *shippers.Runner) {
+			err := runAsLeader("shipper-"+name, runner.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-shipper", err, lager.Data{"shipper": name})
+			}
+			shutdown()
+			os.Exit(1)
+		}(runner)
+	}
+
+	for i, runner := range notifierRunners {
+		name := cfg.Notifications.Channels[i].Name
+		cfg.Logger.Info("starting-notifier", lager.Data{"channel": name})
+
+		wg.Add(1)
+		go func(runner *notifiers.Runner) {
+			err := runAsLeader("notifier-"+name, runner.Run)
+			if err != nil {
+				cfg.Logger.Error("err-fatal-notifier", err, lager.Data{"channel": name})
+			}
+			shutdown()
+			os.Exit(1)
+		}(runner)
+	}
+
 	wg.Add(1)
 	go func() {
 		err := server.ListenAndServe()
@@ -133,3 +431,13 @@ func main() {
 
 	wg.Wait()
 }
+
+// foundationRole is the leader role of a foundation's collector or
+// backfiller. A foundation without a name has the role of the only collector
+// or backfiller before there could be more than one.
+func foundationRole(role string, foundation string) string {
+	if foundation == "" {
+		return role
+	}
+	return role + "-" + foundation
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/checkpoints"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const usage = `usage: paas-auditor [command]
+
+With no command, runs the auditor.
+
+commands:
+  migrate status    list the database migrations and whether they have been applied
+  migrate up        apply the migrations which have not been applied yet
+  migrate dry-run   show the migrations which would be applied, without applying them
+  verify            check the hash chain over stored events and the signed checkpoints
+  restore DAY [LAST_DAY]
+                    restore the archived events of a day, or of each day from DAY to
+                    LAST_DAY, from ARCHIVE_S3_BUCKET. Days look like 2020-01-31
+  restore PATH...   restore archives which have been downloaded, each alongside its
+                    .manifest.json
+  erase-user USER REFERENCE
+                    replace the personal data of a user, given by GUID or username, in
+                    stored events with a pseudonym. REFERENCE is the erasure request
+                    or ticket, and is recorded with the erasure
+  seal-erasures     seal the erasures made before erasures were sealed, once their
+                    events have been checked against the originals in the archives
+                    they list, from ARCHIVE_S3_BUCKET
+`
+
+// runCommand runs a one-off command instead of the auditor, and returns the
+// exit code
+func runCommand(cfg Config, eventDB *db.EventStore, args []string) int {
+	switch args[0] {
+	case "migrate":
+		if len(args) != 2 {
+			break
+		}
+		return runMigrate(eventDB, args[1])
+	case "verify":
+		return runVerify(cfg, eventDB)
+	case "restore":
+		if len(args) < 2 {
+			break
+		}
+		return runRestore(cfg, eventDB, args[1:])
+	case "erase-user":
+		if len(args) != 3 {
+			break
+		}
+		return runEraseUser(eventDB, args[1], args[2])
+	case "seal-erasures":
+		if len(args) != 1 {
+			break
+		}
+		return runSealErasures(cfg, eventDB)
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func runMigrate(eventDB *db.EventStore, subcommand string) int {
+	switch subcommand {
+	case "status":
+		statuses, err := eventDB.MigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error getting migration status: %s\n", err)
+			return 1
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if status.Modified {
+				state += " (modified since it was applied)"
+			}
+			fmt.Printf("%04d_%-45s %s\n", status.Version, status.Name, state)
+		}
+		return 0
+	case "up", "dry-run":
+		dryRun := subcommand == "dry-run"
+		pending, err := eventDB.Migrate(dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error migrating: %s\n", err)
+			return 1
+		}
+		if len(pending) == 0 {
+			fmt.Println("no migrations to apply")
+			return 0
+		}
+		for _, m := range pending {
+			if dryRun {
+				fmt.Printf("-- would apply %04d_%s\n%s\n", m.Version, m.Name, m.SQL)
+			} else {
+				fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+			}
+		}
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// runVerify walks the hash chain and reports the first break. Checkpoint
+// signatures are checked against CHECKPOINT_PUBLIC_KEY, or the public key of
+// CHECKPOINT_SIGNING_KEY.
+func runVerify(cfg Config, eventDB *db.EventStore) int {
+	var publicKey ed25519.PublicKey
+	switch {
+	case cfg.CheckpointPublicKey != "":
+		key, err := checkpoints.ParsePublicKey(cfg.CheckpointPublicKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "CHECKPOINT_PUBLIC_KEY: %s\n", err)
+			return 2
+		}
+		publicKey = key
+	case cfg.CheckpointSigningKey != "":
+		signer, err := checkpoints.NewSigner(cfg.CheckpointSigningKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "CHECKPOINT_SIGNING_KEY: %s\n", err)
+			return 2
+		}
+		publicKey = signer.PublicKey()
+	default:
+		fmt.Fprintln(os.Stderr, "warning: CHECKPOINT_PUBLIC_KEY is not set, so checkpoint signatures will not be checked")
+	}
+
+	result, err := eventDB.VerifyChain()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error verifying chain: %s\n", err)
+		return 2
+	}
+
+	for _, cp := range result.Checkpoints {
+		if publicKey != nil && !checkpoints.Verify(publicKey, cp) {
+			result.Break = &db.ChainBreak{
+				ID:     cp.HeadID,
+				Reason: fmt.Sprintf("checkpoint %d does not have a valid signature from key %s", cp.ID, checkpoints.KeyID(publicKey)),
+			}
+			break
+		}
+	}
+
+	fmt.Printf("events checked:      %d\n", result.EventsChecked)
+	fmt.Printf("erasures checked:    %d\n", result.ErasuresChecked)
+	fmt.Printf("checkpoints checked: %d\n", len(result.Checkpoints))
+	if result.ErasedEvents > 0 {
+		fmt.Printf("erased events:       %d (checked against their sealed erasures)\n", result.ErasedEvents)
+	}
+	if result.Break != nil {
+		switch {
+		case result.Break.ID != 0:
+			fmt.Printf("chain broken at event id %d", result.Break.ID)
+			if result.Break.GUID != "" {
+				fmt.Printf(" (guid %s)", result.Break.GUID)
+			}
+		case result.Break.ErasureID != 0:
+			fmt.Printf("chain broken at erasure %d", result.Break.ErasureID)
+		default:
+			fmt.Printf("chain broken")
+		}
+		fmt.Printf(": %s\n", result.Break.Reason)
+		return 1
+	}
+	fmt.Printf("chain head:          id %d, chain hash %s\n", result.Head.ID, hex.EncodeToString(result.Head.ChainHash))
+	if result.Head.ErasureSeq != 0 {
+		fmt.Printf("erasure chain head:  seq %d, chain hash %s\n", result.Head.ErasureSeq, hex.EncodeToString(result.Head.ErasureChainHash))
+	}
+	fmt.Println("chain verified")
+	return 0
+}
+
+// runRestore loads archived events back into the database. Arguments are
+// either days, which are read from the archive bucket, or paths to local
+// copies of archives.
+func runRestore(cfg Config, eventDB *db.EventStore, args []string) int {
+	var source archive.ObjectGetter = archive.LocalFiles{}
+	objectKeys := args
+
+	if firstDay, err := time.Parse("2006-01-02", args[0]); err == nil {
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		lastDay := firstDay
+		if len(args) == 2 {
+			lastDay, err = time.Parse("2006-01-02", args[1])
+			if err != nil || lastDay.Before(firstDay) {
+				fmt.Fprintf(os.Stderr, "LAST_DAY must be a day like 2020-01-31, no earlier than DAY\n")
+				return 2
+			}
+		}
+		if cfg.ArchiveS3Config.Bucket == "" {
+			fmt.Fprintln(os.Stderr, "ARCHIVE_S3_BUCKET must be set to restore days from the archive")
+			return 2
+		}
+		source = archive.NewS3Client(cfg.ArchiveS3Config, &http.Client{Timeout: 5 * time.Minute})
+
+		// A day which has been archived more than once is restored from its
+		// latest revision
+		archives, err := eventDB.GetCFAuditEventArchives()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading archives: %s\n", err)
+			return 1
+		}
+		revisions := map[time.Time]int{}
+		for _, a := range archives {
+			revisions[a.WindowStart.UTC()] = a.Revision
+		}
+		objectKeys = []string{}
+		for day := firstDay; !day.After(lastDay); day = day.Add(archive.WindowSize) {
+			revision := revisions[day]
+			if revision == 0 {
+				revision = 1
+			}
+			objectKeys = append(objectKeys, archive.ObjectKey(cfg.ArchivePolicy.Prefix, day, revision))
+		}
+	}
+
+	restorer := archive.NewRestorer(cfg.Logger, eventDB, source, cfg.RestoreHold)
+	total := archive.RestoreResult{}
+	for _, objectKey := range objectKeys {
+		result, err := restorer.Restore(objectKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error restoring %s: %s\n", objectKey, err)
+			return 1
+		}
+		fmt.Printf("restored %s: %d events, %d new, %d already present\n", objectKey, result.Events, result.Stored, result.AlreadyPresent)
+		total.Events += result.Events
+		total.Stored += result.Stored
+		total.AlreadyPresent += result.AlreadyPresent
+	}
+	if len(objectKeys) > 1 {
+		fmt.Printf("restored %d archives: %d events, %d new, %d already present\n", len(objectKeys), total.Events, total.Stored, total.AlreadyPresent)
+	}
+	return 0
+}
+
+// runEraseUser pseudonymises a user in the stored events. USER is taken to be
+// a GUID if it looks like one, otherwise a username.
+func runEraseUser(eventDB *db.EventStore, user string, reference string) int {
+	request := db.ErasureRequest{
+		Username:    user,
+		Reference:   reference,
+		RequestedBy: "cli:" + os.Getenv("USER"),
+	}
+	if _, err := uuid.FromString(user); err == nil {
+		request = db.ErasureRequest{
+			UserGUID:    user,
+			Reference:   reference,
+			RequestedBy: request.RequestedBy,
+		}
+	}
+	if err := request.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	erasure, err := eventDB.EraseUserFromCFAuditEvents(request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error erasing user: %s\n", err)
+		return 1
+	}
+	fmt.Printf("erasure %d: %d events changed, %s replaced with %s\n", erasure.ID, erasure.EventCount, erasure.SubjectType, erasure.Pseudonym)
+	for _, key := range erasure.ArchiveKeys {
+		fmt.Printf("archive still holds original events: %s\n", key)
+	}
+	for _, key := range erasure.UnsearchedArchiveKeys {
+		fmt.Printf("archive was not searched, as its events were deleted: %s\n", key)
+	}
+	for _, partition := range erasure.DetachedPartitions {
+		fmt.Printf("detached partition was not searched: %s\n", partition)
+	}
+	for _, sink := range erasure.ShippedTo {
+		fmt.Printf("sink still holds original events: %s\n", sink)
+	}
+	return 0
+}
+
+// runSealErasures seals each erasure made before erasures were sealed, once
+// the events it changed have been checked against their originals in the
+// archives it lists. An erasure which does not check out is left unsealed, so
+// that verify carries on reporting its events.
+func runSealErasures(cfg Config, eventDB *db.EventStore) int {
+	if cfg.ArchiveS3Config.Bucket == "" {
+		fmt.Fprintln(os.Stderr, "ARCHIVE_S3_BUCKET must be set to check erasures against the archive")
+		return 2
+	}
+	erasures, err := eventDB.GetUnsealedCFAuditEventErasures()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading erasures: %s\n", err)
+		return 1
+	}
+	if len(erasures) == 0 {
+		fmt.Println("no erasures to seal")
+		return 0
+	}
+
+	source := archive.NewS3Client(cfg.ArchiveS3Config, &http.Client{Timeout: 5 * time.Minute})
+	restorer := archive.NewRestorer(cfg.Logger, eventDB, source, 0)
+	failed := 0
+	for _, erasure := range erasures {
+		if err := sealErasure(eventDB, restorer, erasure); err != nil {
+			fmt.Fprintf(os.Stderr, "erasure %d not sealed: %s\n", erasure.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("erasure %d sealed\n", erasure.ID)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func sealErasure(eventDB *db.EventStore, restorer *archive.Restorer, erasure db.Erasure) error {
+	originals := []db.FoundationEvent{}
+	for _, key := range erasure.ArchiveKeys {
+		events, err := restorer.Read(key)
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", key, err)
+		}
+		originals = append(originals, events...)
+	}
+	return eventDB.SealEarlierCFAuditEventErasure(erasure.ID, originals)
+}
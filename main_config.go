@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -8,62 +10,343 @@ import (
 	"time"
 
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	uuid "github.com/satori/go.uuid"
 
 	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/alerts"
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+	"github.com/alphagov/paas-auditor/pkg/partitions"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
 )
 
 type Config struct {
-	DeployEnv string
+	DeployEnv  string
+	InstanceID string
 
 	Logger      lager.Logger
 	DatabaseURL string
 
-	CFClientConfig *cfclient.Config
+	Foundations []Foundation
+
+	// UnnamedFoundationRetired says that the events stored before
+	// foundations could be named are from a foundation which is no longer
+	// collected from
+	UnnamedFoundationRetired bool
 
 	PaginationWaitTime time.Duration
 	CollectorSchedule  time.Duration
 	InformerSchedule   time.Duration
 	ShipperSchedule    time.Duration
 
-	SplunkAPIKey string
-	SplunkURL    string
+	CollectorRetryPolicy collectors.RetryPolicy
+
+	BackfillDisabled bool
+	BackfillPolicy   collectors.BackfillPolicy
+
+	EnrichmentDisabled bool
+	EnrichmentCacheTTL time.Duration
+
+	LeaderLeaseTTL time.Duration
+
+	Sinks []shippers.SinkConfig
+
+	APITokenAudience string
+	APIAdminScopes   []string
+	APIErasureScopes []string
+
+	CheckpointSchedule   time.Duration
+	CheckpointSigningKey string
+	CheckpointPublicKey  string
+
+	PartitionMaintainerSchedule time.Duration
+	PartitionPolicy             partitions.Policy
+
+	ArchiveSchedule time.Duration
+	ArchiveS3Config archive.S3Config
+	ArchivePolicy   archive.Policy
+	RestoreHold     time.Duration
+
+	AlertEngineSchedule time.Duration
+	AlertRules          []alerts.Rule
+
+	NotifierSchedule time.Duration
+	Notifications    notifiers.Config
 
 	ListenPort uint
 }
 
 func NewConfigFromEnv() Config {
 	return Config{
-		DeployEnv: getEnvWithDefaultString("DEPLOY_ENV", "dev"),
+		DeployEnv:  getEnvWithDefaultString("DEPLOY_ENV", "dev"),
+		InstanceID: getEnvWithDefaultString("CF_INSTANCE_GUID", uuid.NewV4().String()),
 
 		Logger:      getDefaultLogger(),
 		DatabaseURL: getEnvWithDefaultString("DATABASE_URL", "postgres://postgres:@localhost:5432/"),
 
-		CFClientConfig: &cfclient.Config{
-			ApiAddress:        os.Getenv("CF_API_ADDRESS"),
-			Username:          os.Getenv("CF_USERNAME"),
-			Password:          os.Getenv("CF_PASSWORD"),
-			ClientID:          os.Getenv("CF_CLIENT_ID"),
-			ClientSecret:      os.Getenv("CF_CLIENT_SECRET"),
-			SkipSslValidation: os.Getenv("CF_SKIP_SSL_VALIDATION") == "true",
-			Token:             os.Getenv("CF_TOKEN"),
-			UserAgent:         os.Getenv("CF_USER_AGENT"),
-			HttpClient: &http.Client{
-				Timeout: 30 * time.Second,
-			},
-		},
+		Foundations:              getFoundations(),
+		UnnamedFoundationRetired: os.Getenv("UNNAMED_FOUNDATION_RETIRED") == "true",
 
 		PaginationWaitTime: getEnvWithDefaultDuration("FETCHER_PAGINATION_WAIT_TIME", 200*time.Millisecond),
 		CollectorSchedule:  getEnvWithDefaultDuration("COLLECTOR_SCHEDULE", 2*time.Minute),
 		InformerSchedule:   getEnvWithDefaultDuration("INFORMER_SCHEDULE", 15*time.Second),
 		ShipperSchedule:    getEnvWithDefaultDuration("SHIPPER_SCHEDULE", 15*time.Second),
 
-		SplunkAPIKey: os.Getenv("SPLUNK_API_KEY"),
-		SplunkURL:    os.Getenv("SPLUNK_HEC_ENDPOINT_URL"),
+		CollectorRetryPolicy: collectors.RetryPolicy{
+			InitialBackoff: getEnvWithDefaultDuration("COLLECTOR_RETRY_INITIAL_BACKOFF", collectors.DefaultRetryPolicy.InitialBackoff),
+			MaxBackoff:     getEnvWithDefaultDuration("COLLECTOR_RETRY_MAX_BACKOFF", collectors.DefaultRetryPolicy.MaxBackoff),
+			ErrorBudget:    int(getEnvWithDefaultInt("COLLECTOR_ERROR_BUDGET", uint(collectors.DefaultRetryPolicy.ErrorBudget))),
+		},
+
+		BackfillDisabled: os.Getenv("BACKFILL_DISABLED") == "true",
+		BackfillPolicy: collectors.BackfillPolicy{
+			Period:       getEnvWithDefaultDuration("BACKFILL_PERIOD", collectors.DefaultBackfillPolicy.Period),
+			Window:       getEnvWithDefaultDuration("BACKFILL_WINDOW", collectors.DefaultBackfillPolicy.Window),
+			Concurrency:  int(getEnvWithDefaultInt("BACKFILL_CONCURRENCY", uint(collectors.DefaultBackfillPolicy.Concurrency))),
+			PageInterval: getEnvWithDefaultDuration("BACKFILL_PAGE_INTERVAL", collectors.DefaultBackfillPolicy.PageInterval),
+		},
+
+		EnrichmentDisabled: os.Getenv("ENRICHMENT_DISABLED") == "true",
+		EnrichmentCacheTTL: getEnvWithDefaultDuration("ENRICHMENT_CACHE_TTL", enrichers.DefaultCacheTTL),
+
+		LeaderLeaseTTL: getEnvWithDefaultDuration("LEADER_LEASE_TTL", 30*time.Second),
+
+		Sinks: getSinkConfigs(),
+
+		APITokenAudience: getEnvWithDefaultString("API_TOKEN_AUDIENCE", "cloud_controller"),
+		APIAdminScopes:   getEnvWithDefaultList("API_ADMIN_SCOPES", []string{"cloud_controller.admin", "cloud_controller.admin_read_only", "cloud_controller.global_auditor"}),
+		APIErasureScopes: getEnvWithDefaultList("API_ERASURE_SCOPES", []string{"cloud_controller.admin"}),
+
+		CheckpointSchedule:   getEnvWithDefaultDuration("CHECKPOINT_SCHEDULE", 1*time.Hour),
+		CheckpointSigningKey: os.Getenv("CHECKPOINT_SIGNING_KEY"),
+		CheckpointPublicKey:  os.Getenv("CHECKPOINT_PUBLIC_KEY"),
+
+		PartitionMaintainerSchedule: getEnvWithDefaultDuration("PARTITION_MAINTAINER_SCHEDULE", 1*time.Hour),
+		PartitionPolicy: partitions.Policy{
+			MonthsAhead:     int(getEnvWithDefaultInt("PARTITION_MONTHS_AHEAD", 2)),
+			RetentionMonths: int(getEnvWithDefaultInt("RETENTION_MONTHS", 0)),
+			RetentionAction: getEnvWithDefaultString("RETENTION_ACTION", db.PartitionActionDrop),
+		},
+
+		ArchiveSchedule: getEnvWithDefaultDuration("ARCHIVE_SCHEDULE", 1*time.Hour),
+		ArchiveS3Config: getArchiveS3Config(),
+		ArchivePolicy: archive.Policy{
+			Delay:      getEnvWithDefaultDuration("ARCHIVE_DELAY", 48*time.Hour),
+			Prefix:     os.Getenv("ARCHIVE_PREFIX"),
+			DeleteRows: os.Getenv("ARCHIVE_DELETE_ROWS") == "true",
+		},
+		RestoreHold: getEnvWithDefaultDuration("RESTORE_HOLD", 30*24*time.Hour),
+
+		AlertEngineSchedule: getEnvWithDefaultDuration("ALERT_ENGINE_SCHEDULE", 15*time.Second),
+		AlertRules:          getAlertRules(),
+
+		NotifierSchedule: getEnvWithDefaultDuration("NOTIFIER_SCHEDULE", 15*time.Second),
+		Notifications:    getNotificationsConfig(),
 
 		ListenPort: getEnvWithDefaultInt("PORT", 9299),
 	}
 }
 
+// Foundation is a Cloud Foundry foundation to collect events from. Events are
+// stored labelled with its name.
+type Foundation struct {
+	Name                  string
+	CFClientConfig        *cfclient.Config
+	AuditEventsAPIVersion string
+
+	// UAAURL is the UAA which issues the tokens of the foundation's users,
+	// or empty to use the token endpoint advertised by the foundation
+	UAAURL string
+}
+
+// foundationConfig is the format of each foundation in FOUNDATIONS. Secrets
+// are read from the environment variables they name.
+type foundationConfig struct {
+	Name                  string `json:"name"`
+	APIAddress            string `json:"api_address"`
+	ClientID              string `json:"client_id"`
+	ClientSecretEnv       string `json:"client_secret_env"`
+	Username              string `json:"username"`
+	PasswordEnv           string `json:"password_env"`
+	SkipSSLValidation     bool   `json:"skip_ssl_validation"`
+	AuditEventsAPIVersion string `json:"audit_events_api_version"`
+	UAAURL                string `json:"uaa_url"`
+}
+
+// getFoundations reads the foundations to collect events from: those in the
+// JSON list in FOUNDATIONS, and the one configured by the CF_* environment
+// variables, named CF_FOUNDATION. The CF_* foundation is always used if
+// FOUNDATIONS is not set. Only it can be unnamed, so that events collected
+// before there were foundations stay with the foundation they came from.
+func getFoundations() []Foundation {
+	configs := []foundationConfig{}
+	if v := os.Getenv("FOUNDATIONS"); v != "" {
+		decoder := json.NewDecoder(strings.NewReader(v))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&configs); err != nil {
+			panic(fmt.Errorf("FOUNDATIONS: %s", err))
+		}
+	}
+
+	foundations := []Foundation{}
+	for i, c := range configs {
+		if c.Name == "" {
+			panic(fmt.Errorf("FOUNDATIONS: foundation %d: name is required", i))
+		}
+		foundations = append(foundations, Foundation{
+			Name: c.Name,
+			CFClientConfig: &cfclient.Config{
+				ApiAddress:        c.APIAddress,
+				Username:          c.Username,
+				Password:          getEnvIfNamed(c.PasswordEnv),
+				ClientID:          c.ClientID,
+				ClientSecret:      getEnvIfNamed(c.ClientSecretEnv),
+				SkipSslValidation: c.SkipSSLValidation,
+				UserAgent:         os.Getenv("CF_USER_AGENT"),
+				HttpClient: &http.Client{
+					Timeout: 30 * time.Second,
+				},
+			},
+			AuditEventsAPIVersion: c.AuditEventsAPIVersion,
+			UAAURL:                c.UAAURL,
+		})
+	}
+
+	if len(configs) == 0 || os.Getenv("CF_API_ADDRESS") != "" {
+		foundations = append(foundations, Foundation{
+			Name: os.Getenv("CF_FOUNDATION"),
+			CFClientConfig: &cfclient.Config{
+				ApiAddress:        os.Getenv("CF_API_ADDRESS"),
+				Username:          os.Getenv("CF_USERNAME"),
+				Password:          os.Getenv("CF_PASSWORD"),
+				ClientID:          os.Getenv("CF_CLIENT_ID"),
+				ClientSecret:      os.Getenv("CF_CLIENT_SECRET"),
+				SkipSslValidation: os.Getenv("CF_SKIP_SSL_VALIDATION") == "true",
+				Token:             os.Getenv("CF_TOKEN"),
+				UserAgent:         os.Getenv("CF_USER_AGENT"),
+				HttpClient: &http.Client{
+					Timeout: 30 * time.Second,
+				},
+			},
+			AuditEventsAPIVersion: os.Getenv("CF_AUDIT_EVENTS_API_VERSION"),
+			UAAURL:                os.Getenv("UAA_URL"),
+		})
+	}
+
+	names := map[string]bool{}
+	for i := range foundations {
+		foundation := &foundations[i]
+		if names[foundation.Name] {
+			panic(fmt.Errorf("FOUNDATIONS: foundation %q is configured more than once", foundation.Name))
+		}
+		names[foundation.Name] = true
+
+		if foundation.AuditEventsAPIVersion == "" {
+			foundation.AuditEventsAPIVersion = "v2"
+		}
+	}
+	return foundations
+}
+
+// checkUnnamedFoundation returns an error if there are events stored before
+// foundations could be named, but no foundation is unnamed, unless the
+// unnamed foundation has been retired. Naming the foundation those events
+// came from would collect all of its events again, and store them a second
+// time under the new name.
+func checkUnnamedFoundation(cfg Config, eventDB db.EventDB) error {
+	if cfg.UnnamedFoundationRetired {
+		return nil
+	}
+	for _, foundation := range cfg.Foundations {
+		if foundation.Name == "" {
+			return nil
+		}
+	}
+	latest, err := eventDB.GetLatestCFEventTime("")
+	if err != nil {
+		return err
+	}
+	if latest.After(time.Unix(0, 0)) {
+		return fmt.Errorf(
+			"there are events without a foundation, from before foundations could be named, but every foundation has a name: " +
+				"leave CF_FOUNDATION unset if the CF_* foundation is the one they came from, " +
+				"or set UNNAMED_FOUNDATION_RETIRED=true if they came from a foundation which is no longer collected from",
+		)
+	}
+	return nil
+}
+
+// getEnvIfNamed returns the value of the environment variable k, or "" if k
+// is ""
+func getEnvIfNamed(k string) string {
+	if k == "" {
+		return ""
+	}
+	return os.Getenv(k)
+}
+
+func getArchiveS3Config() archive.S3Config {
+	region := getEnvWithDefaultString("ARCHIVE_S3_REGION", "eu-west-2")
+	return archive.S3Config{
+		Endpoint:        getEnvWithDefaultString("ARCHIVE_S3_ENDPOINT", "https://s3."+region+".amazonaws.com"),
+		Region:          region,
+		Bucket:          os.Getenv("ARCHIVE_S3_BUCKET"),
+		AccessKeyID:     os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("ARCHIVE_S3_SECRET_ACCESS_KEY"),
+	}
+}
+
+// getAlertRules reads the alert rules from the JSON file at ALERT_RULES_FILE,
+// if it is set
+func getAlertRules() []alerts.Rule {
+	filename := os.Getenv("ALERT_RULES_FILE")
+	if filename == "" {
+		return nil
+	}
+	rules, err := alerts.LoadRules(filename)
+	if err != nil {
+		panic(fmt.Errorf("ALERT_RULES_FILE: %s", err))
+	}
+	return rules
+}
+
+// getNotificationsConfig reads the notification channels and silences from
+// the JSON file at NOTIFICATIONS_FILE, if it is set, along with the secrets
+// their configuration names environment variables for
+func getNotificationsConfig() notifiers.Config {
+	filename := os.Getenv("NOTIFICATIONS_FILE")
+	if filename == "" {
+		return notifiers.Config{}
+	}
+	cfg, err := notifiers.LoadConfig(filename)
+	if err != nil {
+		panic(fmt.Errorf("NOTIFICATIONS_FILE: %s", err))
+	}
+
+	for i := range cfg.Channels {
+		channel := &cfg.Channels[i]
+		if env := channel.Webhook.SecretEnv; env != "" {
+			channel.Webhook.Secret = []byte(os.Getenv(env))
+		}
+		if env := channel.Slack.URLEnv; env != "" {
+			channel.Slack.URL = os.Getenv(env)
+		}
+		if env := channel.Email.PasswordEnv; env != "" {
+			channel.Email.Password = os.Getenv(env)
+		}
+	}
+
+	cfg, err = notifiers.ValidateConfig(cfg)
+	if err != nil {
+		panic(fmt.Errorf("NOTIFICATIONS_FILE: %s", err))
+	}
+	return cfg
+}
+
 func getEnvWithDefaultDuration(k string, def time.Duration) time.Duration {
 	v := getEnvWithDefaultString(k, "")
 	if v == "" {
@@ -84,6 +367,20 @@ func getEnvWithDefaultString(k string, def string) string {
 	return v
 }
 
+func getEnvWithDefaultList(k string, def []string) []string {
+	v := getEnvWithDefaultString(k, "")
+	if v == "" {
+		return def
+	}
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvWithDefaultInt(k string, def uint) uint {
 	v := os.Getenv(k)
 	if v == "" {
@@ -96,6 +393,42 @@ func getEnvWithDefaultInt(k string, def uint) uint {
 	return uint(d)
 }
 
+// getSinkConfigs reads the sinks to ship events to from SHIPPERS, a JSON list
+// of shippers.SinkConfig. Secrets are read from the environment variables the
+// sinks name. For compatibility, SPLUNK_API_KEY and SPLUNK_HEC_ENDPOINT_URL
+// add a Splunk sink using the original cursor name.
+func getSinkConfigs() []shippers.SinkConfig {
+	sinks := []shippers.SinkConfig{}
+	if v := os.Getenv("SHIPPERS"); v != "" {
+		decoder := json.NewDecoder(strings.NewReader(v))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&sinks); err != nil {
+			panic(fmt.Errorf("SHIPPERS: %s", err))
+		}
+	}
+
+	splunkAPIKey := os.Getenv("SPLUNK_API_KEY")
+	splunkURL := os.Getenv("SPLUNK_HEC_ENDPOINT_URL")
+	if splunkAPIKey != "" && splunkURL != "" {
+		sinks = append(sinks, shippers.LegacySplunkSinkConfig(splunkURL, splunkAPIKey))
+	}
+
+	for i := range sinks {
+		if env := sinks[i].Splunk.APIKeyEnv; env != "" {
+			sinks[i].Splunk.APIKey = os.Getenv(env)
+		}
+		if env := sinks[i].Redaction.HMACKeyEnv; env != "" {
+			sinks[i].Redaction.HMACKey = []byte(os.Getenv(env))
+		}
+	}
+
+	sinks, err := shippers.ValidateSinkConfigs(sinks)
+	if err != nil {
+		panic(err)
+	}
+	return sinks
+}
+
 func getDefaultLogger() lager.Logger {
 	logger := lager.NewLogger("paas-auditor")
 	logLevel := lager.INFO
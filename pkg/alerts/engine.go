@@ -0,0 +1,255 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// EngineName identifies the engine's cursor in the database
+const EngineName = "alert-rules"
+
+var errReplayed = errors.New("replayed")
+
+// minStaleAge is the least time after an event was created that it is too
+// old to be evaluated against a rule, for rules with a shorter window or none.
+// It leaves time for events to be collected.
+const minStaleAge = time.Hour
+
+// Engine evaluates each newly stored event against the alert rules, in the
+// order events were stored, and records an alert whenever a rule's threshold
+// is met. Alerts and the engine's cursor are stored together, so each alert
+// is recorded once. The first time the engine runs, it starts from the latest
+// stored event. Events created longer ago than a rule's window, or
+// minStaleAge if that is longer, are not evaluated against the rule, so that
+// old events do not raise alerts as if they had just happened.
+//
+// Events counting towards thresholds are kept in memory. When the engine
+// starts, or after an error, it evaluates the events already evaluated within
+// the longest window again, without recording alerts, to rebuild them.
+type Engine struct {
+	schedule time.Duration
+	rules    []Rule
+	logger   lager.Logger
+	eventDB  db.EventDB
+
+	maxWindow time.Duration
+	pending   map[pendingKey][]pendingEvent
+	replayed  bool
+}
+
+type pendingKey struct {
+	rule     string
+	groupKey string
+}
+
+// pendingEvent is an event which matched a rule but has not yet triggered an
+// alert
+type pendingEvent struct {
+	id        int64
+	guid      string
+	createdAt time.Time
+}
+
+func NewEngine(
+	schedule time.Duration,
+	rules []Rule,
+	logger lager.Logger,
+	eventDB db.EventDB,
+) *Engine {
+	logger = logger.Session("alert-engine", lager.Data{"rules": len(rules)})
+	maxWindow := time.Duration(0)
+	for _, rule := range rules {
+		if rule.Threshold.Window.Duration > maxWindow {
+			maxWindow = rule.Threshold.Window.Duration
+		}
+	}
+	return &Engine{
+		schedule:  schedule,
+		rules:     rules,
+		logger:    logger,
+		eventDB:   eventDB,
+		maxWindow: maxWindow,
+		pending:   map[pendingKey][]pendingEvent{},
+	}
+}
+
+func (e *Engine) Run(ctx context.Context) error {
+	lsession := e.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(e.schedule):
+			if err := e.evaluateNewEvents(ctx, lsession); err != nil {
+				AlertEngineErrorsTotal.Inc()
+				// Evaluate the same events again next time, from scratch
+				e.pending = map[pendingKey][]pendingEvent{}
+				e.replayed = false
+			}
+		}
+	}
+}
+
+func (e *Engine) evaluateNewEvents(ctx context.Context, lsession lager.Logger) error {
+	if !e.replayed {
+		cursor, err := e.eventDB.InitAlertCursor(EngineName)
+		if err != nil {
+			lsession.Error("err-init-alert-cursor", err)
+			return err
+		}
+		if err := e.replay(ctx, lsession, cursor); err != nil {
+			return err
+		}
+		e.replayed = true
+	}
+
+	alerts := []db.Alert{}
+	var lastEvaluated *db.CFAuditEvent
+	err := e.eventDB.StreamUnevaluatedCFAuditEvents(ctx, EngineName, func(event db.CFAuditEvent) error {
+		alerts = append(alerts, e.evaluate(lsession, event)...)
+		lastEvaluated = &event
+		AlertEngineEventsEvaluatedTotal.Inc()
+		return nil
+	})
+	if err != nil {
+		lsession.Error("err-stream-unevaluated-cf-audit-events", err)
+		return err
+	}
+	if lastEvaluated == nil {
+		return nil
+	}
+
+	stored, err := e.eventDB.StoreAlerts(EngineName, alerts, *lastEvaluated)
+	if err != nil {
+		lsession.Error("err-store-alerts", err)
+		return err
+	}
+	for _, alert := range stored {
+		AlertsTriggeredTotal.WithLabelValues(alert.Rule).Inc()
+		lsession.Info("alert", lager.Data{
+			"alert_id":    alert.ID,
+			"rule":        alert.Rule,
+			"group_key":   alert.GroupKey,
+			"event_guids": alert.EventGUIDs,
+		})
+	}
+	e.prune(time.Now())
+	lsession.Info("evaluated-events", lager.Data{
+		"last_evaluated_id": lastEvaluated.ID,
+		"alerts":            len(stored),
+	})
+	return nil
+}
+
+// replay evaluates the events which were already evaluated, and were created
+// within the longest window, again, so that the events counting towards
+// thresholds are the same as before the engine started
+func (e *Engine) replay(ctx context.Context, lsession lager.Logger, cursor int64) error {
+	if e.maxWindow == 0 || cursor == 0 {
+		return nil
+	}
+
+	replayed := 0
+	err := e.eventDB.StreamCFAuditEvents(ctx, db.RawEventFilter{
+		Reverse:   true,
+		StartTime: time.Now().Add(-e.maxWindow),
+	}, func(event db.CFAuditEvent) error {
+		if event.ID > cursor {
+			return errReplayed
+		}
+		e.evaluate(lsession, event)
+		replayed++
+		return nil
+	})
+	if err != nil && err != errReplayed {
+		lsession.Error("err-replay", err)
+		return err
+	}
+	lsession.Info("replayed", lager.Data{"events": replayed, "cursor": cursor})
+	return nil
+}
+
+// prune forgets pending events which were created longer ago than their
+// rule's window, as no event created since could count along with them
+func (e *Engine) prune(now time.Time) {
+	windows := map[string]time.Duration{}
+	for _, rule := range e.rules {
+		windows[rule.Name] = rule.Threshold.Window.Duration
+	}
+	for key, pending := range e.pending {
+		for len(pending) > 0 && now.Sub(pending[0].createdAt) > windows[key.rule] {
+			pending = pending[1:]
+		}
+		if len(pending) == 0 {
+			delete(e.pending, key)
+		} else {
+			e.pending[key] = pending
+		}
+	}
+}
+
+// evaluate adds event to the pending events of each rule it matches, and
+// returns an alert for each rule whose threshold it meets
+func (e *Engine) evaluate(lsession lager.Logger, event db.CFAuditEvent) []db.Alert {
+	createdAt, err := time.Parse(time.RFC3339, event.CreatedAt)
+	if err != nil {
+		// Not fatal
+		lsession.Error("err-parse-event-time", err, lager.Data{
+			"guid":           event.GUID,
+			"raw-created-at": event.CreatedAt,
+		})
+		return nil
+	}
+
+	age := time.Since(createdAt)
+	alerts := []db.Alert{}
+	for _, rule := range e.rules {
+		window := rule.Threshold.Window.Duration
+		if age > window && age > minStaleAge {
+			continue
+		}
+		if !rule.Matches(event.Event) {
+			continue
+		}
+		key := pendingKey{rule.Name, rule.groupKey(event.Event)}
+
+		// Events may not be stored in the order they were created in
+		pending := append(e.pending[key], pendingEvent{event.ID, event.GUID, createdAt})
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].createdAt.Before(pending[j].createdAt)
+		})
+		latest := pending[len(pending)-1].createdAt
+		for len(pending) > 0 && latest.Sub(pending[0].createdAt) > window {
+			pending = pending[1:]
+		}
+
+		if len(pending) < rule.Threshold.Count {
+			e.pending[key] = pending
+			continue
+		}
+		alert := db.Alert{
+			Rule:         rule.Name,
+			GroupKey:     key.groupKey,
+			FirstEventAt: pending[0].createdAt,
+			LastEventAt:  latest,
+		}
+		for _, p := range pending {
+			alert.EventIDs = append(alert.EventIDs, p.id)
+			alert.EventGUIDs = append(alert.EventGUIDs, p.guid)
+		}
+		alerts = append(alerts, alert)
+		delete(e.pending, key)
+	}
+	return alerts
+}
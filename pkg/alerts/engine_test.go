@@ -0,0 +1,273 @@
+package alerts_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/alerts"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Engine Run", func() {
+	var (
+		logger  lager.Logger
+		eventDB *dbfakes.FakeEventDB
+		rules   []alerts.Rule
+
+		unevaluated []db.CFAuditEvent
+		evaluated   []db.CFAuditEvent
+
+		alertEngineErrorsTotal float64
+	)
+
+	at := func(ago time.Duration) string {
+		return time.Now().Add(-ago).UTC().Format(time.RFC3339)
+	}
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("alert-engine-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		By("checking the value of the metrics to test against them later")
+		alertEngineErrorsTotal = h.CurrentMetricValue(alerts.AlertEngineErrorsTotal)
+
+		var err error
+		rules, err = alerts.ValidateRules([]alerts.Rule{
+			{
+				Name:   "ssh-into-production",
+				Types:  []string{"audit.app.ssh-authorized"},
+				Spaces: []string{"production-space-guid"},
+			},
+			{
+				Name:  "service-instances-deleted",
+				Types: []string{"audit.service_instance.delete"},
+				Threshold: alerts.Threshold{
+					Count:   3,
+					Window:  alerts.Duration{Duration: 10 * time.Minute},
+					GroupBy: alerts.GroupByActor,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		unevaluated = nil
+		evaluated = nil
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StreamUnevaluatedCFAuditEventsStub = func(_ context.Context, _ string, fn func(db.CFAuditEvent) error) error {
+			// Only the first run finds any events
+			if eventDB.StreamUnevaluatedCFAuditEventsCallCount() > 1 {
+				return nil
+			}
+			for _, event := range unevaluated {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		eventDB.StreamCFAuditEventsStub = func(_ context.Context, _ db.RawEventFilter, fn func(db.CFAuditEvent) error) error {
+			for _, event := range evaluated {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		eventDB.StoreAlertsStub = func(_ string, toStore []db.Alert, _ db.CFAuditEvent) ([]db.Alert, error) {
+			stored := []db.Alert{}
+			for i, alert := range toStore {
+				alert.ID = int64(i + 1)
+				alert.TriggeredAt = time.Now()
+				stored = append(stored, alert)
+			}
+			return stored, nil
+		}
+	})
+
+	event := func(id int64, eventType, actor, space, createdAt string) db.CFAuditEvent {
+		return db.CFAuditEvent{ID: id, Event: cfclient.Event{
+			GUID:      fmt.Sprintf("guid-%d", id),
+			Type:      eventType,
+			Actor:     actor,
+			SpaceGUID: space,
+			CreatedAt: createdAt,
+		}}
+	}
+
+	run := func(ctx context.Context, engine *alerts.Engine) (wait func() error) {
+		var (
+			runError error
+			runWG    sync.WaitGroup
+		)
+		runWG.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			runError = engine.Run(ctx)
+			runWG.Done()
+		}()
+		return func() error {
+			runWG.Wait()
+			return runError
+		}
+	}
+
+	It("stores an alert for each event matching a rule without a threshold", func() {
+		unevaluated = []db.CFAuditEvent{
+			event(7, "audit.app.ssh-authorized", "alice", "production-space-guid", at(time.Minute)),
+			event(8, "audit.app.ssh-authorized", "alice", "staging-space-guid", at(time.Minute)),
+			event(9, "audit.app.update", "alice", "production-space-guid", at(time.Minute)),
+		}
+		alertsTriggeredTotal := h.CurrentMetricValue(
+			alerts.AlertsTriggeredTotal.WithLabelValues("ssh-into-production"),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx, alerts.NewEngine(10*time.Millisecond, rules, logger, eventDB))
+
+		By("waiting for the alerts to be stored")
+		Eventually(eventDB.StoreAlertsCallCount, "100ms", "1ms").Should(Equal(1))
+		name, stored, lastEvaluated := eventDB.StoreAlertsArgsForCall(0)
+		Expect(name).To(Equal(alerts.EngineName))
+		Expect(lastEvaluated.ID).To(Equal(int64(9)))
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].Rule).To(Equal("ssh-into-production"))
+		Expect(stored[0].EventIDs).To(Equal([]int64{7}))
+		Expect(stored[0].EventGUIDs).To(Equal([]string{"guid-7"}))
+
+		By("checking the metrics were incremented")
+		Expect(alerts.AlertsTriggeredTotal.WithLabelValues("ssh-into-production")).To(
+			h.MetricIncrementedBy(alertsTriggeredTotal, "==", 1),
+		)
+
+		By("checking nothing is stored when there are no new events")
+		Consistently(eventDB.StoreAlertsCallCount, "50ms", "1ms").Should(Equal(1))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("does not alert on events created longer ago than a rule's window", func() {
+		unevaluated = []db.CFAuditEvent{
+			event(7, "audit.app.ssh-authorized", "alice", "production-space-guid", at(2*time.Hour)),
+			event(8, "audit.service_instance.delete", "alice", "", at(3*time.Hour)),
+			event(9, "audit.service_instance.delete", "alice", "", at(3*time.Hour)),
+			event(10, "audit.service_instance.delete", "alice", "", at(3*time.Hour)),
+			event(11, "audit.app.ssh-authorized", "alice", "production-space-guid", at(time.Minute)),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx, alerts.NewEngine(10*time.Millisecond, rules, logger, eventDB))
+
+		Eventually(eventDB.StoreAlertsCallCount, "100ms", "1ms").Should(Equal(1))
+		_, stored, lastEvaluated := eventDB.StoreAlertsArgsForCall(0)
+		Expect(lastEvaluated.ID).To(Equal(int64(11)))
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].EventIDs).To(Equal([]int64{11}))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("stores an alert when a threshold is met within the window for the same group", func() {
+		unevaluated = []db.CFAuditEvent{
+			event(10, "audit.service_instance.delete", "alice", "", at(30*time.Minute)),
+			event(11, "audit.service_instance.delete", "alice", "", at(3*time.Minute)),
+			event(12, "audit.service_instance.delete", "bob", "", at(3*time.Minute)),
+			event(13, "audit.service_instance.delete", "alice", "", at(2*time.Minute)),
+			event(14, "audit.service_instance.delete", "bob", "", at(2*time.Minute)),
+			event(15, "audit.service_instance.delete", "alice", "", at(1*time.Minute)),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx, alerts.NewEngine(10*time.Millisecond, rules, logger, eventDB))
+
+		Eventually(eventDB.StoreAlertsCallCount, "100ms", "1ms").Should(Equal(1))
+		_, stored, lastEvaluated := eventDB.StoreAlertsArgsForCall(0)
+		Expect(lastEvaluated.ID).To(Equal(int64(15)))
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].Rule).To(Equal("service-instances-deleted"))
+		Expect(stored[0].GroupKey).To(Equal("alice"))
+		Expect(stored[0].EventIDs).To(Equal([]int64{11, 13, 15}))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("counts events evaluated before it started towards thresholds, without alerting on them again", func() {
+		eventDB.InitAlertCursorReturns(12, nil)
+		evaluated = []db.CFAuditEvent{
+			event(11, "audit.service_instance.delete", "alice", "", at(3*time.Minute)),
+			event(12, "audit.service_instance.delete", "alice", "", at(2*time.Minute)),
+			event(13, "audit.service_instance.delete", "alice", "", at(1*time.Minute)),
+		}
+		unevaluated = []db.CFAuditEvent{
+			event(13, "audit.service_instance.delete", "alice", "", at(1*time.Minute)),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx, alerts.NewEngine(10*time.Millisecond, rules, logger, eventDB))
+
+		Eventually(eventDB.StoreAlertsCallCount, "100ms", "1ms").Should(Equal(1))
+		Expect(eventDB.InitAlertCursorArgsForCall(0)).To(Equal(alerts.EngineName))
+		_, filter, _ := eventDB.StreamCFAuditEventsArgsForCall(0)
+		Expect(filter.Reverse).To(BeTrue())
+		Expect(filter.StartTime).To(BeTemporally("~", time.Now().Add(-10*time.Minute), time.Second))
+
+		_, stored, _ := eventDB.StoreAlertsArgsForCall(0)
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].EventIDs).To(Equal([]int64{11, 12, 13}))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("evaluates the same events again after an error", func() {
+		unevaluated = []db.CFAuditEvent{
+			event(7, "audit.app.ssh-authorized", "alice", "production-space-guid", at(time.Minute)),
+		}
+		eventDB.StreamUnevaluatedCFAuditEventsStub = func(_ context.Context, _ string, fn func(db.CFAuditEvent) error) error {
+			for _, event := range unevaluated {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		storeAlertsStub := eventDB.StoreAlertsStub
+		eventDB.StoreAlertsStub = func(name string, toStore []db.Alert, lastEvaluated db.CFAuditEvent) ([]db.Alert, error) {
+			if eventDB.StoreAlertsCallCount() == 1 {
+				return nil, fmt.Errorf("some-error")
+			}
+			unevaluated = nil
+			return storeAlertsStub(name, toStore, lastEvaluated)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx, alerts.NewEngine(10*time.Millisecond, rules, logger, eventDB))
+
+		Eventually(eventDB.StoreAlertsCallCount, "100ms", "1ms").Should(Equal(2))
+		Expect(alerts.AlertEngineErrorsTotal).To(
+			h.MetricIncrementedBy(alertEngineErrorsTotal, "==", 1),
+		)
+		_, first, _ := eventDB.StoreAlertsArgsForCall(0)
+		_, second, _ := eventDB.StoreAlertsArgsForCall(1)
+		Expect(second).To(Equal(first))
+
+		By("checking the threshold state was rebuilt after the error")
+		Expect(eventDB.InitAlertCursorCallCount()).To(Equal(2))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+})
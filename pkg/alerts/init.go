@@ -0,0 +1,5 @@
+package alerts
+
+func init() {
+	initMetrics()
+}
@@ -0,0 +1,28 @@
+package alerts
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	AlertsTriggeredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "alerts_triggered_total",
+		Help: "Number of alerts triggered by stored events matching an alert rule",
+	}, []string{"rule"})
+
+	AlertEngineEventsEvaluatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "alert_engine_events_evaluated_total",
+		Help: "Number of stored events evaluated against the alert rules",
+	})
+
+	AlertEngineErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "alert_engine_errors_total",
+		Help: "Number of errors encountered while evaluating stored events against the alert rules",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(AlertsTriggeredTotal)
+	prometheus.MustRegister(AlertEngineEventsEvaluatedTotal)
+	prometheus.MustRegister(AlertEngineErrorsTotal)
+}
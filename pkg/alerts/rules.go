@@ -0,0 +1,259 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+const (
+	GroupByActor        = "actor"
+	GroupByActee        = "actee"
+	GroupByOrganization = "organization"
+	GroupBySpace        = "space"
+)
+
+// RulesFile is the format of the file alert rules are loaded from
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule matches events which meet all of its conditions. Each condition
+// matches if the event has any of its values. Conditions with no values
+// match every event.
+type Rule struct {
+	// Name identifies the rule in recorded alerts and metrics
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Types are event types, in which * matches any characters, eg
+	// audit.user.organization_*_add
+	Types []string `json:"types"`
+
+	// Actors are the GUIDs, names or usernames of actors
+	Actors []string `json:"actors"`
+
+	// Organizations and Spaces are GUIDs
+	Organizations []string `json:"organizations"`
+	Spaces        []string `json:"spaces"`
+
+	// Metadata conditions must all match
+	Metadata []MetadataCondition `json:"metadata"`
+
+	// Threshold is how many matching events it takes to trigger an alert.
+	// By default each matching event triggers one.
+	Threshold Threshold `json:"threshold"`
+}
+
+// MetadataCondition matches a value in an event's metadata
+type MetadataCondition struct {
+	// Path is a dot separated path into the event's metadata, eg
+	// request.state. If the path goes through an array, any of its elements
+	// can match.
+	Path string `json:"path"`
+
+	// Values the value can be, compared as strings. Values which are not
+	// strings are compared by their JSON, eg true or 3. With no values, the
+	// condition matches if the path exists.
+	Values []string `json:"values"`
+}
+
+// Threshold triggers an alert when Count events match a rule within Window
+// of each other, by their created_at, counted separately for each value of
+// GroupBy
+type Threshold struct {
+	Count   int      `json:"count"`
+	Window  Duration `json:"window"`
+	GroupBy string   `json:"group_by"`
+}
+
+// LoadRules reads rules from a JSON file in the format of RulesFile, and
+// validates them
+func LoadRules(filename string) ([]Rule, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	rulesFile := RulesFile{}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rulesFile); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	rules, err := ValidateRules(rulesFile.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return rules, nil
+}
+
+// ValidateRules checks that every rule has a unique name and can be
+// evaluated, and fills in defaults
+func ValidateRules(rules []Rule) ([]Rule, error) {
+	validated := make([]Rule, len(rules))
+	names := map[string]bool{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q: name is used more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if len(rule.Types)+len(rule.Actors)+len(rule.Organizations)+len(rule.Spaces)+len(rule.Metadata) == 0 {
+			return nil, fmt.Errorf("rule %q: at least one of types, actors, organizations, spaces and metadata is required", rule.Name)
+		}
+		for _, pattern := range rule.Types {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %q: type %q is not a valid pattern", rule.Name, pattern)
+			}
+		}
+		for _, condition := range rule.Metadata {
+			if condition.Path == "" {
+				return nil, fmt.Errorf("rule %q: metadata path is required", rule.Name)
+			}
+		}
+
+		switch rule.Threshold.GroupBy {
+		case "", GroupByActor, GroupByActee, GroupByOrganization, GroupBySpace:
+		default:
+			return nil, fmt.Errorf(
+				"rule %q: group_by must be %q, %q, %q or %q, not %q", rule.Name,
+				GroupByActor, GroupByActee, GroupByOrganization, GroupBySpace, rule.Threshold.GroupBy,
+			)
+		}
+		if rule.Threshold.Count < 0 {
+			return nil, fmt.Errorf("rule %q: threshold count must not be negative", rule.Name)
+		} else if rule.Threshold.Count == 0 {
+			rule.Threshold.Count = 1
+		}
+		if rule.Threshold.Count > 1 && rule.Threshold.Window.Duration <= 0 {
+			return nil, fmt.Errorf("rule %q: a threshold count of more than 1 needs a window", rule.Name)
+		}
+		validated[i] = rule
+	}
+	return validated, nil
+}
+
+// Matches reports whether event meets all of the rule's conditions
+func (r Rule) Matches(event cfclient.Event) bool {
+	if len(r.Types) > 0 && !anyMatch(r.Types, func(pattern string) bool {
+		matched, _ := path.Match(pattern, event.Type)
+		return matched
+	}) {
+		return false
+	}
+	if len(r.Actors) > 0 && !anyMatch(r.Actors, func(actor string) bool {
+		return actor == event.Actor || actor == event.ActorName || actor == event.ActorUsername
+	}) {
+		return false
+	}
+	if len(r.Organizations) > 0 && !anyMatch(r.Organizations, func(guid string) bool {
+		return guid == event.OrganizationGUID
+	}) {
+		return false
+	}
+	if len(r.Spaces) > 0 && !anyMatch(r.Spaces, func(guid string) bool {
+		return guid == event.SpaceGUID
+	}) {
+		return false
+	}
+	for _, condition := range r.Metadata {
+		if !condition.matches(event.Metadata, strings.Split(condition.Path, ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupKey is the value of the event which the rule's threshold counts by
+func (r Rule) groupKey(event cfclient.Event) string {
+	switch r.Threshold.GroupBy {
+	case GroupByActor:
+		return event.Actor
+	case GroupByActee:
+		return event.Actee
+	case GroupByOrganization:
+		return event.OrganizationGUID
+	case GroupBySpace:
+		return event.SpaceGUID
+	default:
+		return ""
+	}
+}
+
+func (c MetadataCondition) matches(value interface{}, path []string) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, element := range v {
+			if c.matches(element, path) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return c.matchesValue(v)
+		}
+		child, ok := v[path[0]]
+		if !ok {
+			return false
+		}
+		return c.matches(child, path[1:])
+	default:
+		if len(path) > 0 {
+			return false
+		}
+		return c.matchesValue(v)
+	}
+}
+
+func (c MetadataCondition) matchesValue(value interface{}) bool {
+	if len(c.Values) == 0 {
+		return true
+	}
+	s, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		s = string(encoded)
+	}
+	return anyMatch(c.Values, func(v string) bool { return v == s })
+}
+
+func anyMatch(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration is a time.Duration which is configured in JSON as a string such as
+// "10m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
@@ -0,0 +1,163 @@
+package alerts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/alerts"
+)
+
+var _ = Describe("Rules", func() {
+	var event cfclient.Event
+
+	BeforeEach(func() {
+		event = cfclient.Event{
+			GUID:             "a8f3b7d0-0e5c-4a0b-9d3e-1f0c3c6c4e11",
+			Type:             "audit.app.ssh-authorized",
+			CreatedAt:        "2020-01-02T03:04:05Z",
+			Actor:            "some-user-guid",
+			ActorType:        "user",
+			ActorName:        "someone@example.com",
+			ActorUsername:    "someone@example.com",
+			Actee:            "some-app-guid",
+			ActeeType:        "app",
+			OrganizationGUID: "some-org-guid",
+			SpaceGUID:        "production-space-guid",
+			Metadata: map[string]interface{}{
+				"index": float64(0),
+				"request": map[string]interface{}{
+					"state": "STARTED",
+					"routes": []interface{}{
+						map[string]interface{}{"host": "admin"},
+						map[string]interface{}{"host": "www"},
+					},
+				},
+			},
+		}
+	})
+
+	Describe("Matches", func() {
+		It("matches events which meet every condition", func() {
+			rule := alerts.Rule{
+				Types:         []string{"audit.app.ssh-authorized"},
+				Actors:        []string{"someone@example.com"},
+				Organizations: []string{"some-org-guid"},
+				Spaces:        []string{"production-space-guid", "staging-space-guid"},
+				Metadata:      []alerts.MetadataCondition{{Path: "request.state", Values: []string{"STARTED"}}},
+			}
+			Expect(rule.Matches(event)).To(BeTrue())
+
+			rule.Spaces = []string{"staging-space-guid"}
+			Expect(rule.Matches(event)).To(BeFalse())
+		})
+
+		It("matches types with wildcards", func() {
+			Expect(alerts.Rule{Types: []string{"audit.app.*"}}.Matches(event)).To(BeTrue())
+			Expect(alerts.Rule{Types: []string{"audit.user.organization_*_add"}}.Matches(event)).To(BeFalse())
+
+			event.Type = "audit.user.organization_manager_add"
+			Expect(alerts.Rule{Types: []string{"audit.user.organization_*_add"}}.Matches(event)).To(BeTrue())
+		})
+
+		It("matches actors by GUID, name or username", func() {
+			for _, actor := range []string{"some-user-guid", "someone@example.com"} {
+				Expect(alerts.Rule{Actors: []string{actor}}.Matches(event)).To(BeTrue(), actor)
+			}
+			Expect(alerts.Rule{Actors: []string{"someone-else"}}.Matches(event)).To(BeFalse())
+		})
+
+		It("matches metadata values which are not strings by their JSON", func() {
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "index", Values: []string{"0"}}}}.Matches(event)).To(BeTrue())
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "index", Values: []string{"1"}}}}.Matches(event)).To(BeFalse())
+		})
+
+		It("matches metadata in any element of an array", func() {
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "request.routes.host", Values: []string{"admin"}}}}.Matches(event)).To(BeTrue())
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "request.routes.host", Values: []string{"api"}}}}.Matches(event)).To(BeFalse())
+		})
+
+		It("matches metadata paths which exist when there are no values", func() {
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "request.state"}}}.Matches(event)).To(BeTrue())
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "request.name"}}}.Matches(event)).To(BeFalse())
+			Expect(alerts.Rule{Metadata: []alerts.MetadataCondition{{Path: "request.state.more"}}}.Matches(event)).To(BeFalse())
+		})
+	})
+
+	Describe("ValidateRules", func() {
+		It("defaults the threshold to each matching event", func() {
+			rules, err := alerts.ValidateRules([]alerts.Rule{{Name: "a", Types: []string{"audit.app.create"}}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules[0].Threshold.Count).To(Equal(1))
+		})
+
+		It("rejects rules which cannot be evaluated", func() {
+			for _, rules := range [][]alerts.Rule{
+				{{Types: []string{"audit.app.create"}}},
+				{{Name: "a", Types: []string{"audit.app.create"}}, {Name: "a", Types: []string{"audit.app.update"}}},
+				{{Name: "a"}},
+				{{Name: "a", Types: []string{"audit.app.[create"}}},
+				{{Name: "a", Metadata: []alerts.MetadataCondition{{Values: []string{"x"}}}}},
+				{{Name: "a", Types: []string{"audit.app.create"}, Threshold: alerts.Threshold{Count: 5}}},
+				{{Name: "a", Types: []string{"audit.app.create"}, Threshold: alerts.Threshold{Count: -1}}},
+				{{Name: "a", Types: []string{"audit.app.create"}, Threshold: alerts.Threshold{GroupBy: "user"}}},
+			} {
+				_, err := alerts.ValidateRules(rules)
+				Expect(err).To(HaveOccurred(), "%+v", rules)
+			}
+		})
+	})
+
+	Describe("LoadRules", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "alert-rules")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		write := func(contents string) string {
+			filename := filepath.Join(dir, "rules.json")
+			Expect(ioutil.WriteFile(filename, []byte(contents), 0600)).To(Succeed())
+			return filename
+		}
+
+		It("loads rules from a JSON file", func() {
+			rules, err := alerts.LoadRules(write(`{"rules": [
+				{"name": "org-manager-added", "types": ["audit.user.organization_manager_add"]},
+				{
+					"name": "service-instances-deleted",
+					"types": ["audit.service_instance.delete"],
+					"threshold": {"count": 5, "window": "10m", "group_by": "actor"}
+				}
+			]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[1].Threshold).To(Equal(alerts.Threshold{
+				Count:   5,
+				Window:  alerts.Duration{Duration: 10 * time.Minute},
+				GroupBy: alerts.GroupByActor,
+			}))
+		})
+
+		It("rejects unknown fields, so that typos do not go unnoticed", func() {
+			_, err := alerts.LoadRules(write(`{"rules": [{"name": "a", "type": ["audit.app.create"]}]}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "type"`)))
+		})
+
+		It("rejects invalid rules", func() {
+			_, err := alerts.LoadRules(write(`{"rules": [{"name": "a"}]}`))
+			Expect(err).To(MatchError(ContainSubstring("at least one of")))
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const LatestCheckpointPath = "/checkpoints/latest"
+
+type checkpointResponse struct {
+	HeadID    int64     `json:"head_id"`
+	ChainHash string    `json:"chain_hash"`
+	SignedAt  time.Time `json:"signed_at"`
+	KeyID     string    `json:"key_id"`
+	Signature string    `json:"signature"`
+	PublicKey string    `json:"public_key"`
+
+	ErasureSeq       int64  `json:"erasure_seq,omitempty"`
+	ErasureChainHash string `json:"erasure_chain_hash,omitempty"`
+}
+
+// CheckpointHandler serves the most recent signed checkpoint of the hash
+// chain over stored events. It only reveals the number of events stored, so
+// it does not need authentication.
+type CheckpointHandler struct {
+	logger    lager.Logger
+	eventDB   db.EventDB
+	publicKey ed25519.PublicKey
+}
+
+func NewCheckpointHandler(logger lager.Logger, eventDB db.EventDB, publicKey ed25519.PublicKey) *CheckpointHandler {
+	logger = logger.Session("checkpoint-handler")
+	return &CheckpointHandler{logger, eventDB, publicKey}
+}
+
+func (h *CheckpointHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	cp, err := h.eventDB.GetLatestChainCheckpoint()
+	if err != nil {
+		h.logger.Error("err-get-latest-chain-checkpoint", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if cp == nil {
+		writeError(w, http.StatusNotFound, "no checkpoints yet")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, checkpointResponse{
+		HeadID:    cp.HeadID,
+		ChainHash: hex.EncodeToString(cp.ChainHash),
+		SignedAt:  cp.SignedAt.UTC(),
+		KeyID:     cp.KeyID,
+		Signature: base64.StdEncoding.EncodeToString(cp.Signature),
+		PublicKey: base64.StdEncoding.EncodeToString(h.publicKey),
+
+		ErasureSeq:       cp.ErasureSeq,
+		ErasureChainHash: hex.EncodeToString(cp.ErasureChainHash),
+	})
+}
@@ -0,0 +1,106 @@
+package api_test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/api"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+)
+
+var _ = Describe("CheckpointHandler", func() {
+	var (
+		eventDB *dbfakes.FakeEventDB
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("api-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		publicKey := ed25519.PublicKey([]byte("0123456789abcdef0123456789abcdef"))
+		handler = api.NewCheckpointHandler(logger, eventDB, publicKey)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", api.LatestCheckpointPath, nil))
+		return w
+	}
+
+	It("serves the latest checkpoint along with the public key to check it", func() {
+		eventDB.GetLatestChainCheckpointReturns(&db.ChainCheckpoint{
+			ID:        3,
+			HeadID:    42,
+			ChainHash: []byte{0xab, 0xcd},
+			SignedAt:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			KeyID:     "some-key-id",
+			Signature: []byte("some-signature"),
+		}, nil)
+
+		w := get()
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{
+			"head_id": 42,
+			"chain_hash": "abcd",
+			"signed_at": "2020-01-02T03:04:05Z",
+			"key_id": "some-key-id",
+			"signature": "c29tZS1zaWduYXR1cmU=",
+			"public_key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+		}`))
+	})
+
+	It("serves the head of the chain of erasures the checkpoint signs", func() {
+		eventDB.GetLatestChainCheckpointReturns(&db.ChainCheckpoint{
+			ID:        4,
+			HeadID:    43,
+			ChainHash: []byte{0xab, 0xcd},
+			SignedAt:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			KeyID:     "some-key-id",
+			Signature: []byte("some-signature"),
+
+			ErasureSeq:       2,
+			ErasureChainHash: []byte{0xef, 0x01},
+		}, nil)
+
+		w := get()
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{
+			"head_id": 43,
+			"chain_hash": "abcd",
+			"signed_at": "2020-01-02T03:04:05Z",
+			"key_id": "some-key-id",
+			"signature": "c29tZS1zaWduYXR1cmU=",
+			"public_key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+			"erasure_seq": 2,
+			"erasure_chain_hash": "ef01"
+		}`))
+	})
+
+	It("returns a 404 if there are no checkpoints yet", func() {
+		eventDB.GetLatestChainCheckpointReturns(nil, nil)
+
+		w := get()
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns a 500 if the store fails", func() {
+		eventDB.GetLatestChainCheckpointReturns(nil, fmt.Errorf("connection refused"))
+
+		w := get()
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+		var resp map[string]string
+		Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp["error"]).To(Equal("internal server error"))
+	})
+})
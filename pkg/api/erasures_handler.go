@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const ErasuresPath = "/admin/erasures"
+
+type erasureRequest struct {
+	UserGUID  string `json:"user_guid"`
+	Username  string `json:"username"`
+	Reference string `json:"reference"`
+}
+
+type erasureResponse struct {
+	ID          int64     `json:"id"`
+	Pseudonym   string    `json:"pseudonym"`
+	SubjectType string    `json:"subject_type"`
+	Reference   string    `json:"reference"`
+	RequestedBy string    `json:"requested_by"`
+	EventCount  int64     `json:"event_count"`
+	ArchiveKeys []string  `json:"archive_keys"`
+	ErasedAt    time.Time `json:"erased_at"`
+
+	UnsearchedArchiveKeys []string `json:"unsearched_archive_keys"`
+	DetachedPartitions    []string `json:"detached_partitions"`
+	ShippedTo             []string `json:"shipped_to"`
+}
+
+type erasuresResponse struct {
+	Resources []erasureResponse `json:"resources"`
+}
+
+// ErasuresHandler erases a user's personal data from the stored events, for
+// admins only:
+//
+//	POST /admin/erasures   erases a user, given a user_guid or username and a reference
+//	GET  /admin/erasures   lists the erasures which have been run
+type ErasuresHandler struct {
+	logger  lager.Logger
+	eventDB db.EventDB
+}
+
+func NewErasuresHandler(logger lager.Logger, eventDB db.EventDB) *ErasuresHandler {
+	logger = logger.Session("erasures-handler")
+	return &ErasuresHandler{logger, eventDB}
+}
+
+func (h *ErasuresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !principal.Admin {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listErasures(w)
+	case http.MethodPost:
+		h.eraseUser(w, r, principal)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *ErasuresHandler) eraseUser(w http.ResponseWriter, r *http.Request, principal *auth.Principal) {
+	body := erasureRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	requestedBy := "user:" + principal.UserName
+	if principal.UserName == "" {
+		requestedBy = "client:" + principal.ClientID
+	}
+	request := db.ErasureRequest{
+		UserGUID:    body.UserGUID,
+		Username:    body.Username,
+		Reference:   body.Reference,
+		RequestedBy: requestedBy,
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	erasure, err := h.eventDB.EraseUserFromCFAuditEvents(request)
+	if err != nil {
+		h.logger.Error("err-erase-user-from-cf-audit-events", err, lager.Data{"reference": request.Reference})
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, toErasureResponse(erasure))
+}
+
+func (h *ErasuresHandler) listErasures(w http.ResponseWriter) {
+	erasures, err := h.eventDB.GetCFAuditEventErasures()
+	if err != nil {
+		h.logger.Error("err-get-cf-audit-event-erasures", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	response := erasuresResponse{Resources: []erasureResponse{}}
+	for _, erasure := range erasures {
+		response.Resources = append(response.Resources, toErasureResponse(erasure))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func toErasureResponse(erasure db.Erasure) erasureResponse {
+	return erasureResponse{
+		ID:          erasure.ID,
+		Pseudonym:   erasure.Pseudonym,
+		SubjectType: erasure.SubjectType,
+		Reference:   erasure.Reference,
+		RequestedBy: erasure.RequestedBy,
+		EventCount:  erasure.EventCount,
+		ArchiveKeys: nonNil(erasure.ArchiveKeys),
+		ErasedAt:    erasure.ErasedAt.UTC(),
+
+		UnsearchedArchiveKeys: nonNil(erasure.UnsearchedArchiveKeys),
+		DetachedPartitions:    nonNil(erasure.DetachedPartitions),
+		ShippedTo:             nonNil(erasure.ShippedTo),
+	}
+}
+
+// nonNil returns values, or an empty list if it is nil, so that it is
+// encoded as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
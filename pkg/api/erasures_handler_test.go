@@ -0,0 +1,168 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/api"
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+)
+
+var _ = Describe("ErasuresHandler", func() {
+	var (
+		eventDB   *dbfakes.FakeEventDB
+		handler   http.Handler
+		principal *auth.Principal
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("api-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		handler = api.NewErasuresHandler(logger, eventDB)
+		principal = &auth.Principal{UserID: "admin-user-guid", UserName: "admin@example.com", Admin: true}
+	})
+
+	serve := func(method string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, api.ErasuresPath, strings.NewReader(body))
+		req = req.WithContext(auth.NewContext(req.Context(), principal))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	erasure := db.Erasure{
+		ID:          4,
+		Pseudonym:   "erased-5d1c7a9e-6a4b-4f0e-8c1d-3b2a1f0e9d8c",
+		SubjectType: db.ErasureSubjectUserGUID,
+		Reference:   "ticket-123",
+		RequestedBy: "user:admin@example.com",
+		EventCount:  12,
+		ArchiveKeys: []string{"events/2020/01/02.jsonl.gz"},
+		ErasedAt:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+
+		UnsearchedArchiveKeys: []string{"events/2019/12/01.jsonl.gz"},
+		DetachedPartitions:    []string{"cf_audit_events_2019_01"},
+		ShippedTo:             []string{"splunk-security"},
+	}
+	erasureJSON := `{
+		"id": 4,
+		"pseudonym": "erased-5d1c7a9e-6a4b-4f0e-8c1d-3b2a1f0e9d8c",
+		"subject_type": "user_guid",
+		"reference": "ticket-123",
+		"requested_by": "user:admin@example.com",
+		"event_count": 12,
+		"archive_keys": ["events/2020/01/02.jsonl.gz"],
+		"erased_at": "2020-01-02T03:04:05Z",
+		"unsearched_archive_keys": ["events/2019/12/01.jsonl.gz"],
+		"detached_partitions": ["cf_audit_events_2019_01"],
+		"shipped_to": ["splunk-security"]
+	}`
+
+	Describe("POST", func() {
+		It("erases the user and returns the erasure", func() {
+			eventDB.EraseUserFromCFAuditEventsReturns(erasure, nil)
+
+			w := serve("POST", `{"user_guid": "some-user-guid", "reference": "ticket-123"}`)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			Expect(w.Body.String()).To(MatchJSON(erasureJSON))
+
+			Expect(eventDB.EraseUserFromCFAuditEventsCallCount()).To(Equal(1))
+			Expect(eventDB.EraseUserFromCFAuditEventsArgsForCall(0)).To(Equal(db.ErasureRequest{
+				UserGUID:    "some-user-guid",
+				Reference:   "ticket-123",
+				RequestedBy: "user:admin@example.com",
+			}))
+		})
+
+		It("records a client as the requester when there is no user", func() {
+			principal = &auth.Principal{ClientID: "some-client", Admin: true}
+
+			w := serve("POST", `{"username": "someone@example.com", "reference": "ticket-123"}`)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			Expect(eventDB.EraseUserFromCFAuditEventsArgsForCall(0)).To(Equal(db.ErasureRequest{
+				Username:    "someone@example.com",
+				Reference:   "ticket-123",
+				RequestedBy: "client:some-client",
+			}))
+		})
+
+		It("rejects requests without exactly one of user_guid and username", func() {
+			for _, body := range []string{
+				`{"reference": "ticket-123"}`,
+				`{"user_guid": "some-user-guid", "username": "someone", "reference": "ticket-123"}`,
+			} {
+				w := serve("POST", body)
+				Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+			}
+			Expect(eventDB.EraseUserFromCFAuditEventsCallCount()).To(Equal(0))
+		})
+
+		It("rejects requests without a reference", func() {
+			w := serve("POST", `{"user_guid": "some-user-guid"}`)
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+			Expect(w.Body.String()).To(ContainSubstring("reference"))
+			Expect(eventDB.EraseUserFromCFAuditEventsCallCount()).To(Equal(0))
+		})
+
+		It("rejects bodies which are not the expected JSON", func() {
+			for _, body := range []string{`not json`, `{"user_guid": "some-user-guid", "reference": "r", "other": 1}`} {
+				w := serve("POST", body)
+				Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+			}
+			Expect(eventDB.EraseUserFromCFAuditEventsCallCount()).To(Equal(0))
+		})
+
+		It("does not expose database errors", func() {
+			eventDB.EraseUserFromCFAuditEventsReturns(db.Erasure{}, errors.New("secret database details"))
+
+			w := serve("POST", `{"user_guid": "some-user-guid", "reference": "ticket-123"}`)
+			Expect(w.Code).To(Equal(http.StatusInternalServerError))
+			Expect(w.Body.String()).NotTo(ContainSubstring("secret"))
+		})
+	})
+
+	Describe("GET", func() {
+		It("lists the erasures", func() {
+			eventDB.GetCFAuditEventErasuresReturns([]db.Erasure{erasure}, nil)
+
+			w := serve("GET", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`{"resources": [` + erasureJSON + `]}`))
+		})
+
+		It("lists no erasures as an empty list", func() {
+			eventDB.GetCFAuditEventErasuresReturns([]db.Erasure{}, nil)
+
+			w := serve("GET", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`{"resources": []}`))
+		})
+	})
+
+	It("is forbidden to non-admins", func() {
+		principal = &auth.Principal{UserID: "some-user-guid", UserName: "someone@example.com"}
+
+		for _, method := range []string{"GET", "POST"} {
+			w := serve(method, `{"user_guid": "some-user-guid", "reference": "ticket-123"}`)
+			Expect(w.Code).To(Equal(http.StatusForbidden), method)
+		}
+		Expect(eventDB.EraseUserFromCFAuditEventsCallCount()).To(Equal(0))
+		Expect(eventDB.GetCFAuditEventErasuresCallCount()).To(Equal(0))
+	})
+
+	It("rejects other methods", func() {
+		w := serve("DELETE", "")
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	EventsPath = "/events"
+
+	DefaultResultsPerPage = 100
+	MaxResultsPerPage     = 1000
+)
+
+// eventsResponse follows the shape of a page of Cloud Controller's
+// /v2/events, except that next_url is a cursor into the auditor's store
+type eventsResponse struct {
+	NextURL   *string         `json:"next_url"`
+	Resources []eventResource `json:"resources"`
+}
+
+// eventResource is a cfclient.EventResource whose entity also has the
+// foundation the event was collected from
+type eventResource struct {
+	Meta   cfclient.Meta      `json:"metadata"`
+	Entity db.FoundationEvent `json:"entity"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// EventsHandler serves the events stored by the collector to the principal
+// that auth.Authenticator adds to the request context:
+//
+//	GET /events          lists events, newest first, filtered by query params
+//	GET /events/{guid}   gets a single event
+type EventsHandler struct {
+	logger  lager.Logger
+	eventDB db.EventDB
+}
+
+func NewEventsHandler(logger lager.Logger, eventDB db.EventDB) *EventsHandler {
+	logger = logger.Session("events-handler")
+	return &EventsHandler{logger, eventDB}
+}
+
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == EventsPath {
+		h.listEvents(w, r)
+		return
+	}
+
+	guid := strings.TrimPrefix(path, EventsPath+"/")
+	if guid == path || strings.Contains(guid, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	h.getEvent(w, r, guid)
+}
+
+func (h *EventsHandler) listEvents(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !principal.Admin {
+		filter.Organizations = map[string][]string{}
+		for foundation, guids := range principal.Organizations {
+			if len(guids) > 0 && (filter.Foundation == "" || filter.Foundation == foundation) {
+				filter.Organizations[foundation] = guids
+			}
+		}
+		if len(filter.Organizations) == 0 {
+			writeError(w, http.StatusForbidden, "you are not a manager or auditor of any organization")
+			return
+		}
+		if filter.OrganizationGUID != "" && !canSeeOrganization(principal, filter.Organizations, filter.OrganizationGUID) {
+			writeError(w, http.StatusForbidden, "you are not a manager or auditor of this organization")
+			return
+		}
+	}
+	pageSize := filter.Limit
+
+	// Fetch one more than the page size to find out if there is a next page
+	filter.Limit = pageSize + 1
+	events, err := h.eventDB.GetCFAuditEvents(filter)
+	if err != nil {
+		h.logger.Error("err-get-cf-audit-events", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := eventsResponse{Resources: []eventResource{}}
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		nextURL := nextPageURL(r.URL, events[len(events)-1].ID)
+		resp.NextURL = &nextURL
+	}
+	for _, event := range events {
+		resp.Resources = append(resp.Resources, toEventResource(event))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *EventsHandler) getEvent(w http.ResponseWriter, r *http.Request, guid string) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if _, err := uuid.FromString(guid); err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	// Each foundation has its own GUIDs, so the same GUID can be stored for
+	// more than one foundation
+	events, err := h.eventDB.GetCFAuditEvents(db.RawEventFilter{
+		GUID:       guid,
+		Foundation: r.URL.Query().Get("foundation"),
+		Limit:      MaxResultsPerPage,
+	})
+	if err != nil {
+		h.logger.Error("err-get-cf-audit-events", err, lager.Data{"guid": guid})
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Events the principal may not see are not found, rather than forbidden,
+	// so that their GUIDs do not reveal that they exist
+	visible := []db.CFAuditEvent{}
+	for _, event := range events {
+		if principal.CanSeeOrganization(event.Foundation, event.OrganizationGUID) {
+			visible = append(visible, event)
+		}
+	}
+	switch len(visible) {
+	case 0:
+		writeError(w, http.StatusNotFound, "not found")
+	case 1:
+		writeJSON(w, http.StatusOK, toEventResource(visible[0]))
+	default:
+		writeError(w, http.StatusConflict, "an event with this guid is stored for more than one foundation, choose one with the foundation query param")
+	}
+}
+
+// canSeeOrganization says whether the principal may see the events of an
+// organization in any of the foundations
+func canSeeOrganization(principal *auth.Principal, foundations map[string][]string, guid string) bool {
+	for foundation := range foundations {
+		if principal.CanSeeOrganization(foundation, guid) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEventFilter reads a db.RawEventFilter from the query params of a
+// request to list events
+func parseEventFilter(query url.Values) (db.RawEventFilter, error) {
+	filter := db.RawEventFilter{
+		Limit:      DefaultResultsPerPage,
+		Kind:       query.Get("type"),
+		Actor:      query.Get("actor"),
+		Actee:      query.Get("actee"),
+		Foundation: query.Get("foundation"),
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Reverse = true
+	default:
+		return filter, fmt.Errorf("order must be asc or desc, not %q", order)
+	}
+
+	if v := query.Get("results_per_page"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxResultsPerPage {
+			return filter, fmt.Errorf("results_per_page must be between 1 and %d", MaxResultsPerPage)
+		}
+		filter.Limit = limit
+	}
+
+	if v := query.Get("after"); v != "" {
+		afterID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || afterID < 1 {
+			return filter, fmt.Errorf("after must be a cursor from next_url")
+		}
+		filter.AfterID = afterID
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{
+		{"start_time", &filter.StartTime},
+		{"end_time", &filter.EndTime},
+	} {
+		if v := query.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC3339 timestamp", param.name)
+			}
+			*param.dest = t
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *string
+	}{
+		{"organization_guid", &filter.OrganizationGUID},
+		{"space_guid", &filter.SpaceGUID},
+	} {
+		if v := query.Get(param.name); v != "" {
+			if _, err := uuid.FromString(v); err != nil {
+				return filter, fmt.Errorf("%s must be a GUID", param.name)
+			}
+			*param.dest = v
+		}
+	}
+
+	return filter, nil
+}
+
+// nextPageURL keeps the filters of the current request and moves the cursor
+// past the last event on this page
+func nextPageURL(current *url.URL, lastID int64) string {
+	query := current.Query()
+	query.Set("after", strconv.FormatInt(lastID, 10))
+	next := url.URL{Path: current.Path, RawQuery: query.Encode()}
+	return next.String()
+}
+
+func toEventResource(event db.CFAuditEvent) eventResource {
+	return eventResource{
+		Meta: cfclient.Meta{
+			Guid:      event.GUID,
+			Url:       EventsPath + "/" + event.GUID,
+			CreatedAt: event.CreatedAt,
+		},
+		Entity: db.NewFoundationEvent(event),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
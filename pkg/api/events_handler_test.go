@@ -0,0 +1,373 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/api"
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+)
+
+const (
+	eventGUID = "a8f3b7d0-0e5c-4a0b-9d3e-1f0c3c6c4e11"
+	orgGUID   = "0f0a7e3e-4a5c-4c0e-8bd1-2b1d2cbb0d55"
+	spaceGUID = "5c0f2c0e-7a1b-4a3c-9a11-9e8d7c6b5a44"
+)
+
+type eventsResponse struct {
+	NextURL   *string `json:"next_url"`
+	Resources []struct {
+		Meta   cfclient.Meta      `json:"metadata"`
+		Entity db.FoundationEvent `json:"entity"`
+	} `json:"resources"`
+}
+
+var _ = Describe("EventsHandler", func() {
+	var (
+		eventDB   *dbfakes.FakeEventDB
+		handler   http.Handler
+		principal *auth.Principal
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("api-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		handler = api.NewEventsHandler(logger, eventDB)
+		principal = &auth.Principal{UserID: "admin-user-guid", Admin: true}
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), principal))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	storedEvents := func(ids ...int64) []db.CFAuditEvent {
+		events := []db.CFAuditEvent{}
+		for _, id := range ids {
+			events = append(events, db.CFAuditEvent{
+				ID:         id,
+				Foundation: "some-foundation",
+				Event: cfclient.Event{
+					GUID:      fmt.Sprintf("00000000-0000-0000-0000-%012d", id),
+					Type:      "audit.app.create",
+					CreatedAt: "2020-01-02T03:04:05Z",
+					Actor:     "some-user-guid",
+				},
+				EventNames: db.EventNames{OrganizationName: "some-org"},
+			})
+		}
+		return events
+	}
+
+	Describe("GET /events", func() {
+		It("lists events in the CF event shape", func() {
+			eventDB.GetCFAuditEventsReturns(storedEvents(3, 2, 1), nil)
+
+			w := get("/events")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var resp eventsResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.NextURL).To(BeNil())
+			Expect(resp.Resources).To(HaveLen(3))
+			Expect(resp.Resources[0].Meta.Guid).To(Equal("00000000-0000-0000-0000-000000000003"))
+			Expect(resp.Resources[0].Meta.Url).To(Equal("/events/00000000-0000-0000-0000-000000000003"))
+			Expect(resp.Resources[0].Meta.CreatedAt).To(Equal("2020-01-02T03:04:05Z"))
+			Expect(resp.Resources[0].Entity.Type).To(Equal("audit.app.create"))
+			Expect(resp.Resources[0].Entity.Actor).To(Equal("some-user-guid"))
+			Expect(resp.Resources[0].Entity.Foundation).To(Equal("some-foundation"))
+			Expect(resp.Resources[0].Entity.OrganizationName).To(Equal("some-org"))
+
+			Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(1))
+			filter := eventDB.GetCFAuditEventsArgsForCall(0)
+			Expect(filter).To(Equal(db.RawEventFilter{Limit: api.DefaultResultsPerPage + 1}))
+		})
+
+		It("returns an empty list rather than null when there are no events", func() {
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{}, nil)
+
+			w := get("/events")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`{"next_url": null, "resources": []}`))
+		})
+
+		It("passes the filters to the store", func() {
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{}, nil)
+
+			w := get("/events?" +
+				"type=audit.app.update&actor=some-actor&actee=some-actee" +
+				"&organization_guid=" + orgGUID + "&space_guid=" + spaceGUID +
+				"&start_time=2020-01-01T00:00:00Z&end_time=2020-02-01T00:00:00Z" +
+				"&order=asc&results_per_page=10&after=42&foundation=some-foundation",
+			)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			filter := eventDB.GetCFAuditEventsArgsForCall(0)
+			Expect(filter).To(Equal(db.RawEventFilter{
+				Reverse:          true,
+				Limit:            11,
+				Kind:             "audit.app.update",
+				Foundation:       "some-foundation",
+				AfterID:          42,
+				StartTime:        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				EndTime:          time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+				Actor:            "some-actor",
+				Actee:            "some-actee",
+				OrganizationGUID: orgGUID,
+				SpaceGUID:        spaceGUID,
+			}))
+		})
+
+		It("links to the next page using the id of the last event as a cursor", func() {
+			eventDB.GetCFAuditEventsReturns(storedEvents(9, 8, 7), nil)
+
+			w := get("/events?type=audit.app.create&results_per_page=2")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp eventsResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Resources).To(HaveLen(2))
+			Expect(resp.NextURL).NotTo(BeNil())
+			Expect(*resp.NextURL).To(Equal("/events?after=8&results_per_page=2&type=audit.app.create"))
+
+			By("following the link")
+			eventDB.GetCFAuditEventsReturns(storedEvents(7), nil)
+			w = get(*resp.NextURL)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			filter := eventDB.GetCFAuditEventsArgsForCall(1)
+			Expect(filter.AfterID).To(BeNumerically("==", 8))
+			Expect(filter.Kind).To(Equal("audit.app.create"))
+		})
+
+		for _, invalid := range []struct{ query, message string }{
+			{"order=sideways", "order must be asc or desc"},
+			{"results_per_page=0", "results_per_page must be between 1 and 1000"},
+			{"results_per_page=1001", "results_per_page must be between 1 and 1000"},
+			{"after=abc", "after must be a cursor"},
+			{"start_time=yesterday", "start_time must be an RFC3339 timestamp"},
+			{"end_time=2020-01-01", "end_time must be an RFC3339 timestamp"},
+			{"organization_guid=not-a-guid", "organization_guid must be a GUID"},
+			{"space_guid=not-a-guid", "space_guid must be a GUID"},
+		} {
+			invalid := invalid
+			It("rejects "+invalid.query, func() {
+				w := get("/events?" + invalid.query)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(invalid.message))
+				Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+			})
+		}
+
+		It("returns a 500 if the store fails", func() {
+			eventDB.GetCFAuditEventsReturns(nil, fmt.Errorf("connection refused"))
+
+			w := get("/events")
+			Expect(w.Code).To(Equal(http.StatusInternalServerError))
+			Expect(w.Body.String()).NotTo(ContainSubstring("connection refused"))
+		})
+
+		Context("when the principal is not an admin", func() {
+			BeforeEach(func() {
+				principal = &auth.Principal{
+					UserID: "some-user-guid",
+					Organizations: map[string][]string{
+						"foundation-a": {orgGUID},
+						"foundation-b": {},
+					},
+				}
+				eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{}, nil)
+			})
+
+			It("only lists events in the principal's organizations of each foundation", func() {
+				w := get("/events?type=audit.app.create")
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				filter := eventDB.GetCFAuditEventsArgsForCall(0)
+				Expect(filter.Kind).To(Equal("audit.app.create"))
+				Expect(filter.Organizations).To(Equal(map[string][]string{"foundation-a": {orgGUID}}))
+			})
+
+			It("lets the principal filter by one of their organizations", func() {
+				w := get("/events?organization_guid=" + orgGUID)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				filter := eventDB.GetCFAuditEventsArgsForCall(0)
+				Expect(filter.OrganizationGUID).To(Equal(orgGUID))
+				Expect(filter.Organizations).To(Equal(map[string][]string{"foundation-a": {orgGUID}}))
+			})
+
+			It("forbids filtering by another organization", func() {
+				w := get("/events?organization_guid=" + spaceGUID)
+				Expect(w.Code).To(Equal(http.StatusForbidden))
+				Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+			})
+
+			It("forbids filtering by a foundation the principal has no organization roles in", func() {
+				w := get("/events?foundation=foundation-b&organization_guid=" + orgGUID)
+				Expect(w.Code).To(Equal(http.StatusForbidden))
+				Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+			})
+
+			It("forbids listing events if the principal has no organization roles", func() {
+				principal.Organizations = nil
+
+				w := get("/events")
+				Expect(w.Code).To(Equal(http.StatusForbidden))
+				Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+			})
+		})
+
+		It("rejects requests without a principal", func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+		})
+
+		It("only allows GET", func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("POST", "/events", nil))
+			Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("GET /events/{guid}", func() {
+		It("gets a single event", func() {
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:    1,
+				Event: cfclient.Event{GUID: eventGUID, Type: "audit.space.create"},
+			}}, nil)
+
+			w := get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp cfclient.EventResource
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Meta.Guid).To(Equal(eventGUID))
+			Expect(resp.Entity.Type).To(Equal("audit.space.create"))
+
+			filter := eventDB.GetCFAuditEventsArgsForCall(0)
+			Expect(filter).To(Equal(db.RawEventFilter{GUID: eventGUID, Limit: api.MaxResultsPerPage}))
+		})
+
+		It("gets the event from the foundation in the foundation query param", func() {
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:         2,
+				Foundation: "foundation-b",
+				Event:      cfclient.Event{GUID: eventGUID},
+			}}, nil)
+
+			w := get("/events/" + eventGUID + "?foundation=foundation-b")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp struct {
+				Entity db.FoundationEvent `json:"entity"`
+			}
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Entity.Foundation).To(Equal("foundation-b"))
+
+			filter := eventDB.GetCFAuditEventsArgsForCall(0)
+			Expect(filter).To(Equal(db.RawEventFilter{GUID: eventGUID, Foundation: "foundation-b", Limit: api.MaxResultsPerPage}))
+		})
+
+		It("returns a 409 if the guid is stored for more than one foundation the principal can see", func() {
+			principal = &auth.Principal{
+				UserID: "some-user-guid",
+				Organizations: map[string][]string{
+					"foundation-a": {orgGUID},
+					"foundation-b": {orgGUID},
+				},
+			}
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:         1,
+				Foundation: "foundation-a",
+				Event:      cfclient.Event{GUID: eventGUID, OrganizationGUID: orgGUID},
+			}, {
+				ID:         2,
+				Foundation: "foundation-b",
+				Event:      cfclient.Event{GUID: eventGUID, OrganizationGUID: orgGUID},
+			}}, nil)
+
+			w := get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusConflict))
+			Expect(w.Body.String()).To(ContainSubstring("foundation query param"))
+
+			By("returning the one they can see if they can only see one of them")
+			principal.Organizations = map[string][]string{"foundation-b": {orgGUID}}
+
+			w = get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			var resp struct {
+				Entity db.FoundationEvent `json:"entity"`
+			}
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Entity.Foundation).To(Equal("foundation-b"))
+		})
+
+		It("returns a 404 if the event is not stored", func() {
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{}, nil)
+
+			w := get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("returns a 404 if the event is in an organization the principal cannot see", func() {
+			principal = &auth.Principal{
+				UserID:        "some-user-guid",
+				Organizations: map[string][]string{"foundation-a": {orgGUID}},
+			}
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:         1,
+				Foundation: "foundation-a",
+				Event:      cfclient.Event{GUID: eventGUID, OrganizationGUID: spaceGUID},
+			}}, nil)
+
+			w := get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+
+			By("returning a 404 if it is in an organization with the same GUID in another foundation")
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:         1,
+				Foundation: "foundation-b",
+				Event:      cfclient.Event{GUID: eventGUID, OrganizationGUID: orgGUID},
+			}}, nil)
+
+			w = get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+
+			By("returning it if it is in one of their organizations")
+			eventDB.GetCFAuditEventsReturns([]db.CFAuditEvent{{
+				ID:         1,
+				Foundation: "foundation-a",
+				Event:      cfclient.Event{GUID: eventGUID, OrganizationGUID: orgGUID},
+			}}, nil)
+
+			w = get("/events/" + eventGUID)
+			Expect(w.Code).To(Equal(http.StatusOK))
+		})
+
+		It("returns a 404 without querying the store if the guid is not a GUID", func() {
+			w := get("/events/not-a-guid")
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			Expect(eventDB.GetCFAuditEventsCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const ResourceNamesPath = "/resource-names"
+
+type resourceNamesResponse struct {
+	Resources []db.ResourceName `json:"resources"`
+}
+
+// ResourceNamesHandler serves every name an organization, space, app or user
+// has been seen with, most recently seen first, so that resources which have
+// been deleted can still be identified:
+//
+//	GET /resource-names/{type}/{guid}?foundation={name}
+//
+// Admins can look up any resource. Other principals can only look up the
+// organizations they can see events for.
+type ResourceNamesHandler struct {
+	logger  lager.Logger
+	eventDB db.EventDB
+}
+
+func NewResourceNamesHandler(logger lager.Logger, eventDB db.EventDB) *ResourceNamesHandler {
+	logger = logger.Session("resource-names-handler")
+	return &ResourceNamesHandler{logger, eventDB}
+}
+
+func (h *ResourceNamesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, ResourceNamesPath+"/"), "/")
+	if len(parts) != 2 || parts[1] == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	resourceType, guid := parts[0], parts[1]
+	switch resourceType {
+	case db.ResourceTypeOrganization, db.ResourceTypeSpace, db.ResourceTypeApp, db.ResourceTypeUser:
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	foundation := r.URL.Query().Get("foundation")
+	if !principal.Admin && (resourceType != db.ResourceTypeOrganization || !principal.CanSeeOrganization(foundation, guid)) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	names, err := h.eventDB.GetResourceNames(foundation, resourceType, guid)
+	if err != nil {
+		h.logger.Error("err-get-resource-names", err, lager.Data{"resource_type": resourceType, "guid": guid})
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, resourceNamesResponse{Resources: names})
+}
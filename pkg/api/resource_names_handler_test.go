@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/api"
+	"github.com/alphagov/paas-auditor/pkg/auth"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+)
+
+var _ = Describe("ResourceNamesHandler", func() {
+	var (
+		eventDB   *dbfakes.FakeEventDB
+		handler   http.Handler
+		principal *auth.Principal
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("api-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetResourceNamesReturns([]db.ResourceName{{
+			Foundation:  "london",
+			Type:        "organization",
+			GUID:        "org-guid",
+			Name:        "deleted-org",
+			FirstSeenAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			LastSeenAt:  time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC),
+		}}, nil)
+		handler = api.NewResourceNamesHandler(logger, eventDB)
+		principal = &auth.Principal{UserID: "admin-user-guid", Admin: true}
+	})
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), principal))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	It("returns the names a resource has been seen with", func() {
+		w := serve("GET", api.ResourceNamesPath+"/organization/org-guid?foundation=london")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{"resources": [{
+			"foundation": "london",
+			"type": "organization",
+			"guid": "org-guid",
+			"name": "deleted-org",
+			"first_seen_at": "2020-01-02T03:04:05Z",
+			"last_seen_at": "2020-02-03T04:05:06Z"
+		}]}`))
+
+		foundation, resourceType, guid := eventDB.GetResourceNamesArgsForCall(0)
+		Expect([]string{foundation, resourceType, guid}).To(Equal([]string{"london", "organization", "org-guid"}))
+	})
+
+	It("does not know other types of resource", func() {
+		Expect(serve("GET", api.ResourceNamesPath+"/service_instance/some-guid").Code).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", api.ResourceNamesPath+"/organization").Code).To(Equal(http.StatusNotFound))
+		Expect(serve("GET", api.ResourceNamesPath+"/organization/org-guid/more").Code).To(Equal(http.StatusNotFound))
+		Expect(eventDB.GetResourceNamesCallCount()).To(Equal(0))
+	})
+
+	It("only lets other principals look up the organizations they can see", func() {
+		principal = &auth.Principal{UserID: "some-user-guid", Organizations: map[string][]string{"london": {"org-guid"}}}
+
+		Expect(serve("GET", api.ResourceNamesPath+"/organization/org-guid?foundation=london").Code).To(Equal(http.StatusOK))
+		Expect(serve("GET", api.ResourceNamesPath+"/organization/org-guid?foundation=paris").Code).To(Equal(http.StatusForbidden))
+		Expect(serve("GET", api.ResourceNamesPath+"/organization/other-org-guid?foundation=london").Code).To(Equal(http.StatusForbidden))
+		Expect(serve("GET", api.ResourceNamesPath+"/user/some-user-guid").Code).To(Equal(http.StatusForbidden))
+		Expect(eventDB.GetResourceNamesCallCount()).To(Equal(1))
+	})
+
+	It("only allows GET", func() {
+		Expect(serve("POST", api.ResourceNamesPath+"/organization/org-guid").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("does not reveal database errors", func() {
+		eventDB.GetResourceNamesReturns(nil, errors.New("connection refused"))
+		w := serve("GET", api.ResourceNamesPath+"/organization/org-guid")
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+		Expect(w.Body.String()).NotTo(ContainSubstring("connection refused"))
+	})
+})
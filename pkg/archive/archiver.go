@@ -0,0 +1,490 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	// WindowSize is the length of time covered by each archive, in UTC
+	WindowSize = 24 * time.Hour
+
+	ManifestVersion = 1
+
+	// lateEventsPageSize is the most events looked at at a time for having
+	// been stored in a window after it was archived
+	lateEventsPageSize = 100000
+)
+
+// Policy says which events are archived and what happens to them afterwards
+type Policy struct {
+	// Delay is how long after a window ends before it is archived, so that
+	// events which are collected late are included
+	Delay time.Duration
+
+	// Prefix is prepended to the keys of archived objects
+	Prefix string
+
+	// DeleteRows deletes the archived events from the database once the
+	// upload has been verified
+	DeleteRows bool
+}
+
+// Manifest is uploaded alongside each archive, and describes it
+type Manifest struct {
+	Version      int       `json:"version"`
+	WindowStart  time.Time `json:"window_start"`
+	WindowEnd    time.Time `json:"window_end"`
+	ObjectKey    string    `json:"object_key"`
+	EventCount   int64     `json:"event_count"`
+	MinID        int64     `json:"min_id"`
+	MaxID        int64     `json:"max_id"`
+	SHA256       string    `json:"sha256"`
+	NDJSONSHA256 string    `json:"ndjson_sha256"`
+	SizeBytes    int64     `json:"size_bytes"`
+	ArchivedAt   time.Time `json:"archived_at"`
+}
+
+// ObjectKey returns the key of a revision of the archive of the window
+// starting at start. The first revision has no revision number in its key.
+// The manifest's key is the same with a .manifest.json suffix.
+func ObjectKey(prefix string, start time.Time, revision int) string {
+	key := prefix + start.UTC().Format("cf_audit_events/2006/01/02")
+	if revision > 1 {
+		key += fmt.Sprintf("-r%d", revision)
+	}
+	return key + ".ndjson.gz"
+}
+
+func ManifestKey(prefix string, start time.Time, revision int) string {
+	return ObjectKey(prefix, start, revision) + ".manifest.json"
+}
+
+// Archiver uploads each day of stored events to object storage, once the day
+// has been over for longer than the policy's delay. Each archive is gzipped
+// NDJSON, one db.FoundationEvent per line in id order, with a manifest of
+// counts and checksums. Windows are archived in order, and recorded in the
+// database. A window in which events are stored after it was archived is
+// archived again.
+type Archiver struct {
+	schedule time.Duration
+	policy   Policy
+	logger   lager.Logger
+	eventDB  db.EventDB
+	store    ObjectStore
+}
+
+func NewArchiver(
+	schedule time.Duration,
+	policy Policy,
+	logger lager.Logger,
+	eventDB db.EventDB,
+	store ObjectStore,
+) *Archiver {
+	logger = logger.Session("archiver", lager.Data{
+		"delay":       policy.Delay.String(),
+		"prefix":      policy.Prefix,
+		"delete_rows": policy.DeleteRows,
+	})
+	return &Archiver{schedule, policy, logger, eventDB, store}
+}
+
+func (a *Archiver) Run(ctx context.Context) error {
+	lsession := a.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		if err := a.archive(ctx, lsession, time.Now()); err != nil {
+			lsession.Error("err-archive", err)
+			ArchiverErrorsTotal.Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(a.schedule):
+		}
+	}
+}
+
+// archive archives every window which has closed and not been archived yet,
+// and archives again every window in which events have been stored since it
+// was archived
+func (a *Archiver) archive(ctx context.Context, lsession lager.Logger, now time.Time) error {
+	// Backfill jobs collect windows of events out of order, so days are not
+	// archived until every event before them has been collected
+	jobs, err := a.eventDB.GetBackfillJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.CompletedAt == nil {
+			lsession.Info("waiting-for-backfill", lager.Data{"foundation": job.Foundation})
+			return nil
+		}
+	}
+
+	archives, err := a.eventDB.GetCFAuditEventArchives()
+	if err != nil {
+		return err
+	}
+	// Archiving stops at the first error, which can leave an archive whose
+	// rows have not been deleted
+	for _, archive := range archives {
+		if archive.RowsDeletedAt == nil {
+			if err := a.deleteRows(lsession, archive); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(archives) > 0 {
+		if err := a.archiveLateEvents(ctx, lsession); err != nil {
+			return err
+		}
+	}
+
+	var start time.Time
+	if len(archives) > 0 {
+		latest := archives[len(archives)-1]
+		start = latest.WindowEnd.UTC()
+		ArchiverLatestWindowEndTimestamp.Set(float64(latest.WindowEnd.Unix()))
+	} else {
+		earliest, err := a.eventDB.GetEarliestCFEventTime()
+		if err != nil {
+			return err
+		}
+		if earliest.IsZero() {
+			lsession.Info("no-events")
+			return nil
+		}
+		start = earliest.UTC().Truncate(WindowSize)
+	}
+
+	for {
+		end := start.Add(WindowSize)
+		if end.After(now.Add(-a.policy.Delay)) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		archive, err := a.archiveWindow(ctx, lsession, start, end, nil)
+		if err != nil {
+			return fmt.Errorf("archiving window starting %s: %s", start.Format(time.RFC3339), err)
+		}
+		ArchiverWindowsArchivedTotal.Inc()
+		ArchiverEventsArchivedTotal.Add(float64(archive.EventCount))
+		ArchiverBytesArchivedTotal.Add(float64(archive.SizeBytes))
+		ArchiverLatestWindowEndTimestamp.Set(float64(archive.WindowEnd.Unix()))
+
+		if err := a.deleteRows(lsession, archive); err != nil {
+			return err
+		}
+
+		start = end
+	}
+}
+
+// archiveLateEvents archives again the windows in which events have been
+// stored since they were archived, eg by a backfill job, looking through the
+// events stored since it last looked a page at a time. The events would
+// otherwise never be archived, or deleted.
+func (a *Archiver) archiveLateEvents(ctx context.Context, lsession lager.Logger) error {
+	previousSeq := int64(-1)
+	for ctx.Err() == nil {
+		archives, checkedSeq, err := a.eventDB.GetCFAuditEventArchivesWithLateEvents(lateEventsPageSize)
+		if err != nil {
+			return err
+		}
+		if checkedSeq == previousSeq {
+			return nil
+		}
+
+		for _, previous := range archives {
+			previous := previous
+			archive, err := a.archiveWindow(ctx, lsession, previous.WindowStart, previous.WindowEnd, &previous)
+			if err != nil {
+				return fmt.Errorf("archiving window starting %s again: %s", previous.WindowStart.Format(time.RFC3339), err)
+			}
+			ArchiverWindowsRearchivedTotal.Inc()
+			ArchiverEventsArchivedTotal.Add(float64(archive.EventCount - previous.EventCount))
+			ArchiverBytesArchivedTotal.Add(float64(archive.SizeBytes))
+
+			if err := a.deleteRows(lsession, archive); err != nil {
+				return err
+			}
+		}
+
+		if err := a.eventDB.UpdateArchiveCursor(checkedSeq); err != nil {
+			return err
+		}
+		previousSeq = checkedSeq
+	}
+	return nil
+}
+
+func (a *Archiver) deleteRows(lsession lager.Logger, archive db.CFAuditEventArchive) error {
+	if !a.policy.DeleteRows || archive.EventCount == 0 {
+		return nil
+	}
+	deleted, err := a.eventDB.DeleteArchivedCFAuditEvents(archive)
+	if err != nil {
+		return fmt.Errorf("deleting archived events in %s: %s", archive.ObjectKey, err)
+	}
+	lsession.Info("deleted-archived-events", lager.Data{
+		"object_key": archive.ObjectKey,
+		"deleted":    deleted,
+	})
+	ArchiverEventsDeletedTotal.Add(float64(deleted))
+	return nil
+}
+
+// archiveWindow uploads the events created in a window as it reads them, so
+// that a window is never held in memory. If the window has been archived
+// before, previous is its archive, which the new revision replaces. If the
+// events in previous have been deleted, they are copied from it.
+func (a *Archiver) archiveWindow(
+	ctx context.Context,
+	lsession lager.Logger,
+	start time.Time,
+	end time.Time,
+	previous *db.CFAuditEventArchive,
+) (db.CFAuditEventArchive, error) {
+	startTime := time.Now()
+	revision := 1
+	if previous != nil {
+		revision = previous.Revision + 1
+	}
+	archive := db.CFAuditEventArchive{
+		WindowStart: start,
+		WindowEnd:   end,
+		Revision:    revision,
+		ObjectKey:   ObjectKey(a.policy.Prefix, start, revision),
+		ManifestKey: ManifestKey(a.policy.Prefix, start, revision),
+	}
+
+	upload, err := a.store.CreateUpload(archive.ObjectKey, "application/gzip")
+	if err != nil {
+		return archive, err
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := upload.Abort(); err != nil {
+			lsession.Error("err-abort-upload", err, lager.Data{"object_key": archive.ObjectKey})
+		}
+	}()
+
+	objectHash := sha256.New()
+	size := &countingWriter{}
+	gz := gzip.NewWriter(io.MultiWriter(upload, objectHash, size))
+	ndjsonHash := sha256.New()
+	w := io.MultiWriter(gz, ndjsonHash)
+	encoder := json.NewEncoder(w)
+
+	filter := db.RawEventFilter{
+		Reverse:   true,
+		StartTime: start,
+		EndTime:   end,
+	}
+	if previous != nil {
+		// Restored events are copies of archived ones
+		filter.ExcludeRestored = true
+		if previous.RowsDeletedAt != nil && previous.EventCount > 0 {
+			count, err := a.copyArchive(*previous, w)
+			if err != nil {
+				return archive, fmt.Errorf("copying %s: %s", previous.ObjectKey, err)
+			}
+			archive.EventCount = count
+			archive.MinID = previous.MinID
+			archive.MaxID = previous.MaxID
+			filter.AfterID = previous.MaxID
+		}
+	}
+
+	err = a.eventDB.StreamCFAuditEvents(ctx, filter, func(event db.CFAuditEvent) error {
+		if err := encoder.Encode(db.NewFoundationEvent(event)); err != nil {
+			return err
+		}
+		if archive.MinID == 0 {
+			archive.MinID = event.ID
+		}
+		archive.MaxID = event.ID
+		archive.EventCount++
+		return nil
+	})
+	if err != nil {
+		return archive, err
+	}
+	if err := gz.Close(); err != nil {
+		return archive, err
+	}
+	if err := upload.Complete(); err != nil {
+		return archive, err
+	}
+	completed = true
+
+	archive.SHA256 = hex.EncodeToString(objectHash.Sum(nil))
+	archive.SizeBytes = size.n
+	archive.ArchivedAt = time.Now().UTC()
+
+	if err := a.verifyUpload(archive); err != nil {
+		return archive, err
+	}
+
+	manifest, err := json.MarshalIndent(Manifest{
+		Version:      ManifestVersion,
+		WindowStart:  archive.WindowStart,
+		WindowEnd:    archive.WindowEnd,
+		ObjectKey:    archive.ObjectKey,
+		EventCount:   archive.EventCount,
+		MinID:        archive.MinID,
+		MaxID:        archive.MaxID,
+		SHA256:       archive.SHA256,
+		NDJSONSHA256: hex.EncodeToString(ndjsonHash.Sum(nil)),
+		SizeBytes:    archive.SizeBytes,
+		ArchivedAt:   archive.ArchivedAt,
+	}, "", "  ")
+	if err != nil {
+		return archive, err
+	}
+	if err := a.store.PutObject(archive.ManifestKey, manifest, "application/json"); err != nil {
+		return archive, err
+	}
+	uploaded, err := a.store.GetObject(archive.ManifestKey)
+	if err != nil {
+		return archive, err
+	}
+	if !bytes.Equal(uploaded, manifest) {
+		return archive, fmt.Errorf("uploaded manifest %s does not match", archive.ManifestKey)
+	}
+
+	if err := a.eventDB.StoreCFAuditEventArchive(archive); err != nil {
+		return archive, err
+	}
+
+	// The new revision has every event of the previous one, which is no
+	// longer needed
+	if previous != nil {
+		for _, key := range []string{previous.ObjectKey, previous.ManifestKey} {
+			if err := a.store.DeleteObject(key); err != nil {
+				lsession.Error("err-delete-previous-revision", err, lager.Data{"object_key": key})
+				ArchiverErrorsTotal.Inc()
+			}
+		}
+	}
+
+	lsession.Info("archived-window", lager.Data{
+		"object_key":  archive.ObjectKey,
+		"revision":    archive.Revision,
+		"event_count": archive.EventCount,
+		"size_bytes":  archive.SizeBytes,
+		"elapsed":     time.Since(startTime),
+	})
+	return archive, nil
+}
+
+// copyArchive copies the NDJSON of an archive to w as it is downloaded, and
+// checks it against the archive's checksum and event count
+func (a *Archiver) copyArchive(archive db.CFAuditEventArchive, w io.Writer) (int64, error) {
+	body, err := a.store.OpenObject(archive.ObjectKey)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	gz, err := gzip.NewReader(io.TeeReader(body, hash))
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	count, err := countLines(io.TeeReader(gz, w))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return 0, err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != archive.SHA256 {
+		return 0, fmt.Errorf("object does not match its checksum")
+	}
+	if count != archive.EventCount {
+		return 0, fmt.Errorf("object has %d events, expected %d", count, archive.EventCount)
+	}
+	return count, nil
+}
+
+// verifyUpload downloads an archive and checks its checksum and event count
+func (a *Archiver) verifyUpload(archive db.CFAuditEventArchive) error {
+	body, err := a.store.OpenObject(archive.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	uploaded := io.TeeReader(body, hash)
+	count, countErr := countEvents(uploaded)
+	if _, err := io.Copy(ioutil.Discard, uploaded); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != archive.SHA256 {
+		return fmt.Errorf("uploaded object %s does not match its checksum", archive.ObjectKey)
+	}
+	if countErr != nil {
+		return fmt.Errorf("reading uploaded object %s: %s", archive.ObjectKey, countErr)
+	}
+	if count != archive.EventCount {
+		return fmt.Errorf("uploaded object %s has %d events, expected %d", archive.ObjectKey, count, archive.EventCount)
+	}
+	return nil
+}
+
+// countEvents counts the lines of a gzipped NDJSON archive
+func countEvents(archive io.Reader) (int64, error) {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	return countLines(gz)
+}
+
+func countLines(ndjson io.Reader) (int64, error) {
+	var count int64
+	scanner := bufio.NewScanner(ndjson)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		count++
+	}
+	return count, scanner.Err()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,468 @@
+package archive_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+func readArchive(body []byte) []cfclient.Event {
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	ndjson, err := ioutil.ReadAll(gz)
+	Expect(err).NotTo(HaveOccurred())
+
+	events := []cfclient.Event{}
+	for _, line := range strings.Split(strings.TrimSpace(string(ndjson)), "\n") {
+		if line == "" {
+			continue
+		}
+		event := cfclient.Event{}
+		Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+		events = append(events, event)
+	}
+	return events
+}
+
+var _ = Describe("S3Client", func() {
+	var (
+		fakeS3 *h.FakeS3
+		client *archive.S3Client
+	)
+
+	BeforeEach(func() {
+		fakeS3 = h.NewFakeS3("audit-archive", "AKIAEXAMPLE")
+		client = archive.NewS3Client(archive.S3Config{
+			Endpoint:        fakeS3.URL,
+			Region:          "eu-west-2",
+			Bucket:          "audit-archive",
+			AccessKeyID:     "AKIAEXAMPLE",
+			SecretAccessKey: "secret",
+		}, http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		fakeS3.Close()
+	})
+
+	It("puts and gets objects", func() {
+		Expect(client.PutObject("some/key.json", []byte(`{"a":1}`), "application/json")).To(Succeed())
+
+		body, err := client.GetObject("some/key.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal(`{"a":1}`))
+	})
+
+	It("returns the error from the object store", func() {
+		_, err := client.GetObject("missing")
+		Expect(err).To(MatchError(ContainSubstring("404 Not Found: <Error><Code>NoSuchKey</Code></Error>")))
+	})
+
+	It("uploads objects in parts", func() {
+		client = archive.NewS3Client(archive.S3Config{
+			Endpoint:        fakeS3.URL,
+			Region:          "eu-west-2",
+			Bucket:          "audit-archive",
+			AccessKeyID:     "AKIAEXAMPLE",
+			SecretAccessKey: "secret",
+			PartSize:        4,
+		}, http.DefaultClient)
+
+		upload, err := client.CreateUpload("some/key.txt", "text/plain")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = upload.Write([]byte("some "))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = upload.Write([]byte("body"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeS3.Uploads()).To(Equal([]int{2}))
+		_, ok := fakeS3.Object("some/key.txt")
+		Expect(ok).To(BeFalse())
+
+		Expect(upload.Complete()).To(Succeed())
+		Expect(fakeS3.Uploads()).To(BeEmpty())
+		body, err := client.OpenObject("some/key.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer body.Close()
+		Expect(ioutil.ReadAll(body)).To(Equal([]byte("some body")))
+
+		By("aborting an upload")
+		upload, err = client.CreateUpload("other/key.txt", "text/plain")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = upload.Write([]byte("some body"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upload.Abort()).To(Succeed())
+		Expect(fakeS3.Uploads()).To(BeEmpty())
+		Expect(fakeS3.Keys()).To(ConsistOf("some/key.txt"))
+	})
+
+	It("deletes objects", func() {
+		Expect(client.PutObject("some/key.json", []byte(`{"a":1}`), "application/json")).To(Succeed())
+		Expect(client.DeleteObject("some/key.json")).To(Succeed())
+		Expect(fakeS3.Keys()).To(BeEmpty())
+	})
+
+	It("signs requests with its access key", func() {
+		other := archive.NewS3Client(archive.S3Config{
+			Endpoint:    fakeS3.URL,
+			Region:      "eu-west-2",
+			Bucket:      "audit-archive",
+			AccessKeyID: "SOMEONEELSE",
+		}, http.DefaultClient)
+		err := other.PutObject("key", []byte("body"), "text/plain")
+		Expect(err).To(MatchError(ContainSubstring("403 Forbidden")))
+	})
+})
+
+var _ = Describe("Archiver Run", func() {
+	var (
+		logger  lager.Logger
+		eventDB *dbfakes.FakeEventDB
+		fakeS3  *h.FakeS3
+		store   *archive.S3Client
+
+		firstDay time.Time
+		events   []db.CFAuditEvent
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("archiver-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		fakeS3 = h.NewFakeS3("audit-archive", "AKIAEXAMPLE")
+		// Small parts, so that archives are uploaded in several
+		store = archive.NewS3Client(archive.S3Config{
+			Endpoint:        fakeS3.URL,
+			Region:          "eu-west-2",
+			Bucket:          "audit-archive",
+			AccessKeyID:     "AKIAEXAMPLE",
+			SecretAccessKey: "secret",
+			PartSize:        16,
+		}, http.DefaultClient)
+
+		// Three days ago, so two whole days have ended more than a day ago
+		earliest := time.Now().Add(-72 * time.Hour)
+		firstDay = earliest.UTC().Truncate(24 * time.Hour)
+		events = []db.CFAuditEvent{
+			{ID: 1, Event: cfclient.Event{GUID: "guid-1", Type: "audit.app.create", CreatedAt: earliest.Format(time.RFC3339)}},
+			{ID: 2, Event: cfclient.Event{GUID: "guid-2", Type: "audit.app.update", CreatedAt: earliest.Format(time.RFC3339)}},
+		}
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetEarliestCFEventTimeReturns(earliest, nil)
+		eventDB.StreamCFAuditEventsStub = func(_ context.Context, filter db.RawEventFilter, fn func(db.CFAuditEvent) error) error {
+			Expect(filter.Reverse).To(BeTrue())
+			Expect(filter.Limit).To(Equal(0))
+			if !filter.StartTime.Equal(firstDay) {
+				return nil
+			}
+			for _, event := range events {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		eventDB.DeleteArchivedCFAuditEventsReturns(2, nil)
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		fakeS3.Close()
+	})
+
+	It("archives each day which has closed, with a manifest", func() {
+		archivedBefore := h.CurrentMetricValue(archive.ArchiverEventsArchivedTotal)
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{
+			Delay:  24 * time.Hour,
+			Prefix: "prod/",
+		}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(2))
+		Consistently(eventDB.StoreCFAuditEventArchiveCallCount, 100*time.Millisecond).Should(Equal(2))
+
+		first := eventDB.StoreCFAuditEventArchiveArgsForCall(0)
+		Expect(first.WindowStart).To(Equal(firstDay))
+		Expect(first.WindowEnd).To(Equal(firstDay.Add(24 * time.Hour)))
+		Expect(first.Revision).To(Equal(1))
+		Expect(first.ObjectKey).To(Equal("prod/cf_audit_events/" + firstDay.Format("2006/01/02") + ".ndjson.gz"))
+		Expect(first.EventCount).To(BeNumerically("==", 2))
+		Expect(first.MinID).To(BeNumerically("==", 1))
+		Expect(first.MaxID).To(BeNumerically("==", 2))
+
+		body, ok := fakeS3.Object(first.ObjectKey)
+		Expect(ok).To(BeTrue())
+		sum := sha256.Sum256(body)
+		Expect(first.SHA256).To(Equal(hex.EncodeToString(sum[:])))
+		Expect(readArchive(body)).To(Equal([]cfclient.Event{events[0].Event, events[1].Event}))
+
+		manifestJSON, ok := fakeS3.Object(first.ManifestKey)
+		Expect(ok).To(BeTrue())
+		manifest := archive.Manifest{}
+		Expect(json.Unmarshal(manifestJSON, &manifest)).To(Succeed())
+		Expect(manifest.Version).To(Equal(1))
+		Expect(manifest.ObjectKey).To(Equal(first.ObjectKey))
+		Expect(manifest.EventCount).To(BeNumerically("==", 2))
+		Expect(manifest.SHA256).To(Equal(first.SHA256))
+		Expect(manifest.SizeBytes).To(BeNumerically("==", len(body)))
+
+		second := eventDB.StoreCFAuditEventArchiveArgsForCall(1)
+		Expect(second.WindowStart).To(Equal(firstDay.Add(24 * time.Hour)))
+		Expect(second.EventCount).To(BeNumerically("==", 0))
+
+		Expect(eventDB.DeleteArchivedCFAuditEventsCallCount()).To(Equal(0))
+		Expect(h.CurrentMetricValue(archive.ArchiverEventsArchivedTotal)).To(Equal(archivedBefore + 2))
+		Expect(fakeS3.Uploads()).To(BeEmpty())
+	})
+
+	It("carries on from the latest archive", func() {
+		eventDB.GetCFAuditEventArchivesReturns([]db.CFAuditEventArchive{{
+			WindowStart: firstDay.Add(-24 * time.Hour),
+			WindowEnd:   firstDay,
+		}, {
+			WindowStart: firstDay,
+			WindowEnd:   firstDay.Add(24 * time.Hour),
+		}}, nil)
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(1))
+		Expect(eventDB.StoreCFAuditEventArchiveArgsForCall(0).WindowStart).To(Equal(firstDay.Add(24 * time.Hour)))
+		Expect(eventDB.GetEarliestCFEventTimeCallCount()).To(Equal(0))
+	})
+
+	It("deletes archived rows if the policy says so", func() {
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{
+			Delay:      24 * time.Hour,
+			DeleteRows: true,
+		}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(2))
+		Expect(eventDB.DeleteArchivedCFAuditEventsCallCount()).To(Equal(1))
+		Expect(eventDB.DeleteArchivedCFAuditEventsArgsForCall(0).WindowStart).To(Equal(firstDay))
+	})
+
+	It("retries deleting the rows of archives", func() {
+		deletedAt := time.Now()
+		eventDB.GetCFAuditEventArchivesReturns([]db.CFAuditEventArchive{{
+			WindowStart:   firstDay.Add(-48 * time.Hour),
+			WindowEnd:     firstDay.Add(-24 * time.Hour),
+			EventCount:    2,
+			RowsDeletedAt: &deletedAt,
+		}, {
+			WindowStart: firstDay.Add(-24 * time.Hour),
+			WindowEnd:   firstDay,
+			EventCount:  2,
+		}, {
+			WindowStart: firstDay,
+			WindowEnd:   firstDay.Add(24 * time.Hour),
+			EventCount:  2,
+		}}, nil)
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{
+			Delay:      24 * time.Hour,
+			DeleteRows: true,
+		}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.DeleteArchivedCFAuditEventsCallCount).Should(Equal(2))
+		Expect(eventDB.DeleteArchivedCFAuditEventsArgsForCall(0).WindowStart).To(Equal(firstDay.Add(-24 * time.Hour)))
+		Expect(eventDB.DeleteArchivedCFAuditEventsArgsForCall(1).WindowStart).To(Equal(firstDay))
+	})
+
+	It("aborts the upload if it fails part way through", func() {
+		fakeS3.FailPart = func(key string, partNumber int) bool {
+			return partNumber == 2
+		}
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.StreamCFAuditEventsCallCount).Should(Equal(1))
+		Eventually(fakeS3.Uploads).Should(BeEmpty())
+		Consistently(eventDB.StoreCFAuditEventArchiveCallCount, 100*time.Millisecond).Should(Equal(0))
+		Expect(fakeS3.Keys()).To(BeEmpty())
+	})
+
+	Context("when events have been stored in a window after it was archived", func() {
+		var (
+			previous  db.CFAuditEventArchive
+			lateEvent db.CFAuditEvent
+			deletedAt time.Time
+		)
+
+		// archiveDays archives the first two days, to be archived again
+		archiveDays := func() {
+			archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+			archiverCtx, stop := context.WithCancel(ctx)
+			defer stop()
+			go archiver.Run(archiverCtx)
+			Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(2))
+		}
+
+		BeforeEach(func() {
+			lateEvent = db.CFAuditEvent{ID: 7, Event: cfclient.Event{GUID: "guid-7", Type: "audit.app.delete-request", CreatedAt: events[0].CreatedAt}}
+			deletedAt = time.Now()
+
+			archiveDays()
+			previous = eventDB.StoreCFAuditEventArchiveArgsForCall(0)
+			previous.RowsDeletedAt = &deletedAt
+
+			eventDB.StoreCFAuditEventArchiveReturns(nil)
+			eventDB.GetCFAuditEventArchivesReturns([]db.CFAuditEventArchive{previous, eventDB.StoreCFAuditEventArchiveArgsForCall(1)}, nil)
+			eventDB.GetCFAuditEventArchivesWithLateEventsReturnsOnCall(0, []db.CFAuditEventArchive{previous}, 7, nil)
+			eventDB.GetCFAuditEventArchivesWithLateEventsReturnsOnCall(1, nil, 7, nil)
+			eventDB.GetEarliestCFEventTimeReturns(firstDay, nil)
+		})
+
+		It("archives the window again, copying the events which have been deleted", func() {
+			eventDB.StreamCFAuditEventsStub = func(_ context.Context, filter db.RawEventFilter, fn func(db.CFAuditEvent) error) error {
+				Expect(filter.StartTime).To(Equal(firstDay))
+				Expect(filter.AfterID).To(BeNumerically("==", 2))
+				Expect(filter.ExcludeRestored).To(BeTrue())
+				return fn(lateEvent)
+			}
+			rearchivedBefore := h.CurrentMetricValue(archive.ArchiverWindowsRearchivedTotal)
+			archiver := archive.NewArchiver(time.Hour, archive.Policy{
+				Delay:      24 * time.Hour,
+				DeleteRows: true,
+			}, logger, eventDB, store)
+
+			go archiver.Run(ctx)
+
+			Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(3))
+			rearchived := eventDB.StoreCFAuditEventArchiveArgsForCall(2)
+			Expect(rearchived.WindowStart).To(Equal(firstDay))
+			Expect(rearchived.Revision).To(Equal(2))
+			Expect(rearchived.ObjectKey).To(Equal("cf_audit_events/" + firstDay.Format("2006/01/02") + "-r2.ndjson.gz"))
+			Expect(rearchived.EventCount).To(BeNumerically("==", 3))
+			Expect(rearchived.MinID).To(BeNumerically("==", 1))
+			Expect(rearchived.MaxID).To(BeNumerically("==", 7))
+
+			body, ok := fakeS3.Object(rearchived.ObjectKey)
+			Expect(ok).To(BeTrue())
+			Expect(readArchive(body)).To(Equal([]cfclient.Event{events[0].Event, events[1].Event, lateEvent.Event}))
+			Expect(fakeS3.Keys()).NotTo(ContainElement(previous.ObjectKey))
+			Expect(fakeS3.Keys()).NotTo(ContainElement(previous.ManifestKey))
+
+			Eventually(eventDB.UpdateArchiveCursorCallCount).Should(Equal(1))
+			Expect(eventDB.UpdateArchiveCursorArgsForCall(0)).To(BeNumerically("==", 7))
+			Expect(eventDB.DeleteArchivedCFAuditEventsCallCount()).To(BeNumerically(">=", 1))
+			Expect(eventDB.DeleteArchivedCFAuditEventsArgsForCall(0).MaxID).To(BeNumerically("==", 7))
+			Expect(h.CurrentMetricValue(archive.ArchiverWindowsRearchivedTotal)).To(Equal(rearchivedBefore + 1))
+		})
+
+		It("archives the window again from the database if its events have not been deleted", func() {
+			previous.RowsDeletedAt = nil
+			eventDB.GetCFAuditEventArchivesWithLateEventsReturnsOnCall(0, []db.CFAuditEventArchive{previous}, 7, nil)
+			eventDB.StreamCFAuditEventsStub = func(_ context.Context, filter db.RawEventFilter, fn func(db.CFAuditEvent) error) error {
+				Expect(filter.AfterID).To(BeNumerically("==", 0))
+				Expect(filter.ExcludeRestored).To(BeTrue())
+				for _, event := range append(events, lateEvent) {
+					if err := fn(event); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+			go archiver.Run(ctx)
+
+			Eventually(eventDB.StoreCFAuditEventArchiveCallCount).Should(Equal(3))
+			rearchived := eventDB.StoreCFAuditEventArchiveArgsForCall(2)
+			Expect(rearchived.Revision).To(Equal(2))
+			Expect(rearchived.EventCount).To(BeNumerically("==", 3))
+
+			body, ok := fakeS3.Object(rearchived.ObjectKey)
+			Expect(ok).To(BeTrue())
+			Expect(readArchive(body)).To(Equal([]cfclient.Event{events[0].Event, events[1].Event, lateEvent.Event}))
+		})
+
+		It("does not move the cursor past windows it failed to archive again", func() {
+			fakeS3.FailPart = func(key string, partNumber int) bool {
+				return strings.HasSuffix(key, "-r2.ndjson.gz")
+			}
+			archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+			go archiver.Run(ctx)
+
+			Eventually(eventDB.GetCFAuditEventArchivesWithLateEventsCallCount).Should(Equal(1))
+			Consistently(eventDB.UpdateArchiveCursorCallCount, 100*time.Millisecond).Should(Equal(0))
+			Expect(eventDB.StoreCFAuditEventArchiveCallCount()).To(Equal(2))
+			Expect(fakeS3.Keys()).To(ContainElement(previous.ObjectKey))
+		})
+	})
+
+	It("does not record or delete an archive which does not verify", func() {
+		errorsBefore := h.CurrentMetricValue(archive.ArchiverErrorsTotal)
+		fakeS3.Corrupt = func(key string, body []byte) []byte {
+			return append([]byte("x"), body...)
+		}
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{
+			Delay:      24 * time.Hour,
+			DeleteRows: true,
+		}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(archive.ArchiverErrorsTotal)
+		}).Should(Equal(errorsBefore + 1))
+		Expect(eventDB.StoreCFAuditEventArchiveCallCount()).To(Equal(0))
+		Expect(eventDB.DeleteArchivedCFAuditEventsCallCount()).To(Equal(0))
+	})
+
+	It("does nothing if there are no events", func() {
+		eventDB.GetEarliestCFEventTimeReturns(time.Time{}, nil)
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.GetEarliestCFEventTimeCallCount).Should(Equal(1))
+		Consistently(eventDB.StoreCFAuditEventArchiveCallCount, 100*time.Millisecond).Should(Equal(0))
+		Expect(fakeS3.Keys()).To(BeEmpty())
+	})
+
+	It("waits until every backfill job is complete", func() {
+		completedAt := time.Now()
+		eventDB.GetBackfillJobsReturns([]db.BackfillJob{
+			{Foundation: "some-foundation", CompletedAt: &completedAt},
+			{Foundation: "another-foundation"},
+		}, nil)
+		archiver := archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, eventDB, store)
+
+		go archiver.Run(ctx)
+
+		Eventually(eventDB.GetBackfillJobsCallCount).Should(Equal(1))
+		Consistently(eventDB.StoreCFAuditEventArchiveCallCount, 100*time.Millisecond).Should(Equal(0))
+		Expect(eventDB.GetLatestCFAuditEventArchiveCallCount()).To(Equal(0))
+		Expect(fakeS3.Keys()).To(BeEmpty())
+	})
+})
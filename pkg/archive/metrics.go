@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ArchiverErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_errors_total",
+		Help: "Number of errors encountered while archiving stored events to object storage",
+	})
+
+	ArchiverWindowsArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_windows_archived_total",
+		Help: "Number of windows of stored events archived to object storage",
+	})
+
+	ArchiverWindowsRearchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_windows_rearchived_total",
+		Help: "Number of windows of stored events archived again because events were stored in them after they were archived",
+	})
+
+	ArchiverEventsArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_events_archived_total",
+		Help: "Number of stored events archived to object storage",
+	})
+
+	ArchiverBytesArchivedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_bytes_archived_total",
+		Help: "Number of compressed bytes of stored events uploaded to object storage",
+	})
+
+	ArchiverEventsDeletedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "archiver_events_deleted_total",
+		Help: "Number of stored events deleted from the database after being archived",
+	})
+
+	ArchiverLatestWindowEndTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "archiver_latest_window_end_timestamp",
+		Help: "Unix epoch seconds of the end of the most recent window of events archived to object storage",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(ArchiverErrorsTotal)
+	prometheus.MustRegister(ArchiverWindowsArchivedTotal)
+	prometheus.MustRegister(ArchiverWindowsRearchivedTotal)
+	prometheus.MustRegister(ArchiverEventsArchivedTotal)
+	prometheus.MustRegister(ArchiverBytesArchivedTotal)
+	prometheus.MustRegister(ArchiverEventsDeletedTotal)
+	prometheus.MustRegister(ArchiverLatestWindowEndTimestamp)
+}
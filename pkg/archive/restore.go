@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const restoreBatchSize = 1000
+
+// ObjectGetter is where archives are restored from
+type ObjectGetter interface {
+	GetObject(key string) ([]byte, error)
+}
+
+// LocalFiles reads archives which have been downloaded, treating keys as
+// paths
+type LocalFiles struct{}
+
+func (LocalFiles) GetObject(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+type RestoreResult struct {
+	ObjectKey      string
+	Events         int64
+	Stored         int64
+	AlreadyPresent int64
+}
+
+// Restorer loads archived events back into the database. The partitions they
+// are restored into are held for hold, so that the retention policy does not
+// remove them straight away.
+type Restorer struct {
+	logger  lager.Logger
+	eventDB db.EventDB
+	source  ObjectGetter
+	hold    time.Duration
+}
+
+func NewRestorer(logger lager.Logger, eventDB db.EventDB, source ObjectGetter, hold time.Duration) *Restorer {
+	logger = logger.Session("restorer")
+	return &Restorer{logger, eventDB, source, hold}
+}
+
+// Restore checks an archive against its manifest and stores its events.
+// Events which are already stored are skipped. Restored events are added to
+// the end of the hash chain, with new ids, but are not shipped or evaluated
+// against the alert rules again. Their partition is held before they are
+// stored.
+func (r *Restorer) Restore(objectKey string) (RestoreResult, error) {
+	result := RestoreResult{ObjectKey: objectKey}
+	lsession := r.logger.Session("restore", lager.Data{"object_key": objectKey})
+
+	manifest, err := r.getManifest(objectKey)
+	if err != nil {
+		return result, err
+	}
+	events, err := r.getEvents(objectKey, manifest)
+	if err != nil {
+		return result, err
+	}
+	result.Events = int64(len(events))
+
+	if r.hold > 0 {
+		expiresAt := time.Now().Add(r.hold)
+		if err := r.eventDB.HoldCFAuditEventPartition(manifest.WindowStart, expiresAt, "restored "+objectKey); err != nil {
+			return result, fmt.Errorf("holding partition: %s", err)
+		}
+		lsession.Info("held-partition", lager.Data{
+			"name":       db.PartitionName(manifest.WindowStart),
+			"expires_at": expiresAt,
+		})
+	}
+
+	// Events are stored in the order they were archived, in batches of
+	// events from the same foundation, along with the names resolved for them
+	for start := 0; start < len(events); {
+		foundation := events[start].Foundation
+		batch := []cfclient.Event{}
+		names := map[string]db.EventNames{}
+		for start < len(events) && len(batch) < restoreBatchSize && events[start].Foundation == foundation {
+			batch = append(batch, events[start].Event)
+			names[events[start].GUID] = events[start].EventNames
+			start++
+		}
+		stored, err := r.eventDB.RestoreCFAuditEvents(foundation, batch, names)
+		if err != nil {
+			return result, err
+		}
+		result.Stored += int64(stored)
+	}
+	result.AlreadyPresent = result.Events - result.Stored
+
+	lsession.Info("restored", lager.Data{
+		"events":          result.Events,
+		"stored":          result.Stored,
+		"already_present": result.AlreadyPresent,
+	})
+	return result, nil
+}
+
+// Read checks an archive against its manifest and returns its events,
+// without storing them
+func (r *Restorer) Read(objectKey string) ([]db.FoundationEvent, error) {
+	manifest, err := r.getManifest(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	return r.getEvents(objectKey, manifest)
+}
+
+func (r *Restorer) getManifest(objectKey string) (Manifest, error) {
+	manifest := Manifest{}
+	manifestJSON, err := r.source.GetObject(objectKey + ".manifest.json")
+	if err != nil {
+		return manifest, fmt.Errorf("reading manifest: %s", err)
+	}
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return manifest, fmt.Errorf("reading manifest: %s", err)
+	}
+	if manifest.Version != ManifestVersion {
+		return manifest, fmt.Errorf("manifest has version %d, expected %d", manifest.Version, ManifestVersion)
+	}
+	return manifest, nil
+}
+
+// getEvents reads the events in an archive. Archives written before events
+// had foundations restore as events from no particular foundation.
+func (r *Restorer) getEvents(objectKey string, manifest Manifest) ([]db.FoundationEvent, error) {
+	body, err := r.source.GetObject(objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %s", err)
+	}
+	if int64(len(body)) != manifest.SizeBytes {
+		return nil, fmt.Errorf("archive is %d bytes, manifest says %d", len(body), manifest.SizeBytes)
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, fmt.Errorf("archive does not match the checksum in its manifest")
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %s", err)
+	}
+	defer gz.Close()
+	ndjson, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %s", err)
+	}
+	ndjsonSum := sha256.Sum256(ndjson)
+	if hex.EncodeToString(ndjsonSum[:]) != manifest.NDJSONSHA256 {
+		return nil, fmt.Errorf("archive contents do not match the checksum in its manifest")
+	}
+
+	events := []db.FoundationEvent{}
+	scanner := bufio.NewScanner(bytes.NewReader(ndjson))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		event := db.FoundationEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("reading event %d of archive: %s", len(events)+1, err)
+		}
+		createdAt, err := time.Parse(time.RFC3339, event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("reading event %s: %s", event.GUID, err)
+		}
+		if createdAt.Before(manifest.WindowStart) || !createdAt.Before(manifest.WindowEnd) {
+			return nil, fmt.Errorf("event %s was created at %s, outside the window of its manifest", event.GUID, event.CreatedAt)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading archive: %s", err)
+	}
+	if int64(len(events)) != manifest.EventCount {
+		return nil, fmt.Errorf("archive has %d events, manifest says %d", len(events), manifest.EventCount)
+	}
+	return events, nil
+}
@@ -0,0 +1,208 @@
+package archive_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/archive"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Restorer", func() {
+	var (
+		logger    lager.Logger
+		fakeS3    *h.FakeS3
+		store     *archive.S3Client
+		objectKey string
+		events    []cfclient.Event
+		eventDB   *dbfakes.FakeEventDB
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("restorer-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		fakeS3 = h.NewFakeS3("audit-archive", "AKIAEXAMPLE")
+		store = archive.NewS3Client(archive.S3Config{
+			Endpoint:    fakeS3.URL,
+			Region:      "eu-west-2",
+			Bucket:      "audit-archive",
+			AccessKeyID: "AKIAEXAMPLE",
+		}, http.DefaultClient)
+
+		day := time.Now().Add(-72 * time.Hour).UTC().Truncate(24 * time.Hour)
+		events = []cfclient.Event{}
+		archived := []db.CFAuditEvent{}
+		for i := 0; i < 3; i++ {
+			event := cfclient.Event{
+				GUID:      []string{"guid-1", "guid-2", "guid-3"}[i],
+				Type:      "audit.app.update",
+				CreatedAt: day.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+				Metadata:  map[string]interface{}{"request": map[string]interface{}{"name": "app"}},
+			}
+			events = append(events, event)
+			archived = append(archived, db.CFAuditEvent{
+				ID:         int64(i + 1),
+				Foundation: []string{"foundation-a", "foundation-a", "foundation-b"}[i],
+				Event:      event,
+			})
+		}
+		archived[0].EventNames = db.EventNames{OrganizationName: "some-org", AppName: "app"}
+
+		// Archive the events with the archiver, so that the test restores
+		// exactly what the archiver writes
+		archiveDB := &dbfakes.FakeEventDB{}
+		archiveDB.GetEarliestCFEventTimeReturns(day, nil)
+		archiveDB.StreamCFAuditEventsStub = func(_ context.Context, filter db.RawEventFilter, fn func(db.CFAuditEvent) error) error {
+			if !filter.StartTime.Equal(day) {
+				return nil
+			}
+			for _, event := range archived {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go archive.NewArchiver(time.Hour, archive.Policy{Delay: 24 * time.Hour}, logger, archiveDB, store).Run(ctx)
+		Eventually(archiveDB.StoreCFAuditEventArchiveCallCount).Should(Equal(2))
+		objectKey = archiveDB.StoreCFAuditEventArchiveArgsForCall(0).ObjectKey
+
+		eventDB = &dbfakes.FakeEventDB{}
+	})
+
+	AfterEach(func() {
+		fakeS3.Close()
+	})
+
+	It("stores the archived events from each foundation and counts those already present", func() {
+		eventDB.RestoreCFAuditEventsReturnsOnCall(0, 1, nil)
+		eventDB.RestoreCFAuditEventsReturnsOnCall(1, 1, nil)
+
+		result, err := archive.NewRestorer(logger, eventDB, store, 0).Restore(objectKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(archive.RestoreResult{
+			ObjectKey:      objectKey,
+			Events:         3,
+			Stored:         2,
+			AlreadyPresent: 1,
+		}))
+
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(2))
+		foundation, restored, names := eventDB.RestoreCFAuditEventsArgsForCall(0)
+		Expect(foundation).To(Equal("foundation-a"))
+		Expect(restored).To(HaveLen(2))
+		Expect(restored[0].GUID).To(Equal("guid-1"))
+		Expect(restored[0].Metadata).To(Equal(events[0].Metadata))
+		Expect(names).To(Equal(map[string]db.EventNames{
+			"guid-1": {OrganizationName: "some-org", AppName: "app"},
+			"guid-2": {},
+		}))
+		foundation, restored, _ = eventDB.RestoreCFAuditEventsArgsForCall(1)
+		Expect(foundation).To(Equal("foundation-b"))
+		Expect(restored).To(HaveLen(1))
+		Expect(restored[0].CreatedAt).To(Equal(events[2].CreatedAt))
+	})
+
+	It("holds the partition of the day before storing its events", func() {
+		eventDB.HoldCFAuditEventPartitionStub = func(time.Time, time.Time, string) error {
+			Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(0))
+			return nil
+		}
+
+		_, err := archive.NewRestorer(logger, eventDB, store, 30*24*time.Hour).Restore(objectKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(eventDB.HoldCFAuditEventPartitionCallCount()).To(Equal(1))
+		month, expiresAt, reason := eventDB.HoldCFAuditEventPartitionArgsForCall(0)
+		createdAt, err := time.Parse(time.RFC3339, events[0].CreatedAt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.PartitionMonth(month)).To(Equal(db.PartitionMonth(createdAt)))
+		Expect(expiresAt).To(BeTemporally("~", time.Now().Add(30*24*time.Hour), time.Minute))
+		Expect(reason).To(Equal("restored " + objectKey))
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(2))
+
+		By("not storing events if the partition cannot be held")
+		eventDB.HoldCFAuditEventPartitionStub = nil
+		eventDB.HoldCFAuditEventPartitionReturns(fmt.Errorf("connection refused"))
+		_, err = archive.NewRestorer(logger, eventDB, store, time.Hour).Restore(objectKey)
+		Expect(err).To(MatchError(ContainSubstring("holding partition")))
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(2))
+	})
+
+	It("restores from a local copy", func() {
+		dir, err := os.MkdirTemp("", "restore")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		body, _ := fakeS3.Object(objectKey)
+		manifest, _ := fakeS3.Object(objectKey + ".manifest.json")
+		path := filepath.Join(dir, "day.ndjson.gz")
+		Expect(os.WriteFile(path, body, 0600)).To(Succeed())
+		Expect(os.WriteFile(path+".manifest.json", manifest, 0600)).To(Succeed())
+		eventDB.RestoreCFAuditEventsReturnsOnCall(0, 2, nil)
+		eventDB.RestoreCFAuditEventsReturnsOnCall(1, 1, nil)
+
+		result, err := archive.NewRestorer(logger, eventDB, archive.LocalFiles{}, 0).Restore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Stored).To(BeNumerically("==", 3))
+		Expect(result.AlreadyPresent).To(BeNumerically("==", 0))
+	})
+
+	It("reads the archived events without storing them", func() {
+		read, err := archive.NewRestorer(logger, eventDB, store, time.Hour).Read(objectKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read).To(HaveLen(3))
+		Expect(read[0].GUID).To(Equal("guid-1"))
+		Expect(read[0].Foundation).To(Equal("foundation-a"))
+		Expect(read[0].EventNames).To(Equal(db.EventNames{OrganizationName: "some-org", AppName: "app"}))
+		Expect(read[2].Foundation).To(Equal("foundation-b"))
+
+		Expect(eventDB.HoldCFAuditEventPartitionCallCount()).To(Equal(0))
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(0))
+
+		By("refusing an archive which does not match its manifest")
+		fakeS3.Corrupt = func(key string, body []byte) []byte {
+			if key == objectKey {
+				body = append([]byte{}, body...)
+				body[len(body)-1] ^= 0xff
+			}
+			return body
+		}
+		_, err = archive.NewRestorer(logger, eventDB, store, 0).Read(objectKey)
+		Expect(err).To(MatchError("archive does not match the checksum in its manifest"))
+	})
+
+	It("refuses an archive which does not match its manifest", func() {
+		fakeS3.Corrupt = func(key string, body []byte) []byte {
+			if key == objectKey {
+				body = append([]byte{}, body...)
+				body[len(body)-1] ^= 0xff
+			}
+			return body
+		}
+
+		_, err := archive.NewRestorer(logger, eventDB, store, 0).Restore(objectKey)
+		Expect(err).To(MatchError("archive does not match the checksum in its manifest"))
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(0))
+	})
+
+	It("refuses an archive without a manifest", func() {
+		_, err := archive.NewRestorer(logger, eventDB, store, 0).Restore("cf_audit_events/1970/01/01.ndjson.gz")
+		Expect(err).To(MatchError(ContainSubstring("reading manifest")))
+		Expect(eventDB.RestoreCFAuditEventsCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,341 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the size of the parts of multipart uploads. S3 needs
+// every part but the last to be at least 5 MiB.
+const DefaultPartSize = 8 * 1024 * 1024
+
+// ObjectStore is where archives are uploaded to
+type ObjectStore interface {
+	PutObject(key string, body []byte, contentType string) error
+	GetObject(key string) ([]byte, error)
+	DeleteObject(key string) error
+
+	// OpenObject returns the body of an object to be read as it is
+	// downloaded. It must be closed.
+	OpenObject(key string) (io.ReadCloser, error)
+
+	// CreateUpload starts uploading an object which is too large to hold in
+	// memory. The object is written to the Upload, and only stored once the
+	// Upload is completed.
+	CreateUpload(key string, contentType string) (Upload, error)
+}
+
+// Upload is an object being uploaded in parts
+type Upload interface {
+	io.Writer
+	Complete() error
+	Abort() error
+}
+
+// S3Config configures an S3 compatible object store. Requests use path style
+// URLs, eg https://s3.eu-west-2.amazonaws.com/bucket/key, which all S3
+// compatible stores support.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PartSize is the size of the parts of multipart uploads, or zero for
+	// DefaultPartSize
+	PartSize int
+}
+
+// S3Client is a minimal client for S3 compatible object stores, which signs
+// requests with AWS Signature Version 4
+type S3Client struct {
+	config     S3Config
+	httpClient *http.Client
+}
+
+func NewS3Client(config S3Config, httpClient *http.Client) *S3Client {
+	if config.PartSize == 0 {
+		config.PartSize = DefaultPartSize
+	}
+	return &S3Client{config, httpClient}
+}
+
+func (c *S3Client) PutObject(key string, body []byte, contentType string) error {
+	req, err := c.newRequest(http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3Client) GetObject(key string) ([]byte, error) {
+	body, err := c.OpenObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+func (c *S3Client) OpenObject(key string) (io.ReadCloser, error) {
+	req, err := c.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *S3Client) DeleteObject(key string) error {
+	req, err := c.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3Client) CreateUpload(key string, contentType string) (Upload, error) {
+	req, err := c.newRequest(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, err)
+	}
+	return &s3Upload{client: c, key: key, uploadID: result.UploadID}, nil
+}
+
+// s3Upload is a multipart upload. It holds one part in memory at a time.
+type s3Upload struct {
+	client   *S3Client
+	key      string
+	uploadID string
+
+	part  []byte
+	etags []string
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := u.client.config.PartSize - len(u.part)
+		if n > len(p) {
+			n = len(p)
+		}
+		u.part = append(u.part, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(u.part) == u.client.config.PartSize {
+			if err := u.uploadPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (u *s3Upload) uploadPart() error {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(len(u.etags) + 1)},
+		"uploadId":   {u.uploadID},
+	}
+	req, err := u.client.newRequest(http.MethodPut, u.key, query, u.part)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.do(req, u.part, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	u.etags = append(u.etags, resp.Header.Get("ETag"))
+	u.part = u.part[:0]
+	return nil
+}
+
+// Complete uploads the last part, and stores the object
+func (u *s3Upload) Complete() error {
+	if len(u.part) > 0 || len(u.etags) == 0 {
+		if err := u.uploadPart(); err != nil {
+			return err
+		}
+	}
+
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for i, etag := range u.etags {
+		complete.Parts = append(complete.Parts, part{i + 1, etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+
+	req, err := u.client.newRequest(http.MethodPost, u.key, url.Values{"uploadId": {u.uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.do(req, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 can report that completing the upload failed after it has sent
+	// the 200 status
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var s3Err struct {
+		XMLName xml.Name `xml:"Error"`
+	}
+	if xml.Unmarshal(result, &s3Err) == nil {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, strings.TrimSpace(string(result)))
+	}
+	return nil
+}
+
+// Abort discards the parts uploaded so far
+func (u *s3Upload) Abort() error {
+	req, err := u.client.newRequest(http.MethodDelete, u.key, url.Values{"uploadId": {u.uploadID}}, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.do(req, nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3Client) newRequest(method string, key string, query url.Values, body []byte) (*http.Request, error) {
+	endpoint, err := url.Parse(c.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + c.config.Bucket + "/" + key
+	endpoint.RawQuery = query.Encode()
+	return http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+}
+
+// do signs and sends a request, and returns the response if it has status
+func (c *S3Client) do(req *http.Request, body []byte, status int) (*http.Response, error) {
+	c.sign(req, body, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != status {
+		defer resp.Body.Close()
+		return nil, s3Error(req, resp)
+	}
+	return resp, nil
+}
+
+func s3Error(req *http.Request, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// sign adds the headers for AWS Signature Version 4
+func (c *S3Client) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headerNames := []string{}
+	for name := range req.Header {
+		headerNames = append(headerNames, strings.ToLower(name))
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := ""
+	for _, name := range headerNames {
+		canonicalHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + c.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), date)
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
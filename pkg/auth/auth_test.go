@@ -0,0 +1,547 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/auth"
+)
+
+const (
+	orgGUID      = "0f0a7e3e-4a5c-4c0e-8bd1-2b1d2cbb0d55"
+	otherOrgGUID = "5c0f2c0e-7a1b-4a3c-9a11-9e8d7c6b5a44"
+)
+
+// fakeUAA serves /token_keys for a set of RSA keys, and signs tokens with them
+type fakeUAA struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	keys             map[string]*rsa.PrivateKey
+	tokenKeysFetches int
+
+	// blocked, if set, holds up responses to /token_keys until it is closed
+	blocked chan struct{}
+}
+
+func newFakeUAA() *fakeUAA {
+	uaa := &fakeUAA{keys: map[string]*rsa.PrivateKey{}}
+	uaa.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token_keys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		uaa.mu.Lock()
+		uaa.tokenKeysFetches++
+		blocked := uaa.blocked
+		uaa.mu.Unlock()
+		if blocked != nil {
+			<-blocked
+		}
+		uaa.mu.Lock()
+		defer uaa.mu.Unlock()
+
+		keys := []map[string]string{}
+		for kid, key := range uaa.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	return uaa
+}
+
+func (u *fakeUAA) addKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.keys[kid] = key
+}
+
+func (u *fakeUAA) block() (unblock func()) {
+	blocked := make(chan struct{})
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.blocked = blocked
+	return func() { close(blocked) }
+}
+
+func (u *fakeUAA) fetches() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.tokenKeysFetches
+}
+
+func (u *fakeUAA) issuer() string {
+	return u.URL + "/oauth/token"
+}
+
+func (u *fakeUAA) token(kid string, claims map[string]interface{}) string {
+	u.mu.Lock()
+	key := u.keys[kid]
+	u.mu.Unlock()
+	return signToken("RS256", kid, key, claims)
+}
+
+func (u *fakeUAA) userToken(kid string, userID string, scopes ...string) string {
+	return u.token(kid, map[string]interface{}{
+		"iss":       u.issuer(),
+		"user_id":   userID,
+		"user_name": "some-user@example.com",
+		"client_id": "cf",
+		"aud":       []string{"cloud_controller", "openid"},
+		"scope":     scopes,
+		"exp":       time.Now().Add(10 * time.Minute).Unix(),
+	})
+}
+
+func signToken(alg string, kid string, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		Expect(err).NotTo(HaveOccurred())
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	Expect(err).NotTo(HaveOccurred())
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// newFakeCC serves /v3/roles, returning an organization_auditor role in each
+// of orgGUIDs for any user, over two pages
+func newFakeCC(requests *int, orgGUIDs ...string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		Expect(r.URL.Path).To(Equal("/v3/roles"))
+		Expect(r.Header.Get("Authorization")).To(HavePrefix("bearer "))
+		Expect(r.URL.Query().Get("types")).To(Equal("organization_manager,organization_auditor"))
+
+		page := orgGUIDs
+		next := interface{}(nil)
+		if r.URL.Query().Get("page") == "" && len(orgGUIDs) > 1 {
+			page = orgGUIDs[:1]
+			next = map[string]string{"href": server.URL + r.URL.Path + "?" + r.URL.RawQuery + "&page=2"}
+		} else if len(orgGUIDs) > 1 {
+			page = orgGUIDs[1:]
+		}
+
+		resources := []interface{}{}
+		for _, guid := range page {
+			resources = append(resources, map[string]interface{}{
+				"type": "organization_auditor",
+				"relationships": map[string]interface{}{
+					"user":         map[string]interface{}{"data": map[string]string{"guid": r.URL.Query().Get("user_guids")}},
+					"organization": map[string]interface{}{"data": map[string]string{"guid": guid}},
+					"space":        map[string]interface{}{"data": nil},
+				},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pagination": map[string]interface{}{"next": next},
+			"resources":  resources,
+		})
+	}))
+	return server
+}
+
+var _ = Describe("Verifier", func() {
+	var (
+		uaa                *fakeUAA
+		verifier           *auth.Verifier
+		minRefreshInterval time.Duration
+	)
+
+	BeforeEach(func() {
+		minRefreshInterval = 0
+	})
+
+	JustBeforeEach(func() {
+		logger := lager.NewLogger("auth-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		uaa = newFakeUAA()
+		uaa.addKey("key-1")
+		verifier = auth.NewVerifier(auth.NewTokenKeys(uaa.URL, minRefreshInterval, uaa.Client(), logger), uaa.issuer(), "cloud_controller")
+	})
+
+	AfterEach(func() {
+		uaa.Close()
+	})
+
+	It("returns the claims of a valid token", func() {
+		claims, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid", "openid", "cloud_controller.read"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.UserID).To(Equal("some-user-guid"))
+		Expect(claims.UserName).To(Equal("some-user@example.com"))
+		Expect(claims.HasScope("cloud_controller.read")).To(BeTrue())
+		Expect(claims.HasScope("cloud_controller.admin")).To(BeFalse())
+	})
+
+	It("caches the token keys", func() {
+		for i := 0; i < 3; i++ {
+			_, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(uaa.fetches()).To(Equal(1))
+	})
+
+	It("fetches the token keys again when UAA starts signing with a new key", func() {
+		_, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+		Expect(err).NotTo(HaveOccurred())
+
+		uaa.addKey("key-2")
+		time.Sleep(time.Millisecond)
+		_, err = verifier.Verify(uaa.userToken("key-2", "some-user-guid"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uaa.fetches()).To(Equal(2))
+	})
+
+	It("verifies tokens with keys it has while UAA is slow to return new keys", func() {
+		_, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+		Expect(err).NotTo(HaveOccurred())
+
+		unblock := uaa.block()
+		uaa.addKey("key-2")
+		token := uaa.userToken("key-2", "some-user-guid")
+		verified := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := verifier.Verify(token)
+			verified <- err
+		}()
+		Eventually(uaa.fetches).Should(Equal(2))
+
+		_, err = verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verified).NotTo(Receive())
+
+		unblock()
+		Eventually(verified).Should(Receive(BeNil()))
+	})
+
+	It("fetches the token keys once for requests which need them at the same time", func() {
+		_, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+		Expect(err).NotTo(HaveOccurred())
+
+		unblock := uaa.block()
+		uaa.addKey("key-2")
+		token := uaa.userToken("key-2", "some-user-guid")
+		verified := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			go func() {
+				defer GinkgoRecover()
+				_, err := verifier.Verify(token)
+				verified <- err
+			}()
+		}
+		Eventually(uaa.fetches).Should(Equal(2))
+		Consistently(uaa.fetches, "20ms", "1ms").Should(Equal(2))
+
+		unblock()
+		for i := 0; i < 5; i++ {
+			Eventually(verified).Should(Receive(BeNil()))
+		}
+		Expect(uaa.fetches()).To(Equal(2))
+	})
+
+	Context("when the keys were fetched recently", func() {
+		BeforeEach(func() {
+			minRefreshInterval = time.Hour
+		})
+
+		It("does not fetch them again for an unknown key", func() {
+			_, err := verifier.Verify(uaa.userToken("key-1", "some-user-guid"))
+			Expect(err).NotTo(HaveOccurred())
+
+			uaa.addKey("key-2")
+			_, err = verifier.Verify(uaa.userToken("key-2", "some-user-guid"))
+			Expect(err).To(MatchError(`unknown token key "key-2"`))
+			Expect(uaa.fetches()).To(Equal(1))
+		})
+	})
+
+	It("rejects a token signed with a key UAA does not have", func() {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		token := signToken("RS256", "key-1", otherKey, map[string]interface{}{
+			"iss": uaa.issuer(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+
+		_, err = verifier.Verify(token)
+		Expect(err).To(MatchError("invalid token signature"))
+	})
+
+	It("rejects an expired token", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss": uaa.issuer(),
+			"exp": time.Now().Add(-time.Minute - auth.ClockSkew).Unix(),
+		})
+
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError("token has expired"))
+	})
+
+	It("rejects a token which is not valid yet", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss": uaa.issuer(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"nbf": time.Now().Add(time.Minute + auth.ClockSkew).Unix(),
+		})
+
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError("token is not valid yet"))
+	})
+
+	It("rejects a token from another issuer", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss": "https://uaa.example.com/oauth/token",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError(ContainSubstring("token issued by")))
+	})
+
+	It("rejects a token for another audience", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss": uaa.issuer(),
+			"aud": []string{"some-other-service"},
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError(`token is not for audience "cloud_controller"`))
+
+		By("rejecting a token without an audience")
+		token = uaa.token("key-1", map[string]interface{}{
+			"iss": uaa.issuer(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+
+		_, err = verifier.Verify(token)
+		Expect(err).To(MatchError(`token is not for audience "cloud_controller"`))
+	})
+
+	It("accepts a token whose audience is a single string", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss": uaa.issuer(),
+			"aud": "cloud_controller",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+
+		_, err := verifier.Verify(token)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects tokens which are not signed with RS256", func() {
+		encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+		token := encode(`{"alg":"none","kid":"key-1"}`) + "." + encode(`{}`) + "."
+
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError(`unsupported token signing algorithm "none"`))
+	})
+
+	It("rejects malformed tokens", func() {
+		_, err := verifier.Verify("not-a-jwt")
+		Expect(err).To(MatchError("malformed token"))
+	})
+})
+
+var _ = Describe("Authenticator", func() {
+	var (
+		uaa             *fakeUAA
+		cc              *httptest.Server
+		ccRequests      int
+		otherUAA        *fakeUAA
+		otherCC         *httptest.Server
+		otherCCRequests int
+		authenticator   *auth.Authenticator
+		handler         http.Handler
+		seenPrincipal   *auth.Principal
+		handlerRequests int
+	)
+
+	BeforeEach(func() {
+		logger := lager.NewLogger("auth-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		uaa = newFakeUAA()
+		uaa.addKey("key-1")
+		ccRequests = 0
+		cc = newFakeCC(&ccRequests, orgGUID, otherOrgGUID)
+		otherUAA = newFakeUAA()
+		otherUAA.addKey("key-1")
+		otherCCRequests = 0
+		otherCC = newFakeCC(&otherCCRequests, otherOrgGUID)
+
+		verifier := auth.NewVerifier(auth.NewTokenKeys(uaa.URL, time.Minute, uaa.Client(), logger), uaa.issuer(), "cloud_controller")
+		authenticator = auth.NewAuthenticator(
+			logger,
+			[]auth.Foundation{{
+				Name:     "london",
+				Verifier: verifier,
+				OrgRoles: auth.NewOrgRoles(cc.URL, cc.Client(), time.Minute),
+			}, {
+				Name:     "paris",
+				Verifier: auth.NewVerifier(auth.NewTokenKeys(otherUAA.URL, time.Minute, otherUAA.Client(), logger), otherUAA.issuer(), "cloud_controller"),
+				OrgRoles: auth.NewOrgRoles(otherCC.URL, otherCC.Client(), time.Minute),
+			}},
+			[]string{"cloud_controller.admin", "cloud_controller.global_auditor"},
+		)
+
+		seenPrincipal = nil
+		handlerRequests = 0
+		handler = authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerRequests++
+			seenPrincipal, _ = auth.FromContext(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	})
+
+	AfterEach(func() {
+		uaa.Close()
+		cc.Close()
+		otherUAA.Close()
+		otherCC.Close()
+	})
+
+	request := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/events", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	It("treats a principal with an admin scope as an admin", func() {
+		w := request("bearer " + uaa.userToken("key-1", "admin-user-guid", "cloud_controller.global_auditor"))
+		Expect(w.Code).To(Equal(http.StatusTeapot))
+
+		Expect(seenPrincipal).NotTo(BeNil())
+		Expect(seenPrincipal.UserID).To(Equal("admin-user-guid"))
+		Expect(seenPrincipal.Admin).To(BeTrue())
+		Expect(seenPrincipal.CanSeeOrganization("london", "any-org-guid")).To(BeTrue())
+		Expect(ccRequests).To(Equal(0))
+	})
+
+	It("looks up the organizations other users have roles in", func() {
+		w := request("Bearer " + uaa.userToken("key-1", "some-user-guid", "cloud_controller.read"))
+		Expect(w.Code).To(Equal(http.StatusTeapot))
+
+		Expect(seenPrincipal.Admin).To(BeFalse())
+		Expect(seenPrincipal.Organizations).To(Equal(map[string][]string{"london": {orgGUID, otherOrgGUID}}))
+		Expect(seenPrincipal.CanSeeOrganization("london", orgGUID)).To(BeTrue())
+		Expect(seenPrincipal.CanSeeOrganization("london", "any-org-guid")).To(BeFalse())
+		Expect(seenPrincipal.CanSeeOrganization("paris", orgGUID)).To(BeFalse())
+		Expect(ccRequests).To(Equal(2))
+		Expect(otherCCRequests).To(Equal(0))
+
+		By("caching the roles")
+		w = request("Bearer " + uaa.userToken("key-1", "some-user-guid", "cloud_controller.read"))
+		Expect(w.Code).To(Equal(http.StatusTeapot))
+		Expect(ccRequests).To(Equal(2))
+	})
+
+	It("looks up the roles of users of another foundation with that foundation", func() {
+		w := request("Bearer " + otherUAA.userToken("key-1", "some-user-guid", "cloud_controller.read"))
+		Expect(w.Code).To(Equal(http.StatusTeapot))
+
+		Expect(seenPrincipal.Organizations).To(Equal(map[string][]string{"paris": {otherOrgGUID}}))
+		Expect(seenPrincipal.CanSeeOrganization("paris", otherOrgGUID)).To(BeTrue())
+		Expect(seenPrincipal.CanSeeOrganization("london", otherOrgGUID)).To(BeFalse())
+		Expect(ccRequests).To(Equal(0))
+		Expect(otherCCRequests).To(Equal(1))
+	})
+
+	It("does not look up roles for client tokens without a user", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss":       uaa.issuer(),
+			"aud":       []string{"cloud_controller"},
+			"client_id": "some-client",
+			"exp":       time.Now().Add(time.Minute).Unix(),
+		})
+
+		w := request("bearer " + token)
+		Expect(w.Code).To(Equal(http.StatusTeapot))
+		Expect(seenPrincipal.ClientID).To(Equal("some-client"))
+		Expect(seenPrincipal.Admin).To(BeFalse())
+		Expect(seenPrincipal.Organizations).To(BeEmpty())
+		Expect(ccRequests).To(Equal(0))
+	})
+
+	It("rejects requests without a token", func() {
+		w := request("")
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(w.Header().Get("WWW-Authenticate")).To(HavePrefix("Bearer"))
+		Expect(handlerRequests).To(Equal(0))
+
+		w = request("Basic dXNlcjpwYXNz")
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(handlerRequests).To(Equal(0))
+	})
+
+	It("rejects requests with an invalid token", func() {
+		w := request("bearer not-a-jwt")
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(handlerRequests).To(Equal(0))
+	})
+
+	It("rejects tokens from an issuer which is not the UAA of a foundation", func() {
+		token := uaa.token("key-1", map[string]interface{}{
+			"iss":     "https://uaa.example.com/oauth/token",
+			"aud":     []string{"cloud_controller"},
+			"user_id": "some-user-guid",
+			"exp":     time.Now().Add(time.Minute).Unix(),
+		})
+
+		w := request("bearer " + token)
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(handlerRequests).To(Equal(0))
+	})
+
+	It("rejects tokens signed by another foundation's UAA in the name of this one", func() {
+		token := otherUAA.token("key-1", map[string]interface{}{
+			"iss":     uaa.issuer(),
+			"aud":     []string{"cloud_controller"},
+			"user_id": "some-user-guid",
+			"exp":     time.Now().Add(time.Minute).Unix(),
+		})
+
+		w := request("bearer " + token)
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(handlerRequests).To(Equal(0))
+	})
+
+	It("fails closed if Cloud Controller cannot be reached", func() {
+		cc.Close()
+
+		w := request("bearer " + uaa.userToken("key-1", "some-user-guid"))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(handlerRequests).To(Equal(0))
+	})
+})
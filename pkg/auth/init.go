@@ -0,0 +1,5 @@
+package auth
+
+func init() {
+	initMetrics()
+}
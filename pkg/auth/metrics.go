@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	AuthRequestsRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_requests_rejected_total",
+		Help: "Number of requests rejected because they had no valid UAA token",
+	}, []string{"reason"})
+
+	AuthErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_errors_total",
+		Help: "Number of errors encountered while looking up a user's organization roles",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(AuthRequestsRejectedTotal)
+	prometheus.MustRegister(AuthErrorsTotal)
+}
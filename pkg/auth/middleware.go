@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type contextKey struct{}
+
+// Principal is who made a request, and which events they may see
+type Principal struct {
+	UserID   string
+	UserName string
+	ClientID string
+
+	// Admin principals may see every event
+	Admin bool
+
+	// Organizations are the GUIDs of the organizations whose events a
+	// principal who is not an admin may see, by the name of their foundation
+	Organizations map[string][]string
+}
+
+// CanSeeOrganization says whether the principal may see the events of the
+// organization with guid in foundation
+func (p *Principal) CanSeeOrganization(foundation string, guid string) bool {
+	if p.Admin {
+		return true
+	}
+	for _, g := range p.Organizations[foundation] {
+		if g == guid {
+			return true
+		}
+	}
+	return false
+}
+
+// Foundation is a foundation whose users may read its events. Their tokens
+// are checked by Verifier, and their roles looked up with OrgRoles.
+type Foundation struct {
+	Name     string
+	Verifier *Verifier
+	OrgRoles *OrgRoles
+}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Authenticator is HTTP middleware which only lets through requests with a
+// valid access token from the UAA of one of the foundations, and adds the
+// Principal to the request context. A user's organizations are looked up in
+// every foundation which shares that UAA. Deciding what the principal may see
+// is left to the handler.
+type Authenticator struct {
+	logger      lager.Logger
+	foundations []Foundation
+	adminScopes []string
+}
+
+func NewAuthenticator(
+	logger lager.Logger,
+	foundations []Foundation,
+	adminScopes []string,
+) *Authenticator {
+	logger = logger.Session("authenticator")
+	return &Authenticator{logger, foundations, adminScopes}
+}
+
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			a.reject(w, "missing-token", "missing bearer token")
+			return
+		}
+
+		issuer := unverifiedIssuer(token)
+		foundations := []Foundation{}
+		for _, foundation := range a.foundations {
+			if foundation.Verifier.Issuer() == issuer {
+				foundations = append(foundations, foundation)
+			}
+		}
+		if len(foundations) == 0 {
+			a.logger.Info("invalid-token", lager.Data{"error": "unknown issuer", "issuer": issuer})
+			a.reject(w, "invalid-token", "invalid token")
+			return
+		}
+
+		claims, err := foundations[0].Verifier.Verify(token)
+		if err != nil {
+			a.logger.Info("invalid-token", lager.Data{"error": err.Error()})
+			a.reject(w, "invalid-token", "invalid token")
+			return
+		}
+
+		principal := &Principal{
+			UserID:   claims.UserID,
+			UserName: claims.UserName,
+			ClientID: claims.ClientID,
+		}
+		for _, scope := range a.adminScopes {
+			if claims.HasScope(scope) {
+				principal.Admin = true
+			}
+		}
+
+		// Client credentials tokens have no user, and so no roles
+		if !principal.Admin && principal.UserID != "" {
+			principal.Organizations = map[string][]string{}
+			for _, foundation := range foundations {
+				guids, err := foundation.OrgRoles.OrganizationGUIDs(r.Context(), principal.UserID, token)
+				if err != nil {
+					a.logger.Error("err-get-organization-roles", err, lager.Data{
+						"user_id":    principal.UserID,
+						"foundation": foundation.Name,
+					})
+					AuthErrorsTotal.Inc()
+					writeError(w, http.StatusServiceUnavailable, "could not look up organization roles")
+					return
+				}
+				principal.Organizations[foundation.Name] = guids
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+	})
+}
+
+func (a *Authenticator) reject(w http.ResponseWriter, reason string, message string) {
+	AuthRequestsRejectedTotal.WithLabelValues(reason).Inc()
+	w.Header().Set("WWW-Authenticate", `Bearer realm="paas-auditor"`)
+	writeError(w, http.StatusUnauthorized, message)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") || parts[1] == "" {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultOrgRolesCacheTTL = 1 * time.Minute
+
+// OrgRoleTypes are the Cloud Controller roles which let a user see the audit
+// events of an organization
+var OrgRoleTypes = []string{"organization_manager", "organization_auditor"}
+
+type rolesResponse struct {
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []struct {
+		Relationships struct {
+			Organization struct {
+				Data *struct {
+					GUID string `json:"guid"`
+				} `json:"data"`
+			} `json:"organization"`
+		} `json:"relationships"`
+	} `json:"resources"`
+}
+
+type cachedOrgGUIDs struct {
+	guids     []string
+	fetchedAt time.Time
+}
+
+// OrgRoles looks up which organizations a user has a role in from Cloud
+// Controller's /v3/roles, using the user's own token. Results are cached per
+// user for ttl, so a role that is removed keeps working for up to ttl.
+type OrgRoles struct {
+	ccURL  string
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedOrgGUIDs
+}
+
+func NewOrgRoles(ccURL string, client *http.Client, ttl time.Duration) *OrgRoles {
+	return &OrgRoles{
+		ccURL:  strings.TrimSuffix(ccURL, "/"),
+		client: client,
+		ttl:    ttl,
+		cache:  map[string]cachedOrgGUIDs{},
+	}
+}
+
+// OrganizationGUIDs returns the GUIDs of the organizations in which the user
+// is an organization manager or auditor
+func (o *OrgRoles) OrganizationGUIDs(ctx context.Context, userID string, token string) ([]string, error) {
+	o.mu.Lock()
+	cached, ok := o.cache[userID]
+	o.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < o.ttl {
+		return cached.guids, nil
+	}
+
+	query := url.Values{}
+	query.Set("user_guids", userID)
+	query.Set("types", strings.Join(OrgRoleTypes, ","))
+	query.Set("per_page", "5000")
+	nextURL := o.ccURL + "/v3/roles?" + query.Encode()
+
+	guids := []string{}
+	seen := map[string]bool{}
+	for nextURL != "" {
+		var page rolesResponse
+		if err := o.get(ctx, nextURL, token, &page); err != nil {
+			return nil, err
+		}
+		for _, role := range page.Resources {
+			org := role.Relationships.Organization.Data
+			if org != nil && !seen[org.GUID] {
+				seen[org.GUID] = true
+				guids = append(guids, org.GUID)
+			}
+		}
+		nextURL = ""
+		if page.Pagination.Next != nil {
+			nextURL = page.Pagination.Next.Href
+		}
+	}
+
+	o.mu.Lock()
+	o.cache[userID] = cachedOrgGUIDs{guids, time.Now()}
+	o.mu.Unlock()
+
+	return guids, nil
+}
+
+func (o *OrgRoles) get(ctx context.Context, u string, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching roles: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fetching roles: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching roles: Status: %d Body: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
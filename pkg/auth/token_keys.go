@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	DefaultTokenKeysMaxAge             = 1 * time.Hour
+	DefaultTokenKeysMinRefreshInterval = 10 * time.Second
+	DefaultTokenKeysRefreshTimeout     = 10 * time.Second
+)
+
+type tokenKeysResponse struct {
+	Keys []tokenKey `json:"keys"`
+}
+
+type tokenKey struct {
+	KeyID   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Alg     string `json:"alg"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Value   string `json:"value"`
+}
+
+// TokenKeys caches the keys UAA signs tokens with, from its /token_keys
+// endpoint. UAA rotates keys by adding a new key and later removing the old
+// one, so the keys are fetched again when a token is signed with a key we
+// have not seen, and whenever they are older than maxAge.
+//
+// The keys are fetched without holding the lock, so requests with keys we
+// have are not held up while UAA is slow. Requests which need the keys
+// fetched while they are being fetched wait for that fetch, rather than
+// fetching them again.
+type TokenKeys struct {
+	uaaURL             string
+	client             *http.Client
+	maxAge             time.Duration
+	minRefreshInterval time.Duration
+	refreshTimeout     time.Duration
+	logger             lager.Logger
+
+	mu         sync.Mutex
+	keys       map[string]*rsa.PublicKey
+	fetchedAt  time.Time
+	refreshing *refresh
+}
+
+// refresh is a fetch of the keys which is in progress. done is closed once it
+// has finished, after which err is set.
+type refresh struct {
+	done chan struct{}
+	err  error
+}
+
+// NewTokenKeys returns a TokenKeys which fetches keys from UAA at most once
+// every minRefreshInterval because of tokens with unknown keys, so that bad
+// tokens cannot be used to flood UAA with requests
+func NewTokenKeys(
+	uaaURL string,
+	minRefreshInterval time.Duration,
+	client *http.Client,
+	logger lager.Logger,
+) *TokenKeys {
+	return &TokenKeys{
+		uaaURL:             strings.TrimSuffix(uaaURL, "/"),
+		client:             client,
+		maxAge:             DefaultTokenKeysMaxAge,
+		minRefreshInterval: minRefreshInterval,
+		refreshTimeout:     DefaultTokenKeysRefreshTimeout,
+		logger:             logger.Session("token-keys"),
+		keys:               map[string]*rsa.PublicKey{},
+	}
+}
+
+// Key returns the public key with the given key ID
+func (k *TokenKeys) Key(keyID string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	age := time.Since(k.fetchedAt)
+	key, ok := k.keys[keyID]
+	stale := age > k.maxAge
+	unknown := !ok && age > k.minRefreshInterval
+	k.mu.Unlock()
+
+	if stale || unknown {
+		if err := k.refresh(); err != nil {
+			// Keep using the keys we have if UAA is briefly unavailable
+			if ok {
+				k.logger.Error("err-refresh-token-keys", err)
+				return key, nil
+			}
+			return nil, err
+		}
+		k.mu.Lock()
+		key, ok = k.keys[keyID]
+		k.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown token key %q", keyID)
+	}
+	return key, nil
+}
+
+// refresh fetches the keys, or waits for the fetch which is already in
+// progress, and returns its error
+func (k *TokenKeys) refresh() error {
+	k.mu.Lock()
+	r := k.refreshing
+	if r != nil {
+		k.mu.Unlock()
+		<-r.done
+		return r.err
+	}
+	r = &refresh{done: make(chan struct{})}
+	k.refreshing = r
+	k.mu.Unlock()
+
+	keys, err := k.fetch()
+
+	k.mu.Lock()
+	if err == nil {
+		k.keys = keys
+		k.fetchedAt = time.Now()
+	}
+	k.refreshing = nil
+	k.mu.Unlock()
+
+	r.err = err
+	close(r.done)
+	return err
+}
+
+// fetch fetches the keys from UAA, giving up after refreshTimeout
+func (k *TokenKeys) fetch() (map[string]*rsa.PublicKey, error) {
+	k.logger.Info("refresh")
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.refreshTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", k.uaaURL+"/token_keys", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching token keys: %w", err)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching token keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching token keys: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching token keys: Status: %d Body: %s", resp.StatusCode, body)
+	}
+
+	var keysResp tokenKeysResponse
+	if err := json.Unmarshal(body, &keysResp); err != nil {
+		return nil, fmt.Errorf("fetching token keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, tk := range keysResp.Keys {
+		if tk.KeyType != "RSA" {
+			continue
+		}
+		key, err := tk.publicKey()
+		if err != nil {
+			k.logger.Error("err-parse-token-key", err, lager.Data{"kid": tk.KeyID})
+			continue
+		}
+		keys[tk.KeyID] = key
+	}
+	return keys, nil
+}
+
+// publicKey reads the key from its JWK modulus and exponent, or from the PEM
+// encoded value which older versions of UAA return instead
+func (tk tokenKey) publicKey() (*rsa.PublicKey, error) {
+	if tk.N != "" && tk.E != "" {
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(tk.N, "="))
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(tk.E, "="))
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+
+	block, _ := pem.Decode([]byte(tk.Value))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key in value")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not an RSA public key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ClockSkew is how far the clocks of UAA and the auditor are allowed to
+// differ when checking whether a token has expired
+const ClockSkew = 30 * time.Second
+
+type tokenHeader struct {
+	Alg   string `json:"alg"`
+	KeyID string `json:"kid"`
+}
+
+// Claims are the claims we use from a UAA access token
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	Subject   string   `json:"sub"`
+	UserID    string   `json:"user_id"`
+	UserName  string   `json:"user_name"`
+	ClientID  string   `json:"client_id"`
+	Scope     []string `json:"scope"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// audience is the aud claim, which may be a single string or a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scope {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier checks that access tokens were signed by UAA for the auditor and
+// are current
+type Verifier struct {
+	keys     *TokenKeys
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewVerifier returns a Verifier that only accepts tokens issued by issuer,
+// which for UAA is its URL followed by /oauth/token, for audience
+func NewVerifier(keys *TokenKeys, issuer string, audience string) *Verifier {
+	return &Verifier{keys, issuer, audience, time.Now}
+}
+
+// Issuer returns the issuer of the tokens the Verifier accepts
+func (v *Verifier) Issuer() string {
+	return v.issuer
+}
+
+// Verify checks the signature and validity period of a token and returns its
+// claims. Only RS256 signed tokens are accepted.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported token signing algorithm %q", header.Alg)
+	}
+
+	key, err := v.keys.Key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(ClockSkew)) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-ClockSkew)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("token issued by %q, not %q", claims.Issuer, v.issuer)
+	}
+	if !claims.Audience.contains(v.audience) {
+		return nil, fmt.Errorf("token is not for audience %q", v.audience)
+	}
+
+	return &claims, nil
+}
+
+// unverifiedIssuer returns the issuer claimed by a token, without checking
+// the token, to choose which Verifier to check it with
+func unverifiedIssuer(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,97 @@
+package checkpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Checkpointer periodically signs the head of the hash chain, along with the
+// head of the chain of erasures, and stores the checkpoint. The chain detects events being edited, added or removed in the
+// middle of the table, and checkpoints detect events being removed from the
+// end, as long as the checkpoints are kept somewhere the database's users
+// cannot change them, such as a metrics store.
+type Checkpointer struct {
+	schedule time.Duration
+	logger   lager.Logger
+	eventDB  db.EventDB
+	signer   *Signer
+}
+
+func NewCheckpointer(
+	schedule time.Duration,
+	logger lager.Logger,
+	eventDB db.EventDB,
+	signer *Signer,
+) *Checkpointer {
+	logger = logger.Session("checkpointer")
+	return &Checkpointer{schedule, logger, eventDB, signer}
+}
+
+func (c *Checkpointer) Run(ctx context.Context) error {
+	lsession := c.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(c.schedule):
+			if err := c.checkpoint(lsession); err != nil {
+				lsession.Error("err-checkpoint", err)
+				CheckpointerErrorsTotal.Inc()
+			}
+		}
+	}
+}
+
+func (c *Checkpointer) checkpoint(lsession lager.Logger) error {
+	head, err := c.eventDB.GetChainHead()
+	if err != nil {
+		return err
+	}
+	if head.ID == 0 {
+		lsession.Info("no-events")
+		return nil
+	}
+
+	latest, err := c.eventDB.GetLatestChainCheckpoint()
+	if err != nil {
+		return err
+	}
+	if latest != nil && latest.HeadID == head.ID && bytes.Equal(latest.ChainHash, head.ChainHash) &&
+		latest.ErasureSeq == head.ErasureSeq && bytes.Equal(latest.ErasureChainHash, head.ErasureChainHash) {
+		c.setMetrics(*latest)
+		return nil
+	}
+
+	cp := c.signer.Sign(head, time.Now())
+	if err := c.eventDB.StoreChainCheckpoint(cp); err != nil {
+		return err
+	}
+	lsession.Info("stored-checkpoint", lager.Data{
+		"head_id":    cp.HeadID,
+		"chain_hash": hex.EncodeToString(cp.ChainHash),
+		"key_id":     cp.KeyID,
+
+		"erasure_seq":        cp.ErasureSeq,
+		"erasure_chain_hash": hex.EncodeToString(cp.ErasureChainHash),
+	})
+	c.setMetrics(cp)
+	return nil
+}
+
+func (c *Checkpointer) setMetrics(cp db.ChainCheckpoint) {
+	CheckpointerLatestCheckpoint.Reset()
+	CheckpointerLatestCheckpoint.WithLabelValues(
+		hex.EncodeToString(cp.ChainHash), cp.KeyID,
+	).Set(float64(cp.HeadID))
+	CheckpointerLatestCheckpointTimestamp.Set(float64(cp.SignedAt.Unix()))
+}
@@ -0,0 +1,186 @@
+package checkpoints_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/checkpoints"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var signingKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+var _ = Describe("Signer", func() {
+	var signer *checkpoints.Signer
+
+	BeforeEach(func() {
+		var err error
+		signer, err = checkpoints.NewSigner(signingKey)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("signs checkpoints which verify with its public key", func() {
+		signedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		cp := signer.Sign(db.ChainHead{ID: 42, ChainHash: []byte{0xab, 0xcd}}, signedAt)
+
+		Expect(cp.HeadID).To(BeNumerically("==", 42))
+		Expect(cp.ChainHash).To(Equal([]byte{0xab, 0xcd}))
+		Expect(cp.SignedAt).To(Equal(signedAt))
+		Expect(cp.KeyID).To(Equal(checkpoints.KeyID(signer.PublicKey())))
+		Expect(string(checkpoints.SignedPayload(cp))).To(Equal(
+			"paas-auditor-chain-checkpoint:v1\n42\nabcd\n2020-01-02T03:04:05Z\n",
+		))
+		Expect(checkpoints.Verify(signer.PublicKey(), cp)).To(BeTrue())
+
+		By("rejecting a checkpoint that has been edited")
+		edited := cp
+		edited.HeadID = 41
+		Expect(checkpoints.Verify(signer.PublicKey(), edited)).To(BeFalse())
+
+		By("rejecting a checkpoint signed with another key")
+		otherSigner, err := checkpoints.NewSigner(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoints.Verify(otherSigner.PublicKey(), cp)).To(BeFalse())
+	})
+
+	It("signs the head of the chain of erasures when there is one", func() {
+		signedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		cp := signer.Sign(db.ChainHead{
+			ID: 42, ChainHash: []byte{0xab, 0xcd},
+			ErasureSeq: 3, ErasureChainHash: []byte{0xef, 0x01},
+		}, signedAt)
+
+		Expect(cp.ErasureSeq).To(BeNumerically("==", 3))
+		Expect(cp.ErasureChainHash).To(Equal([]byte{0xef, 0x01}))
+		Expect(string(checkpoints.SignedPayload(cp))).To(Equal(
+			"paas-auditor-chain-checkpoint:v2\n42\nabcd\n3\nef01\n2020-01-02T03:04:05Z\n",
+		))
+		Expect(checkpoints.Verify(signer.PublicKey(), cp)).To(BeTrue())
+
+		By("rejecting a checkpoint whose erasure head has been edited")
+		edited := cp
+		edited.ErasureChainHash = []byte{0xef, 0x02}
+		Expect(checkpoints.Verify(signer.PublicKey(), edited)).To(BeFalse())
+
+		By("rejecting a checkpoint whose erasure head has been removed")
+		edited = cp
+		edited.ErasureSeq, edited.ErasureChainHash = 0, nil
+		Expect(checkpoints.Verify(signer.PublicKey(), edited)).To(BeFalse())
+	})
+
+	It("reads public keys", func() {
+		encoded := base64.StdEncoding.EncodeToString(signer.PublicKey())
+		key, err := checkpoints.ParsePublicKey(encoded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(signer.PublicKey()))
+
+		_, err = checkpoints.ParsePublicKey("c2hvcnQ=")
+		Expect(err).To(MatchError("public key must be 32 bytes, not 5"))
+	})
+
+	It("rejects signing keys which are not 32 bytes", func() {
+		_, err := checkpoints.NewSigner("c2hvcnQ=")
+		Expect(err).To(MatchError("signing key must be 32 bytes, not 5"))
+	})
+})
+
+var _ = Describe("Checkpointer Run", func() {
+	var (
+		logger       lager.Logger
+		eventDB      *dbfakes.FakeEventDB
+		signer       *checkpoints.Signer
+		checkpointer *checkpoints.Checkpointer
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("checkpointer-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		var err error
+		signer, err = checkpoints.NewSigner(signingKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		eventDB = &dbfakes.FakeEventDB{}
+		checkpointer = checkpoints.NewCheckpointer(10*time.Millisecond, logger, eventDB, signer)
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("signs and stores the chain head", func() {
+		eventDB.GetChainHeadReturns(db.ChainHead{ID: 7, ChainHash: []byte{0x01, 0x02}}, nil)
+
+		go checkpointer.Run(ctx)
+
+		Eventually(eventDB.StoreChainCheckpointCallCount).Should(BeNumerically(">=", 1))
+		cp := eventDB.StoreChainCheckpointArgsForCall(0)
+		Expect(cp.HeadID).To(BeNumerically("==", 7))
+		Expect(checkpoints.Verify(signer.PublicKey(), cp)).To(BeTrue())
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(checkpoints.CheckpointerLatestCheckpoint.WithLabelValues("0102", cp.KeyID))
+		}).Should(BeNumerically("==", 7))
+	})
+
+	It("does not store another checkpoint if the head has not moved", func() {
+		head := db.ChainHead{ID: 7, ChainHash: []byte{0x01, 0x02}}
+		latest := signer.Sign(head, time.Now())
+		eventDB.GetChainHeadReturns(head, nil)
+		eventDB.GetLatestChainCheckpointReturns(&latest, nil)
+
+		go checkpointer.Run(ctx)
+
+		Eventually(eventDB.GetLatestChainCheckpointCallCount).Should(BeNumerically(">=", 3))
+		Expect(eventDB.StoreChainCheckpointCallCount()).To(Equal(0))
+	})
+
+	It("stores another checkpoint if only the head of the chain of erasures has moved", func() {
+		head := db.ChainHead{ID: 7, ChainHash: []byte{0x01, 0x02}, ErasureSeq: 1, ErasureChainHash: []byte{0x03}}
+		latest := signer.Sign(head, time.Now())
+		head.ErasureSeq, head.ErasureChainHash = 2, []byte{0x04}
+		eventDB.GetChainHeadReturns(head, nil)
+		eventDB.GetLatestChainCheckpointReturns(&latest, nil)
+
+		go checkpointer.Run(ctx)
+
+		Eventually(eventDB.StoreChainCheckpointCallCount).Should(BeNumerically(">=", 1))
+		cp := eventDB.StoreChainCheckpointArgsForCall(0)
+		Expect(cp.HeadID).To(BeNumerically("==", 7))
+		Expect(cp.ErasureSeq).To(BeNumerically("==", 2))
+		Expect(cp.ErasureChainHash).To(Equal([]byte{0x04}))
+		Expect(checkpoints.Verify(signer.PublicKey(), cp)).To(BeTrue())
+	})
+
+	It("does not store a checkpoint if there are no events", func() {
+		eventDB.GetChainHeadReturns(db.ChainHead{}, nil)
+
+		go checkpointer.Run(ctx)
+
+		Eventually(eventDB.GetChainHeadCallCount).Should(BeNumerically(">=", 3))
+		Expect(eventDB.StoreChainCheckpointCallCount()).To(Equal(0))
+	})
+
+	It("counts errors and carries on", func() {
+		errorsBefore := h.CurrentMetricValue(checkpoints.CheckpointerErrorsTotal)
+		eventDB.GetChainHeadReturns(db.ChainHead{}, fmt.Errorf("connection refused"))
+
+		go checkpointer.Run(ctx)
+
+		Eventually(eventDB.GetChainHeadCallCount).Should(BeNumerically(">=", 3))
+		Expect(h.CurrentMetricValue(checkpoints.CheckpointerErrorsTotal)).To(BeNumerically(">=", errorsBefore+2))
+	})
+})
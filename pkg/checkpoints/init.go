@@ -0,0 +1,5 @@
+package checkpoints
+
+func init() {
+	initMetrics()
+}
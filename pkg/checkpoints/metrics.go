@@ -0,0 +1,28 @@
+package checkpoints
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	CheckpointerErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chain_checkpointer_errors_total",
+		Help: "Number of errors encountered while checkpointing the hash chain of stored events",
+	})
+
+	CheckpointerLatestCheckpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chain_checkpointer_latest_checkpoint_head_id",
+		Help: "Id of the event at the head of the most recent signed checkpoint, labelled by its chain hash and signing key",
+	}, []string{"chain_hash", "key_id"})
+
+	CheckpointerLatestCheckpointTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chain_checkpointer_latest_checkpoint_timestamp",
+		Help: "Unix epoch seconds when the most recent checkpoint was signed",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(CheckpointerErrorsTotal)
+	prometheus.MustRegister(CheckpointerLatestCheckpoint)
+	prometheus.MustRegister(CheckpointerLatestCheckpointTimestamp)
+}
@@ -0,0 +1,98 @@
+package checkpoints
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Signer signs checkpoints of the chain head with an Ed25519 key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner returns a Signer using the base64 encoded 32 byte Ed25519 seed
+func NewSigner(encodedSeed string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedSeed))
+	if err != nil {
+		return nil, fmt.Errorf("decoding signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, not %d", ed25519.SeedSize, len(seed))
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	return &Signer{key, KeyID(key.Public().(ed25519.PublicKey))}, nil
+}
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func (s *Signer) Sign(head db.ChainHead, signedAt time.Time) db.ChainCheckpoint {
+	cp := db.ChainCheckpoint{
+		HeadID:    head.ID,
+		ChainHash: head.ChainHash,
+		SignedAt:  signedAt.UTC(),
+		KeyID:     s.keyID,
+
+		ErasureSeq:       head.ErasureSeq,
+		ErasureChainHash: head.ErasureChainHash,
+	}
+	cp.Signature = ed25519.Sign(s.key, SignedPayload(cp))
+	return cp
+}
+
+// Verify reports whether the checkpoint was signed by the private key for
+// publicKey
+func Verify(publicKey ed25519.PublicKey, cp db.ChainCheckpoint) bool {
+	return cp.KeyID == KeyID(publicKey) &&
+		ed25519.Verify(publicKey, SignedPayload(cp), cp.Signature)
+}
+
+// KeyID identifies a public key by the start of its SHA-256 hash
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePublicKey reads a base64 encoded Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, not %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SignedPayload is the text that is signed for a checkpoint. Anyone with the
+// public key can rebuild it from a checkpoint to check the signature.
+// Checkpoints with an erasure head sign it too, in a v2 payload, so it cannot
+// be removed from them without invalidating the signature.
+func SignedPayload(cp db.ChainCheckpoint) []byte {
+	if cp.ErasureSeq != 0 {
+		return []byte(fmt.Sprintf(
+			"paas-auditor-chain-checkpoint:v2\n%d\n%s\n%d\n%s\n%s\n",
+			cp.HeadID,
+			hex.EncodeToString(cp.ChainHash),
+			cp.ErasureSeq,
+			hex.EncodeToString(cp.ErasureChainHash),
+			cp.SignedAt.UTC().Format(time.RFC3339Nano),
+		))
+	}
+	return []byte(fmt.Sprintf(
+		"paas-auditor-chain-checkpoint:v1\n%d\n%s\n%s\n",
+		cp.HeadID,
+		hex.EncodeToString(cp.ChainHash),
+		cp.SignedAt.UTC().Format(time.RFC3339Nano),
+	))
+}
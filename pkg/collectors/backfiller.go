@@ -0,0 +1,294 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+// BackfillPolicy controls how the events a foundation had before its
+// collector started are collected
+type BackfillPolicy struct {
+	// Period is how far back before the collector started the job is split
+	// into windows. Events older than that are collected in one window.
+	Period time.Duration
+
+	// Window is the length of time covered by each window
+	Window time.Duration
+
+	// Concurrency is the number of windows collected at a time
+	Concurrency int
+
+	// PageInterval is the least time between requests for pages, across all
+	// windows
+	PageInterval time.Duration
+}
+
+var DefaultBackfillPolicy = BackfillPolicy{
+	Period:       31 * 24 * time.Hour,
+	Window:       24 * time.Hour,
+	Concurrency:  4,
+	PageInterval: 100 * time.Millisecond,
+}
+
+func (p BackfillPolicy) Validate() error {
+	if p.Period < 0 {
+		return fmt.Errorf("period must not be negative")
+	}
+	if p.Window < time.Second {
+		return fmt.Errorf("window must be at least a second")
+	}
+	if p.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if p.PageInterval <= 0 {
+		return fmt.Errorf("page interval must be positive")
+	}
+	return nil
+}
+
+// backfillEpoch is the start of the oldest window of every backfill job, so
+// that it includes every event older than the policy's period. It is the same
+// time the collector starts from when there are no events.
+var backfillEpoch = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// PlanBackfill returns a job to collect a foundation's events created before
+// end. The policy's period is split into windows of the policy's length, most
+// recent first, followed by a window of every event older than the period.
+func PlanBackfill(foundation string, end time.Time, policy BackfillPolicy) (db.BackfillJob, []db.BackfillWindow) {
+	end = end.UTC().Truncate(time.Second)
+	periodStart := end.Add(-policy.Period)
+	if periodStart.Before(backfillEpoch) {
+		periodStart = backfillEpoch
+	}
+
+	windows := []db.BackfillWindow{}
+	windowEnd := end
+	for windowEnd.After(periodStart) {
+		windowStart := windowEnd.Add(-policy.Window)
+		if windowStart.Before(periodStart) {
+			windowStart = periodStart
+		}
+		windows = append(windows, db.BackfillWindow{Foundation: foundation, Start: windowStart, End: windowEnd})
+		windowEnd = windowStart
+	}
+	if windowEnd.After(backfillEpoch) {
+		windows = append(windows, db.BackfillWindow{Foundation: foundation, Start: backfillEpoch, End: windowEnd})
+	}
+
+	job := db.BackfillJob{
+		Foundation: foundation,
+		Start:      backfillEpoch,
+		End:        end,
+	}
+	return job, windows
+}
+
+// Backfiller works through a foundation's backfill job, collecting the events
+// created in each window which is not yet complete. Windows are collected in
+// parallel, most recent first. Progress through each window is checkpointed
+// after every page is stored, so that after a restart each window carries on
+// from the page it had got to. A window which fails is tried again on the next
+// run. Backfilled events are shipped, but are not evaluated against the alert
+// rules.
+type Backfiller struct {
+	foundation string
+	schedule   time.Duration
+	policy     BackfillPolicy
+	logger     lager.Logger
+	pager      fetchers.CFAuditEventPager
+	enricher   *enrichers.Enricher
+	eventDB    db.EventDB
+
+	// The enricher is not safe for concurrent use, so windows take turns
+	enricherMu sync.Mutex
+}
+
+func NewBackfiller(
+	foundation string,
+	schedule time.Duration,
+	policy BackfillPolicy,
+	logger lager.Logger,
+	pager fetchers.CFAuditEventPager,
+	enricher *enrichers.Enricher,
+	eventDB db.EventDB,
+) *Backfiller {
+	logger = logger.Session("cf-audit-event-backfiller", lager.Data{
+		"foundation":    foundation,
+		"concurrency":   policy.Concurrency,
+		"page_interval": policy.PageInterval.String(),
+	})
+	return &Backfiller{
+		foundation: foundation,
+		schedule:   schedule,
+		policy:     policy,
+		logger:     logger,
+		pager:      pager,
+		enricher:   enricher,
+		eventDB:    eventDB,
+	}
+}
+
+func (b *Backfiller) Run(ctx context.Context) error {
+	lsession := b.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		if err := b.backfill(ctx, lsession); errors.Is(err, db.ErrLeaseLost) {
+			// The elector goes back to acquiring the lease
+			lsession.Info("lost-leader-lease")
+			return err
+		} else if err != nil {
+			lsession.Error("err-backfill", err)
+			CFAuditEventBackfillerErrorsTotal.WithLabelValues(b.foundation).Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(b.schedule):
+		}
+	}
+}
+
+// backfill collects every window of the foundation's backfill job which is
+// not complete
+func (b *Backfiller) backfill(ctx context.Context, lsession lager.Logger) error {
+	job, err := b.eventDB.GetBackfillJob(b.foundation)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return nil
+	}
+	windows, err := b.eventDB.GetBackfillWindows(b.foundation)
+	if err != nil {
+		return err
+	}
+
+	pending := []db.BackfillWindow{}
+	for _, window := range windows {
+		if window.CompletedAt == nil {
+			pending = append(pending, window)
+		}
+	}
+	CFAuditEventBackfillerWindows.WithLabelValues(b.foundation, "pending").Set(float64(len(pending)))
+	CFAuditEventBackfillerWindows.WithLabelValues(b.foundation, "completed").Set(float64(len(windows) - len(pending)))
+	if len(pending) == 0 {
+		return nil
+	}
+
+	lsession.Info("backfilling", lager.Data{
+		"job_start":       job.Start,
+		"job_end":         job.End,
+		"windows":         len(windows),
+		"pending_windows": len(pending),
+	})
+
+	// Every window waits for the same ticker before each request, which
+	// bounds the rate of requests however many windows there are
+	limiter := time.NewTicker(b.policy.PageInterval)
+	defer limiter.Stop()
+
+	var failed int64
+	work := make(chan db.BackfillWindow)
+	var wg sync.WaitGroup
+	for i := 0; i < b.policy.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for window := range work {
+				err := b.backfillWindow(ctx, lsession, limiter.C, window)
+				if err != nil && ctx.Err() == nil {
+					lsession.Error("err-backfill-window", err, lager.Data{
+						"window_start": window.Start,
+						"window_end":   window.End,
+					})
+					CFAuditEventBackfillerErrorsTotal.WithLabelValues(b.foundation).Inc()
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+	// Once the context is done, each window returns straight away
+	for _, window := range pending {
+		work <- window
+	}
+	close(work)
+	wg.Wait()
+
+	if ctx.Err() == nil && failed == 0 {
+		lsession.Info("backfilled", lager.Data{"windows": len(windows)})
+	}
+	return nil
+}
+
+// backfillWindow stores the remaining pages of a window, checkpointing the
+// window after each one
+func (b *Backfiller) backfillWindow(ctx context.Context, lsession lager.Logger, limiter <-chan time.Time, window db.BackfillWindow) error {
+	pageURL := window.NextPageURL
+	if pageURL == "" {
+		pageURL = b.pager.FirstPageURL(window.Start, window.End)
+	}
+
+	for {
+		select {
+		case <-limiter:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		nextPageURL, events, err := b.pager.FetchPage(pageURL)
+		if err != nil {
+			return err
+		}
+
+		var names map[string]db.EventNames
+		if b.enricher != nil {
+			b.enricherMu.Lock()
+			names = b.enricher.Enrich(ctx, events)
+			b.enricherMu.Unlock()
+		}
+
+		stored, err := b.eventDB.BackfillCFAuditEvents(b.foundation, events, names)
+		if err != nil {
+			return err
+		}
+
+		window.NextPageURL = nextPageURL
+		window.PagesFetched++
+		window.EventsStored += int64(stored)
+		if nextPageURL == "" {
+			completedAt := time.Now()
+			window.CompletedAt = &completedAt
+		}
+		if err := b.eventDB.UpdateBackfillWindow(window); err != nil {
+			return err
+		}
+		CFAuditEventBackfillerPagesFetchedTotal.WithLabelValues(b.foundation).Inc()
+		CFAuditEventBackfillerEventsStoredTotal.WithLabelValues(b.foundation).Add(float64(stored))
+
+		if window.CompletedAt != nil {
+			lsession.Info("backfilled-window", lager.Data{
+				"window_start":  window.Start,
+				"window_end":    window.End,
+				"pages_fetched": window.PagesFetched,
+				"events_stored": window.EventsStored,
+			})
+			CFAuditEventBackfillerWindows.WithLabelValues(b.foundation, "pending").Dec()
+			CFAuditEventBackfillerWindows.WithLabelValues(b.foundation, "completed").Inc()
+			return nil
+		}
+		pageURL = nextPageURL
+	}
+}
@@ -0,0 +1,274 @@
+package collectors_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	fetcherfakes "github.com/alphagov/paas-auditor/pkg/fetchers/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("PlanBackfill", func() {
+	policy := collectors.BackfillPolicy{
+		Period:       3 * 24 * time.Hour,
+		Window:       24 * time.Hour,
+		Concurrency:  1,
+		PageInterval: time.Millisecond,
+	}
+	end := time.Date(2020, 1, 10, 12, 30, 15, 500, time.UTC)
+	epoch := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	It("splits the period into windows, most recent first, followed by a window going back to 1970", func() {
+		job, windows := collectors.PlanBackfill("some-foundation", end, policy)
+
+		Expect(job).To(Equal(db.BackfillJob{
+			Foundation: "some-foundation",
+			Start:      epoch,
+			End:        end.Truncate(time.Second),
+		}))
+		Expect(windows).To(Equal([]db.BackfillWindow{
+			{Foundation: "some-foundation", Start: end.Truncate(time.Second).Add(-24 * time.Hour), End: end.Truncate(time.Second)},
+			{Foundation: "some-foundation", Start: end.Truncate(time.Second).Add(-48 * time.Hour), End: end.Truncate(time.Second).Add(-24 * time.Hour)},
+			{Foundation: "some-foundation", Start: end.Truncate(time.Second).Add(-72 * time.Hour), End: end.Truncate(time.Second).Add(-48 * time.Hour)},
+			{Foundation: "some-foundation", Start: epoch, End: end.Truncate(time.Second).Add(-72 * time.Hour)},
+		}))
+	})
+
+	It("has a single window without a period", func() {
+		policy := policy
+		policy.Period = 0
+		_, windows := collectors.PlanBackfill("", end, policy)
+		Expect(windows).To(HaveLen(1))
+		Expect(windows[0].Start).To(Equal(epoch))
+	})
+
+	It("rejects invalid policies", func() {
+		Expect(policy.Validate()).To(Succeed())
+		Expect(collectors.DefaultBackfillPolicy.Validate()).To(Succeed())
+
+		invalid := policy
+		invalid.Window = 0
+		Expect(invalid.Validate()).To(MatchError(ContainSubstring("window")))
+
+		invalid = policy
+		invalid.Concurrency = 0
+		Expect(invalid.Validate()).To(MatchError(ContainSubstring("concurrency")))
+
+		invalid = policy
+		invalid.PageInterval = 0
+		Expect(invalid.Validate()).To(MatchError(ContainSubstring("page interval")))
+	})
+})
+
+var _ = Describe("Backfiller Run", func() {
+	var (
+		logger  lager.Logger
+		eventDB *dbfakes.FakeEventDB
+		pager   *fetcherfakes.FakeCFAuditEventPager
+
+		// windows are the checkpoints stored by the fake database
+		windows   map[time.Time]db.BackfillWindow
+		windowsMu sync.Mutex
+
+		foundation = "backfill-foundation"
+		jobEnd     = time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)
+		policy     = collectors.BackfillPolicy{
+			Period:       24 * time.Hour,
+			Window:       12 * time.Hour,
+			Concurrency:  2,
+			PageInterval: time.Millisecond,
+		}
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("backfiller-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		job, planned := collectors.PlanBackfill(foundation, jobEnd, policy)
+		windows = map[time.Time]db.BackfillWindow{}
+		for _, window := range planned {
+			windows[window.Start] = window
+		}
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetBackfillJobReturns(&job, nil)
+		eventDB.GetBackfillWindowsStub = func(string) ([]db.BackfillWindow, error) {
+			windowsMu.Lock()
+			defer windowsMu.Unlock()
+			stored := []db.BackfillWindow{}
+			for _, window := range planned {
+				stored = append(stored, windows[window.Start])
+			}
+			return stored, nil
+		}
+		eventDB.UpdateBackfillWindowStub = func(window db.BackfillWindow) error {
+			windowsMu.Lock()
+			defer windowsMu.Unlock()
+			windows[window.Start] = window
+			return nil
+		}
+		eventDB.BackfillCFAuditEventsStub = func(_ string, events []cfclient.Event, _ map[string]db.EventNames) (int, error) {
+			return len(events), nil
+		}
+
+		// Each window has two pages of one event each
+		pager = &fetcherfakes.FakeCFAuditEventPager{}
+		pager.FirstPageURLStub = func(start time.Time, _ time.Time) string {
+			return "/page-1?start=" + start.Format(time.RFC3339)
+		}
+		pager.FetchPageStub = func(pageURL string) (string, []cfclient.Event, error) {
+			var start string
+			if _, err := fmt.Sscanf(pageURL, "/page-1?start=%s", &start); err == nil {
+				return "/page-2?start=" + start, []cfclient.Event{{GUID: pageURL}}, nil
+			}
+			return "", []cfclient.Event{{GUID: pageURL}}, nil
+		}
+	})
+
+	run := func(backfiller *collectors.Backfiller) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- backfiller.Run(ctx) }()
+
+		Eventually(func() int {
+			windowsMu.Lock()
+			defer windowsMu.Unlock()
+			pending := 0
+			for _, window := range windows {
+				if window.CompletedAt == nil {
+					pending++
+				}
+			}
+			return pending
+		}).Should(Equal(0))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	}
+
+	It("collects every window, checkpointing after each page", func() {
+		pagesFetched := h.CurrentMetricValue(collectors.CFAuditEventBackfillerPagesFetchedTotal.WithLabelValues(foundation))
+		eventsStored := h.CurrentMetricValue(collectors.CFAuditEventBackfillerEventsStoredTotal.WithLabelValues(foundation))
+
+		run(collectors.NewBackfiller(foundation, time.Hour, policy, logger, pager, nil, eventDB))
+
+		Expect(pager.FetchPageCallCount()).To(Equal(6))
+		Expect(eventDB.BackfillCFAuditEventsCallCount()).To(Equal(6))
+		storedFoundation, _, _ := eventDB.BackfillCFAuditEventsArgsForCall(0)
+		Expect(storedFoundation).To(Equal(foundation))
+
+		Expect(eventDB.UpdateBackfillWindowCallCount()).To(Equal(6))
+		for _, window := range windows {
+			Expect(window.PagesFetched).To(Equal(int64(2)))
+			Expect(window.EventsStored).To(Equal(int64(2)))
+			Expect(window.NextPageURL).To(BeEmpty())
+		}
+
+		By("checkpointing the URL of the next page")
+		checkpoints := []string{}
+		for i := 0; i < eventDB.UpdateBackfillWindowCallCount(); i++ {
+			window := eventDB.UpdateBackfillWindowArgsForCall(i)
+			if window.CompletedAt == nil {
+				checkpoints = append(checkpoints, window.NextPageURL)
+			}
+		}
+		Expect(checkpoints).To(ConsistOf(
+			"/page-2?start=2020-01-03T12:00:00Z",
+			"/page-2?start=2020-01-03T00:00:00Z",
+			"/page-2?start=1970-01-01T00:00:00Z",
+		))
+
+		By("checking the metrics")
+		Expect(collectors.CFAuditEventBackfillerPagesFetchedTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(pagesFetched, "==", 6),
+		)
+		Expect(collectors.CFAuditEventBackfillerEventsStoredTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(eventsStored, "==", 6),
+		)
+		Expect(h.CurrentMetricValue(collectors.CFAuditEventBackfillerWindows.WithLabelValues(foundation, "pending"))).To(Equal(0.0))
+		Expect(h.CurrentMetricValue(collectors.CFAuditEventBackfillerWindows.WithLabelValues(foundation, "completed"))).To(Equal(3.0))
+	})
+
+	It("carries on from each window's checkpoint", func() {
+		for start, window := range windows {
+			if start.Equal(jobEnd.Add(-12 * time.Hour)) {
+				completedAt := time.Now()
+				window.PagesFetched = 2
+				window.CompletedAt = &completedAt
+			} else {
+				window.NextPageURL = "/page-2?start=" + start.Format(time.RFC3339)
+				window.PagesFetched = 1
+			}
+			windows[start] = window
+		}
+
+		run(collectors.NewBackfiller(foundation, time.Hour, policy, logger, pager, nil, eventDB))
+
+		Expect(pager.FirstPageURLCallCount()).To(Equal(0))
+		Expect(pager.FetchPageCallCount()).To(Equal(2))
+		for _, window := range windows {
+			Expect(window.PagesFetched).To(Equal(int64(2)))
+		}
+	})
+
+	It("tries a window which failed again on the next run, from its checkpoint", func() {
+		var failOnce sync.Once
+		fetchPage := pager.FetchPageStub
+		pager.FetchPageStub = func(pageURL string) (string, []cfclient.Event, error) {
+			failed := false
+			if pageURL == "/page-2?start=1970-01-01T00:00:00Z" {
+				failOnce.Do(func() { failed = true })
+			}
+			if failed {
+				return "", nil, errors.New("some-error")
+			}
+			return fetchPage(pageURL)
+		}
+		backfillerErrors := h.CurrentMetricValue(collectors.CFAuditEventBackfillerErrorsTotal.WithLabelValues(foundation))
+
+		run(collectors.NewBackfiller(foundation, 10*time.Millisecond, policy, logger, pager, nil, eventDB))
+
+		Expect(pager.FetchPageCallCount()).To(Equal(7))
+		Expect(pager.FirstPageURLCallCount()).To(Equal(3))
+		Expect(collectors.CFAuditEventBackfillerErrorsTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(backfillerErrors, "==", 1),
+		)
+	})
+
+	It("spaces out requests for pages across all windows", func() {
+		policy := policy
+		policy.Concurrency = 3
+		policy.PageInterval = 20 * time.Millisecond
+
+		startTime := time.Now()
+		run(collectors.NewBackfiller(foundation, time.Hour, policy, logger, pager, nil, eventDB))
+
+		Expect(pager.FetchPageCallCount()).To(Equal(6))
+		Expect(time.Since(startTime)).To(BeNumerically(">=", 6*policy.PageInterval))
+	})
+
+	It("does nothing without a backfill job", func() {
+		eventDB.GetBackfillJobReturns(nil, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		Expect(collectors.NewBackfiller(foundation, time.Millisecond, policy, logger, pager, nil, eventDB).Run(ctx)).To(Succeed())
+
+		Expect(eventDB.GetBackfillJobCallCount()).To(BeNumerically(">=", 1))
+		Expect(eventDB.GetBackfillJobArgsForCall(0)).To(Equal(foundation))
+		Expect(eventDB.GetBackfillWindowsCallCount()).To(Equal(0))
+		Expect(pager.FetchPageCallCount()).To(Equal(0))
+	})
+})
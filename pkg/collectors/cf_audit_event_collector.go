@@ -2,29 +2,47 @@ package collectors
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 )
 
+// CFAuditEventCollector collects events from one foundation, and stores them
+// labelled with the foundation's name, along with the names resolved for them
+// by the enricher if there is one.
+//
+// With a backfill policy, a foundation without any events gets a backfill
+// job for the events it already has, which are left to the Backfiller. The
+// collector only collects events from the end of the job onwards.
 type CFAuditEventCollector struct {
-	schedule        time.Duration
-	logger          lager.Logger
-	fetcher         fetchers.CFAuditEventFetcher
-	eventDB         db.EventDB
-	eventsCollected int
+	foundation          string
+	schedule            time.Duration
+	retryPolicy         RetryPolicy
+	backfillPolicy      *BackfillPolicy
+	logger              lager.Logger
+	fetcher             fetchers.CFAuditEventFetcher
+	enricher            *enrichers.Enricher
+	eventDB             db.EventDB
+	eventsCollected     int
+	consecutiveFailures int
 }
 
 func NewCFAuditEventCollector(
+	foundation string,
 	schedule time.Duration,
+	retryPolicy RetryPolicy,
+	backfillPolicy *BackfillPolicy,
 	logger lager.Logger,
 	fetcher fetchers.CFAuditEventFetcher,
+	enricher *enrichers.Enricher,
 	eventDB db.EventDB,
 ) *CFAuditEventCollector {
-	logger = logger.Session("cf-audit-event-collector")
-	return &CFAuditEventCollector{schedule, logger, fetcher, eventDB, 0}
+	logger = logger.Session("cf-audit-event-collector", lager.Data{"foundation": foundation})
+	return &CFAuditEventCollector{foundation, schedule, retryPolicy, backfillPolicy, logger, fetcher, enricher, eventDB, 0, 0}
 }
 
 func (c *CFAuditEventCollector) Run(ctx context.Context) error {
@@ -32,73 +50,176 @@ func (c *CFAuditEventCollector) Run(ctx context.Context) error {
 	lsession.Info("start")
 	defer lsession.Info("end")
 
-	for {
-		pullEventsSince, err := c.pullEventsSince(5 * time.Second)
-		if err != nil {
-			lsession.Error("err-pull-events-since", err)
-			CFAuditEventCollectorErrorsTotal.Inc()
-			return err
-		}
+	wait := c.schedule
 
+	for {
 		select {
 		case <-ctx.Done():
 			lsession.Info("done")
 			return nil
-		case <-time.After(c.schedule):
-			startTime := time.Now()
-
-			resultsChan := make(chan fetchers.CFAuditEventResult, 3)
-			go c.fetcher(pullEventsSince, resultsChan)
-
-			for result := range resultsChan {
-				if result.Err != nil {
-					lsession.Error("err-recv-events", err)
-					CFAuditEventCollectorErrorsTotal.Inc()
-					return result.Err
-				}
-
-				err := c.eventDB.StoreCFAuditEvents(result.Events)
-				if err != nil {
-					lsession.Error("err-store-cf-audit-events", err)
-					CFAuditEventCollectorErrorsTotal.Inc()
-					return err
-				}
-
-				c.eventsCollected += len(result.Events)
-				CFAuditEventCollectorEventsCollectedTotal.Add(float64(len(result.Events)))
-
-				lsession.Info(
-					"stored-events",
-					lager.Data{
-						"duration":         time.Since(startTime),
-						"events-collected": c.eventsCollected,
-					},
-				)
-			}
-
-			duration := time.Since(startTime)
-			lsession.Info(
-				"stored-all-events",
-				lager.Data{
-					"duration":         duration,
-					"events-collected": c.eventsCollected,
-				},
-			)
-			CFAuditEventCollectorEventsCollectDurationTotal.Add(duration.Seconds())
+		case <-time.After(wait):
 		}
+
+		err := c.collect(ctx, lsession)
+		if ctx.Err() != nil {
+			lsession.Info("done")
+			return nil
+		}
+
+		if err == nil {
+			c.consecutiveFailures = 0
+			CFAuditEventCollectorConsecutiveFailures.WithLabelValues(c.foundation).Set(0)
+			CFAuditEventCollectorLastSuccessTimestamp.WithLabelValues(c.foundation).Set(float64(time.Now().Unix()))
+			wait = c.schedule
+			continue
+		}
+
+		if errors.Is(err, db.ErrLeaseLost) {
+			// The elector goes back to acquiring the lease
+			lsession.Info("lost-leader-lease")
+			return err
+		}
+
+		c.consecutiveFailures++
+		CFAuditEventCollectorConsecutiveFailures.WithLabelValues(c.foundation).Set(float64(c.consecutiveFailures))
+
+		if !isRetryable(err) {
+			lsession.Error("err-fatal", err)
+			return err
+		}
+
+		if c.consecutiveFailures > c.retryPolicy.ErrorBudget {
+			lsession.Error("err-error-budget-exhausted", err, lager.Data{
+				"consecutive-failures": c.consecutiveFailures,
+			})
+			return err
+		}
+
+		wait = c.retryPolicy.backoff(c.consecutiveFailures)
+		CFAuditEventCollectorRetriesTotal.WithLabelValues(c.foundation).Inc()
+		lsession.Info("retrying", lager.Data{
+			"consecutive-failures": c.consecutiveFailures,
+			"backoff":              wait,
+		})
 	}
 }
 
+// collect fetches and stores every event since the latest one in the
+// database. Each page is stored as it arrives, so pages stored before an
+// error are kept and will not be fetched again.
+func (c *CFAuditEventCollector) collect(ctx context.Context, lsession lager.Logger) error {
+	pullEventsSince, err := c.pullEventsSince(5 * time.Second)
+	if err != nil {
+		lsession.Error("err-pull-events-since", err)
+		CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+		return err
+	}
+
+	startTime := time.Now()
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+
+	resultsChan := make(chan fetchers.CFAuditEventResult, 3)
+	go c.fetcher(fetchCtx, pullEventsSince, resultsChan)
+
+	for result := range resultsChan {
+		if result.Err != nil {
+			lsession.Error("err-recv-events", result.Err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return result.Err
+		}
+
+		var names map[string]db.EventNames
+		if c.enricher != nil {
+			names = c.enricher.Enrich(ctx, result.Events)
+		}
+
+		// Pages overlap with events already stored, so only count new ones
+		stored, err := c.eventDB.StoreCFAuditEvents(c.foundation, result.Events, names)
+		if err != nil {
+			lsession.Error("err-store-cf-audit-events", err)
+			CFAuditEventCollectorErrorsTotal.WithLabelValues(c.foundation).Inc()
+			return err
+		}
+
+		c.eventsCollected += stored
+		CFAuditEventCollectorEventsCollectedTotal.WithLabelValues(c.foundation).Add(float64(stored))
+
+		lsession.Info(
+			"stored-events",
+			lager.Data{
+				"duration":         time.Since(startTime),
+				"events-collected": c.eventsCollected,
+			},
+		)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	duration := time.Since(startTime)
+	lsession.Info(
+		"stored-all-events",
+		lager.Data{
+			"duration":         duration,
+			"events-collected": c.eventsCollected,
+		},
+	)
+	CFAuditEventCollectorEventsCollectDurationTotal.WithLabelValues(c.foundation).Add(duration.Seconds())
+	return nil
+}
+
 func (c *CFAuditEventCollector) pullEventsSince(overlapBy time.Duration) (time.Time, error) {
-	latestCFEventTime, err := c.eventDB.GetLatestCFEventTime()
+	latestCFEventTime, err := c.eventDB.GetLatestCFEventTime(c.foundation)
 
 	if err != nil {
 		return latestCFEventTime, err
 	}
 
+	if c.backfillPolicy != nil {
+		backfillEnd, err := c.backfillEnd(latestCFEventTime)
+		if err != nil {
+			return latestCFEventTime, err
+		}
+		if backfillEnd.After(latestCFEventTime) {
+			latestCFEventTime = backfillEnd
+		}
+	}
+
 	startTime := latestCFEventTime.Add(-overlapBy)
 	if startTime.Year() < 1970 {
 		return latestCFEventTime, nil
 	}
 	return startTime, nil
 }
+
+// backfillEnd returns the end of the foundation's backfill job, before which
+// events are left to the backfiller. A foundation without any events gets a
+// job up to now. A foundation which already had events without a job carries
+// on from its latest event.
+func (c *CFAuditEventCollector) backfillEnd(latestCFEventTime time.Time) (time.Time, error) {
+	job, err := c.eventDB.GetBackfillJob(c.foundation)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if job != nil {
+		return job.End, nil
+	}
+	if latestCFEventTime.After(backfillEpoch) {
+		return time.Time{}, nil
+	}
+
+	planned, windows := PlanBackfill(c.foundation, time.Now(), *c.backfillPolicy)
+	stored, err := c.eventDB.CreateBackfillJob(planned, windows)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.logger.Info("planned-backfill", lager.Data{
+		"job_start": stored.Start,
+		"job_end":   stored.End,
+		"windows":   len(windows),
+	})
+	return stored.End, nil
+}
@@ -10,9 +10,13 @@ import (
 	. "github.com/onsi/gomega"
 
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/lib/pq"
 
 	"github.com/alphagov/paas-auditor/pkg/collectors"
+	"github.com/alphagov/paas-auditor/pkg/db"
 	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	enricherfakes "github.com/alphagov/paas-auditor/pkg/enrichers/fakes"
 	"github.com/alphagov/paas-auditor/pkg/fetchers"
 	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
 )
@@ -23,7 +27,16 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		logger  lager.Logger
 		eventDB *dbfakes.FakeEventDB
 
+		foundation = "some-foundation"
+
+		retryPolicy = collectors.RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+			ErrorBudget:    3,
+		}
+
 		cfAuditEventCollectorEventsCollectedTotal float64
+		cfAuditEventCollectorRetriesTotal         float64
 	)
 
 	BeforeEach(func() {
@@ -32,12 +45,16 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 
 		By("checking the value of the metrics to test against them later")
 		cfAuditEventCollectorEventsCollectedTotal = h.CurrentMetricValue(
-			collectors.CFAuditEventCollectorEventsCollectedTotal,
+			collectors.CFAuditEventCollectorEventsCollectedTotal.WithLabelValues(foundation),
+		)
+		cfAuditEventCollectorRetriesTotal = h.CurrentMetricValue(
+			collectors.CFAuditEventCollectorRetriesTotal.WithLabelValues(foundation),
 		)
 	})
 
 	It("appears to work", func() {
 		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(1, nil)
 
 		eventsToReceive := []fetchers.CFAuditEventResult{
 			fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}},
@@ -45,7 +62,7 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 			fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}},
 		}
 
-		fetcher := func(_ time.Time, c chan fetchers.CFAuditEventResult) {
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
 			for _, eventPage := range eventsToReceive {
 				c <- eventPage
 			}
@@ -54,9 +71,13 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		}
 
 		coll = collectors.NewCFAuditEventCollector(
+			foundation,
 			10*time.Millisecond,
+			retryPolicy,
+			nil,
 			logger,
 			fetcher,
+			nil,
 			eventDB,
 		)
 
@@ -83,9 +104,14 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		).Should(BeNumerically("==", 3))
 
 		Expect(eventDB.GetLatestCFEventTimeCallCount()).Should(BeNumerically(">=", 1))
+		Expect(eventDB.GetLatestCFEventTimeArgsForCall(0)).To(Equal(foundation))
+
+		By("storing the events from the foundation")
+		storedFoundation, _, _ := eventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(storedFoundation).To(Equal(foundation))
 
 		By("checking the metrics")
-		Expect(collectors.CFAuditEventCollectorEventsCollectedTotal).To(
+		Expect(collectors.CFAuditEventCollectorEventsCollectedTotal.WithLabelValues(foundation)).To(
 			h.MetricIncrementedBy(cfAuditEventCollectorEventsCollectedTotal, ">=", 3),
 		)
 
@@ -94,4 +120,270 @@ var _ = Describe("CFAuditEventCollector Run", func() {
 		collectWG.Wait()
 		Expect(collectError).NotTo(HaveOccurred())
 	})
+
+	It("only counts the events which were not already stored", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(0, nil)
+
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}, cfclient.Event{}}}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			foundation,
+			10*time.Millisecond,
+			retryPolicy,
+			nil,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+		go coll.Run(collectContext)
+
+		Eventually(eventDB.StoreCFAuditEventsCallCount, "100ms", "1ms").Should(
+			BeNumerically(">=", 2),
+		)
+		Expect(h.CurrentMetricValue(collectors.CFAuditEventCollectorEventsCollectedTotal.WithLabelValues(foundation))).To(
+			Equal(cfAuditEventCollectorEventsCollectedTotal),
+		)
+	})
+
+	It("retries retryable errors and keeps the events it already stored", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturnsOnCall(1, 0, &pq.Error{Code: "08006"})
+
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}}
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{cfclient.Event{}}}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			foundation,
+			10*time.Millisecond,
+			retryPolicy,
+			nil,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+		)
+
+		collectContext, cancelCollect := context.WithCancel(context.Background())
+		defer cancelCollect()
+
+		collectErrors := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			collectErrors <- coll.Run(collectContext)
+		}()
+
+		By("collecting again after the second page fails to store")
+		Eventually(eventDB.GetLatestCFEventTimeCallCount, "100ms", "1ms").Should(
+			BeNumerically(">=", 2),
+		)
+		Eventually(eventDB.StoreCFAuditEventsCallCount, "100ms", "1ms").Should(
+			BeNumerically(">=", 4),
+		)
+		Expect(collectErrors).NotTo(Receive())
+
+		By("checking the metrics")
+		Expect(collectors.CFAuditEventCollectorRetriesTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(cfAuditEventCollectorRetriesTotal, "==", 1),
+		)
+		Expect(h.CurrentMetricValue(collectors.CFAuditEventCollectorConsecutiveFailures.WithLabelValues(foundation))).To(
+			BeNumerically("==", 0),
+		)
+		Expect(h.CurrentMetricValue(collectors.CFAuditEventCollectorLastSuccessTimestamp.WithLabelValues(foundation))).To(
+			BeNumerically(">", 0),
+		)
+
+		cancelCollect()
+		Eventually(collectErrors).Should(Receive(BeNil()))
+	})
+
+	It("stores the names resolved by the enricher with the events", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.StoreCFAuditEventsReturns(1, nil)
+
+		resolver := &enricherfakes.FakeResolver{}
+		resolver.ResolveNameReturns("some-org", nil)
+		enricher := enrichers.NewEnricher(foundation, time.Hour, logger, resolver, eventDB)
+
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{Events: []cfclient.Event{
+				{GUID: "some-guid", OrganizationGUID: "some-org-guid"},
+			}}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			foundation,
+			time.Millisecond,
+			retryPolicy,
+			nil,
+			logger,
+			fetcher,
+			enricher,
+			eventDB,
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go coll.Run(ctx)
+
+		Eventually(eventDB.StoreCFAuditEventsCallCount).Should(BeNumerically(">=", 1))
+		_, _, names := eventDB.StoreCFAuditEventsArgsForCall(0)
+		Expect(names).To(Equal(map[string]db.EventNames{
+			"some-guid": {OrganizationName: "some-org"},
+		}))
+	})
+
+	Context("with a backfill policy", func() {
+		var (
+			backfillPolicy = collectors.BackfillPolicy{
+				Period:       3 * 24 * time.Hour,
+				Window:       24 * time.Hour,
+				Concurrency:  2,
+				PageInterval: time.Millisecond,
+			}
+		)
+
+		BeforeEach(func() {
+			eventDB = &dbfakes.FakeEventDB{}
+			var stored *db.BackfillJob
+			eventDB.CreateBackfillJobStub = func(job db.BackfillJob, _ []db.BackfillWindow) (db.BackfillJob, error) {
+				stored = &job
+				return job, nil
+			}
+			eventDB.GetBackfillJobStub = func(string) (*db.BackfillJob, error) {
+				return stored, nil
+			}
+		})
+
+		run := func() time.Time {
+			sinces := make(chan time.Time, 100)
+			fetcher := func(_ context.Context, since time.Time, c chan fetchers.CFAuditEventResult) {
+				defer close(c)
+				sinces <- since
+			}
+			coll = collectors.NewCFAuditEventCollector(
+				foundation,
+				time.Millisecond,
+				retryPolicy,
+				&backfillPolicy,
+				logger,
+				fetcher,
+				nil,
+				eventDB,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go coll.Run(ctx)
+
+			var since time.Time
+			Eventually(sinces).Should(Receive(&since))
+			return since
+		}
+
+		It("plans a backfill job for a foundation without events, and collects from its end", func() {
+			eventDB.GetLatestCFEventTimeReturns(time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC), nil)
+
+			since := run()
+
+			Expect(eventDB.CreateBackfillJobCallCount()).To(Equal(1))
+			job, windows := eventDB.CreateBackfillJobArgsForCall(0)
+			Expect(job.Foundation).To(Equal(foundation))
+			Expect(job.End).To(BeTemporally("~", time.Now(), time.Second))
+			Expect(windows).To(HaveLen(4))
+			Expect(since).To(Equal(job.End.Add(-5 * time.Second)))
+		})
+
+		It("carries on from the end of the foundation's backfill job", func() {
+			jobEnd := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			eventDB.GetLatestCFEventTimeReturns(jobEnd.Add(-time.Hour), nil)
+			eventDB.GetBackfillJobReturns(&db.BackfillJob{Foundation: foundation, End: jobEnd}, nil)
+
+			Expect(run()).To(Equal(jobEnd.Add(-5 * time.Second)))
+			Expect(eventDB.GetBackfillJobArgsForCall(0)).To(Equal(foundation))
+			Expect(eventDB.CreateBackfillJobCallCount()).To(Equal(0))
+		})
+
+		It("carries on from the latest event once it is after the end of the job", func() {
+			jobEnd := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			eventDB.GetLatestCFEventTimeReturns(jobEnd.Add(time.Hour), nil)
+			eventDB.GetBackfillJobReturns(&db.BackfillJob{Foundation: foundation, End: jobEnd}, nil)
+
+			Expect(run()).To(Equal(jobEnd.Add(time.Hour - 5*time.Second)))
+		})
+
+		It("does not plan a backfill job for a foundation which already has events", func() {
+			latest := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			eventDB.GetLatestCFEventTimeReturns(latest, nil)
+
+			Expect(run()).To(Equal(latest.Add(-5 * time.Second)))
+			Expect(eventDB.CreateBackfillJobCallCount()).To(Equal(0))
+		})
+	})
+
+	It("gives up immediately on a fatal error", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{
+				Err: cfclient.CloudFoundryHTTPError{StatusCode: 403, Status: "Forbidden"},
+			}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			foundation,
+			time.Millisecond,
+			retryPolicy,
+			nil,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+		)
+
+		err := coll.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("403")))
+		Expect(eventDB.StoreCFAuditEventsCallCount()).To(Equal(0))
+	})
+
+	It("gives up once the error budget is exhausted", func() {
+		eventDB = &dbfakes.FakeEventDB{}
+
+		fetcher := func(_ context.Context, _ time.Time, c chan fetchers.CFAuditEventResult) {
+			defer close(c)
+			c <- fetchers.CFAuditEventResult{
+				Err: cfclient.CloudFoundryHTTPError{StatusCode: 502, Status: "Bad Gateway"},
+			}
+		}
+
+		coll = collectors.NewCFAuditEventCollector(
+			foundation,
+			time.Millisecond,
+			retryPolicy,
+			nil,
+			logger,
+			fetcher,
+			nil,
+			eventDB,
+		)
+
+		err := coll.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("502")))
+		Expect(eventDB.GetLatestCFEventTimeCallCount()).To(Equal(retryPolicy.ErrorBudget + 1))
+		Expect(collectors.CFAuditEventCollectorRetriesTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(cfAuditEventCollectorRetriesTotal, "==", float64(retryPolicy.ErrorBudget)),
+		)
+	})
 })
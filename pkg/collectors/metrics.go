@@ -5,24 +5,66 @@ import (
 )
 
 var (
-	CFAuditEventCollectorErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_errors_total",
 		Help: "Number of errors encountered by CF Audit Event Collector",
-	})
+	}, []string{"foundation"})
 
-	CFAuditEventCollectorEventsCollectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorEventsCollectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_events_collected_total",
-		Help: "Number of events collected and saved to the DB by CF Audit Event Collector",
-	})
+		Help: "Number of new events collected and saved to the DB by CF Audit Event Collector, not counting events fetched again which were already stored",
+	}, []string{"foundation"})
 
-	CFAuditEventCollectorEventsCollectDurationTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	CFAuditEventCollectorEventsCollectDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cf_audit_event_collector_collect_duration_total",
 		Help: "Number of seconds spent collecting events by CF Audit Event Collector",
-	})
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_collector_retries_total",
+		Help: "Number of times CF Audit Event Collector has retried after a retryable error",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_event_collector_consecutive_failures",
+		Help: "Number of consecutive failed collections by CF Audit Event Collector",
+	}, []string{"foundation"})
+
+	CFAuditEventCollectorLastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_event_collector_last_success_timestamp",
+		Help: "Unix epoch seconds of the most recent successful collection by CF Audit Event Collector",
+	}, []string{"foundation"})
+
+	CFAuditEventBackfillerWindows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_event_backfiller_windows",
+		Help: "Number of windows of a foundation's backfill job, by whether they are pending or completed",
+	}, []string{"foundation", "status"})
+
+	CFAuditEventBackfillerPagesFetchedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_backfiller_pages_fetched_total",
+		Help: "Number of pages of events fetched and stored by the backfiller",
+	}, []string{"foundation"})
+
+	CFAuditEventBackfillerEventsStoredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_backfiller_events_stored_total",
+		Help: "Number of new events stored by the backfiller, not counting events which were already stored",
+	}, []string{"foundation"})
+
+	CFAuditEventBackfillerErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_event_backfiller_errors_total",
+		Help: "Number of errors encountered by the backfiller",
+	}, []string{"foundation"})
 )
 
 func initMetrics() {
 	prometheus.MustRegister(CFAuditEventCollectorErrorsTotal)
 	prometheus.MustRegister(CFAuditEventCollectorEventsCollectedTotal)
 	prometheus.MustRegister(CFAuditEventCollectorEventsCollectDurationTotal)
+	prometheus.MustRegister(CFAuditEventCollectorRetriesTotal)
+	prometheus.MustRegister(CFAuditEventCollectorConsecutiveFailures)
+	prometheus.MustRegister(CFAuditEventCollectorLastSuccessTimestamp)
+	prometheus.MustRegister(CFAuditEventBackfillerWindows)
+	prometheus.MustRegister(CFAuditEventBackfillerPagesFetchedTotal)
+	prometheus.MustRegister(CFAuditEventBackfillerEventsStoredTotal)
+	prometheus.MustRegister(CFAuditEventBackfillerErrorsTotal)
 }
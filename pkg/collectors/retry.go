@@ -0,0 +1,43 @@
+package collectors
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+)
+
+// RetryPolicy controls how the collector responds to retryable errors
+type RetryPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// ErrorBudget is the number of consecutive failed collections tolerated
+	// before the collector gives up
+	ErrorBudget int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+	ErrorBudget:    10,
+}
+
+// backoff returns how long to wait after the given number of consecutive
+// failures. It doubles with each failure up to MaxBackoff, and is jittered
+// across the upper half of that interval.
+func (p RetryPolicy) backoff(failures int) time.Duration {
+	backoff := p.MaxBackoff
+	if failures < 32 {
+		if b := p.InitialBackoff << uint(failures-1); b > 0 && b < p.MaxBackoff {
+			backoff = b
+		}
+	}
+	half := int64(backoff / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func isRetryable(err error) bool {
+	return fetchers.IsRetryable(err) || db.IsRetryable(err)
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	AlertDeliveriesTable = "alert_deliveries"
+
+	AlertDeliverySent         = "sent"
+	AlertDeliveryFailed       = "failed"
+	AlertDeliverySilenced     = "silenced"
+	AlertDeliveryDeduplicated = "deduplicated"
+
+	// undeliveredAlertsLimit bounds how many alerts a notifier reads per run
+	undeliveredAlertsLimit = 100
+)
+
+// AlertDelivery records what happened to an alert for a notification channel
+type AlertDelivery struct {
+	AlertID int64
+	Channel string
+	Status  string
+
+	// Attempts is the number of times sending the alert has been tried
+	Attempts  int
+	LastError string
+
+	// Failures is the number of runs in which sending the alert failed, and
+	// NextAttemptAt is when a failed alert is to be tried again
+	Failures      int
+	NextAttemptAt *time.Time
+
+	UpdatedAt time.Time
+
+	// DeliveredAt is when the alert was sent, if it has been
+	DeliveredAt *time.Time
+}
+
+// GetUndeliveredAlerts returns the alerts triggered at or after since which
+// have not been sent, silenced or deduplicated for the channel, in the order
+// they were triggered, along with the number of runs in which sending each
+// has failed. Alerts which failed are only returned once their next attempt
+// is due. If rules is not empty, only alerts for those rules are returned.
+func (s *EventStore) GetUndeliveredAlerts(channel string, rules []string, since time.Time) ([]Alert, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	if rules == nil {
+		rules = []string{}
+	}
+	rows, err := s.querier(ctx, nil).Query(`
+		select
+			a.id, a.rule, a.group_key, a.event_ids, a.event_guids,
+			a.first_event_at, a.last_event_at, a.triggered_at, coalesce(d.failures, 0)
+		from `+AlertsTable+` a
+		left join `+AlertDeliveriesTable+` d on d.alert_id = a.id and d.channel = $1
+		where a.triggered_at >= $2
+		and (cardinality($3::text[]) = 0 or a.rule = any($3))
+		and (
+			d.alert_id is null
+			or (d.status = '`+AlertDeliveryFailed+`' and coalesce(d.next_attempt_at, now()) <= now())
+		)
+		order by a.id asc
+		limit $4
+	`, channel, since, pq.Array(rules), undeliveredAlertsLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var (
+			alert      Alert
+			eventIDs   pq.Int64Array
+			eventGUIDs pq.StringArray
+		)
+		err := rows.Scan(
+			&alert.ID, &alert.Rule, &alert.GroupKey, &eventIDs, &eventGUIDs,
+			&alert.FirstEventAt, &alert.LastEventAt, &alert.TriggeredAt, &alert.DeliveryFailures,
+		)
+		if err != nil {
+			return nil, err
+		}
+		alert.EventIDs = []int64(eventIDs)
+		alert.EventGUIDs = []string(eventGUIDs)
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// GetLastAlertDeliveryTime returns when an alert for the rule and group key
+// was last sent to the channel, or the zero time if one has not been
+func (s *EventStore) GetLastAlertDeliveryTime(channel string, rule string, groupKey string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	var deliveredAt sql.NullTime
+	err := s.querier(ctx, nil).QueryRow(`
+		select max(d.delivered_at)
+		from `+AlertDeliveriesTable+` d
+		join `+AlertsTable+` a on a.id = d.alert_id
+		where d.channel = $1 and d.status = '`+AlertDeliverySent+`'
+		and a.rule = $2 and a.group_key = $3
+	`, channel, rule, groupKey).Scan(&deliveredAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return deliveredAt.Time, nil
+}
+
+// StoreAlertDelivery records what happened to an alert for a channel. The
+// attempts and failures are added to those of any earlier failed delivery.
+func (s *EventStore) StoreAlertDelivery(delivery AlertDelivery) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			insert into `+AlertDeliveriesTable+` (
+				alert_id, channel, status, attempts, last_error, failures, next_attempt_at, updated_at, delivered_at
+			) values (
+				$1, $2, $3, $4, $5, $6, $7, now(), $8
+			) on conflict (alert_id, channel) do
+			update set
+				status = excluded.status,
+				attempts = `+AlertDeliveriesTable+`.attempts + excluded.attempts,
+				last_error = excluded.last_error,
+				failures = `+AlertDeliveriesTable+`.failures + excluded.failures,
+				next_attempt_at = excluded.next_attempt_at,
+				updated_at = excluded.updated_at,
+				delivered_at = excluded.delivered_at
+		`,
+			delivery.AlertID, delivery.Channel, delivery.Status, delivery.Attempts, delivery.LastError,
+			delivery.Failures, delivery.NextAttemptAt, delivery.DeliveredAt,
+		)
+		return err
+	})
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	AlertsTable       = "alerts"
+	AlertCursorsTable = "alert_cursors"
+)
+
+// Alert records that an alert rule matched one or more stored events
+type Alert struct {
+	ID   int64
+	Rule string
+
+	// GroupKey is the value the rule's threshold counted events by, such as
+	// an actor GUID, or empty if it counted all matching events together
+	GroupKey string
+
+	EventIDs   []int64
+	EventGUIDs []string
+
+	// FirstEventAt and LastEventAt are the created_at of the earliest and
+	// latest of the events
+	FirstEventAt time.Time
+	LastEventAt  time.Time
+
+	TriggeredAt time.Time
+
+	// DeliveryFailures is the number of runs in which sending the alert to a
+	// channel has failed. It is only set by GetUndeliveredAlerts.
+	DeliveryFailures int
+}
+
+// StreamUnevaluatedCFAuditEvents calls fn with each event stored after the
+// last one evaluated by the named alert engine, in the order they were stored.
+// The engine's cursor must have been started with InitAlertCursor. Only
+// collected events are evaluated, not restored or backfilled ones. It reads
+// at most unevaluatedEventsLimit events, and stops at the first error from fn.
+func (s *EventStore) StreamUnevaluatedCFAuditEvents(ctx context.Context, name string, fn func(CFAuditEvent) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := s.querier(ctx, tx).Query(`
+		select `+eventColumns+`
+		from `+CFAuditEventsTable+`
+		where
+			id > (select evaluated_seq from `+AlertCursorsTable+` where name = $1)
+			and origin = '`+OriginCollected+`'
+		order by id asc
+		limit $2
+	`, name, unevaluatedEventsLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := CFAuditEvent{}
+		if err := scanEvent(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// InitAlertCursor returns the id of the last event evaluated by the named
+// alert engine. If the engine has not evaluated any events, its cursor is
+// started at the latest stored event, so that turning on alerting does not
+// evaluate every event stored before then.
+func (s *EventStore) InitAlertCursor(name string) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	q := s.querier(ctx, nil)
+
+	_, err := q.Exec(`
+		insert into `+AlertCursorsTable+` (name, evaluated_seq, updated_at)
+		select $1, coalesce(max(id), 0), now() from `+CFAuditEventsTable+`
+		on conflict (name) do nothing
+	`, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var evaluatedSeq int64
+	err = q.QueryRow(`
+		select evaluated_seq from `+AlertCursorsTable+` where name = $1
+	`, name).Scan(&evaluatedSeq)
+	return evaluatedSeq, err
+}
+
+// StoreAlerts records alerts and the last event the named alert engine
+// evaluated in one transaction, so that alerts are recorded once even if the
+// engine stops part way through. It returns the alerts with their ids.
+func (s *EventStore) StoreAlerts(name string, alerts []Alert, lastEvaluated CFAuditEvent) ([]Alert, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+
+	stored := make([]Alert, len(alerts))
+	for i, alert := range alerts {
+		err := q.QueryRow(`
+			insert into `+AlertsTable+` (
+				rule, group_key, event_count, event_ids, event_guids, first_event_at, last_event_at
+			) values (
+				$1, $2, $3, $4, $5, $6, $7
+			)
+			returning id, triggered_at
+		`,
+			alert.Rule, alert.GroupKey, len(alert.EventIDs), pq.Array(alert.EventIDs), pq.Array(alert.EventGUIDs),
+			alert.FirstEventAt, alert.LastEventAt,
+		).Scan(&alert.ID, &alert.TriggeredAt)
+		if err != nil {
+			return nil, err
+		}
+		stored[i] = alert
+	}
+
+	_, err = q.Exec(`
+		insert into `+AlertCursorsTable+` (name, evaluated_seq, updated_at) values (
+			$1, $2, now()
+		) on conflict (name) do
+		update set
+			evaluated_seq = excluded.evaluated_seq,
+			updated_at = excluded.updated_at
+	`, name, lastEvaluated.ID)
+	if err != nil {
+		return nil, err
+	}
+	return stored, s.commit(q, tx)
+}
@@ -0,0 +1,274 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	CFAuditEventArchivesTable      = "cf_audit_event_archives"
+	CFAuditEventArchiveCursorTable = "cf_audit_event_archive_cursor"
+)
+
+// CFAuditEventArchive records the events created in a window of time which
+// have been uploaded to object storage. A window is archived again, as a new
+// revision, if events are stored in it after it was archived.
+type CFAuditEventArchive struct {
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Revision    int
+	ObjectKey   string
+	ManifestKey string
+	EventCount  int64
+	MinID       int64
+	MaxID       int64
+	SHA256      string
+	SizeBytes   int64
+	ArchivedAt  time.Time
+
+	RowsDeleted   int64
+	RowsDeletedAt *time.Time
+}
+
+// GetEarliestCFEventTime returns the created_at of the oldest stored event,
+// or the zero time if there are no events
+func (s *EventStore) GetEarliestCFEventTime() (time.Time, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	var createdAt time.Time
+	err := s.querier(ctx, nil).QueryRow(`
+		select created_at from ` + CFAuditEventsTable + `
+		order by created_at
+		limit 1
+	`).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return createdAt, err
+}
+
+// GetLatestCFAuditEventArchive returns the archive of the most recent window,
+// or nil if nothing has been archived
+func (s *EventStore) GetLatestCFAuditEventArchive() (*CFAuditEventArchive, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	archive, err := scanArchive(s.querier(ctx, nil).QueryRow(`
+		select ` + archiveColumns + `
+		from ` + CFAuditEventArchivesTable + `
+		order by window_end desc
+		limit 1
+	`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// GetCFAuditEventArchives returns the archive of every window, oldest first
+func (s *EventStore) GetCFAuditEventArchives() ([]CFAuditEventArchive, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select ` + archiveColumns + `
+		from ` + CFAuditEventArchivesTable + `
+		order by window_start
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanArchives(rows)
+}
+
+// GetCFAuditEventArchivesWithLateEvents returns the archives of the windows
+// in which events were stored after they were archived. It looks at up to
+// limit events after the last one checked, and returns the id of the last
+// event it looked at, which should be recorded with UpdateArchiveCursor once
+// the windows have been archived again. Restored events are not late, as they
+// came from archives.
+func (s *EventStore) GetCFAuditEventArchivesWithLateEvents(limit int64) ([]CFAuditEventArchive, int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	q := s.querier(ctx, nil)
+
+	// Events are only stored while holding the chain lock, so every event up
+	// to the latest one has been committed
+	var afterID, upToID int64
+	err := q.QueryRow(`
+		select
+			checked_seq,
+			greatest(checked_seq, least(
+				checked_seq + $1,
+				(select coalesce(max(id), 0) from `+CFAuditEventsTable+`)
+			))
+		from `+CFAuditEventArchiveCursorTable+`
+	`, limit).Scan(&afterID, &upToID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := q.Query(`
+		select `+archiveColumns+`
+		from `+CFAuditEventArchivesTable+`
+		where window_start in (
+			select a.window_start
+			from `+CFAuditEventsTable+` e
+			join `+CFAuditEventArchivesTable+` a
+			on e.created_at >= a.window_start and e.created_at < a.window_end
+			where e.id > $1 and e.id <= $2
+			and e.id > coalesce(a.max_id, 0)
+			and e.origin <> '`+OriginRestored+`'
+		)
+		order by window_start
+	`, afterID, upToID)
+	if err != nil {
+		return nil, 0, err
+	}
+	archives, err := scanArchives(rows)
+	return archives, upToID, err
+}
+
+// UpdateArchiveCursor records that events up to checkedSeq have been checked
+// for being stored in a window after it was archived
+func (s *EventStore) UpdateArchiveCursor(checkedSeq int64) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			update `+CFAuditEventArchiveCursorTable+`
+			set checked_seq = greatest(checked_seq, $1), updated_at = now()
+		`, checkedSeq)
+		return err
+	})
+}
+
+const archiveColumns = `
+	window_start, window_end, revision, object_key, manifest_key, event_count, min_id, max_id,
+	sha256, size_bytes, archived_at, rows_deleted, rows_deleted_at
+`
+
+func scanArchive(row interface{ Scan(...interface{}) error }) (CFAuditEventArchive, error) {
+	archive := CFAuditEventArchive{}
+	var minID, maxID, rowsDeleted sql.NullInt64
+	err := row.Scan(
+		&archive.WindowStart, &archive.WindowEnd, &archive.Revision, &archive.ObjectKey, &archive.ManifestKey,
+		&archive.EventCount, &minID, &maxID, &archive.SHA256, &archive.SizeBytes,
+		&archive.ArchivedAt, &rowsDeleted, &archive.RowsDeletedAt,
+	)
+	archive.MinID = minID.Int64
+	archive.MaxID = maxID.Int64
+	archive.RowsDeleted = rowsDeleted.Int64
+	return archive, err
+}
+
+func scanArchives(rows *sql.Rows) ([]CFAuditEventArchive, error) {
+	defer rows.Close()
+	archives := []CFAuditEventArchive{}
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, archive)
+	}
+	return archives, rows.Err()
+}
+
+// StoreCFAuditEventArchive records an archive. A later revision of the
+// archive of a window replaces the earlier one, which must have been stored.
+// Its rows have not been deleted yet.
+func (s *EventStore) StoreCFAuditEventArchive(archive CFAuditEventArchive) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	return s.write(ctx, func(q querier) error {
+		res, err := q.Exec(`
+			insert into `+CFAuditEventArchivesTable+` (
+				window_start, window_end, revision, object_key, manifest_key, event_count, min_id, max_id,
+				sha256, size_bytes, archived_at
+			) values (
+				$1, $2, $3, $4, $5, $6, nullif($7, 0), nullif($8, 0), $9, $10, $11
+			) on conflict (window_start) do
+			update set
+				revision = excluded.revision,
+				object_key = excluded.object_key,
+				manifest_key = excluded.manifest_key,
+				event_count = excluded.event_count,
+				min_id = excluded.min_id,
+				max_id = excluded.max_id,
+				sha256 = excluded.sha256,
+				size_bytes = excluded.size_bytes,
+				archived_at = excluded.archived_at,
+				rows_deleted = null,
+				rows_deleted_at = null
+			where `+CFAuditEventArchivesTable+`.revision = excluded.revision - 1
+		`,
+			archive.WindowStart, archive.WindowEnd, archive.Revision, archive.ObjectKey, archive.ManifestKey,
+			archive.EventCount, archive.MinID, archive.MaxID, archive.SHA256, archive.SizeBytes,
+			archive.ArchivedAt,
+		)
+		if err != nil {
+			return err
+		}
+		stored, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if stored == 0 {
+			return fmt.Errorf("revision %d of the archive of %s does not follow the stored revision", archive.Revision, archive.WindowStart.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
+
+// DeleteArchivedCFAuditEvents deletes the stored events covered by an
+// archive, and returns how many were deleted. Events stored in the window
+// after it was archived, and events restored from archives, are kept. As with
+// removing a partition, the gaps left in the hash chain are anchored, and the
+// head of the chain is kept.
+func (s *EventStore) DeleteArchivedCFAuditEvents(archive CFAuditEventArchive) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+	if err := lockChain(q); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	err = q.QueryRow(`
+		with removed as (
+			delete from `+CFAuditEventsTable+`
+			where created_at >= $1 and created_at < $2 and id <= $3
+			and origin <> '`+OriginRestored+`'
+			and id <> coalesce((select max(id) from `+CFAuditEventsTable+` where chain_hash is not null), 0)
+			returning id, chain_hash, $4::text as reason
+		), anchored as (`+anchorRemovedSQL+`)
+		select count(*) from removed
+	`, archive.WindowStart, archive.WindowEnd, archive.MaxID, "archived "+archive.ObjectKey).Scan(&deleted)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = q.Exec(`
+		update `+CFAuditEventArchivesTable+`
+		set rows_deleted = $2, rows_deleted_at = now()
+		where window_start = $1
+	`, archive.WindowStart, deleted)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, s.commit(q, tx)
+}
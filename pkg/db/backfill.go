@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	BackfillJobsTable    = "backfill_jobs"
+	BackfillWindowsTable = "backfill_windows"
+)
+
+// BackfillJob is the job to collect the events a foundation had before its
+// collector started, from Start up to End
+type BackfillJob struct {
+	Foundation  string
+	Start       time.Time
+	End         time.Time
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// BackfillWindow is the checkpoint of a backfill job's progress through the
+// events created at or after Start and before End. NextPageURL is the page to
+// fetch next, which is empty before the first page has been stored, and once
+// the window is complete.
+type BackfillWindow struct {
+	Foundation   string
+	Start        time.Time
+	End          time.Time
+	NextPageURL  string
+	PagesFetched int64
+	EventsStored int64
+	UpdatedAt    *time.Time
+	CompletedAt  *time.Time
+}
+
+// CreateBackfillJob stores a foundation's backfill job along with its
+// windows, and returns the foundation's job. A foundation only ever has one
+// job, so if it already has one, that is returned instead and nothing is
+// stored.
+func (s *EventStore) CreateBackfillJob(job BackfillJob, windows []BackfillWindow) (BackfillJob, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return job, err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+
+	res, err := q.Exec(`
+		insert into `+BackfillJobsTable+` (foundation, job_start, job_end) values (
+			$1, $2, $3
+		) on conflict (foundation) do nothing
+	`, job.Foundation, job.Start, job.End)
+	if err != nil {
+		return job, err
+	}
+	created, err := res.RowsAffected()
+	if err != nil {
+		return job, err
+	}
+
+	if created > 0 {
+		for _, window := range windows {
+			_, err := q.Exec(`
+				insert into `+BackfillWindowsTable+` (foundation, window_start, window_end) values (
+					$1, $2, $3
+				)
+			`, job.Foundation, window.Start, window.End)
+			if err != nil {
+				return job, err
+			}
+		}
+	}
+
+	stored, err := getBackfillJob(q, job.Foundation)
+	if err != nil {
+		return job, err
+	}
+	return *stored, s.commit(q, tx)
+}
+
+// GetBackfillJob returns a foundation's backfill job, or nil if it has none
+func (s *EventStore) GetBackfillJob(foundation string) (*BackfillJob, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+	job, err := getBackfillJob(s.querier(ctx, nil), foundation)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// GetBackfillJobs returns the backfill job of every foundation which has one
+func (s *EventStore) GetBackfillJobs() ([]BackfillJob, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select foundation, job_start, job_end, created_at, completed_at
+		from ` + BackfillJobsTable + `
+		order by foundation
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []BackfillJob{}
+	for rows.Next() {
+		job := BackfillJob{}
+		if err := rows.Scan(&job.Foundation, &job.Start, &job.End, &job.CreatedAt, &job.CompletedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func getBackfillJob(q querier, foundation string) (*BackfillJob, error) {
+	job := BackfillJob{}
+	err := q.QueryRow(`
+		select foundation, job_start, job_end, created_at, completed_at
+		from `+BackfillJobsTable+`
+		where foundation = $1
+	`, foundation).Scan(&job.Foundation, &job.Start, &job.End, &job.CreatedAt, &job.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetBackfillWindows returns the windows of a foundation's backfill job, most
+// recent first
+func (s *EventStore) GetBackfillWindows(foundation string) ([]BackfillWindow, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select
+			foundation, window_start, window_end, coalesce(next_page_url, ''),
+			pages_fetched, events_stored, updated_at, completed_at
+		from `+BackfillWindowsTable+`
+		where foundation = $1
+		order by window_start desc
+	`, foundation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []BackfillWindow{}
+	for rows.Next() {
+		window := BackfillWindow{}
+		err := rows.Scan(
+			&window.Foundation, &window.Start, &window.End, &window.NextPageURL,
+			&window.PagesFetched, &window.EventsStored, &window.UpdatedAt, &window.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+// UpdateBackfillWindow checkpoints the progress of a window. Once every
+// window of the job is complete, so is the job.
+func (s *EventStore) UpdateBackfillWindow(window BackfillWindow) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+
+	_, err = q.Exec(`
+		update `+BackfillWindowsTable+` set
+			next_page_url = nullif($3, ''),
+			pages_fetched = $4,
+			events_stored = $5,
+			updated_at = now(),
+			completed_at = $6
+		where foundation = $1 and window_start = $2
+	`,
+		window.Foundation, window.Start, window.NextPageURL,
+		window.PagesFetched, window.EventsStored, window.CompletedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if window.CompletedAt != nil {
+		_, err = q.Exec(`
+			update `+BackfillJobsTable+` set completed_at = now()
+			where foundation = $1 and completed_at is null
+			and not exists (
+				select 1 from `+BackfillWindowsTable+`
+				where foundation = $1 and completed_at is null
+			)
+		`, window.Foundation)
+		if err != nil {
+			return err
+		}
+	}
+	return s.commit(q, tx)
+}
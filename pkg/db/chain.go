@@ -0,0 +1,685 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// Each stored event is sealed with two hashes. Its content hash covers the
+// canonical form of its content, and its chain hash covers the previous
+// event's chain hash and its own content hash, in id order. Editing, adding
+// or removing an event in the middle of the table breaks the chain from that
+// event on. Removing events from the end does not, which is what signed
+// checkpoints of the chain head are for.
+//
+// Erased events can no longer be checked against the content hash they were
+// sealed with, so they are checked against the hashes recorded by their
+// erasure instead. Erasures are sealed into a chain of their own in the same
+// way, see erasures.go, and checkpoints sign the head of both chains.
+
+const (
+	ChainCheckpointsTable = "chain_checkpoints"
+
+	// chainLockID is the key of the transaction level advisory lock held
+	// while storing and sealing events, so that events are sealed in id order
+	chainLockID = 4620061914
+
+	chainSealBatchSize = 10000
+)
+
+// ChainHead is the last sealed event, and the last sealed erasure, if any
+// erasures have been sealed
+type ChainHead struct {
+	ID        int64
+	ChainHash []byte
+
+	ErasureSeq       int64
+	ErasureChainHash []byte
+}
+
+// ChainCheckpoint is a signed record of the chain head at a point in time.
+// Checkpoints signed before erasures were sealed, or while there were none,
+// have an ErasureSeq of zero.
+type ChainCheckpoint struct {
+	ID        int64
+	HeadID    int64
+	ChainHash []byte
+	SignedAt  time.Time
+	KeyID     string
+	Signature []byte
+
+	ErasureSeq       int64
+	ErasureChainHash []byte
+}
+
+// ChainBreak is the first event or erasure at which the chains do not verify
+type ChainBreak struct {
+	ID        int64  `json:"id,omitempty"`
+	GUID      string `json:"guid,omitempty"`
+	ErasureID int64  `json:"erasure_id,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+type ChainVerification struct {
+	EventsChecked   int64
+	ErasuresChecked int64
+
+	// ErasedEvents are events whose personal data has been erased, so their
+	// content was checked against the content hash recorded by their sealed
+	// erasure instead of the one they were sealed with
+	ErasedEvents int64
+
+	Head        ChainHead
+	Checkpoints []ChainCheckpoint
+	Break       *ChainBreak
+}
+
+// ContentHash returns the hash of the canonical form of an event's content,
+// the foundation it was collected from and the names resolved for it.
+// CreatedAt must be an RFC3339 timestamp, and is hashed in UTC. The
+// foundation is only hashed if it is not empty, and the names if any of them
+// are not empty, so events stored before there were foundations or names keep
+// their hashes.
+func ContentHash(foundation string, event cfclient.Event, names EventNames) ([]byte, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, event.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", event.GUID, err)
+	}
+	content := []interface{}{
+		event.GUID,
+		createdAt.UTC().Format(time.RFC3339Nano),
+		event.Type,
+		event.Actor,
+		event.ActorType,
+		event.ActorName,
+		event.ActorUsername,
+		event.Actee,
+		event.ActeeType,
+		event.ActeeName,
+		event.OrganizationGUID,
+		event.SpaceGUID,
+		event.Metadata, // maps are marshalled with sorted keys
+	}
+	if names != (EventNames{}) {
+		content = append(content, foundation, names)
+	} else if foundation != "" {
+		content = append(content, foundation)
+	}
+	canonical, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", event.GUID, err)
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+// ChainHash returns the chain hash of an event, given the chain hash of the
+// event before it. The first event has no previous chain hash.
+func ChainHash(previous []byte, contentHash []byte) []byte {
+	h := sha256.New()
+	h.Write(previous)
+	h.Write(contentHash)
+	return h.Sum(nil)
+}
+
+const chainRowColumns = `
+	id,
+	foundation,
+	guid,
+	created_at,
+	event_type,
+	actor,
+	actor_type,
+	actor_name,
+	actor_username,
+	actee,
+	actee_type,
+	actee_name,
+	coalesce(organization_guid::text, ''),
+	coalesce(space_guid::text, ''),
+	metadata,
+	coalesce(organization_name, ''),
+	coalesce(space_name, ''),
+	coalesce(app_name, ''),
+	coalesce(actor_email, ''),
+	content_hash,
+	chain_hash,
+	coalesce(erasure_id, 0)
+`
+
+type chainRow struct {
+	id          int64
+	foundation  string
+	event       cfclient.Event
+	names       EventNames
+	contentHash []byte
+	chainHash   []byte
+
+	// erasureID is the erasure which last replaced personal data in the
+	// event since it was sealed, or 0 if it has not been erased
+	erasureID int64
+}
+
+// scanChainRow reads chainRowColumns in the same form whenever the row is
+// read, so that its content hash does not depend on the session time zone or
+// on how JSON numbers are decoded
+func scanChainRow(rows *sql.Rows) (chainRow, error) {
+	row := chainRow{}
+	createdAt := time.Time{}
+	metadata := []byte{}
+	err := rows.Scan(
+		&row.id,
+		&row.foundation,
+		&row.event.GUID,
+		&createdAt,
+		&row.event.Type,
+		&row.event.Actor,
+		&row.event.ActorType,
+		&row.event.ActorName,
+		&row.event.ActorUsername,
+		&row.event.Actee,
+		&row.event.ActeeType,
+		&row.event.ActeeName,
+		&row.event.OrganizationGUID,
+		&row.event.SpaceGUID,
+		&metadata,
+		&row.names.OrganizationName,
+		&row.names.SpaceName,
+		&row.names.AppName,
+		&row.names.ActorEmail,
+		&row.contentHash,
+		&row.chainHash,
+		&row.erasureID,
+	)
+	if err != nil {
+		return row, err
+	}
+	row.event.CreatedAt = createdAt.UTC().Format(time.RFC3339Nano)
+	if len(metadata) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(metadata))
+		decoder.UseNumber()
+		if err := decoder.Decode(&row.event.Metadata); err != nil {
+			return row, err
+		}
+	}
+	return row, nil
+}
+
+func lockChain(q querier) error {
+	_, err := q.Exec(`select pg_advisory_xact_lock($1)`, chainLockID)
+	return err
+}
+
+// sealEvents seals up to chainSealBatchSize unsealed events in id order. The
+// caller must hold the chain lock.
+func sealEvents(q querier) (int, error) {
+	var previous []byte
+	err := q.QueryRow(`
+		select chain_hash from ` + CFAuditEventsTable + `
+		where chain_hash is not null
+		order by id desc
+		limit 1
+	`).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	rows, err := q.Query(`
+		select `+chainRowColumns+` from `+CFAuditEventsTable+`
+		where chain_hash is null
+		order by id
+		limit $1
+	`, chainSealBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	unsealed := []chainRow{}
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		unsealed = append(unsealed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update, err := q.stmt(`
+		update ` + CFAuditEventsTable + `
+		set content_hash = $1, chain_hash = $2
+		where id = $3
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range unsealed {
+		contentHash, err := ContentHash(row.foundation, row.event, row.names)
+		if err != nil {
+			return 0, err
+		}
+		chainHash := ChainHash(previous, contentHash)
+		if _, err := update.ExecContext(q.ctx, contentHash, chainHash, row.id); err != nil {
+			return 0, err
+		}
+		previous = chainHash
+	}
+	return len(unsealed), nil
+}
+
+// sealAllEvents seals events stored before the chain existed, a batch per
+// transaction
+func (s *EventStore) sealAllEvents(ctx context.Context) error {
+	total := 0
+	for {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		q := s.querier(ctx, tx)
+		if err := lockChain(q); err != nil {
+			tx.Rollback()
+			return err
+		}
+		sealed, err := sealEvents(q)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		total += sealed
+		if sealed > 0 {
+			s.logger.Info("sealed-events", lager.Data{"sealed": total})
+		}
+		if sealed < chainSealBatchSize {
+			return nil
+		}
+	}
+}
+
+// GetChainHead returns the last sealed event and erasure, or a zero
+// ChainHead if there are no events
+func (s *EventStore) GetChainHead() (ChainHead, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	q := s.querier(ctx, nil)
+	head := ChainHead{}
+	err := q.QueryRow(`
+		select id, chain_hash from `+CFAuditEventsTable+`
+		where chain_hash is not null
+		order by id desc
+		limit 1
+	`).Scan(&head.ID, &head.ChainHash)
+	if err == sql.ErrNoRows {
+		return ChainHead{}, nil
+	} else if err != nil {
+		return head, err
+	}
+	head.ErasureSeq, head.ErasureChainHash, err = erasureChainHead(q)
+	return head, err
+}
+
+func (s *EventStore) StoreChainCheckpoint(checkpoint ChainCheckpoint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			insert into `+ChainCheckpointsTable+` (
+				head_id, chain_hash, signed_at, key_id, signature, erasure_seq, erasure_chain_hash
+			) values (
+				$1, $2, $3, $4, $5, nullif($6::bigint, 0), $7
+			)
+		`,
+			checkpoint.HeadID, checkpoint.ChainHash, checkpoint.SignedAt, checkpoint.KeyID, checkpoint.Signature,
+			checkpoint.ErasureSeq, checkpoint.ErasureChainHash,
+		)
+		return err
+	})
+}
+
+// GetLatestChainCheckpoint returns the most recent checkpoint, or nil if
+// there are none
+func (s *EventStore) GetLatestChainCheckpoint() (*ChainCheckpoint, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select id, head_id, chain_hash, signed_at, key_id, signature, coalesce(erasure_seq, 0), erasure_chain_hash
+		from ` + ChainCheckpointsTable + `
+		order by id desc
+		limit 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := scanChainCheckpoints(rows)
+	if err != nil || len(checkpoints) == 0 {
+		return nil, err
+	}
+	return &checkpoints[0], nil
+}
+
+func scanChainCheckpoints(rows *sql.Rows) ([]ChainCheckpoint, error) {
+	defer rows.Close()
+	checkpoints := []ChainCheckpoint{}
+	for rows.Next() {
+		cp := ChainCheckpoint{}
+		err := rows.Scan(&cp.ID, &cp.HeadID, &cp.ChainHash, &cp.SignedAt, &cp.KeyID, &cp.Signature, &cp.ErasureSeq, &cp.ErasureChainHash)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// VerifyChain walks every sealed erasure and then every stored event, in the
+// order they were sealed, recomputing their hashes, and checks that the
+// checkpointed chain hashes match. It stops at the first break. It does not
+// check the signatures of the checkpoints.
+func (s *EventStore) VerifyChain() (ChainVerification, error) {
+	result := ChainVerification{}
+
+	tx, err := s.db.BeginTx(s.ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	q := s.querier(s.ctx, tx)
+
+	checkpointRows, err := q.Query(`
+		select id, head_id, chain_hash, signed_at, key_id, signature, coalesce(erasure_seq, 0), erasure_chain_hash
+		from ` + ChainCheckpointsTable + `
+		order by head_id, id
+	`)
+	if err != nil {
+		return result, err
+	}
+	checkpoints, err := scanChainCheckpoints(checkpointRows)
+	if err != nil {
+		return result, err
+	}
+
+	anchors, err := chainAnchors(q)
+	if err != nil {
+		return result, err
+	}
+
+	// Checkpoints of events removed by the retention policy or deleted after
+	// archiving cannot be checked
+	removed, err := removedIDRanges(q)
+	if err != nil {
+		return result, err
+	}
+	result.Checkpoints = []ChainCheckpoint{}
+	for _, cp := range checkpoints {
+		if !removed.contains(cp.HeadID) {
+			result.Checkpoints = append(result.Checkpoints, cp)
+		}
+	}
+
+	erasures, err := verifyErasures(q, result.Checkpoints, &result)
+	if err != nil || result.Break != nil {
+		return result, err
+	}
+
+	rows, err := q.Query(`select ` + chainRowColumns + ` from ` + CFAuditEventsTable + ` order by id`)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	var previous []byte
+	nextCheckpoint := 0
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			return result, err
+		}
+
+		// A checkpointed event that we have walked past has been deleted
+		if nextCheckpoint < len(result.Checkpoints) && result.Checkpoints[nextCheckpoint].HeadID < row.id {
+			result.Break = missingCheckpointedEvent(result.Checkpoints[nextCheckpoint])
+			return result, nil
+		}
+
+		if anchor, ok := anchors[row.id]; ok {
+			previous = anchor
+		}
+		result.Break = verifyChainRow(row, previous, erasures)
+		for result.Break == nil && nextCheckpoint < len(result.Checkpoints) && result.Checkpoints[nextCheckpoint].HeadID == row.id {
+			cp := result.Checkpoints[nextCheckpoint]
+			if !bytes.Equal(cp.ChainHash, row.chainHash) {
+				result.Break = &ChainBreak{ID: row.id, GUID: row.event.GUID, Reason: fmt.Sprintf("chain hash does not match checkpoint %d", cp.ID)}
+			}
+			nextCheckpoint++
+		}
+		if result.Break != nil {
+			return result, nil
+		}
+
+		previous = row.chainHash
+		result.EventsChecked++
+		if row.erasureID != 0 {
+			result.ErasedEvents++
+		}
+		result.Head.ID, result.Head.ChainHash = row.id, row.chainHash
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	if nextCheckpoint < len(result.Checkpoints) {
+		result.Break = missingCheckpointedEvent(result.Checkpoints[nextCheckpoint])
+	}
+	return result, nil
+}
+
+// chainAnchors returns the chain hash to verify each event which follows a
+// removed partition against, by event id
+func chainAnchors(q querier) (map[int64][]byte, error) {
+	rows, err := q.Query(`select next_id, previous_chain_hash from ` + ChainAnchorsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := map[int64][]byte{}
+	for rows.Next() {
+		var id int64
+		var previous []byte
+		if err := rows.Scan(&id, &previous); err != nil {
+			return nil, err
+		}
+		anchors[id] = previous
+	}
+	return anchors, rows.Err()
+}
+
+type erasedEventKey struct {
+	erasureID int64
+	eventID   int64
+}
+
+// verifiedErasures are the sealed erasures, whose records have been checked,
+// and the events they changed
+type verifiedErasures struct {
+	// seqs are the places of the erasures in the chain of erasures, by id
+	seqs   map[int64]int64
+	events map[erasedEventKey]ErasedEvent
+
+	// checkpointedID is the last event covered by a checkpoint, and
+	// checkpointedSeq the last erasure
+	checkpointedID  int64
+	checkpointedSeq int64
+}
+
+// verifyErasures walks the chain of erasures in the order they were sealed,
+// recomputing their hashes, and checks that the checkpointed chain hashes
+// match. It sets the break in result at the first break.
+func verifyErasures(q querier, checkpoints []ChainCheckpoint, result *ChainVerification) (verifiedErasures, error) {
+	verified := verifiedErasures{
+		seqs:   map[int64]int64{},
+		events: map[erasedEventKey]ErasedEvent{},
+	}
+	sealed, err := readErasures(q, `where seal_seq is not null order by seal_seq`)
+	if err != nil {
+		return verified, err
+	}
+	events, err := erasedEvents(q, nil)
+	if err != nil {
+		return verified, err
+	}
+
+	var previous []byte
+	chainHashes := map[int64][]byte{}
+	for _, e := range sealed {
+		recordHash, err := ErasureRecordHash(e.erasure, events[e.erasure.ID])
+		if err != nil {
+			return verified, err
+		}
+		if !bytes.Equal(recordHash, e.recordHash) {
+			result.Break = &ChainBreak{ErasureID: e.erasure.ID, Reason: "erasure or the events it changed do not match its record hash"}
+			return verified, nil
+		}
+		if !bytes.Equal(ChainHash(previous, e.recordHash), e.chainHash) {
+			result.Break = &ChainBreak{ErasureID: e.erasure.ID, Reason: "chain hash does not follow from the previous erasure"}
+			return verified, nil
+		}
+		previous = e.chainHash
+		chainHashes[e.seq] = e.chainHash
+		verified.seqs[e.erasure.ID] = e.seq
+		for _, event := range events[e.erasure.ID] {
+			verified.events[erasedEventKey{e.erasure.ID, event.EventID}] = event
+		}
+		result.ErasuresChecked++
+		result.Head.ErasureSeq, result.Head.ErasureChainHash = e.seq, e.chainHash
+	}
+
+	for _, cp := range checkpoints {
+		if cp.HeadID > verified.checkpointedID {
+			verified.checkpointedID = cp.HeadID
+		}
+		if cp.ErasureSeq == 0 {
+			continue
+		}
+		chainHash, ok := chainHashes[cp.ErasureSeq]
+		if !ok {
+			result.Break = &ChainBreak{Reason: fmt.Sprintf("erasure at the head of checkpoint %d is missing", cp.ID)}
+			return verified, nil
+		}
+		if !bytes.Equal(cp.ErasureChainHash, chainHash) {
+			result.Break = &ChainBreak{Reason: fmt.Sprintf("erasure chain hash does not match checkpoint %d", cp.ID)}
+			return verified, nil
+		}
+		if cp.ErasureSeq > verified.checkpointedSeq {
+			verified.checkpointedSeq = cp.ErasureSeq
+		}
+	}
+	return verified, nil
+}
+
+type idRanges [][2]int64
+
+func (r idRanges) contains(id int64) bool {
+	for _, idRange := range r {
+		if id >= idRange[0] && id <= idRange[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func removedIDRanges(q querier) (idRanges, error) {
+	rows, err := q.Query(`
+		select min_id, max_id from ` + PartitionRemovalsTable + `
+		where min_id is not null
+		union all
+		select min_id, max_id from ` + CFAuditEventArchivesTable + `
+		where min_id is not null and rows_deleted_at is not null
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranges := idRanges{}
+	for rows.Next() {
+		var idRange [2]int64
+		if err := rows.Scan(&idRange[0], &idRange[1]); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, idRange)
+	}
+	return ranges, rows.Err()
+}
+
+// verifyChainRow checks an event's content and its place in the chain. The
+// content of an erased event is checked against the content hash recorded by
+// its erasure, which must be sealed and must have changed that event. If the
+// event is covered by a checkpoint, so must its erasure be, or the erasure
+// could have been made up to hide an edit to the event.
+func verifyChainRow(row chainRow, previous []byte, erasures verifiedErasures) *ChainBreak {
+	chainBreak := func(reason string, args ...interface{}) *ChainBreak {
+		return &ChainBreak{ID: row.id, GUID: row.event.GUID, Reason: fmt.Sprintf(reason, args...)}
+	}
+	if row.chainHash == nil {
+		return chainBreak("event is not sealed")
+	}
+	contentHash, err := ContentHash(row.foundation, row.event, row.names)
+	if err != nil {
+		return chainBreak("%s", err)
+	}
+	if row.erasureID == 0 {
+		if !bytes.Equal(contentHash, row.contentHash) {
+			return chainBreak("content does not match its content hash")
+		}
+	} else {
+		seq, ok := erasures.seqs[row.erasureID]
+		if !ok {
+			return chainBreak("erasure %d is not sealed", row.erasureID)
+		}
+		if row.id <= erasures.checkpointedID && seq > erasures.checkpointedSeq {
+			return chainBreak("erasure %d is not covered by a checkpoint yet", row.erasureID)
+		}
+		erasure, ok := erasures.events[erasedEventKey{row.erasureID, row.id}]
+		if !ok {
+			return chainBreak("erasure %d did not change this event", row.erasureID)
+		}
+		if erasure.GUID != row.event.GUID || !bytes.Equal(erasure.ContentHash, row.contentHash) {
+			return chainBreak("event does not match the one erasure %d changed", row.erasureID)
+		}
+		if !bytes.Equal(contentHash, erasure.ErasedContentHash) {
+			return chainBreak("content does not match the content hash recorded by erasure %d", row.erasureID)
+		}
+	}
+	if !bytes.Equal(ChainHash(previous, row.contentHash), row.chainHash) {
+		return chainBreak("chain hash does not follow from the previous event")
+	}
+	return nil
+}
+
+func missingCheckpointedEvent(cp ChainCheckpoint) *ChainBreak {
+	return &ChainBreak{
+		ID:     cp.HeadID,
+		Reason: fmt.Sprintf("event at the head of checkpoint %d is missing", cp.ID),
+	}
+}
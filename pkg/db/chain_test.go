@@ -0,0 +1,176 @@
+package db_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Hash chain", func() {
+	var event cfclient.Event
+
+	BeforeEach(func() {
+		event = cfclient.Event{
+			GUID:             "a8f3b7d0-0e5c-4a0b-9d3e-1f0c3c6c4e11",
+			Type:             "audit.app.update",
+			CreatedAt:        "2020-01-02T03:04:05.123456Z",
+			Actor:            "some-actor",
+			ActorType:        "user",
+			ActorName:        "some-actor-name",
+			ActorUsername:    "some-actor-username",
+			Actee:            "some-actee",
+			ActeeType:        "app",
+			ActeeName:        "some-actee-name",
+			OrganizationGUID: "0f0a7e3e-4a5c-4c0e-8bd1-2b1d2cbb0d55",
+			SpaceGUID:        "5c0f2c0e-7a1b-4a3c-9a11-9e8d7c6b5a44",
+			Metadata: map[string]interface{}{
+				"request": map[string]interface{}{"name": "some-app", "instances": json.Number("2")},
+			},
+		}
+	})
+
+	Describe("ContentHash", func() {
+		It("does not depend on the time zone of created_at", func() {
+			utc, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			event.CreatedAt = "2020-01-02T04:04:05.123456+01:00"
+			bst, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(bst).To(Equal(utc))
+		})
+
+		It("does not depend on the order of metadata keys", func() {
+			before, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = json.Unmarshal([]byte(`{"request": {"instances": 2, "name": "some-app"}}`), &event.Metadata)
+			Expect(err).NotTo(HaveOccurred())
+			after, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(after).To(Equal(before))
+		})
+
+		It("changes if any field changes", func() {
+			original, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, edit := range []func(*cfclient.Event){
+				func(e *cfclient.Event) { e.GUID = "00000000-0000-0000-0000-000000000000" },
+				func(e *cfclient.Event) { e.CreatedAt = "2020-01-02T03:04:06.123456Z" },
+				func(e *cfclient.Event) { e.Type = "audit.app.delete-request" },
+				func(e *cfclient.Event) { e.Actor = "other-actor" },
+				func(e *cfclient.Event) { e.ActorType = "other" },
+				func(e *cfclient.Event) { e.ActorName = "other" },
+				func(e *cfclient.Event) { e.ActorUsername = "other" },
+				func(e *cfclient.Event) { e.Actee = "other" },
+				func(e *cfclient.Event) { e.ActeeType = "other" },
+				func(e *cfclient.Event) { e.ActeeName = "other" },
+				func(e *cfclient.Event) { e.OrganizationGUID = "" },
+				func(e *cfclient.Event) { e.SpaceGUID = "" },
+				func(e *cfclient.Event) { e.Metadata = nil },
+			} {
+				edited := event
+				edit(&edited)
+				hash, err := db.ContentHash("", edited, db.EventNames{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hash).NotTo(Equal(original))
+			}
+		})
+
+		It("does not let content move between fields", func() {
+			a, b := event, event
+			a.ActorName, a.ActorUsername = "ab", "c"
+			b.ActorName, b.ActorUsername = "a", "bc"
+
+			hashA, err := db.ContentHash("", a, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			hashB, err := db.ContentHash("", b, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hashA).NotTo(Equal(hashB))
+		})
+
+		It("covers the foundation", func() {
+			withoutFoundation, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			foundationA, err := db.ContentHash("foundation-a", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			foundationB, err := db.ContentHash("foundation-b", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(foundationA).NotTo(Equal(withoutFoundation))
+			Expect(foundationA).NotTo(Equal(foundationB))
+		})
+
+		It("covers the names resolved for the event", func() {
+			names := db.EventNames{OrganizationName: "some-org", ActorEmail: "someone@example.com"}
+			withoutNames, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			withNames, err := db.ContentHash("", event, names)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(withNames).NotTo(Equal(withoutNames))
+
+			for _, edit := range []func(*db.EventNames){
+				func(n *db.EventNames) { n.OrganizationName = "other" },
+				func(n *db.EventNames) { n.SpaceName = "other" },
+				func(n *db.EventNames) { n.AppName = "other" },
+				func(n *db.EventNames) { n.ActorEmail = "" },
+			} {
+				edited := names
+				edit(&edited)
+				hash, err := db.ContentHash("", event, edited)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hash).NotTo(Equal(withNames))
+			}
+
+			foundationName, err := db.ContentHash("some-org", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			orgName, err := db.ContentHash("", event, db.EventNames{OrganizationName: "some-org"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgName).NotTo(Equal(foundationName))
+		})
+
+		It("hashes events without a foundation as it did before there were foundations", func() {
+			canonical, err := json.Marshal([]interface{}{
+				event.GUID, event.CreatedAt, event.Type,
+				event.Actor, event.ActorType, event.ActorName, event.ActorUsername,
+				event.Actee, event.ActeeType, event.ActeeName,
+				event.OrganizationGUID, event.SpaceGUID, event.Metadata,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			expected := sha256.Sum256(canonical)
+
+			hash, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(expected[:]))
+		})
+
+		It("returns an error if created_at is not a timestamp", func() {
+			event.CreatedAt = "yesterday"
+			_, err := db.ContentHash("", event, db.EventNames{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ChainHash", func() {
+		It("hashes the previous chain hash followed by the content hash", func() {
+			previous := []byte("previous-chain-hash")
+			content := []byte("content-hash")
+
+			expected := sha256.Sum256([]byte("previous-chain-hashcontent-hash"))
+			Expect(db.ChainHash(previous, content)).To(Equal(expected[:]))
+		})
+
+		It("starts the chain from the first content hash alone", func() {
+			expected := sha256.Sum256([]byte("content-hash"))
+			Expect(db.ChainHash(nil, []byte("content-hash"))).To(Equal(expected[:]))
+		})
+	})
+})
@@ -0,0 +1,987 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	CFAuditEventErasuresTable     = "cf_audit_event_erasures"
+	CFAuditEventErasedEventsTable = "cf_audit_event_erased_events"
+
+	ErasureSubjectUserGUID = "user_guid"
+	ErasureSubjectUsername = "username"
+
+	// erasureMaxRounds bounds how many times the identifiers of a user found
+	// in their events are used to look for more of their events
+	erasureMaxRounds = 5
+)
+
+// ErasureRequest identifies a user whose personal data is to be erased from
+// the stored events, by either their GUID or their username
+type ErasureRequest struct {
+	UserGUID string
+	Username string
+
+	// Reference is the request or ticket the erasure is for
+	Reference string
+
+	// RequestedBy is who asked for the erasure to be run
+	RequestedBy string
+}
+
+func (r ErasureRequest) Validate() error {
+	if (r.UserGUID == "") == (r.Username == "") {
+		return fmt.Errorf("exactly one of user GUID and username is required")
+	}
+	if r.Reference == "" {
+		return fmt.Errorf("a reference is required")
+	}
+	if r.RequestedBy == "" {
+		return fmt.Errorf("requested by is required")
+	}
+	return nil
+}
+
+// Erasure records an erasure of a user's personal data from stored events
+type Erasure struct {
+	ID          int64
+	Pseudonym   string
+	SubjectType string
+	Reference   string
+	RequestedBy string
+
+	// EventCount is the number of events which were changed
+	EventCount int64
+
+	// ArchiveKeys are the archives which hold the original content of
+	// events which were changed. Archives are not changed.
+	ArchiveKeys []string
+
+	// UnsearchedArchiveKeys are the archives whose events have been deleted
+	// from the database, so they were not searched, and may hold events
+	// about the user
+	UnsearchedArchiveKeys []string
+
+	// DetachedPartitions are the partitions detached by the retention
+	// policy, which were not searched, and may hold events about the user
+	DetachedPartitions []string
+
+	// ShippedTo are the sinks which were sent some of the changed events
+	// before they were changed. Sinks are not changed.
+	ShippedTo []string
+
+	ErasedAt time.Time
+}
+
+// EraseUserFromCFAuditEvents replaces the personal data of a user in every
+// stored event they are the actor or actee of, or which mentions them in its
+// metadata, with a pseudonym, and records the erasure. Events are changed,
+// never deleted, so that counts of events do not change.
+//
+// The user's GUIDs and usernames found in their events are used to look for
+// more of their events. Fields and metadata values which are exactly one of
+// these identifiers are replaced, and the names of the actor or actee are
+// replaced when they are the user.
+//
+// The email address resolved for the user as the actor of events is removed,
+// as are the names recorded for them.
+//
+// The user's events are looked for before taking the chain lock, so that
+// events can still be stored while the whole table is searched. Only the
+// events found, and any stored since, are searched again and changed while
+// holding it.
+//
+// Changed events keep their content hash and chain hash, so the hash chain
+// and its checkpoints still verify. The erasure records both content hashes
+// of each event it changed, so that the erased content can be checked
+// instead, and is sealed into the chain of erasures along with them, so that
+// those hashes cannot be edited either.
+func (s *EventStore) EraseUserFromCFAuditEvents(request ErasureRequest) (Erasure, error) {
+	erasure := Erasure{
+		Pseudonym:   "erased-" + uuid.NewV4().String(),
+		SubjectType: ErasureSubjectUserGUID,
+		Reference:   request.Reference,
+		RequestedBy: request.RequestedBy,
+		ArchiveKeys: []string{},
+
+		UnsearchedArchiveKeys: []string{},
+		DetachedPartitions:    []string{},
+		ShippedTo:             []string{},
+	}
+	if err := request.Validate(); err != nil {
+		return erasure, err
+	}
+	subject := newErasureSubject()
+	if request.UserGUID != "" {
+		subject.guids[request.UserGUID] = true
+	} else {
+		erasure.SubjectType = ErasureSubjectUsername
+		subject.names[request.Username] = true
+	}
+	lsession := s.logger.Session("erase-user", lager.Data{
+		"pseudonym":    erasure.Pseudonym,
+		"subject_type": erasure.SubjectType,
+		"reference":    erasure.Reference,
+		"requested_by": erasure.RequestedBy,
+	})
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	scope, err := findErasureRows(s.querier(ctx, nil), subject)
+	if err != nil {
+		return erasure, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return erasure, err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+	if err := lockChain(q); err != nil {
+		return erasure, err
+	}
+
+	var rows []chainRow
+	for round := 0; round < erasureMaxRounds; round++ {
+		rows, err = selectErasureRows(q, subject, scope, true)
+		if err != nil {
+			return erasure, err
+		}
+		if !subject.learn(rows) {
+			break
+		}
+		// Events stored since the search name the user by identifiers
+		// which other events may have too
+		scope = erasureScope{}
+	}
+
+	changed := []chainRow{}
+	changedIDs := []int64{}
+	createdAt := []string{}
+	for _, row := range rows {
+		if subject.erase(&row.event, erasure.Pseudonym) {
+			// The resolved email address of the actor is removed, as there
+			// is nothing to replace it with
+			if row.event.Actor == erasure.Pseudonym {
+				row.names.ActorEmail = ""
+			}
+			changed = append(changed, row)
+			changedIDs = append(changedIDs, row.id)
+			createdAt = append(createdAt, row.event.CreatedAt)
+		}
+	}
+	erasure.EventCount = int64(len(changed))
+
+	archives, err := q.Query(`
+		select object_key from `+CFAuditEventArchivesTable+` a
+		where exists (
+			select 1 from unnest($1::timestamptz[]) t
+			where t >= a.window_start and t < a.window_end
+		)
+		order by window_start
+	`, pq.Array(createdAt))
+	if err != nil {
+		return erasure, err
+	}
+	for archives.Next() {
+		var key string
+		if err := archives.Scan(&key); err != nil {
+			archives.Close()
+			return erasure, err
+		}
+		erasure.ArchiveKeys = append(erasure.ArchiveKeys, key)
+	}
+	archives.Close()
+	if err := archives.Err(); err != nil {
+		return erasure, err
+	}
+
+	if err := findUnsearchedCopies(q, &erasure, changedIDs); err != nil {
+		return erasure, err
+	}
+
+	err = q.QueryRow(`
+		insert into `+CFAuditEventErasuresTable+` (
+			pseudonym, subject_type, reference, requested_by, event_count, archive_keys,
+			unsearched_archive_keys, detached_partitions, shipped_to
+		) values (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9
+		)
+		returning id, erased_at
+	`,
+		erasure.Pseudonym, erasure.SubjectType, erasure.Reference, erasure.RequestedBy,
+		erasure.EventCount, pq.Array(erasure.ArchiveKeys),
+		pq.Array(erasure.UnsearchedArchiveKeys), pq.Array(erasure.DetachedPartitions), pq.Array(erasure.ShippedTo),
+	).Scan(&erasure.ID, &erasure.ErasedAt)
+	if err != nil {
+		return erasure, err
+	}
+
+	for _, row := range changed {
+		var metadata interface{}
+		if row.event.Metadata != nil {
+			metadataJSON, err := json.Marshal(row.event.Metadata)
+			if err != nil {
+				return erasure, err
+			}
+			metadata = string(metadataJSON)
+		}
+		_, err := q.Exec(`
+			update `+CFAuditEventsTable+`
+			set
+				actor = $2,
+				actor_name = $3,
+				actor_username = $4,
+				actee = $5,
+				actee_name = $6,
+				metadata = $7::jsonb,
+				actor_email = nullif($8, ''),
+				erasure_id = $9
+			where id = $1
+		`,
+			row.id, row.event.Actor, row.event.ActorName, row.event.ActorUsername,
+			row.event.Actee, row.event.ActeeName, metadata, row.names.ActorEmail, erasure.ID,
+		)
+		if err != nil {
+			return erasure, err
+		}
+	}
+	if err := recordErasedEvents(q, erasure.ID, changedIDs); err != nil {
+		return erasure, err
+	}
+	if err := sealErasure(q, erasure.ID); err != nil {
+		return erasure, err
+	}
+	_, err = q.Exec(`
+		delete from `+ResourceNamesTable+`
+		where resource_type = $1 and (guid = any($2) or name = any($3))
+	`, ResourceTypeUser, pq.Array(subject.guidList()), pq.Array(subject.nameList()))
+	if err != nil {
+		return erasure, err
+	}
+
+	// Alerts grouped by actor or actee are keyed by the user's GUID
+	_, err = q.Exec(`
+		update `+AlertsTable+`
+		set group_key = $2
+		where group_key = any($1)
+	`, pq.Array(subject.guidList()), erasure.Pseudonym)
+	if err != nil {
+		return erasure, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return erasure, err
+	}
+	lsession.Info("erased", lager.Data{
+		"erasure_id":              erasure.ID,
+		"event_count":             erasure.EventCount,
+		"archive_keys":            erasure.ArchiveKeys,
+		"unsearched_archive_keys": erasure.UnsearchedArchiveKeys,
+		"detached_partitions":     erasure.DetachedPartitions,
+		"shipped_to":              erasure.ShippedTo,
+	})
+	return erasure, nil
+}
+
+// recordErasedEvents records the content hash each of the events with ids
+// was sealed with, and the content hash of its content as it is now, against
+// the erasure which changed them. The content is read back, as it is when it
+// is verified, rather than hashed as it was written.
+func recordErasedEvents(q querier, erasureID int64, ids []int64) error {
+	rows, err := q.Query(`
+		select `+chainRowColumns+` from `+CFAuditEventsTable+`
+		where id = any($1)
+		order by id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	erased := []chainRow{}
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		erased = append(erased, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, row := range erased {
+		erasedContentHash, err := ContentHash(row.foundation, row.event, row.names)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(`
+			insert into `+CFAuditEventErasedEventsTable+` (
+				erasure_id, event_id, guid, content_hash, erased_content_hash
+			) values (
+				$1, $2, $3, $4, $5
+			)
+		`, erasureID, row.id, row.event.GUID, row.contentHash, erasedContentHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnsealedCFAuditEventErasures returns the erasures which have not been
+// sealed, which are those made before erasures were sealed, oldest first
+func (s *EventStore) GetUnsealedCFAuditEventErasures() ([]Erasure, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	unsealed, err := readErasures(s.querier(ctx, nil), `where seal_seq is null order by id`)
+	if err != nil {
+		return nil, err
+	}
+	erasures := []Erasure{}
+	for _, e := range unsealed {
+		erasures = append(erasures, e.erasure)
+	}
+	return erasures, nil
+}
+
+// SealEarlierCFAuditEventErasure seals an erasure made before erasures were
+// sealed, once every event which points to it has been checked against its
+// original in originals, such as the events of the archives the erasure
+// lists. Each original must match the content hash its event was sealed
+// with, and the event must differ from it only by values replaced with the
+// erasure's pseudonym, or with that of an erasure made before it, which
+// changed the event first, or by the actor's email address being removed. Any
+// hashes already recorded for the events must match. Nothing is recorded or
+// sealed unless every event checks out.
+func (s *EventStore) SealEarlierCFAuditEventErasure(erasureID int64, originals []FoundationEvent) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+	if err := lockChain(q); err != nil {
+		return err
+	}
+
+	erasures, err := readErasures(q, `where id = $1`, erasureID)
+	if err != nil {
+		return err
+	}
+	if len(erasures) == 0 {
+		return fmt.Errorf("erasure %d does not exist", erasureID)
+	}
+	erasure := erasures[0]
+	if erasure.seq != 0 {
+		return fmt.Errorf("erasure %d is already sealed", erasureID)
+	}
+
+	rows, err := q.Query(`
+		select `+chainRowColumns+` from `+CFAuditEventsTable+`
+		where erasure_id = $1
+		order by id
+	`, erasureID)
+	if err != nil {
+		return err
+	}
+	changed := []chainRow{}
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		changed = append(changed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if int64(len(changed)) > erasure.erasure.EventCount {
+		return fmt.Errorf("%d events point to erasure %d, which changed %d", len(changed), erasureID, erasure.erasure.EventCount)
+	}
+
+	pseudonyms := map[string]bool{}
+	earlier, err := readErasures(q, `where id <= $1`, erasureID)
+	if err != nil {
+		return err
+	}
+	for _, e := range earlier {
+		pseudonyms[e.erasure.Pseudonym] = true
+	}
+
+	byGUID := map[string]FoundationEvent{}
+	for _, original := range originals {
+		byGUID[original.GUID] = original
+	}
+	recorded, err := erasedEvents(q, []int64{erasureID})
+	if err != nil {
+		return err
+	}
+	recordedByID := map[int64]ErasedEvent{}
+	for _, event := range recorded[erasureID] {
+		recordedByID[event.EventID] = event
+	}
+
+	unrecorded := []int64{}
+	for _, row := range changed {
+		original, ok := byGUID[row.event.GUID]
+		if !ok {
+			return fmt.Errorf("event %s: no original to check it against", row.event.GUID)
+		}
+		originalHash, err := ContentHash(original.Foundation, original.Event, original.EventNames)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(originalHash, row.contentHash) {
+			return fmt.Errorf("event %s: original does not match the content hash the event was sealed with", row.event.GUID)
+		}
+		current := FoundationEvent{Event: row.event, EventNames: row.names, Foundation: row.foundation}
+		if !erasedFrom(original, current, pseudonyms) {
+			return fmt.Errorf("event %s: differs from its original by more than the pseudonyms of erasure %d and those before it", row.event.GUID, erasureID)
+		}
+
+		event, ok := recordedByID[row.id]
+		if !ok {
+			unrecorded = append(unrecorded, row.id)
+			continue
+		}
+		erasedContentHash, err := ContentHash(row.foundation, row.event, row.names)
+		if err != nil {
+			return err
+		}
+		if event.GUID != row.event.GUID || !bytes.Equal(event.ContentHash, row.contentHash) || !bytes.Equal(event.ErasedContentHash, erasedContentHash) {
+			return fmt.Errorf("event %s: hashes recorded by erasure %d do not match the event", row.event.GUID, erasureID)
+		}
+	}
+
+	if err := recordErasedEvents(q, erasureID, unrecorded); err != nil {
+		return err
+	}
+	_, err = q.Exec(`
+		update `+CFAuditEventErasuresTable+` set events_recorded = true where id = $1
+	`, erasureID)
+	if err != nil {
+		return err
+	}
+	if err := sealErasure(q, erasureID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.logger.Info("sealed-earlier-erasure", lager.Data{
+		"erasure_id":  erasureID,
+		"event_count": len(changed),
+		"recorded":    len(unrecorded),
+	})
+	return nil
+}
+
+// erasedFrom reports whether current only differs from original by values
+// replaced with one of pseudonyms, or by the actor's email address being
+// removed
+func erasedFrom(original FoundationEvent, current FoundationEvent, pseudonyms map[string]bool) bool {
+	same := func(original string, current string) bool {
+		return current == original || pseudonyms[current]
+	}
+	o, c := original.Event, current.Event
+	if original.Foundation != current.Foundation ||
+		o.GUID != c.GUID || o.Type != c.Type || o.ActorType != c.ActorType || o.ActeeType != c.ActeeType ||
+		o.OrganizationGUID != c.OrganizationGUID || o.SpaceGUID != c.SpaceGUID {
+		return false
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, o.CreatedAt)
+	if err != nil {
+		return false
+	}
+	currentCreatedAt, err := time.Parse(time.RFC3339Nano, c.CreatedAt)
+	if err != nil || !createdAt.Equal(currentCreatedAt) {
+		return false
+	}
+	if !same(o.Actor, c.Actor) || !same(o.ActorName, c.ActorName) || !same(o.ActorUsername, c.ActorUsername) ||
+		!same(o.Actee, c.Actee) || !same(o.ActeeName, c.ActeeName) {
+		return false
+	}
+	on, cn := original.EventNames, current.EventNames
+	if on.OrganizationName != cn.OrganizationName || on.SpaceName != cn.SpaceName || on.AppName != cn.AppName ||
+		(cn.ActorEmail != on.ActorEmail && cn.ActorEmail != "") {
+		return false
+	}
+	return erasedValueFrom(o.Metadata, c.Metadata, pseudonyms)
+}
+
+func erasedValueFrom(original interface{}, current interface{}, pseudonyms map[string]bool) bool {
+	if str, ok := current.(string); ok && pseudonyms[str] {
+		if _, ok := original.(string); ok {
+			return true
+		}
+	}
+	switch o := original.(type) {
+	case map[string]interface{}:
+		c, ok := current.(map[string]interface{})
+		if !ok || len(c) != len(o) {
+			return false
+		}
+		for key, value := range o {
+			currentValue, ok := c[key]
+			if !ok || !erasedValueFrom(value, currentValue, pseudonyms) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		c, ok := current.([]interface{})
+		if !ok || len(c) != len(o) {
+			return false
+		}
+		for i := range o {
+			if !erasedValueFrom(o[i], c[i], pseudonyms) {
+				return false
+			}
+		}
+		return true
+	}
+	// Numbers are decoded differently from archives and from the database,
+	// so leaves are compared in their JSON form
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return false
+	}
+	currentJSON, err := json.Marshal(current)
+	return err == nil && bytes.Equal(originalJSON, currentJSON)
+}
+
+// erasureScope limits the events searched for a user to those with ids, and
+// those stored after afterID. The zero scope is every event.
+type erasureScope struct {
+	ids     []int64
+	afterID int64
+}
+
+// findErasureRows searches every event for the user, learning their
+// identifiers as it goes, and returns the scope of the events found and those
+// stored since
+func findErasureRows(q querier, subject erasureSubject) (erasureScope, error) {
+	scope := erasureScope{ids: []int64{}}
+	err := q.QueryRow(`select coalesce(max(id), 0) from ` + CFAuditEventsTable).Scan(&scope.afterID)
+	if err != nil {
+		return scope, err
+	}
+
+	for round := 0; round < erasureMaxRounds; round++ {
+		rows, err := selectErasureRows(q, subject, erasureScope{}, false)
+		if err != nil {
+			return scope, err
+		}
+		scope.ids = scope.ids[:0]
+		for _, row := range rows {
+			scope.ids = append(scope.ids, row.id)
+		}
+		if !subject.learn(rows) {
+			break
+		}
+	}
+	return scope, nil
+}
+
+func selectErasureRows(q querier, subject erasureSubject, scope erasureScope, forUpdate bool) ([]chainRow, error) {
+	lock := ""
+	if forUpdate {
+		lock = "for update"
+	}
+	rows, err := q.Query(`
+		select `+chainRowColumns+` from `+CFAuditEventsTable+`
+		where ($4::bigint[] is null or id = any($4) or id > $5)
+		and (
+			actor = any($1) or actee = any($1)
+			or (actor_type = 'user' and (actor_username = any($2) or actor_name = any($2)))
+			or (actee_type = 'user' and actee_name = any($2))
+			or exists (
+				select 1 from unnest($3::text[]) v
+				where strpos(metadata::text, to_json(v)::text) > 0
+			)
+		)
+		order by id
+		`+lock+`
+	`,
+		pq.Array(subject.guidList()), pq.Array(subject.nameList()), pq.Array(subject.identifiers()),
+		pq.Array(scope.ids), scope.afterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []chainRow{}
+	for rows.Next() {
+		row, err := scanChainRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, row)
+	}
+	return found, rows.Err()
+}
+
+// findUnsearchedCopies records the copies of events which the erasure could
+// not search or change: archives whose events have been deleted, partitions
+// detached by the retention policy, and sinks which were sent changed events
+func findUnsearchedCopies(q querier, erasure *Erasure, changedIDs []int64) error {
+	query := func(dest *[]string, query string, args ...interface{}) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			*dest = append(*dest, value)
+		}
+		return rows.Err()
+	}
+
+	err := query(&erasure.UnsearchedArchiveKeys, `
+		select object_key from `+CFAuditEventArchivesTable+`
+		where rows_deleted_at is not null
+		order by window_start
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = query(&erasure.DetachedPartitions, `
+		select distinct partition_name from `+PartitionRemovalsTable+`
+		where action = $1 and to_regclass(partition_name) is not null
+		order by partition_name
+	`, PartitionActionDetach)
+	if err != nil {
+		return err
+	}
+
+	// Restored events are not shipped, even once a sink's cursor is past them
+	return query(&erasure.ShippedTo, `
+		select name from `+ShipperCursorsTable+` c
+		where exists (
+			select 1 from `+CFAuditEventsTable+` e
+			where e.id = any($1) and e.id <= c.shipped_seq and e.origin != '`+OriginRestored+`'
+		)
+		order by name
+	`, pq.Array(changedIDs))
+}
+
+// erasureSubject is the GUIDs and usernames of a user being erased
+type erasureSubject struct {
+	guids map[string]bool
+	names map[string]bool
+}
+
+func newErasureSubject() erasureSubject {
+	return erasureSubject{map[string]bool{}, map[string]bool{}}
+}
+
+// learn adds the user's identifiers found in their events, and reports
+// whether there were any new ones
+func (s erasureSubject) learn(rows []chainRow) bool {
+	learnt := false
+	add := func(set map[string]bool, value string) {
+		if value != "" && !set[value] {
+			set[value] = true
+			learnt = true
+		}
+	}
+	for _, row := range rows {
+		e := row.event
+		if e.ActorType == "user" {
+			if s.guids[e.Actor] {
+				add(s.names, e.ActorUsername)
+				add(s.names, e.ActorName)
+			} else if s.names[e.ActorUsername] || s.names[e.ActorName] {
+				add(s.guids, e.Actor)
+			}
+		}
+		if e.ActeeType == "user" {
+			if s.guids[e.Actee] {
+				add(s.names, e.ActeeName)
+			} else if s.names[e.ActeeName] {
+				add(s.guids, e.Actee)
+			}
+		}
+	}
+	return learnt
+}
+
+// erase replaces the user's personal data in event with pseudonym, and
+// reports whether anything was replaced
+func (s erasureSubject) erase(event *cfclient.Event, pseudonym string) bool {
+	erased := false
+	replace := func(field *string, replace bool) {
+		if replace && *field != "" && *field != pseudonym {
+			*field = pseudonym
+			erased = true
+		}
+	}
+
+	actorIsUser := s.guids[event.Actor] ||
+		(event.ActorType == "user" && (s.names[event.ActorUsername] || s.names[event.ActorName]))
+	replace(&event.Actor, actorIsUser)
+	replace(&event.ActorName, actorIsUser || s.names[event.ActorName])
+	replace(&event.ActorUsername, actorIsUser || s.names[event.ActorUsername])
+
+	acteeIsUser := s.guids[event.Actee] || (event.ActeeType == "user" && s.names[event.ActeeName])
+	replace(&event.Actee, acteeIsUser)
+	replace(&event.ActeeName, acteeIsUser || s.names[event.ActeeName])
+
+	if event.Metadata != nil && s.eraseValue(event.Metadata, pseudonym) {
+		erased = true
+	}
+	return erased
+}
+
+func (s erasureSubject) eraseValue(value interface{}, pseudonym string) bool {
+	erased := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, element := range v {
+			if str, ok := element.(string); ok && (s.guids[str] || s.names[str]) {
+				v[key] = pseudonym
+				erased = true
+			} else if s.eraseValue(element, pseudonym) {
+				erased = true
+			}
+		}
+	case []interface{}:
+		for i, element := range v {
+			if str, ok := element.(string); ok && (s.guids[str] || s.names[str]) {
+				v[i] = pseudonym
+				erased = true
+			} else if s.eraseValue(element, pseudonym) {
+				erased = true
+			}
+		}
+	}
+	return erased
+}
+
+func (s erasureSubject) guidList() []string {
+	return sortedKeys(s.guids)
+}
+
+func (s erasureSubject) nameList() []string {
+	return sortedKeys(s.names)
+}
+
+func (s erasureSubject) identifiers() []string {
+	return append(s.guidList(), s.nameList()...)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetCFAuditEventErasures returns every erasure, oldest first
+func (s *EventStore) GetCFAuditEventErasures() ([]Erasure, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	sealed, err := readErasures(s.querier(ctx, nil), `order by id`)
+	if err != nil {
+		return nil, err
+	}
+	erasures := []Erasure{}
+	for _, e := range sealed {
+		erasures = append(erasures, e.erasure)
+	}
+	return erasures, nil
+}
+
+// ErasedEvent is an event changed by an erasure, with the content hash it
+// was sealed with and the content hash of its erased content
+type ErasedEvent struct {
+	EventID           int64
+	GUID              string
+	ContentHash       []byte
+	ErasedContentHash []byte
+}
+
+// ErasureRecordHash returns the hash of the canonical form of an erasure and
+// the events it changed, in event id order. ErasedAt is hashed in UTC.
+func ErasureRecordHash(erasure Erasure, events []ErasedEvent) ([]byte, error) {
+	events = append([]ErasedEvent{}, events...)
+	sort.Slice(events, func(i, j int) bool { return events[i].EventID < events[j].EventID })
+	changed := []interface{}{}
+	for _, e := range events {
+		changed = append(changed, []interface{}{e.EventID, e.GUID, e.ContentHash, e.ErasedContentHash})
+	}
+	list := func(values []string) []string {
+		if values == nil {
+			return []string{}
+		}
+		return values
+	}
+	content := []interface{}{
+		erasure.ID,
+		erasure.Pseudonym,
+		erasure.SubjectType,
+		erasure.Reference,
+		erasure.RequestedBy,
+		erasure.EventCount,
+		list(erasure.ArchiveKeys),
+		list(erasure.UnsearchedArchiveKeys),
+		list(erasure.DetachedPartitions),
+		list(erasure.ShippedTo),
+		erasure.ErasedAt.UTC().Format(time.RFC3339Nano),
+		changed,
+	}
+	canonical, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("erasure %d: %w", erasure.ID, err)
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+// sealedErasure is an erasure with its place in the chain of erasures, which
+// is zero if it has not been sealed
+type sealedErasure struct {
+	erasure    Erasure
+	seq        int64
+	recordHash []byte
+	chainHash  []byte
+}
+
+// readErasures returns the erasures selected by the rest of a query, such as
+// its where and order by clauses
+func readErasures(q querier, rest string, args ...interface{}) ([]sealedErasure, error) {
+	rows, err := q.Query(`
+		select
+			id, pseudonym, subject_type, reference, requested_by, event_count, archive_keys,
+			unsearched_archive_keys, detached_partitions, shipped_to, erased_at,
+			coalesce(seal_seq, 0), record_hash, chain_hash
+		from `+CFAuditEventErasuresTable+`
+		`+rest, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	erasures := []sealedErasure{}
+	for rows.Next() {
+		e := sealedErasure{}
+		err := rows.Scan(
+			&e.erasure.ID, &e.erasure.Pseudonym, &e.erasure.SubjectType, &e.erasure.Reference,
+			&e.erasure.RequestedBy, &e.erasure.EventCount, pq.Array(&e.erasure.ArchiveKeys),
+			pq.Array(&e.erasure.UnsearchedArchiveKeys), pq.Array(&e.erasure.DetachedPartitions), pq.Array(&e.erasure.ShippedTo),
+			&e.erasure.ErasedAt, &e.seq, &e.recordHash, &e.chainHash,
+		)
+		if err != nil {
+			return nil, err
+		}
+		erasures = append(erasures, e)
+	}
+	return erasures, rows.Err()
+}
+
+// erasedEvents returns the events changed by each of the erasures with ids,
+// or by every erasure if ids is nil, by erasure id
+func erasedEvents(q querier, ids []int64) (map[int64][]ErasedEvent, error) {
+	rows, err := q.Query(`
+		select erasure_id, event_id, guid, content_hash, erased_content_hash
+		from `+CFAuditEventErasedEventsTable+`
+		where $1::bigint[] is null or erasure_id = any($1)
+		order by erasure_id, event_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	erased := map[int64][]ErasedEvent{}
+	for rows.Next() {
+		var erasureID int64
+		var event ErasedEvent
+		if err := rows.Scan(&erasureID, &event.EventID, &event.GUID, &event.ContentHash, &event.ErasedContentHash); err != nil {
+			return nil, err
+		}
+		erased[erasureID] = append(erased[erasureID], event)
+	}
+	return erased, rows.Err()
+}
+
+// erasureChainHead returns the place in the chain of erasures and the chain
+// hash of the last sealed erasure, or zero and nil if none have been sealed
+func erasureChainHead(q querier) (int64, []byte, error) {
+	var seq int64
+	var chainHash []byte
+	err := q.QueryRow(`
+		select seal_seq, chain_hash from `+CFAuditEventErasuresTable+`
+		where seal_seq is not null
+		order by seal_seq desc
+		limit 1
+	`).Scan(&seq, &chainHash)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	return seq, chainHash, err
+}
+
+// sealErasure seals an erasure and the events it changed, as they are
+// recorded, onto the end of the chain of erasures. The erasure and its events
+// are read back, as they are when they are verified. The caller must hold the
+// chain lock.
+func sealErasure(q querier, erasureID int64) error {
+	seq, previous, err := erasureChainHead(q)
+	if err != nil {
+		return err
+	}
+	erasures, err := readErasures(q, `where id = $1`, erasureID)
+	if err != nil {
+		return err
+	}
+	if len(erasures) == 0 {
+		return fmt.Errorf("erasure %d does not exist", erasureID)
+	}
+	events, err := erasedEvents(q, []int64{erasureID})
+	if err != nil {
+		return err
+	}
+
+	recordHash, err := ErasureRecordHash(erasures[0].erasure, events[erasureID])
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`
+		update `+CFAuditEventErasuresTable+`
+		set seal_seq = $2, record_hash = $3, chain_hash = $4
+		where id = $1
+	`, erasureID, seq+1, recordHash, ChainHash(previous, recordHash))
+	return err
+}
@@ -0,0 +1,115 @@
+package db_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("ErasureRequest", func() {
+	It("accepts a user GUID or a username with a reference and requester", func() {
+		Expect(db.ErasureRequest{UserGUID: "some-guid", Reference: "r", RequestedBy: "cli:someone"}.Validate()).To(Succeed())
+		Expect(db.ErasureRequest{Username: "someone", Reference: "r", RequestedBy: "cli:someone"}.Validate()).To(Succeed())
+	})
+
+	It("needs exactly one of a user GUID and a username", func() {
+		Expect(db.ErasureRequest{Reference: "r", RequestedBy: "cli:someone"}.Validate()).To(
+			MatchError(ContainSubstring("exactly one of user GUID and username")))
+		Expect(db.ErasureRequest{UserGUID: "some-guid", Username: "someone", Reference: "r", RequestedBy: "cli:someone"}.Validate()).To(
+			MatchError(ContainSubstring("exactly one of user GUID and username")))
+	})
+
+	It("needs a reference and a requester", func() {
+		Expect(db.ErasureRequest{UserGUID: "some-guid", RequestedBy: "cli:someone"}.Validate()).To(
+			MatchError(ContainSubstring("reference")))
+		Expect(db.ErasureRequest{UserGUID: "some-guid", Reference: "r"}.Validate()).To(
+			MatchError(ContainSubstring("requested by")))
+	})
+})
+
+var _ = Describe("ErasureRecordHash", func() {
+	var (
+		erasure db.Erasure
+		events  []db.ErasedEvent
+	)
+
+	BeforeEach(func() {
+		erasure = db.Erasure{
+			ID:          3,
+			Pseudonym:   "erased-some-uuid",
+			SubjectType: db.ErasureSubjectUserGUID,
+			Reference:   "TICKET-123",
+			RequestedBy: "cli:someone",
+			EventCount:  2,
+			ArchiveKeys: []string{"some-archive"},
+			ShippedTo:   []string{"splunk"},
+			ErasedAt:    time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		}
+		events = []db.ErasedEvent{
+			{EventID: 1, GUID: "guid-1", ContentHash: []byte("sealed-1"), ErasedContentHash: []byte("erased-1")},
+			{EventID: 2, GUID: "guid-2", ContentHash: []byte("sealed-2"), ErasedContentHash: []byte("erased-2")},
+		}
+	})
+
+	It("does not depend on the order of the events or the time zone of erased_at", func() {
+		original, err := db.ErasureRecordHash(erasure, events)
+		Expect(err).NotTo(HaveOccurred())
+
+		erasure.ErasedAt = erasure.ErasedAt.In(time.FixedZone("BST", 3600))
+		reordered, err := db.ErasureRecordHash(erasure, []db.ErasedEvent{events[1], events[0]})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reordered).To(Equal(original))
+	})
+
+	It("changes if any field of the erasure or of the events it changed changes", func() {
+		original, err := db.ErasureRecordHash(erasure, events)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, edit := range []func(*db.Erasure, []db.ErasedEvent) []db.ErasedEvent{
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.ID = 4; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.Pseudonym = "other"; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.SubjectType = "other"; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.Reference = "other"; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.RequestedBy = "other"; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.EventCount = 3; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.ArchiveKeys = nil; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				e.UnsearchedArchiveKeys = []string{"a"}
+				return ev
+			},
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				e.DetachedPartitions = []string{"p"}
+				return ev
+			},
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { e.ShippedTo = nil; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				e.ErasedAt = e.ErasedAt.Add(time.Microsecond)
+				return ev
+			},
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { return ev[:1] },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				return append(ev, db.ErasedEvent{EventID: 5, GUID: "guid-5", ContentHash: []byte("x"), ErasedContentHash: []byte("y")})
+			},
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { ev[0].EventID = 4; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent { ev[0].GUID = "other"; return ev },
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				ev[0].ContentHash = []byte("other")
+				return ev
+			},
+			func(e *db.Erasure, ev []db.ErasedEvent) []db.ErasedEvent {
+				ev[0].ErasedContentHash = []byte("other")
+				return ev
+			},
+		} {
+			edited := erasure
+			editedEvents := edit(&edited, append([]db.ErasedEvent{}, events...))
+			hash, err := db.ErasureRecordHash(edited, editedEvents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).NotTo(Equal(original))
+		}
+	})
+})
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// ErrLeaseLost is returned by a write made with a store from WithLease if
+// its lease is no longer held, so the write was not committed
+var ErrLeaseLost = errors.New("leader lease has been lost")
+
+// ErrPartitionHeld is returned when removing a partition which is held, for
+// example because events have been restored into it
+var ErrPartitionHeld = errors.New("partition is held")
+
+// IsRetryable reports whether an error returned by the store is likely to be
+// transient, such as a dropped connection or a database failover
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", // connection_exception
+			"40", // transaction_rollback, e.g. serialization_failure or deadlock_detected
+			"53", // insufficient_resources
+			"57": // operator_intervention, e.g. admin_shutdown or cannot_connect_now
+			return true
+		}
+		return pqErr.Code == "55P03" // lock_not_available
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -10,34 +11,282 @@ import (
 )
 
 type FakeEventDB struct {
-	GetCFAuditEventsStub        func(db.RawEventFilter) ([]cfclient.Event, error)
+	AcquireLeaderLeaseStub        func(*db.Lease, time.Duration) (bool, error)
+	acquireLeaderLeaseMutex       sync.RWMutex
+	acquireLeaderLeaseArgsForCall []struct {
+		arg1 *db.Lease
+		arg2 time.Duration
+	}
+	acquireLeaderLeaseReturns struct {
+		result1 bool
+		result2 error
+	}
+	acquireLeaderLeaseReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	BackfillCFAuditEventsStub        func(string, []cfclient.Event, map[string]db.EventNames) (int, error)
+	backfillCFAuditEventsMutex       sync.RWMutex
+	backfillCFAuditEventsArgsForCall []struct {
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
+	}
+	backfillCFAuditEventsReturns struct {
+		result1 int
+		result2 error
+	}
+	backfillCFAuditEventsReturnsOnCall map[int]struct {
+		result1 int
+		result2 error
+	}
+	CountUnarchivedCFAuditEventsStub        func(db.Partition) (int64, error)
+	countUnarchivedCFAuditEventsMutex       sync.RWMutex
+	countUnarchivedCFAuditEventsArgsForCall []struct {
+		arg1 db.Partition
+	}
+	countUnarchivedCFAuditEventsReturns struct {
+		result1 int64
+		result2 error
+	}
+	countUnarchivedCFAuditEventsReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	CreateBackfillJobStub        func(db.BackfillJob, []db.BackfillWindow) (db.BackfillJob, error)
+	createBackfillJobMutex       sync.RWMutex
+	createBackfillJobArgsForCall []struct {
+		arg1 db.BackfillJob
+		arg2 []db.BackfillWindow
+	}
+	createBackfillJobReturns struct {
+		result1 db.BackfillJob
+		result2 error
+	}
+	createBackfillJobReturnsOnCall map[int]struct {
+		result1 db.BackfillJob
+		result2 error
+	}
+	DeleteArchivedCFAuditEventsStub        func(db.CFAuditEventArchive) (int64, error)
+	deleteArchivedCFAuditEventsMutex       sync.RWMutex
+	deleteArchivedCFAuditEventsArgsForCall []struct {
+		arg1 db.CFAuditEventArchive
+	}
+	deleteArchivedCFAuditEventsReturns struct {
+		result1 int64
+		result2 error
+	}
+	deleteArchivedCFAuditEventsReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	EnsureCFAuditEventPartitionStub        func(time.Time) (bool, error)
+	ensureCFAuditEventPartitionMutex       sync.RWMutex
+	ensureCFAuditEventPartitionArgsForCall []struct {
+		arg1 time.Time
+	}
+	ensureCFAuditEventPartitionReturns struct {
+		result1 bool
+		result2 error
+	}
+	ensureCFAuditEventPartitionReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	EraseUserFromCFAuditEventsStub        func(db.ErasureRequest) (db.Erasure, error)
+	eraseUserFromCFAuditEventsMutex       sync.RWMutex
+	eraseUserFromCFAuditEventsArgsForCall []struct {
+		arg1 db.ErasureRequest
+	}
+	eraseUserFromCFAuditEventsReturns struct {
+		result1 db.Erasure
+		result2 error
+	}
+	eraseUserFromCFAuditEventsReturnsOnCall map[int]struct {
+		result1 db.Erasure
+		result2 error
+	}
+	GetBackfillJobStub        func(string) (*db.BackfillJob, error)
+	getBackfillJobMutex       sync.RWMutex
+	getBackfillJobArgsForCall []struct {
+		arg1 string
+	}
+	getBackfillJobReturns struct {
+		result1 *db.BackfillJob
+		result2 error
+	}
+	getBackfillJobReturnsOnCall map[int]struct {
+		result1 *db.BackfillJob
+		result2 error
+	}
+	GetBackfillJobsStub        func() ([]db.BackfillJob, error)
+	getBackfillJobsMutex       sync.RWMutex
+	getBackfillJobsArgsForCall []struct {
+	}
+	getBackfillJobsReturns struct {
+		result1 []db.BackfillJob
+		result2 error
+	}
+	getBackfillJobsReturnsOnCall map[int]struct {
+		result1 []db.BackfillJob
+		result2 error
+	}
+	GetBackfillWindowsStub        func(string) ([]db.BackfillWindow, error)
+	getBackfillWindowsMutex       sync.RWMutex
+	getBackfillWindowsArgsForCall []struct {
+		arg1 string
+	}
+	getBackfillWindowsReturns struct {
+		result1 []db.BackfillWindow
+		result2 error
+	}
+	getBackfillWindowsReturnsOnCall map[int]struct {
+		result1 []db.BackfillWindow
+		result2 error
+	}
+	GetCFAuditEventArchivesStub        func() ([]db.CFAuditEventArchive, error)
+	getCFAuditEventArchivesMutex       sync.RWMutex
+	getCFAuditEventArchivesArgsForCall []struct {
+	}
+	getCFAuditEventArchivesReturns struct {
+		result1 []db.CFAuditEventArchive
+		result2 error
+	}
+	getCFAuditEventArchivesReturnsOnCall map[int]struct {
+		result1 []db.CFAuditEventArchive
+		result2 error
+	}
+	GetCFAuditEventArchivesWithLateEventsStub        func(int64) ([]db.CFAuditEventArchive, int64, error)
+	getCFAuditEventArchivesWithLateEventsMutex       sync.RWMutex
+	getCFAuditEventArchivesWithLateEventsArgsForCall []struct {
+		arg1 int64
+	}
+	getCFAuditEventArchivesWithLateEventsReturns struct {
+		result1 []db.CFAuditEventArchive
+		result2 int64
+		result3 error
+	}
+	getCFAuditEventArchivesWithLateEventsReturnsOnCall map[int]struct {
+		result1 []db.CFAuditEventArchive
+		result2 int64
+		result3 error
+	}
+	GetCFAuditEventErasuresStub        func() ([]db.Erasure, error)
+	getCFAuditEventErasuresMutex       sync.RWMutex
+	getCFAuditEventErasuresArgsForCall []struct {
+	}
+	getCFAuditEventErasuresReturns struct {
+		result1 []db.Erasure
+		result2 error
+	}
+	getCFAuditEventErasuresReturnsOnCall map[int]struct {
+		result1 []db.Erasure
+		result2 error
+	}
+	GetCFAuditEventPartitionHoldsStub        func() ([]db.PartitionHold, error)
+	getCFAuditEventPartitionHoldsMutex       sync.RWMutex
+	getCFAuditEventPartitionHoldsArgsForCall []struct {
+	}
+	getCFAuditEventPartitionHoldsReturns struct {
+		result1 []db.PartitionHold
+		result2 error
+	}
+	getCFAuditEventPartitionHoldsReturnsOnCall map[int]struct {
+		result1 []db.PartitionHold
+		result2 error
+	}
+	GetCFAuditEventPartitionsStub        func() ([]db.Partition, error)
+	getCFAuditEventPartitionsMutex       sync.RWMutex
+	getCFAuditEventPartitionsArgsForCall []struct {
+	}
+	getCFAuditEventPartitionsReturns struct {
+		result1 []db.Partition
+		result2 error
+	}
+	getCFAuditEventPartitionsReturnsOnCall map[int]struct {
+		result1 []db.Partition
+		result2 error
+	}
+	GetCFAuditEventsStub        func(db.RawEventFilter) ([]db.CFAuditEvent, error)
 	getCFAuditEventsMutex       sync.RWMutex
 	getCFAuditEventsArgsForCall []struct {
 		arg1 db.RawEventFilter
 	}
 	getCFAuditEventsReturns struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	getCFAuditEventsReturnsOnCall map[int]struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
-	GetCFEventCountStub        func() (int64, error)
-	getCFEventCountMutex       sync.RWMutex
-	getCFEventCountArgsForCall []struct {
+	GetCFEventCountsStub        func() (map[string]int64, error)
+	getCFEventCountsMutex       sync.RWMutex
+	getCFEventCountsArgsForCall []struct {
 	}
-	getCFEventCountReturns struct {
-		result1 int64
+	getCFEventCountsReturns struct {
+		result1 map[string]int64
 		result2 error
 	}
-	getCFEventCountReturnsOnCall map[int]struct {
-		result1 int64
+	getCFEventCountsReturnsOnCall map[int]struct {
+		result1 map[string]int64
+		result2 error
+	}
+	GetChainHeadStub        func() (db.ChainHead, error)
+	getChainHeadMutex       sync.RWMutex
+	getChainHeadArgsForCall []struct {
+	}
+	getChainHeadReturns struct {
+		result1 db.ChainHead
+		result2 error
+	}
+	getChainHeadReturnsOnCall map[int]struct {
+		result1 db.ChainHead
+		result2 error
+	}
+	GetEarliestCFEventTimeStub        func() (time.Time, error)
+	getEarliestCFEventTimeMutex       sync.RWMutex
+	getEarliestCFEventTimeArgsForCall []struct {
+	}
+	getEarliestCFEventTimeReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getEarliestCFEventTimeReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
+	GetLastAlertDeliveryTimeStub        func(string, string, string) (time.Time, error)
+	getLastAlertDeliveryTimeMutex       sync.RWMutex
+	getLastAlertDeliveryTimeArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	getLastAlertDeliveryTimeReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getLastAlertDeliveryTimeReturnsOnCall map[int]struct {
+		result1 time.Time
 		result2 error
 	}
-	GetLatestCFEventTimeStub        func() (time.Time, error)
+	GetLatestCFAuditEventArchiveStub        func() (*db.CFAuditEventArchive, error)
+	getLatestCFAuditEventArchiveMutex       sync.RWMutex
+	getLatestCFAuditEventArchiveArgsForCall []struct {
+	}
+	getLatestCFAuditEventArchiveReturns struct {
+		result1 *db.CFAuditEventArchive
+		result2 error
+	}
+	getLatestCFAuditEventArchiveReturnsOnCall map[int]struct {
+		result1 *db.CFAuditEventArchive
+		result2 error
+	}
+	GetLatestCFEventTimeStub        func(string) (time.Time, error)
 	getLatestCFEventTimeMutex       sync.RWMutex
 	getLatestCFEventTimeArgsForCall []struct {
+		arg1 string
 	}
 	getLatestCFEventTimeReturns struct {
 		result1 time.Time
@@ -47,19 +296,75 @@ type FakeEventDB struct {
 		result1 time.Time
 		result2 error
 	}
-	GetUnshippedCFAuditEventsForShipperStub        func(string) ([]cfclient.Event, error)
+	GetLatestChainCheckpointStub        func() (*db.ChainCheckpoint, error)
+	getLatestChainCheckpointMutex       sync.RWMutex
+	getLatestChainCheckpointArgsForCall []struct {
+	}
+	getLatestChainCheckpointReturns struct {
+		result1 *db.ChainCheckpoint
+		result2 error
+	}
+	getLatestChainCheckpointReturnsOnCall map[int]struct {
+		result1 *db.ChainCheckpoint
+		result2 error
+	}
+	GetResourceNamesStub        func(string, string, string) ([]db.ResourceName, error)
+	getResourceNamesMutex       sync.RWMutex
+	getResourceNamesArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	getResourceNamesReturns struct {
+		result1 []db.ResourceName
+		result2 error
+	}
+	getResourceNamesReturnsOnCall map[int]struct {
+		result1 []db.ResourceName
+		result2 error
+	}
+	GetUndeliveredAlertsStub        func(string, []string, time.Time) ([]db.Alert, error)
+	getUndeliveredAlertsMutex       sync.RWMutex
+	getUndeliveredAlertsArgsForCall []struct {
+		arg1 string
+		arg2 []string
+		arg3 time.Time
+	}
+	getUndeliveredAlertsReturns struct {
+		result1 []db.Alert
+		result2 error
+	}
+	getUndeliveredAlertsReturnsOnCall map[int]struct {
+		result1 []db.Alert
+		result2 error
+	}
+	GetUnshippedCFAuditEventsForShipperStub        func(string, int) ([]db.CFAuditEvent, error)
 	getUnshippedCFAuditEventsForShipperMutex       sync.RWMutex
 	getUnshippedCFAuditEventsForShipperArgsForCall []struct {
 		arg1 string
+		arg2 int
 	}
 	getUnshippedCFAuditEventsForShipperReturns struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
 	getUnshippedCFAuditEventsForShipperReturnsOnCall map[int]struct {
-		result1 []cfclient.Event
+		result1 []db.CFAuditEvent
 		result2 error
 	}
+	HoldCFAuditEventPartitionStub        func(time.Time, time.Time, string) error
+	holdCFAuditEventPartitionMutex       sync.RWMutex
+	holdCFAuditEventPartitionArgsForCall []struct {
+		arg1 time.Time
+		arg2 time.Time
+		arg3 string
+	}
+	holdCFAuditEventPartitionReturns struct {
+		result1 error
+	}
+	holdCFAuditEventPartitionReturnsOnCall map[int]struct {
+		result1 error
+	}
 	InitStub        func() error
 	initMutex       sync.RWMutex
 	initArgsForCall []struct {
@@ -70,23 +375,186 @@ type FakeEventDB struct {
 	initReturnsOnCall map[int]struct {
 		result1 error
 	}
-	StoreCFAuditEventsStub        func([]cfclient.Event) error
+	InitAlertCursorStub        func(string) (int64, error)
+	initAlertCursorMutex       sync.RWMutex
+	initAlertCursorArgsForCall []struct {
+		arg1 string
+	}
+	initAlertCursorReturns struct {
+		result1 int64
+		result2 error
+	}
+	initAlertCursorReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	ReleaseLeaderLeaseStub        func(*db.Lease) error
+	releaseLeaderLeaseMutex       sync.RWMutex
+	releaseLeaderLeaseArgsForCall []struct {
+		arg1 *db.Lease
+	}
+	releaseLeaderLeaseReturns struct {
+		result1 error
+	}
+	releaseLeaderLeaseReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RemoveCFAuditEventPartitionStub        func(db.Partition, string) (db.PartitionRemoval, error)
+	removeCFAuditEventPartitionMutex       sync.RWMutex
+	removeCFAuditEventPartitionArgsForCall []struct {
+		arg1 db.Partition
+		arg2 string
+	}
+	removeCFAuditEventPartitionReturns struct {
+		result1 db.PartitionRemoval
+		result2 error
+	}
+	removeCFAuditEventPartitionReturnsOnCall map[int]struct {
+		result1 db.PartitionRemoval
+		result2 error
+	}
+	RestoreCFAuditEventsStub        func(string, []cfclient.Event, map[string]db.EventNames) (int, error)
+	restoreCFAuditEventsMutex       sync.RWMutex
+	restoreCFAuditEventsArgsForCall []struct {
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
+	}
+	restoreCFAuditEventsReturns struct {
+		result1 int
+		result2 error
+	}
+	restoreCFAuditEventsReturnsOnCall map[int]struct {
+		result1 int
+		result2 error
+	}
+	StoreAlertDeliveryStub        func(db.AlertDelivery) error
+	storeAlertDeliveryMutex       sync.RWMutex
+	storeAlertDeliveryArgsForCall []struct {
+		arg1 db.AlertDelivery
+	}
+	storeAlertDeliveryReturns struct {
+		result1 error
+	}
+	storeAlertDeliveryReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StoreAlertsStub        func(string, []db.Alert, db.CFAuditEvent) ([]db.Alert, error)
+	storeAlertsMutex       sync.RWMutex
+	storeAlertsArgsForCall []struct {
+		arg1 string
+		arg2 []db.Alert
+		arg3 db.CFAuditEvent
+	}
+	storeAlertsReturns struct {
+		result1 []db.Alert
+		result2 error
+	}
+	storeAlertsReturnsOnCall map[int]struct {
+		result1 []db.Alert
+		result2 error
+	}
+	StoreCFAuditEventArchiveStub        func(db.CFAuditEventArchive) error
+	storeCFAuditEventArchiveMutex       sync.RWMutex
+	storeCFAuditEventArchiveArgsForCall []struct {
+		arg1 db.CFAuditEventArchive
+	}
+	storeCFAuditEventArchiveReturns struct {
+		result1 error
+	}
+	storeCFAuditEventArchiveReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StoreCFAuditEventsStub        func(string, []cfclient.Event, map[string]db.EventNames) (int, error)
 	storeCFAuditEventsMutex       sync.RWMutex
 	storeCFAuditEventsArgsForCall []struct {
-		arg1 []cfclient.Event
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
 	}
 	storeCFAuditEventsReturns struct {
-		result1 error
+		result1 int
+		result2 error
 	}
 	storeCFAuditEventsReturnsOnCall map[int]struct {
+		result1 int
+		result2 error
+	}
+	StoreChainCheckpointStub        func(db.ChainCheckpoint) error
+	storeChainCheckpointMutex       sync.RWMutex
+	storeChainCheckpointArgsForCall []struct {
+		arg1 db.ChainCheckpoint
+	}
+	storeChainCheckpointReturns struct {
+		result1 error
+	}
+	storeChainCheckpointReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StoreResourceNamesStub        func([]db.ResourceName) error
+	storeResourceNamesMutex       sync.RWMutex
+	storeResourceNamesArgsForCall []struct {
+		arg1 []db.ResourceName
+	}
+	storeResourceNamesReturns struct {
+		result1 error
+	}
+	storeResourceNamesReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StreamCFAuditEventsStub        func(context.Context, db.RawEventFilter, func(db.CFAuditEvent) error) error
+	streamCFAuditEventsMutex       sync.RWMutex
+	streamCFAuditEventsArgsForCall []struct {
+		arg1 context.Context
+		arg2 db.RawEventFilter
+		arg3 func(db.CFAuditEvent) error
+	}
+	streamCFAuditEventsReturns struct {
 		result1 error
 	}
-	UpdateShipperCursorStub        func(string, string, string) error
+	streamCFAuditEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StreamUnevaluatedCFAuditEventsStub        func(context.Context, string, func(db.CFAuditEvent) error) error
+	streamUnevaluatedCFAuditEventsMutex       sync.RWMutex
+	streamUnevaluatedCFAuditEventsArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 func(db.CFAuditEvent) error
+	}
+	streamUnevaluatedCFAuditEventsReturns struct {
+		result1 error
+	}
+	streamUnevaluatedCFAuditEventsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateArchiveCursorStub        func(int64) error
+	updateArchiveCursorMutex       sync.RWMutex
+	updateArchiveCursorArgsForCall []struct {
+		arg1 int64
+	}
+	updateArchiveCursorReturns struct {
+		result1 error
+	}
+	updateArchiveCursorReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateBackfillWindowStub        func(db.BackfillWindow) error
+	updateBackfillWindowMutex       sync.RWMutex
+	updateBackfillWindowArgsForCall []struct {
+		arg1 db.BackfillWindow
+	}
+	updateBackfillWindowReturns struct {
+		result1 error
+	}
+	updateBackfillWindowReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UpdateShipperCursorStub        func(string, db.CFAuditEvent) error
 	updateShipperCursorMutex       sync.RWMutex
 	updateShipperCursorArgsForCall []struct {
 		arg1 string
-		arg2 string
-		arg3 string
+		arg2 db.CFAuditEvent
 	}
 	updateShipperCursorReturns struct {
 		result1 error
@@ -98,371 +566,2604 @@ type FakeEventDB struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeEventDB) GetCFAuditEvents(arg1 db.RawEventFilter) ([]cfclient.Event, error) {
-	fake.getCFAuditEventsMutex.Lock()
-	ret, specificReturn := fake.getCFAuditEventsReturnsOnCall[len(fake.getCFAuditEventsArgsForCall)]
-	fake.getCFAuditEventsArgsForCall = append(fake.getCFAuditEventsArgsForCall, struct {
-		arg1 db.RawEventFilter
-	}{arg1})
-	fake.recordInvocation("GetCFAuditEvents", []interface{}{arg1})
-	fake.getCFAuditEventsMutex.Unlock()
-	if fake.GetCFAuditEventsStub != nil {
-		return fake.GetCFAuditEventsStub(arg1)
+func (fake *FakeEventDB) AcquireLeaderLease(arg1 *db.Lease, arg2 time.Duration) (bool, error) {
+	fake.acquireLeaderLeaseMutex.Lock()
+	ret, specificReturn := fake.acquireLeaderLeaseReturnsOnCall[len(fake.acquireLeaderLeaseArgsForCall)]
+	fake.acquireLeaderLeaseArgsForCall = append(fake.acquireLeaderLeaseArgsForCall, struct {
+		arg1 *db.Lease
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.recordInvocation("AcquireLeaderLease", []interface{}{arg1, arg2})
+	fake.acquireLeaderLeaseMutex.Unlock()
+	if fake.AcquireLeaderLeaseStub != nil {
+		return fake.AcquireLeaderLeaseStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.acquireLeaderLeaseReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) AcquireLeaderLeaseCallCount() int {
+	fake.acquireLeaderLeaseMutex.RLock()
+	defer fake.acquireLeaderLeaseMutex.RUnlock()
+	return len(fake.acquireLeaderLeaseArgsForCall)
+}
+
+func (fake *FakeEventDB) AcquireLeaderLeaseCalls(stub func(*db.Lease, time.Duration) (bool, error)) {
+	fake.acquireLeaderLeaseMutex.Lock()
+	defer fake.acquireLeaderLeaseMutex.Unlock()
+	fake.AcquireLeaderLeaseStub = stub
+}
+
+func (fake *FakeEventDB) AcquireLeaderLeaseArgsForCall(i int) (*db.Lease, time.Duration) {
+	fake.acquireLeaderLeaseMutex.RLock()
+	defer fake.acquireLeaderLeaseMutex.RUnlock()
+	argsForCall := fake.acquireLeaderLeaseArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) AcquireLeaderLeaseReturns(result1 bool, result2 error) {
+	fake.acquireLeaderLeaseMutex.Lock()
+	defer fake.acquireLeaderLeaseMutex.Unlock()
+	fake.AcquireLeaderLeaseStub = nil
+	fake.acquireLeaderLeaseReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) AcquireLeaderLeaseReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.acquireLeaderLeaseMutex.Lock()
+	defer fake.acquireLeaderLeaseMutex.Unlock()
+	fake.AcquireLeaderLeaseStub = nil
+	if fake.acquireLeaderLeaseReturnsOnCall == nil {
+		fake.acquireLeaderLeaseReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.acquireLeaderLeaseReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEvents(arg1 string, arg2 []cfclient.Event, arg3 map[string]db.EventNames) (int, error) {
+	var arg2Copy []cfclient.Event
+	if arg2 != nil {
+		arg2Copy = make([]cfclient.Event, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.backfillCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.backfillCFAuditEventsReturnsOnCall[len(fake.backfillCFAuditEventsArgsForCall)]
+	fake.backfillCFAuditEventsArgsForCall = append(fake.backfillCFAuditEventsArgsForCall, struct {
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
+	}{arg1, arg2Copy, arg3})
+	fake.recordInvocation("BackfillCFAuditEvents", []interface{}{arg1, arg2Copy, arg3})
+	fake.backfillCFAuditEventsMutex.Unlock()
+	if fake.BackfillCFAuditEventsStub != nil {
+		return fake.BackfillCFAuditEventsStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.backfillCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEventsCallCount() int {
+	fake.backfillCFAuditEventsMutex.RLock()
+	defer fake.backfillCFAuditEventsMutex.RUnlock()
+	return len(fake.backfillCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEventsCalls(stub func(string, []cfclient.Event, map[string]db.EventNames) (int, error)) {
+	fake.backfillCFAuditEventsMutex.Lock()
+	defer fake.backfillCFAuditEventsMutex.Unlock()
+	fake.BackfillCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEventsArgsForCall(i int) (string, []cfclient.Event, map[string]db.EventNames) {
+	fake.backfillCFAuditEventsMutex.RLock()
+	defer fake.backfillCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.backfillCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEventsReturns(result1 int, result2 error) {
+	fake.backfillCFAuditEventsMutex.Lock()
+	defer fake.backfillCFAuditEventsMutex.Unlock()
+	fake.BackfillCFAuditEventsStub = nil
+	fake.backfillCFAuditEventsReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) BackfillCFAuditEventsReturnsOnCall(i int, result1 int, result2 error) {
+	fake.backfillCFAuditEventsMutex.Lock()
+	defer fake.backfillCFAuditEventsMutex.Unlock()
+	fake.BackfillCFAuditEventsStub = nil
+	if fake.backfillCFAuditEventsReturnsOnCall == nil {
+		fake.backfillCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 int
+			result2 error
+		})
+	}
+	fake.backfillCFAuditEventsReturnsOnCall[i] = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEvents(arg1 db.Partition) (int64, error) {
+	fake.countUnarchivedCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.countUnarchivedCFAuditEventsReturnsOnCall[len(fake.countUnarchivedCFAuditEventsArgsForCall)]
+	fake.countUnarchivedCFAuditEventsArgsForCall = append(fake.countUnarchivedCFAuditEventsArgsForCall, struct {
+		arg1 db.Partition
+	}{arg1})
+	fake.recordInvocation("CountUnarchivedCFAuditEvents", []interface{}{arg1})
+	fake.countUnarchivedCFAuditEventsMutex.Unlock()
+	if fake.CountUnarchivedCFAuditEventsStub != nil {
+		return fake.CountUnarchivedCFAuditEventsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.countUnarchivedCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEventsCallCount() int {
+	fake.countUnarchivedCFAuditEventsMutex.RLock()
+	defer fake.countUnarchivedCFAuditEventsMutex.RUnlock()
+	return len(fake.countUnarchivedCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEventsCalls(stub func(db.Partition) (int64, error)) {
+	fake.countUnarchivedCFAuditEventsMutex.Lock()
+	defer fake.countUnarchivedCFAuditEventsMutex.Unlock()
+	fake.CountUnarchivedCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEventsArgsForCall(i int) db.Partition {
+	fake.countUnarchivedCFAuditEventsMutex.RLock()
+	defer fake.countUnarchivedCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.countUnarchivedCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEventsReturns(result1 int64, result2 error) {
+	fake.countUnarchivedCFAuditEventsMutex.Lock()
+	defer fake.countUnarchivedCFAuditEventsMutex.Unlock()
+	fake.CountUnarchivedCFAuditEventsStub = nil
+	fake.countUnarchivedCFAuditEventsReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) CountUnarchivedCFAuditEventsReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.countUnarchivedCFAuditEventsMutex.Lock()
+	defer fake.countUnarchivedCFAuditEventsMutex.Unlock()
+	fake.CountUnarchivedCFAuditEventsStub = nil
+	if fake.countUnarchivedCFAuditEventsReturnsOnCall == nil {
+		fake.countUnarchivedCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.countUnarchivedCFAuditEventsReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) CreateBackfillJob(arg1 db.BackfillJob, arg2 []db.BackfillWindow) (db.BackfillJob, error) {
+	var arg2Copy []db.BackfillWindow
+	if arg2 != nil {
+		arg2Copy = make([]db.BackfillWindow, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.createBackfillJobMutex.Lock()
+	ret, specificReturn := fake.createBackfillJobReturnsOnCall[len(fake.createBackfillJobArgsForCall)]
+	fake.createBackfillJobArgsForCall = append(fake.createBackfillJobArgsForCall, struct {
+		arg1 db.BackfillJob
+		arg2 []db.BackfillWindow
+	}{arg1, arg2Copy})
+	fake.recordInvocation("CreateBackfillJob", []interface{}{arg1, arg2Copy})
+	fake.createBackfillJobMutex.Unlock()
+	if fake.CreateBackfillJobStub != nil {
+		return fake.CreateBackfillJobStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.createBackfillJobReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) CreateBackfillJobCallCount() int {
+	fake.createBackfillJobMutex.RLock()
+	defer fake.createBackfillJobMutex.RUnlock()
+	return len(fake.createBackfillJobArgsForCall)
+}
+
+func (fake *FakeEventDB) CreateBackfillJobCalls(stub func(db.BackfillJob, []db.BackfillWindow) (db.BackfillJob, error)) {
+	fake.createBackfillJobMutex.Lock()
+	defer fake.createBackfillJobMutex.Unlock()
+	fake.CreateBackfillJobStub = stub
+}
+
+func (fake *FakeEventDB) CreateBackfillJobArgsForCall(i int) (db.BackfillJob, []db.BackfillWindow) {
+	fake.createBackfillJobMutex.RLock()
+	defer fake.createBackfillJobMutex.RUnlock()
+	argsForCall := fake.createBackfillJobArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) CreateBackfillJobReturns(result1 db.BackfillJob, result2 error) {
+	fake.createBackfillJobMutex.Lock()
+	defer fake.createBackfillJobMutex.Unlock()
+	fake.CreateBackfillJobStub = nil
+	fake.createBackfillJobReturns = struct {
+		result1 db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) CreateBackfillJobReturnsOnCall(i int, result1 db.BackfillJob, result2 error) {
+	fake.createBackfillJobMutex.Lock()
+	defer fake.createBackfillJobMutex.Unlock()
+	fake.CreateBackfillJobStub = nil
+	if fake.createBackfillJobReturnsOnCall == nil {
+		fake.createBackfillJobReturnsOnCall = make(map[int]struct {
+			result1 db.BackfillJob
+			result2 error
+		})
+	}
+	fake.createBackfillJobReturnsOnCall[i] = struct {
+		result1 db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEvents(arg1 db.CFAuditEventArchive) (int64, error) {
+	fake.deleteArchivedCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.deleteArchivedCFAuditEventsReturnsOnCall[len(fake.deleteArchivedCFAuditEventsArgsForCall)]
+	fake.deleteArchivedCFAuditEventsArgsForCall = append(fake.deleteArchivedCFAuditEventsArgsForCall, struct {
+		arg1 db.CFAuditEventArchive
+	}{arg1})
+	fake.recordInvocation("DeleteArchivedCFAuditEvents", []interface{}{arg1})
+	fake.deleteArchivedCFAuditEventsMutex.Unlock()
+	if fake.DeleteArchivedCFAuditEventsStub != nil {
+		return fake.DeleteArchivedCFAuditEventsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.deleteArchivedCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEventsCallCount() int {
+	fake.deleteArchivedCFAuditEventsMutex.RLock()
+	defer fake.deleteArchivedCFAuditEventsMutex.RUnlock()
+	return len(fake.deleteArchivedCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEventsCalls(stub func(db.CFAuditEventArchive) (int64, error)) {
+	fake.deleteArchivedCFAuditEventsMutex.Lock()
+	defer fake.deleteArchivedCFAuditEventsMutex.Unlock()
+	fake.DeleteArchivedCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEventsArgsForCall(i int) db.CFAuditEventArchive {
+	fake.deleteArchivedCFAuditEventsMutex.RLock()
+	defer fake.deleteArchivedCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.deleteArchivedCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEventsReturns(result1 int64, result2 error) {
+	fake.deleteArchivedCFAuditEventsMutex.Lock()
+	defer fake.deleteArchivedCFAuditEventsMutex.Unlock()
+	fake.DeleteArchivedCFAuditEventsStub = nil
+	fake.deleteArchivedCFAuditEventsReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) DeleteArchivedCFAuditEventsReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.deleteArchivedCFAuditEventsMutex.Lock()
+	defer fake.deleteArchivedCFAuditEventsMutex.Unlock()
+	fake.DeleteArchivedCFAuditEventsStub = nil
+	if fake.deleteArchivedCFAuditEventsReturnsOnCall == nil {
+		fake.deleteArchivedCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.deleteArchivedCFAuditEventsReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartition(arg1 time.Time) (bool, error) {
+	fake.ensureCFAuditEventPartitionMutex.Lock()
+	ret, specificReturn := fake.ensureCFAuditEventPartitionReturnsOnCall[len(fake.ensureCFAuditEventPartitionArgsForCall)]
+	fake.ensureCFAuditEventPartitionArgsForCall = append(fake.ensureCFAuditEventPartitionArgsForCall, struct {
+		arg1 time.Time
+	}{arg1})
+	fake.recordInvocation("EnsureCFAuditEventPartition", []interface{}{arg1})
+	fake.ensureCFAuditEventPartitionMutex.Unlock()
+	if fake.EnsureCFAuditEventPartitionStub != nil {
+		return fake.EnsureCFAuditEventPartitionStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.ensureCFAuditEventPartitionReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartitionCallCount() int {
+	fake.ensureCFAuditEventPartitionMutex.RLock()
+	defer fake.ensureCFAuditEventPartitionMutex.RUnlock()
+	return len(fake.ensureCFAuditEventPartitionArgsForCall)
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartitionCalls(stub func(time.Time) (bool, error)) {
+	fake.ensureCFAuditEventPartitionMutex.Lock()
+	defer fake.ensureCFAuditEventPartitionMutex.Unlock()
+	fake.EnsureCFAuditEventPartitionStub = stub
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartitionArgsForCall(i int) time.Time {
+	fake.ensureCFAuditEventPartitionMutex.RLock()
+	defer fake.ensureCFAuditEventPartitionMutex.RUnlock()
+	argsForCall := fake.ensureCFAuditEventPartitionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartitionReturns(result1 bool, result2 error) {
+	fake.ensureCFAuditEventPartitionMutex.Lock()
+	defer fake.ensureCFAuditEventPartitionMutex.Unlock()
+	fake.EnsureCFAuditEventPartitionStub = nil
+	fake.ensureCFAuditEventPartitionReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) EnsureCFAuditEventPartitionReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.ensureCFAuditEventPartitionMutex.Lock()
+	defer fake.ensureCFAuditEventPartitionMutex.Unlock()
+	fake.EnsureCFAuditEventPartitionStub = nil
+	if fake.ensureCFAuditEventPartitionReturnsOnCall == nil {
+		fake.ensureCFAuditEventPartitionReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.ensureCFAuditEventPartitionReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEvents(arg1 db.ErasureRequest) (db.Erasure, error) {
+	fake.eraseUserFromCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.eraseUserFromCFAuditEventsReturnsOnCall[len(fake.eraseUserFromCFAuditEventsArgsForCall)]
+	fake.eraseUserFromCFAuditEventsArgsForCall = append(fake.eraseUserFromCFAuditEventsArgsForCall, struct {
+		arg1 db.ErasureRequest
+	}{arg1})
+	fake.recordInvocation("EraseUserFromCFAuditEvents", []interface{}{arg1})
+	fake.eraseUserFromCFAuditEventsMutex.Unlock()
+	if fake.EraseUserFromCFAuditEventsStub != nil {
+		return fake.EraseUserFromCFAuditEventsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.eraseUserFromCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEventsCallCount() int {
+	fake.eraseUserFromCFAuditEventsMutex.RLock()
+	defer fake.eraseUserFromCFAuditEventsMutex.RUnlock()
+	return len(fake.eraseUserFromCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEventsCalls(stub func(db.ErasureRequest) (db.Erasure, error)) {
+	fake.eraseUserFromCFAuditEventsMutex.Lock()
+	defer fake.eraseUserFromCFAuditEventsMutex.Unlock()
+	fake.EraseUserFromCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEventsArgsForCall(i int) db.ErasureRequest {
+	fake.eraseUserFromCFAuditEventsMutex.RLock()
+	defer fake.eraseUserFromCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.eraseUserFromCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEventsReturns(result1 db.Erasure, result2 error) {
+	fake.eraseUserFromCFAuditEventsMutex.Lock()
+	defer fake.eraseUserFromCFAuditEventsMutex.Unlock()
+	fake.EraseUserFromCFAuditEventsStub = nil
+	fake.eraseUserFromCFAuditEventsReturns = struct {
+		result1 db.Erasure
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) EraseUserFromCFAuditEventsReturnsOnCall(i int, result1 db.Erasure, result2 error) {
+	fake.eraseUserFromCFAuditEventsMutex.Lock()
+	defer fake.eraseUserFromCFAuditEventsMutex.Unlock()
+	fake.EraseUserFromCFAuditEventsStub = nil
+	if fake.eraseUserFromCFAuditEventsReturnsOnCall == nil {
+		fake.eraseUserFromCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 db.Erasure
+			result2 error
+		})
+	}
+	fake.eraseUserFromCFAuditEventsReturnsOnCall[i] = struct {
+		result1 db.Erasure
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillJob(arg1 string) (*db.BackfillJob, error) {
+	fake.getBackfillJobMutex.Lock()
+	ret, specificReturn := fake.getBackfillJobReturnsOnCall[len(fake.getBackfillJobArgsForCall)]
+	fake.getBackfillJobArgsForCall = append(fake.getBackfillJobArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("GetBackfillJob", []interface{}{arg1})
+	fake.getBackfillJobMutex.Unlock()
+	if fake.GetBackfillJobStub != nil {
+		return fake.GetBackfillJobStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getBackfillJobReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetBackfillJobCallCount() int {
+	fake.getBackfillJobMutex.RLock()
+	defer fake.getBackfillJobMutex.RUnlock()
+	return len(fake.getBackfillJobArgsForCall)
+}
+
+func (fake *FakeEventDB) GetBackfillJobCalls(stub func(string) (*db.BackfillJob, error)) {
+	fake.getBackfillJobMutex.Lock()
+	defer fake.getBackfillJobMutex.Unlock()
+	fake.GetBackfillJobStub = stub
+}
+
+func (fake *FakeEventDB) GetBackfillJobArgsForCall(i int) string {
+	fake.getBackfillJobMutex.RLock()
+	defer fake.getBackfillJobMutex.RUnlock()
+	argsForCall := fake.getBackfillJobArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetBackfillJobReturns(result1 *db.BackfillJob, result2 error) {
+	fake.getBackfillJobMutex.Lock()
+	defer fake.getBackfillJobMutex.Unlock()
+	fake.GetBackfillJobStub = nil
+	fake.getBackfillJobReturns = struct {
+		result1 *db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillJobReturnsOnCall(i int, result1 *db.BackfillJob, result2 error) {
+	fake.getBackfillJobMutex.Lock()
+	defer fake.getBackfillJobMutex.Unlock()
+	fake.GetBackfillJobStub = nil
+	if fake.getBackfillJobReturnsOnCall == nil {
+		fake.getBackfillJobReturnsOnCall = make(map[int]struct {
+			result1 *db.BackfillJob
+			result2 error
+		})
+	}
+	fake.getBackfillJobReturnsOnCall[i] = struct {
+		result1 *db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillJobs() ([]db.BackfillJob, error) {
+	fake.getBackfillJobsMutex.Lock()
+	ret, specificReturn := fake.getBackfillJobsReturnsOnCall[len(fake.getBackfillJobsArgsForCall)]
+	fake.getBackfillJobsArgsForCall = append(fake.getBackfillJobsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetBackfillJobs", []interface{}{})
+	fake.getBackfillJobsMutex.Unlock()
+	if fake.GetBackfillJobsStub != nil {
+		return fake.GetBackfillJobsStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getBackfillJobsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetBackfillJobsCallCount() int {
+	fake.getBackfillJobsMutex.RLock()
+	defer fake.getBackfillJobsMutex.RUnlock()
+	return len(fake.getBackfillJobsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetBackfillJobsCalls(stub func() ([]db.BackfillJob, error)) {
+	fake.getBackfillJobsMutex.Lock()
+	defer fake.getBackfillJobsMutex.Unlock()
+	fake.GetBackfillJobsStub = stub
+}
+
+func (fake *FakeEventDB) GetBackfillJobsReturns(result1 []db.BackfillJob, result2 error) {
+	fake.getBackfillJobsMutex.Lock()
+	defer fake.getBackfillJobsMutex.Unlock()
+	fake.GetBackfillJobsStub = nil
+	fake.getBackfillJobsReturns = struct {
+		result1 []db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillJobsReturnsOnCall(i int, result1 []db.BackfillJob, result2 error) {
+	fake.getBackfillJobsMutex.Lock()
+	defer fake.getBackfillJobsMutex.Unlock()
+	fake.GetBackfillJobsStub = nil
+	if fake.getBackfillJobsReturnsOnCall == nil {
+		fake.getBackfillJobsReturnsOnCall = make(map[int]struct {
+			result1 []db.BackfillJob
+			result2 error
+		})
+	}
+	fake.getBackfillJobsReturnsOnCall[i] = struct {
+		result1 []db.BackfillJob
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillWindows(arg1 string) ([]db.BackfillWindow, error) {
+	fake.getBackfillWindowsMutex.Lock()
+	ret, specificReturn := fake.getBackfillWindowsReturnsOnCall[len(fake.getBackfillWindowsArgsForCall)]
+	fake.getBackfillWindowsArgsForCall = append(fake.getBackfillWindowsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("GetBackfillWindows", []interface{}{arg1})
+	fake.getBackfillWindowsMutex.Unlock()
+	if fake.GetBackfillWindowsStub != nil {
+		return fake.GetBackfillWindowsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getBackfillWindowsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetBackfillWindowsCallCount() int {
+	fake.getBackfillWindowsMutex.RLock()
+	defer fake.getBackfillWindowsMutex.RUnlock()
+	return len(fake.getBackfillWindowsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetBackfillWindowsCalls(stub func(string) ([]db.BackfillWindow, error)) {
+	fake.getBackfillWindowsMutex.Lock()
+	defer fake.getBackfillWindowsMutex.Unlock()
+	fake.GetBackfillWindowsStub = stub
+}
+
+func (fake *FakeEventDB) GetBackfillWindowsArgsForCall(i int) string {
+	fake.getBackfillWindowsMutex.RLock()
+	defer fake.getBackfillWindowsMutex.RUnlock()
+	argsForCall := fake.getBackfillWindowsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetBackfillWindowsReturns(result1 []db.BackfillWindow, result2 error) {
+	fake.getBackfillWindowsMutex.Lock()
+	defer fake.getBackfillWindowsMutex.Unlock()
+	fake.GetBackfillWindowsStub = nil
+	fake.getBackfillWindowsReturns = struct {
+		result1 []db.BackfillWindow
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetBackfillWindowsReturnsOnCall(i int, result1 []db.BackfillWindow, result2 error) {
+	fake.getBackfillWindowsMutex.Lock()
+	defer fake.getBackfillWindowsMutex.Unlock()
+	fake.GetBackfillWindowsStub = nil
+	if fake.getBackfillWindowsReturnsOnCall == nil {
+		fake.getBackfillWindowsReturnsOnCall = make(map[int]struct {
+			result1 []db.BackfillWindow
+			result2 error
+		})
+	}
+	fake.getBackfillWindowsReturnsOnCall[i] = struct {
+		result1 []db.BackfillWindow
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchives() ([]db.CFAuditEventArchive, error) {
+	fake.getCFAuditEventArchivesMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventArchivesReturnsOnCall[len(fake.getCFAuditEventArchivesArgsForCall)]
+	fake.getCFAuditEventArchivesArgsForCall = append(fake.getCFAuditEventArchivesArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetCFAuditEventArchives", []interface{}{})
+	fake.getCFAuditEventArchivesMutex.Unlock()
+	if fake.GetCFAuditEventArchivesStub != nil {
+		return fake.GetCFAuditEventArchivesStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFAuditEventArchivesReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesCallCount() int {
+	fake.getCFAuditEventArchivesMutex.RLock()
+	defer fake.getCFAuditEventArchivesMutex.RUnlock()
+	return len(fake.getCFAuditEventArchivesArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesCalls(stub func() ([]db.CFAuditEventArchive, error)) {
+	fake.getCFAuditEventArchivesMutex.Lock()
+	defer fake.getCFAuditEventArchivesMutex.Unlock()
+	fake.GetCFAuditEventArchivesStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesReturns(result1 []db.CFAuditEventArchive, result2 error) {
+	fake.getCFAuditEventArchivesMutex.Lock()
+	defer fake.getCFAuditEventArchivesMutex.Unlock()
+	fake.GetCFAuditEventArchivesStub = nil
+	fake.getCFAuditEventArchivesReturns = struct {
+		result1 []db.CFAuditEventArchive
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesReturnsOnCall(i int, result1 []db.CFAuditEventArchive, result2 error) {
+	fake.getCFAuditEventArchivesMutex.Lock()
+	defer fake.getCFAuditEventArchivesMutex.Unlock()
+	fake.GetCFAuditEventArchivesStub = nil
+	if fake.getCFAuditEventArchivesReturnsOnCall == nil {
+		fake.getCFAuditEventArchivesReturnsOnCall = make(map[int]struct {
+			result1 []db.CFAuditEventArchive
+			result2 error
+		})
+	}
+	fake.getCFAuditEventArchivesReturnsOnCall[i] = struct {
+		result1 []db.CFAuditEventArchive
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEvents(arg1 int64) ([]db.CFAuditEventArchive, int64, error) {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventArchivesWithLateEventsReturnsOnCall[len(fake.getCFAuditEventArchivesWithLateEventsArgsForCall)]
+	fake.getCFAuditEventArchivesWithLateEventsArgsForCall = append(fake.getCFAuditEventArchivesWithLateEventsArgsForCall, struct {
+		arg1 int64
+	}{arg1})
+	fake.recordInvocation("GetCFAuditEventArchivesWithLateEvents", []interface{}{arg1})
+	fake.getCFAuditEventArchivesWithLateEventsMutex.Unlock()
+	if fake.GetCFAuditEventArchivesWithLateEventsStub != nil {
+		return fake.GetCFAuditEventArchivesWithLateEventsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	fakeReturns := fake.getCFAuditEventArchivesWithLateEventsReturns
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEventsCallCount() int {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.RLock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.RUnlock()
+	return len(fake.getCFAuditEventArchivesWithLateEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEventsCalls(stub func(int64) ([]db.CFAuditEventArchive, int64, error)) {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.Lock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.Unlock()
+	fake.GetCFAuditEventArchivesWithLateEventsStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEventsArgsForCall(i int) int64 {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.RLock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.RUnlock()
+	argsForCall := fake.getCFAuditEventArchivesWithLateEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEventsReturns(result1 []db.CFAuditEventArchive, result2 int64, result3 error) {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.Lock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.Unlock()
+	fake.GetCFAuditEventArchivesWithLateEventsStub = nil
+	fake.getCFAuditEventArchivesWithLateEventsReturns = struct {
+		result1 []db.CFAuditEventArchive
+		result2 int64
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventArchivesWithLateEventsReturnsOnCall(i int, result1 []db.CFAuditEventArchive, result2 int64, result3 error) {
+	fake.getCFAuditEventArchivesWithLateEventsMutex.Lock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.Unlock()
+	fake.GetCFAuditEventArchivesWithLateEventsStub = nil
+	if fake.getCFAuditEventArchivesWithLateEventsReturnsOnCall == nil {
+		fake.getCFAuditEventArchivesWithLateEventsReturnsOnCall = make(map[int]struct {
+			result1 []db.CFAuditEventArchive
+			result2 int64
+			result3 error
+		})
+	}
+	fake.getCFAuditEventArchivesWithLateEventsReturnsOnCall[i] = struct {
+		result1 []db.CFAuditEventArchive
+		result2 int64
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventErasures() ([]db.Erasure, error) {
+	fake.getCFAuditEventErasuresMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventErasuresReturnsOnCall[len(fake.getCFAuditEventErasuresArgsForCall)]
+	fake.getCFAuditEventErasuresArgsForCall = append(fake.getCFAuditEventErasuresArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetCFAuditEventErasures", []interface{}{})
+	fake.getCFAuditEventErasuresMutex.Unlock()
+	if fake.GetCFAuditEventErasuresStub != nil {
+		return fake.GetCFAuditEventErasuresStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFAuditEventErasuresReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFAuditEventErasuresCallCount() int {
+	fake.getCFAuditEventErasuresMutex.RLock()
+	defer fake.getCFAuditEventErasuresMutex.RUnlock()
+	return len(fake.getCFAuditEventErasuresArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventErasuresCalls(stub func() ([]db.Erasure, error)) {
+	fake.getCFAuditEventErasuresMutex.Lock()
+	defer fake.getCFAuditEventErasuresMutex.Unlock()
+	fake.GetCFAuditEventErasuresStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventErasuresReturns(result1 []db.Erasure, result2 error) {
+	fake.getCFAuditEventErasuresMutex.Lock()
+	defer fake.getCFAuditEventErasuresMutex.Unlock()
+	fake.GetCFAuditEventErasuresStub = nil
+	fake.getCFAuditEventErasuresReturns = struct {
+		result1 []db.Erasure
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventErasuresReturnsOnCall(i int, result1 []db.Erasure, result2 error) {
+	fake.getCFAuditEventErasuresMutex.Lock()
+	defer fake.getCFAuditEventErasuresMutex.Unlock()
+	fake.GetCFAuditEventErasuresStub = nil
+	if fake.getCFAuditEventErasuresReturnsOnCall == nil {
+		fake.getCFAuditEventErasuresReturnsOnCall = make(map[int]struct {
+			result1 []db.Erasure
+			result2 error
+		})
+	}
+	fake.getCFAuditEventErasuresReturnsOnCall[i] = struct {
+		result1 []db.Erasure
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionHolds() ([]db.PartitionHold, error) {
+	fake.getCFAuditEventPartitionHoldsMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventPartitionHoldsReturnsOnCall[len(fake.getCFAuditEventPartitionHoldsArgsForCall)]
+	fake.getCFAuditEventPartitionHoldsArgsForCall = append(fake.getCFAuditEventPartitionHoldsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetCFAuditEventPartitionHolds", []interface{}{})
+	fake.getCFAuditEventPartitionHoldsMutex.Unlock()
+	if fake.GetCFAuditEventPartitionHoldsStub != nil {
+		return fake.GetCFAuditEventPartitionHoldsStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFAuditEventPartitionHoldsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionHoldsCallCount() int {
+	fake.getCFAuditEventPartitionHoldsMutex.RLock()
+	defer fake.getCFAuditEventPartitionHoldsMutex.RUnlock()
+	return len(fake.getCFAuditEventPartitionHoldsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionHoldsCalls(stub func() ([]db.PartitionHold, error)) {
+	fake.getCFAuditEventPartitionHoldsMutex.Lock()
+	defer fake.getCFAuditEventPartitionHoldsMutex.Unlock()
+	fake.GetCFAuditEventPartitionHoldsStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionHoldsReturns(result1 []db.PartitionHold, result2 error) {
+	fake.getCFAuditEventPartitionHoldsMutex.Lock()
+	defer fake.getCFAuditEventPartitionHoldsMutex.Unlock()
+	fake.GetCFAuditEventPartitionHoldsStub = nil
+	fake.getCFAuditEventPartitionHoldsReturns = struct {
+		result1 []db.PartitionHold
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionHoldsReturnsOnCall(i int, result1 []db.PartitionHold, result2 error) {
+	fake.getCFAuditEventPartitionHoldsMutex.Lock()
+	defer fake.getCFAuditEventPartitionHoldsMutex.Unlock()
+	fake.GetCFAuditEventPartitionHoldsStub = nil
+	if fake.getCFAuditEventPartitionHoldsReturnsOnCall == nil {
+		fake.getCFAuditEventPartitionHoldsReturnsOnCall = make(map[int]struct {
+			result1 []db.PartitionHold
+			result2 error
+		})
+	}
+	fake.getCFAuditEventPartitionHoldsReturnsOnCall[i] = struct {
+		result1 []db.PartitionHold
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitions() ([]db.Partition, error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventPartitionsReturnsOnCall[len(fake.getCFAuditEventPartitionsArgsForCall)]
+	fake.getCFAuditEventPartitionsArgsForCall = append(fake.getCFAuditEventPartitionsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetCFAuditEventPartitions", []interface{}{})
+	fake.getCFAuditEventPartitionsMutex.Unlock()
+	if fake.GetCFAuditEventPartitionsStub != nil {
+		return fake.GetCFAuditEventPartitionsStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFAuditEventPartitionsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionsCallCount() int {
+	fake.getCFAuditEventPartitionsMutex.RLock()
+	defer fake.getCFAuditEventPartitionsMutex.RUnlock()
+	return len(fake.getCFAuditEventPartitionsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionsCalls(stub func() ([]db.Partition, error)) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionsReturns(result1 []db.Partition, result2 error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = nil
+	fake.getCFAuditEventPartitionsReturns = struct {
+		result1 []db.Partition
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventPartitionsReturnsOnCall(i int, result1 []db.Partition, result2 error) {
+	fake.getCFAuditEventPartitionsMutex.Lock()
+	defer fake.getCFAuditEventPartitionsMutex.Unlock()
+	fake.GetCFAuditEventPartitionsStub = nil
+	if fake.getCFAuditEventPartitionsReturnsOnCall == nil {
+		fake.getCFAuditEventPartitionsReturnsOnCall = make(map[int]struct {
+			result1 []db.Partition
+			result2 error
+		})
+	}
+	fake.getCFAuditEventPartitionsReturnsOnCall[i] = struct {
+		result1 []db.Partition
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEvents(arg1 db.RawEventFilter) ([]db.CFAuditEvent, error) {
+	fake.getCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.getCFAuditEventsReturnsOnCall[len(fake.getCFAuditEventsArgsForCall)]
+	fake.getCFAuditEventsArgsForCall = append(fake.getCFAuditEventsArgsForCall, struct {
+		arg1 db.RawEventFilter
+	}{arg1})
+	fake.recordInvocation("GetCFAuditEvents", []interface{}{arg1})
+	fake.getCFAuditEventsMutex.Unlock()
+	if fake.GetCFAuditEventsStub != nil {
+		return fake.GetCFAuditEventsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFAuditEventsCallCount() int {
+	fake.getCFAuditEventsMutex.RLock()
+	defer fake.getCFAuditEventsMutex.RUnlock()
+	return len(fake.getCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFAuditEventsCalls(stub func(db.RawEventFilter) ([]db.CFAuditEvent, error)) {
+	fake.getCFAuditEventsMutex.Lock()
+	defer fake.getCFAuditEventsMutex.Unlock()
+	fake.GetCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) GetCFAuditEventsArgsForCall(i int) db.RawEventFilter {
+	fake.getCFAuditEventsMutex.RLock()
+	defer fake.getCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.getCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetCFAuditEventsReturns(result1 []db.CFAuditEvent, result2 error) {
+	fake.getCFAuditEventsMutex.Lock()
+	defer fake.getCFAuditEventsMutex.Unlock()
+	fake.GetCFAuditEventsStub = nil
+	fake.getCFAuditEventsReturns = struct {
+		result1 []db.CFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFAuditEventsReturnsOnCall(i int, result1 []db.CFAuditEvent, result2 error) {
+	fake.getCFAuditEventsMutex.Lock()
+	defer fake.getCFAuditEventsMutex.Unlock()
+	fake.GetCFAuditEventsStub = nil
+	if fake.getCFAuditEventsReturnsOnCall == nil {
+		fake.getCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 []db.CFAuditEvent
+			result2 error
+		})
+	}
+	fake.getCFAuditEventsReturnsOnCall[i] = struct {
+		result1 []db.CFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFEventCounts() (map[string]int64, error) {
+	fake.getCFEventCountsMutex.Lock()
+	ret, specificReturn := fake.getCFEventCountsReturnsOnCall[len(fake.getCFEventCountsArgsForCall)]
+	fake.getCFEventCountsArgsForCall = append(fake.getCFEventCountsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetCFEventCounts", []interface{}{})
+	fake.getCFEventCountsMutex.Unlock()
+	if fake.GetCFEventCountsStub != nil {
+		return fake.GetCFEventCountsStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getCFEventCountsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetCFEventCountsCallCount() int {
+	fake.getCFEventCountsMutex.RLock()
+	defer fake.getCFEventCountsMutex.RUnlock()
+	return len(fake.getCFEventCountsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetCFEventCountsCalls(stub func() (map[string]int64, error)) {
+	fake.getCFEventCountsMutex.Lock()
+	defer fake.getCFEventCountsMutex.Unlock()
+	fake.GetCFEventCountsStub = stub
+}
+
+func (fake *FakeEventDB) GetCFEventCountsReturns(result1 map[string]int64, result2 error) {
+	fake.getCFEventCountsMutex.Lock()
+	defer fake.getCFEventCountsMutex.Unlock()
+	fake.GetCFEventCountsStub = nil
+	fake.getCFEventCountsReturns = struct {
+		result1 map[string]int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetCFEventCountsReturnsOnCall(i int, result1 map[string]int64, result2 error) {
+	fake.getCFEventCountsMutex.Lock()
+	defer fake.getCFEventCountsMutex.Unlock()
+	fake.GetCFEventCountsStub = nil
+	if fake.getCFEventCountsReturnsOnCall == nil {
+		fake.getCFEventCountsReturnsOnCall = make(map[int]struct {
+			result1 map[string]int64
+			result2 error
+		})
+	}
+	fake.getCFEventCountsReturnsOnCall[i] = struct {
+		result1 map[string]int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetChainHead() (db.ChainHead, error) {
+	fake.getChainHeadMutex.Lock()
+	ret, specificReturn := fake.getChainHeadReturnsOnCall[len(fake.getChainHeadArgsForCall)]
+	fake.getChainHeadArgsForCall = append(fake.getChainHeadArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetChainHead", []interface{}{})
+	fake.getChainHeadMutex.Unlock()
+	if fake.GetChainHeadStub != nil {
+		return fake.GetChainHeadStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getChainHeadReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetChainHeadCallCount() int {
+	fake.getChainHeadMutex.RLock()
+	defer fake.getChainHeadMutex.RUnlock()
+	return len(fake.getChainHeadArgsForCall)
+}
+
+func (fake *FakeEventDB) GetChainHeadCalls(stub func() (db.ChainHead, error)) {
+	fake.getChainHeadMutex.Lock()
+	defer fake.getChainHeadMutex.Unlock()
+	fake.GetChainHeadStub = stub
+}
+
+func (fake *FakeEventDB) GetChainHeadReturns(result1 db.ChainHead, result2 error) {
+	fake.getChainHeadMutex.Lock()
+	defer fake.getChainHeadMutex.Unlock()
+	fake.GetChainHeadStub = nil
+	fake.getChainHeadReturns = struct {
+		result1 db.ChainHead
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetChainHeadReturnsOnCall(i int, result1 db.ChainHead, result2 error) {
+	fake.getChainHeadMutex.Lock()
+	defer fake.getChainHeadMutex.Unlock()
+	fake.GetChainHeadStub = nil
+	if fake.getChainHeadReturnsOnCall == nil {
+		fake.getChainHeadReturnsOnCall = make(map[int]struct {
+			result1 db.ChainHead
+			result2 error
+		})
+	}
+	fake.getChainHeadReturnsOnCall[i] = struct {
+		result1 db.ChainHead
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetEarliestCFEventTime() (time.Time, error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	ret, specificReturn := fake.getEarliestCFEventTimeReturnsOnCall[len(fake.getEarliestCFEventTimeArgsForCall)]
+	fake.getEarliestCFEventTimeArgsForCall = append(fake.getEarliestCFEventTimeArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetEarliestCFEventTime", []interface{}{})
+	fake.getEarliestCFEventTimeMutex.Unlock()
+	if fake.GetEarliestCFEventTimeStub != nil {
+		return fake.GetEarliestCFEventTimeStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getEarliestCFEventTimeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetEarliestCFEventTimeCallCount() int {
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	return len(fake.getEarliestCFEventTimeArgsForCall)
+}
+
+func (fake *FakeEventDB) GetEarliestCFEventTimeCalls(stub func() (time.Time, error)) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = stub
+}
+
+func (fake *FakeEventDB) GetEarliestCFEventTimeReturns(result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	fake.getEarliestCFEventTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetEarliestCFEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getEarliestCFEventTimeMutex.Lock()
+	defer fake.getEarliestCFEventTimeMutex.Unlock()
+	fake.GetEarliestCFEventTimeStub = nil
+	if fake.getEarliestCFEventTimeReturnsOnCall == nil {
+		fake.getEarliestCFEventTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getEarliestCFEventTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTime(arg1 string, arg2 string, arg3 string) (time.Time, error) {
+	fake.getLastAlertDeliveryTimeMutex.Lock()
+	ret, specificReturn := fake.getLastAlertDeliveryTimeReturnsOnCall[len(fake.getLastAlertDeliveryTimeArgsForCall)]
+	fake.getLastAlertDeliveryTimeArgsForCall = append(fake.getLastAlertDeliveryTimeArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("GetLastAlertDeliveryTime", []interface{}{arg1, arg2, arg3})
+	fake.getLastAlertDeliveryTimeMutex.Unlock()
+	if fake.GetLastAlertDeliveryTimeStub != nil {
+		return fake.GetLastAlertDeliveryTimeStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getLastAlertDeliveryTimeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTimeCallCount() int {
+	fake.getLastAlertDeliveryTimeMutex.RLock()
+	defer fake.getLastAlertDeliveryTimeMutex.RUnlock()
+	return len(fake.getLastAlertDeliveryTimeArgsForCall)
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTimeCalls(stub func(string, string, string) (time.Time, error)) {
+	fake.getLastAlertDeliveryTimeMutex.Lock()
+	defer fake.getLastAlertDeliveryTimeMutex.Unlock()
+	fake.GetLastAlertDeliveryTimeStub = stub
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTimeArgsForCall(i int) (string, string, string) {
+	fake.getLastAlertDeliveryTimeMutex.RLock()
+	defer fake.getLastAlertDeliveryTimeMutex.RUnlock()
+	argsForCall := fake.getLastAlertDeliveryTimeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTimeReturns(result1 time.Time, result2 error) {
+	fake.getLastAlertDeliveryTimeMutex.Lock()
+	defer fake.getLastAlertDeliveryTimeMutex.Unlock()
+	fake.GetLastAlertDeliveryTimeStub = nil
+	fake.getLastAlertDeliveryTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLastAlertDeliveryTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getLastAlertDeliveryTimeMutex.Lock()
+	defer fake.getLastAlertDeliveryTimeMutex.Unlock()
+	fake.GetLastAlertDeliveryTimeStub = nil
+	if fake.getLastAlertDeliveryTimeReturnsOnCall == nil {
+		fake.getLastAlertDeliveryTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getLastAlertDeliveryTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestCFAuditEventArchive() (*db.CFAuditEventArchive, error) {
+	fake.getLatestCFAuditEventArchiveMutex.Lock()
+	ret, specificReturn := fake.getLatestCFAuditEventArchiveReturnsOnCall[len(fake.getLatestCFAuditEventArchiveArgsForCall)]
+	fake.getLatestCFAuditEventArchiveArgsForCall = append(fake.getLatestCFAuditEventArchiveArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetLatestCFAuditEventArchive", []interface{}{})
+	fake.getLatestCFAuditEventArchiveMutex.Unlock()
+	if fake.GetLatestCFAuditEventArchiveStub != nil {
+		return fake.GetLatestCFAuditEventArchiveStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getLatestCFAuditEventArchiveReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetLatestCFAuditEventArchiveCallCount() int {
+	fake.getLatestCFAuditEventArchiveMutex.RLock()
+	defer fake.getLatestCFAuditEventArchiveMutex.RUnlock()
+	return len(fake.getLatestCFAuditEventArchiveArgsForCall)
+}
+
+func (fake *FakeEventDB) GetLatestCFAuditEventArchiveCalls(stub func() (*db.CFAuditEventArchive, error)) {
+	fake.getLatestCFAuditEventArchiveMutex.Lock()
+	defer fake.getLatestCFAuditEventArchiveMutex.Unlock()
+	fake.GetLatestCFAuditEventArchiveStub = stub
+}
+
+func (fake *FakeEventDB) GetLatestCFAuditEventArchiveReturns(result1 *db.CFAuditEventArchive, result2 error) {
+	fake.getLatestCFAuditEventArchiveMutex.Lock()
+	defer fake.getLatestCFAuditEventArchiveMutex.Unlock()
+	fake.GetLatestCFAuditEventArchiveStub = nil
+	fake.getLatestCFAuditEventArchiveReturns = struct {
+		result1 *db.CFAuditEventArchive
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestCFAuditEventArchiveReturnsOnCall(i int, result1 *db.CFAuditEventArchive, result2 error) {
+	fake.getLatestCFAuditEventArchiveMutex.Lock()
+	defer fake.getLatestCFAuditEventArchiveMutex.Unlock()
+	fake.GetLatestCFAuditEventArchiveStub = nil
+	if fake.getLatestCFAuditEventArchiveReturnsOnCall == nil {
+		fake.getLatestCFAuditEventArchiveReturnsOnCall = make(map[int]struct {
+			result1 *db.CFAuditEventArchive
+			result2 error
+		})
+	}
+	fake.getLatestCFAuditEventArchiveReturnsOnCall[i] = struct {
+		result1 *db.CFAuditEventArchive
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTime(arg1 string) (time.Time, error) {
+	fake.getLatestCFEventTimeMutex.Lock()
+	ret, specificReturn := fake.getLatestCFEventTimeReturnsOnCall[len(fake.getLatestCFEventTimeArgsForCall)]
+	fake.getLatestCFEventTimeArgsForCall = append(fake.getLatestCFEventTimeArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("GetLatestCFEventTime", []interface{}{arg1})
+	fake.getLatestCFEventTimeMutex.Unlock()
+	if fake.GetLatestCFEventTimeStub != nil {
+		return fake.GetLatestCFEventTimeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getLatestCFEventTimeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTimeCallCount() int {
+	fake.getLatestCFEventTimeMutex.RLock()
+	defer fake.getLatestCFEventTimeMutex.RUnlock()
+	return len(fake.getLatestCFEventTimeArgsForCall)
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTimeCalls(stub func(string) (time.Time, error)) {
+	fake.getLatestCFEventTimeMutex.Lock()
+	defer fake.getLatestCFEventTimeMutex.Unlock()
+	fake.GetLatestCFEventTimeStub = stub
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTimeArgsForCall(i int) string {
+	fake.getLatestCFEventTimeMutex.RLock()
+	defer fake.getLatestCFEventTimeMutex.RUnlock()
+	argsForCall := fake.getLatestCFEventTimeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTimeReturns(result1 time.Time, result2 error) {
+	fake.getLatestCFEventTimeMutex.Lock()
+	defer fake.getLatestCFEventTimeMutex.Unlock()
+	fake.GetLatestCFEventTimeStub = nil
+	fake.getLatestCFEventTimeReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestCFEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getLatestCFEventTimeMutex.Lock()
+	defer fake.getLatestCFEventTimeMutex.Unlock()
+	fake.GetLatestCFEventTimeStub = nil
+	if fake.getLatestCFEventTimeReturnsOnCall == nil {
+		fake.getLatestCFEventTimeReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getLatestCFEventTimeReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestChainCheckpoint() (*db.ChainCheckpoint, error) {
+	fake.getLatestChainCheckpointMutex.Lock()
+	ret, specificReturn := fake.getLatestChainCheckpointReturnsOnCall[len(fake.getLatestChainCheckpointArgsForCall)]
+	fake.getLatestChainCheckpointArgsForCall = append(fake.getLatestChainCheckpointArgsForCall, struct {
+	}{})
+	fake.recordInvocation("GetLatestChainCheckpoint", []interface{}{})
+	fake.getLatestChainCheckpointMutex.Unlock()
+	if fake.GetLatestChainCheckpointStub != nil {
+		return fake.GetLatestChainCheckpointStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getLatestChainCheckpointReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetLatestChainCheckpointCallCount() int {
+	fake.getLatestChainCheckpointMutex.RLock()
+	defer fake.getLatestChainCheckpointMutex.RUnlock()
+	return len(fake.getLatestChainCheckpointArgsForCall)
+}
+
+func (fake *FakeEventDB) GetLatestChainCheckpointCalls(stub func() (*db.ChainCheckpoint, error)) {
+	fake.getLatestChainCheckpointMutex.Lock()
+	defer fake.getLatestChainCheckpointMutex.Unlock()
+	fake.GetLatestChainCheckpointStub = stub
+}
+
+func (fake *FakeEventDB) GetLatestChainCheckpointReturns(result1 *db.ChainCheckpoint, result2 error) {
+	fake.getLatestChainCheckpointMutex.Lock()
+	defer fake.getLatestChainCheckpointMutex.Unlock()
+	fake.GetLatestChainCheckpointStub = nil
+	fake.getLatestChainCheckpointReturns = struct {
+		result1 *db.ChainCheckpoint
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetLatestChainCheckpointReturnsOnCall(i int, result1 *db.ChainCheckpoint, result2 error) {
+	fake.getLatestChainCheckpointMutex.Lock()
+	defer fake.getLatestChainCheckpointMutex.Unlock()
+	fake.GetLatestChainCheckpointStub = nil
+	if fake.getLatestChainCheckpointReturnsOnCall == nil {
+		fake.getLatestChainCheckpointReturnsOnCall = make(map[int]struct {
+			result1 *db.ChainCheckpoint
+			result2 error
+		})
+	}
+	fake.getLatestChainCheckpointReturnsOnCall[i] = struct {
+		result1 *db.ChainCheckpoint
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetResourceNames(arg1 string, arg2 string, arg3 string) ([]db.ResourceName, error) {
+	fake.getResourceNamesMutex.Lock()
+	ret, specificReturn := fake.getResourceNamesReturnsOnCall[len(fake.getResourceNamesArgsForCall)]
+	fake.getResourceNamesArgsForCall = append(fake.getResourceNamesArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("GetResourceNames", []interface{}{arg1, arg2, arg3})
+	fake.getResourceNamesMutex.Unlock()
+	if fake.GetResourceNamesStub != nil {
+		return fake.GetResourceNamesStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getResourceNamesReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetResourceNamesCallCount() int {
+	fake.getResourceNamesMutex.RLock()
+	defer fake.getResourceNamesMutex.RUnlock()
+	return len(fake.getResourceNamesArgsForCall)
+}
+
+func (fake *FakeEventDB) GetResourceNamesCalls(stub func(string, string, string) ([]db.ResourceName, error)) {
+	fake.getResourceNamesMutex.Lock()
+	defer fake.getResourceNamesMutex.Unlock()
+	fake.GetResourceNamesStub = stub
+}
+
+func (fake *FakeEventDB) GetResourceNamesArgsForCall(i int) (string, string, string) {
+	fake.getResourceNamesMutex.RLock()
+	defer fake.getResourceNamesMutex.RUnlock()
+	argsForCall := fake.getResourceNamesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) GetResourceNamesReturns(result1 []db.ResourceName, result2 error) {
+	fake.getResourceNamesMutex.Lock()
+	defer fake.getResourceNamesMutex.Unlock()
+	fake.GetResourceNamesStub = nil
+	fake.getResourceNamesReturns = struct {
+		result1 []db.ResourceName
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetResourceNamesReturnsOnCall(i int, result1 []db.ResourceName, result2 error) {
+	fake.getResourceNamesMutex.Lock()
+	defer fake.getResourceNamesMutex.Unlock()
+	fake.GetResourceNamesStub = nil
+	if fake.getResourceNamesReturnsOnCall == nil {
+		fake.getResourceNamesReturnsOnCall = make(map[int]struct {
+			result1 []db.ResourceName
+			result2 error
+		})
+	}
+	fake.getResourceNamesReturnsOnCall[i] = struct {
+		result1 []db.ResourceName
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlerts(arg1 string, arg2 []string, arg3 time.Time) ([]db.Alert, error) {
+	var arg2Copy []string
+	if arg2 != nil {
+		arg2Copy = make([]string, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.getUndeliveredAlertsMutex.Lock()
+	ret, specificReturn := fake.getUndeliveredAlertsReturnsOnCall[len(fake.getUndeliveredAlertsArgsForCall)]
+	fake.getUndeliveredAlertsArgsForCall = append(fake.getUndeliveredAlertsArgsForCall, struct {
+		arg1 string
+		arg2 []string
+		arg3 time.Time
+	}{arg1, arg2Copy, arg3})
+	fake.recordInvocation("GetUndeliveredAlerts", []interface{}{arg1, arg2Copy, arg3})
+	fake.getUndeliveredAlertsMutex.Unlock()
+	if fake.GetUndeliveredAlertsStub != nil {
+		return fake.GetUndeliveredAlertsStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getUndeliveredAlertsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlertsCallCount() int {
+	fake.getUndeliveredAlertsMutex.RLock()
+	defer fake.getUndeliveredAlertsMutex.RUnlock()
+	return len(fake.getUndeliveredAlertsArgsForCall)
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlertsCalls(stub func(string, []string, time.Time) ([]db.Alert, error)) {
+	fake.getUndeliveredAlertsMutex.Lock()
+	defer fake.getUndeliveredAlertsMutex.Unlock()
+	fake.GetUndeliveredAlertsStub = stub
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlertsArgsForCall(i int) (string, []string, time.Time) {
+	fake.getUndeliveredAlertsMutex.RLock()
+	defer fake.getUndeliveredAlertsMutex.RUnlock()
+	argsForCall := fake.getUndeliveredAlertsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlertsReturns(result1 []db.Alert, result2 error) {
+	fake.getUndeliveredAlertsMutex.Lock()
+	defer fake.getUndeliveredAlertsMutex.Unlock()
+	fake.GetUndeliveredAlertsStub = nil
+	fake.getUndeliveredAlertsReturns = struct {
+		result1 []db.Alert
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetUndeliveredAlertsReturnsOnCall(i int, result1 []db.Alert, result2 error) {
+	fake.getUndeliveredAlertsMutex.Lock()
+	defer fake.getUndeliveredAlertsMutex.Unlock()
+	fake.GetUndeliveredAlertsStub = nil
+	if fake.getUndeliveredAlertsReturnsOnCall == nil {
+		fake.getUndeliveredAlertsReturnsOnCall = make(map[int]struct {
+			result1 []db.Alert
+			result2 error
+		})
+	}
+	fake.getUndeliveredAlertsReturnsOnCall[i] = struct {
+		result1 []db.Alert
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipper(arg1 string, arg2 int) ([]db.CFAuditEvent, error) {
+	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
+	ret, specificReturn := fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)]
+	fake.getUnshippedCFAuditEventsForShipperArgsForCall = append(fake.getUnshippedCFAuditEventsForShipperArgsForCall, struct {
+		arg1 string
+		arg2 int
+	}{arg1, arg2})
+	fake.recordInvocation("GetUnshippedCFAuditEventsForShipper", []interface{}{arg1, arg2})
+	fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
+	if fake.GetUnshippedCFAuditEventsForShipperStub != nil {
+		return fake.GetUnshippedCFAuditEventsForShipperStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getUnshippedCFAuditEventsForShipperReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCallCount() int {
+	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
+	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
+	return len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCalls(stub func(string, int) ([]db.CFAuditEvent, error)) {
+	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
+	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
+	fake.GetUnshippedCFAuditEventsForShipperStub = stub
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperArgsForCall(i int) (string, int) {
+	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
+	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
+	argsForCall := fake.getUnshippedCFAuditEventsForShipperArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturns(result1 []db.CFAuditEvent, result2 error) {
+	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
+	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
+	fake.GetUnshippedCFAuditEventsForShipperStub = nil
+	fake.getUnshippedCFAuditEventsForShipperReturns = struct {
+		result1 []db.CFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturnsOnCall(i int, result1 []db.CFAuditEvent, result2 error) {
+	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
+	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
+	fake.GetUnshippedCFAuditEventsForShipperStub = nil
+	if fake.getUnshippedCFAuditEventsForShipperReturnsOnCall == nil {
+		fake.getUnshippedCFAuditEventsForShipperReturnsOnCall = make(map[int]struct {
+			result1 []db.CFAuditEvent
+			result2 error
+		})
+	}
+	fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[i] = struct {
+		result1 []db.CFAuditEvent
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartition(arg1 time.Time, arg2 time.Time, arg3 string) error {
+	fake.holdCFAuditEventPartitionMutex.Lock()
+	ret, specificReturn := fake.holdCFAuditEventPartitionReturnsOnCall[len(fake.holdCFAuditEventPartitionArgsForCall)]
+	fake.holdCFAuditEventPartitionArgsForCall = append(fake.holdCFAuditEventPartitionArgsForCall, struct {
+		arg1 time.Time
+		arg2 time.Time
+		arg3 string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("HoldCFAuditEventPartition", []interface{}{arg1, arg2, arg3})
+	fake.holdCFAuditEventPartitionMutex.Unlock()
+	if fake.HoldCFAuditEventPartitionStub != nil {
+		return fake.HoldCFAuditEventPartitionStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.holdCFAuditEventPartitionReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartitionCallCount() int {
+	fake.holdCFAuditEventPartitionMutex.RLock()
+	defer fake.holdCFAuditEventPartitionMutex.RUnlock()
+	return len(fake.holdCFAuditEventPartitionArgsForCall)
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartitionCalls(stub func(time.Time, time.Time, string) error) {
+	fake.holdCFAuditEventPartitionMutex.Lock()
+	defer fake.holdCFAuditEventPartitionMutex.Unlock()
+	fake.HoldCFAuditEventPartitionStub = stub
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartitionArgsForCall(i int) (time.Time, time.Time, string) {
+	fake.holdCFAuditEventPartitionMutex.RLock()
+	defer fake.holdCFAuditEventPartitionMutex.RUnlock()
+	argsForCall := fake.holdCFAuditEventPartitionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartitionReturns(result1 error) {
+	fake.holdCFAuditEventPartitionMutex.Lock()
+	defer fake.holdCFAuditEventPartitionMutex.Unlock()
+	fake.HoldCFAuditEventPartitionStub = nil
+	fake.holdCFAuditEventPartitionReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) HoldCFAuditEventPartitionReturnsOnCall(i int, result1 error) {
+	fake.holdCFAuditEventPartitionMutex.Lock()
+	defer fake.holdCFAuditEventPartitionMutex.Unlock()
+	fake.HoldCFAuditEventPartitionStub = nil
+	if fake.holdCFAuditEventPartitionReturnsOnCall == nil {
+		fake.holdCFAuditEventPartitionReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.holdCFAuditEventPartitionReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) Init() error {
+	fake.initMutex.Lock()
+	ret, specificReturn := fake.initReturnsOnCall[len(fake.initArgsForCall)]
+	fake.initArgsForCall = append(fake.initArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Init", []interface{}{})
+	fake.initMutex.Unlock()
+	if fake.InitStub != nil {
+		return fake.InitStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.initReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) InitCallCount() int {
+	fake.initMutex.RLock()
+	defer fake.initMutex.RUnlock()
+	return len(fake.initArgsForCall)
+}
+
+func (fake *FakeEventDB) InitCalls(stub func() error) {
+	fake.initMutex.Lock()
+	defer fake.initMutex.Unlock()
+	fake.InitStub = stub
+}
+
+func (fake *FakeEventDB) InitReturns(result1 error) {
+	fake.initMutex.Lock()
+	defer fake.initMutex.Unlock()
+	fake.InitStub = nil
+	fake.initReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) InitReturnsOnCall(i int, result1 error) {
+	fake.initMutex.Lock()
+	defer fake.initMutex.Unlock()
+	fake.InitStub = nil
+	if fake.initReturnsOnCall == nil {
+		fake.initReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.initReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) InitAlertCursor(arg1 string) (int64, error) {
+	fake.initAlertCursorMutex.Lock()
+	ret, specificReturn := fake.initAlertCursorReturnsOnCall[len(fake.initAlertCursorArgsForCall)]
+	fake.initAlertCursorArgsForCall = append(fake.initAlertCursorArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("InitAlertCursor", []interface{}{arg1})
+	fake.initAlertCursorMutex.Unlock()
+	if fake.InitAlertCursorStub != nil {
+		return fake.InitAlertCursorStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.initAlertCursorReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) InitAlertCursorCallCount() int {
+	fake.initAlertCursorMutex.RLock()
+	defer fake.initAlertCursorMutex.RUnlock()
+	return len(fake.initAlertCursorArgsForCall)
+}
+
+func (fake *FakeEventDB) InitAlertCursorCalls(stub func(string) (int64, error)) {
+	fake.initAlertCursorMutex.Lock()
+	defer fake.initAlertCursorMutex.Unlock()
+	fake.InitAlertCursorStub = stub
+}
+
+func (fake *FakeEventDB) InitAlertCursorArgsForCall(i int) string {
+	fake.initAlertCursorMutex.RLock()
+	defer fake.initAlertCursorMutex.RUnlock()
+	argsForCall := fake.initAlertCursorArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) InitAlertCursorReturns(result1 int64, result2 error) {
+	fake.initAlertCursorMutex.Lock()
+	defer fake.initAlertCursorMutex.Unlock()
+	fake.InitAlertCursorStub = nil
+	fake.initAlertCursorReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) InitAlertCursorReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.initAlertCursorMutex.Lock()
+	defer fake.initAlertCursorMutex.Unlock()
+	fake.InitAlertCursorStub = nil
+	if fake.initAlertCursorReturnsOnCall == nil {
+		fake.initAlertCursorReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.initAlertCursorReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLease(arg1 *db.Lease) error {
+	fake.releaseLeaderLeaseMutex.Lock()
+	ret, specificReturn := fake.releaseLeaderLeaseReturnsOnCall[len(fake.releaseLeaderLeaseArgsForCall)]
+	fake.releaseLeaderLeaseArgsForCall = append(fake.releaseLeaderLeaseArgsForCall, struct {
+		arg1 *db.Lease
+	}{arg1})
+	fake.recordInvocation("ReleaseLeaderLease", []interface{}{arg1})
+	fake.releaseLeaderLeaseMutex.Unlock()
+	if fake.ReleaseLeaderLeaseStub != nil {
+		return fake.ReleaseLeaderLeaseStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.releaseLeaderLeaseReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLeaseCallCount() int {
+	fake.releaseLeaderLeaseMutex.RLock()
+	defer fake.releaseLeaderLeaseMutex.RUnlock()
+	return len(fake.releaseLeaderLeaseArgsForCall)
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLeaseCalls(stub func(*db.Lease) error) {
+	fake.releaseLeaderLeaseMutex.Lock()
+	defer fake.releaseLeaderLeaseMutex.Unlock()
+	fake.ReleaseLeaderLeaseStub = stub
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLeaseArgsForCall(i int) *db.Lease {
+	fake.releaseLeaderLeaseMutex.RLock()
+	defer fake.releaseLeaderLeaseMutex.RUnlock()
+	argsForCall := fake.releaseLeaderLeaseArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLeaseReturns(result1 error) {
+	fake.releaseLeaderLeaseMutex.Lock()
+	defer fake.releaseLeaderLeaseMutex.Unlock()
+	fake.ReleaseLeaderLeaseStub = nil
+	fake.releaseLeaderLeaseReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) ReleaseLeaderLeaseReturnsOnCall(i int, result1 error) {
+	fake.releaseLeaderLeaseMutex.Lock()
+	defer fake.releaseLeaderLeaseMutex.Unlock()
+	fake.ReleaseLeaderLeaseStub = nil
+	if fake.releaseLeaderLeaseReturnsOnCall == nil {
+		fake.releaseLeaderLeaseReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.releaseLeaderLeaseReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartition(arg1 db.Partition, arg2 string) (db.PartitionRemoval, error) {
+	fake.removeCFAuditEventPartitionMutex.Lock()
+	ret, specificReturn := fake.removeCFAuditEventPartitionReturnsOnCall[len(fake.removeCFAuditEventPartitionArgsForCall)]
+	fake.removeCFAuditEventPartitionArgsForCall = append(fake.removeCFAuditEventPartitionArgsForCall, struct {
+		arg1 db.Partition
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("RemoveCFAuditEventPartition", []interface{}{arg1, arg2})
+	fake.removeCFAuditEventPartitionMutex.Unlock()
+	if fake.RemoveCFAuditEventPartitionStub != nil {
+		return fake.RemoveCFAuditEventPartitionStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.removeCFAuditEventPartitionReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartitionCallCount() int {
+	fake.removeCFAuditEventPartitionMutex.RLock()
+	defer fake.removeCFAuditEventPartitionMutex.RUnlock()
+	return len(fake.removeCFAuditEventPartitionArgsForCall)
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartitionCalls(stub func(db.Partition, string) (db.PartitionRemoval, error)) {
+	fake.removeCFAuditEventPartitionMutex.Lock()
+	defer fake.removeCFAuditEventPartitionMutex.Unlock()
+	fake.RemoveCFAuditEventPartitionStub = stub
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartitionArgsForCall(i int) (db.Partition, string) {
+	fake.removeCFAuditEventPartitionMutex.RLock()
+	defer fake.removeCFAuditEventPartitionMutex.RUnlock()
+	argsForCall := fake.removeCFAuditEventPartitionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartitionReturns(result1 db.PartitionRemoval, result2 error) {
+	fake.removeCFAuditEventPartitionMutex.Lock()
+	defer fake.removeCFAuditEventPartitionMutex.Unlock()
+	fake.RemoveCFAuditEventPartitionStub = nil
+	fake.removeCFAuditEventPartitionReturns = struct {
+		result1 db.PartitionRemoval
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) RemoveCFAuditEventPartitionReturnsOnCall(i int, result1 db.PartitionRemoval, result2 error) {
+	fake.removeCFAuditEventPartitionMutex.Lock()
+	defer fake.removeCFAuditEventPartitionMutex.Unlock()
+	fake.RemoveCFAuditEventPartitionStub = nil
+	if fake.removeCFAuditEventPartitionReturnsOnCall == nil {
+		fake.removeCFAuditEventPartitionReturnsOnCall = make(map[int]struct {
+			result1 db.PartitionRemoval
+			result2 error
+		})
+	}
+	fake.removeCFAuditEventPartitionReturnsOnCall[i] = struct {
+		result1 db.PartitionRemoval
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEvents(arg1 string, arg2 []cfclient.Event, arg3 map[string]db.EventNames) (int, error) {
+	var arg2Copy []cfclient.Event
+	if arg2 != nil {
+		arg2Copy = make([]cfclient.Event, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.restoreCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.restoreCFAuditEventsReturnsOnCall[len(fake.restoreCFAuditEventsArgsForCall)]
+	fake.restoreCFAuditEventsArgsForCall = append(fake.restoreCFAuditEventsArgsForCall, struct {
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
+	}{arg1, arg2Copy, arg3})
+	fake.recordInvocation("RestoreCFAuditEvents", []interface{}{arg1, arg2Copy, arg3})
+	fake.restoreCFAuditEventsMutex.Unlock()
+	if fake.RestoreCFAuditEventsStub != nil {
+		return fake.RestoreCFAuditEventsStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.restoreCFAuditEventsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEventsCallCount() int {
+	fake.restoreCFAuditEventsMutex.RLock()
+	defer fake.restoreCFAuditEventsMutex.RUnlock()
+	return len(fake.restoreCFAuditEventsArgsForCall)
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEventsCalls(stub func(string, []cfclient.Event, map[string]db.EventNames) (int, error)) {
+	fake.restoreCFAuditEventsMutex.Lock()
+	defer fake.restoreCFAuditEventsMutex.Unlock()
+	fake.RestoreCFAuditEventsStub = stub
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEventsArgsForCall(i int) (string, []cfclient.Event, map[string]db.EventNames) {
+	fake.restoreCFAuditEventsMutex.RLock()
+	defer fake.restoreCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.restoreCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEventsReturns(result1 int, result2 error) {
+	fake.restoreCFAuditEventsMutex.Lock()
+	defer fake.restoreCFAuditEventsMutex.Unlock()
+	fake.RestoreCFAuditEventsStub = nil
+	fake.restoreCFAuditEventsReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) RestoreCFAuditEventsReturnsOnCall(i int, result1 int, result2 error) {
+	fake.restoreCFAuditEventsMutex.Lock()
+	defer fake.restoreCFAuditEventsMutex.Unlock()
+	fake.RestoreCFAuditEventsStub = nil
+	if fake.restoreCFAuditEventsReturnsOnCall == nil {
+		fake.restoreCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 int
+			result2 error
+		})
+	}
+	fake.restoreCFAuditEventsReturnsOnCall[i] = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) StoreAlertDelivery(arg1 db.AlertDelivery) error {
+	fake.storeAlertDeliveryMutex.Lock()
+	ret, specificReturn := fake.storeAlertDeliveryReturnsOnCall[len(fake.storeAlertDeliveryArgsForCall)]
+	fake.storeAlertDeliveryArgsForCall = append(fake.storeAlertDeliveryArgsForCall, struct {
+		arg1 db.AlertDelivery
+	}{arg1})
+	fake.recordInvocation("StoreAlertDelivery", []interface{}{arg1})
+	fake.storeAlertDeliveryMutex.Unlock()
+	if fake.StoreAlertDeliveryStub != nil {
+		return fake.StoreAlertDeliveryStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.storeAlertDeliveryReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) StoreAlertDeliveryCallCount() int {
+	fake.storeAlertDeliveryMutex.RLock()
+	defer fake.storeAlertDeliveryMutex.RUnlock()
+	return len(fake.storeAlertDeliveryArgsForCall)
+}
+
+func (fake *FakeEventDB) StoreAlertDeliveryCalls(stub func(db.AlertDelivery) error) {
+	fake.storeAlertDeliveryMutex.Lock()
+	defer fake.storeAlertDeliveryMutex.Unlock()
+	fake.StoreAlertDeliveryStub = stub
+}
+
+func (fake *FakeEventDB) StoreAlertDeliveryArgsForCall(i int) db.AlertDelivery {
+	fake.storeAlertDeliveryMutex.RLock()
+	defer fake.storeAlertDeliveryMutex.RUnlock()
+	argsForCall := fake.storeAlertDeliveryArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) StoreAlertDeliveryReturns(result1 error) {
+	fake.storeAlertDeliveryMutex.Lock()
+	defer fake.storeAlertDeliveryMutex.Unlock()
+	fake.StoreAlertDeliveryStub = nil
+	fake.storeAlertDeliveryReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreAlertDeliveryReturnsOnCall(i int, result1 error) {
+	fake.storeAlertDeliveryMutex.Lock()
+	defer fake.storeAlertDeliveryMutex.Unlock()
+	fake.StoreAlertDeliveryStub = nil
+	if fake.storeAlertDeliveryReturnsOnCall == nil {
+		fake.storeAlertDeliveryReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.storeAlertDeliveryReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreAlerts(arg1 string, arg2 []db.Alert, arg3 db.CFAuditEvent) ([]db.Alert, error) {
+	var arg2Copy []db.Alert
+	if arg2 != nil {
+		arg2Copy = make([]db.Alert, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.storeAlertsMutex.Lock()
+	ret, specificReturn := fake.storeAlertsReturnsOnCall[len(fake.storeAlertsArgsForCall)]
+	fake.storeAlertsArgsForCall = append(fake.storeAlertsArgsForCall, struct {
+		arg1 string
+		arg2 []db.Alert
+		arg3 db.CFAuditEvent
+	}{arg1, arg2Copy, arg3})
+	fake.recordInvocation("StoreAlerts", []interface{}{arg1, arg2Copy, arg3})
+	fake.storeAlertsMutex.Unlock()
+	if fake.StoreAlertsStub != nil {
+		return fake.StoreAlertsStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.storeAlertsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeEventDB) StoreAlertsCallCount() int {
+	fake.storeAlertsMutex.RLock()
+	defer fake.storeAlertsMutex.RUnlock()
+	return len(fake.storeAlertsArgsForCall)
+}
+
+func (fake *FakeEventDB) StoreAlertsCalls(stub func(string, []db.Alert, db.CFAuditEvent) ([]db.Alert, error)) {
+	fake.storeAlertsMutex.Lock()
+	defer fake.storeAlertsMutex.Unlock()
+	fake.StoreAlertsStub = stub
+}
+
+func (fake *FakeEventDB) StoreAlertsArgsForCall(i int) (string, []db.Alert, db.CFAuditEvent) {
+	fake.storeAlertsMutex.RLock()
+	defer fake.storeAlertsMutex.RUnlock()
+	argsForCall := fake.storeAlertsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) StoreAlertsReturns(result1 []db.Alert, result2 error) {
+	fake.storeAlertsMutex.Lock()
+	defer fake.storeAlertsMutex.Unlock()
+	fake.StoreAlertsStub = nil
+	fake.storeAlertsReturns = struct {
+		result1 []db.Alert
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) StoreAlertsReturnsOnCall(i int, result1 []db.Alert, result2 error) {
+	fake.storeAlertsMutex.Lock()
+	defer fake.storeAlertsMutex.Unlock()
+	fake.StoreAlertsStub = nil
+	if fake.storeAlertsReturnsOnCall == nil {
+		fake.storeAlertsReturnsOnCall = make(map[int]struct {
+			result1 []db.Alert
+			result2 error
+		})
+	}
+	fake.storeAlertsReturnsOnCall[i] = struct {
+		result1 []db.Alert
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchive(arg1 db.CFAuditEventArchive) error {
+	fake.storeCFAuditEventArchiveMutex.Lock()
+	ret, specificReturn := fake.storeCFAuditEventArchiveReturnsOnCall[len(fake.storeCFAuditEventArchiveArgsForCall)]
+	fake.storeCFAuditEventArchiveArgsForCall = append(fake.storeCFAuditEventArchiveArgsForCall, struct {
+		arg1 db.CFAuditEventArchive
+	}{arg1})
+	fake.recordInvocation("StoreCFAuditEventArchive", []interface{}{arg1})
+	fake.storeCFAuditEventArchiveMutex.Unlock()
+	if fake.StoreCFAuditEventArchiveStub != nil {
+		return fake.StoreCFAuditEventArchiveStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.storeCFAuditEventArchiveReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchiveCallCount() int {
+	fake.storeCFAuditEventArchiveMutex.RLock()
+	defer fake.storeCFAuditEventArchiveMutex.RUnlock()
+	return len(fake.storeCFAuditEventArchiveArgsForCall)
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchiveCalls(stub func(db.CFAuditEventArchive) error) {
+	fake.storeCFAuditEventArchiveMutex.Lock()
+	defer fake.storeCFAuditEventArchiveMutex.Unlock()
+	fake.StoreCFAuditEventArchiveStub = stub
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchiveArgsForCall(i int) db.CFAuditEventArchive {
+	fake.storeCFAuditEventArchiveMutex.RLock()
+	defer fake.storeCFAuditEventArchiveMutex.RUnlock()
+	argsForCall := fake.storeCFAuditEventArchiveArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchiveReturns(result1 error) {
+	fake.storeCFAuditEventArchiveMutex.Lock()
+	defer fake.storeCFAuditEventArchiveMutex.Unlock()
+	fake.StoreCFAuditEventArchiveStub = nil
+	fake.storeCFAuditEventArchiveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreCFAuditEventArchiveReturnsOnCall(i int, result1 error) {
+	fake.storeCFAuditEventArchiveMutex.Lock()
+	defer fake.storeCFAuditEventArchiveMutex.Unlock()
+	fake.StoreCFAuditEventArchiveStub = nil
+	if fake.storeCFAuditEventArchiveReturnsOnCall == nil {
+		fake.storeCFAuditEventArchiveReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.storeCFAuditEventArchiveReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreCFAuditEvents(arg1 string, arg2 []cfclient.Event, arg3 map[string]db.EventNames) (int, error) {
+	var arg2Copy []cfclient.Event
+	if arg2 != nil {
+		arg2Copy = make([]cfclient.Event, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.storeCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.storeCFAuditEventsReturnsOnCall[len(fake.storeCFAuditEventsArgsForCall)]
+	fake.storeCFAuditEventsArgsForCall = append(fake.storeCFAuditEventsArgsForCall, struct {
+		arg1 string
+		arg2 []cfclient.Event
+		arg3 map[string]db.EventNames
+	}{arg1, arg2Copy, arg3})
+	fake.recordInvocation("StoreCFAuditEvents", []interface{}{arg1, arg2Copy, arg3})
+	fake.storeCFAuditEventsMutex.Unlock()
+	if fake.StoreCFAuditEventsStub != nil {
+		return fake.StoreCFAuditEventsStub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.getCFAuditEventsReturns
+	fakeReturns := fake.storeCFAuditEventsReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsCallCount() int {
-	fake.getCFAuditEventsMutex.RLock()
-	defer fake.getCFAuditEventsMutex.RUnlock()
-	return len(fake.getCFAuditEventsArgsForCall)
+func (fake *FakeEventDB) StoreCFAuditEventsCallCount() int {
+	fake.storeCFAuditEventsMutex.RLock()
+	defer fake.storeCFAuditEventsMutex.RUnlock()
+	return len(fake.storeCFAuditEventsArgsForCall)
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsCalls(stub func(db.RawEventFilter) ([]cfclient.Event, error)) {
-	fake.getCFAuditEventsMutex.Lock()
-	defer fake.getCFAuditEventsMutex.Unlock()
-	fake.GetCFAuditEventsStub = stub
+func (fake *FakeEventDB) StoreCFAuditEventsCalls(stub func(string, []cfclient.Event, map[string]db.EventNames) (int, error)) {
+	fake.storeCFAuditEventsMutex.Lock()
+	defer fake.storeCFAuditEventsMutex.Unlock()
+	fake.StoreCFAuditEventsStub = stub
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsArgsForCall(i int) db.RawEventFilter {
-	fake.getCFAuditEventsMutex.RLock()
-	defer fake.getCFAuditEventsMutex.RUnlock()
-	argsForCall := fake.getCFAuditEventsArgsForCall[i]
-	return argsForCall.arg1
+func (fake *FakeEventDB) StoreCFAuditEventsArgsForCall(i int) (string, []cfclient.Event, map[string]db.EventNames) {
+	fake.storeCFAuditEventsMutex.RLock()
+	defer fake.storeCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.storeCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsReturns(result1 []cfclient.Event, result2 error) {
-	fake.getCFAuditEventsMutex.Lock()
-	defer fake.getCFAuditEventsMutex.Unlock()
-	fake.GetCFAuditEventsStub = nil
-	fake.getCFAuditEventsReturns = struct {
-		result1 []cfclient.Event
+func (fake *FakeEventDB) StoreCFAuditEventsReturns(result1 int, result2 error) {
+	fake.storeCFAuditEventsMutex.Lock()
+	defer fake.storeCFAuditEventsMutex.Unlock()
+	fake.StoreCFAuditEventsStub = nil
+	fake.storeCFAuditEventsReturns = struct {
+		result1 int
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetCFAuditEventsReturnsOnCall(i int, result1 []cfclient.Event, result2 error) {
-	fake.getCFAuditEventsMutex.Lock()
-	defer fake.getCFAuditEventsMutex.Unlock()
-	fake.GetCFAuditEventsStub = nil
-	if fake.getCFAuditEventsReturnsOnCall == nil {
-		fake.getCFAuditEventsReturnsOnCall = make(map[int]struct {
-			result1 []cfclient.Event
+func (fake *FakeEventDB) StoreCFAuditEventsReturnsOnCall(i int, result1 int, result2 error) {
+	fake.storeCFAuditEventsMutex.Lock()
+	defer fake.storeCFAuditEventsMutex.Unlock()
+	fake.StoreCFAuditEventsStub = nil
+	if fake.storeCFAuditEventsReturnsOnCall == nil {
+		fake.storeCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 int
 			result2 error
 		})
 	}
-	fake.getCFAuditEventsReturnsOnCall[i] = struct {
-		result1 []cfclient.Event
+	fake.storeCFAuditEventsReturnsOnCall[i] = struct {
+		result1 int
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeEventDB) GetCFEventCount() (int64, error) {
-	fake.getCFEventCountMutex.Lock()
-	ret, specificReturn := fake.getCFEventCountReturnsOnCall[len(fake.getCFEventCountArgsForCall)]
-	fake.getCFEventCountArgsForCall = append(fake.getCFEventCountArgsForCall, struct {
-	}{})
-	fake.recordInvocation("GetCFEventCount", []interface{}{})
-	fake.getCFEventCountMutex.Unlock()
-	if fake.GetCFEventCountStub != nil {
-		return fake.GetCFEventCountStub()
+func (fake *FakeEventDB) StoreChainCheckpoint(arg1 db.ChainCheckpoint) error {
+	fake.storeChainCheckpointMutex.Lock()
+	ret, specificReturn := fake.storeChainCheckpointReturnsOnCall[len(fake.storeChainCheckpointArgsForCall)]
+	fake.storeChainCheckpointArgsForCall = append(fake.storeChainCheckpointArgsForCall, struct {
+		arg1 db.ChainCheckpoint
+	}{arg1})
+	fake.recordInvocation("StoreChainCheckpoint", []interface{}{arg1})
+	fake.storeChainCheckpointMutex.Unlock()
+	if fake.StoreChainCheckpointStub != nil {
+		return fake.StoreChainCheckpointStub(arg1)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2
+		return ret.result1
 	}
-	fakeReturns := fake.getCFEventCountReturns
-	return fakeReturns.result1, fakeReturns.result2
+	fakeReturns := fake.storeChainCheckpointReturns
+	return fakeReturns.result1
 }
 
-func (fake *FakeEventDB) GetCFEventCountCallCount() int {
-	fake.getCFEventCountMutex.RLock()
-	defer fake.getCFEventCountMutex.RUnlock()
-	return len(fake.getCFEventCountArgsForCall)
+func (fake *FakeEventDB) StoreChainCheckpointCallCount() int {
+	fake.storeChainCheckpointMutex.RLock()
+	defer fake.storeChainCheckpointMutex.RUnlock()
+	return len(fake.storeChainCheckpointArgsForCall)
 }
 
-func (fake *FakeEventDB) GetCFEventCountCalls(stub func() (int64, error)) {
-	fake.getCFEventCountMutex.Lock()
-	defer fake.getCFEventCountMutex.Unlock()
-	fake.GetCFEventCountStub = stub
+func (fake *FakeEventDB) StoreChainCheckpointCalls(stub func(db.ChainCheckpoint) error) {
+	fake.storeChainCheckpointMutex.Lock()
+	defer fake.storeChainCheckpointMutex.Unlock()
+	fake.StoreChainCheckpointStub = stub
 }
 
-func (fake *FakeEventDB) GetCFEventCountReturns(result1 int64, result2 error) {
-	fake.getCFEventCountMutex.Lock()
-	defer fake.getCFEventCountMutex.Unlock()
-	fake.GetCFEventCountStub = nil
-	fake.getCFEventCountReturns = struct {
-		result1 int64
-		result2 error
-	}{result1, result2}
+func (fake *FakeEventDB) StoreChainCheckpointArgsForCall(i int) db.ChainCheckpoint {
+	fake.storeChainCheckpointMutex.RLock()
+	defer fake.storeChainCheckpointMutex.RUnlock()
+	argsForCall := fake.storeChainCheckpointArgsForCall[i]
+	return argsForCall.arg1
 }
 
-func (fake *FakeEventDB) GetCFEventCountReturnsOnCall(i int, result1 int64, result2 error) {
-	fake.getCFEventCountMutex.Lock()
-	defer fake.getCFEventCountMutex.Unlock()
-	fake.GetCFEventCountStub = nil
-	if fake.getCFEventCountReturnsOnCall == nil {
-		fake.getCFEventCountReturnsOnCall = make(map[int]struct {
-			result1 int64
-			result2 error
+func (fake *FakeEventDB) StoreChainCheckpointReturns(result1 error) {
+	fake.storeChainCheckpointMutex.Lock()
+	defer fake.storeChainCheckpointMutex.Unlock()
+	fake.StoreChainCheckpointStub = nil
+	fake.storeChainCheckpointReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreChainCheckpointReturnsOnCall(i int, result1 error) {
+	fake.storeChainCheckpointMutex.Lock()
+	defer fake.storeChainCheckpointMutex.Unlock()
+	fake.StoreChainCheckpointStub = nil
+	if fake.storeChainCheckpointReturnsOnCall == nil {
+		fake.storeChainCheckpointReturnsOnCall = make(map[int]struct {
+			result1 error
 		})
 	}
-	fake.getCFEventCountReturnsOnCall[i] = struct {
-		result1 int64
-		result2 error
-	}{result1, result2}
+	fake.storeChainCheckpointReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTime() (time.Time, error) {
-	fake.getLatestCFEventTimeMutex.Lock()
-	ret, specificReturn := fake.getLatestCFEventTimeReturnsOnCall[len(fake.getLatestCFEventTimeArgsForCall)]
-	fake.getLatestCFEventTimeArgsForCall = append(fake.getLatestCFEventTimeArgsForCall, struct {
-	}{})
-	fake.recordInvocation("GetLatestCFEventTime", []interface{}{})
-	fake.getLatestCFEventTimeMutex.Unlock()
-	if fake.GetLatestCFEventTimeStub != nil {
-		return fake.GetLatestCFEventTimeStub()
+func (fake *FakeEventDB) StoreResourceNames(arg1 []db.ResourceName) error {
+	var arg1Copy []db.ResourceName
+	if arg1 != nil {
+		arg1Copy = make([]db.ResourceName, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.storeResourceNamesMutex.Lock()
+	ret, specificReturn := fake.storeResourceNamesReturnsOnCall[len(fake.storeResourceNamesArgsForCall)]
+	fake.storeResourceNamesArgsForCall = append(fake.storeResourceNamesArgsForCall, struct {
+		arg1 []db.ResourceName
+	}{arg1Copy})
+	fake.recordInvocation("StoreResourceNames", []interface{}{arg1Copy})
+	fake.storeResourceNamesMutex.Unlock()
+	if fake.StoreResourceNamesStub != nil {
+		return fake.StoreResourceNamesStub(arg1)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2
+		return ret.result1
 	}
-	fakeReturns := fake.getLatestCFEventTimeReturns
-	return fakeReturns.result1, fakeReturns.result2
+	fakeReturns := fake.storeResourceNamesReturns
+	return fakeReturns.result1
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTimeCallCount() int {
-	fake.getLatestCFEventTimeMutex.RLock()
-	defer fake.getLatestCFEventTimeMutex.RUnlock()
-	return len(fake.getLatestCFEventTimeArgsForCall)
+func (fake *FakeEventDB) StoreResourceNamesCallCount() int {
+	fake.storeResourceNamesMutex.RLock()
+	defer fake.storeResourceNamesMutex.RUnlock()
+	return len(fake.storeResourceNamesArgsForCall)
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTimeCalls(stub func() (time.Time, error)) {
-	fake.getLatestCFEventTimeMutex.Lock()
-	defer fake.getLatestCFEventTimeMutex.Unlock()
-	fake.GetLatestCFEventTimeStub = stub
+func (fake *FakeEventDB) StoreResourceNamesCalls(stub func([]db.ResourceName) error) {
+	fake.storeResourceNamesMutex.Lock()
+	defer fake.storeResourceNamesMutex.Unlock()
+	fake.StoreResourceNamesStub = stub
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTimeReturns(result1 time.Time, result2 error) {
-	fake.getLatestCFEventTimeMutex.Lock()
-	defer fake.getLatestCFEventTimeMutex.Unlock()
-	fake.GetLatestCFEventTimeStub = nil
-	fake.getLatestCFEventTimeReturns = struct {
-		result1 time.Time
-		result2 error
-	}{result1, result2}
+func (fake *FakeEventDB) StoreResourceNamesArgsForCall(i int) []db.ResourceName {
+	fake.storeResourceNamesMutex.RLock()
+	defer fake.storeResourceNamesMutex.RUnlock()
+	argsForCall := fake.storeResourceNamesArgsForCall[i]
+	return argsForCall.arg1
 }
 
-func (fake *FakeEventDB) GetLatestCFEventTimeReturnsOnCall(i int, result1 time.Time, result2 error) {
-	fake.getLatestCFEventTimeMutex.Lock()
-	defer fake.getLatestCFEventTimeMutex.Unlock()
-	fake.GetLatestCFEventTimeStub = nil
-	if fake.getLatestCFEventTimeReturnsOnCall == nil {
-		fake.getLatestCFEventTimeReturnsOnCall = make(map[int]struct {
-			result1 time.Time
-			result2 error
+func (fake *FakeEventDB) StoreResourceNamesReturns(result1 error) {
+	fake.storeResourceNamesMutex.Lock()
+	defer fake.storeResourceNamesMutex.Unlock()
+	fake.StoreResourceNamesStub = nil
+	fake.storeResourceNamesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) StoreResourceNamesReturnsOnCall(i int, result1 error) {
+	fake.storeResourceNamesMutex.Lock()
+	defer fake.storeResourceNamesMutex.Unlock()
+	fake.StoreResourceNamesStub = nil
+	if fake.storeResourceNamesReturnsOnCall == nil {
+		fake.storeResourceNamesReturnsOnCall = make(map[int]struct {
+			result1 error
 		})
 	}
-	fake.getLatestCFEventTimeReturnsOnCall[i] = struct {
-		result1 time.Time
-		result2 error
-	}{result1, result2}
+	fake.storeResourceNamesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipper(arg1 string) ([]cfclient.Event, error) {
-	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
-	ret, specificReturn := fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)]
-	fake.getUnshippedCFAuditEventsForShipperArgsForCall = append(fake.getUnshippedCFAuditEventsForShipperArgsForCall, struct {
-		arg1 string
-	}{arg1})
-	fake.recordInvocation("GetUnshippedCFAuditEventsForShipper", []interface{}{arg1})
-	fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
-	if fake.GetUnshippedCFAuditEventsForShipperStub != nil {
-		return fake.GetUnshippedCFAuditEventsForShipperStub(arg1)
+func (fake *FakeEventDB) StreamCFAuditEvents(arg1 context.Context, arg2 db.RawEventFilter, arg3 func(db.CFAuditEvent) error) error {
+	fake.streamCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.streamCFAuditEventsReturnsOnCall[len(fake.streamCFAuditEventsArgsForCall)]
+	fake.streamCFAuditEventsArgsForCall = append(fake.streamCFAuditEventsArgsForCall, struct {
+		arg1 context.Context
+		arg2 db.RawEventFilter
+		arg3 func(db.CFAuditEvent) error
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("StreamCFAuditEvents", []interface{}{arg1, arg2, arg3})
+	fake.streamCFAuditEventsMutex.Unlock()
+	if fake.StreamCFAuditEventsStub != nil {
+		return fake.StreamCFAuditEventsStub(arg1, arg2, arg3)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2
+		return ret.result1
 	}
-	fakeReturns := fake.getUnshippedCFAuditEventsForShipperReturns
-	return fakeReturns.result1, fakeReturns.result2
+	fakeReturns := fake.streamCFAuditEventsReturns
+	return fakeReturns.result1
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCallCount() int {
-	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
-	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
-	return len(fake.getUnshippedCFAuditEventsForShipperArgsForCall)
+func (fake *FakeEventDB) StreamCFAuditEventsCallCount() int {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	return len(fake.streamCFAuditEventsArgsForCall)
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperCalls(stub func(string) ([]cfclient.Event, error)) {
-	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
-	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
-	fake.GetUnshippedCFAuditEventsForShipperStub = stub
+func (fake *FakeEventDB) StreamCFAuditEventsCalls(stub func(context.Context, db.RawEventFilter, func(db.CFAuditEvent) error) error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = stub
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperArgsForCall(i int) string {
-	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
-	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
-	argsForCall := fake.getUnshippedCFAuditEventsForShipperArgsForCall[i]
-	return argsForCall.arg1
+func (fake *FakeEventDB) StreamCFAuditEventsArgsForCall(i int) (context.Context, db.RawEventFilter, func(db.CFAuditEvent) error) {
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.streamCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturns(result1 []cfclient.Event, result2 error) {
-	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
-	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
-	fake.GetUnshippedCFAuditEventsForShipperStub = nil
-	fake.getUnshippedCFAuditEventsForShipperReturns = struct {
-		result1 []cfclient.Event
-		result2 error
-	}{result1, result2}
+func (fake *FakeEventDB) StreamCFAuditEventsReturns(result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	fake.streamCFAuditEventsReturns = struct {
+		result1 error
+	}{result1}
 }
 
-func (fake *FakeEventDB) GetUnshippedCFAuditEventsForShipperReturnsOnCall(i int, result1 []cfclient.Event, result2 error) {
-	fake.getUnshippedCFAuditEventsForShipperMutex.Lock()
-	defer fake.getUnshippedCFAuditEventsForShipperMutex.Unlock()
-	fake.GetUnshippedCFAuditEventsForShipperStub = nil
-	if fake.getUnshippedCFAuditEventsForShipperReturnsOnCall == nil {
-		fake.getUnshippedCFAuditEventsForShipperReturnsOnCall = make(map[int]struct {
-			result1 []cfclient.Event
-			result2 error
+func (fake *FakeEventDB) StreamCFAuditEventsReturnsOnCall(i int, result1 error) {
+	fake.streamCFAuditEventsMutex.Lock()
+	defer fake.streamCFAuditEventsMutex.Unlock()
+	fake.StreamCFAuditEventsStub = nil
+	if fake.streamCFAuditEventsReturnsOnCall == nil {
+		fake.streamCFAuditEventsReturnsOnCall = make(map[int]struct {
+			result1 error
 		})
 	}
-	fake.getUnshippedCFAuditEventsForShipperReturnsOnCall[i] = struct {
-		result1 []cfclient.Event
-		result2 error
-	}{result1, result2}
+	fake.streamCFAuditEventsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
 }
 
-func (fake *FakeEventDB) Init() error {
-	fake.initMutex.Lock()
-	ret, specificReturn := fake.initReturnsOnCall[len(fake.initArgsForCall)]
-	fake.initArgsForCall = append(fake.initArgsForCall, struct {
-	}{})
-	fake.recordInvocation("Init", []interface{}{})
-	fake.initMutex.Unlock()
-	if fake.InitStub != nil {
-		return fake.InitStub()
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEvents(arg1 context.Context, arg2 string, arg3 func(db.CFAuditEvent) error) error {
+	fake.streamUnevaluatedCFAuditEventsMutex.Lock()
+	ret, specificReturn := fake.streamUnevaluatedCFAuditEventsReturnsOnCall[len(fake.streamUnevaluatedCFAuditEventsArgsForCall)]
+	fake.streamUnevaluatedCFAuditEventsArgsForCall = append(fake.streamUnevaluatedCFAuditEventsArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 func(db.CFAuditEvent) error
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("StreamUnevaluatedCFAuditEvents", []interface{}{arg1, arg2, arg3})
+	fake.streamUnevaluatedCFAuditEventsMutex.Unlock()
+	if fake.StreamUnevaluatedCFAuditEventsStub != nil {
+		return fake.StreamUnevaluatedCFAuditEventsStub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.initReturns
+	fakeReturns := fake.streamUnevaluatedCFAuditEventsReturns
 	return fakeReturns.result1
 }
 
-func (fake *FakeEventDB) InitCallCount() int {
-	fake.initMutex.RLock()
-	defer fake.initMutex.RUnlock()
-	return len(fake.initArgsForCall)
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEventsCallCount() int {
+	fake.streamUnevaluatedCFAuditEventsMutex.RLock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.RUnlock()
+	return len(fake.streamUnevaluatedCFAuditEventsArgsForCall)
 }
 
-func (fake *FakeEventDB) InitCalls(stub func() error) {
-	fake.initMutex.Lock()
-	defer fake.initMutex.Unlock()
-	fake.InitStub = stub
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEventsCalls(stub func(context.Context, string, func(db.CFAuditEvent) error) error) {
+	fake.streamUnevaluatedCFAuditEventsMutex.Lock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.Unlock()
+	fake.StreamUnevaluatedCFAuditEventsStub = stub
 }
 
-func (fake *FakeEventDB) InitReturns(result1 error) {
-	fake.initMutex.Lock()
-	defer fake.initMutex.Unlock()
-	fake.InitStub = nil
-	fake.initReturns = struct {
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEventsArgsForCall(i int) (context.Context, string, func(db.CFAuditEvent) error) {
+	fake.streamUnevaluatedCFAuditEventsMutex.RLock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.RUnlock()
+	argsForCall := fake.streamUnevaluatedCFAuditEventsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEventsReturns(result1 error) {
+	fake.streamUnevaluatedCFAuditEventsMutex.Lock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.Unlock()
+	fake.StreamUnevaluatedCFAuditEventsStub = nil
+	fake.streamUnevaluatedCFAuditEventsReturns = struct {
 		result1 error
 	}{result1}
 }
 
-func (fake *FakeEventDB) InitReturnsOnCall(i int, result1 error) {
-	fake.initMutex.Lock()
-	defer fake.initMutex.Unlock()
-	fake.InitStub = nil
-	if fake.initReturnsOnCall == nil {
-		fake.initReturnsOnCall = make(map[int]struct {
+func (fake *FakeEventDB) StreamUnevaluatedCFAuditEventsReturnsOnCall(i int, result1 error) {
+	fake.streamUnevaluatedCFAuditEventsMutex.Lock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.Unlock()
+	fake.StreamUnevaluatedCFAuditEventsStub = nil
+	if fake.streamUnevaluatedCFAuditEventsReturnsOnCall == nil {
+		fake.streamUnevaluatedCFAuditEventsReturnsOnCall = make(map[int]struct {
 			result1 error
 		})
 	}
-	fake.initReturnsOnCall[i] = struct {
+	fake.streamUnevaluatedCFAuditEventsReturnsOnCall[i] = struct {
 		result1 error
 	}{result1}
 }
 
-func (fake *FakeEventDB) StoreCFAuditEvents(arg1 []cfclient.Event) error {
-	var arg1Copy []cfclient.Event
-	if arg1 != nil {
-		arg1Copy = make([]cfclient.Event, len(arg1))
-		copy(arg1Copy, arg1)
+func (fake *FakeEventDB) UpdateArchiveCursor(arg1 int64) error {
+	fake.updateArchiveCursorMutex.Lock()
+	ret, specificReturn := fake.updateArchiveCursorReturnsOnCall[len(fake.updateArchiveCursorArgsForCall)]
+	fake.updateArchiveCursorArgsForCall = append(fake.updateArchiveCursorArgsForCall, struct {
+		arg1 int64
+	}{arg1})
+	fake.recordInvocation("UpdateArchiveCursor", []interface{}{arg1})
+	fake.updateArchiveCursorMutex.Unlock()
+	if fake.UpdateArchiveCursorStub != nil {
+		return fake.UpdateArchiveCursorStub(arg1)
 	}
-	fake.storeCFAuditEventsMutex.Lock()
-	ret, specificReturn := fake.storeCFAuditEventsReturnsOnCall[len(fake.storeCFAuditEventsArgsForCall)]
-	fake.storeCFAuditEventsArgsForCall = append(fake.storeCFAuditEventsArgsForCall, struct {
-		arg1 []cfclient.Event
-	}{arg1Copy})
-	fake.recordInvocation("StoreCFAuditEvents", []interface{}{arg1Copy})
-	fake.storeCFAuditEventsMutex.Unlock()
-	if fake.StoreCFAuditEventsStub != nil {
-		return fake.StoreCFAuditEventsStub(arg1)
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.updateArchiveCursorReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeEventDB) UpdateArchiveCursorCallCount() int {
+	fake.updateArchiveCursorMutex.RLock()
+	defer fake.updateArchiveCursorMutex.RUnlock()
+	return len(fake.updateArchiveCursorArgsForCall)
+}
+
+func (fake *FakeEventDB) UpdateArchiveCursorCalls(stub func(int64) error) {
+	fake.updateArchiveCursorMutex.Lock()
+	defer fake.updateArchiveCursorMutex.Unlock()
+	fake.UpdateArchiveCursorStub = stub
+}
+
+func (fake *FakeEventDB) UpdateArchiveCursorArgsForCall(i int) int64 {
+	fake.updateArchiveCursorMutex.RLock()
+	defer fake.updateArchiveCursorMutex.RUnlock()
+	argsForCall := fake.updateArchiveCursorArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEventDB) UpdateArchiveCursorReturns(result1 error) {
+	fake.updateArchiveCursorMutex.Lock()
+	defer fake.updateArchiveCursorMutex.Unlock()
+	fake.UpdateArchiveCursorStub = nil
+	fake.updateArchiveCursorReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateArchiveCursorReturnsOnCall(i int, result1 error) {
+	fake.updateArchiveCursorMutex.Lock()
+	defer fake.updateArchiveCursorMutex.Unlock()
+	fake.UpdateArchiveCursorStub = nil
+	if fake.updateArchiveCursorReturnsOnCall == nil {
+		fake.updateArchiveCursorReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.updateArchiveCursorReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEventDB) UpdateBackfillWindow(arg1 db.BackfillWindow) error {
+	fake.updateBackfillWindowMutex.Lock()
+	ret, specificReturn := fake.updateBackfillWindowReturnsOnCall[len(fake.updateBackfillWindowArgsForCall)]
+	fake.updateBackfillWindowArgsForCall = append(fake.updateBackfillWindowArgsForCall, struct {
+		arg1 db.BackfillWindow
+	}{arg1})
+	fake.recordInvocation("UpdateBackfillWindow", []interface{}{arg1})
+	fake.updateBackfillWindowMutex.Unlock()
+	if fake.UpdateBackfillWindowStub != nil {
+		return fake.UpdateBackfillWindowStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.storeCFAuditEventsReturns
+	fakeReturns := fake.updateBackfillWindowReturns
 	return fakeReturns.result1
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsCallCount() int {
-	fake.storeCFAuditEventsMutex.RLock()
-	defer fake.storeCFAuditEventsMutex.RUnlock()
-	return len(fake.storeCFAuditEventsArgsForCall)
+func (fake *FakeEventDB) UpdateBackfillWindowCallCount() int {
+	fake.updateBackfillWindowMutex.RLock()
+	defer fake.updateBackfillWindowMutex.RUnlock()
+	return len(fake.updateBackfillWindowArgsForCall)
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsCalls(stub func([]cfclient.Event) error) {
-	fake.storeCFAuditEventsMutex.Lock()
-	defer fake.storeCFAuditEventsMutex.Unlock()
-	fake.StoreCFAuditEventsStub = stub
+func (fake *FakeEventDB) UpdateBackfillWindowCalls(stub func(db.BackfillWindow) error) {
+	fake.updateBackfillWindowMutex.Lock()
+	defer fake.updateBackfillWindowMutex.Unlock()
+	fake.UpdateBackfillWindowStub = stub
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsArgsForCall(i int) []cfclient.Event {
-	fake.storeCFAuditEventsMutex.RLock()
-	defer fake.storeCFAuditEventsMutex.RUnlock()
-	argsForCall := fake.storeCFAuditEventsArgsForCall[i]
+func (fake *FakeEventDB) UpdateBackfillWindowArgsForCall(i int) db.BackfillWindow {
+	fake.updateBackfillWindowMutex.RLock()
+	defer fake.updateBackfillWindowMutex.RUnlock()
+	argsForCall := fake.updateBackfillWindowArgsForCall[i]
 	return argsForCall.arg1
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsReturns(result1 error) {
-	fake.storeCFAuditEventsMutex.Lock()
-	defer fake.storeCFAuditEventsMutex.Unlock()
-	fake.StoreCFAuditEventsStub = nil
-	fake.storeCFAuditEventsReturns = struct {
+func (fake *FakeEventDB) UpdateBackfillWindowReturns(result1 error) {
+	fake.updateBackfillWindowMutex.Lock()
+	defer fake.updateBackfillWindowMutex.Unlock()
+	fake.UpdateBackfillWindowStub = nil
+	fake.updateBackfillWindowReturns = struct {
 		result1 error
 	}{result1}
 }
 
-func (fake *FakeEventDB) StoreCFAuditEventsReturnsOnCall(i int, result1 error) {
-	fake.storeCFAuditEventsMutex.Lock()
-	defer fake.storeCFAuditEventsMutex.Unlock()
-	fake.StoreCFAuditEventsStub = nil
-	if fake.storeCFAuditEventsReturnsOnCall == nil {
-		fake.storeCFAuditEventsReturnsOnCall = make(map[int]struct {
+func (fake *FakeEventDB) UpdateBackfillWindowReturnsOnCall(i int, result1 error) {
+	fake.updateBackfillWindowMutex.Lock()
+	defer fake.updateBackfillWindowMutex.Unlock()
+	fake.UpdateBackfillWindowStub = nil
+	if fake.updateBackfillWindowReturnsOnCall == nil {
+		fake.updateBackfillWindowReturnsOnCall = make(map[int]struct {
 			result1 error
 		})
 	}
-	fake.storeCFAuditEventsReturnsOnCall[i] = struct {
+	fake.updateBackfillWindowReturnsOnCall[i] = struct {
 		result1 error
 	}{result1}
 }
 
-func (fake *FakeEventDB) UpdateShipperCursor(arg1 string, arg2 string, arg3 string) error {
+func (fake *FakeEventDB) UpdateShipperCursor(arg1 string, arg2 db.CFAuditEvent) error {
 	fake.updateShipperCursorMutex.Lock()
 	ret, specificReturn := fake.updateShipperCursorReturnsOnCall[len(fake.updateShipperCursorArgsForCall)]
 	fake.updateShipperCursorArgsForCall = append(fake.updateShipperCursorArgsForCall, struct {
 		arg1 string
-		arg2 string
-		arg3 string
-	}{arg1, arg2, arg3})
-	fake.recordInvocation("UpdateShipperCursor", []interface{}{arg1, arg2, arg3})
+		arg2 db.CFAuditEvent
+	}{arg1, arg2})
+	fake.recordInvocation("UpdateShipperCursor", []interface{}{arg1, arg2})
 	fake.updateShipperCursorMutex.Unlock()
 	if fake.UpdateShipperCursorStub != nil {
-		return fake.UpdateShipperCursorStub(arg1, arg2, arg3)
+		return fake.UpdateShipperCursorStub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -477,17 +3178,17 @@ func (fake *FakeEventDB) UpdateShipperCursorCallCount() int {
 	return len(fake.updateShipperCursorArgsForCall)
 }
 
-func (fake *FakeEventDB) UpdateShipperCursorCalls(stub func(string, string, string) error) {
+func (fake *FakeEventDB) UpdateShipperCursorCalls(stub func(string, db.CFAuditEvent) error) {
 	fake.updateShipperCursorMutex.Lock()
 	defer fake.updateShipperCursorMutex.Unlock()
 	fake.UpdateShipperCursorStub = stub
 }
 
-func (fake *FakeEventDB) UpdateShipperCursorArgsForCall(i int) (string, string, string) {
+func (fake *FakeEventDB) UpdateShipperCursorArgsForCall(i int) (string, db.CFAuditEvent) {
 	fake.updateShipperCursorMutex.RLock()
 	defer fake.updateShipperCursorMutex.RUnlock()
 	argsForCall := fake.updateShipperCursorArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeEventDB) UpdateShipperCursorReturns(result1 error) {
@@ -516,18 +3217,90 @@ func (fake *FakeEventDB) UpdateShipperCursorReturnsOnCall(i int, result1 error)
 func (fake *FakeEventDB) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.acquireLeaderLeaseMutex.RLock()
+	defer fake.acquireLeaderLeaseMutex.RUnlock()
+	fake.backfillCFAuditEventsMutex.RLock()
+	defer fake.backfillCFAuditEventsMutex.RUnlock()
+	fake.countUnarchivedCFAuditEventsMutex.RLock()
+	defer fake.countUnarchivedCFAuditEventsMutex.RUnlock()
+	fake.createBackfillJobMutex.RLock()
+	defer fake.createBackfillJobMutex.RUnlock()
+	fake.deleteArchivedCFAuditEventsMutex.RLock()
+	defer fake.deleteArchivedCFAuditEventsMutex.RUnlock()
+	fake.ensureCFAuditEventPartitionMutex.RLock()
+	defer fake.ensureCFAuditEventPartitionMutex.RUnlock()
+	fake.eraseUserFromCFAuditEventsMutex.RLock()
+	defer fake.eraseUserFromCFAuditEventsMutex.RUnlock()
+	fake.getBackfillJobMutex.RLock()
+	defer fake.getBackfillJobMutex.RUnlock()
+	fake.getBackfillJobsMutex.RLock()
+	defer fake.getBackfillJobsMutex.RUnlock()
+	fake.getBackfillWindowsMutex.RLock()
+	defer fake.getBackfillWindowsMutex.RUnlock()
+	fake.getCFAuditEventArchivesMutex.RLock()
+	defer fake.getCFAuditEventArchivesMutex.RUnlock()
+	fake.getCFAuditEventArchivesWithLateEventsMutex.RLock()
+	defer fake.getCFAuditEventArchivesWithLateEventsMutex.RUnlock()
+	fake.getCFAuditEventErasuresMutex.RLock()
+	defer fake.getCFAuditEventErasuresMutex.RUnlock()
+	fake.getCFAuditEventPartitionHoldsMutex.RLock()
+	defer fake.getCFAuditEventPartitionHoldsMutex.RUnlock()
+	fake.getCFAuditEventPartitionsMutex.RLock()
+	defer fake.getCFAuditEventPartitionsMutex.RUnlock()
 	fake.getCFAuditEventsMutex.RLock()
 	defer fake.getCFAuditEventsMutex.RUnlock()
-	fake.getCFEventCountMutex.RLock()
-	defer fake.getCFEventCountMutex.RUnlock()
+	fake.getCFEventCountsMutex.RLock()
+	defer fake.getCFEventCountsMutex.RUnlock()
+	fake.getChainHeadMutex.RLock()
+	defer fake.getChainHeadMutex.RUnlock()
+	fake.getEarliestCFEventTimeMutex.RLock()
+	defer fake.getEarliestCFEventTimeMutex.RUnlock()
+	fake.getLastAlertDeliveryTimeMutex.RLock()
+	defer fake.getLastAlertDeliveryTimeMutex.RUnlock()
+	fake.getLatestCFAuditEventArchiveMutex.RLock()
+	defer fake.getLatestCFAuditEventArchiveMutex.RUnlock()
 	fake.getLatestCFEventTimeMutex.RLock()
 	defer fake.getLatestCFEventTimeMutex.RUnlock()
+	fake.getLatestChainCheckpointMutex.RLock()
+	defer fake.getLatestChainCheckpointMutex.RUnlock()
+	fake.getResourceNamesMutex.RLock()
+	defer fake.getResourceNamesMutex.RUnlock()
+	fake.getUndeliveredAlertsMutex.RLock()
+	defer fake.getUndeliveredAlertsMutex.RUnlock()
 	fake.getUnshippedCFAuditEventsForShipperMutex.RLock()
 	defer fake.getUnshippedCFAuditEventsForShipperMutex.RUnlock()
+	fake.holdCFAuditEventPartitionMutex.RLock()
+	defer fake.holdCFAuditEventPartitionMutex.RUnlock()
 	fake.initMutex.RLock()
 	defer fake.initMutex.RUnlock()
+	fake.initAlertCursorMutex.RLock()
+	defer fake.initAlertCursorMutex.RUnlock()
+	fake.releaseLeaderLeaseMutex.RLock()
+	defer fake.releaseLeaderLeaseMutex.RUnlock()
+	fake.removeCFAuditEventPartitionMutex.RLock()
+	defer fake.removeCFAuditEventPartitionMutex.RUnlock()
+	fake.restoreCFAuditEventsMutex.RLock()
+	defer fake.restoreCFAuditEventsMutex.RUnlock()
+	fake.storeAlertDeliveryMutex.RLock()
+	defer fake.storeAlertDeliveryMutex.RUnlock()
+	fake.storeAlertsMutex.RLock()
+	defer fake.storeAlertsMutex.RUnlock()
+	fake.storeCFAuditEventArchiveMutex.RLock()
+	defer fake.storeCFAuditEventArchiveMutex.RUnlock()
 	fake.storeCFAuditEventsMutex.RLock()
 	defer fake.storeCFAuditEventsMutex.RUnlock()
+	fake.storeChainCheckpointMutex.RLock()
+	defer fake.storeChainCheckpointMutex.RUnlock()
+	fake.storeResourceNamesMutex.RLock()
+	defer fake.storeResourceNamesMutex.RUnlock()
+	fake.streamCFAuditEventsMutex.RLock()
+	defer fake.streamCFAuditEventsMutex.RUnlock()
+	fake.streamUnevaluatedCFAuditEventsMutex.RLock()
+	defer fake.streamUnevaluatedCFAuditEventsMutex.RUnlock()
+	fake.updateArchiveCursorMutex.RLock()
+	defer fake.updateArchiveCursorMutex.RUnlock()
+	fake.updateBackfillWindowMutex.RLock()
+	defer fake.updateBackfillWindowMutex.RUnlock()
 	fake.updateShipperCursorMutex.RLock()
 	defer fake.updateShipperCursorMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// Lease is an instance's claim on the leader lease of a role. Its generation
+// is that of the lease when the instance last acquired or renewed it, or 0 if
+// it does not hold it. The lease's generation goes up each time the lease
+// changes hands, so it tells an instance's terms as leader apart.
+type Lease struct {
+	Role   string
+	Holder string
+
+	generation int64
+}
+
+func NewLease(role string, holder string) *Lease {
+	return &Lease{Role: role, Holder: holder}
+}
+
+// Generation returns the generation of the lease held, or 0 if it is not held
+func (l *Lease) Generation() int64 {
+	return atomic.LoadInt64(&l.generation)
+}
+
+func (l *Lease) setGeneration(generation int64) {
+	atomic.StoreInt64(&l.generation, generation)
+}
+
+// WithLease returns a copy of the store whose writes are fenced by lease:
+// they are only committed if the lease is still held by its holder, with the
+// generation it had when the holder last acquired or renewed it. A leader
+// which has lost its lease without noticing, for example because it was
+// paused, cannot then overwrite the writes of the instance which took over.
+// The copy shares the store's connections and statements, so only the
+// original should be closed.
+func (s *EventStore) WithLease(lease *Lease) *EventStore {
+	fenced := *s
+	fenced.lease = lease
+	return &fenced
+}
+
+// AcquireLeaderLease takes the lease for its role if it is free or has
+// expired, or extends it if its holder already has it. It reports whether the
+// holder now has the lease, and records the lease's generation in it. Expiry
+// uses the database clock so instances need not agree on time.
+func (s *EventStore) AcquireLeaderLease(lease *Lease, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultLeaseTimeout)
+	defer cancel()
+
+	var (
+		currentHolder string
+		generation    int64
+	)
+	err := s.querier(ctx, nil).QueryRow(`
+		insert into `+LeaderLeasesTable+` as lease (role, holder, expires_at) values (
+			$1, $2, now() + $3::bigint * interval '1 millisecond'
+		) on conflict (role) do
+		update set
+			holder = excluded.holder,
+			expires_at = excluded.expires_at,
+			generation = case
+				when lease.holder = excluded.holder and lease.expires_at > now() then lease.generation
+				else lease.generation + 1
+			end
+		where
+			lease.holder = excluded.holder
+			or lease.expires_at <= now()
+		returning holder, generation
+	`, lease.Role, lease.Holder, ttl.Milliseconds()).Scan(&currentHolder, &generation)
+	if err == sql.ErrNoRows || (err == nil && currentHolder != lease.Holder) {
+		lease.setGeneration(0)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	lease.setGeneration(generation)
+	return true, nil
+}
+
+// ReleaseLeaderLease gives up the lease if its holder has it, so that a
+// standby can take over without waiting for it to expire. The lease's row is
+// kept, expired, so that its generation keeps going up.
+func (s *EventStore) ReleaseLeaderLease(lease *Lease) error {
+	lease.setGeneration(0)
+
+	// The lease is usually released while shutting down, after s.ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultLeaseTimeout)
+	defer cancel()
+
+	_, err := s.querier(ctx, nil).Exec(`
+		update `+LeaderLeasesTable+` set expires_at = now()
+		where role = $1 and holder = $2
+	`, lease.Role, lease.Holder)
+	return err
+}
+
+// checkLease returns ErrLeaseLost unless the store has no lease, or its lease
+// is still held with the generation it was acquired with. The lease's row is
+// locked until the end of the transaction, so the lease cannot change hands
+// before a write checked with it is committed.
+func (s *EventStore) checkLease(q querier) error {
+	if s.lease == nil {
+		return nil
+	}
+	generation := s.lease.Generation()
+	if generation == 0 {
+		return ErrLeaseLost
+	}
+
+	var current int64
+	err := q.QueryRow(`
+		select generation from `+LeaderLeasesTable+`
+		where role = $1 and holder = $2 and expires_at > now()
+		for share
+	`, s.lease.Role, s.lease.Holder).Scan(&current)
+	if err == sql.ErrNoRows || (err == nil && current != generation) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// commit commits a write transaction, once checkLease has made sure the
+// store's lease is still held. The lease is checked last, so that its row is
+// only locked briefly, and renewing it is not held up by long writes.
+func (s *EventStore) commit(q querier, tx *sql.Tx) error {
+	if err := s.checkLease(q); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// write runs fn in a transaction, which is committed by commit
+func (s *EventStore) write(ctx context.Context, fn func(q querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+
+	if err := fn(q); err != nil {
+		return err
+	}
+	return s.commit(q, tx)
+}
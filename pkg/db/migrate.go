@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Migrations are the numbered SQL files in migrations/, which are built into
+// the binary. Each is applied once, in order, in its own transaction, and
+// recorded in schema_migrations.
+//
+// The migrations up to 0005 were run on every boot before schema_migrations
+// existed, so they are written to be idempotent. They are applied again,
+// harmlessly, the first time a database that already has them is migrated.
+// Later migrations do not need to be.
+
+const (
+	SchemaMigrationsTable = "schema_migrations"
+
+	// migrationLockID is the key of the session level advisory lock held
+	// while migrating, so that instances starting together take turns
+	migrationLockID = 4620061915
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFilename = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+
+	// Modified is set if the migration has been edited since it was applied
+	Modified bool
+}
+
+// Migrations returns the migrations built into the binary, in order
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, entry := range entries {
+		match := migrationFilename.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: filename must look like 0001_some_name.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(contents)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     match[2],
+			SQL:      string(contents),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: expected version %04d, versions must start at 1 with no gaps", m.Version, m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrationStatus returns every migration and whether it has been applied
+func (s *EventStore) MigrationStatus() ([]MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return migrationStatus(ctx, conn)
+}
+
+// Migrate applies the migrations which have not been applied yet, and returns
+// them. If dryRun is set it only returns them.
+func (s *EventStore) Migrate(dryRun bool) ([]Migration, error) {
+	lsession := s.logger.Session("migrate", lager.Data{"dry_run": dryRun})
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultInitTimeout)
+	defer cancel()
+
+	// Advisory locks belong to a connection, so hold on to one
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if !dryRun {
+		if _, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return nil, err
+		}
+		defer func() {
+			// Use a fresh context in case ctx has timed out
+			unlockCtx, cancel := context.WithTimeout(context.Background(), DefaultLeaseTimeout)
+			defer cancel()
+			if _, err := conn.ExecContext(unlockCtx, `select pg_advisory_unlock($1)`, migrationLockID); err != nil {
+				lsession.Error("err-advisory-unlock", err)
+			}
+		}()
+
+		_, err := conn.ExecContext(ctx, `
+			create table if not exists `+SchemaMigrationsTable+` (
+				version integer not null,
+				name text not null,
+				checksum text not null,
+				applied_at timestamptz not null,
+
+				primary key (version)
+			)
+		`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses, err := migrationStatus(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, status := range statuses {
+		if status.Modified {
+			lsession.Info("migration-modified-since-applied", lager.Data{
+				"version": status.Version,
+				"name":    status.Name,
+			})
+		}
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	if dryRun {
+		return pending, nil
+	}
+
+	for _, m := range pending {
+		if err := applyMigration(ctx, lsession, conn, m); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func applyMigration(ctx context.Context, lsession lager.Logger, conn *sql.Conn, m Migration) error {
+	startTime := time.Now()
+	data := lager.Data{"version": m.Version, "name": m.Name}
+	lsession.Info("apply-migration", data)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	filename := fmt.Sprintf("%04d_%s.sql", m.Version, m.Name)
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return wrapPqError(err, filename)
+	}
+	_, err = tx.Exec(`
+		insert into `+SchemaMigrationsTable+` (version, name, checksum, applied_at)
+		values ($1, $2, $3, now())
+	`, m.Version, m.Name, m.Checksum)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	data["elapsed"] = time.Since(startTime)
+	lsession.Info("applied-migration", data)
+	return nil
+}
+
+func migrationStatus(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = conn.QueryRowContext(ctx, `select to_regclass($1) is not null`, SchemaMigrationsTable).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		statuses := []MigrationStatus{}
+		for _, m := range migrations {
+			statuses = append(statuses, MigrationStatus{Migration: m})
+		}
+		return statuses, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `select version, checksum, applied_at from `+SchemaMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		status := MigrationStatus{Applied: true}
+		if err := rows.Scan(&status.Version, &status.Checksum, &status.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			status.Modified = a.Checksum != m.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,26 @@
+package db_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Migrations", func() {
+	It("are built into the binary in version order", func() {
+		migrations, err := db.Migrations()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(migrations)).To(BeNumerically(">=", 5))
+
+		for i, m := range migrations {
+			Expect(m.Version).To(Equal(i + 1))
+			Expect(m.Name).NotTo(BeEmpty())
+			Expect(m.SQL).NotTo(BeEmpty())
+			Expect(m.Checksum).To(HaveLen(64))
+		}
+
+		Expect(migrations[0].Name).To(Equal("create_cf_audit_events"))
+		Expect(migrations[1].Name).To(Equal("create_shipper_cursors"))
+	})
+})
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS leader_leases (
+	role text NOT NULL,
+	holder text NOT NULL,
+	expires_at timestamptz NOT NULL,
+	PRIMARY KEY (role)
+);
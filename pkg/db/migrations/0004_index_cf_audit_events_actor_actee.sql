@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS cf_audit_events_actor_idx ON cf_audit_events (actor);
+CREATE INDEX IF NOT EXISTS cf_audit_events_actee_idx ON cf_audit_events (actee);
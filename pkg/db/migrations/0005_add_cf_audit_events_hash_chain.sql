@@ -0,0 +1,18 @@
+-- Tamper-evident hash chain, see chain.go. Rows are sealed, by setting both
+-- hashes, in the same transaction that stores them.
+ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS content_hash bytea;
+ALTER TABLE cf_audit_events ADD COLUMN IF NOT EXISTS chain_hash bytea;
+CREATE INDEX IF NOT EXISTS cf_audit_events_unsealed_idx ON cf_audit_events (id) WHERE chain_hash IS NULL;
+
+CREATE TABLE IF NOT EXISTS chain_checkpoints (
+	id SERIAL,
+	head_id bigint NOT NULL,
+	chain_hash bytea NOT NULL,
+	signed_at timestamptz NOT NULL,
+	key_id text NOT NULL,
+	signature bytea NOT NULL,
+
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS chain_checkpoints_head_id_idx ON chain_checkpoints (head_id);
@@ -0,0 +1,116 @@
+-- Partition cf_audit_events by the month of created_at, in UTC, so that old
+-- months can be removed by detaching a partition rather than deleting rows.
+-- The primary key of a partitioned table must include the partition key, so
+-- it becomes (guid, created_at). Needs Postgres 11 or later.
+
+-- cf_audit_events_ensure_partition creates the partition for the month
+-- containing the given time, if it does not exist, and reports whether it
+-- created it. Partitions are named cf_audit_events_YYYY_MM.
+CREATE OR REPLACE FUNCTION cf_audit_events_ensure_partition(month timestamptz) RETURNS boolean AS $$
+DECLARE
+	month_start timestamp := date_trunc('month', month AT TIME ZONE 'UTC');
+	partition_name text := 'cf_audit_events_' || to_char(month_start, 'YYYY_MM');
+BEGIN
+	IF to_regclass(partition_name) IS NOT NULL THEN
+		RETURN false;
+	END IF;
+	EXECUTE format(
+		'CREATE TABLE %I PARTITION OF cf_audit_events FOR VALUES FROM (%L) TO (%L)',
+		partition_name,
+		month_start AT TIME ZONE 'UTC',
+		(month_start + interval '1 month') AT TIME ZONE 'UTC'
+	);
+	RETURN true;
+END; $$ LANGUAGE plpgsql;
+
+-- Free up the names of the constraints, indexes and sequence of the old table
+ALTER TABLE cf_audit_events RENAME TO cf_audit_events_unpartitioned;
+ALTER TABLE cf_audit_events_unpartitioned RENAME CONSTRAINT cf_audit_events_pkey TO cf_audit_events_unpartitioned_pkey;
+ALTER TABLE cf_audit_events_unpartitioned DROP CONSTRAINT IF EXISTS cf_audit_events_guid_key;
+DROP INDEX IF EXISTS
+	cf_audit_events_id_idx,
+	cf_audit_events_guid_idx,
+	cf_audit_events_created_at_idx,
+	cf_audit_events_state_organization_guid_idx,
+	cf_audit_events_state_space_guid_idx,
+	cf_audit_events_state_event_type_idx,
+	cf_audit_events_actor_idx,
+	cf_audit_events_actee_idx,
+	cf_audit_events_unsealed_idx;
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY NONE;
+ALTER SEQUENCE cf_audit_events_id_seq AS bigint;
+
+CREATE TABLE cf_audit_events (
+	id bigint NOT NULL DEFAULT nextval('cf_audit_events_id_seq'),
+	guid uuid NOT NULL,
+	created_at timestamptz NOT NULL,
+	event_type text NOT NULL,
+	actor text NOT NULL,
+	actor_type text NOT NULL,
+	actor_name text NOT NULL,
+	actor_username text NOT NULL,
+	actee text NOT NULL,
+	actee_type text NOT NULL,
+	actee_name text NOT NULL,
+	organization_guid uuid,
+	space_guid uuid,
+	metadata jsonb,
+	content_hash bytea,
+	chain_hash bytea,
+
+	CONSTRAINT created_at_not_zero_value CHECK (created_at > 'epoch'::timestamptz),
+	PRIMARY KEY (guid, created_at)
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE cf_audit_events_id_seq OWNED BY cf_audit_events.id;
+
+-- Partitions for the existing events, and for this month and the next two
+SELECT cf_audit_events_ensure_partition(month) FROM (
+	SELECT DISTINCT date_trunc('month', created_at) AS month FROM cf_audit_events_unpartitioned
+	UNION
+	SELECT now() + n * interval '1 month' FROM generate_series(0, 2) AS n
+) AS months;
+
+INSERT INTO cf_audit_events (
+	id, guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata, content_hash, chain_hash
+) SELECT
+	id, guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata, content_hash, chain_hash
+FROM cf_audit_events_unpartitioned;
+
+DROP TABLE cf_audit_events_unpartitioned;
+
+-- Indexes on the partitioned table are created on every partition
+CREATE INDEX cf_audit_events_id_idx ON cf_audit_events (id);
+CREATE INDEX cf_audit_events_created_at_idx ON cf_audit_events (created_at);
+CREATE INDEX cf_audit_events_state_organization_guid_idx ON cf_audit_events (organization_guid);
+CREATE INDEX cf_audit_events_state_space_guid_idx ON cf_audit_events (space_guid);
+CREATE INDEX cf_audit_events_state_event_type_idx ON cf_audit_events (event_type);
+CREATE INDEX cf_audit_events_actor_idx ON cf_audit_events (actor);
+CREATE INDEX cf_audit_events_actee_idx ON cf_audit_events (actee);
+CREATE INDEX cf_audit_events_unsealed_idx ON cf_audit_events (id) WHERE chain_hash IS NULL;
+
+-- Removing a partition removes events from the middle of the hash chain.
+-- chain_anchors records the chain hash of the event before each gap that
+-- leaves, so that the chain can still be verified across it.
+CREATE TABLE chain_anchors (
+	next_id bigint NOT NULL,
+	previous_chain_hash bytea NOT NULL,
+	reason text NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (next_id)
+);
+
+-- cf_audit_event_partition_removals records each partition removed by the
+-- retention policy
+CREATE TABLE cf_audit_event_partition_removals (
+	partition_name text NOT NULL,
+	month timestamptz NOT NULL,
+	action text NOT NULL,
+	event_count bigint NOT NULL,
+	min_id bigint,
+	max_id bigint,
+	removed_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (partition_name, removed_at)
+);
@@ -0,0 +1,19 @@
+-- cf_audit_event_archives records each window of events uploaded to object
+-- storage by the archiver, and whether the archived rows have been deleted
+CREATE TABLE cf_audit_event_archives (
+	window_start timestamptz NOT NULL,
+	window_end timestamptz NOT NULL,
+	object_key text NOT NULL,
+	manifest_key text NOT NULL,
+	event_count bigint NOT NULL,
+	min_id bigint,
+	max_id bigint,
+	sha256 text NOT NULL,
+	size_bytes bigint NOT NULL,
+	archived_at timestamptz NOT NULL,
+	rows_deleted bigint,
+	rows_deleted_at timestamptz,
+
+	PRIMARY KEY (window_start),
+	CONSTRAINT window_is_not_empty CHECK (window_end > window_start)
+);
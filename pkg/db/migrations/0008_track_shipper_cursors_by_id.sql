@@ -0,0 +1,21 @@
+-- Shippers track the id of the last event they shipped, rather than its
+-- created_at, so that each event is shipped once, in the order it was stored.
+-- Events are only inserted while holding the chain lock, so ids become
+-- visible in order and a shipper never passes over an uncommitted event.
+ALTER TABLE shipper_cursors ADD COLUMN shipped_seq bigint;
+
+-- Carry on from the last event each shipper shipped. If it cannot be found,
+-- carry on after the events created before the cursor. Events stored after
+-- the last shipped event, but created before it, were shipped by the old
+-- cursor and are shipped once more.
+UPDATE shipper_cursors c SET shipped_seq = coalesce(
+	(SELECT max(e.id) FROM cf_audit_events e WHERE e.guid::text = c.shipped_id),
+	(SELECT max(e.id) FROM cf_audit_events e WHERE e.created_at < c.updated_at),
+	0
+);
+
+ALTER TABLE shipper_cursors ALTER COLUMN shipped_seq SET NOT NULL;
+
+COMMENT ON COLUMN shipper_cursors.shipped_seq IS 'id of the last event shipped';
+COMMENT ON COLUMN shipper_cursors.updated_at IS 'created_at of the last event shipped';
+COMMENT ON COLUMN shipper_cursors.shipped_id IS 'guid of the last event shipped';
@@ -0,0 +1,20 @@
+-- cf_audit_event_erasures records each erasure of a user's personal data
+-- from stored events. The user is only identified by the pseudonym which
+-- replaced their personal data.
+CREATE TABLE cf_audit_event_erasures (
+	id bigserial NOT NULL,
+	pseudonym text NOT NULL,
+	subject_type text NOT NULL,
+	reference text NOT NULL,
+	requested_by text NOT NULL,
+	event_count bigint NOT NULL,
+	archive_keys text[] NOT NULL,
+	erased_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (id),
+	CONSTRAINT subject_type_is_known CHECK (subject_type IN ('user_guid', 'username'))
+);
+
+-- Erased events keep the content hash of their original content, which can
+-- no longer be checked, so they are marked with the erasure which changed them
+ALTER TABLE cf_audit_events ADD COLUMN erasure_id bigint REFERENCES cf_audit_event_erasures (id);
@@ -0,0 +1,29 @@
+-- alerts records each time an alert rule matched stored events. Events are
+-- referred to by id and guid, but not by foreign key, as they may be removed
+-- by the retention policy or archiving.
+CREATE TABLE alerts (
+	id bigserial NOT NULL,
+	rule text NOT NULL,
+	group_key text NOT NULL,
+	event_count integer NOT NULL,
+	event_ids bigint[] NOT NULL,
+	event_guids text[] NOT NULL,
+	first_event_at timestamptz NOT NULL,
+	last_event_at timestamptz NOT NULL,
+	triggered_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (id),
+	CONSTRAINT event_count_is_positive CHECK (event_count > 0)
+);
+
+CREATE INDEX alerts_rule_triggered_at_idx ON alerts (rule, triggered_at);
+
+-- alert_cursors tracks the id of the last event evaluated against the alert
+-- rules, in the same way as shipper_cursors
+CREATE TABLE alert_cursors (
+	name text NOT NULL,
+	evaluated_seq bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now(),
+
+	PRIMARY KEY (name)
+);
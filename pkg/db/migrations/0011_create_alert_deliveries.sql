@@ -0,0 +1,17 @@
+-- alert_deliveries records what happened to each alert for each notification
+-- channel. A failed delivery is tried again, and its row updated, until it is
+-- sent.
+CREATE TABLE alert_deliveries (
+	alert_id bigint NOT NULL REFERENCES alerts (id) ON DELETE CASCADE,
+	channel text NOT NULL,
+	status text NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	delivered_at timestamptz,
+
+	PRIMARY KEY (alert_id, channel),
+	CONSTRAINT status_is_known CHECK (status IN ('sent', 'failed', 'silenced', 'deduplicated'))
+);
+
+CREATE INDEX alerts_triggered_at_idx ON alerts (triggered_at);
@@ -0,0 +1,12 @@
+-- foundation identifies the Cloud Foundry foundation an event was collected
+-- from. Events collected before more than one foundation could be configured
+-- have an empty foundation.
+ALTER TABLE cf_audit_events ADD COLUMN foundation text NOT NULL DEFAULT '';
+
+-- Events from different foundations are stored separately even if they share
+-- a GUID
+ALTER TABLE cf_audit_events DROP CONSTRAINT cf_audit_events_pkey;
+ALTER TABLE cf_audit_events ADD PRIMARY KEY (guid, created_at, foundation);
+
+-- Each foundation's collector starts from its latest event
+CREATE INDEX cf_audit_events_foundation_created_at_idx ON cf_audit_events (foundation, created_at);
@@ -0,0 +1,26 @@
+-- The names of the organization, space and app an event is about, and the
+-- email address of the user who caused it, as they were when the event was
+-- collected. They are not part of the event as Cloud Controller reported it,
+-- so they are not covered by its content hash. They are null when the name
+-- could not be found.
+ALTER TABLE cf_audit_events
+	ADD COLUMN organization_name text,
+	ADD COLUMN space_name text,
+	ADD COLUMN app_name text,
+	ADD COLUMN actor_email text;
+
+-- resource_names records every name each organization, space, app and user
+-- has been seen with, and when, so that names can still be looked up after
+-- the resource has been renamed or deleted. The name of a user is their email
+-- address.
+CREATE TABLE resource_names (
+	foundation text NOT NULL DEFAULT '',
+	resource_type text NOT NULL,
+	guid text NOT NULL,
+	name text NOT NULL,
+	first_seen_at timestamptz NOT NULL,
+	last_seen_at timestamptz NOT NULL,
+
+	PRIMARY KEY (foundation, resource_type, guid, name),
+	CONSTRAINT resource_type_is_known CHECK (resource_type IN ('organization', 'space', 'app', 'user'))
+);
@@ -0,0 +1,33 @@
+-- backfill_jobs records the job to collect the events a foundation had
+-- before its collector started, which the backfiller works through in
+-- windows of time. The collector only collects events from the end of the
+-- job onwards.
+CREATE TABLE backfill_jobs (
+	foundation text NOT NULL DEFAULT '',
+	job_start timestamptz NOT NULL,
+	job_end timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	completed_at timestamptz,
+
+	PRIMARY KEY (foundation),
+	CONSTRAINT job_is_not_empty CHECK (job_end > job_start)
+);
+
+-- backfill_windows checkpoints the backfiller's progress through each window
+-- of a job: the URL of the next page of events to fetch, which is null until
+-- the first page has been stored, and how many pages and events it has
+-- stored.
+CREATE TABLE backfill_windows (
+	foundation text NOT NULL DEFAULT '',
+	window_start timestamptz NOT NULL,
+	window_end timestamptz NOT NULL,
+	next_page_url text,
+	pages_fetched bigint NOT NULL DEFAULT 0,
+	events_stored bigint NOT NULL DEFAULT 0,
+	updated_at timestamptz,
+	completed_at timestamptz,
+
+	PRIMARY KEY (foundation, window_start),
+	FOREIGN KEY (foundation) REFERENCES backfill_jobs (foundation) ON DELETE CASCADE,
+	CONSTRAINT window_is_not_empty CHECK (window_end > window_start)
+);
@@ -0,0 +1,5 @@
+-- origin records how an event came to be stored. Events restored from an
+-- archive were shipped and evaluated against the alert rules when they were
+-- first collected, so they are not shipped or evaluated again.
+ALTER TABLE cf_audit_events ADD COLUMN origin text NOT NULL DEFAULT 'collected';
+ALTER TABLE cf_audit_events ADD CONSTRAINT origin_is_known CHECK (origin IN ('collected', 'restored'));
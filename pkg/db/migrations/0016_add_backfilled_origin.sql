@@ -0,0 +1,5 @@
+-- Backfilled events are shipped, as sinks have not seen them, but they
+-- happened before the foundation's collector started, so they are not
+-- evaluated against the alert rules
+ALTER TABLE cf_audit_events DROP CONSTRAINT origin_is_known;
+ALTER TABLE cf_audit_events ADD CONSTRAINT origin_is_known CHECK (origin IN ('collected', 'restored', 'backfilled'));
@@ -0,0 +1,18 @@
+-- cf_audit_event_erased_events records, for each event an erasure changed,
+-- the content hash the event was sealed with and the content hash of its
+-- erased content, so that the content of erased events can still be checked,
+-- and only against an erasure which changed them.
+CREATE TABLE cf_audit_event_erased_events (
+	erasure_id bigint NOT NULL REFERENCES cf_audit_event_erasures (id),
+	event_id bigint NOT NULL,
+	guid uuid NOT NULL,
+	content_hash bytea NOT NULL,
+	erased_content_hash bytea NOT NULL,
+
+	PRIMARY KEY (erasure_id, event_id)
+);
+
+-- The events changed by erasures made before this table existed are recorded
+-- as they are when the app next starts
+ALTER TABLE cf_audit_event_erasures ADD COLUMN events_recorded boolean NOT NULL DEFAULT false;
+ALTER TABLE cf_audit_event_erasures ALTER COLUMN events_recorded SET DEFAULT true;
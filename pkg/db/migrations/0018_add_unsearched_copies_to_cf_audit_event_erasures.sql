@@ -0,0 +1,6 @@
+-- Erasures record the copies of events they could not search or change:
+-- archives whose events have been deleted, partitions detached by the
+-- retention policy, and sinks which were sent events before they were erased
+ALTER TABLE cf_audit_event_erasures ADD COLUMN unsearched_archive_keys text[] NOT NULL DEFAULT '{}';
+ALTER TABLE cf_audit_event_erasures ADD COLUMN detached_partitions text[] NOT NULL DEFAULT '{}';
+ALTER TABLE cf_audit_event_erasures ADD COLUMN shipped_to text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,15 @@
+-- Events can be stored in a window after it has been archived, eg when a new
+-- foundation is backfilled. The archiver archives such windows again, as a
+-- new revision of their archive.
+ALTER TABLE cf_audit_event_archives ADD COLUMN revision integer NOT NULL DEFAULT 1;
+
+-- cf_audit_event_archive_cursor records the id of the last event the archiver
+-- has checked for being stored in a window after it was archived. It has one
+-- row. Events stored before this migration have not been checked.
+CREATE TABLE cf_audit_event_archive_cursor (
+	only_row boolean PRIMARY KEY DEFAULT true CHECK (only_row),
+	checked_seq bigint NOT NULL,
+	updated_at timestamptz NOT NULL
+);
+
+INSERT INTO cf_audit_event_archive_cursor (checked_seq, updated_at) VALUES (0, now());
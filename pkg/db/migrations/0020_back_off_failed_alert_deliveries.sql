@@ -0,0 +1,5 @@
+-- A failed delivery is tried again once next_attempt_at has passed, backing
+-- off with the number of runs it has failed in, so that later alerts for the
+-- channel are not held up by it
+ALTER TABLE alert_deliveries ADD COLUMN failures integer NOT NULL DEFAULT 0;
+ALTER TABLE alert_deliveries ADD COLUMN next_attempt_at timestamptz;
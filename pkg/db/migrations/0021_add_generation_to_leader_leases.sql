@@ -0,0 +1,4 @@
+-- The generation of a leader lease goes up each time it changes hands. Writes
+-- made by a leader check it before they are committed, so that a leader which
+-- has lost its lease cannot overwrite the writes of the one which took over.
+ALTER TABLE leader_leases ADD COLUMN generation bigint NOT NULL DEFAULT 1;
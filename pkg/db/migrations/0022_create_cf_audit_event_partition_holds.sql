@@ -0,0 +1,10 @@
+-- A partition hold keeps the partition of a month from being removed by the
+-- retention policy until it expires. Restoring archived events holds the
+-- partitions they are restored into, which would otherwise be older than the
+-- retention policy allows and removed straight away.
+CREATE TABLE cf_audit_event_partition_holds (
+	month timestamptz PRIMARY KEY,
+	reason text NOT NULL,
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+-- Erasures are sealed into a hash chain of their own, in the transaction that
+-- makes them, see erasures.go. An erasure's record hash covers its fields and
+-- the events it changed, so that the hashes its erased events are checked
+-- against cannot be edited. seal_seq is the erasure's place in the chain,
+-- which is the order erasures were sealed in rather than their id.
+ALTER TABLE cf_audit_event_erasures ADD COLUMN seal_seq bigint UNIQUE;
+ALTER TABLE cf_audit_event_erasures ADD COLUMN record_hash bytea;
+ALTER TABLE cf_audit_event_erasures ADD COLUMN chain_hash bytea;
+
+-- Checkpoints sign the head of the chain of erasures along with the head of
+-- the chain of events. Checkpoints signed before erasures were sealed, or
+-- while there were none, have no erasure head.
+ALTER TABLE chain_checkpoints ADD COLUMN erasure_seq bigint;
+ALTER TABLE chain_checkpoints ADD COLUMN erasure_chain_hash bytea;
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/lib/pq"
+)
+
+// cf_audit_events is partitioned by the month of created_at, in UTC. Each
+// partition is named after its month, eg cf_audit_events_2020_01.
+
+const (
+	ChainAnchorsTable       = "chain_anchors"
+	PartitionRemovalsTable  = "cf_audit_event_partition_removals"
+	PartitionHoldsTable     = "cf_audit_event_partition_holds"
+	PartitionActionDrop     = "drop"
+	PartitionActionDetach   = "detach"
+	partitionNameTimeLayout = "2006_01"
+)
+
+var partitionName = regexp.MustCompile(`^` + CFAuditEventsTable + `_(\d{4}_\d{2})$`)
+
+// Partition is a partition of cf_audit_events holding the events created in
+// the month starting at Month
+type Partition struct {
+	Name  string
+	Month time.Time
+}
+
+// PartitionRemoval records a partition removed by the retention policy
+type PartitionRemoval struct {
+	Partition
+	Action     string
+	EventCount int64
+}
+
+// PartitionHold keeps the partition of Month from being removed by the
+// retention policy until ExpiresAt
+type PartitionHold struct {
+	Month     time.Time
+	Reason    string
+	ExpiresAt time.Time
+}
+
+// PartitionMonth returns the start of the month containing t, in UTC
+func PartitionMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// PartitionName returns the name of the partition holding events created in
+// the month containing t
+func PartitionName(t time.Time) string {
+	return CFAuditEventsTable + "_" + PartitionMonth(t).Format(partitionNameTimeLayout)
+}
+
+// EnsureCFAuditEventPartition creates the partition for the month containing
+// month, if it does not exist, and reports whether it created it
+func (s *EventStore) EnsureCFAuditEventPartition(month time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	var created bool
+	err := s.querier(ctx, nil).QueryRow(`select cf_audit_events_ensure_partition($1)`, month).Scan(&created)
+	return created, err
+}
+
+func ensurePartitions(q querier, months map[time.Time]bool) error {
+	for month := range months {
+		if _, err := q.Exec(`select cf_audit_events_ensure_partition($1)`, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCFAuditEventPartitions returns the partitions of cf_audit_events, oldest
+// first
+func (s *EventStore) GetCFAuditEventPartitions() ([]Partition, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select c.relname
+		from pg_inherits i
+		join pg_class c on c.oid = i.inhrelid
+		where i.inhparent = $1::regclass
+		order by c.relname
+	`, CFAuditEventsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := []Partition{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		match := partitionName.FindStringSubmatch(name)
+		if match == nil {
+			s.logger.Info("ignoring-unexpected-partition", lager.Data{"name": name})
+			continue
+		}
+		month, err := time.Parse(partitionNameTimeLayout, match[1])
+		if err != nil {
+			return nil, fmt.Errorf("partition %s: %s", name, err)
+		}
+		partitions = append(partitions, Partition{Name: name, Month: month})
+	}
+	return partitions, rows.Err()
+}
+
+// HoldCFAuditEventPartition holds the partition for the month containing
+// month until expiresAt. A partition which is already held is held until the
+// later of the two.
+func (s *EventStore) HoldCFAuditEventPartition(month time.Time, expiresAt time.Time, reason string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			insert into `+PartitionHoldsTable+` (month, reason, expires_at)
+			values ($1, $2, $3)
+			on conflict (month) do update set
+				reason = case
+					when excluded.expires_at > `+PartitionHoldsTable+`.expires_at then excluded.reason
+					else `+PartitionHoldsTable+`.reason
+				end,
+				expires_at = greatest(`+PartitionHoldsTable+`.expires_at, excluded.expires_at)
+		`, PartitionMonth(month), reason, expiresAt)
+		return err
+	})
+}
+
+// GetCFAuditEventPartitionHolds returns the holds which have not expired,
+// oldest month first
+func (s *EventStore) GetCFAuditEventPartitionHolds() ([]PartitionHold, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select month, reason, expires_at
+		from ` + PartitionHoldsTable + `
+		where expires_at > now()
+		order by month
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []PartitionHold{}
+	for rows.Next() {
+		var hold PartitionHold
+		if err := rows.Scan(&hold.Month, &hold.Reason, &hold.ExpiresAt); err != nil {
+			return nil, err
+		}
+		hold.Month = hold.Month.UTC()
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// CountUnarchivedCFAuditEvents returns how many events in a partition are not
+// in the archive of their window, because their window has not been archived
+// or they were stored in it after it was archived. Restored events are not
+// counted, as they came from archives.
+func (s *EventStore) CountUnarchivedCFAuditEvents(partition Partition) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	var count int64
+	err := s.querier(ctx, nil).QueryRow(`
+		select count(*)
+		from `+CFAuditEventsTable+` e
+		where e.created_at >= $1 and e.created_at < $2
+		and e.origin <> '`+OriginRestored+`'
+		and not exists (
+			select 1 from `+CFAuditEventArchivesTable+` a
+			where e.created_at >= a.window_start and e.created_at < a.window_end
+			and e.id <= a.max_id
+		)
+	`, partition.Month, partition.Month.AddDate(0, 1, 0)).Scan(&count)
+	return count, err
+}
+
+// RemoveCFAuditEventPartition detaches a partition from cf_audit_events, and
+// drops it if action is PartitionActionDrop. A detached partition is left as
+// a table of its own, for archiving by other means.
+//
+// The removal is recorded, along with anchors for the gaps it leaves in the
+// hash chain, so that the remaining events can still be verified. The
+// partition holding the head of the chain cannot be removed, as new events
+// follow on from it, and a partition which is held returns ErrPartitionHeld.
+func (s *EventStore) RemoveCFAuditEventPartition(partition Partition, action string) (PartitionRemoval, error) {
+	removal := PartitionRemoval{Partition: partition, Action: action}
+	if action != PartitionActionDrop && action != PartitionActionDetach {
+		return removal, fmt.Errorf("unknown partition action %q", action)
+	}
+	if !partitionName.MatchString(partition.Name) {
+		return removal, fmt.Errorf("%q is not a partition of %s", partition.Name, CFAuditEventsTable)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return removal, err
+	}
+	defer tx.Rollback()
+	if err := lockChain(s.querier(ctx, tx)); err != nil {
+		return removal, err
+	}
+
+	// The name of the partition can not be a parameter, so it is quoted, and
+	// the statements which name it are not kept prepared
+	table := pq.QuoteIdentifier(partition.Name)
+
+	var holdsHead bool
+	err = tx.QueryRow(`
+		select exists (
+			select 1 from ` + table + `
+			where id = (select max(id) from ` + CFAuditEventsTable + ` where chain_hash is not null)
+		)
+	`).Scan(&holdsHead)
+	if err != nil {
+		return removal, err
+	}
+	if holdsHead {
+		return removal, fmt.Errorf("partition %s holds the head of the hash chain", partition.Name)
+	}
+
+	// Events are restored while holding the chain lock, after the hold on
+	// their partition, so a partition being restored into is seen to be held
+	var heldUntil time.Time
+	err = tx.QueryRow(`
+		select expires_at from `+PartitionHoldsTable+`
+		where month = $1 and expires_at > now()
+	`, partition.Month).Scan(&heldUntil)
+	if err == nil {
+		return removal, fmt.Errorf("partition %s: %w until %s", partition.Name, ErrPartitionHeld, heldUntil.UTC().Format(time.RFC3339))
+	} else if err != sql.ErrNoRows {
+		return removal, err
+	}
+	if _, err := tx.Exec(`delete from `+PartitionHoldsTable+` where month = $1`, partition.Month); err != nil {
+		return removal, err
+	}
+
+	_, err = tx.Exec(`
+		with removed as (
+			select id, chain_hash, $1::text as reason from `+table+`
+		)
+	`+anchorRemovedSQL, "removed partition "+partition.Name)
+	if err != nil {
+		return removal, err
+	}
+
+	err = tx.QueryRow(`
+		insert into `+PartitionRemovalsTable+` (
+			partition_name, month, action, event_count, min_id, max_id
+		)
+		select $1, $2, $3, count(*), min(id), max(id) from `+table+`
+		returning event_count
+	`, partition.Name, partition.Month, action).Scan(&removal.EventCount)
+	if err != nil {
+		return removal, err
+	}
+
+	if _, err := tx.Exec(`alter table ` + CFAuditEventsTable + ` detach partition ` + table); err != nil {
+		return removal, err
+	}
+	if action == PartitionActionDrop {
+		if _, err := tx.Exec(`drop table ` + table); err != nil {
+			return removal, err
+		}
+	}
+	return removal, s.commit(s.querier(ctx, tx), tx)
+}
+
+// anchorRemovedSQL follows a "removed" common table expression which selects
+// the id, chain_hash and reason of events which are being removed. It records
+// a chain anchor for each event which directly follows one of them. The
+// caller must hold the chain lock.
+const anchorRemovedSQL = `
+	insert into ` + ChainAnchorsTable + ` (next_id, previous_chain_hash, reason)
+	select next.id, removed.chain_hash, removed.reason
+	from removed
+	cross join lateral (
+		select id from ` + CFAuditEventsTable + ` e
+		where e.id > removed.id
+		order by e.id
+		limit 1
+	) next
+	where removed.chain_hash is not null
+	and not exists (select 1 from removed r where r.id = next.id)
+	on conflict (next_id) do update set
+		previous_chain_hash = excluded.previous_chain_hash,
+		reason = excluded.reason,
+		created_at = now()
+`
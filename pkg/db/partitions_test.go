@@ -0,0 +1,23 @@
+package db_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+var _ = Describe("Partitions", func() {
+	It("are named after the month of created_at in UTC", func() {
+		london, err := time.LoadLocation("Europe/London")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Still April in UTC
+		createdAt := time.Date(2020, 5, 1, 0, 30, 0, 0, london)
+
+		Expect(db.PartitionMonth(createdAt)).To(Equal(time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(db.PartitionName(createdAt)).To(Equal("cf_audit_events_2020_04"))
+	})
+})
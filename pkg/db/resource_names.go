@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ResourceNamesTable = "resource_names"
+
+	ResourceTypeOrganization = "organization"
+	ResourceTypeSpace        = "space"
+	ResourceTypeApp          = "app"
+
+	// ResourceTypeUser is a user, whose name is their email address
+	ResourceTypeUser = "user"
+)
+
+// ResourceName is a name an organization, space, app or user of a foundation
+// has been seen with, and when
+type ResourceName struct {
+	Foundation  string    `json:"foundation,omitempty"`
+	Type        string    `json:"type"`
+	GUID        string    `json:"guid"`
+	Name        string    `json:"name"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// StoreResourceNames records that resources have been seen with names. A name
+// seen before has the times it was seen widened to include the new ones.
+func (s *EventStore) StoreResourceNames(names []ResourceName) error {
+	if len(names) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
+	defer cancel()
+
+	var (
+		foundations  = make([]string, len(names))
+		types        = make([]string, len(names))
+		guids        = make([]string, len(names))
+		values       = make([]string, len(names))
+		firstSeenAts = make([]string, len(names))
+		lastSeenAts  = make([]string, len(names))
+	)
+	for i, name := range names {
+		foundations[i] = name.Foundation
+		types[i] = name.Type
+		guids[i] = name.GUID
+		values[i] = name.Name
+		firstSeenAts[i] = name.FirstSeenAt.Format(time.RFC3339Nano)
+		lastSeenAts[i] = name.LastSeenAt.Format(time.RFC3339Nano)
+	}
+
+	// The same name can be given more than once, which a single insert
+	// cannot update twice, so names are grouped first
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			insert into `+ResourceNamesTable+` as r (
+				foundation, resource_type, guid, name, first_seen_at, last_seen_at
+			)
+			select foundation, resource_type, guid, name, min(first_seen_at), max(last_seen_at)
+			from unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[], $6::timestamptz[])
+				as n(foundation, resource_type, guid, name, first_seen_at, last_seen_at)
+			group by 1, 2, 3, 4
+			on conflict (foundation, resource_type, guid, name) do
+			update set
+				first_seen_at = least(r.first_seen_at, excluded.first_seen_at),
+				last_seen_at = greatest(r.last_seen_at, excluded.last_seen_at)
+		`,
+			pq.Array(foundations), pq.Array(types), pq.Array(guids), pq.Array(values),
+			pq.Array(firstSeenAts), pq.Array(lastSeenAts),
+		)
+		return err
+	})
+}
+
+// GetResourceNames returns every name a resource of a foundation has been
+// seen with, most recently seen first
+func (s *EventStore) GetResourceNames(foundation string, resourceType string, guid string) ([]ResourceName, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select foundation, resource_type, guid, name, first_seen_at, last_seen_at
+		from `+ResourceNamesTable+`
+		where foundation = $1 and resource_type = $2 and guid = $3
+		order by last_seen_at desc, name
+	`, foundation, resourceType, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []ResourceName{}
+	for rows.Next() {
+		name := ResourceName{}
+		err := rows.Scan(&name.Foundation, &name.Type, &name.GUID, &name.Name, &name.FirstSeenAt, &name.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// statements holds the prepared statements of a store. Each query is
+// prepared the first time it is run, and kept until the store is closed.
+//
+// Queries are only ever built from constant SQL, with every value bound as a
+// parameter, so there is a small, fixed set of them. Statements which name a
+// partition, which can not be a parameter, and statements which use the
+// staging table, which is created afresh in each transaction, are run without
+// being kept. So are migrations.
+type statements struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	prepared map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{db: db, prepared: map[string]*sql.Stmt{}}
+}
+
+func (s *statements) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.prepared[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.prepared[query] = stmt
+	return stmt, nil
+}
+
+func (s *statements) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for query, stmt := range s.prepared {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.prepared, query)
+	}
+	return firstErr
+}
+
+// querier runs queries with the store's prepared statements, in tx if it is
+// not nil
+type querier struct {
+	ctx   context.Context
+	stmts *statements
+	tx    *sql.Tx
+}
+
+func (s *EventStore) querier(ctx context.Context, tx *sql.Tx) querier {
+	return querier{ctx, s.stmts, tx}
+}
+
+func (q querier) stmt(query string) (*sql.Stmt, error) {
+	stmt, err := q.stmts.get(q.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if q.tx != nil {
+		// The statement is prepared again on the transaction's connection
+		// only if it has not been prepared there before
+		return q.tx.StmtContext(q.ctx, stmt), nil
+	}
+	return stmt, nil
+}
+
+func (q querier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := q.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(q.ctx, args...)
+}
+
+func (q querier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := q.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(q.ctx, args...)
+}
+
+// row is a *sql.Row, or the error from preparing its statement
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(...interface{}) error { return r.err }
+
+func (q querier) QueryRow(query string, args ...interface{}) row {
+	stmt, err := q.stmt(query)
+	if err != nil {
+		return errRow{err}
+	}
+	return stmt.QueryRowContext(q.ctx, args...)
+}
@@ -5,9 +5,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -19,285 +19,616 @@ import (
 const (
 	CFAuditEventsTable  = "cf_audit_events"
 	ShipperCursorsTable = "shipper_cursors"
+	LeaderLeasesTable   = "leader_leases"
+
+	// CFAuditEventsStagingTable is the temporary table events are copied
+	// into before being inserted
+	CFAuditEventsStagingTable = "cf_audit_events_staging"
 
 	DefaultInitTimeout  = 15 * time.Minute
 	DefaultStoreTimeout = 10 * time.Minute
 	DefaultQueryTimeout = 60 * time.Second
+	DefaultLeaseTimeout = 5 * time.Second
+
+	// unevaluatedEventsLimit bounds how many events the alert engine reads
+	// per run, and so how long its read transaction is open
+	unevaluatedEventsLimit = 8192
+)
+
+// The origin of a stored event is how it came to be stored
+const (
+	OriginCollected  = "collected"
+	OriginRestored   = "restored"
+	OriginBackfilled = "backfilled"
 )
 
 type EventDB interface {
 	Init() error
 
-	StoreCFAuditEvents(events []cfclient.Event) error
-	GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event, error)
-	GetLatestCFEventTime() (time.Time, error)
-	GetCFEventCount() (int64, error)
-
-	GetUnshippedCFAuditEventsForShipper(shipperName string) ([]cfclient.Event, error)
-	UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error
+	StoreCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error)
+	RestoreCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error)
+	BackfillCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error)
+	GetCFAuditEvents(filter RawEventFilter) ([]CFAuditEvent, error)
+	StreamCFAuditEvents(ctx context.Context, filter RawEventFilter, fn func(CFAuditEvent) error) error
+	GetLatestCFEventTime(foundation string) (time.Time, error)
+	GetCFEventCounts() (map[string]int64, error)
+
+	CreateBackfillJob(job BackfillJob, windows []BackfillWindow) (BackfillJob, error)
+	GetBackfillJob(foundation string) (*BackfillJob, error)
+	GetBackfillJobs() ([]BackfillJob, error)
+	GetBackfillWindows(foundation string) ([]BackfillWindow, error)
+	UpdateBackfillWindow(window BackfillWindow) error
+
+	GetUnshippedCFAuditEventsForShipper(shipperName string, limit int) ([]CFAuditEvent, error)
+	UpdateShipperCursor(shipperName string, lastShipped CFAuditEvent) error
+
+	AcquireLeaderLease(lease *Lease, ttl time.Duration) (bool, error)
+	ReleaseLeaderLease(lease *Lease) error
+
+	GetChainHead() (ChainHead, error)
+	StoreChainCheckpoint(checkpoint ChainCheckpoint) error
+	GetLatestChainCheckpoint() (*ChainCheckpoint, error)
+
+	EnsureCFAuditEventPartition(month time.Time) (bool, error)
+	GetCFAuditEventPartitions() ([]Partition, error)
+	RemoveCFAuditEventPartition(partition Partition, action string) (PartitionRemoval, error)
+	HoldCFAuditEventPartition(month time.Time, expiresAt time.Time, reason string) error
+	GetCFAuditEventPartitionHolds() ([]PartitionHold, error)
+
+	GetEarliestCFEventTime() (time.Time, error)
+	GetLatestCFAuditEventArchive() (*CFAuditEventArchive, error)
+	GetCFAuditEventArchives() ([]CFAuditEventArchive, error)
+	GetCFAuditEventArchivesWithLateEvents(limit int64) ([]CFAuditEventArchive, int64, error)
+	UpdateArchiveCursor(checkedSeq int64) error
+	StoreCFAuditEventArchive(archive CFAuditEventArchive) error
+	DeleteArchivedCFAuditEvents(archive CFAuditEventArchive) (int64, error)
+	CountUnarchivedCFAuditEvents(partition Partition) (int64, error)
+
+	StoreResourceNames(names []ResourceName) error
+	GetResourceNames(foundation string, resourceType string, guid string) ([]ResourceName, error)
+
+	EraseUserFromCFAuditEvents(request ErasureRequest) (Erasure, error)
+	GetCFAuditEventErasures() ([]Erasure, error)
+
+	StreamUnevaluatedCFAuditEvents(ctx context.Context, name string, fn func(CFAuditEvent) error) error
+	InitAlertCursor(name string) (int64, error)
+	StoreAlerts(name string, alerts []Alert, lastEvaluated CFAuditEvent) ([]Alert, error)
+
+	GetUndeliveredAlerts(channel string, rules []string, since time.Time) ([]Alert, error)
+	GetLastAlertDeliveryTime(channel string, rule string, groupKey string) (time.Time, error)
+	StoreAlertDelivery(delivery AlertDelivery) error
 }
 
 type EventStore struct {
 	db     *sql.DB
+	stmts  *statements
 	logger lager.Logger
 	ctx    context.Context
+
+	// lease fences writes, if it is set. See WithLease.
+	lease *Lease
 }
 
 func NewEventStore(ctx context.Context, db *sql.DB, logger lager.Logger) *EventStore {
 	return &EventStore{
 		db:     db,
+		stmts:  newStatements(db),
 		logger: logger.Session("event-store"),
 		ctx:    ctx,
 	}
 }
 
-// Init initialises the database tables and functions
+// Close closes the store's prepared statements. It does not close db.
+func (s *EventStore) Close() error {
+	return s.stmts.close()
+}
+
+// Init migrates the database and seals any unsealed events
 func (s *EventStore) Init() error {
 	s.logger.Info("initializing")
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultInitTimeout)
 	defer cancel()
 
-	for _, filename := range []string{
-		"create_cf_audit_events.sql",
-		"create_shipper_cursors.sql",
-	} {
-		if err := s.runSQLFilesInTransaction(ctx, filename); err != nil {
-			return err
-		}
+	if _, err := s.Migrate(false); err != nil {
+		return err
+	}
+
+	if err := s.sealAllEvents(ctx); err != nil {
+		return err
 	}
 
 	s.logger.Info("initialized")
 	return nil
 }
 
-func (s *EventStore) StoreCFAuditEvents(events []cfclient.Event) error {
+// StoreCFAuditEvents stores and seals events collected from foundation,
+// skipping any which are already stored, and returns the number of events
+// which were new. names holds the names resolved for events by their GUID,
+// and may be nil.
+func (s *EventStore) StoreCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error) {
+	return s.storeCFAuditEvents(foundation, OriginCollected, events, names)
+}
+
+// RestoreCFAuditEvents stores events from an archive in the same way as
+// StoreCFAuditEvents, marked as restored so that they are not shipped or
+// evaluated against the alert rules again
+func (s *EventStore) RestoreCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error) {
+	return s.storeCFAuditEvents(foundation, OriginRestored, events, names)
+}
+
+// BackfillCFAuditEvents stores events created before foundation's collector
+// started in the same way as StoreCFAuditEvents, marked as backfilled so that
+// they are shipped but not evaluated against the alert rules
+func (s *EventStore) BackfillCFAuditEvents(foundation string, events []cfclient.Event, names map[string]EventNames) (int, error) {
+	return s.storeCFAuditEvents(foundation, OriginBackfilled, events, names)
+}
+
+func (s *EventStore) storeCFAuditEvents(foundation string, origin string, events []cfclient.Event, names map[string]EventNames) (int, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
 	defer cancel()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
+	q := s.querier(ctx, tx)
+	if err := lockChain(q); err != nil {
+		return 0, err
+	}
+
+	// The maintainer creates partitions ahead of time, but events can be
+	// older than the oldest partition, eg when they are backfilled
+	months := map[time.Time]bool{}
 	for _, event := range events {
-		eventMetadataJSON, err := json.Marshal(&event.Metadata)
+		if createdAt, err := time.Parse(time.RFC3339, event.CreatedAt); err == nil {
+			months[PartitionMonth(createdAt)] = true
+		}
+	}
+	if err := ensurePartitions(q, months); err != nil {
+		return 0, err
+	}
+
+	stored, err := copyCFAuditEvents(tx, foundation, origin, events, names)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		sealed, err := sealEvents(q)
 		if err != nil {
-			return err
+			return 0, err
 		}
+		if sealed < chainSealBatchSize {
+			break
+		}
+	}
+	if err := s.commit(q, tx); err != nil {
+		return 0, err
+	}
+	return stored, nil
+}
+
+// copyCFAuditEvents bulk loads events with COPY into a staging table, and
+// inserts them from there in the order they were given, skipping any which
+// are already stored. It returns the number inserted. The staging table only
+// lasts for the transaction, so these statements are not kept prepared.
+func copyCFAuditEvents(tx *sql.Tx, foundation string, origin string, events []cfclient.Event, names map[string]EventNames) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
 
-		stmt := fmt.Sprintf(`
-			insert into %s (
-				guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata
-			) values (
-				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')::uuid, NULLIF($12, '')::uuid, $13
-			) on conflict do nothing
-		`, CFAuditEventsTable)
-		_, err = tx.Exec(stmt, event.GUID, event.CreatedAt, event.Type, event.Actor, event.ActorType, event.ActorName, event.ActorUsername, event.Actee, event.ActeeType, event.ActeeName, event.OrganizationGUID, event.SpaceGUID, eventMetadataJSON)
+	_, err := tx.Exec(`
+		create temporary table ` + CFAuditEventsStagingTable + ` (
+			seq integer not null,
+			guid uuid not null,
+			created_at timestamptz not null,
+			event_type text not null,
+			actor text not null,
+			actor_type text not null,
+			actor_name text not null,
+			actor_username text not null,
+			actee text not null,
+			actee_type text not null,
+			actee_name text not null,
+			organization_guid text not null,
+			space_guid text not null,
+			metadata jsonb,
+			organization_name text not null,
+			space_name text not null,
+			app_name text not null,
+			actor_email text not null
+		) on commit drop
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(
+		CFAuditEventsStagingTable,
+		"seq", "guid", "created_at", "event_type", "actor", "actor_type", "actor_name", "actor_username",
+		"actee", "actee_type", "actee_name", "organization_guid", "space_guid", "metadata",
+		"organization_name", "space_name", "app_name", "actor_email",
+	))
+	if err != nil {
+		return 0, err
+	}
+	for i, event := range events {
+		eventMetadataJSON, err := json.Marshal(&event.Metadata)
 		if err != nil {
-			return err
+			stmt.Close()
+			return 0, err
 		}
+		eventNames := names[event.GUID]
+		_, err = stmt.Exec(
+			i, event.GUID, event.CreatedAt, event.Type, event.Actor, event.ActorType, event.ActorName, event.ActorUsername,
+			event.Actee, event.ActeeType, event.ActeeName, event.OrganizationGUID, event.SpaceGUID, string(eventMetadataJSON),
+			eventNames.OrganizationName, eventNames.SpaceName, eventNames.AppName, eventNames.ActorEmail,
+		)
+		if err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		insert into `+CFAuditEventsTable+` (
+			foundation, origin, guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name, organization_guid, space_guid, metadata,
+			organization_name, space_name, app_name, actor_email
+		)
+		select
+			$1, $2, guid, created_at, event_type, actor, actor_type, actor_name, actor_username, actee, actee_type, actee_name,
+			nullif(organization_guid, '')::uuid, nullif(space_guid, '')::uuid, metadata,
+			nullif(organization_name, ''), nullif(space_name, ''), nullif(app_name, ''), nullif(actor_email, '')
+		from `+CFAuditEventsStagingTable+`
+		order by seq
+		on conflict do nothing
+	`, foundation, origin)
+	if err != nil {
+		return 0, err
 	}
-	return tx.Commit()
+	inserted, err := result.RowsAffected()
+	return int(inserted), err
 }
 
+// RawEventFilter selects stored events. Events are read in id order,
+// newest first unless Reverse is set. Zero values do not filter.
 type RawEventFilter struct {
 	Reverse bool
 	Limit   int
 	Kind    string
+
+	// Foundation only returns events collected from this foundation. Events
+	// collected before foundations were configured have an empty foundation,
+	// so they cannot be selected by it.
+	Foundation string
+
+	// AfterID only returns events after the event with this id, in the order
+	// the events are being read. It is used as a pagination cursor.
+	AfterID int64
+
+	GUID             string
+	StartTime        time.Time
+	EndTime          time.Time
+	Actor            string
+	Actee            string
+	OrganizationGUID string
+	SpaceGUID        string
+
+	// Organizations restricts events to those in any of these orgs, given by
+	// the name of their foundation, if it is not nil. An empty, non-nil map
+	// matches no events.
+	Organizations map[string][]string
+
+	// ExcludeRestored leaves out events restored from archives
+	ExcludeRestored bool
+}
+
+// CFAuditEvent is a stored event along with its position in the store, the
+// foundation it was collected from and the names resolved for it
+type CFAuditEvent struct {
+	ID         int64
+	Foundation string
+	cfclient.Event
+	EventNames
+}
+
+// EventNames are the names of the resources an event refers to, as they were
+// when it was collected. Names which could not be found are empty. They are
+// not part of the event as the foundation reported it, but they are covered
+// by its content hash, as they are served and shipped along with it.
+type EventNames struct {
+	OrganizationName string `json:"organization_name,omitempty"`
+	SpaceName        string `json:"space_name,omitempty"`
+	AppName          string `json:"app_name,omitempty"`
+	ActorEmail       string `json:"actor_email,omitempty"`
+}
+
+// FoundationEvent is the form of a stored event outside the database, eg in
+// sinks and archives: the event as the foundation reported it, along with the
+// foundation's name if it has one and the names resolved for it
+type FoundationEvent struct {
+	cfclient.Event
+	EventNames
+	Foundation string `json:"foundation,omitempty"`
+}
+
+// NewFoundationEvent returns the form of a stored event outside the database
+func NewFoundationEvent(event CFAuditEvent) FoundationEvent {
+	return FoundationEvent{
+		Event:      event.Event,
+		EventNames: event.EventNames,
+		Foundation: event.Foundation,
+	}
+}
+
+// whereClause returns the conditions of the filter, with their values as
+// parameters starting from $1
+func (f RawEventFilter) whereClause() (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	param := func(arg interface{}) string {
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args))
+	}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition+param(arg))
+	}
+
+	if f.Kind != "" {
+		add("event_type = ", f.Kind)
+	}
+	if f.Foundation != "" {
+		add("foundation = ", f.Foundation)
+	}
+	if f.AfterID > 0 {
+		if f.Reverse {
+			add("id > ", f.AfterID)
+		} else {
+			add("id < ", f.AfterID)
+		}
+	}
+	if f.GUID != "" {
+		add("guid = ", f.GUID)
+	}
+	if !f.StartTime.IsZero() {
+		add("created_at >= ", f.StartTime)
+	}
+	if !f.EndTime.IsZero() {
+		add("created_at < ", f.EndTime)
+	}
+	if f.Actor != "" {
+		add("actor = ", f.Actor)
+	}
+	if f.Actee != "" {
+		add("actee = ", f.Actee)
+	}
+	if f.OrganizationGUID != "" {
+		add("organization_guid = ", f.OrganizationGUID)
+	}
+	if f.SpaceGUID != "" {
+		add("space_guid = ", f.SpaceGUID)
+	}
+	if f.ExcludeRestored {
+		conditions = append(conditions, "origin <> '"+OriginRestored+"'")
+	}
+	if f.Organizations != nil {
+		// Organization GUIDs are only unique within a foundation
+		foundations := []string{}
+		for foundation := range f.Organizations {
+			foundations = append(foundations, foundation)
+		}
+		sort.Strings(foundations)
+		orgs := []string{}
+		for _, foundation := range foundations {
+			orgs = append(orgs, "(foundation = "+param(foundation)+
+				" and organization_guid = any("+param(pq.Array(f.Organizations[foundation]))+"::uuid[]))")
+		}
+		if len(orgs) == 0 {
+			orgs = append(orgs, "false")
+		}
+		conditions = append(conditions, "("+strings.Join(orgs, " or ")+")")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "where " + strings.Join(conditions, " and "), args
 }
 
-func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]cfclient.Event, error) {
-	events := []cfclient.Event{}
+// GetCFAuditEvents returns the events matching filter. It holds every event
+// in memory, so use it with a Limit, and StreamCFAuditEvents otherwise.
+func (s *EventStore) GetCFAuditEvents(filter RawEventFilter) ([]CFAuditEvent, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	events := []CFAuditEvent{}
+	err := s.StreamCFAuditEvents(ctx, filter, func(event CFAuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// StreamCFAuditEvents calls fn with each event matching filter, in order,
+// from a read-only transaction. It stops at the first error from fn, and
+// returns it, or when ctx is done.
+func (s *EventStore) StreamCFAuditEvents(ctx context.Context, filter RawEventFilter, fn func(CFAuditEvent) error) error {
 	sortDirection := "desc"
 	if filter.Reverse {
 		sortDirection = "asc"
 	}
+	where, args := filter.whereClause()
 	limit := ""
 	if filter.Limit > 0 {
-		limit = fmt.Sprintf(`limit %d`, filter.Limit)
+		args = append(args, filter.Limit)
+		limit = "limit $" + strconv.Itoa(len(args))
 	}
-	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
-	defer cancel()
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
-	rows, err := tx.Query(`
+	rows, err := s.querier(ctx, tx).Query(`
 		select
-			guid,
-			created_at,
-			event_type,
-			actor,
-			actor_type,
-			actor_name,
-			actor_username,
-			actee,
-			actee_type,
-			actee_name,
-			coalesce(organization_guid::text, ''),
-			coalesce(space_guid::text, ''),
-			metadata
+			`+eventColumns+`
 		from
-			` + CFAuditEventsTable + `
+			`+CFAuditEventsTable+`
+		`+where+`
 		order by
-			id ` + sortDirection + `
-		` + limit + `
-	`)
+			id `+sortDirection+`
+		`+limit+`
+	`, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		event := cfclient.Event{}
-		bytesOfMetadataJSON := []byte{}
-		err = rows.Scan(
-			&event.GUID,
-			&event.CreatedAt,
-			&event.Type,
-			&event.Actor,
-			&event.ActorType,
-			&event.ActorName,
-			&event.ActorUsername,
-			&event.Actee,
-			&event.ActeeType,
-			&event.ActeeName,
-			&event.OrganizationGUID,
-			&event.SpaceGUID,
-			&bytesOfMetadataJSON,
-		)
-		if err != nil {
-			return nil, err
+		event := CFAuditEvent{}
+		if err := scanEvent(rows, &event); err != nil {
+			return err
 		}
-		if len(bytesOfMetadataJSON) > 0 {
-			err = json.Unmarshal(bytesOfMetadataJSON, &event.Metadata)
-			if err != nil {
-				return nil, err
-			}
+		if err := fn(event); err != nil {
+			return err
 		}
-		events = append(events, event)
 	}
-	return events, nil
+	return rows.Err()
 }
 
-func (s *EventStore) GetUnshippedCFAuditEventsForShipper(shipperName string) ([]cfclient.Event, error) {
-	events := []cfclient.Event{}
-	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
-	defer cancel()
-	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+// eventColumns are the columns scanEvent reads
+const eventColumns = `
+	id,
+	foundation,
+	guid,
+	created_at,
+	event_type,
+	actor,
+	actor_type,
+	actor_name,
+	actor_username,
+	actee,
+	actee_type,
+	actee_name,
+	coalesce(organization_guid::text, ''),
+	coalesce(space_guid::text, ''),
+	metadata,
+	coalesce(organization_name, ''),
+	coalesce(space_name, ''),
+	coalesce(app_name, ''),
+	coalesce(actor_email, '')
+`
+
+// scanEvent scans eventColumns
+func scanEvent(rows *sql.Rows, event *CFAuditEvent) error {
+	bytesOfMetadataJSON := []byte{}
+	err := rows.Scan(
+		&event.ID,
+		&event.Foundation,
+		&event.GUID,
+		&event.CreatedAt,
+		&event.Type,
+		&event.Actor,
+		&event.ActorType,
+		&event.ActorName,
+		&event.ActorUsername,
+		&event.Actee,
+		&event.ActeeType,
+		&event.ActeeName,
+		&event.OrganizationGUID,
+		&event.SpaceGUID,
+		&bytesOfMetadataJSON,
+		&event.OrganizationName,
+		&event.SpaceName,
+		&event.AppName,
+		&event.ActorEmail,
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer tx.Rollback()
-	rows, err := tx.Query(`
-		with last_shipped_event as (
-			select updated_at, shipped_id
-			from
-				` + ShipperCursorsTable + ` where name = '` + shipperName + `'
-			union
-				select (date '1970 1 1')::timestamptz, ''
-			order by updated_at desc
-			limit 1
-		),
-		recent_cf_audit_events as (
-			select *
-			from ` + CFAuditEventsTable + `
-			where created_at >= (select updated_at from last_shipped_event)
-			order by created_at asc
-			limit 8192
-		)
-		select
-			guid,
-			created_at,
-			event_type,
-			actor,
-			actor_type,
-			actor_name,
-			actor_username,
-			actee,
-			actee_type,
-			actee_name,
-			coalesce(organization_guid::text, ''),
-			coalesce(space_guid::text, ''),
-			metadata
-		from recent_cf_audit_events
-		where guid::text != (select shipped_id from last_shipped_event)
-		order by created_at asc
-	`)
+	if len(bytesOfMetadataJSON) > 0 {
+		return json.Unmarshal(bytesOfMetadataJSON, &event.Metadata)
+	}
+	return nil
+}
+
+// GetUnshippedCFAuditEventsForShipper returns up to limit of the events
+// stored after the last one the shipper shipped, in id order. Restored events
+// are skipped. The events are read in one statement, so that no transaction
+// is held open while they are shipped, which would hold up removing
+// partitions.
+func (s *EventStore) GetUnshippedCFAuditEventsForShipper(shipperName string, limit int) ([]CFAuditEvent, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
+	defer cancel()
+
+	rows, err := s.querier(ctx, nil).Query(`
+		select `+eventColumns+`
+		from `+CFAuditEventsTable+`
+		where
+			id > coalesce((select shipped_seq from `+ShipperCursorsTable+` where name = $1), 0)
+			and origin != '`+OriginRestored+`'
+		order by id asc
+		limit $2
+	`, shipperName, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	events := []CFAuditEvent{}
 	for rows.Next() {
-		event := cfclient.Event{}
-		bytesOfMetadataJSON := []byte{}
-		err = rows.Scan(
-			&event.GUID,
-			&event.CreatedAt,
-			&event.Type,
-			&event.Actor,
-			&event.ActorType,
-			&event.ActorName,
-			&event.ActorUsername,
-			&event.Actee,
-			&event.ActeeType,
-			&event.ActeeName,
-			&event.OrganizationGUID,
-			&event.SpaceGUID,
-			&bytesOfMetadataJSON,
-		)
-		if err != nil {
+		event := CFAuditEvent{}
+		if err := scanEvent(rows, &event); err != nil {
 			return nil, err
 		}
-		if len(bytesOfMetadataJSON) > 0 {
-			err = json.Unmarshal(bytesOfMetadataJSON, &event.Metadata)
-			if err != nil {
-				return nil, err
-			}
-		}
 		events = append(events, event)
 	}
-	return events, nil
+	return events, rows.Err()
 }
 
-func (s *EventStore) UpdateShipperCursor(shipperName string, shipperTime string, shippedID string) error {
+// UpdateShipperCursor records the last event a shipper has shipped
+func (s *EventStore) UpdateShipperCursor(shipperName string, lastShipped CFAuditEvent) error {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultStoreTimeout)
 	defer cancel()
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
 
-	stmt := fmt.Sprintf(
-		`insert into %s (name, updated_at, shipped_id) values (
-				$1, $2, $3
+	return s.write(ctx, func(q querier) error {
+		_, err := q.Exec(`
+			insert into `+ShipperCursorsTable+` (name, shipped_seq, updated_at, shipped_id) values (
+				$1, $2, $3, $4
 			) on conflict on constraint name_unique do
 			update set
+				shipped_seq = excluded.shipped_seq,
 				updated_at = excluded.updated_at,
-				shipped_id = excluded.shipped_id`,
-		ShipperCursorsTable,
-	)
-
-	_, err = tx.Exec(stmt, shipperName, shipperTime, shippedID)
-	if err != nil {
+				shipped_id = excluded.shipped_id
+		`, shipperName, lastShipped.ID, lastShipped.CreatedAt, lastShipped.GUID)
 		return err
-	}
-
-	return tx.Commit()
+	})
 }
 
-func (s *EventStore) GetLatestCFEventTime() (time.Time, error) {
+// GetLatestCFEventTime returns the time of the latest event collected from
+// foundation, or the start of 1970 if there are none
+func (s *EventStore) GetLatestCFEventTime(foundation string) (time.Time, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
+	row := s.querier(ctx, nil).QueryRow(`
 		select
 			created_at
 		from
 			`+CFAuditEventsTable+`
+		where
+			foundation = $1
 		order by
 			created_at DESC
 		limit 1
-	`)
+	`, foundation)
 
 	createdAt := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
 	err := row.Scan(&createdAt)
@@ -307,72 +638,52 @@ func (s *EventStore) GetLatestCFEventTime() (time.Time, error) {
 	return createdAt, nil // if no rows, return 1st Jan 1970
 }
 
-func (s *EventStore) GetCFEventCount() (int64, error) {
+// GetCFEventCounts estimates the number of stored events from each
+// foundation from the planner's statistics for each partition: its number of
+// rows, split by the frequencies of its most common foundations. Partitions
+// which have not been analyzed yet are counted under the empty foundation.
+// Foundations with no events are left out.
+func (s *EventStore) GetCFEventCounts() (map[string]int64, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DefaultQueryTimeout)
 	defer cancel()
-	row := s.db.QueryRowContext(
-		ctx,
-		fmt.Sprintf(
-			`SELECT reltuples::numeric FROM pg_class WHERE relname = '%s';`,
-			CFAuditEventsTable,
-		),
-	)
-
-	var cfEventCount int64
-	err := row.Scan(&cfEventCount)
-	if err == sql.ErrNoRows {
-		return int64(0), nil
-	} else if err != nil {
-		return int64(0), err
-	}
-	return cfEventCount, nil
-}
-
-func (s *EventStore) runSQLFilesInTransaction(ctx context.Context, filenames ...string) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	for _, filename := range filenames {
-		if err := s.runSQLFile(tx, filename); err != nil {
-			return err
-		}
-	}
-	return tx.Commit()
-}
-
-func (s *EventStore) runSQLFile(tx *sql.Tx, filename string) error {
-	startTime := time.Now()
-	s.logger.Info("run-sql-file", map[string]interface{}{"sqlFile": filename})
-
-	defer func() {
-		s.logger.Info("finish-sql-file", lager.Data{
-			"sqlFile": filename,
-			"elapsed": time.Since(startTime),
-		})
-	}()
-
-	schemaFilename := schemaFile(filename)
-	sql, err := ioutil.ReadFile(schemaFilename)
+	rows, err := s.querier(ctx, nil).Query(`
+		select
+			coalesce(mcv.foundation, ''),
+			coalesce(sum(greatest(c.reltuples, 0) * coalesce(mcv.freq, 1)), 0)::bigint
+		from pg_inherits i
+		join pg_class c on c.oid = i.inhrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		left join lateral (
+			select v.foundation, v.freq
+			from
+				pg_stats st,
+				unnest(st.most_common_vals::text::text[], st.most_common_freqs) as v(foundation, freq)
+			where
+				st.schemaname = n.nspname
+				and st.tablename = c.relname
+				and st.attname = 'foundation'
+		) mcv on true
+		where i.inhparent = $1::regclass
+		group by 1
+		having sum(greatest(c.reltuples, 0) * coalesce(mcv.freq, 1)) >= 0.5
+	`, CFAuditEventsTable)
 	if err != nil {
-		return fmt.Errorf("failed to execute sql file %s: %s", schemaFilename, err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	_, err = tx.Exec(string(sql))
-	if err != nil {
-		return wrapPqError(err, schemaFilename)
+	counts := map[string]int64{}
+	for rows.Next() {
+		var (
+			foundation string
+			count      int64
+		)
+		if err := rows.Scan(&foundation, &count); err != nil {
+			return nil, err
+		}
+		counts[foundation] = count
 	}
-
-	return nil
-}
-
-// queryJSON returns rows as a json blobs, which makes it easier to decode into structs.
-func queryJSON(tx *sql.Tx, q string, args ...interface{}) (*sql.Rows, error) {
-	return tx.Query(fmt.Sprintf(`
-		with q as ( %s )
-		select row_to_json(q.*) from q;
-	`, q), args...)
+	return counts, rows.Err()
 }
 
 func wrapPqError(err error, prefix string) error {
@@ -391,18 +702,3 @@ func wrapPqError(err error, prefix string) error {
 	}
 	return fmt.Errorf("%s: %s", prefix, msg)
 }
-
-func schemaDir() string {
-	root := os.Getenv("APP_ROOT")
-	if root == "" {
-		root = os.Getenv("PWD")
-	}
-	if root == "" {
-		root, _ = os.Getwd()
-	}
-	return filepath.Join(root, "pkg", "db", "sql")
-}
-
-func schemaFile(filename string) string {
-	return filepath.Join(schemaDir(), filename)
-}
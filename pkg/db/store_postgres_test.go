@@ -0,0 +1,1236 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/lib/pq"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// These tests need a Postgres server, eg from make start-postgres-docker.
+// Each test gets a database of its own, which is dropped afterwards.
+var _ = Describe("EventStore with Postgres", func() {
+	var (
+		adminDB   *sql.DB
+		testDB    *sql.DB
+		dbName    string
+		store     *db.EventStore
+		malicious = []string{
+			`'; drop table cf_audit_events; --`,
+			`' or '1'='1`,
+			`$1`,
+			`"quoted" name`,
+			`back\slash`,
+		}
+	)
+
+	event := func(i int, actor string) cfclient.Event {
+		return cfclient.Event{
+			GUID:      fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+			CreatedAt: time.Date(2020, 1, 2, 3, 4, i, 0, time.UTC).Format(time.RFC3339),
+			Type:      "audit.app.update",
+			Actor:     actor,
+			ActorType: "user",
+			Actee:     "some-actee",
+			ActeeType: "app",
+			Metadata:  map[string]interface{}{},
+		}
+	}
+
+	BeforeEach(func() {
+		databaseURL := os.Getenv("TEST_DATABASE_URL")
+		if databaseURL == "" {
+			Skip("TEST_DATABASE_URL is not set")
+		}
+
+		var err error
+		adminDB, err = sql.Open("postgres", databaseURL)
+		Expect(err).NotTo(HaveOccurred())
+		dbName = fmt.Sprintf("paas_auditor_test_%d", time.Now().UnixNano())
+		_, err = adminDB.Exec(`create database ` + pq.QuoteIdentifier(dbName))
+		Expect(err).NotTo(HaveOccurred())
+
+		testURL, err := url.Parse(databaseURL)
+		Expect(err).NotTo(HaveOccurred())
+		testURL.Path = "/" + dbName
+		testDB, err = sql.Open("postgres", testURL.String())
+		Expect(err).NotTo(HaveOccurred())
+
+		logger := lager.NewLogger("store-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+		store = db.NewEventStore(context.Background(), testDB, logger)
+		Expect(store.Init()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if store != nil {
+			Expect(store.Close()).To(Succeed())
+		}
+		if testDB != nil {
+			Expect(testDB.Close()).To(Succeed())
+		}
+		if adminDB != nil {
+			_, err := adminDB.Exec(`drop database if exists ` + pq.QuoteIdentifier(dbName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(adminDB.Close()).To(Succeed())
+		}
+		store, testDB, adminDB = nil, nil, nil
+	})
+
+	unshipped := func(shipperName string) []string {
+		events, err := store.GetUnshippedCFAuditEventsForShipper(shipperName, 100)
+		Expect(err).NotTo(HaveOccurred())
+		guids := []string{}
+		for _, event := range events {
+			guids = append(guids, event.GUID)
+		}
+		return guids
+	}
+
+	It("keeps the cursors of shippers with names containing SQL apart", func() {
+		stored, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "a"), event(3, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(3))
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+
+		for i, name := range malicious {
+			By(fmt.Sprintf("shipping to %q", name))
+			Expect(unshipped(name)).To(HaveLen(3))
+			Expect(store.UpdateShipperCursor(name, events[i%3])).To(Succeed())
+			Expect(unshipped(name)).To(HaveLen(2 - i%3))
+		}
+
+		By("checking each cursor was stored under its own name")
+		var cursors int
+		Expect(testDB.QueryRow(`select count(*) from ` + db.ShipperCursorsTable).Scan(&cursors)).To(Succeed())
+		Expect(cursors).To(Equal(len(malicious)))
+		Expect(unshipped("some-other-shipper")).To(HaveLen(3))
+
+		events, err = store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+	})
+
+	It("ships backfilled events without alerting on them", func() {
+		_, err := store.InitAlertCursor("test-engine")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.BackfillCFAuditEvents("", []cfclient.Event{event(1, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(2, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(unshipped("some-shipper")).To(Equal([]string{event(1, "").GUID, event(2, "").GUID}))
+		unevaluated := []string{}
+		err = store.StreamUnevaluatedCFAuditEvents(context.Background(), "test-engine", func(event db.CFAuditEvent) error {
+			unevaluated = append(unevaluated, event.GUID)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unevaluated).To(Equal([]string{event(2, "").GUID}))
+	})
+
+	It("does not ship or alert on restored events", func() {
+		_, err := store.InitAlertCursor("test-engine")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		restored, err := store.RestoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(Equal(1))
+		_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(3, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(unshipped("some-shipper")).To(Equal([]string{event(1, "").GUID, event(3, "").GUID}))
+		unevaluated := []string{}
+		err = store.StreamUnevaluatedCFAuditEvents(context.Background(), "test-engine", func(event db.CFAuditEvent) error {
+			unevaluated = append(unevaluated, event.GUID)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unevaluated).To(Equal([]string{event(1, "").GUID, event(3, "").GUID}))
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+	})
+
+	It("keeps events from each foundation apart", func() {
+		stored, err := store.StoreCFAuditEvents("foundation-a", []cfclient.Event{event(1, "a"), event(2, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(2))
+
+		By("storing events with the same GUIDs from another foundation")
+		stored, err = store.StoreCFAuditEvents("foundation-b", []cfclient.Event{event(1, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(1))
+		stored, err = store.StoreCFAuditEvents("foundation-b", []cfclient.Event{event(1, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(0))
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Foundation: "foundation-b"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Foundation).To(Equal("foundation-b"))
+		Expect(events[0].GUID).To(Equal(event(1, "").GUID))
+
+		By("checking the latest event of each foundation")
+		latest, err := store.GetLatestCFEventTime("foundation-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(latest.UTC().Format(time.RFC3339)).To(Equal(event(2, "").CreatedAt))
+		latest, err = store.GetLatestCFEventTime("foundation-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(latest.UTC().Format(time.RFC3339)).To(Equal(event(1, "").CreatedAt))
+		latest, err = store.GetLatestCFEventTime("foundation-c")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(latest.Year()).To(Equal(1970))
+
+		By("estimating the events from each foundation")
+		_, err = testDB.Exec(`analyze ` + db.CFAuditEventsTable)
+		Expect(err).NotTo(HaveOccurred())
+		counts, err := store.GetCFEventCounts()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts).To(Equal(map[string]int64{"foundation-a": 2, "foundation-b": 1}))
+
+		verification, err := store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).To(BeNil())
+		Expect(verification.EventsChecked).To(BeNumerically("==", 3))
+	})
+
+	It("only returns the events of organizations in the foundation they are in", func() {
+		orgGUID := "0f0a7e3e-4a5c-4c0e-8bd1-2b1d2cbb0d55"
+		inOrg := func(i int) cfclient.Event {
+			e := event(i, "someone")
+			e.OrganizationGUID = orgGUID
+			return e
+		}
+		_, err := store.StoreCFAuditEvents("foundation-a", []cfclient.Event{inOrg(1), event(2, "someone")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.StoreCFAuditEvents("foundation-b", []cfclient.Event{inOrg(3)}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{
+			Organizations: map[string][]string{"foundation-a": {orgGUID}, "foundation-c": {orgGUID}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Foundation).To(Equal("foundation-a"))
+		Expect(events[0].GUID).To(Equal(inOrg(1).GUID))
+
+		By("returning nothing for a principal without organizations")
+		events, err = store.GetCFAuditEvents(db.RawEventFilter{Organizations: map[string][]string{}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("stores the names resolved for events and covers them by the hash chain", func() {
+		names := map[string]db.EventNames{
+			event(1, "").GUID: {OrganizationName: "some-org", SpaceName: "some-space", AppName: "some-app", ActorEmail: "someone@example.com"},
+		}
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "a")}, names)
+		Expect(err).NotTo(HaveOccurred())
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].EventNames).To(Equal(names[event(1, "").GUID]))
+		Expect(events[1].EventNames).To(Equal(db.EventNames{}))
+
+		var nullNames int
+		err = testDB.QueryRow(`select count(*) from cf_audit_events where organization_name is null and actor_email is null`).Scan(&nullNames)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nullNames).To(Equal(1))
+
+		verification, err := store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).To(BeNil())
+
+		_, err = testDB.Exec(`update cf_audit_events set organization_name = 'renamed-org'`)
+		Expect(err).NotTo(HaveOccurred())
+		verification, err = store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).NotTo(BeNil())
+		Expect(verification.Break.GUID).To(Equal(events[0].GUID))
+		Expect(verification.Break.Reason).To(Equal("content does not match its content hash"))
+	})
+
+	It("keeps every name a resource has been seen with", func() {
+		at := func(day int) time.Time {
+			return time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)
+		}
+		seen := func(name string, first int, last int) db.ResourceName {
+			return db.ResourceName{
+				Foundation: "foundation-a", Type: db.ResourceTypeOrganization, GUID: "org-guid",
+				Name: name, FirstSeenAt: at(first), LastSeenAt: at(last),
+			}
+		}
+		Expect(store.StoreResourceNames([]db.ResourceName{seen("old-name", 2, 3), seen("old-name", 1, 1)})).To(Succeed())
+		Expect(store.StoreResourceNames([]db.ResourceName{seen("new-name", 5, 5), seen("old-name", 4, 4)})).To(Succeed())
+		other := seen("other-foundation", 9, 9)
+		other.Foundation = "foundation-b"
+		Expect(store.StoreResourceNames([]db.ResourceName{other})).To(Succeed())
+
+		names, err := store.GetResourceNames("foundation-a", db.ResourceTypeOrganization, "org-guid")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(HaveLen(2))
+		Expect(names[0].Name).To(Equal("new-name"))
+		Expect(names[1].Name).To(Equal("old-name"))
+		Expect(names[1].FirstSeenAt.Equal(at(1))).To(BeTrue())
+		Expect(names[1].LastSeenAt.Equal(at(4))).To(BeTrue())
+	})
+
+	It("checkpoints backfill windows and completes the job with its last window", func() {
+		epoch := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+		job := db.BackfillJob{Foundation: "foundation-a", Start: epoch, End: end}
+		windows := []db.BackfillWindow{
+			{Foundation: "foundation-a", Start: end.Add(-24 * time.Hour), End: end},
+			{Foundation: "foundation-a", Start: epoch, End: end.Add(-24 * time.Hour)},
+		}
+
+		missing, err := store.GetBackfillJob("foundation-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeNil())
+
+		stored, err := store.CreateBackfillJob(job, windows)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.End.Equal(end)).To(BeTrue())
+
+		By("keeping the first job of a foundation")
+		again, err := store.CreateBackfillJob(db.BackfillJob{Foundation: "foundation-a", Start: epoch, End: end.Add(time.Hour)}, windows[:1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again.End.Equal(end)).To(BeTrue())
+
+		storedWindows, err := store.GetBackfillWindows("foundation-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storedWindows).To(HaveLen(2))
+		Expect(storedWindows[0].Start.Equal(windows[0].Start)).To(BeTrue())
+		Expect(storedWindows[0].NextPageURL).To(BeEmpty())
+		Expect(storedWindows[0].UpdatedAt).To(BeNil())
+
+		By("checkpointing a window")
+		checkpoint := storedWindows[0]
+		checkpoint.NextPageURL = "/v2/events?page=2"
+		checkpoint.PagesFetched = 1
+		checkpoint.EventsStored = 100
+		Expect(store.UpdateBackfillWindow(checkpoint)).To(Succeed())
+
+		storedWindows, err = store.GetBackfillWindows("foundation-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storedWindows[0].NextPageURL).To(Equal("/v2/events?page=2"))
+		Expect(storedWindows[0].PagesFetched).To(Equal(int64(1)))
+		Expect(storedWindows[0].EventsStored).To(Equal(int64(100)))
+		Expect(storedWindows[0].UpdatedAt).NotTo(BeNil())
+
+		By("completing every window")
+		for _, window := range storedWindows {
+			completedAt := time.Now()
+			window.NextPageURL = ""
+			window.CompletedAt = &completedAt
+			Expect(store.UpdateBackfillWindow(window)).To(Succeed())
+
+			current, err := store.GetBackfillJob("foundation-a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.CompletedAt == nil).To(Equal(window.Start.Equal(windows[0].Start)))
+		}
+
+		jobs, err := store.GetBackfillJobs()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].CompletedAt).NotTo(BeNil())
+	})
+
+	It("finds windows in which events were stored after they were archived", func() {
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "someone"), event(2, "someone")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		windowStart := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+		archive := db.CFAuditEventArchive{
+			WindowStart: windowStart,
+			WindowEnd:   windowStart.Add(24 * time.Hour),
+			Revision:    1,
+			ObjectKey:   "cf_audit_events/2020/01/02.ndjson.gz",
+			ManifestKey: "cf_audit_events/2020/01/02.ndjson.gz.manifest.json",
+			EventCount:  2,
+			MinID:       1,
+			MaxID:       2,
+			ArchivedAt:  time.Now(),
+		}
+		Expect(store.StoreCFAuditEventArchive(archive)).To(Succeed())
+		partition := db.Partition{Name: db.PartitionName(windowStart), Month: db.PartitionMonth(windowStart)}
+
+		late, checkedSeq, err := store.GetCFAuditEventArchivesWithLateEvents(100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(late).To(BeEmpty())
+		Expect(checkedSeq).To(BeNumerically("==", 2))
+		Expect(store.UpdateArchiveCursor(checkedSeq)).To(Succeed())
+		Expect(store.CountUnarchivedCFAuditEvents(partition)).To(BeNumerically("==", 0))
+
+		By("backfilling and restoring events in the window")
+		_, err = store.BackfillCFAuditEvents("", []cfclient.Event{event(3, "someone")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.RestoreCFAuditEvents("", []cfclient.Event{event(4, "someone")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		late, checkedSeq, err = store.GetCFAuditEventArchivesWithLateEvents(100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(late).To(HaveLen(1))
+		Expect(late[0].WindowStart.Equal(windowStart)).To(BeTrue())
+		Expect(late[0].Revision).To(Equal(1))
+		Expect(checkedSeq).To(BeNumerically("==", 4))
+		Expect(store.CountUnarchivedCFAuditEvents(partition)).To(BeNumerically("==", 1))
+
+		By("looking at a page of events at a time")
+		late, checkedSeq, err = store.GetCFAuditEventArchivesWithLateEvents(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(late).To(HaveLen(1))
+		Expect(checkedSeq).To(BeNumerically("==", 3))
+
+		By("archiving the window again")
+		archive.Revision = 2
+		archive.ObjectKey = "cf_audit_events/2020/01/02-r2.ndjson.gz"
+		archive.EventCount = 3
+		archive.MaxID = 3
+		Expect(store.StoreCFAuditEventArchive(archive)).To(Succeed())
+		Expect(store.StoreCFAuditEventArchive(archive)).To(MatchError(ContainSubstring("does not follow the stored revision")))
+		Expect(store.UpdateArchiveCursor(checkedSeq)).To(Succeed())
+
+		late, _, err = store.GetCFAuditEventArchivesWithLateEvents(100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(late).To(BeEmpty())
+		Expect(store.CountUnarchivedCFAuditEvents(partition)).To(BeNumerically("==", 0))
+
+		By("keeping restored events when deleting the archived ones")
+		deleted, err := store.DeleteArchivedCFAuditEvents(archive)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(BeNumerically("==", 3))
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].GUID).To(Equal(event(4, "").GUID))
+
+		archives, err := store.GetCFAuditEventArchives()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archives).To(HaveLen(1))
+		Expect(archives[0].Revision).To(Equal(2))
+		Expect(archives[0].ObjectKey).To(Equal(archive.ObjectKey))
+		Expect(archives[0].RowsDeletedAt).NotTo(BeNil())
+
+		verification, err := store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).To(BeNil())
+	})
+
+	It("treats filter values containing SQL as values", func() {
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "o'brien"), event(2, "someone")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, value := range malicious {
+			By(fmt.Sprintf("filtering by %q", value))
+			filters := []db.RawEventFilter{
+				{Kind: value},
+				{Actor: value},
+				{Actee: value},
+				{Foundation: value},
+			}
+			for _, filter := range filters {
+				events, err := store.GetCFAuditEvents(filter)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events).To(BeEmpty())
+			}
+		}
+
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Actor: "o'brien"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].GUID).To(Equal(event(1, "").GUID))
+
+		By("checking the events are all still there")
+		events, err = store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+
+		verification, err := store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).To(BeNil())
+		Expect(verification.EventsChecked).To(BeNumerically("==", 2))
+	})
+
+	It("keeps working when partitions are removed after its statements are prepared", func() {
+		january := event(1, "a")
+		february := event(2, "a")
+		february.GUID = "00000000-0000-4000-8000-000000000099"
+		february.CreatedAt = "2020-02-02T03:04:05Z"
+
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{january, february}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Actor: "a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+
+		month := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		removal, err := store.RemoveCFAuditEventPartition(
+			db.Partition{Name: db.PartitionName(month), Month: month},
+			db.PartitionActionDrop,
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removal.EventCount).To(BeNumerically("==", 1))
+
+		events, err = store.GetCFAuditEvents(db.RawEventFilter{Actor: "a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].GUID).To(Equal(february.GUID))
+
+		verification, err := store.VerifyChain()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verification.Break).To(BeNil())
+	})
+
+	It("does not remove a partition while it is held", func() {
+		january := event(1, "a")
+		february := event(2, "a")
+		february.GUID = "00000000-0000-4000-8000-000000000099"
+		february.CreatedAt = "2020-02-02T03:04:05Z"
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{january, february}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		month := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		partition := db.Partition{Name: db.PartitionName(month), Month: month}
+
+		By("holding the partition, and keeping the later expiry when it is held again")
+		Expect(store.HoldCFAuditEventPartition(month.AddDate(0, 0, 14), time.Now().Add(time.Hour), "restored a")).To(Succeed())
+		Expect(store.HoldCFAuditEventPartition(month, time.Now().Add(time.Minute), "restored b")).To(Succeed())
+		holds, err := store.GetCFAuditEventPartitionHolds()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holds).To(HaveLen(1))
+		Expect(holds[0].Month).To(Equal(month))
+		Expect(holds[0].Reason).To(Equal("restored a"))
+		Expect(holds[0].ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		_, err = store.RemoveCFAuditEventPartition(partition, db.PartitionActionDrop)
+		Expect(err).To(MatchError(db.ErrPartitionHeld))
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{Actor: "a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+
+		By("removing it once the hold has expired")
+		_, err = testDB.Exec(`update ` + db.PartitionHoldsTable + ` set expires_at = now() - interval '1 second'`)
+		Expect(err).NotTo(HaveOccurred())
+		holds, err = store.GetCFAuditEventPartitionHolds()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holds).To(BeEmpty())
+
+		removal, err := store.RemoveCFAuditEventPartition(partition, db.PartitionActionDrop)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removal.EventCount).To(BeNumerically("==", 1))
+		var remaining int
+		Expect(testDB.QueryRow(`select count(*) from ` + db.PartitionHoldsTable).Scan(&remaining)).To(Succeed())
+		Expect(remaining).To(Equal(0))
+	})
+
+	Describe("erasing a user", func() {
+		const (
+			userGUID  = "11111111-1111-4111-8111-111111111111"
+			otherGUID = "22222222-2222-4222-8222-222222222222"
+		)
+
+		storeEvents := func() {
+			byUser := event(1, userGUID)
+			byUser.ActorName = "someone@example.com"
+			byUser.ActorUsername = "someone@example.com"
+
+			aboutUser := event(2, otherGUID)
+			aboutUser.Type = "audit.user.space_developer_add"
+			aboutUser.ActeeType = "user"
+			aboutUser.Actee = userGUID
+			aboutUser.ActeeName = "someone@example.com"
+
+			mentionsUser := event(3, otherGUID)
+			mentionsUser.Metadata = map[string]interface{}{
+				"request": map[string]interface{}{"username": "someone@example.com", "role": "manager"},
+			}
+
+			unrelated := event(4, otherGUID)
+			unrelated.ActorName = "other@example.com"
+
+			_, err := store.StoreCFAuditEvents("", []cfclient.Event{byUser, aboutUser, mentionsUser, unrelated}, nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("pseudonymises every event about the user without changing the event count", func() {
+			storeEvents()
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasure.EventCount).To(BeNumerically("==", 3))
+			Expect(erasure.Pseudonym).To(HavePrefix("erased-"))
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			for _, e := range events {
+				Expect(e.Actor).NotTo(Equal(userGUID))
+				Expect(e.Actee).NotTo(Equal(userGUID))
+				Expect(e.ActorName).NotTo(Equal("someone@example.com"))
+				Expect(e.ActeeName).NotTo(Equal("someone@example.com"))
+			}
+			byGUID := map[string]cfclient.Event{}
+			for _, e := range events {
+				byGUID[e.GUID] = e.Event
+			}
+			Expect(byGUID[event(1, "").GUID].Actor).To(Equal(erasure.Pseudonym))
+			Expect(byGUID[event(1, "").GUID].ActorUsername).To(Equal(erasure.Pseudonym))
+			Expect(byGUID[event(2, "").GUID].Actor).To(Equal(otherGUID))
+			Expect(byGUID[event(2, "").GUID].Actee).To(Equal(erasure.Pseudonym))
+			Expect(byGUID[event(3, "").GUID].Metadata).To(Equal(map[string]interface{}{
+				"request": map[string]interface{}{"username": erasure.Pseudonym, "role": "manager"},
+			}))
+			Expect(byGUID[event(4, "").GUID].ActorName).To(Equal("other@example.com"))
+
+			erasures, err := store.GetCFAuditEventErasures()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasures).To(HaveLen(1))
+			Expect(erasures[0].ID).To(Equal(erasure.ID))
+			Expect(erasures[0].Reference).To(Equal("ticket-123"))
+			Expect(erasures[0].RequestedBy).To(Equal("cli:test"))
+			Expect(erasures[0].EventCount).To(BeNumerically("==", 3))
+		})
+
+		It("removes the email address resolved for the user and the names recorded for them", func() {
+			byUser := event(1, userGUID)
+			_, err := store.StoreCFAuditEvents("", []cfclient.Event{byUser, event(2, otherGUID)}, map[string]db.EventNames{
+				byUser.GUID:       {OrganizationName: "some-org", ActorEmail: "someone@example.com"},
+				event(2, "").GUID: {ActorEmail: "other@example.com"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.StoreResourceNames([]db.ResourceName{
+				{Type: db.ResourceTypeUser, GUID: userGUID, Name: "someone@example.com", FirstSeenAt: time.Now(), LastSeenAt: time.Now()},
+				{Type: db.ResourceTypeUser, GUID: otherGUID, Name: "other@example.com", FirstSeenAt: time.Now(), LastSeenAt: time.Now()},
+			})).To(Succeed())
+
+			_, err = store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events[0].EventNames).To(Equal(db.EventNames{OrganizationName: "some-org"}))
+			Expect(events[1].ActorEmail).To(Equal("other@example.com"))
+
+			names, err := store.GetResourceNames("", db.ResourceTypeUser, userGUID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(BeEmpty())
+			names, err = store.GetResourceNames("", db.ResourceTypeUser, otherGUID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(HaveLen(1))
+		})
+
+		It("finds the user by username", func() {
+			storeEvents()
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				Username:    "someone@example.com",
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasure.SubjectType).To(Equal(db.ErasureSubjectUsername))
+			Expect(erasure.EventCount).To(BeNumerically("==", 3))
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{Actor: userGUID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(BeEmpty())
+		})
+
+		It("keeps the hash chain verifiable", func() {
+			storeEvents()
+
+			_, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			verification, err := store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).To(BeNil())
+			Expect(verification.EventsChecked).To(BeNumerically("==", 4))
+			Expect(verification.ErasedEvents).To(BeNumerically("==", 3))
+		})
+
+		It("checks the content of erased events against their erasure", func() {
+			storeEvents()
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("detecting erased content which has been edited")
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = 'edited' where guid = $1`, event(1, "").GUID)
+			Expect(err).NotTo(HaveOccurred())
+			verification, err := store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.GUID).To(Equal(event(1, "").GUID))
+			Expect(verification.Break.Reason).To(ContainSubstring("recorded by erasure"))
+
+			By("detecting an event marked as erased by an erasure which did not change it")
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = $2 where guid = $1`, event(1, "").GUID, erasure.Pseudonym)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = 'edited', erasure_id = $2 where guid = $1`, event(4, "").GUID, erasure.ID)
+			Expect(err).NotTo(HaveOccurred())
+			verification, err = store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.GUID).To(Equal(event(4, "").GUID))
+			Expect(verification.Break.Reason).To(ContainSubstring("did not change this event"))
+		})
+
+		It("seals erasures so that their records cannot be edited", func() {
+			storeEvents()
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			head, err := store.GetChainHead()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(head.ErasureSeq).To(BeNumerically("==", 1))
+			Expect(head.ErasureChainHash).NotTo(BeEmpty())
+
+			verification, err := store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).To(BeNil())
+			Expect(verification.ErasuresChecked).To(BeNumerically("==", 1))
+			Expect(verification.Head.ErasureChainHash).To(Equal(head.ErasureChainHash))
+
+			By("detecting an erased event whose recorded hashes have been edited to match an edit")
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = 'edited' where guid = $1`, event(1, "").GUID)
+			Expect(err).NotTo(HaveOccurred())
+			var erasedContentHash []byte
+			Expect(testDB.QueryRow(`select erased_content_hash from cf_audit_event_erased_events where guid = $1`, event(1, "").GUID).Scan(&erasedContentHash)).To(Succeed())
+			edited, err := store.GetCFAuditEvents(db.RawEventFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			for _, e := range edited {
+				if e.GUID == event(1, "").GUID {
+					hash, err := db.ContentHash(e.Foundation, e.Event, e.EventNames)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = testDB.Exec(`update cf_audit_event_erased_events set erased_content_hash = $2 where guid = $1`, e.GUID, hash)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			verification, err = store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.ErasureID).To(Equal(erasure.ID))
+			Expect(verification.Break.Reason).To(ContainSubstring("record hash"))
+
+			By("detecting an event pointed at an erasure which has not been sealed")
+			_, err = testDB.Exec(`update cf_audit_event_erased_events set erased_content_hash = $2 where guid = $1`, event(1, "").GUID, erasedContentHash)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = $2 where guid = $1`, event(1, "").GUID, erasure.Pseudonym)
+			Expect(err).NotTo(HaveOccurred())
+			var fakeID int64
+			err = testDB.QueryRow(`
+				insert into cf_audit_event_erasures (pseudonym, subject_type, reference, requested_by, event_count, archive_keys)
+				values ('erased-fake', 'user_guid', 'fake', 'fake', 1, '{}')
+				returning id
+			`).Scan(&fakeID)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = testDB.Exec(`update cf_audit_events set actor_name = 'edited', erasure_id = $2 where guid = $1`, event(4, "").GUID, fakeID)
+			Expect(err).NotTo(HaveOccurred())
+			fake, err := store.GetCFAuditEvents(db.RawEventFilter{})
+			Expect(err).NotTo(HaveOccurred())
+			for _, e := range fake {
+				if e.GUID == event(4, "").GUID {
+					hash, err := db.ContentHash(e.Foundation, e.Event, e.EventNames)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = testDB.Exec(`
+						insert into cf_audit_event_erased_events (erasure_id, event_id, guid, content_hash, erased_content_hash)
+						select $1, id, guid, content_hash, $3 from cf_audit_events where guid = $2
+					`, fakeID, e.GUID, hash)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			verification, err = store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.GUID).To(Equal(event(4, "").GUID))
+			Expect(verification.Break.Reason).To(Equal(fmt.Sprintf("erasure %d is not sealed", fakeID)))
+		})
+
+		It("does not trust erasures of checkpointed events until they are checkpointed too", func() {
+			storeEvents()
+
+			head, err := store.GetChainHead()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.StoreChainCheckpoint(db.ChainCheckpoint{
+				HeadID: head.ID, ChainHash: head.ChainHash,
+				SignedAt: time.Now(), KeyID: "some-key-id", Signature: []byte("some-signature"),
+			})).To(Succeed())
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			verification, err := store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.Reason).To(Equal(fmt.Sprintf("erasure %d is not covered by a checkpoint yet", erasure.ID)))
+
+			head, err = store.GetChainHead()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.StoreChainCheckpoint(db.ChainCheckpoint{
+				HeadID: head.ID, ChainHash: head.ChainHash,
+				ErasureSeq: head.ErasureSeq, ErasureChainHash: head.ErasureChainHash,
+				SignedAt: time.Now(), KeyID: "some-key-id", Signature: []byte("some-signature"),
+			})).To(Succeed())
+			latest, err := store.GetLatestChainCheckpoint()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest.ErasureSeq).To(Equal(head.ErasureSeq))
+			Expect(latest.ErasureChainHash).To(Equal(head.ErasureChainHash))
+
+			verification, err = store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).To(BeNil())
+			Expect(verification.ErasedEvents).To(BeNumerically("==", 3))
+
+			By("detecting a checkpointed erasure which has been deleted")
+			_, err = testDB.Exec(`update cf_audit_event_erasures set seal_seq = null, record_hash = null, chain_hash = null`)
+			Expect(err).NotTo(HaveOccurred())
+			verification, err = store.VerifyChain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.Break).NotTo(BeNil())
+			Expect(verification.Break.Reason).To(Equal(fmt.Sprintf("erasure at the head of checkpoint %d is missing", latest.ID)))
+		})
+
+		Describe("erasures made before erasures were sealed", func() {
+			var (
+				erasure   db.Erasure
+				originals []db.FoundationEvent
+			)
+
+			// unseal makes erasure look like one made before erasures
+			// recorded the events they changed, and were sealed
+			unseal := func() {
+				_, err := testDB.Exec(`delete from cf_audit_event_erased_events where erasure_id = $1`, erasure.ID)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = testDB.Exec(`
+					update cf_audit_event_erasures
+					set events_recorded = false, seal_seq = null, record_hash = null, chain_hash = null
+					where id = $1
+				`, erasure.ID)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			BeforeEach(func() {
+				storeEvents()
+				stored, err := store.GetCFAuditEvents(db.RawEventFilter{})
+				Expect(err).NotTo(HaveOccurred())
+				originals = []db.FoundationEvent{}
+				for _, e := range stored {
+					originals = append(originals, db.NewFoundationEvent(e))
+				}
+
+				erasure, err = store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+					UserGUID:    userGUID,
+					Reference:   "ticket-123",
+					RequestedBy: "cli:test",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				unseal()
+			})
+
+			It("are not trusted, even after the app starts again", func() {
+				Expect(store.Init()).To(Succeed())
+
+				unsealed, err := store.GetUnsealedCFAuditEventErasures()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unsealed).To(HaveLen(1))
+				Expect(unsealed[0].ID).To(Equal(erasure.ID))
+
+				verification, err := store.VerifyChain()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verification.Break).NotTo(BeNil())
+				Expect(verification.Break.Reason).To(Equal(fmt.Sprintf("erasure %d is not sealed", erasure.ID)))
+			})
+
+			It("are sealed once their events have been checked against the originals", func() {
+				Expect(store.SealEarlierCFAuditEventErasure(erasure.ID, originals)).To(Succeed())
+
+				unsealed, err := store.GetUnsealedCFAuditEventErasures()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unsealed).To(BeEmpty())
+
+				verification, err := store.VerifyChain()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verification.Break).To(BeNil())
+				Expect(verification.ErasedEvents).To(BeNumerically("==", 3))
+				Expect(verification.ErasuresChecked).To(BeNumerically("==", 1))
+
+				err = store.SealEarlierCFAuditEventErasure(erasure.ID, originals)
+				Expect(err).To(MatchError(ContainSubstring("already sealed")))
+			})
+
+			It("are not sealed if an event has been edited", func() {
+				_, err := testDB.Exec(`update cf_audit_events set actee_name = 'edited' where guid = $1`, event(1, "").GUID)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = store.SealEarlierCFAuditEventErasure(erasure.ID, originals)
+				Expect(err).To(MatchError(ContainSubstring("differs from its original")))
+
+				unsealed, err := store.GetUnsealedCFAuditEventErasures()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unsealed).To(HaveLen(1))
+			})
+
+			It("are not sealed if an event has no original, or its original does not match the event", func() {
+				err := store.SealEarlierCFAuditEventErasure(erasure.ID, originals[1:])
+				Expect(err).To(MatchError(ContainSubstring("no original")))
+
+				originals[0].Type = "audit.app.delete-request"
+				err = store.SealEarlierCFAuditEventErasure(erasure.ID, originals)
+				Expect(err).To(MatchError(ContainSubstring("does not match the content hash")))
+
+				unsealed, err := store.GetUnsealedCFAuditEventErasures()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unsealed).To(HaveLen(1))
+			})
+		})
+
+		It("reports the copies it could not search or change", func() {
+			december := event(9, otherGUID)
+			december.CreatedAt = "2019-12-02T03:04:05Z"
+			_, err := store.StoreCFAuditEvents("", []cfclient.Event{december}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			storeEvents()
+
+			month := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+			_, err = store.RemoveCFAuditEventPartition(
+				db.Partition{Name: db.PartitionName(month), Month: month},
+				db.PartitionActionDetach,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			archive := db.CFAuditEventArchive{
+				WindowStart: time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC),
+				WindowEnd:   time.Date(2019, 11, 2, 0, 0, 0, 0, time.UTC),
+				ObjectKey:   "events/2019/11/01.jsonl.gz",
+				ManifestKey: "events/2019/11/01.manifest.json",
+				ArchivedAt:  time.Now(),
+			}
+			Expect(store.StoreCFAuditEventArchive(archive)).To(Succeed())
+			_, err = store.DeleteArchivedCFAuditEvents(archive)
+			Expect(err).NotTo(HaveOccurred())
+
+			events, err := store.GetCFAuditEvents(db.RawEventFilter{Reverse: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events[0].GUID).To(Equal(event(1, "").GUID))
+			Expect(store.UpdateShipperCursor("sink-a", events[0])).To(Succeed())
+			Expect(store.UpdateShipperCursor("sink-b", db.CFAuditEvent{Event: cfclient.Event{CreatedAt: december.CreatedAt}})).To(Succeed())
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasure.UnsearchedArchiveKeys).To(Equal([]string{"events/2019/11/01.jsonl.gz"}))
+			Expect(erasure.DetachedPartitions).To(Equal([]string{db.PartitionName(month)}))
+			Expect(erasure.ShippedTo).To(Equal([]string{"sink-a"}))
+
+			erasures, err := store.GetCFAuditEventErasures()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasures).To(HaveLen(1))
+			Expect(erasures[0].UnsearchedArchiveKeys).To(Equal(erasure.UnsearchedArchiveKeys))
+			Expect(erasures[0].DetachedPartitions).To(Equal(erasure.DetachedPartitions))
+			Expect(erasures[0].ShippedTo).To(Equal(erasure.ShippedTo))
+		})
+
+		It("records an erasure which found nothing", func() {
+			storeEvents()
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    "33333333-3333-4333-8333-333333333333",
+				Reference:   "ticket-456",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasure.EventCount).To(BeNumerically("==", 0))
+			Expect(erasure.ArchiveKeys).To(BeEmpty())
+
+			erasures, err := store.GetCFAuditEventErasures()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(erasures).To(HaveLen(1))
+		})
+	})
+
+	It("fences the writes of a leader which has lost its lease", func() {
+		_, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		events, err := store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+
+		leaseA := db.NewLease("test-role", "instance-a")
+		acquired, err := store.AcquireLeaderLease(leaseA, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+		Expect(leaseA.Generation()).To(BeNumerically("==", 1))
+		storeA := store.WithLease(leaseA)
+		Expect(storeA.UpdateShipperCursor("some-shipper", events[0])).To(Succeed())
+
+		By("keeping the generation when the lease is renewed")
+		acquired, err = store.AcquireLeaderLease(leaseA, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+		Expect(leaseA.Generation()).To(BeNumerically("==", 1))
+
+		By("not letting another instance take the lease before it expires")
+		leaseB := db.NewLease("test-role", "instance-b")
+		acquired, err = store.AcquireLeaderLease(leaseB, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeFalse())
+		Expect(leaseB.Generation()).To(BeZero())
+
+		By("rejecting the writes of the old leader once another instance has taken over")
+		_, err = testDB.Exec(`update ` + db.LeaderLeasesTable + ` set expires_at = now() - interval '1 second'`)
+		Expect(err).NotTo(HaveOccurred())
+		acquired, err = store.AcquireLeaderLease(leaseB, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+		Expect(leaseB.Generation()).To(BeNumerically("==", 2))
+
+		Expect(storeA.UpdateShipperCursor("some-shipper", events[0])).To(MatchError(db.ErrLeaseLost))
+		_, err = storeA.StoreCFAuditEvents("", []cfclient.Event{event(2, "a")}, nil)
+		Expect(err).To(MatchError(db.ErrLeaseLost))
+		events, err = store.GetCFAuditEvents(db.RawEventFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(store.WithLease(leaseB).UpdateShipperCursor("some-shipper", events[0])).To(Succeed())
+
+		By("rejecting the writes of an earlier term of the same instance")
+		earlierB := db.NewLease("test-role", "instance-b")
+		acquired, err = store.AcquireLeaderLease(earlierB, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+		Expect(store.ReleaseLeaderLease(leaseB)).To(Succeed())
+		Expect(leaseB.Generation()).To(BeZero())
+		acquired, err = store.AcquireLeaderLease(leaseB, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+		Expect(leaseB.Generation()).To(BeNumerically("==", 3))
+		Expect(store.WithLease(earlierB).UpdateShipperCursor("some-shipper", events[0])).To(MatchError(db.ErrLeaseLost))
+		Expect(store.WithLease(leaseB).UpdateShipperCursor("some-shipper", events[0])).To(Succeed())
+	})
+
+	Describe("alerts", func() {
+		unevaluated := func() []int64 {
+			ids := []int64{}
+			err := store.StreamUnevaluatedCFAuditEvents(context.Background(), "test-engine", func(event db.CFAuditEvent) error {
+				ids = append(ids, event.ID)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return ids
+		}
+
+		It("starts the cursor at the latest event stored before the engine first ran", func() {
+			_, err := store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "a")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unevaluated()).To(BeEmpty())
+
+			cursor, err := store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cursor).NotTo(BeZero())
+			Expect(unevaluated()).To(BeEmpty())
+
+			_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(3, "b")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unevaluated()).To(HaveLen(1))
+
+			again, err := store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again).To(Equal(cursor))
+		})
+
+		It("stores alerts and advances the cursor together", func() {
+			cursor, err := store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cursor).To(BeNumerically("==", 0))
+
+			_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "a"), event(3, "b")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			ids := unevaluated()
+			Expect(ids).To(HaveLen(3))
+
+			firstEventAt := time.Date(2020, 1, 2, 3, 4, 1, 0, time.UTC)
+			stored, err := store.StoreAlerts("test-engine", []db.Alert{{
+				Rule:         "some-rule",
+				GroupKey:     "a",
+				EventIDs:     ids[:2],
+				EventGUIDs:   []string{event(1, "").GUID, event(2, "").GUID},
+				FirstEventAt: firstEventAt,
+				LastEventAt:  firstEventAt.Add(time.Second),
+			}}, db.CFAuditEvent{ID: ids[1]})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(1))
+			Expect(stored[0].ID).NotTo(BeZero())
+			Expect(stored[0].TriggeredAt).NotTo(BeZero())
+
+			cursor, err = store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cursor).To(Equal(ids[1]))
+			Expect(unevaluated()).To(Equal(ids[2:]))
+
+			var (
+				eventCount int
+				eventIDs   pq.Int64Array
+			)
+			err = testDB.QueryRow(`select event_count, event_ids from alerts where id = $1`, stored[0].ID).Scan(&eventCount, &eventIDs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eventCount).To(Equal(2))
+			Expect([]int64(eventIDs)).To(Equal(ids[:2]))
+		})
+
+		It("tracks the delivery of alerts to each channel", func() {
+			_, err := store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(1, "a"), event(2, "b")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			ids := unevaluated()
+			at := time.Date(2020, 1, 2, 3, 4, 1, 0, time.UTC)
+			stored, err := store.StoreAlerts("test-engine", []db.Alert{
+				{Rule: "rule-a", GroupKey: "a", EventIDs: ids[:1], EventGUIDs: []string{event(1, "").GUID}, FirstEventAt: at, LastEventAt: at},
+				{Rule: "rule-b", GroupKey: "b", EventIDs: ids[1:], EventGUIDs: []string{event(2, "").GUID}, FirstEventAt: at, LastEventAt: at},
+			}, db.CFAuditEvent{ID: ids[1]})
+			Expect(err).NotTo(HaveOccurred())
+			since := time.Now().Add(-time.Hour)
+
+			undelivered, err := store.GetUndeliveredAlerts("some-channel", nil, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(HaveLen(2))
+			Expect(undelivered[0].ID).To(Equal(stored[0].ID))
+			Expect(undelivered[0].EventGUIDs).To(Equal([]string{event(1, "").GUID}))
+
+			By("only returning alerts for the channel's rules")
+			undelivered, err = store.GetUndeliveredAlerts("some-channel", []string{"rule-b"}, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(HaveLen(1))
+			Expect(undelivered[0].Rule).To(Equal("rule-b"))
+
+			By("only returning alerts triggered since the maximum age")
+			undelivered, err = store.GetUndeliveredAlerts("some-channel", nil, time.Now().Add(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(BeEmpty())
+
+			By("returning failed deliveries again once they are due")
+			nextAttemptAt := time.Now().Add(time.Hour)
+			Expect(store.StoreAlertDelivery(db.AlertDelivery{
+				AlertID: stored[0].ID, Channel: "some-channel", Status: db.AlertDeliveryFailed, Attempts: 3, LastError: "some-error",
+				Failures: 1, NextAttemptAt: &nextAttemptAt,
+			})).To(Succeed())
+			undelivered, err = store.GetUndeliveredAlerts("some-channel", nil, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(HaveLen(1))
+			Expect(undelivered[0].ID).To(Equal(stored[1].ID))
+
+			nextAttemptAt = time.Now().Add(-time.Second)
+			Expect(store.StoreAlertDelivery(db.AlertDelivery{
+				AlertID: stored[0].ID, Channel: "some-channel", Status: db.AlertDeliveryFailed, Attempts: 3, LastError: "some-error",
+				Failures: 1, NextAttemptAt: &nextAttemptAt,
+			})).To(Succeed())
+			undelivered, err = store.GetUndeliveredAlerts("some-channel", nil, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(HaveLen(2))
+			Expect(undelivered[0].DeliveryFailures).To(Equal(2))
+			Expect(undelivered[1].DeliveryFailures).To(BeZero())
+
+			deliveredAt := time.Now()
+			Expect(store.StoreAlertDelivery(db.AlertDelivery{
+				AlertID: stored[0].ID, Channel: "some-channel", Status: db.AlertDeliverySent, Attempts: 1, DeliveredAt: &deliveredAt,
+			})).To(Succeed())
+			Expect(store.StoreAlertDelivery(db.AlertDelivery{
+				AlertID: stored[1].ID, Channel: "some-channel", Status: db.AlertDeliverySilenced,
+			})).To(Succeed())
+			undelivered, err = store.GetUndeliveredAlerts("some-channel", nil, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(BeEmpty())
+
+			By("keeping channels apart")
+			undelivered, err = store.GetUndeliveredAlerts("other-channel", nil, since)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(undelivered).To(HaveLen(2))
+
+			By("adding up attempts")
+			var attempts int
+			err = testDB.QueryRow(`select attempts from alert_deliveries where alert_id = $1`, stored[0].ID).Scan(&attempts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(7))
+
+			By("finding when an alert for a rule and group key was last sent")
+			last, err := store.GetLastAlertDeliveryTime("some-channel", "rule-a", "a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(last).To(BeTemporally("~", deliveredAt, time.Millisecond))
+			last, err = store.GetLastAlertDeliveryTime("some-channel", "rule-b", "b")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(last).To(BeZero())
+		})
+
+		It("pseudonymises the group key of alerts when erasing a user", func() {
+			const userGUID = "11111111-1111-4111-8111-111111111111"
+			_, err := store.InitAlertCursor("test-engine")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.StoreCFAuditEvents("", []cfclient.Event{event(1, userGUID)}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			ids := unevaluated()
+
+			_, err = store.StoreAlerts("test-engine", []db.Alert{{
+				Rule:       "some-rule",
+				GroupKey:   userGUID,
+				EventIDs:   ids,
+				EventGUIDs: []string{event(1, "").GUID},
+			}}, db.CFAuditEvent{ID: ids[0]})
+			Expect(err).NotTo(HaveOccurred())
+
+			erasure, err := store.EraseUserFromCFAuditEvents(db.ErasureRequest{
+				UserGUID:    userGUID,
+				Reference:   "ticket-123",
+				RequestedBy: "cli:test",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var groupKey string
+			Expect(testDB.QueryRow(`select group_key from alerts`).Scan(&groupKey)).To(Succeed())
+			Expect(groupKey).To(Equal(erasure.Pseudonym))
+		})
+	})
+})
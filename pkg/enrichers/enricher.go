@@ -0,0 +1,180 @@
+package enrichers
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const DefaultCacheTTL = time.Hour
+
+// Enricher resolves the names of the organization, space and app each event
+// from a foundation is about, and the email address of the user who caused
+// it, so that they can be stored with the event.
+//
+// Names are cached for the cache TTL, including the absence of a name, so
+// that a page of events needs few requests. Every name seen is recorded, so
+// that when a resource has been deleted its last known name is used instead.
+// Failing to resolve a name never fails the events: the name is left empty.
+//
+// An Enricher is not safe for concurrent use. Each collector has its own.
+type Enricher struct {
+	foundation string
+	cacheTTL   time.Duration
+	logger     lager.Logger
+	resolver   Resolver
+	eventDB    db.EventDB
+
+	cache map[resourceKey]cachedName
+}
+
+type resourceKey struct {
+	resourceType string
+	guid         string
+}
+
+type cachedName struct {
+	name      string
+	expiresAt time.Time
+}
+
+func NewEnricher(
+	foundation string,
+	cacheTTL time.Duration,
+	logger lager.Logger,
+	resolver Resolver,
+	eventDB db.EventDB,
+) *Enricher {
+	logger = logger.Session("enricher", lager.Data{"foundation": foundation})
+	return &Enricher{
+		foundation: foundation,
+		cacheTTL:   cacheTTL,
+		logger:     logger,
+		resolver:   resolver,
+		eventDB:    eventDB,
+		cache:      map[resourceKey]cachedName{},
+	}
+}
+
+// Enrich returns the names resolved for events, by their GUID
+func (e *Enricher) Enrich(ctx context.Context, events []cfclient.Event) map[string]db.EventNames {
+	lsession := e.logger.Session("enrich")
+	now := time.Now()
+	for key, cached := range e.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(e.cache, key)
+		}
+	}
+
+	seen := []db.ResourceName{}
+	see := func(resourceType string, guid string, name string, at time.Time) {
+		seen = append(seen, db.ResourceName{
+			Foundation:  e.foundation,
+			Type:        resourceType,
+			GUID:        guid,
+			Name:        name,
+			FirstSeenAt: at,
+			LastSeenAt:  at,
+		})
+	}
+
+	// The name of the resource an event is about is in the event, as it was
+	// when the event happened, which is better than its current name
+	for _, event := range events {
+		if !isResolvable(event.ActeeType) || event.Actee == "" || event.ActeeName == "" {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, event.CreatedAt)
+		if err != nil {
+			createdAt = now
+		}
+		see(event.ActeeType, event.Actee, event.ActeeName, createdAt)
+	}
+
+	resolve := func(resourceType string, guid string) string {
+		if guid == "" {
+			return ""
+		}
+		key := resourceKey{resourceType, guid}
+		if cached, ok := e.cache[key]; ok {
+			return cached.name
+		}
+		if ctx.Err() != nil {
+			return ""
+		}
+
+		name, err := e.resolver.ResolveName(ctx, resourceType, guid)
+		if err == nil {
+			EnricherResolvedTotal.WithLabelValues(e.foundation, resourceType, "resolved").Inc()
+			see(resourceType, guid, name, now)
+		} else {
+			if err != ErrNotFound {
+				lsession.Error("err-resolve-name", err, lager.Data{"resource_type": resourceType, "guid": guid})
+				EnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+			}
+			name = e.lastKnownName(lsession, resourceType, guid)
+			status := "not-found"
+			if name != "" {
+				status = "last-known"
+			}
+			EnricherResolvedTotal.WithLabelValues(e.foundation, resourceType, status).Inc()
+		}
+		e.cache[key] = cachedName{name, now.Add(e.cacheTTL)}
+		return name
+	}
+
+	nameOf := func(event cfclient.Event, resourceType string, guid string) string {
+		if event.ActeeType == resourceType && event.Actee == guid && event.ActeeName != "" {
+			return event.ActeeName
+		}
+		return resolve(resourceType, guid)
+	}
+
+	names := make(map[string]db.EventNames, len(events))
+	for _, event := range events {
+		eventNames := db.EventNames{
+			OrganizationName: nameOf(event, db.ResourceTypeOrganization, event.OrganizationGUID),
+			SpaceName:        nameOf(event, db.ResourceTypeSpace, event.SpaceGUID),
+		}
+		if event.ActeeType == db.ResourceTypeApp {
+			eventNames.AppName = nameOf(event, db.ResourceTypeApp, event.Actee)
+		}
+		if event.ActorType == db.ResourceTypeUser {
+			eventNames.ActorEmail = resolve(db.ResourceTypeUser, event.Actor)
+		}
+		names[event.GUID] = eventNames
+	}
+
+	if err := e.eventDB.StoreResourceNames(seen); err != nil {
+		lsession.Error("err-store-resource-names", err)
+		EnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+	}
+	return names
+}
+
+// lastKnownName returns the name a resource was last seen with, or an empty
+// string if it has never been seen
+func (e *Enricher) lastKnownName(lsession lager.Logger, resourceType string, guid string) string {
+	names, err := e.eventDB.GetResourceNames(e.foundation, resourceType, guid)
+	if err != nil {
+		lsession.Error("err-get-resource-names", err, lager.Data{"resource_type": resourceType, "guid": guid})
+		EnricherErrorsTotal.WithLabelValues(e.foundation).Inc()
+		return ""
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0].Name
+}
+
+func isResolvable(resourceType string) bool {
+	switch resourceType {
+	case db.ResourceTypeOrganization, db.ResourceTypeSpace, db.ResourceTypeApp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package enrichers_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	"github.com/alphagov/paas-auditor/pkg/enrichers/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Enricher", func() {
+	var (
+		logger   lager.Logger
+		resolver *fakes.FakeResolver
+		eventDB  *dbfakes.FakeEventDB
+		enricher *enrichers.Enricher
+
+		foundation = "some-foundation"
+		names      map[string]string
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("enricher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		names = map[string]string{
+			"organization/org-guid": "some-org",
+			"space/space-guid":      "some-space",
+			"app/app-guid":          "some-app",
+			"user/user-guid":        "someone@example.com",
+		}
+		resolver = &fakes.FakeResolver{}
+		resolver.ResolveNameStub = func(_ context.Context, resourceType string, guid string) (string, error) {
+			if name, ok := names[resourceType+"/"+guid]; ok {
+				return name, nil
+			}
+			return "", enrichers.ErrNotFound
+		}
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetResourceNamesReturns([]db.ResourceName{}, nil)
+		enricher = enrichers.NewEnricher(foundation, time.Hour, logger, resolver, eventDB)
+	})
+
+	appEvent := func(guid string) cfclient.Event {
+		return cfclient.Event{
+			GUID:             guid,
+			Type:             "audit.app.update",
+			CreatedAt:        "2020-01-02T03:04:05Z",
+			Actor:            "user-guid",
+			ActorType:        "user",
+			Actee:            "app-guid",
+			ActeeType:        "app",
+			OrganizationGUID: "org-guid",
+			SpaceGUID:        "space-guid",
+		}
+	}
+
+	It("resolves the names of the organization, space and app, and the email of the actor", func() {
+		enriched := enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-1")})
+		Expect(enriched).To(Equal(map[string]db.EventNames{
+			"event-1": {
+				OrganizationName: "some-org",
+				SpaceName:        "some-space",
+				AppName:          "some-app",
+				ActorEmail:       "someone@example.com",
+			},
+		}))
+	})
+
+	It("caches names", func() {
+		enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-1"), appEvent("event-2")})
+		enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-3")})
+		Expect(resolver.ResolveNameCallCount()).To(Equal(4))
+	})
+
+	It("looks names up again once they have expired from the cache", func() {
+		enricher = enrichers.NewEnricher(foundation, 0, logger, resolver, eventDB)
+		enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-1")})
+		enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-2")})
+		Expect(resolver.ResolveNameCallCount()).To(Equal(8))
+	})
+
+	It("uses the name of the resource an event is about from the event", func() {
+		event := appEvent("event-1")
+		event.ActeeName = "old-app-name"
+		enriched := enricher.Enrich(context.Background(), []cfclient.Event{event})
+		Expect(enriched["event-1"].AppName).To(Equal("old-app-name"))
+
+		for i := 0; i < resolver.ResolveNameCallCount(); i++ {
+			_, resourceType, _ := resolver.ResolveNameArgsForCall(i)
+			Expect(resourceType).NotTo(Equal(db.ResourceTypeApp))
+		}
+	})
+
+	It("only resolves the app name of events about apps, and the email of users", func() {
+		event := appEvent("event-1")
+		event.ActeeType, event.Actee = "service_instance", "service-guid"
+		event.ActorType = "service_broker"
+		enriched := enricher.Enrich(context.Background(), []cfclient.Event{event})
+		Expect(enriched["event-1"]).To(Equal(db.EventNames{
+			OrganizationName: "some-org",
+			SpaceName:        "some-space",
+		}))
+	})
+
+	It("records the names it sees", func() {
+		event := appEvent("event-1")
+		event.ActeeName = "old-app-name"
+		enricher.Enrich(context.Background(), []cfclient.Event{event})
+
+		Expect(eventDB.StoreResourceNamesCallCount()).To(Equal(1))
+		seen := eventDB.StoreResourceNamesArgsForCall(0)
+		Expect(seen).To(ContainElement(db.ResourceName{
+			Foundation:  foundation,
+			Type:        db.ResourceTypeApp,
+			GUID:        "app-guid",
+			Name:        "old-app-name",
+			FirstSeenAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			LastSeenAt:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		}))
+		resolved := []string{}
+		for _, name := range seen {
+			resolved = append(resolved, name.Name)
+			Expect(name.Foundation).To(Equal(foundation))
+		}
+		Expect(resolved).To(ConsistOf("old-app-name", "some-org", "some-space", "someone@example.com"))
+	})
+
+	It("uses the last known name of a resource which has been deleted", func() {
+		delete(names, "organization/org-guid")
+		eventDB.GetResourceNamesStub = func(f string, resourceType string, guid string) ([]db.ResourceName, error) {
+			if resourceType == db.ResourceTypeOrganization {
+				return []db.ResourceName{{Name: "deleted-org"}, {Name: "older-name"}}, nil
+			}
+			return []db.ResourceName{}, nil
+		}
+
+		enriched := enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-1")})
+		Expect(enriched["event-1"].OrganizationName).To(Equal("deleted-org"))
+
+		f, resourceType, guid := eventDB.GetResourceNamesArgsForCall(0)
+		Expect([]string{f, resourceType, guid}).To(Equal([]string{foundation, "organization", "org-guid"}))
+		Expect(enrichers.EnricherResolvedTotal.WithLabelValues(foundation, "organization", "last-known")).To(
+			h.MetricIncrementedBy(0, ">=", 1),
+		)
+	})
+
+	It("leaves names empty, and carries on, when they cannot be resolved", func() {
+		errorsTotal := h.CurrentMetricValue(enrichers.EnricherErrorsTotal.WithLabelValues(foundation))
+		resolver.ResolveNameStub = nil
+		resolver.ResolveNameReturns("", errors.New("UAA responded with 403 Forbidden"))
+		eventDB.GetResourceNamesReturns(nil, errors.New("connection refused"))
+		eventDB.StoreResourceNamesReturns(errors.New("connection refused"))
+
+		enriched := enricher.Enrich(context.Background(), []cfclient.Event{appEvent("event-1")})
+		Expect(enriched).To(Equal(map[string]db.EventNames{"event-1": {}}))
+		Expect(enrichers.EnricherErrorsTotal.WithLabelValues(foundation)).To(
+			h.MetricIncrementedBy(errorsTotal, "==", 9),
+		)
+	})
+
+	It("stops resolving names once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		enriched := enricher.Enrich(ctx, []cfclient.Event{appEvent("event-1")})
+		Expect(enriched).To(HaveKeyWithValue("event-1", db.EventNames{}))
+		Expect(resolver.ResolveNameCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,120 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+)
+
+type FakeResolver struct {
+	ResolveNameStub        func(context.Context, string, string) (string, error)
+	resolveNameMutex       sync.RWMutex
+	resolveNameArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}
+	resolveNameReturns struct {
+		result1 string
+		result2 error
+	}
+	resolveNameReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeResolver) ResolveName(arg1 context.Context, arg2 string, arg3 string) (string, error) {
+	fake.resolveNameMutex.Lock()
+	ret, specificReturn := fake.resolveNameReturnsOnCall[len(fake.resolveNameArgsForCall)]
+	fake.resolveNameArgsForCall = append(fake.resolveNameArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("ResolveName", []interface{}{arg1, arg2, arg3})
+	fake.resolveNameMutex.Unlock()
+	if fake.ResolveNameStub != nil {
+		return fake.ResolveNameStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.resolveNameReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeResolver) ResolveNameCallCount() int {
+	fake.resolveNameMutex.RLock()
+	defer fake.resolveNameMutex.RUnlock()
+	return len(fake.resolveNameArgsForCall)
+}
+
+func (fake *FakeResolver) ResolveNameCalls(stub func(context.Context, string, string) (string, error)) {
+	fake.resolveNameMutex.Lock()
+	defer fake.resolveNameMutex.Unlock()
+	fake.ResolveNameStub = stub
+}
+
+func (fake *FakeResolver) ResolveNameArgsForCall(i int) (context.Context, string, string) {
+	fake.resolveNameMutex.RLock()
+	defer fake.resolveNameMutex.RUnlock()
+	argsForCall := fake.resolveNameArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeResolver) ResolveNameReturns(result1 string, result2 error) {
+	fake.resolveNameMutex.Lock()
+	defer fake.resolveNameMutex.Unlock()
+	fake.ResolveNameStub = nil
+	fake.resolveNameReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeResolver) ResolveNameReturnsOnCall(i int, result1 string, result2 error) {
+	fake.resolveNameMutex.Lock()
+	defer fake.resolveNameMutex.Unlock()
+	fake.ResolveNameStub = nil
+	if fake.resolveNameReturnsOnCall == nil {
+		fake.resolveNameReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.resolveNameReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeResolver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.resolveNameMutex.RLock()
+	defer fake.resolveNameMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeResolver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ enrichers.Resolver = new(FakeResolver)
@@ -0,0 +1,22 @@
+package enrichers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	EnricherResolvedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "enricher_names_resolved_total",
+		Help: "Number of names looked up for events, by whether they were resolved, only their last known name was found, or none was found",
+	}, []string{"foundation", "resource_type", "status"})
+
+	EnricherErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "enricher_errors_total",
+		Help: "Number of errors encountered while resolving names for events",
+	}, []string{"foundation"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(EnricherResolvedTotal)
+	prometheus.MustRegister(EnricherErrorsTotal)
+}
@@ -0,0 +1,137 @@
+package enrichers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// ErrNotFound is returned by a Resolver for a resource which does not exist,
+// eg because it has been deleted
+var ErrNotFound = errors.New("not found")
+
+// Resolver looks up the current name of an organization, space, app or user
+// in a foundation. The name of a user is their email address.
+type Resolver interface {
+	ResolveName(ctx context.Context, resourceType string, guid string) (string, error)
+}
+
+// CFResolver resolves the names of organizations, spaces and apps from Cloud
+// Controller's v3 API, and the email addresses of users from UAA. Looking up
+// users needs the scim.read scope.
+type CFResolver struct {
+	cfClient  cfclient.CloudFoundryClient
+	uaaURL    string
+	uaaClient *http.Client
+}
+
+// NewCFResolver returns a resolver which uses cfClient for Cloud Controller,
+// and uaaClient, which must add a token to requests, for the UAA at uaaURL
+func NewCFResolver(cfClient cfclient.CloudFoundryClient, uaaURL string, uaaClient *http.Client) *CFResolver {
+	return &CFResolver{cfClient, strings.TrimSuffix(uaaURL, "/"), uaaClient}
+}
+
+var cfResourcePaths = map[string]string{
+	db.ResourceTypeOrganization: "/v3/organizations/",
+	db.ResourceTypeSpace:        "/v3/spaces/",
+	db.ResourceTypeApp:          "/v3/apps/",
+}
+
+func (r *CFResolver) ResolveName(ctx context.Context, resourceType string, guid string) (string, error) {
+	if resourceType == db.ResourceTypeUser {
+		return r.resolveUserEmail(ctx, guid)
+	}
+	path, ok := cfResourcePaths[resourceType]
+	if !ok {
+		return "", fmt.Errorf("cannot resolve the names of %s resources", resourceType)
+	}
+	// The CF client does not take a context, so a request which has started
+	// is not cancelled
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	resp, err := r.cfClient.DoRequest(r.cfClient.NewRequest("GET", path+url.PathEscape(guid)))
+	if err != nil {
+		if isCFNotFound(err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	resource := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&resource); err != nil {
+		return "", err
+	}
+	if resource.Name == "" {
+		return "", ErrNotFound
+	}
+	return resource.Name, nil
+}
+
+func isCFNotFound(err error) bool {
+	if cfclient.IsResourceNotFoundError(err) {
+		return true
+	}
+	httpErr, ok := err.(cfclient.CloudFoundryHTTPError)
+	return ok && httpErr.StatusCode == http.StatusNotFound
+}
+
+// resolveUserEmail returns the user's primary email address, or their first
+// one if none is primary
+func (r *CFResolver) resolveUserEmail(ctx context.Context, guid string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.uaaURL+"/Users/"+url.PathEscape(guid), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.uaaClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("UAA responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	user := struct {
+		Emails []struct {
+			Value   string `json:"value"`
+			Primary bool   `json:"primary"`
+		} `json:"emails"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", err
+	}
+	email := ""
+	for _, e := range user.Emails {
+		if e.Primary || email == "" {
+			email = e.Value
+		}
+		if e.Primary {
+			break
+		}
+	}
+	if email == "" {
+		return "", ErrNotFound
+	}
+	return email, nil
+}
@@ -0,0 +1,76 @@
+package enrichers_test
+
+import (
+	"context"
+	"net/http"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/enrichers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("CFResolver", func() {
+	var (
+		fakeCF   *h.FakeCF
+		cfClient *cfclient.Client
+		resolver *enrichers.CFResolver
+	)
+
+	BeforeEach(func() {
+		fakeCF = h.NewFakeCF("paas-auditor", "some-secret")
+		fakeCF.AddResources(
+			h.FakeCFResource{Type: "organization", GUID: "org-guid", Name: "some-org"},
+			h.FakeCFResource{Type: "space", GUID: "space-guid", Name: "some-space"},
+			h.FakeCFResource{Type: "app", GUID: "app-guid", Name: "some-app"},
+			h.FakeCFResource{Type: "user", GUID: "user-guid", Name: "someone@example.com"},
+		)
+
+		var err error
+		cfClient, err = fakeCF.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		resolver = enrichers.NewCFResolver(cfClient, cfClient.Endpoint.TokenEndpoint, cfClient.Config.HttpClient)
+	})
+
+	AfterEach(func() {
+		fakeCF.Close()
+	})
+
+	It("resolves the names of organizations, spaces and apps, and the emails of users", func() {
+		for resourceType, expected := range map[string][]string{
+			db.ResourceTypeOrganization: {"org-guid", "some-org"},
+			db.ResourceTypeSpace:        {"space-guid", "some-space"},
+			db.ResourceTypeApp:          {"app-guid", "some-app"},
+			db.ResourceTypeUser:         {"user-guid", "someone@example.com"},
+		} {
+			name, err := resolver.ResolveName(context.Background(), resourceType, expected[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal(expected[1]))
+		}
+		Expect(fakeCF.Requests("/Users/user-guid")).To(Equal(1))
+	})
+
+	It("says when a resource does not exist", func() {
+		fakeCF.DeleteResource("app", "app-guid")
+		fakeCF.DeleteResource("user", "user-guid")
+
+		_, err := resolver.ResolveName(context.Background(), db.ResourceTypeApp, "app-guid")
+		Expect(err).To(Equal(enrichers.ErrNotFound))
+		_, err = resolver.ResolveName(context.Background(), db.ResourceTypeUser, "user-guid")
+		Expect(err).To(Equal(enrichers.ErrNotFound))
+	})
+
+	It("returns other errors", func() {
+		resolver = enrichers.NewCFResolver(cfClient, cfClient.Endpoint.TokenEndpoint, http.DefaultClient)
+		_, err := resolver.ResolveName(context.Background(), db.ResourceTypeUser, "user-guid")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("does not resolve other kinds of resource", func() {
+		_, err := resolver.ResolveName(context.Background(), "service_instance", "some-guid")
+		Expect(err).To(MatchError(ContainSubstring("cannot resolve")))
+	})
+})
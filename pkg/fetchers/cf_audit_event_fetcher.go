@@ -1,6 +1,7 @@
 package fetchers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,10 +12,12 @@ import (
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 )
 
-type CFAuditEventFetcher = func(pullEventsSince time.Time, resultsChan chan CFAuditEventResult)
+type CFAuditEventFetcher = func(ctx context.Context, pullEventsSince time.Time, resultsChan chan CFAuditEventResult)
 
-func FetchCFAuditEvents(cfg *FetcherConfig, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
-	fetchEvents(cfg, startPageURL(pullEventsSince), resultsChan)
+type pageGetter = func(cfClient cfclient.CloudFoundryClient, url string) (string, []cfclient.Event, error)
+
+func FetchCFAuditEvents(ctx context.Context, cfg *FetcherConfig, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
+	fetchEvents(ctx, cfg, startPageURL(pullEventsSince), getPage, resultsChan)
 }
 
 type CFAuditEventResult struct {
@@ -30,7 +33,7 @@ func startPageURL(pullEventsSince time.Time) string {
 	return fmt.Sprintf("/v2/events?%s", q.Encode())
 }
 
-func fetchEvents(cfg *FetcherConfig, startPageURL string, resultsChan chan CFAuditEventResult) {
+func fetchEvents(ctx context.Context, cfg *FetcherConfig, startPageURL string, getPage pageGetter, resultsChan chan CFAuditEventResult) {
 	defer close(resultsChan)
 
 	logger := cfg.Logger.WithData(lager.Data{"start_page_url": startPageURL})
@@ -46,20 +49,34 @@ func fetchEvents(cfg *FetcherConfig, startPageURL string, resultsChan chan CFAud
 		nextPageURL, events, err = getPage(cfg.CFClient, nextPageURL)
 		if err != nil {
 			logger.Error("fetched.page.error", err)
-			resultsChan <- CFAuditEventResult{Err: err}
+			select {
+			case resultsChan <- CFAuditEventResult{Err: err}:
+			case <-ctx.Done():
+			}
 			return
 		}
 		logger.Info("fetched.page.ok", lager.Data{"event_count": len(events)})
-		resultsChan <- CFAuditEventResult{Events: events}
 
-		time.Sleep(cfg.PaginationWaitTime)
+		select {
+		case resultsChan <- CFAuditEventResult{Events: events}:
+		case <-ctx.Done():
+			logger.Info("cancelled")
+			return
+		}
+
+		select {
+		case <-time.After(cfg.PaginationWaitTime):
+		case <-ctx.Done():
+			logger.Info("cancelled")
+			return
+		}
 	}
 }
 
 func getPage(cfClient cfclient.CloudFoundryClient, url string) (string, []cfclient.Event, error) {
 	resp, err := cfClient.DoRequest(cfClient.NewRequest("GET", url))
 	if err != nil {
-		return "", nil, fmt.Errorf("error requesting events: %s", err)
+		return "", nil, fmt.Errorf("error requesting events: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -70,7 +87,7 @@ func getPage(cfClient cfclient.CloudFoundryClient, url string) (string, []cfclie
 
 	var eventResp cfclient.EventsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&eventResp); err != nil {
-		return "", nil, fmt.Errorf("error unmarshaling events: %s", err)
+		return "", nil, fmt.Errorf("error unmarshaling events: %w", err)
 	}
 
 	events := make([]cfclient.Event, len(eventResp.Resources))
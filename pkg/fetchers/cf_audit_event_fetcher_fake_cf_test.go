@@ -0,0 +1,238 @@
+package fetchers_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("CFAuditEvents Fetcher against a fake Cloud Controller", func() {
+	const (
+		numberOfPages = 10
+		eventsPerPage = 100
+	)
+
+	var (
+		fakeCF          *h.FakeCF
+		cfg             *fetchers.FetcherConfig
+		resultsChan     chan fetchers.CFAuditEventResult
+		eventPages      [][]cfclient.Event
+		pullEventsSince = time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		fakeCF = h.NewFakeCF("paas-auditor", "some-secret")
+
+		cfClient, err := fakeCF.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		cfg = &fetchers.FetcherConfig{
+			CFClient:           cfClient,
+			Logger:             logger,
+			PaginationWaitTime: 10 * time.Millisecond,
+		}
+
+		resultsChan = make(chan fetchers.CFAuditEventResult, numberOfPages)
+
+		By("adding events from before and after the time they are fetched since")
+		generator := h.NewEventGenerator(42)
+		fakeCF.AddEvents(generator.Generate(10, pullEventsSince.Add(-time.Hour), time.Second)...)
+		events := generator.Generate(numberOfPages*eventsPerPage, pullEventsSince.Add(time.Second), time.Second)
+		fakeCF.AddEvents(events...)
+		eventPages = make([][]cfclient.Event, numberOfPages)
+		for page := range eventPages {
+			eventPages[page] = events[page*eventsPerPage : (page+1)*eventsPerPage]
+		}
+	})
+
+	AfterEach(func() {
+		fakeCF.Close()
+	})
+
+	Describe("FetchCFAuditEvents", func() {
+		const path = "/v2/events"
+
+		It("appears to work", func() {
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for page := 1; page <= numberOfPages; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					Equal(fetchers.CFAuditEventResult{Events: eventPages[page-1]}),
+				))
+
+				Expect(fakeCF.Requests(path)).To(Equal(page))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(func() int { return fakeCF.Requests(path) }).Should(Equal(numberOfPages))
+		})
+
+		It("returns an error and closes the chan when there is an error", func() {
+			By("failing the third request")
+			fakeCF.InjectFaults(h.FaultNone, h.FaultNone, h.FaultConnectionDropped)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for p := 0; p < 2; p++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					Equal(fetchers.CFAuditEventResult{Events: eventPages[p]}),
+				))
+			}
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("error requesting events")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(func() int { return fakeCF.Requests(path) }).Should(Equal(3))
+		})
+
+		It("returns an error and closes the chan when there is an non-200 response", func() {
+			By("failing the third request")
+			fakeCF.InjectFaults(h.FaultNone, h.FaultNone, h.FaultUnexpectedStatus)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for p := 0; p < 2; p++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					Equal(fetchers.CFAuditEventResult{Events: eventPages[p]}),
+				))
+			}
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("with status code 204")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(func() int { return fakeCF.Requests(path) }).Should(Equal(3))
+		})
+
+		It("stops fetching and closes the chan when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			unbufferedChan := make(chan fetchers.CFAuditEventResult)
+
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(ctx, cfg, pullEventsSince, unbufferedChan)
+			}()
+
+			Eventually(unbufferedChan, "100ms", "1ms").Should(Receive())
+			cancel()
+
+			Eventually(unbufferedChan).Should(BeClosed())
+			Expect(fakeCF.Requests(path)).To(BeNumerically("<", numberOfPages))
+		})
+	})
+
+	Describe("FetchCFAuditEventsV3", func() {
+		const path = "/v3/audit_events"
+
+		BeforeEach(func() {
+			for _, events := range eventPages {
+				for i := range events {
+					// The v3 API does not expose actor_username
+					events[i].ActorUsername = ""
+				}
+			}
+		})
+
+		It("appears to work", func() {
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for page := 1; page <= numberOfPages; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					Equal(fetchers.CFAuditEventResult{Events: eventPages[page-1]}),
+				))
+
+				Expect(fakeCF.Requests(path)).To(Equal(page))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(func() int { return fakeCF.Requests(path) }).Should(Equal(numberOfPages))
+		})
+
+		It("leaves the space and organization empty when they are null", func() {
+			event := cfclient.Event{
+				GUID:      "a595fe2f-01ff-4965-a50c-290258ab8582",
+				CreatedAt: "2030-10-04T12:40:44Z",
+				Type:      "audit.user_provided_service_instance.create",
+				Actor:     "actor-guid",
+				ActorType: "user",
+				ActorName: "admin",
+				Actee:     "target-guid",
+				ActeeType: "user",
+				ActeeName: "someone",
+				Metadata:  map[string]interface{}{},
+			}
+			fakeCF.AddEvents(event)
+
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), resultsChan)
+			}()
+
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				Equal(fetchers.CFAuditEventResult{Events: []cfclient.Event{event}}),
+			))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("returns an error and closes the chan when there is an non-200 response", func() {
+			By("failing the second request")
+			fakeCF.InjectFaults(h.FaultNone, h.FaultUnexpectedStatus)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				Equal(fetchers.CFAuditEventResult{Events: eventPages[0]}),
+			))
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("with status code 204")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(func() int { return fakeCF.Requests(path) }).Should(Equal(2))
+		})
+	})
+})
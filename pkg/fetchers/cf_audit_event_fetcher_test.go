@@ -1,6 +1,7 @@
 package fetchers_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/satori/go.uuid"
 	"math/rand"
@@ -104,7 +105,7 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
 			}()
 
 			By("expecting results via the channel")
@@ -141,7 +142,7 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
 			}()
 
 			By("expecting results via the channel")
@@ -178,7 +179,7 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			By("fetching events")
 			go func() {
 				defer GinkgoRecover()
-				fetchers.FetchCFAuditEvents(cfg, pullEventsSince, resultsChan)
+				fetchers.FetchCFAuditEvents(context.Background(), cfg, pullEventsSince, resultsChan)
 			}()
 
 			By("expecting results via the channel")
@@ -196,6 +197,184 @@ var _ = Describe("CFAuditEvents Fetcher", func() {
 			Eventually(resultsChan).Should(BeClosed())
 			Eventually(httpmock.GetTotalCallCount).Should(Equal(3))
 		})
+
+		It("stops fetching and closes the chan when the context is cancelled", func() {
+			expectedQ := "timestamp>2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			for page := 1; page <= numberOfPages; page++ {
+				mockEventPageResponse(page, numberOfPages, page != numberOfPages, expectedQ, eventPages[page-1])
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			unbufferedChan := make(chan fetchers.CFAuditEventResult)
+
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEvents(ctx, cfg, pullEventsSince, unbufferedChan)
+			}()
+
+			Eventually(unbufferedChan, "100ms", "1ms").Should(Receive())
+			cancel()
+
+			Eventually(unbufferedChan).Should(BeClosed())
+			Expect(httpmock.GetTotalCallCount()).To(BeNumerically("<", numberOfPages))
+		})
+	})
+
+	Describe("FetchCFAuditEventsV3", func() {
+		const (
+			numberOfPages = 10
+		)
+
+		var (
+			resultsChan chan fetchers.CFAuditEventResult
+			eventPages  [][]cfclient.Event
+		)
+
+		BeforeEach(func() {
+			resultsChan = make(chan fetchers.CFAuditEventResult, numberOfPages)
+			eventPages = randomEventPages(numberOfPages, 5)
+			for _, events := range eventPages {
+				for i := range events {
+					// The v3 API does not expose actor_username
+					events[i].ActorUsername = ""
+				}
+			}
+		})
+
+		It("appears to work", func() {
+			expectedSince := "2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			for page := 1; page <= numberOfPages; page++ {
+				thereAreMorePages := page != numberOfPages
+
+				mockV3EventPageResponse(
+					page, thereAreMorePages,
+					expectedSince,
+					eventPages[page-1],
+				)
+			}
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			for page := 1; page <= numberOfPages; page++ {
+				Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+					Equal(fetchers.CFAuditEventResult{Events: eventPages[page-1]}),
+				))
+
+				Expect(httpmock.GetTotalCallCount()).To(Equal(page))
+			}
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(httpmock.GetTotalCallCount).Should(Equal(numberOfPages))
+		})
+
+		It("leaves the space and organization empty when they are null", func() {
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			httpmock.RegisterResponder(
+				"GET", fmt.Sprintf("%s/v3/audit_events", cfAPIURL),
+				httpmock.NewStringResponder(200, `{
+					"pagination": {"total_results": 1, "total_pages": 1, "next": null},
+					"resources": [{
+						"guid": "a595fe2f-01ff-4965-a50c-290258ab8582",
+						"created_at": "2019-10-04T12:40:44Z",
+						"type": "audit.user_provided_service_instance.create",
+						"actor": {"guid": "actor-guid", "type": "user", "name": "admin"},
+						"target": {"guid": "target-guid", "type": "user", "name": "someone"},
+						"data": {},
+						"space": null,
+						"organization": null
+					}]
+				}`),
+			)
+
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				Equal(fetchers.CFAuditEventResult{Events: []cfclient.Event{{
+					GUID:      "a595fe2f-01ff-4965-a50c-290258ab8582",
+					CreatedAt: "2019-10-04T12:40:44Z",
+					Type:      "audit.user_provided_service_instance.create",
+					Actor:     "actor-guid",
+					ActorType: "user",
+					ActorName: "admin",
+					Actee:     "target-guid",
+					ActeeType: "user",
+					ActeeName: "someone",
+					Metadata:  map[string]interface{}{},
+				}}}),
+			))
+			Eventually(resultsChan).Should(BeClosed())
+		})
+
+		It("returns an error and closes the chan when there is an non-200 response", func() {
+			expectedSince := "2019-10-04T12:40:43Z"
+			pullEventsSince := time.Date(2019, 10, 4, 12, 40, 43, 0, time.UTC)
+
+			By("registering mocks")
+			mockV3EventPageResponse(1, true, expectedSince, eventPages[0])
+			// The next request will fail
+			httpmock.RegisterResponder(
+				"GET", fmt.Sprintf(`=~^%s.*\z`, cfAPIURL),
+				httpmock.NewJsonResponderOrPanic(201, `{"error": "sadpanda"}`),
+			)
+
+			By("fetching events")
+			go func() {
+				defer GinkgoRecover()
+				fetchers.FetchCFAuditEventsV3(context.Background(), cfg, pullEventsSince, resultsChan)
+			}()
+
+			By("expecting results via the channel")
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(
+				Equal(fetchers.CFAuditEventResult{Events: eventPages[0]}),
+			))
+			Eventually(resultsChan, "100ms", "1ms").Should(Receive(WithTransform(
+				func(res fetchers.CFAuditEventResult) error { return res.Err },
+				MatchError(ContainSubstring("with status code 201")),
+			)))
+
+			By("checking we are finished")
+			Eventually(resultsChan).Should(BeClosed())
+			Eventually(httpmock.GetTotalCallCount).Should(Equal(2))
+		})
+	})
+
+	Describe("IsRetryable", func() {
+		It("retries network errors, 5xx and 429 responses", func() {
+			Expect(fetchers.IsRetryable(fmt.Errorf("error requesting events: %w", &url.Error{
+				Op: "Get", URL: cfAPIURL, Err: fmt.Errorf("connection refused"),
+			}))).To(BeTrue())
+			Expect(fetchers.IsRetryable(cfclient.CloudFoundryHTTPError{StatusCode: 502})).To(BeTrue())
+			Expect(fetchers.IsRetryable(cfclient.CloudFoundryHTTPError{StatusCode: 429})).To(BeTrue())
+			Expect(fetchers.IsRetryable(cfclient.CloudFoundryError{ErrorCode: "CF-RateLimitExceeded"})).To(BeTrue())
+		})
+
+		It("does not retry other errors", func() {
+			Expect(fetchers.IsRetryable(cfclient.CloudFoundryHTTPError{StatusCode: 401})).To(BeFalse())
+			Expect(fetchers.IsRetryable(cfclient.CloudFoundryError{ErrorCode: "CF-NotAuthorized"})).To(BeFalse())
+			Expect(fetchers.IsRetryable(fmt.Errorf("request failed with status code 201"))).To(BeFalse())
+		})
+	})
+
+	Describe("NewCFAuditEventFetcher", func() {
+		It("rejects unknown API versions", func() {
+			_, err := fetchers.NewCFAuditEventFetcher(cfg, "v4")
+			Expect(err).To(MatchError(ContainSubstring("v4")))
+		})
 	})
 })
 
@@ -266,6 +445,70 @@ func wrapEventsForResponse(
 	}
 }
 
+func mockV3EventPageResponse(
+	page int, addNextURL bool,
+	expectedSince string,
+	events []cfclient.Event,
+) {
+	mockURL := fmt.Sprintf("%s/v3/audit_events", cfAPIURL)
+
+	expectedQuery := url.Values{
+		"created_ats[gt]": []string{expectedSince},
+		"order_by":        []string{"created_at"},
+		"per_page":        []string{"100"},
+	}
+
+	if page > 1 {
+		expectedQuery["page"] = []string{fmt.Sprintf("%d", page)}
+	}
+
+	var next interface{}
+	if addNextURL {
+		nextURLQuery := url.Values{
+			"created_ats[gt]": []string{expectedSince},
+			"order_by":        []string{"created_at"},
+			"per_page":        []string{"100"},
+			"page":            []string{fmt.Sprintf("%d", page+1)},
+		}
+		// The v3 API returns absolute links
+		next = map[string]interface{}{
+			"href": fmt.Sprintf("%s?%s", mockURL, nextURLQuery.Encode()),
+		}
+	}
+
+	resources := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		resources[i] = map[string]interface{}{
+			"guid":       event.GUID,
+			"created_at": event.CreatedAt,
+			"updated_at": event.CreatedAt,
+			"type":       event.Type,
+			"actor": map[string]interface{}{
+				"guid": event.Actor,
+				"type": event.ActorType,
+				"name": event.ActorName,
+			},
+			"target": map[string]interface{}{
+				"guid": event.Actee,
+				"type": event.ActeeType,
+				"name": event.ActeeName,
+			},
+			"data":         event.Metadata,
+			"space":        map[string]interface{}{"guid": event.SpaceGUID},
+			"organization": map[string]interface{}{"guid": event.OrganizationGUID},
+		}
+	}
+
+	resp := httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"pagination": map[string]interface{}{
+			"total_results": len(events),
+			"next":          next,
+		},
+		"resources": resources,
+	})
+	httpmock.RegisterResponderWithQuery("GET", mockURL, expectedQuery, resp)
+}
+
 func randomEvent() cfclient.Event {
 	eventCreatedAt := time.Unix(rand.Int63(), 0).Format("2006-01-02T15:04:05Z")
 	eventGUID := uuid.NewV4().String()
@@ -0,0 +1,66 @@
+package fetchers
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// CFAuditEventPager fetches the audit events created in a window of time one
+// page at a time, so that the caller can record which page it has got to and
+// carry on from there later
+type CFAuditEventPager interface {
+	// FirstPageURL returns the URL of the first page of the events created at
+	// or after start and before end
+	FirstPageURL(start time.Time, end time.Time) string
+
+	// FetchPage returns the URL of the page after pageURL, which is empty
+	// after the last page, and the events on pageURL
+	FetchPage(pageURL string) (string, []cfclient.Event, error)
+}
+
+type cfAuditEventPager struct {
+	cfClient     cfclient.CloudFoundryClient
+	firstPageURL func(start time.Time, end time.Time) string
+	getPage      pageGetter
+}
+
+// NewCFAuditEventPager returns a pager which reads audit events from the
+// given version of the Cloud Controller API
+func NewCFAuditEventPager(cfClient cfclient.CloudFoundryClient, apiVersion string) (CFAuditEventPager, error) {
+	switch apiVersion {
+	case CFAuditEventsAPIV2:
+		return &cfAuditEventPager{cfClient, windowPageURL, getPage}, nil
+	case CFAuditEventsAPIV3:
+		return &cfAuditEventPager{cfClient, windowPageURLV3, getPageV3}, nil
+	default:
+		return nil, fmt.Errorf("unknown CF audit events API version %q", apiVersion)
+	}
+}
+
+func (p *cfAuditEventPager) FirstPageURL(start time.Time, end time.Time) string {
+	return p.firstPageURL(start, end)
+}
+
+func (p *cfAuditEventPager) FetchPage(pageURL string) (string, []cfclient.Event, error) {
+	return p.getPage(p.cfClient, pageURL)
+}
+
+func windowPageURL(start time.Time, end time.Time) string {
+	q := url.Values{}
+	q.Add("q", fmt.Sprintf("timestamp>=%s", start.UTC().Format("2006-01-02T15:04:05Z")))
+	q.Add("q", fmt.Sprintf("timestamp<%s", end.UTC().Format("2006-01-02T15:04:05Z")))
+	q.Set("results-per-page", "100")
+	return fmt.Sprintf("/v2/events?%s", q.Encode())
+}
+
+func windowPageURLV3(start time.Time, end time.Time) string {
+	q := url.Values{}
+	q.Set("created_ats[gte]", start.UTC().Format("2006-01-02T15:04:05Z"))
+	q.Set("created_ats[lt]", end.UTC().Format("2006-01-02T15:04:05Z"))
+	q.Set("order_by", "created_at")
+	q.Set("per_page", "100")
+	return fmt.Sprintf("/v3/audit_events?%s", q.Encode())
+}
@@ -0,0 +1,125 @@
+package fetchers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+func FetchCFAuditEventsV3(ctx context.Context, cfg *FetcherConfig, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
+	fetchEvents(ctx, cfg, startPageURLV3(pullEventsSince), getPageV3, resultsChan)
+}
+
+type v3AuditEventsResponse struct {
+	Pagination v3Pagination   `json:"pagination"`
+	Resources  []v3AuditEvent `json:"resources"`
+}
+
+type v3Pagination struct {
+	TotalResults int            `json:"total_results"`
+	TotalPages   int            `json:"total_pages"`
+	Next         *cfclient.Link `json:"next"`
+}
+
+type v3AuditEvent struct {
+	GUID         string                 `json:"guid"`
+	CreatedAt    string                 `json:"created_at"`
+	Type         string                 `json:"type"`
+	Actor        v3AuditEventParty      `json:"actor"`
+	Target       v3AuditEventParty      `json:"target"`
+	Data         map[string]interface{} `json:"data"`
+	Space        *v3AuditEventParent    `json:"space"`
+	Organization *v3AuditEventParent    `json:"organization"`
+}
+
+type v3AuditEventParty struct {
+	GUID string `json:"guid"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type v3AuditEventParent struct {
+	GUID string `json:"guid"`
+}
+
+func startPageURLV3(pullEventsSince time.Time) string {
+	q := url.Values{}
+	q.Set("created_ats[gt]", pullEventsSince.Format("2006-01-02T15:04:05Z"))
+	q.Set("order_by", "created_at")
+	q.Set("per_page", "100")
+	return fmt.Sprintf("/v3/audit_events?%s", q.Encode())
+}
+
+func getPageV3(cfClient cfclient.CloudFoundryClient, url string) (string, []cfclient.Event, error) {
+	resp, err := cfClient.DoRequest(cfClient.NewRequest("GET", url))
+	if err != nil {
+		return "", nil, fmt.Errorf("error requesting events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// This only occurs when the status code is < 400
+		return "", nil, fmt.Errorf("request failed with status code %d", resp.StatusCode)
+	}
+
+	var eventResp v3AuditEventsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&eventResp); err != nil {
+		return "", nil, fmt.Errorf("error unmarshaling events: %w", err)
+	}
+
+	events := make([]cfclient.Event, len(eventResp.Resources))
+	for i, e := range eventResp.Resources {
+		events[i] = e.toEvent()
+	}
+
+	nextURL := ""
+	if eventResp.Pagination.Next != nil && eventResp.Pagination.Next.Href != "" {
+		nextURL, err = relativePageURL(eventResp.Pagination.Next.Href)
+		if err != nil {
+			return "", nil, fmt.Errorf("error parsing next page url: %s", err)
+		}
+	}
+
+	return nextURL, events, nil
+}
+
+// toEvent maps a v3 audit event onto the v2 event shape that we store. The v3
+// API does not expose actor_username, so it is left empty.
+func (e v3AuditEvent) toEvent() cfclient.Event {
+	event := cfclient.Event{
+		GUID:      e.GUID,
+		CreatedAt: e.CreatedAt,
+		Type:      e.Type,
+
+		Actor:     e.Actor.GUID,
+		ActorType: e.Actor.Type,
+		ActorName: e.Actor.Name,
+		Actee:     e.Target.GUID,
+		ActeeType: e.Target.Type,
+		ActeeName: e.Target.Name,
+
+		Metadata: e.Data,
+	}
+	if e.Organization != nil {
+		event.OrganizationGUID = e.Organization.GUID
+	}
+	if e.Space != nil {
+		event.SpaceGUID = e.Space.GUID
+	}
+	return event
+}
+
+// relativePageURL strips the scheme and host from the absolute links returned
+// by the v3 API, as the CF client prefixes the API address itself
+func relativePageURL(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return u.RequestURI(), nil
+}
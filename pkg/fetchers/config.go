@@ -1,14 +1,38 @@
 package fetchers
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 	cfclient "github.com/cloudfoundry-community/go-cfclient"
 )
 
+const (
+	CFAuditEventsAPIV2 = "v2"
+	CFAuditEventsAPIV3 = "v3"
+)
+
 type FetcherConfig struct {
 	CFClient           cfclient.CloudFoundryClient
 	Logger             lager.Logger
 	PaginationWaitTime time.Duration
 }
+
+// NewCFAuditEventFetcher returns a fetcher which reads audit events from the
+// given version of the Cloud Controller API
+func NewCFAuditEventFetcher(cfg *FetcherConfig, apiVersion string) (CFAuditEventFetcher, error) {
+	switch apiVersion {
+	case CFAuditEventsAPIV2:
+		return func(ctx context.Context, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
+			FetchCFAuditEvents(ctx, cfg, pullEventsSince, resultsChan)
+		}, nil
+	case CFAuditEventsAPIV3:
+		return func(ctx context.Context, pullEventsSince time.Time, resultsChan chan CFAuditEventResult) {
+			FetchCFAuditEventsV3(ctx, cfg, pullEventsSince, resultsChan)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown CF audit events API version %q", apiVersion)
+	}
+}
@@ -0,0 +1,51 @@
+package fetchers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+var retryableCFErrorCodes = map[string]bool{
+	"CF-RateLimitExceeded":  true,
+	"CF-ServiceUnavailable": true,
+	"UnknownError":          true,
+	"CF-UnknownError":       true,
+}
+
+// IsRetryable reports whether an error returned by a fetcher is likely to be
+// transient, such as a network failure or a 5xx or 429 from Cloud Controller
+func IsRetryable(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case net.Error:
+			return true
+		case *json.SyntaxError:
+			// Responses truncated by the router
+			return true
+		case cfclient.CloudFoundryHTTPError:
+			return e.StatusCode >= http.StatusInternalServerError ||
+				e.StatusCode == http.StatusTooManyRequests
+		case cfclient.CloudFoundryError:
+			return retryableCFErrorCodes[e.ErrorCode]
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true
+		}
+		err = unwrap(err)
+	}
+	return false
+}
+
+// unwrap handles both the standard library wrapping and the Cause method used
+// by github.com/pkg/errors, which the CF client uses for token errors
+func unwrap(err error) error {
+	if cause, ok := err.(interface{ Cause() error }); ok {
+		return cause.Cause()
+	}
+	return errors.Unwrap(err)
+}
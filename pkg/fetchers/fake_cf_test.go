@@ -0,0 +1,197 @@
+package fetchers_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Fetching from a fake Cloud Controller", func() {
+	var (
+		fakeCF    *h.FakeCF
+		generator *h.EventGenerator
+		cfg       *fetchers.FetcherConfig
+		since     = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		fakeCF = h.NewFakeCF("paas-auditor", "some-secret")
+		generator = h.NewEventGenerator(42)
+
+		cfClient, err := fakeCF.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+
+		logger := lager.NewLogger("fetcher-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+		cfg = &fetchers.FetcherConfig{
+			CFClient:           cfClient,
+			Logger:             logger,
+			PaginationWaitTime: time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		fakeCF.Close()
+	})
+
+	fetch := func(apiVersion string, since time.Time) ([]cfclient.Event, error) {
+		fetcher, err := fetchers.NewCFAuditEventFetcher(cfg, apiVersion)
+		Expect(err).NotTo(HaveOccurred())
+
+		resultsChan := make(chan fetchers.CFAuditEventResult)
+		go fetcher(context.Background(), since, resultsChan)
+
+		events := []cfclient.Event{}
+		for result := range resultsChan {
+			if result.Err != nil {
+				return events, result.Err
+			}
+			events = append(events, result.Events...)
+		}
+		return events, nil
+	}
+
+	for _, apiVersion := range []string{fetchers.CFAuditEventsAPIV2, fetchers.CFAuditEventsAPIV3} {
+		apiVersion := apiVersion
+		path := map[string]string{
+			fetchers.CFAuditEventsAPIV2: "/v2/events",
+			fetchers.CFAuditEventsAPIV3: "/v3/audit_events",
+		}[apiVersion]
+
+		expected := func(events []cfclient.Event) []cfclient.Event {
+			if apiVersion == fetchers.CFAuditEventsAPIV3 {
+				for i := range events {
+					// The v3 API does not expose actor_username
+					events[i].ActorUsername = ""
+				}
+			}
+			return events
+		}
+
+		Context("from the "+apiVersion+" API", func() {
+			It("fetches every page of events created since the given time, in order", func() {
+				before := generator.Generate(10, since.Add(-time.Hour), time.Second)
+				after := generator.Generate(250, since.Add(time.Second), 200*time.Millisecond)
+				fakeCF.AddEvents(before...)
+				fakeCF.AddEvents(after...)
+
+				events, err := fetch(apiVersion, since)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events).To(Equal(expected(after)))
+				Expect(fakeCF.Requests(path)).To(Equal(3))
+			})
+
+			It("fetches events which arrive over time", func() {
+				fakeCF.StartArrivals(generator, 5*time.Millisecond, 2)
+				Eventually(func() int { return len(fakeCF.Events()) }).Should(BeNumerically(">=", 6))
+
+				events, err := fetch(apiVersion, time.Now().Add(-time.Hour))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(events)).To(BeNumerically(">=", 6))
+			})
+
+			It("gets a new token when its token expires", func() {
+				fakeCF.TokenTTL = time.Second
+				fakeCF.AddEvents(generator.Generate(250, since.Add(time.Second), time.Second)...)
+
+				events, err := fetch(apiVersion, since)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events).To(HaveLen(250))
+				Expect(fakeCF.Requests("/oauth/token")).To(BeNumerically(">", 1))
+			})
+
+			It("returns retryable errors for rate limiting, server errors, truncated responses and dropped connections", func() {
+				fakeCF.AddEvents(generator.Generate(250, since.Add(time.Second), time.Second)...)
+
+				for _, fault := range []h.Fault{h.FaultRateLimited, h.FaultServerError, h.FaultMalformedJSON, h.FaultConnectionDropped} {
+					By("injecting " + string(fault))
+					fakeCF.InjectFaults(fault)
+					_, err := fetch(apiVersion, since)
+					Expect(err).To(HaveOccurred())
+					Expect(fetchers.IsRetryable(err)).To(BeTrue(), err.Error())
+				}
+
+				events, err := fetch(apiVersion, since)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events).To(HaveLen(250))
+			})
+
+			It("returns an error when its token is rejected", func() {
+				fakeCF.AddEvents(generator.Generate(10, since.Add(time.Second), time.Second)...)
+				fakeCF.InjectFaults(h.FaultTokenExpired)
+
+				_, err := fetch(apiVersion, since)
+				Expect(err).To(MatchError(ContainSubstring("CF-InvalidAuthToken")))
+			})
+
+			It("fails some requests at the fault rate", func() {
+				fakeCF.AddEvents(generator.Generate(50, since.Add(time.Second), time.Second)...)
+				fakeCF.FaultRate = 1
+				fakeCF.RandomFaults = []h.Fault{h.FaultServerError}
+
+				_, err := fetch(apiVersion, since)
+				Expect(err).To(HaveOccurred())
+				Expect(fetchers.IsRetryable(err)).To(BeTrue())
+			})
+
+			It("pages through the events created in a window, and carries on from a page URL", func() {
+				before := generator.Generate(10, since.Add(-time.Hour), time.Second)
+				during := generator.Generate(250, since, time.Second)
+				after := generator.Generate(10, since.Add(time.Hour), time.Second)
+				fakeCF.AddEvents(before...)
+				fakeCF.AddEvents(during...)
+				fakeCF.AddEvents(after...)
+
+				pager, err := fetchers.NewCFAuditEventPager(cfg.CFClient, apiVersion)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("fetching the first page")
+				nextPageURL, events, err := pager.FetchPage(pager.FirstPageURL(since, since.Add(time.Hour)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events).To(Equal(expected(during[:100])))
+				Expect(nextPageURL).To(HavePrefix(path + "?"))
+
+				By("carrying on from the URL of the next page")
+				pages := 1
+				for nextPageURL != "" {
+					var page []cfclient.Event
+					nextPageURL, page, err = pager.FetchPage(nextPageURL)
+					Expect(err).NotTo(HaveOccurred())
+					events = append(events, page...)
+					pages++
+				}
+				Expect(events).To(Equal(expected(during)))
+				Expect(pages).To(Equal(3))
+			})
+		})
+	}
+
+	It("generates the same events from the same seed", func() {
+		Expect(h.NewEventGenerator(7).Generate(20, since, time.Second)).To(
+			Equal(h.NewEventGenerator(7).Generate(20, since, time.Second)))
+		Expect(h.NewEventGenerator(7).Generate(20, since, time.Second)).NotTo(
+			Equal(h.NewEventGenerator(8).Generate(20, since, time.Second)))
+	})
+
+	It("only issues tokens to its client", func() {
+		cfClient, err := cfclient.NewClient(&cfclient.Config{
+			ApiAddress:   fakeCF.URL,
+			ClientID:     fakeCF.ClientID,
+			ClientSecret: "another-secret",
+			HttpClient:   &http.Client{},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cfg.CFClient = cfClient
+
+		_, err = fetch(fetchers.CFAuditEventsAPIV2, since)
+		Expect(err).To(MatchError(ContainSubstring("Bad credentials")))
+	})
+})
@@ -0,0 +1,197 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/fetchers"
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+)
+
+type FakeCFAuditEventPager struct {
+	FetchPageStub        func(string) (string, []cfclient.Event, error)
+	fetchPageMutex       sync.RWMutex
+	fetchPageArgsForCall []struct {
+		arg1 string
+	}
+	fetchPageReturns struct {
+		result1 string
+		result2 []cfclient.Event
+		result3 error
+	}
+	fetchPageReturnsOnCall map[int]struct {
+		result1 string
+		result2 []cfclient.Event
+		result3 error
+	}
+	FirstPageURLStub        func(time.Time, time.Time) string
+	firstPageURLMutex       sync.RWMutex
+	firstPageURLArgsForCall []struct {
+		arg1 time.Time
+		arg2 time.Time
+	}
+	firstPageURLReturns struct {
+		result1 string
+	}
+	firstPageURLReturnsOnCall map[int]struct {
+		result1 string
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCFAuditEventPager) FetchPage(arg1 string) (string, []cfclient.Event, error) {
+	fake.fetchPageMutex.Lock()
+	ret, specificReturn := fake.fetchPageReturnsOnCall[len(fake.fetchPageArgsForCall)]
+	fake.fetchPageArgsForCall = append(fake.fetchPageArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("FetchPage", []interface{}{arg1})
+	fake.fetchPageMutex.Unlock()
+	if fake.FetchPageStub != nil {
+		return fake.FetchPageStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	fakeReturns := fake.fetchPageReturns
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeCFAuditEventPager) FetchPageCallCount() int {
+	fake.fetchPageMutex.RLock()
+	defer fake.fetchPageMutex.RUnlock()
+	return len(fake.fetchPageArgsForCall)
+}
+
+func (fake *FakeCFAuditEventPager) FetchPageCalls(stub func(string) (string, []cfclient.Event, error)) {
+	fake.fetchPageMutex.Lock()
+	defer fake.fetchPageMutex.Unlock()
+	fake.FetchPageStub = stub
+}
+
+func (fake *FakeCFAuditEventPager) FetchPageArgsForCall(i int) string {
+	fake.fetchPageMutex.RLock()
+	defer fake.fetchPageMutex.RUnlock()
+	argsForCall := fake.fetchPageArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCFAuditEventPager) FetchPageReturns(result1 string, result2 []cfclient.Event, result3 error) {
+	fake.fetchPageMutex.Lock()
+	defer fake.fetchPageMutex.Unlock()
+	fake.FetchPageStub = nil
+	fake.fetchPageReturns = struct {
+		result1 string
+		result2 []cfclient.Event
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeCFAuditEventPager) FetchPageReturnsOnCall(i int, result1 string, result2 []cfclient.Event, result3 error) {
+	fake.fetchPageMutex.Lock()
+	defer fake.fetchPageMutex.Unlock()
+	fake.FetchPageStub = nil
+	if fake.fetchPageReturnsOnCall == nil {
+		fake.fetchPageReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 []cfclient.Event
+			result3 error
+		})
+	}
+	fake.fetchPageReturnsOnCall[i] = struct {
+		result1 string
+		result2 []cfclient.Event
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURL(arg1 time.Time, arg2 time.Time) string {
+	fake.firstPageURLMutex.Lock()
+	ret, specificReturn := fake.firstPageURLReturnsOnCall[len(fake.firstPageURLArgsForCall)]
+	fake.firstPageURLArgsForCall = append(fake.firstPageURLArgsForCall, struct {
+		arg1 time.Time
+		arg2 time.Time
+	}{arg1, arg2})
+	fake.recordInvocation("FirstPageURL", []interface{}{arg1, arg2})
+	fake.firstPageURLMutex.Unlock()
+	if fake.FirstPageURLStub != nil {
+		return fake.FirstPageURLStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.firstPageURLReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURLCallCount() int {
+	fake.firstPageURLMutex.RLock()
+	defer fake.firstPageURLMutex.RUnlock()
+	return len(fake.firstPageURLArgsForCall)
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURLCalls(stub func(time.Time, time.Time) string) {
+	fake.firstPageURLMutex.Lock()
+	defer fake.firstPageURLMutex.Unlock()
+	fake.FirstPageURLStub = stub
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURLArgsForCall(i int) (time.Time, time.Time) {
+	fake.firstPageURLMutex.RLock()
+	defer fake.firstPageURLMutex.RUnlock()
+	argsForCall := fake.firstPageURLArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURLReturns(result1 string) {
+	fake.firstPageURLMutex.Lock()
+	defer fake.firstPageURLMutex.Unlock()
+	fake.FirstPageURLStub = nil
+	fake.firstPageURLReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeCFAuditEventPager) FirstPageURLReturnsOnCall(i int, result1 string) {
+	fake.firstPageURLMutex.Lock()
+	defer fake.firstPageURLMutex.Unlock()
+	fake.FirstPageURLStub = nil
+	if fake.firstPageURLReturnsOnCall == nil {
+		fake.firstPageURLReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.firstPageURLReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeCFAuditEventPager) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.fetchPageMutex.RLock()
+	defer fake.fetchPageMutex.RUnlock()
+	fake.firstPageURLMutex.RLock()
+	defer fake.firstPageURLMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCFAuditEventPager) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ fetchers.CFAuditEventPager = new(FakeCFAuditEventPager)
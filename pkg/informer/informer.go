@@ -8,19 +8,22 @@ import (
 	"github.com/alphagov/paas-auditor/pkg/db"
 )
 
+// Informer reports stats about the events stored from each foundation
 type Informer struct {
-	schedule time.Duration
-	logger   lager.Logger
-	eventDB  db.EventDB
+	schedule    time.Duration
+	foundations []string
+	logger      lager.Logger
+	eventDB     db.EventDB
 }
 
 func NewInformer(
 	schedule time.Duration,
+	foundations []string,
 	logger lager.Logger,
 	eventDB db.EventDB,
 ) *Informer {
 	logger = logger.Session("informer")
-	return &Informer{schedule, logger, eventDB}
+	return &Informer{schedule, foundations, logger, eventDB}
 }
 
 func (i *Informer) Run(ctx context.Context) error {
@@ -35,20 +38,33 @@ func (i *Informer) Run(ctx context.Context) error {
 			lsession.Info("done")
 			return nil
 		case <-time.After(i.schedule):
-			count, err := i.eventDB.GetCFEventCount()
-			if err != nil {
-				lsession.Error("err-event-db-get-cf-event-count", err)
-			}
-			InformerCFAuditEventsTotal.Set(float64(count)) // this will be 0 if err
-
-			timestamp, err := i.eventDB.GetLatestCFEventTime()
-			if err != nil {
-				lsession.Error("err-event-db-get-latest-cf-event-time", err)
-				InformerLatestCFAuditEventTimestamp.Set(float64(0))
-			} else {
-				InformerLatestCFAuditEventTimestamp.Set(float64(timestamp.Unix()))
-			}
+			i.inform(lsession)
+		}
+	}
+}
+
+func (i *Informer) inform(lsession lager.Logger) {
+	counts, err := i.eventDB.GetCFEventCounts()
+	if err != nil {
+		lsession.Error("err-event-db-get-cf-event-counts", err)
+	}
+	// Events may be stored from foundations which are no longer collected
+	// from, eg when they were restored from an archive
+	for foundation, count := range counts {
+		InformerCFAuditEventsTotal.WithLabelValues(foundation).Set(float64(count))
+	}
+
+	for _, foundation := range i.foundations {
+		if _, ok := counts[foundation]; !ok {
+			InformerCFAuditEventsTotal.WithLabelValues(foundation).Set(0)
+		}
 
+		timestamp, err := i.eventDB.GetLatestCFEventTime(foundation)
+		if err != nil {
+			lsession.Error("err-event-db-get-latest-cf-event-time", err, lager.Data{"foundation": foundation})
+			InformerLatestCFAuditEventTimestamp.WithLabelValues(foundation).Set(float64(0))
+		} else {
+			InformerLatestCFAuditEventTimestamp.WithLabelValues(foundation).Set(float64(timestamp.Unix()))
 		}
 	}
 }
@@ -30,18 +30,19 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 
 		By("checking the value of the metrics to test against them later")
 		informerCFAuditEventsTotal = h.CurrentMetricValue(
-			informer.InformerCFAuditEventsTotal,
+			informer.InformerCFAuditEventsTotal.WithLabelValues("foundation-a"),
 		)
 		informerLatestCFAuditEventTimestamp = h.CurrentMetricValue(
-			informer.InformerLatestCFAuditEventTimestamp,
+			informer.InformerLatestCFAuditEventTimestamp.WithLabelValues("foundation-a"),
 		)
 
 		eventDB = &dbfakes.FakeEventDB{}
-		eventDB.GetCFEventCountReturns(int64(100), nil)
+		eventDB.GetCFEventCountsReturns(map[string]int64{"foundation-a": 100, "retired-foundation": 5}, nil)
 		eventDB.GetLatestCFEventTimeReturns(time.Now(), nil)
 
 		i = informer.NewInformer(
 			10*time.Millisecond,
+			[]string{"foundation-a", "foundation-b"},
 			logger,
 			eventDB,
 		)
@@ -68,17 +69,28 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		By("waiting for metrics")
 		Eventually(
 			func() float64 {
-				return h.CurrentMetricValue(informer.InformerCFAuditEventsTotal)
+				return h.CurrentMetricValue(informer.InformerCFAuditEventsTotal.WithLabelValues("foundation-a"))
 			}, "100ms", "1ms",
 		).Should(BeNumerically("==", float64(100)))
 
-		By("checking the metrics")
-		Expect(informer.InformerCFAuditEventsTotal).To(
+		By("checking the metrics of each foundation")
+		Expect(informer.InformerCFAuditEventsTotal.WithLabelValues("foundation-a")).To(
 			h.MetricIncrementedBy(informerCFAuditEventsTotal, "==", 100),
 		)
-		Expect(informer.InformerLatestCFAuditEventTimestamp).To(
+		Expect(informer.InformerLatestCFAuditEventTimestamp.WithLabelValues("foundation-a")).To(
 			h.MetricIncrementedBy(informerLatestCFAuditEventTimestamp, ">", 0),
 		)
+		Expect(h.CurrentMetricValue(informer.InformerCFAuditEventsTotal.WithLabelValues("foundation-b"))).To(
+			BeNumerically("==", 0),
+		)
+		Expect(h.CurrentMetricValue(informer.InformerCFAuditEventsTotal.WithLabelValues("retired-foundation"))).To(
+			BeNumerically("==", 5),
+		)
+		Eventually(eventDB.GetLatestCFEventTimeCallCount, "100ms", "1ms").Should(BeNumerically(">=", 2))
+		Expect([]string{
+			eventDB.GetLatestCFEventTimeArgsForCall(0),
+			eventDB.GetLatestCFEventTimeArgsForCall(1),
+		}).To(Equal([]string{"foundation-a", "foundation-b"}))
 
 		By("cleaning up")
 		cancelInf()
@@ -5,15 +5,15 @@ import (
 )
 
 var (
-	InformerCFAuditEventsTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+	InformerCFAuditEventsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "informer_cf_audit_events_total",
-		Help: "Number of CF audit events in the database",
-	})
+		Help: "Estimated number of CF audit events in the database from each foundation",
+	}, []string{"foundation"})
 
-	InformerLatestCFAuditEventTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+	InformerLatestCFAuditEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "informer_latest_cf_audit_event_timestamp",
-		Help: "Unix epoch seconds of most recent event in the database",
-	})
+		Help: "Unix epoch seconds of most recent event in the database from each foundation",
+	}, []string{"foundation"})
 )
 
 func initMetrics() {
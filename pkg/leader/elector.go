@@ -0,0 +1,137 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Elector makes sure that only one instance at a time runs the loop for a
+// role. The leader holds a lease row in the database, which it renews every
+// third of the lease TTL. Standby instances try to take the lease just as
+// often, so they take over within 4/3 of the TTL after the leader stops
+// renewing it.
+//
+// A leader steps down once its lease has expired, but it may not notice
+// straight away, for example if it is paused. The loop's writes should go
+// through a store fenced by the same lease, from db.EventStore.WithLease, so
+// that they fail with db.ErrLeaseLost instead of overlapping with those of
+// the new leader. A loop which returns db.ErrLeaseLost has lost the lease
+// like any other, so the instance goes back to being a standby.
+type Elector struct {
+	lease   *db.Lease
+	ttl     time.Duration
+	logger  lager.Logger
+	eventDB db.EventDB
+}
+
+func NewElector(
+	lease *db.Lease,
+	ttl time.Duration,
+	logger lager.Logger,
+	eventDB db.EventDB,
+) *Elector {
+	logger = logger.Session("leader-elector", lager.Data{"role": lease.Role, "holder": lease.Holder})
+	return &Elector{lease, ttl, logger, eventDB}
+}
+
+// Run calls fn whenever this instance holds the lease. The context passed to
+// fn is cancelled if the lease is lost. Run returns when ctx is done, or with
+// the error if fn returns one other than db.ErrLeaseLost.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	lsession := e.logger.Session("run")
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	isLeader := LeaderElectorIsLeader.WithLabelValues(e.lease.Role)
+	isLeader.Set(0)
+
+	for {
+		acquired, err := e.eventDB.AcquireLeaderLease(e.lease, e.ttl)
+		if err != nil {
+			lsession.Error("err-acquire-leader-lease", err)
+			LeaderElectorErrorsTotal.WithLabelValues(e.lease.Role).Inc()
+		}
+
+		if acquired {
+			lsession.Info("acquired-leader-lease", lager.Data{"generation": e.lease.Generation()})
+			isLeader.Set(1)
+			err := e.lead(ctx, lsession, fn)
+			isLeader.Set(0)
+
+			if ctx.Err() != nil || err != nil {
+				if err := e.eventDB.ReleaseLeaderLease(e.lease); err != nil {
+					lsession.Error("err-release-leader-lease", err)
+				}
+				return err
+			}
+			lsession.Info("lost-leader-lease")
+		}
+
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(e.ttl / 3):
+		}
+	}
+}
+
+// lead runs fn until it returns, or until the lease cannot be renewed before
+// it expires, in which case fn is cancelled and lead returns nil. It also
+// returns nil if fn fails because a fenced write found the lease lost.
+func (e *Elector) lead(ctx context.Context, lsession lager.Logger, fn func(ctx context.Context) error) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(leaderCtx)
+	}()
+
+	stepDown := func() error {
+		cancel()
+		<-done
+		return nil
+	}
+
+	expiry := time.NewTimer(e.ttl)
+	defer expiry.Stop()
+	renew := time.NewTicker(e.ttl / 3)
+	defer renew.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if errors.Is(err, db.ErrLeaseLost) {
+				lsession.Info("leader-lease-lost-by-loop", lager.Data{"error": err.Error()})
+				return nil
+			}
+			return err
+		case <-expiry.C:
+			lsession.Info("leader-lease-expired")
+			return stepDown()
+		case <-renew.C:
+			renewStart := time.Now()
+			renewed, err := e.eventDB.AcquireLeaderLease(e.lease, e.ttl)
+			if err != nil {
+				lsession.Error("err-renew-leader-lease", err)
+				LeaderElectorErrorsTotal.WithLabelValues(e.lease.Role).Inc()
+				continue
+			}
+			if !renewed {
+				return stepDown()
+			}
+			if !expiry.Stop() {
+				select {
+				case <-expiry.C:
+				default:
+				}
+			}
+			expiry.Reset(e.ttl - time.Since(renewStart))
+		}
+	}
+}
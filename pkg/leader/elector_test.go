@@ -0,0 +1,173 @@
+package leader_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/leader"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Elector Run", func() {
+	var (
+		logger  lager.Logger
+		eventDB *dbfakes.FakeEventDB
+		lease   *db.Lease
+		elector *leader.Elector
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("leader-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		lease = db.NewLease("test-role", "instance-0")
+		elector = leader.NewElector(lease, 30*time.Millisecond, logger, eventDB)
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	isLeader := func() float64 {
+		return h.CurrentMetricValue(leader.LeaderElectorIsLeader.WithLabelValues("test-role"))
+	}
+
+	It("runs the loop while it holds the lease and releases it when done", func() {
+		eventDB.AcquireLeaderLeaseReturns(true, nil)
+
+		running := make(chan struct{})
+		runErrors := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			runErrors <- elector.Run(ctx, func(ctx context.Context) error {
+				close(running)
+				<-ctx.Done()
+				return nil
+			})
+		}()
+
+		Eventually(running).Should(BeClosed())
+		Expect(isLeader()).To(BeNumerically("==", 1))
+
+		acquired, ttl := eventDB.AcquireLeaderLeaseArgsForCall(0)
+		Expect(acquired).To(BeIdenticalTo(lease))
+		Expect(ttl).To(Equal(30 * time.Millisecond))
+
+		By("renewing the lease")
+		Eventually(eventDB.AcquireLeaderLeaseCallCount, "100ms", "1ms").Should(BeNumerically(">=", 3))
+
+		cancel()
+		Eventually(runErrors).Should(Receive(BeNil()))
+		Expect(isLeader()).To(BeNumerically("==", 0))
+		Expect(eventDB.ReleaseLeaderLeaseCallCount()).To(Equal(1))
+		Expect(eventDB.ReleaseLeaderLeaseArgsForCall(0)).To(BeIdenticalTo(lease))
+	})
+
+	It("waits as a standby while another instance holds the lease", func() {
+		eventDB.AcquireLeaderLeaseReturns(false, nil)
+
+		called := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			elector.Run(ctx, func(ctx context.Context) error {
+				close(called)
+				return nil
+			})
+		}()
+
+		Eventually(eventDB.AcquireLeaderLeaseCallCount, "100ms", "1ms").Should(BeNumerically(">=", 3))
+		Expect(called).NotTo(BeClosed())
+		Expect(isLeader()).To(BeNumerically("==", 0))
+
+		By("taking over once the lease is free")
+		eventDB.AcquireLeaderLeaseReturns(true, nil)
+		Eventually(called, "100ms", "1ms").Should(BeClosed())
+	})
+
+	It("stops the loop when the lease is taken by another instance", func() {
+		eventDB.AcquireLeaderLeaseReturnsOnCall(0, true, nil)
+		eventDB.AcquireLeaderLeaseReturns(false, nil)
+
+		stopped := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			elector.Run(ctx, func(ctx context.Context) error {
+				<-ctx.Done()
+				close(stopped)
+				return nil
+			})
+		}()
+
+		Eventually(stopped, "100ms", "1ms").Should(BeClosed())
+		Eventually(isLeader).Should(BeNumerically("==", 0))
+		Expect(eventDB.ReleaseLeaderLeaseCallCount()).To(Equal(0))
+	})
+
+	It("stops the loop when the lease cannot be renewed before it expires", func() {
+		eventDB.AcquireLeaderLeaseReturnsOnCall(0, true, nil)
+		eventDB.AcquireLeaderLeaseReturns(false, fmt.Errorf("connection refused"))
+
+		stopped := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			elector.Run(ctx, func(ctx context.Context) error {
+				<-ctx.Done()
+				close(stopped)
+				return nil
+			})
+		}()
+
+		Eventually(stopped, "100ms", "1ms").Should(BeClosed())
+		Expect(eventDB.AcquireLeaderLeaseCallCount()).To(BeNumerically(">=", 3))
+	})
+
+	It("goes back to acquiring the lease when a write of the loop finds it lost", func() {
+		eventDB.AcquireLeaderLeaseReturns(true, nil)
+
+		calls := make(chan struct{}, 2)
+		runErrors := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			runErrors <- elector.Run(ctx, func(ctx context.Context) error {
+				calls <- struct{}{}
+				if len(calls) == 1 {
+					return fmt.Errorf("storing events: %w", db.ErrLeaseLost)
+				}
+				<-ctx.Done()
+				return nil
+			})
+		}()
+
+		Eventually(calls, "100ms", "1ms").Should(HaveLen(2))
+		Expect(runErrors).NotTo(Receive())
+		Expect(eventDB.ReleaseLeaderLeaseCallCount()).To(Equal(0))
+		Expect(isLeader()).To(BeNumerically("==", 1))
+
+		cancel()
+		Eventually(runErrors).Should(Receive(BeNil()))
+	})
+
+	It("returns the error from the loop and releases the lease", func() {
+		eventDB.AcquireLeaderLeaseReturns(true, nil)
+
+		err := elector.Run(ctx, func(ctx context.Context) error {
+			return fmt.Errorf("sadpanda")
+		})
+
+		Expect(err).To(MatchError("sadpanda"))
+		Expect(eventDB.ReleaseLeaderLeaseCallCount()).To(Equal(1))
+	})
+})
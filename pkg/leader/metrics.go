@@ -0,0 +1,22 @@
+package leader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	LeaderElectorIsLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "leader_elector_is_leader",
+		Help: "Whether this instance currently holds the leader lease for a role (1) or not (0)",
+	}, []string{"role"})
+
+	LeaderElectorErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "leader_elector_errors_total",
+		Help: "Number of errors encountered while acquiring or renewing the leader lease for a role",
+	}, []string{"role"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(LeaderElectorIsLeader)
+	prometheus.MustRegister(LeaderElectorErrorsTotal)
+}
@@ -0,0 +1,139 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultSMTPPort = 587
+
+type EmailConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username"`
+
+	// PasswordEnv names the environment variable holding the password for
+	// Username, so that the password is not part of the configuration
+	PasswordEnv string `json:"password_env"`
+
+	// Password is read from PasswordEnv when the configuration is loaded
+	Password string `json:"-"`
+}
+
+// EmailNotifier sends alerts as plain text email over SMTP. It uses STARTTLS
+// if the server offers it, and only authenticates over TLS or to localhost.
+type EmailNotifier struct {
+	host     string
+	port     int
+	from     string
+	to       []string
+	username string
+	password string
+	timeout  time.Duration
+}
+
+func NewEmailNotifier(cfg EmailConfig) *EmailNotifier {
+	port := cfg.Port
+	if port == 0 {
+		port = DefaultSMTPPort
+	}
+	return &EmailNotifier{
+		host:     cfg.Host,
+		port:     port,
+		from:     cfg.From,
+		to:       cfg.To,
+		username: cfg.Username,
+		password: cfg.Password,
+		timeout:  30 * time.Second,
+	}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, message Message) error {
+	dialer := net.Dialer{Timeout: n.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)))
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(n.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	body, err := n.encode(message)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (n *EmailNotifier) encode(message Message) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "%s: %d\r\n", AlertIDHeader, message.Alert.ID)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n")
+	fmt.Fprintf(&buf, "\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(message.Text)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
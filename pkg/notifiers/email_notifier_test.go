@@ -0,0 +1,86 @@
+package notifiers_test
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("EmailNotifier", func() {
+	var (
+		smtpServer *h.FakeSMTP
+		cfg        notifiers.EmailConfig
+		message    notifiers.Message
+	)
+
+	BeforeEach(func() {
+		smtpServer = h.NewFakeSMTP("auditor", "password")
+		cfg = notifiers.EmailConfig{
+			Host:     smtpServer.Host(),
+			Port:     smtpServer.Port(),
+			From:     "paas-auditor@example.com",
+			To:       []string{"security@example.com", "oncall@example.com"},
+			Username: "auditor",
+			Password: "password",
+		}
+		message = notifiers.Message{
+			Alert:   db.Alert{ID: 42, Rule: "org-manager-added"},
+			Subject: "paas-auditor dev: alert org-manager-added – someone",
+			Text:    "Alert rule org-manager-added was triggered.\n\nEvents:\n" + strings.Repeat("some-guid ", 20) + "\n",
+		}
+	})
+
+	AfterEach(func() {
+		smtpServer.Close()
+	})
+
+	It("sends the message to every recipient", func() {
+		notifier := notifiers.NewEmailNotifier(cfg)
+		Expect(notifier.Notify(context.Background(), message)).To(Succeed())
+
+		messages := smtpServer.Messages()
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].From).To(Equal("paas-auditor@example.com"))
+		Expect(messages[0].To).To(Equal([]string{"security@example.com", "oncall@example.com"}))
+
+		parsed, err := mail.ReadMessage(strings.NewReader(string(messages[0].Data)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Header.Get("From")).To(Equal("paas-auditor@example.com"))
+		Expect(parsed.Header.Get("To")).To(Equal("security@example.com, oncall@example.com"))
+		Expect(parsed.Header.Get(notifiers.AlertIDHeader)).To(Equal("42"))
+		Expect(parsed.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subject).To(Equal(message.Subject))
+
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(parsed.Body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.ReplaceAll(string(body), "\r\n", "\n")).To(Equal(message.Text))
+	})
+
+	It("fails when the credentials are wrong", func() {
+		cfg.Password = "wrong"
+		notifier := notifiers.NewEmailNotifier(cfg)
+		Expect(notifier.Notify(context.Background(), message)).To(MatchError(ContainSubstring("535")))
+		Expect(smtpServer.Messages()).To(BeEmpty())
+	})
+
+	It("fails when the server does not accept the message", func() {
+		smtpServer.FailNext(1)
+		notifier := notifiers.NewEmailNotifier(cfg)
+		Expect(notifier.Notify(context.Background(), message)).To(MatchError(ContainSubstring("451")))
+		Expect(notifier.Notify(context.Background(), message)).To(Succeed())
+		Expect(smtpServer.Messages()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,5 @@
+package notifiers
+
+func init() {
+	initMetrics()
+}
@@ -0,0 +1,22 @@
+package notifiers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	NotifierNotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "alert_notifier_notifications_total",
+		Help: "Number of alerts handled by a notification channel",
+	}, []string{"channel", "status"})
+
+	NotifierErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "alert_notifier_errors_total",
+		Help: "Number of errors encountered while delivering alerts to a notification channel",
+	}, []string{"channel"})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(NotifierNotificationsTotal)
+	prometheus.MustRegister(NotifierErrorsTotal)
+}
@@ -0,0 +1,183 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	WebhookNotifierType = "webhook"
+	SlackNotifierType   = "slack"
+	EmailNotifierType   = "email"
+
+	DefaultMaxRetries    = 3
+	DefaultRetryInterval = time.Minute
+	DefaultMaxAge        = 24 * time.Hour
+
+	// MaxRetryInterval is the longest a failed alert waits before it is
+	// tried again
+	MaxRetryInterval = time.Hour
+)
+
+// Notifier tells people about an alert over a channel. The Runner takes care
+// of finding alerts to deliver, rendering messages, retries, deduplication,
+// silences and recording deliveries, so a new channel only needs to say how
+// to send a message.
+type Notifier interface {
+	// Notify sends a message about an alert. It should only return once the
+	// channel has accepted the message.
+	Notify(ctx context.Context, message Message) error
+}
+
+// Config is the format of the file notification channels are loaded from
+type Config struct {
+	Channels []ChannelConfig `json:"channels"`
+	Silences []Silence       `json:"silences"`
+}
+
+// ChannelConfig configures a named notification channel. The name identifies
+// the channel's deliveries in the database, so renaming a channel will notify
+// it of alerts again.
+type ChannelConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Rules limits the channel to alerts for these rules. By default it is
+	// notified of alerts for every rule.
+	Rules []string `json:"rules"`
+
+	Template   Template `json:"template"`
+	MaxRetries int      `json:"max_retries"`
+
+	// DedupeWindow is how long after an alert for a rule and group key is
+	// sent that further alerts for them are not sent
+	DedupeWindow Duration `json:"dedupe_window"`
+
+	// RetryInterval is how long an alert which failed waits before it is
+	// tried again. It doubles after each run the alert fails in, up to
+	// MaxRetryInterval.
+	RetryInterval Duration `json:"retry_interval"`
+
+	// MaxAge is how long after an alert is triggered it is given up on, if it
+	// has not been delivered
+	MaxAge Duration `json:"max_age"`
+
+	Webhook WebhookConfig `json:"webhook"`
+	Slack   SlackConfig   `json:"slack"`
+	Email   EmailConfig   `json:"email"`
+}
+
+// NewNotifier creates the Notifier for a channel of the configured type
+func NewNotifier(cfg ChannelConfig, deployEnv string) (Notifier, error) {
+	switch cfg.Type {
+	case WebhookNotifierType:
+		if cfg.Webhook.URL == "" || len(cfg.Webhook.Secret) == 0 {
+			return nil, fmt.Errorf("channel %q: webhook url and a secret in the environment variable named by secret_env are required", cfg.Name)
+		}
+		return NewWebhookNotifier(cfg.Webhook, deployEnv), nil
+	case SlackNotifierType:
+		if cfg.Slack.URL == "" {
+			return nil, fmt.Errorf("channel %q: slack url or url_env is required", cfg.Name)
+		}
+		return NewSlackNotifier(cfg.Slack), nil
+	case EmailNotifierType:
+		if cfg.Email.Host == "" || cfg.Email.From == "" || len(cfg.Email.To) == 0 {
+			return nil, fmt.Errorf("channel %q: email host, from and to are required", cfg.Name)
+		}
+		return NewEmailNotifier(cfg.Email), nil
+	default:
+		return nil, fmt.Errorf("channel %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// LoadConfig reads channels and silences from a JSON file in the format of
+// Config. Secrets named by environment variables are not read, and the
+// configuration is not validated.
+func LoadConfig(filename string) (Config, error) {
+	cfg := Config{}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %s", filename, err)
+	}
+	return cfg, nil
+}
+
+// ValidateConfig checks that every channel has a unique name, that its
+// templates render and that silences are valid, and fills in defaults for
+// optional settings
+func ValidateConfig(cfg Config) (Config, error) {
+	validated := Config{
+		Channels: make([]ChannelConfig, len(cfg.Channels)),
+		Silences: cfg.Silences,
+	}
+	names := map[string]bool{}
+	for i, channel := range cfg.Channels {
+		if channel.Name == "" {
+			return validated, fmt.Errorf("channel %d: name is required", i)
+		}
+		if names[channel.Name] {
+			return validated, fmt.Errorf("channel %q: name is used more than once", channel.Name)
+		}
+		names[channel.Name] = true
+
+		if channel.MaxRetries < 0 {
+			return validated, fmt.Errorf("channel %q: max_retries must not be negative", channel.Name)
+		} else if channel.MaxRetries == 0 {
+			channel.MaxRetries = DefaultMaxRetries
+		}
+		if channel.DedupeWindow.Duration < 0 {
+			return validated, fmt.Errorf("channel %q: dedupe_window must not be negative", channel.Name)
+		}
+		if channel.RetryInterval.Duration < 0 {
+			return validated, fmt.Errorf("channel %q: retry_interval must not be negative", channel.Name)
+		} else if channel.RetryInterval.Duration == 0 {
+			channel.RetryInterval.Duration = DefaultRetryInterval
+		}
+		if channel.MaxAge.Duration < 0 {
+			return validated, fmt.Errorf("channel %q: max_age must not be negative", channel.Name)
+		} else if channel.MaxAge.Duration == 0 {
+			channel.MaxAge.Duration = DefaultMaxAge
+		}
+		if _, err := newTemplates(channel.Template); err != nil {
+			return validated, fmt.Errorf("channel %q: %s", channel.Name, err)
+		}
+		validated.Channels[i] = channel
+	}
+	for i, silence := range cfg.Silences {
+		if silence.StartsAt.IsZero() || silence.EndsAt.IsZero() {
+			return validated, fmt.Errorf("silence %d: starts_at and ends_at are required", i)
+		}
+		if !silence.EndsAt.After(silence.StartsAt) {
+			return validated, fmt.Errorf("silence %d: ends_at must be after starts_at", i)
+		}
+	}
+	return validated, nil
+}
+
+// Duration is a time.Duration which is configured in JSON as a string such as
+// "30m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
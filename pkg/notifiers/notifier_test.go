@@ -0,0 +1,146 @@
+package notifiers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+)
+
+var _ = Describe("Config", func() {
+	Describe("ValidateConfig", func() {
+		It("fills in defaults", func() {
+			cfg, err := notifiers.ValidateConfig(notifiers.Config{
+				Channels: []notifiers.ChannelConfig{{Name: "a", Type: notifiers.SlackNotifierType}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Channels[0].MaxRetries).To(Equal(notifiers.DefaultMaxRetries))
+			Expect(cfg.Channels[0].RetryInterval.Duration).To(Equal(notifiers.DefaultRetryInterval))
+			Expect(cfg.Channels[0].MaxAge.Duration).To(Equal(notifiers.DefaultMaxAge))
+			Expect(cfg.Channels[0].DedupeWindow.Duration).To(BeZero())
+		})
+
+		It("rejects configuration which cannot be used", func() {
+			now := time.Now()
+			for _, cfg := range []notifiers.Config{
+				{Channels: []notifiers.ChannelConfig{{Type: notifiers.SlackNotifierType}}},
+				{Channels: []notifiers.ChannelConfig{{Name: "a"}, {Name: "a"}}},
+				{Channels: []notifiers.ChannelConfig{{Name: "a", MaxRetries: -1}}},
+				{Channels: []notifiers.ChannelConfig{{Name: "a", RetryInterval: notifiers.Duration{Duration: -time.Minute}}}},
+				{Channels: []notifiers.ChannelConfig{{Name: "a", Template: notifiers.Template{Subject: "{{.Rule"}}}},
+				{Channels: []notifiers.ChannelConfig{{Name: "a", Template: notifiers.Template{Text: "{{.Nonexistent}}"}}}},
+				{Silences: []notifiers.Silence{{StartsAt: now}}},
+				{Silences: []notifiers.Silence{{StartsAt: now, EndsAt: now.Add(-time.Hour)}}},
+			} {
+				_, err := notifiers.ValidateConfig(cfg)
+				Expect(err).To(HaveOccurred(), "%+v", cfg)
+			}
+		})
+	})
+
+	Describe("NewNotifier", func() {
+		It("creates a notifier of each type", func() {
+			for _, cfg := range []notifiers.ChannelConfig{
+				{Name: "a", Type: notifiers.WebhookNotifierType, Webhook: notifiers.WebhookConfig{URL: "http://example.com", Secret: []byte("secret")}},
+				{Name: "b", Type: notifiers.SlackNotifierType, Slack: notifiers.SlackConfig{URL: "http://example.com"}},
+				{Name: "c", Type: notifiers.EmailNotifierType, Email: notifiers.EmailConfig{Host: "localhost", From: "a@example.com", To: []string{"b@example.com"}}},
+			} {
+				_, err := notifiers.NewNotifier(cfg, "dev")
+				Expect(err).NotTo(HaveOccurred(), cfg.Name)
+			}
+		})
+
+		It("requires the settings of the type", func() {
+			for _, cfg := range []notifiers.ChannelConfig{
+				{Name: "a", Type: notifiers.WebhookNotifierType, Webhook: notifiers.WebhookConfig{URL: "http://example.com", SecretEnv: "UNSET"}},
+				{Name: "b", Type: notifiers.SlackNotifierType},
+				{Name: "c", Type: notifiers.EmailNotifierType, Email: notifiers.EmailConfig{Host: "localhost", From: "a@example.com"}},
+				{Name: "d", Type: "pager"},
+			} {
+				_, err := notifiers.NewNotifier(cfg, "dev")
+				Expect(err).To(MatchError(ContainSubstring(cfg.Name)))
+			}
+		})
+	})
+
+	Describe("LoadConfig", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "notifiers")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		write := func(contents string) string {
+			filename := filepath.Join(dir, "notifications.json")
+			Expect(ioutil.WriteFile(filename, []byte(contents), 0600)).To(Succeed())
+			return filename
+		}
+
+		It("loads channels and silences from a JSON file", func() {
+			cfg, err := notifiers.LoadConfig(write(`{
+				"channels": [
+					{
+						"name": "security-webhook",
+						"type": "webhook",
+						"rules": ["org-manager-added"],
+						"dedupe_window": "1h",
+						"webhook": {"url": "https://example.com/hook", "secret_env": "WEBHOOK_SECRET"}
+					}
+				],
+				"silences": [
+					{"comment": "planned work", "starts_at": "2020-01-02T00:00:00Z", "ends_at": "2020-01-02T06:00:00Z"}
+				]
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Channels).To(HaveLen(1))
+			Expect(cfg.Channels[0].Rules).To(Equal([]string{"org-manager-added"}))
+			Expect(cfg.Channels[0].DedupeWindow.Duration).To(Equal(time.Hour))
+			Expect(cfg.Channels[0].Webhook.SecretEnv).To(Equal("WEBHOOK_SECRET"))
+			Expect(cfg.Silences).To(HaveLen(1))
+			Expect(cfg.Silences[0].EndsAt).To(Equal(time.Date(2020, 1, 2, 6, 0, 0, 0, time.UTC)))
+		})
+
+		It("rejects unknown fields, so that typos do not go unnoticed", func() {
+			_, err := notifiers.LoadConfig(write(`{"channels": [{"name": "a", "type": "slack", "slack": {"uri": "x"}}]}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "uri"`)))
+		})
+	})
+
+	Describe("Silence", func() {
+		It("matches alerts triggered while it is in effect which meet its conditions", func() {
+			start := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+			silence := notifiers.Silence{
+				StartsAt: start,
+				EndsAt:   start.Add(time.Hour),
+				Rules:    []string{"some-rule"},
+				Channels: []string{"some-channel"},
+			}
+			alert := db.Alert{Rule: "some-rule", GroupKey: "someone", TriggeredAt: start.Add(time.Minute)}
+			Expect(silence.Matches("some-channel", alert)).To(BeTrue())
+			Expect(silence.Matches("other-channel", alert)).To(BeFalse())
+
+			alert.TriggeredAt = start.Add(time.Hour)
+			Expect(silence.Matches("some-channel", alert)).To(BeFalse())
+
+			alert.TriggeredAt = start
+			alert.Rule = "other-rule"
+			Expect(silence.Matches("some-channel", alert)).To(BeFalse())
+
+			silence.GroupKeys = []string{"someone"}
+			silence.Rules = nil
+			Expect(silence.Matches("some-channel", alert)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package notifiers_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestNotifiers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Notifiers Suite")
+}
@@ -0,0 +1,231 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/gojektech/heimdall"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Runner periodically delivers undelivered alerts to a channel, in the order
+// they were triggered, and records what happened to each in the database.
+// Alerts matched by a silence, or for a rule and group key which were sent
+// within the dedupe window, are recorded without being sent. If an alert
+// cannot be sent, the runner goes on to later alerts, and tries it again once
+// its retry interval has passed, backing off each time it fails, until it is
+// older than the channel's maximum age.
+type Runner struct {
+	name          string
+	rules         []string
+	schedule      time.Duration
+	maxRetries    int
+	dedupeWindow  time.Duration
+	retryInterval time.Duration
+	maxAge        time.Duration
+	silences      []Silence
+	deployEnv     string
+	templates     *templates
+	logger        lager.Logger
+	eventDB       db.EventDB
+	notifier      Notifier
+	retrier       heimdall.Retriable
+}
+
+func NewRunner(
+	cfg ChannelConfig,
+	silences []Silence,
+	deployEnv string,
+	schedule time.Duration,
+	logger lager.Logger,
+	eventDB db.EventDB,
+	notifier Notifier,
+) (*Runner, error) {
+	logger = logger.Session("notifier", lager.Data{"channel": cfg.Name})
+
+	templates, err := newTemplates(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		initalTimeout         = 100 * time.Millisecond
+		maxTimeout            = 2 * time.Second
+		exponent      float64 = 2
+		jitter                = 500 * time.Millisecond
+
+		backoff = heimdall.NewExponentialBackoff(
+			initalTimeout, maxTimeout,
+			exponent, jitter,
+		)
+
+		retrier = heimdall.NewRetrier(backoff)
+	)
+
+	return &Runner{
+		name:          cfg.Name,
+		rules:         cfg.Rules,
+		schedule:      schedule,
+		maxRetries:    cfg.MaxRetries,
+		dedupeWindow:  cfg.DedupeWindow.Duration,
+		retryInterval: cfg.RetryInterval.Duration,
+		maxAge:        cfg.MaxAge.Duration,
+		silences:      silences,
+		deployEnv:     deployEnv,
+		templates:     templates,
+		logger:        logger,
+		eventDB:       eventDB,
+		notifier:      notifier,
+		retrier:       retrier,
+	}, nil
+}
+
+func (r *Runner) Run(ctx context.Context) error {
+	lsession := r.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(r.schedule):
+			if err := r.deliverAlerts(ctx, lsession); err != nil && ctx.Err() == nil {
+				NotifierErrorsTotal.WithLabelValues(r.name).Inc()
+			}
+		}
+	}
+}
+
+func (r *Runner) deliverAlerts(ctx context.Context, lsession lager.Logger) error {
+	alerts, err := r.eventDB.GetUndeliveredAlerts(r.name, r.rules, time.Now().Add(-r.maxAge))
+	if err != nil {
+		lsession.Error("err-get-undelivered-alerts", err)
+		return err
+	}
+	var sendErr error
+	for _, alert := range alerts {
+		if err := r.deliver(ctx, lsession, alert); err == errSendFailed {
+			// The alert has been recorded as failed and is tried again once it
+			// is due, so later alerts go ahead
+			sendErr = err
+		} else if err != nil {
+			return err
+		}
+	}
+	return sendErr
+}
+
+func (r *Runner) deliver(ctx context.Context, lsession lager.Logger, alert db.Alert) error {
+	logData := lager.Data{"alert_id": alert.ID, "rule": alert.Rule, "group_key": alert.GroupKey}
+	delivery := db.AlertDelivery{AlertID: alert.ID, Channel: r.name}
+
+	if r.silenced(alert) {
+		delivery.Status = db.AlertDeliverySilenced
+	} else if r.dedupeWindow > 0 {
+		lastDelivered, err := r.eventDB.GetLastAlertDeliveryTime(r.name, alert.Rule, alert.GroupKey)
+		if err != nil {
+			lsession.Error("err-get-last-alert-delivery-time", err, logData)
+			return err
+		}
+		if !lastDelivered.IsZero() && alert.TriggeredAt.Before(lastDelivered.Add(r.dedupeWindow)) {
+			delivery.Status = db.AlertDeliveryDeduplicated
+		}
+	}
+
+	var sendErr error
+	if delivery.Status == "" {
+		var message Message
+		message, sendErr = r.templates.render(alert, r.deployEnv)
+		if sendErr == nil {
+			delivery.Attempts, sendErr = r.send(ctx, lsession, message)
+		}
+		if sendErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lsession.Error("err-send-alert", sendErr, logData)
+			nextAttemptAt := time.Now().Add(r.backoff(alert.DeliveryFailures))
+			delivery.Status = db.AlertDeliveryFailed
+			delivery.LastError = sendErr.Error()
+			delivery.Failures = 1
+			delivery.NextAttemptAt = &nextAttemptAt
+			logData["next_attempt_at"] = nextAttemptAt
+		} else {
+			deliveredAt := time.Now()
+			delivery.Status = db.AlertDeliverySent
+			delivery.DeliveredAt = &deliveredAt
+		}
+	}
+
+	if err := r.eventDB.StoreAlertDelivery(delivery); err != nil {
+		lsession.Error("err-store-alert-delivery", err, logData)
+		return err
+	}
+	NotifierNotificationsTotal.WithLabelValues(r.name, delivery.Status).Inc()
+	logData["status"] = delivery.Status
+	logData["attempts"] = delivery.Attempts
+	lsession.Info("delivered-alert", logData)
+	if sendErr != nil {
+		return errSendFailed
+	}
+	return nil
+}
+
+// errSendFailed is returned by deliver when an alert could not be sent, and
+// has been recorded as failed
+var errSendFailed = errors.New("alert could not be sent")
+
+// backoff returns how long an alert which has failed in failures earlier runs
+// waits before it is tried again
+func (r *Runner) backoff(failures int) time.Duration {
+	interval := r.retryInterval
+	for i := 0; i < failures && interval < MaxRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > MaxRetryInterval {
+		return MaxRetryInterval
+	}
+	return interval
+}
+
+func (r *Runner) silenced(alert db.Alert) bool {
+	for _, silence := range r.silences {
+		if silence.Matches(r.name, alert) {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends a message, retrying with backoff up to maxRetries times, and
+// returns how many attempts it took
+func (r *Runner) send(ctx context.Context, lsession lager.Logger, message Message) (int, error) {
+	var err error
+	attempt := 0
+	for ; attempt <= r.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			case <-time.After(r.retrier.NextInterval(attempt - 1)):
+			}
+		}
+
+		err = r.notifier.Notify(ctx, message)
+		if err == nil {
+			return attempt + 1, nil
+		}
+		lsession.Info("send-alert-failed", lager.Data{
+			"alert_id": message.Alert.ID,
+			"attempt":  attempt,
+			"error":    err.Error(),
+		})
+	}
+	return attempt, err
+}
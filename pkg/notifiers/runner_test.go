@@ -0,0 +1,231 @@
+package notifiers_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+	"github.com/alphagov/paas-auditor/pkg/notifiers/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Runner Run", func() {
+	const channelName = "test-channel"
+
+	var (
+		logger   lager.Logger
+		eventDB  *dbfakes.FakeEventDB
+		notifier *fakes.FakeNotifier
+		cfg      notifiers.ChannelConfig
+		silences []notifiers.Silence
+
+		undelivered []db.Alert
+		triggeredAt time.Time
+
+		notifierErrorsTotal float64
+		sentTotal           float64
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("notifier-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		By("checking the value of the metrics to test against them later")
+		notifierErrorsTotal = h.CurrentMetricValue(
+			notifiers.NotifierErrorsTotal.WithLabelValues(channelName),
+		)
+		sentTotal = h.CurrentMetricValue(
+			notifiers.NotifierNotificationsTotal.WithLabelValues(channelName, db.AlertDeliverySent),
+		)
+
+		triggeredAt = time.Now().Add(-time.Minute)
+		undelivered = []db.Alert{
+			{ID: 1, Rule: "org-manager-added", GroupKey: "alice", EventGUIDs: []string{"abcd"}, TriggeredAt: triggeredAt},
+			{ID: 2, Rule: "ssh-into-production", GroupKey: "bob", EventGUIDs: []string{"efgh"}, TriggeredAt: triggeredAt},
+		}
+
+		eventDB = &dbfakes.FakeEventDB{}
+		eventDB.GetUndeliveredAlertsStub = func(string, []string, time.Time) ([]db.Alert, error) {
+			// Only the first run finds any alerts
+			if eventDB.GetUndeliveredAlertsCallCount() > 1 {
+				return []db.Alert{}, nil
+			}
+			return undelivered, nil
+		}
+		notifier = &fakes.FakeNotifier{}
+
+		validated, err := notifiers.ValidateConfig(notifiers.Config{
+			Channels: []notifiers.ChannelConfig{{
+				Name:       channelName,
+				Type:       notifiers.WebhookNotifierType,
+				Rules:      []string{"org-manager-added", "ssh-into-production"},
+				MaxRetries: 2,
+				Template:   notifiers.Template{Subject: "{{.Rule}} in {{.DeployEnv}}"},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cfg = validated.Channels[0]
+		silences = nil
+	})
+
+	run := func(ctx context.Context) (wait func() error) {
+		runner, err := notifiers.NewRunner(cfg, silences, "dev", 10*time.Millisecond, logger, eventDB, notifier)
+		Expect(err).NotTo(HaveOccurred())
+
+		var (
+			runError error
+			runWG    sync.WaitGroup
+		)
+		runWG.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			runError = runner.Run(ctx)
+			runWG.Done()
+		}()
+		return func() error {
+			runWG.Wait()
+			return runError
+		}
+	}
+
+	deliveries := func() []db.AlertDelivery {
+		found := []db.AlertDelivery{}
+		for i := 0; i < eventDB.StoreAlertDeliveryCallCount(); i++ {
+			found = append(found, eventDB.StoreAlertDeliveryArgsForCall(i))
+		}
+		return found
+	}
+
+	It("sends each undelivered alert and records its delivery", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.StoreAlertDeliveryCallCount, "100ms", "1ms").Should(Equal(2))
+		channel, rules, since := eventDB.GetUndeliveredAlertsArgsForCall(0)
+		Expect(channel).To(Equal(channelName))
+		Expect(rules).To(Equal([]string{"org-manager-added", "ssh-into-production"}))
+		Expect(since).To(BeTemporally("~", time.Now().Add(-notifiers.DefaultMaxAge), time.Second))
+
+		Expect(notifier.NotifyCallCount()).To(Equal(2))
+		_, message := notifier.NotifyArgsForCall(0)
+		Expect(message.Alert.ID).To(Equal(int64(1)))
+		Expect(message.Subject).To(Equal("org-manager-added in dev"))
+		Expect(message.Text).To(ContainSubstring("abcd"))
+
+		for i, delivery := range deliveries() {
+			Expect(delivery.AlertID).To(Equal(undelivered[i].ID))
+			Expect(delivery.Channel).To(Equal(channelName))
+			Expect(delivery.Status).To(Equal(db.AlertDeliverySent))
+			Expect(delivery.Attempts).To(Equal(1))
+			Expect(delivery.DeliveredAt).NotTo(BeNil())
+		}
+		Expect(notifiers.NotifierNotificationsTotal.WithLabelValues(channelName, db.AlertDeliverySent)).To(
+			h.MetricIncrementedBy(sentTotal, "==", 2),
+		)
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("retries with backoff, and goes on to later alerts when an alert cannot be sent", func() {
+		notifier.NotifyStub = func(_ context.Context, message notifiers.Message) error {
+			if message.Alert.ID == 1 {
+				return fmt.Errorf("some-error")
+			}
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.StoreAlertDeliveryCallCount, "2s", "1ms").Should(Equal(2))
+		Expect(notifier.NotifyCallCount()).To(Equal(4))
+		failed := deliveries()[0]
+		Expect(failed.NextAttemptAt).NotTo(BeNil())
+		Expect(*failed.NextAttemptAt).To(BeTemporally("~", time.Now().Add(notifiers.DefaultRetryInterval), time.Second))
+		failed.NextAttemptAt = nil
+		Expect(failed).To(Equal(db.AlertDelivery{
+			AlertID:   1,
+			Channel:   channelName,
+			Status:    db.AlertDeliveryFailed,
+			Attempts:  3,
+			LastError: "some-error",
+			Failures:  1,
+		}))
+		Expect(deliveries()[1].AlertID).To(Equal(int64(2)))
+		Expect(deliveries()[1].Status).To(Equal(db.AlertDeliverySent))
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(notifiers.NotifierErrorsTotal.WithLabelValues(channelName))
+		}).Should(Equal(notifierErrorsTotal + 1))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+		Expect(eventDB.StoreAlertDeliveryCallCount()).To(Equal(2))
+	})
+
+	It("waits longer each time an alert fails, up to the maximum retry interval", func() {
+		notifier.NotifyReturns(fmt.Errorf("some-error"))
+		undelivered[0].DeliveryFailures = 2
+		undelivered[1].DeliveryFailures = 20
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.StoreAlertDeliveryCallCount, "2s", "1ms").Should(Equal(2))
+		Expect(*deliveries()[0].NextAttemptAt).To(BeTemporally("~", time.Now().Add(4*notifiers.DefaultRetryInterval), time.Second))
+		Expect(*deliveries()[1].NextAttemptAt).To(BeTemporally("~", time.Now().Add(notifiers.MaxRetryInterval), time.Second))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("records silenced alerts without sending them", func() {
+		silences = []notifiers.Silence{{
+			StartsAt: triggeredAt.Add(-time.Hour),
+			EndsAt:   triggeredAt.Add(time.Hour),
+			Rules:    []string{"ssh-into-production"},
+		}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.StoreAlertDeliveryCallCount, "100ms", "1ms").Should(Equal(2))
+		Expect(notifier.NotifyCallCount()).To(Equal(1))
+		Expect(deliveries()[1].Status).To(Equal(db.AlertDeliverySilenced))
+		Expect(deliveries()[1].Attempts).To(BeZero())
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+
+	It("records alerts sent recently for the same rule and group as deduplicated", func() {
+		cfg.DedupeWindow = notifiers.Duration{Duration: time.Hour}
+		eventDB.GetLastAlertDeliveryTimeStub = func(_ string, rule string, groupKey string) (time.Time, error) {
+			if rule == "ssh-into-production" && groupKey == "bob" {
+				return triggeredAt.Add(-30 * time.Minute), nil
+			}
+			return time.Time{}, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.StoreAlertDeliveryCallCount, "100ms", "1ms").Should(Equal(2))
+		Expect(notifier.NotifyCallCount()).To(Equal(1))
+		Expect(deliveries()[0].Status).To(Equal(db.AlertDeliverySent))
+		Expect(deliveries()[1].Status).To(Equal(db.AlertDeliveryDeduplicated))
+		channel, _, _ := eventDB.GetLastAlertDeliveryTimeArgsForCall(1)
+		Expect(channel).To(Equal(channelName))
+
+		cancel()
+		Expect(wait()).To(Succeed())
+	})
+})
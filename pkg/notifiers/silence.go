@@ -0,0 +1,44 @@
+package notifiers
+
+import (
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Silence stops alerts triggered between StartsAt and EndsAt from being
+// sent, for example during planned work. Alerts it matches are recorded as
+// silenced, and are not sent once it ends. Rules, GroupKeys and Channels
+// limit which alerts it matches, and each matches everything if it is empty.
+type Silence struct {
+	Comment string `json:"comment"`
+
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+
+	Rules     []string `json:"rules"`
+	GroupKeys []string `json:"group_keys"`
+	Channels  []string `json:"channels"`
+}
+
+// Matches reports whether the silence stops alert being sent to channel
+func (s Silence) Matches(channel string, alert db.Alert) bool {
+	if alert.TriggeredAt.Before(s.StartsAt) || !alert.TriggeredAt.Before(s.EndsAt) {
+		return false
+	}
+	return matchesAny(s.Rules, alert.Rule) &&
+		matchesAny(s.GroupKeys, alert.GroupKey) &&
+		matchesAny(s.Channels, channel)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type SlackConfig struct {
+	URL string `json:"url"`
+
+	// URLEnv names the environment variable holding the URL instead, as
+	// incoming webhook URLs are secret
+	URLEnv string `json:"url_env"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook, or anything which
+// accepts the same payload
+type SlackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func NewSlackNotifier(cfg SlackConfig) *SlackNotifier {
+	return &SlackNotifier{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    cfg.URL,
+	}
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, message Message) error {
+	body, err := json.Marshal(slackPayload{
+		Text: "*" + message.Subject + "*\n" + message.Text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doNotifyRequest(n.client, req)
+}
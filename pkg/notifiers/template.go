@@ -0,0 +1,106 @@
+package notifiers
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	DefaultSubjectTemplate = `paas-auditor {{.DeployEnv}}: alert {{.Rule}}{{if .GroupKey}} for {{.GroupKey}}{{end}}`
+
+	DefaultTextTemplate = `Alert rule {{.Rule}} was triggered by {{len .EventGUIDs}} event(s)` +
+		`{{if .GroupKey}} for {{.GroupKey}}{{end}} in {{.DeployEnv}}, ` +
+		`created between {{time .FirstEventAt}} and {{time .LastEventAt}}.
+
+Events:
+{{range .EventGUIDs}}{{.}}
+{{end}}`
+)
+
+// Template configures the messages sent for alerts, as Go text/template
+// templates. Templates are given the fields of db.Alert and DeployEnv, and
+// the functions time, which formats a time as RFC3339 in UTC, and join.
+type Template struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// Message is a rendered notification about an alert
+type Message struct {
+	Alert   db.Alert
+	Subject string
+	Text    string
+}
+
+type templateData struct {
+	db.Alert
+	DeployEnv string
+}
+
+var templateFuncs = template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"join": strings.Join,
+}
+
+type templates struct {
+	subject *template.Template
+	text    *template.Template
+}
+
+// newTemplates parses the configured templates, or the defaults, and checks
+// they can be rendered
+func newTemplates(cfg Template) (*templates, error) {
+	if cfg.Subject == "" {
+		cfg.Subject = DefaultSubjectTemplate
+	}
+	if cfg.Text == "" {
+		cfg.Text = DefaultTextTemplate
+	}
+	subject, err := template.New("subject").Funcs(templateFuncs).Option("missingkey=error").Parse(cfg.Subject)
+	if err != nil {
+		return nil, err
+	}
+	text, err := template.New("text").Funcs(templateFuncs).Option("missingkey=error").Parse(cfg.Text)
+	if err != nil {
+		return nil, err
+	}
+	t := &templates{subject, text}
+
+	_, err = t.render(db.Alert{
+		ID:           1,
+		Rule:         "example",
+		GroupKey:     "example",
+		EventIDs:     []int64{1},
+		EventGUIDs:   []string{"example"},
+		FirstEventAt: time.Now(),
+		LastEventAt:  time.Now(),
+		TriggeredAt:  time.Now(),
+	}, "example")
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *templates) render(alert db.Alert, deployEnv string) (Message, error) {
+	data := templateData{alert, deployEnv}
+	var subject, text bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Alert: alert,
+		// Subjects end up in email headers, which cannot contain line breaks
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookTimestampHeader = "X-Paas-Auditor-Timestamp"
+	WebhookSignatureHeader = "X-Paas-Auditor-Signature"
+	AlertIDHeader          = "X-Paas-Auditor-Alert-Id"
+)
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+
+	// SecretEnv names the environment variable holding the key payloads are
+	// signed with, so that the key is not part of the configuration
+	SecretEnv string `json:"secret_env"`
+
+	// Secret is read from SecretEnv when the configuration is loaded
+	Secret []byte `json:"-"`
+}
+
+type webhookPayload struct {
+	ID           int64     `json:"id"`
+	Rule         string    `json:"rule"`
+	GroupKey     string    `json:"group_key"`
+	EventIDs     []int64   `json:"event_ids"`
+	EventGUIDs   []string  `json:"event_guids"`
+	FirstEventAt time.Time `json:"first_event_at"`
+	LastEventAt  time.Time `json:"last_event_at"`
+	TriggeredAt  time.Time `json:"triggered_at"`
+	DeployEnv    string    `json:"deploy_env"`
+	Subject      string    `json:"subject"`
+	Text         string    `json:"text"`
+}
+
+// WebhookNotifier posts alerts as JSON to a URL. Each request is signed with
+// an HMAC-SHA256 of its timestamp and body, so that the receiver can check it
+// came from paas-auditor and is recent. The alert id is sent as a header too,
+// as an alert may be posted more than once if a response is lost.
+type WebhookNotifier struct {
+	client    *http.Client
+	url       string
+	secret    []byte
+	deployEnv string
+}
+
+func NewWebhookNotifier(cfg WebhookConfig, deployEnv string) *WebhookNotifier {
+	return &WebhookNotifier{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		url:       cfg.URL,
+		secret:    cfg.Secret,
+		deployEnv: deployEnv,
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, message Message) error {
+	alert := message.Alert
+	body, err := json.Marshal(webhookPayload{
+		ID:           alert.ID,
+		Rule:         alert.Rule,
+		GroupKey:     alert.GroupKey,
+		EventIDs:     alert.EventIDs,
+		EventGUIDs:   alert.EventGUIDs,
+		FirstEventAt: alert.FirstEventAt.UTC(),
+		LastEventAt:  alert.LastEventAt.UTC(),
+		TriggeredAt:  alert.TriggeredAt.UTC(),
+		DeployEnv:    n.deployEnv,
+		Subject:      message.Subject,
+		Text:         message.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(n.secret, timestamp, body))
+	req.Header.Set(AlertIDHeader, strconv.FormatInt(alert.ID, 10))
+
+	return doNotifyRequest(n.client, req)
+}
+
+// SignWebhookPayload returns the signature of a webhook request, in the form
+// sha256=<hex HMAC-SHA256 of the timestamp, a full stop and the body>
+func SignWebhookPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// doNotifyRequest sends req and fails unless the response is a success
+func doNotifyRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: unexpected status %d: %s", req.URL.Host, resp.StatusCode, respBody)
+	}
+	return nil
+}
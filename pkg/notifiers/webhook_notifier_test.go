@@ -0,0 +1,117 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/notifiers"
+)
+
+var _ = Describe("WebhookNotifier", func() {
+	var (
+		server   *httptest.Server
+		status   int
+		requests []*http.Request
+		bodies   [][]byte
+		message  notifiers.Message
+	)
+
+	BeforeEach(func() {
+		status = http.StatusNoContent
+		requests = nil
+		bodies = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r)
+			bodies = append(bodies, body)
+			w.WriteHeader(status)
+			w.Write([]byte("some response"))
+		}))
+
+		triggeredAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		message = notifiers.Message{
+			Alert: db.Alert{
+				ID:           42,
+				Rule:         "org-manager-added",
+				GroupKey:     "some-actor",
+				EventIDs:     []int64{7},
+				EventGUIDs:   []string{"some-guid"},
+				FirstEventAt: triggeredAt.Add(-time.Minute),
+				LastEventAt:  triggeredAt.Add(-time.Minute),
+				TriggeredAt:  triggeredAt,
+			},
+			Subject: "some subject",
+			Text:    "some text",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts the alert as JSON signed with the secret", func() {
+		notifier := notifiers.NewWebhookNotifier(notifiers.WebhookConfig{URL: server.URL, Secret: []byte("secret")}, "dev")
+		Expect(notifier.Notify(context.Background(), message)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		req, body := requests[0], bodies[0]
+		Expect(req.Method).To(Equal("POST"))
+		Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.Header.Get(notifiers.AlertIDHeader)).To(Equal("42"))
+
+		timestamp := req.Header.Get(notifiers.WebhookTimestampHeader)
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Unix(unix, 0)).To(BeTemporally("~", time.Now(), 5*time.Second))
+		Expect(req.Header.Get(notifiers.WebhookSignatureHeader)).To(Equal(
+			notifiers.SignWebhookPayload([]byte("secret"), timestamp, body),
+		))
+		Expect(req.Header.Get(notifiers.WebhookSignatureHeader)).NotTo(Equal(
+			notifiers.SignWebhookPayload([]byte("other-secret"), timestamp, body),
+		))
+
+		var payload map[string]interface{}
+		Expect(json.Unmarshal(body, &payload)).To(Succeed())
+		Expect(payload).To(HaveKeyWithValue("id", BeNumerically("==", 42)))
+		Expect(payload).To(HaveKeyWithValue("rule", "org-manager-added"))
+		Expect(payload).To(HaveKeyWithValue("group_key", "some-actor"))
+		Expect(payload).To(HaveKeyWithValue("event_guids", []interface{}{"some-guid"}))
+		Expect(payload).To(HaveKeyWithValue("triggered_at", "2020-01-02T03:04:05Z"))
+		Expect(payload).To(HaveKeyWithValue("deploy_env", "dev"))
+		Expect(payload).To(HaveKeyWithValue("subject", "some subject"))
+		Expect(payload).To(HaveKeyWithValue("text", "some text"))
+	})
+
+	It("fails unless the response is a success", func() {
+		status = http.StatusBadGateway
+		notifier := notifiers.NewWebhookNotifier(notifiers.WebhookConfig{URL: server.URL, Secret: []byte("secret")}, "dev")
+		err := notifier.Notify(context.Background(), message)
+		Expect(err).To(MatchError(ContainSubstring("unexpected status 502: some response")))
+	})
+
+	Describe("SlackNotifier", func() {
+		It("posts the subject and text", func() {
+			notifier := notifiers.NewSlackNotifier(notifiers.SlackConfig{URL: server.URL})
+			Expect(notifier.Notify(context.Background(), message)).To(Succeed())
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(bodies[0]).To(MatchJSON(`{"text": "*some subject*\nsome text"}`))
+		})
+
+		It("fails unless the response is a success", func() {
+			status = http.StatusForbidden
+			notifier := notifiers.NewSlackNotifier(notifiers.SlackConfig{URL: server.URL})
+			Expect(notifier.Notify(context.Background(), message)).To(MatchError(ContainSubstring("403")))
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package partitions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+// Policy says which monthly partitions of stored events should exist
+type Policy struct {
+	// MonthsAhead is the number of months after the current one to create
+	// partitions for
+	MonthsAhead int
+
+	// RetentionMonths is the number of whole months before the current one
+	// to keep. Older partitions are removed. Zero keeps everything.
+	RetentionMonths int
+
+	// RetentionAction is db.PartitionActionDrop or db.PartitionActionDetach
+	RetentionAction string
+
+	// RequireArchived keeps partitions until every event in them has been
+	// archived to object storage, including events stored in a window after
+	// it was archived, until the window is archived again
+	RequireArchived bool
+}
+
+func (p Policy) Validate() error {
+	if p.MonthsAhead < 0 {
+		return fmt.Errorf("months ahead must not be negative")
+	}
+	if p.RetentionMonths < 0 {
+		return fmt.Errorf("retention months must not be negative")
+	}
+	if p.RetentionAction != db.PartitionActionDrop && p.RetentionAction != db.PartitionActionDetach {
+		return fmt.Errorf("retention action must be %q or %q, not %q", db.PartitionActionDrop, db.PartitionActionDetach, p.RetentionAction)
+	}
+	return nil
+}
+
+// Maintainer creates the partitions of stored events ahead of time, and
+// removes partitions older than the retention policy allows, unless they are
+// held, for example because archived events have been restored into them
+type Maintainer struct {
+	schedule time.Duration
+	policy   Policy
+	logger   lager.Logger
+	eventDB  db.EventDB
+}
+
+func NewMaintainer(
+	schedule time.Duration,
+	policy Policy,
+	logger lager.Logger,
+	eventDB db.EventDB,
+) *Maintainer {
+	logger = logger.Session("partition-maintainer", lager.Data{
+		"months_ahead":     policy.MonthsAhead,
+		"retention_months": policy.RetentionMonths,
+		"retention_action": policy.RetentionAction,
+	})
+	return &Maintainer{schedule, policy, logger, eventDB}
+}
+
+func (m *Maintainer) Run(ctx context.Context) error {
+	lsession := m.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		if err := m.maintain(lsession, time.Now()); err != nil {
+			lsession.Error("err-maintain", err)
+			MaintainerErrorsTotal.Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(m.schedule):
+		}
+	}
+}
+
+func (m *Maintainer) maintain(lsession lager.Logger, now time.Time) error {
+	thisMonth := db.PartitionMonth(now)
+
+	for i := 0; i <= m.policy.MonthsAhead; i++ {
+		month := thisMonth.AddDate(0, i, 0)
+		created, err := m.eventDB.EnsureCFAuditEventPartition(month)
+		if err != nil {
+			return err
+		}
+		if created {
+			lsession.Info("created-partition", lager.Data{"name": db.PartitionName(month)})
+			MaintainerPartitionsCreatedTotal.Inc()
+		}
+	}
+
+	partitions, err := m.eventDB.GetCFAuditEventPartitions()
+	if err != nil {
+		return err
+	}
+
+	if m.policy.RetentionMonths > 0 {
+		cutoff := thisMonth.AddDate(0, -m.policy.RetentionMonths, 0)
+		if m.policy.RequireArchived {
+			archivedUntil := time.Time{}
+			latest, err := m.eventDB.GetLatestCFAuditEventArchive()
+			if err != nil {
+				return err
+			}
+			if latest != nil {
+				archivedUntil = db.PartitionMonth(latest.WindowEnd)
+			}
+			if archivedUntil.Before(cutoff) {
+				lsession.Info("waiting-for-archiver", lager.Data{
+					"archived_until": archivedUntil,
+					"cutoff":         cutoff,
+				})
+				cutoff = archivedUntil
+			}
+		}
+
+		holds, err := m.eventDB.GetCFAuditEventPartitionHolds()
+		if err != nil {
+			return err
+		}
+		heldUntil := map[time.Time]time.Time{}
+		for _, hold := range holds {
+			heldUntil[hold.Month] = hold.ExpiresAt
+		}
+
+		kept := []db.Partition{}
+		for _, partition := range partitions {
+			if !partition.Month.Before(cutoff) {
+				kept = append(kept, partition)
+				continue
+			}
+			if expiresAt, ok := heldUntil[partition.Month]; ok {
+				lsession.Info("partition-held", lager.Data{
+					"name":       partition.Name,
+					"expires_at": expiresAt,
+				})
+				kept = append(kept, partition)
+				continue
+			}
+			if m.policy.RequireArchived {
+				unarchived, err := m.eventDB.CountUnarchivedCFAuditEvents(partition)
+				if err != nil {
+					return fmt.Errorf("counting unarchived events in partition %s: %s", partition.Name, err)
+				}
+				if unarchived > 0 {
+					lsession.Info("waiting-for-archiver", lager.Data{
+						"name":              partition.Name,
+						"unarchived_events": unarchived,
+					})
+					kept = append(kept, partition)
+					continue
+				}
+			}
+			removal, err := m.eventDB.RemoveCFAuditEventPartition(partition, m.policy.RetentionAction)
+			if errors.Is(err, db.ErrPartitionHeld) {
+				// It was held after the holds were read
+				lsession.Info("partition-held", lager.Data{"name": partition.Name, "error": err.Error()})
+				kept = append(kept, partition)
+				continue
+			} else if err != nil {
+				return fmt.Errorf("removing partition %s: %s", partition.Name, err)
+			}
+			lsession.Info("removed-partition", lager.Data{
+				"name":        partition.Name,
+				"action":      removal.Action,
+				"event_count": removal.EventCount,
+			})
+			MaintainerPartitionsRemovedTotal.WithLabelValues(removal.Action).Inc()
+			MaintainerEventsRemovedTotal.WithLabelValues(removal.Action).Add(float64(removal.EventCount))
+		}
+		partitions = kept
+	}
+
+	MaintainerPartitions.Set(float64(len(partitions)))
+	if len(partitions) > 0 {
+		MaintainerOldestPartitionTimestamp.Set(float64(partitions[0].Month.Unix()))
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package partitions_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/partitions"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Policy", func() {
+	It("accepts the drop and detach actions", func() {
+		Expect(partitions.Policy{RetentionAction: db.PartitionActionDrop}.Validate()).To(Succeed())
+		Expect(partitions.Policy{RetentionAction: db.PartitionActionDetach}.Validate()).To(Succeed())
+		Expect(partitions.Policy{RetentionAction: "truncate"}.Validate()).To(MatchError(
+			`retention action must be "drop" or "detach", not "truncate"`,
+		))
+	})
+
+	It("rejects negative months", func() {
+		Expect(partitions.Policy{RetentionMonths: -1, RetentionAction: "drop"}.Validate()).NotTo(Succeed())
+		Expect(partitions.Policy{MonthsAhead: -1, RetentionAction: "drop"}.Validate()).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Maintainer Run", func() {
+	var (
+		logger    lager.Logger
+		eventDB   *dbfakes.FakeEventDB
+		thisMonth time.Time
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	partition := func(month time.Time) db.Partition {
+		return db.Partition{Name: db.PartitionName(month), Month: month}
+	}
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("partition-maintainer-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		eventDB = &dbfakes.FakeEventDB{}
+		thisMonth = db.PartitionMonth(time.Now())
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("creates partitions for this month and the months ahead", func() {
+		createdBefore := h.CurrentMetricValue(partitions.MaintainerPartitionsCreatedTotal)
+		eventDB.EnsureCFAuditEventPartitionReturns(true, nil)
+		maintainer := partitions.NewMaintainer(time.Hour, partitions.Policy{
+			MonthsAhead:     2,
+			RetentionAction: db.PartitionActionDrop,
+		}, logger, eventDB)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.GetCFAuditEventPartitionsCallCount).Should(Equal(1))
+		Expect(eventDB.EnsureCFAuditEventPartitionCallCount()).To(Equal(3))
+		Expect(eventDB.EnsureCFAuditEventPartitionArgsForCall(0)).To(Equal(thisMonth))
+		Expect(eventDB.EnsureCFAuditEventPartitionArgsForCall(2)).To(Equal(thisMonth.AddDate(0, 2, 0)))
+		Expect(h.CurrentMetricValue(partitions.MaintainerPartitionsCreatedTotal)).To(Equal(createdBefore + 3))
+		Expect(eventDB.RemoveCFAuditEventPartitionCallCount()).To(Equal(0))
+	})
+
+	It("removes partitions older than the retention period", func() {
+		droppedBefore := h.CurrentMetricValue(partitions.MaintainerEventsRemovedTotal.WithLabelValues("detach"))
+		eventDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -4, 0)),
+			partition(thisMonth.AddDate(0, -3, 0)),
+			partition(thisMonth.AddDate(0, -2, 0)),
+			partition(thisMonth.AddDate(0, -1, 0)),
+			partition(thisMonth),
+		}, nil)
+		eventDB.RemoveCFAuditEventPartitionStub = func(p db.Partition, action string) (db.PartitionRemoval, error) {
+			return db.PartitionRemoval{Partition: p, Action: action, EventCount: 10}, nil
+		}
+		maintainer := partitions.NewMaintainer(time.Hour, partitions.Policy{
+			RetentionMonths: 2,
+			RetentionAction: db.PartitionActionDetach,
+		}, logger, eventDB)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.RemoveCFAuditEventPartitionCallCount).Should(Equal(2))
+		removed, action := eventDB.RemoveCFAuditEventPartitionArgsForCall(0)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -4, 0))))
+		Expect(action).To(Equal(db.PartitionActionDetach))
+		removed, _ = eventDB.RemoveCFAuditEventPartitionArgsForCall(1)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -3, 0))))
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(partitions.MaintainerPartitions)
+		}).Should(BeNumerically("==", 3))
+		Expect(h.CurrentMetricValue(partitions.MaintainerOldestPartitionTimestamp)).To(
+			BeNumerically("==", thisMonth.AddDate(0, -2, 0).Unix()),
+		)
+		Expect(h.CurrentMetricValue(partitions.MaintainerEventsRemovedTotal.WithLabelValues("detach"))).To(
+			Equal(droppedBefore + 20),
+		)
+	})
+
+	It("keeps partitions which have not been archived yet", func() {
+		eventDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -4, 0)),
+			partition(thisMonth.AddDate(0, -3, 0)),
+			partition(thisMonth.AddDate(0, -2, 0)),
+		}, nil)
+		eventDB.GetLatestCFAuditEventArchiveReturns(&db.CFAuditEventArchive{
+			WindowEnd: thisMonth.AddDate(0, -3, 5),
+		}, nil)
+		maintainer := partitions.NewMaintainer(time.Hour, partitions.Policy{
+			RetentionMonths: 1,
+			RetentionAction: db.PartitionActionDrop,
+			RequireArchived: true,
+		}, logger, eventDB)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.RemoveCFAuditEventPartitionCallCount).Should(Equal(1))
+		Consistently(eventDB.RemoveCFAuditEventPartitionCallCount, 100*time.Millisecond).Should(Equal(1))
+		removed, _ := eventDB.RemoveCFAuditEventPartitionArgsForCall(0)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -4, 0))))
+	})
+
+	It("keeps partitions with events which have not been archived since they were stored", func() {
+		eventDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -4, 0)),
+			partition(thisMonth.AddDate(0, -3, 0)),
+			partition(thisMonth.AddDate(0, -2, 0)),
+		}, nil)
+		eventDB.GetLatestCFAuditEventArchiveReturns(&db.CFAuditEventArchive{
+			WindowEnd: thisMonth,
+		}, nil)
+		eventDB.CountUnarchivedCFAuditEventsStub = func(p db.Partition) (int64, error) {
+			if p.Month.Equal(thisMonth.AddDate(0, -3, 0)) {
+				return 5, nil
+			}
+			return 0, nil
+		}
+		maintainer := partitions.NewMaintainer(time.Hour, partitions.Policy{
+			RetentionMonths: 1,
+			RetentionAction: db.PartitionActionDrop,
+			RequireArchived: true,
+		}, logger, eventDB)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.RemoveCFAuditEventPartitionCallCount).Should(Equal(2))
+		Consistently(eventDB.RemoveCFAuditEventPartitionCallCount, 100*time.Millisecond).Should(Equal(2))
+		removed, _ := eventDB.RemoveCFAuditEventPartitionArgsForCall(0)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -4, 0))))
+		removed, _ = eventDB.RemoveCFAuditEventPartitionArgsForCall(1)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -2, 0))))
+		Expect(eventDB.CountUnarchivedCFAuditEventsCallCount()).To(Equal(3))
+	})
+
+	It("keeps partitions which are held, such as those events have been restored into", func() {
+		eventDB.GetCFAuditEventPartitionsReturns([]db.Partition{
+			partition(thisMonth.AddDate(0, -14, 0)),
+			partition(thisMonth.AddDate(0, -13, 0)),
+			partition(thisMonth.AddDate(0, -3, 0)),
+			partition(thisMonth),
+		}, nil)
+		eventDB.GetCFAuditEventPartitionHoldsReturns([]db.PartitionHold{{
+			Month:     thisMonth.AddDate(0, -14, 0),
+			Reason:    "restored 2020/01/01/cf-audit-events.ndjson.gz",
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}}, nil)
+		eventDB.RemoveCFAuditEventPartitionStub = func(p db.Partition, action string) (db.PartitionRemoval, error) {
+			if p.Month.Equal(thisMonth.AddDate(0, -3, 0)) {
+				// The partition was held after the holds were read
+				return db.PartitionRemoval{}, fmt.Errorf("partition %s: %w until tomorrow", p.Name, db.ErrPartitionHeld)
+			}
+			return db.PartitionRemoval{Partition: p, Action: action}, nil
+		}
+		maintainer := partitions.NewMaintainer(time.Hour, partitions.Policy{
+			RetentionMonths: 1,
+			RetentionAction: db.PartitionActionDrop,
+		}, logger, eventDB)
+		errorsBefore := h.CurrentMetricValue(partitions.MaintainerErrorsTotal)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.RemoveCFAuditEventPartitionCallCount).Should(Equal(2))
+		Consistently(eventDB.RemoveCFAuditEventPartitionCallCount, 100*time.Millisecond).Should(Equal(2))
+		removed, _ := eventDB.RemoveCFAuditEventPartitionArgsForCall(0)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -13, 0))))
+		removed, _ = eventDB.RemoveCFAuditEventPartitionArgsForCall(1)
+		Expect(removed).To(Equal(partition(thisMonth.AddDate(0, -3, 0))))
+
+		Expect(h.CurrentMetricValue(partitions.MaintainerPartitions)).To(BeNumerically("==", 3))
+		Expect(h.CurrentMetricValue(partitions.MaintainerOldestPartitionTimestamp)).To(
+			BeNumerically("==", thisMonth.AddDate(0, -14, 0).Unix()),
+		)
+		Expect(h.CurrentMetricValue(partitions.MaintainerErrorsTotal)).To(Equal(errorsBefore))
+	})
+
+	It("counts errors and carries on", func() {
+		errorsBefore := h.CurrentMetricValue(partitions.MaintainerErrorsTotal)
+		eventDB.EnsureCFAuditEventPartitionReturns(false, fmt.Errorf("connection refused"))
+		maintainer := partitions.NewMaintainer(10*time.Millisecond, partitions.Policy{
+			RetentionAction: db.PartitionActionDrop,
+		}, logger, eventDB)
+
+		go maintainer.Run(ctx)
+
+		Eventually(eventDB.EnsureCFAuditEventPartitionCallCount).Should(BeNumerically(">=", 3))
+		Expect(h.CurrentMetricValue(partitions.MaintainerErrorsTotal)).To(BeNumerically(">=", errorsBefore+2))
+		Expect(eventDB.GetCFAuditEventPartitionsCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,46 @@
+package partitions
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	MaintainerErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "partition_maintainer_errors_total",
+		Help: "Number of errors encountered while maintaining the partitions of stored events",
+	})
+
+	MaintainerPartitionsCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "partition_maintainer_partitions_created_total",
+		Help: "Number of monthly partitions of stored events created ahead of time",
+	})
+
+	MaintainerPartitionsRemovedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "partition_maintainer_partitions_removed_total",
+		Help: "Number of monthly partitions of stored events removed by the retention policy, labelled by whether they were dropped or detached",
+	}, []string{"action"})
+
+	MaintainerEventsRemovedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "partition_maintainer_events_removed_total",
+		Help: "Number of stored events removed by the retention policy, labelled by whether their partitions were dropped or detached",
+	}, []string{"action"})
+
+	MaintainerPartitions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "partition_maintainer_partitions",
+		Help: "Number of monthly partitions of stored events",
+	})
+
+	MaintainerOldestPartitionTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "partition_maintainer_oldest_partition_timestamp",
+		Help: "Unix epoch seconds of the start of the month of the oldest partition of stored events",
+	})
+)
+
+func initMetrics() {
+	prometheus.MustRegister(MaintainerErrorsTotal)
+	prometheus.MustRegister(MaintainerPartitionsCreatedTotal)
+	prometheus.MustRegister(MaintainerPartitionsRemovedTotal)
+	prometheus.MustRegister(MaintainerEventsRemovedTotal)
+	prometheus.MustRegister(MaintainerPartitions)
+	prometheus.MustRegister(MaintainerOldestPartitionTimestamp)
+}
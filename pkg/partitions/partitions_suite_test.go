@@ -0,0 +1,13 @@
+package partitions_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPartitions(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Partitions Suite")
+}
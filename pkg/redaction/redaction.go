@@ -0,0 +1,205 @@
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	// ActionDrop empties a field, or removes a value from metadata
+	ActionDrop = "drop"
+
+	// ActionMask replaces a value with MaskedValue
+	ActionMask = "mask"
+
+	// ActionHMAC replaces a value with a keyed HMAC-SHA256 of it, so that the
+	// same value always gets the same pseudonym, but the value cannot be
+	// recovered without the key
+	ActionHMAC = "hmac"
+
+	MaskedValue = "****"
+
+	// HMACPrefix marks pseudonyms, so that they are not mistaken for values
+	HMACPrefix = "hmac-sha256:"
+)
+
+// fields are the event fields which can be redacted, by their JSON names
+var fields = map[string]func(*db.CFAuditEvent) *string{
+	"actor":             func(e *db.CFAuditEvent) *string { return &e.Actor },
+	"actor_type":        func(e *db.CFAuditEvent) *string { return &e.ActorType },
+	"actor_name":        func(e *db.CFAuditEvent) *string { return &e.ActorName },
+	"actor_username":    func(e *db.CFAuditEvent) *string { return &e.ActorUsername },
+	"actor_email":       func(e *db.CFAuditEvent) *string { return &e.ActorEmail },
+	"actee":             func(e *db.CFAuditEvent) *string { return &e.Actee },
+	"actee_type":        func(e *db.CFAuditEvent) *string { return &e.ActeeType },
+	"actee_name":        func(e *db.CFAuditEvent) *string { return &e.ActeeName },
+	"organization_guid": func(e *db.CFAuditEvent) *string { return &e.OrganizationGUID },
+	"organization_name": func(e *db.CFAuditEvent) *string { return &e.OrganizationName },
+	"space_guid":        func(e *db.CFAuditEvent) *string { return &e.SpaceGUID },
+	"space_name":        func(e *db.CFAuditEvent) *string { return &e.SpaceName },
+	"app_name":          func(e *db.CFAuditEvent) *string { return &e.AppName },
+}
+
+// Rule redacts either a field of an event or a value in its metadata
+type Rule struct {
+	// Field is the JSON name of an event field, eg actor_username
+	Field string `json:"field"`
+
+	// Metadata is a dot separated path into the event's metadata, eg
+	// request.email. Each element of an array on the path is redacted.
+	Metadata string `json:"metadata"`
+
+	// Action is ActionDrop, ActionMask or ActionHMAC
+	Action string `json:"action"`
+}
+
+// Policy is the redaction applied to events before they are shipped to a sink
+type Policy struct {
+	Rules []Rule `json:"rules"`
+
+	// HMACKeyEnv names the environment variable holding the key for
+	// ActionHMAC, so that the key is not part of the configuration
+	HMACKeyEnv string `json:"hmac_key_env"`
+
+	// HMACKey is read from HMACKeyEnv when the configuration is loaded
+	HMACKey []byte `json:"-"`
+
+	// ShipActorEmail ships the actor's email, which is looked up from UAA.
+	// It is dropped unless the sink opts in, so that policies written before
+	// it was added do not ship it unredacted. Rules still apply to it.
+	ShipActorEmail bool `json:"ship_actor_email"`
+}
+
+func (p Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if (rule.Field == "") == (rule.Metadata == "") {
+			return fmt.Errorf("redaction rule %d: exactly one of field and metadata is required", i)
+		}
+		if rule.Field != "" && fields[rule.Field] == nil {
+			return fmt.Errorf("redaction rule %d: field %q cannot be redacted", i, rule.Field)
+		}
+		switch rule.Action {
+		case ActionDrop, ActionMask:
+		case ActionHMAC:
+			if len(p.HMACKey) == 0 {
+				return fmt.Errorf("redaction rule %d: hmac needs a key in the environment variable named by hmac_key_env", i)
+			}
+		default:
+			return fmt.Errorf("redaction rule %d: action must be %q, %q or %q, not %q", i, ActionDrop, ActionMask, ActionHMAC, rule.Action)
+		}
+	}
+	return nil
+}
+
+// Redactor applies a policy to events. The policy must be valid.
+type Redactor struct {
+	policy Policy
+}
+
+func NewRedactor(policy Policy) *Redactor {
+	return &Redactor{policy}
+}
+
+// Redact returns a copy of event with the policy applied. event itself is not
+// changed, as it may be shared. Empty values are left empty.
+func (r *Redactor) Redact(event db.CFAuditEvent) db.CFAuditEvent {
+	if !r.policy.ShipActorEmail {
+		event.ActorEmail = ""
+	}
+	if len(r.policy.Rules) == 0 {
+		return event
+	}
+	if event.Metadata != nil {
+		event.Metadata = copyValue(event.Metadata).(map[string]interface{})
+	}
+	for _, rule := range r.policy.Rules {
+		if rule.Field != "" {
+			field := fields[rule.Field](&event)
+			if *field != "" {
+				*field = r.redactString(rule.Action, *field)
+			}
+			continue
+		}
+		r.redactPath(rule.Action, event.Metadata, strings.Split(rule.Metadata, "."))
+	}
+	return event
+}
+
+func (r *Redactor) redactPath(action string, value interface{}, path []string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, element := range v {
+			r.redactPath(action, element, path)
+		}
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) > 1 {
+			r.redactPath(action, child, path[1:])
+			return
+		}
+		if action == ActionDrop {
+			delete(v, path[0])
+			return
+		}
+		if child == nil || child == "" {
+			return
+		}
+		if s, ok := child.(string); ok {
+			v[path[0]] = r.redactString(action, s)
+			return
+		}
+		// Numbers, objects and arrays are redacted as a whole, by their JSON
+		encoded, err := json.Marshal(child)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(child))
+		}
+		v[path[0]] = r.redactString(action, string(encoded))
+	}
+}
+
+func (r *Redactor) redactString(action string, s string) string {
+	switch action {
+	case ActionDrop:
+		return ""
+	case ActionHMAC:
+		return HMAC(r.policy.HMACKey, s)
+	default:
+		return MaskedValue
+	}
+}
+
+// HMAC returns the pseudonym of value under key, so that pseudonyms can be
+// worked out for values, eg to search for a user in a sink
+func HMAC(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return HMACPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,174 @@
+package redaction_test
+
+import (
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/redaction"
+)
+
+var _ = Describe("Policy", func() {
+	key := []byte("some-key")
+
+	It("accepts the drop, mask and hmac actions", func() {
+		for _, action := range []string{redaction.ActionDrop, redaction.ActionMask, redaction.ActionHMAC} {
+			policy := redaction.Policy{
+				Rules:   []redaction.Rule{{Field: "actor_name", Action: action}},
+				HMACKey: key,
+			}
+			Expect(policy.Validate()).To(Succeed())
+		}
+	})
+
+	It("rejects unknown actions", func() {
+		policy := redaction.Policy{Rules: []redaction.Rule{{Field: "actor_name", Action: "shred"}}}
+		Expect(policy.Validate()).To(MatchError(ContainSubstring(`not "shred"`)))
+	})
+
+	It("rejects fields which cannot be redacted", func() {
+		policy := redaction.Policy{Rules: []redaction.Rule{{Field: "guid", Action: "mask"}}}
+		Expect(policy.Validate()).To(MatchError(ContainSubstring(`field "guid" cannot be redacted`)))
+	})
+
+	It("needs either a field or a metadata path", func() {
+		Expect(redaction.Policy{Rules: []redaction.Rule{{Action: "mask"}}}.Validate()).NotTo(Succeed())
+		Expect(redaction.Policy{
+			Rules: []redaction.Rule{{Field: "actor_name", Metadata: "request.name", Action: "mask"}},
+		}.Validate()).NotTo(Succeed())
+	})
+
+	It("needs a key for hmac", func() {
+		policy := redaction.Policy{
+			Rules:      []redaction.Rule{{Field: "actor_name", Action: "hmac"}},
+			HMACKeyEnv: "SOME_KEY",
+		}
+		Expect(policy.Validate()).To(MatchError(ContainSubstring("hmac needs a key")))
+	})
+})
+
+var _ = Describe("Redactor", func() {
+	var (
+		key   = []byte("some-key")
+		event db.CFAuditEvent
+	)
+
+	BeforeEach(func() {
+		event = db.CFAuditEvent{Event: cfclient.Event{
+			GUID:          "some-guid",
+			Type:          "audit.user.space_developer_add",
+			Actor:         "some-user-guid",
+			ActorName:     "someone@example.com",
+			ActorUsername: "someone@example.com",
+			Actee:         "some-other-user-guid",
+			ActeeName:     "someone-else@example.com",
+			Metadata: map[string]interface{}{
+				"request": map[string]interface{}{
+					"email":     "someone-else@example.com",
+					"instances": float64(2),
+					"users": []interface{}{
+						map[string]interface{}{"email": "a@example.com", "role": "developer"},
+						map[string]interface{}{"email": "b@example.com", "role": "auditor"},
+					},
+				},
+			},
+		}, EventNames: db.EventNames{
+			OrganizationName: "some-org",
+			ActorEmail:       "someone@example.com",
+		}}
+	})
+
+	redactPolicy := func(policy redaction.Policy) db.CFAuditEvent {
+		policy.HMACKey = key
+		Expect(policy.Validate()).To(Succeed())
+		return redaction.NewRedactor(policy).Redact(event)
+	}
+
+	redact := func(rules ...redaction.Rule) db.CFAuditEvent {
+		return redactPolicy(redaction.Policy{Rules: rules, ShipActorEmail: true})
+	}
+
+	It("leaves events alone without any rules", func() {
+		Expect(redact()).To(Equal(event))
+	})
+
+	It("drops the actor's email unless the sink opts in to it", func() {
+		redacted := redactPolicy(redaction.Policy{Rules: []redaction.Rule{
+			{Field: "actor_name", Action: "mask"},
+		}})
+		Expect(redacted.ActorEmail).To(Equal(""))
+		Expect(redacted.ActorName).To(Equal(redaction.MaskedValue))
+		Expect(redacted.OrganizationName).To(Equal("some-org"))
+		Expect(event.ActorEmail).To(Equal("someone@example.com"))
+
+		Expect(redactPolicy(redaction.Policy{}).ActorEmail).To(Equal(""))
+	})
+
+	It("drops, masks and pseudonymises fields", func() {
+		redacted := redact(
+			redaction.Rule{Field: "actor_name", Action: "drop"},
+			redaction.Rule{Field: "actee_name", Action: "mask"},
+			redaction.Rule{Field: "actor_username", Action: "hmac"},
+			redaction.Rule{Field: "space_guid", Action: "mask"},
+		)
+		Expect(redacted.ActorName).To(Equal(""))
+		Expect(redacted.ActeeName).To(Equal(redaction.MaskedValue))
+		Expect(redacted.ActorUsername).To(Equal(redaction.HMAC(key, "someone@example.com")))
+		Expect(redacted.ActorUsername).To(HavePrefix("hmac-sha256:"))
+		Expect(redacted.SpaceGUID).To(Equal(""), "empty values are left empty")
+		Expect(redacted.Actor).To(Equal(event.Actor))
+		Expect(redacted.GUID).To(Equal(event.GUID))
+	})
+
+	It("redacts the names resolved for events", func() {
+		redacted := redact(
+			redaction.Rule{Field: "actor_email", Action: "hmac"},
+			redaction.Rule{Field: "organization_name", Action: "mask"},
+			redaction.Rule{Field: "app_name", Action: "mask"},
+		)
+		Expect(redacted.ActorEmail).To(Equal(redaction.HMAC(key, "someone@example.com")))
+		Expect(redacted.OrganizationName).To(Equal(redaction.MaskedValue))
+		Expect(redacted.AppName).To(Equal(""), "empty values are left empty")
+		Expect(event.ActorEmail).To(Equal("someone@example.com"))
+	})
+
+	It("gives the same value the same pseudonym, which depends on the key", func() {
+		Expect(redaction.HMAC(key, "someone@example.com")).To(Equal(redaction.HMAC(key, "someone@example.com")))
+		Expect(redaction.HMAC(key, "someone@example.com")).NotTo(Equal(redaction.HMAC(key, "someone-else@example.com")))
+		Expect(redaction.HMAC(key, "someone@example.com")).NotTo(Equal(redaction.HMAC([]byte("other-key"), "someone@example.com")))
+	})
+
+	It("redacts metadata by path, including each element of arrays", func() {
+		redacted := redact(
+			redaction.Rule{Metadata: "request.email", Action: "hmac"},
+			redaction.Rule{Metadata: "request.users.email", Action: "mask"},
+			redaction.Rule{Metadata: "request.users.role", Action: "drop"},
+			redaction.Rule{Metadata: "request.instances", Action: "mask"},
+			redaction.Rule{Metadata: "request.missing.path", Action: "drop"},
+		)
+		Expect(redacted.Metadata).To(Equal(map[string]interface{}{
+			"request": map[string]interface{}{
+				"email":     redaction.HMAC(key, "someone-else@example.com"),
+				"instances": redaction.MaskedValue,
+				"users": []interface{}{
+					map[string]interface{}{"email": redaction.MaskedValue},
+					map[string]interface{}{"email": redaction.MaskedValue},
+				},
+			},
+		}))
+	})
+
+	It("does not change the original event", func() {
+		redact(
+			redaction.Rule{Field: "actor_name", Action: "drop"},
+			redaction.Rule{Metadata: "request.email", Action: "drop"},
+			redaction.Rule{Metadata: "request.users.email", Action: "mask"},
+		)
+		Expect(event.ActorName).To(Equal("someone@example.com"))
+		request := event.Metadata["request"].(map[string]interface{})
+		Expect(request["email"]).To(Equal("someone-else@example.com"))
+		users := request["users"].([]interface{})
+		Expect(users[0]).To(HaveKeyWithValue("email", "a@example.com"))
+	})
+})
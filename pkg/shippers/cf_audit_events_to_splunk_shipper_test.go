@@ -2,6 +2,7 @@ package shippers_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"sync"
 	"time"
@@ -14,30 +15,25 @@ import (
 	"github.com/jarcoal/httpmock"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/alphagov/paas-auditor/pkg/db"
 	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
 	"github.com/alphagov/paas-auditor/pkg/shippers"
 	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
 )
 
-const (
-	splunkURL = "http://splunk.api/hec-endpoint"
-)
-
 var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
-	BeforeSuite(func() {
-		httpmock.Activate()
-	})
+	const shipperName = shippers.LegacySplunkShipperName
 
 	BeforeEach(func() {
-		httpmock.Reset()
+		httpmock.Activate()
 	})
 
-	AfterSuite(func() {
+	AfterEach(func() {
 		httpmock.DeactivateAndReset()
 	})
 
 	var (
-		shipper *shippers.CFAuditEventsToSplunkShipper
+		runner  *shippers.Runner
 		logger  lager.Logger
 		eventDB *dbfakes.FakeEventDB
 
@@ -50,37 +46,68 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
 
 		By("checking the value of the metrics to test against them later")
-		cfAuditEventsToSplunkShipperEventsShippedTotal = h.CurrentMetricValue(
-			shippers.CFAuditEventsToSplunkShipperErrorsTotal,
+		cfAuditEventsToSplunkShipperErrorsTotal = h.CurrentMetricValue(
+			shippers.ShipperErrorsTotal.WithLabelValues(shipperName),
 		)
 		cfAuditEventsToSplunkShipperEventsShippedTotal = h.CurrentMetricValue(
-			shippers.CFAuditEventsToSplunkShipperEventsShippedTotal,
+			shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, ""),
 		)
 
 		eventDB = &dbfakes.FakeEventDB{}
 		eventDB.GetUnshippedCFAuditEventsForShipperReturns(
-			[]cfclient.Event{
-				cfclient.Event{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z"},
-				cfclient.Event{GUID: "efgh", CreatedAt: "2006-01-02T15:04:05Z"},
-				cfclient.Event{GUID: "ijkl", CreatedAt: "2006-01-02T15:04:05Z"},
+			[]db.CFAuditEvent{
+				db.CFAuditEvent{ID: 1, Event: cfclient.Event{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z"}},
+				db.CFAuditEvent{ID: 2, Event: cfclient.Event{GUID: "efgh", CreatedAt: "2006-01-02T15:04:05Z"}},
+				db.CFAuditEvent{ID: 3, Event: cfclient.Event{GUID: "ijkl", CreatedAt: "2006-01-02T15:04:05Z"}},
 			},
 			nil,
 		)
 
-		shipper = shippers.NewCFAuditEventsToSplunkShipper(
+		By("configuring the sink the way SPLUNK_API_KEY and SPLUNK_HEC_ENDPOINT_URL do")
+		sinks, err := shippers.ValidateSinkConfigs([]shippers.SinkConfig{
+			shippers.LegacySplunkSinkConfig(splunkURL, "splunk-key"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		shipper, err := shippers.NewShipper(sinks[0], "dev")
+		Expect(err).NotTo(HaveOccurred())
+
+		runner = shippers.NewRunner(
+			sinks[0],
 			10*time.Millisecond,
 			logger,
 			eventDB,
-			"dev", "splunk-key", splunkURL,
+			shipper,
 		)
 	})
 
 	It("appears to work", func() {
 		httpmock.RegisterResponder(
 			"POST", splunkURL,
-			httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
-				"message": "success",
-			}),
+			func(req *http.Request) (*http.Response, error) {
+				defer GinkgoRecover()
+				Expect(req.Header.Get("Authorization")).To(Equal("Splunk splunk-key"))
+
+				decoder := json.NewDecoder(req.Body)
+				guids := []string{}
+				for decoder.More() {
+					var event struct {
+						SourceType string `json:"sourcetype"`
+						Source     string `json:"source"`
+						Event      struct {
+							GUID string `json:"guid"`
+						} `json:"event"`
+					}
+					Expect(decoder.Decode(&event)).To(Succeed())
+					Expect(event.SourceType).To(Equal("cf-audit-event"))
+					Expect(event.Source).To(Equal("dev"))
+					guids = append(guids, event.Event.GUID)
+				}
+				Expect(guids).To(Equal([]string{"abcd", "efgh", "ijkl"}))
+
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"message": "success",
+				})
+			},
 		)
 
 		var (
@@ -96,29 +123,35 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		shipWG.Add(1)
 		go func() {
 			defer GinkgoRecover()
-			shipError = shipper.Run(shipContext)
+			shipError = runner.Run(shipContext)
 			shipWG.Done()
 		}()
 
 		By("waiting for events to be queried")
 		Eventually(
 			eventDB.GetUnshippedCFAuditEventsForShipperCallCount, "100ms", "1ms",
-		).Should(BeNumerically("==", 1))
+		).Should(BeNumerically(">=", 1))
+		name, _ := eventDB.GetUnshippedCFAuditEventsForShipperArgsForCall(0)
+		Expect(name).To(Equal("cf-audit-events-to-splunk"))
 
-		By("waiting for events to be shipped")
+		By("waiting for events to be shipped in one request")
 		Eventually(
 			httpmock.GetTotalCallCount, "1000ms", "1ms",
-		).Should(BeNumerically("==", 3))
+		).Should(BeNumerically(">=", 1))
 
-		Expect(shipError).NotTo(HaveOccurred())
+		By("checking the cursor was advanced")
+		Eventually(eventDB.UpdateShipperCursorCallCount).Should(BeNumerically(">=", 1))
+		name, lastShipped := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(name).To(Equal("cf-audit-events-to-splunk"))
+		Expect(lastShipped.GUID).To(Equal("ijkl"))
 
 		By("checking the metrics")
-		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal).To(
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "")).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperEventsShippedTotal, ">=", 3),
 		)
 
 		By("checking that there were no errors")
-		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal).To(
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, "==", 0),
 		)
 
@@ -129,19 +162,24 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 	})
 
 	It("appears is resilient to errors", func() {
-		splunkPOSTs := 0
+		var (
+			splunkPOSTs   = 0
+			splunkPOSTsMu sync.Mutex
+		)
 
+		// Every attempt of the first run fails
 		httpmock.RegisterResponder(
 			"POST", splunkURL,
 			func(req *http.Request) (*http.Response, error) {
-				if splunkPOSTs >= 1 && splunkPOSTs <= 5 {
-					splunkPOSTs++
+				splunkPOSTsMu.Lock()
+				defer splunkPOSTsMu.Unlock()
+				splunkPOSTs++
+				if splunkPOSTs <= 1+shippers.DefaultMaxRetries {
 					return httpmock.NewJsonResponse(500, map[string]interface{}{
 						"message": "failure",
 					})
 				}
 
-				splunkPOSTs++
 				return httpmock.NewJsonResponse(200, map[string]interface{}{
 					"message": "success",
 				})
@@ -161,7 +199,7 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		shipWG.Add(1)
 		go func() {
 			defer GinkgoRecover()
-			shipError = shipper.Run(shipContext)
+			shipError = runner.Run(shipContext)
 			shipWG.Done()
 		}()
 
@@ -178,27 +216,29 @@ var _ = Describe("CFAuditEventsToSplunkShipper Run", func() {
 		By("checking the metrics")
 		Eventually(
 			func() prometheus.Collector {
-				return shippers.CFAuditEventsToSplunkShipperErrorsTotal
+				return shippers.ShipperErrorsTotal.WithLabelValues(shipperName)
 			}, "10s", "1ms",
 		).Should(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, ">=", 1),
 		)
+		Expect(eventDB.UpdateShipperCursorCallCount()).To(Equal(0))
 
 		By("waiting for events to be queried again")
 		Eventually(
 			eventDB.GetUnshippedCFAuditEventsForShipperCallCount, "1s", "1ms",
-		).Should(BeNumerically("==", 2))
+		).Should(BeNumerically(">=", 2))
 
 		By("waiting for events to be shipped")
 		Eventually(
 			httpmock.GetTotalCallCount, "5s", "1ms",
-		).Should(BeNumerically(">=", 10))
+		).Should(BeNumerically(">=", 2+shippers.DefaultMaxRetries))
+		Eventually(eventDB.UpdateShipperCursorCallCount).Should(BeNumerically(">=", 1))
 
 		By("checking the metrics")
-		Expect(shippers.CFAuditEventsToSplunkShipperEventsShippedTotal).To(
-			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperEventsShippedTotal, ">=", 2),
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "")).To(
+			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperEventsShippedTotal, ">=", 3),
 		)
-		Expect(shippers.CFAuditEventsToSplunkShipperErrorsTotal).To(
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
 			h.MetricIncrementedBy(cfAuditEventsToSplunkShipperErrorsTotal, "==", 1),
 		)
 
@@ -0,0 +1,436 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
+)
+
+type FakeAckShipper struct {
+	AckPolicyStub        func() (shippers.AckPolicy, bool)
+	ackPolicyMutex       sync.RWMutex
+	ackPolicyArgsForCall []struct {
+	}
+	ackPolicyReturns struct {
+		result1 shippers.AckPolicy
+		result2 bool
+	}
+	ackPolicyReturnsOnCall map[int]struct {
+		result1 shippers.AckPolicy
+		result2 bool
+	}
+	AckedStub        func(context.Context, []int64) (map[int64]bool, error)
+	ackedMutex       sync.RWMutex
+	ackedArgsForCall []struct {
+		arg1 context.Context
+		arg2 []int64
+	}
+	ackedReturns struct {
+		result1 map[int64]bool
+		result2 error
+	}
+	ackedReturnsOnCall map[int]struct {
+		result1 map[int64]bool
+		result2 error
+	}
+	EncodeStub        func(db.CFAuditEvent) ([]byte, error)
+	encodeMutex       sync.RWMutex
+	encodeArgsForCall []struct {
+		arg1 db.CFAuditEvent
+	}
+	encodeReturns struct {
+		result1 []byte
+		result2 error
+	}
+	encodeReturnsOnCall map[int]struct {
+		result1 []byte
+		result2 error
+	}
+	SendStub        func(context.Context, [][]byte) error
+	sendMutex       sync.RWMutex
+	sendArgsForCall []struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}
+	sendReturns struct {
+		result1 error
+	}
+	sendReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SendForAckStub        func(context.Context, [][]byte) (int64, error)
+	sendForAckMutex       sync.RWMutex
+	sendForAckArgsForCall []struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}
+	sendForAckReturns struct {
+		result1 int64
+		result2 error
+	}
+	sendForAckReturnsOnCall map[int]struct {
+		result1 int64
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeAckShipper) AckPolicy() (shippers.AckPolicy, bool) {
+	fake.ackPolicyMutex.Lock()
+	ret, specificReturn := fake.ackPolicyReturnsOnCall[len(fake.ackPolicyArgsForCall)]
+	fake.ackPolicyArgsForCall = append(fake.ackPolicyArgsForCall, struct {
+	}{})
+	fake.recordInvocation("AckPolicy", []interface{}{})
+	fake.ackPolicyMutex.Unlock()
+	if fake.AckPolicyStub != nil {
+		return fake.AckPolicyStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.ackPolicyReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAckShipper) AckPolicyCallCount() int {
+	fake.ackPolicyMutex.RLock()
+	defer fake.ackPolicyMutex.RUnlock()
+	return len(fake.ackPolicyArgsForCall)
+}
+
+func (fake *FakeAckShipper) AckPolicyCalls(stub func() (shippers.AckPolicy, bool)) {
+	fake.ackPolicyMutex.Lock()
+	defer fake.ackPolicyMutex.Unlock()
+	fake.AckPolicyStub = stub
+}
+
+func (fake *FakeAckShipper) AckPolicyReturns(result1 shippers.AckPolicy, result2 bool) {
+	fake.ackPolicyMutex.Lock()
+	defer fake.ackPolicyMutex.Unlock()
+	fake.AckPolicyStub = nil
+	fake.ackPolicyReturns = struct {
+		result1 shippers.AckPolicy
+		result2 bool
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) AckPolicyReturnsOnCall(i int, result1 shippers.AckPolicy, result2 bool) {
+	fake.ackPolicyMutex.Lock()
+	defer fake.ackPolicyMutex.Unlock()
+	fake.AckPolicyStub = nil
+	if fake.ackPolicyReturnsOnCall == nil {
+		fake.ackPolicyReturnsOnCall = make(map[int]struct {
+			result1 shippers.AckPolicy
+			result2 bool
+		})
+	}
+	fake.ackPolicyReturnsOnCall[i] = struct {
+		result1 shippers.AckPolicy
+		result2 bool
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) Acked(arg1 context.Context, arg2 []int64) (map[int64]bool, error) {
+	var arg2Copy []int64
+	if arg2 != nil {
+		arg2Copy = make([]int64, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.ackedMutex.Lock()
+	ret, specificReturn := fake.ackedReturnsOnCall[len(fake.ackedArgsForCall)]
+	fake.ackedArgsForCall = append(fake.ackedArgsForCall, struct {
+		arg1 context.Context
+		arg2 []int64
+	}{arg1, arg2Copy})
+	fake.recordInvocation("Acked", []interface{}{arg1, arg2Copy})
+	fake.ackedMutex.Unlock()
+	if fake.AckedStub != nil {
+		return fake.AckedStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.ackedReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAckShipper) AckedCallCount() int {
+	fake.ackedMutex.RLock()
+	defer fake.ackedMutex.RUnlock()
+	return len(fake.ackedArgsForCall)
+}
+
+func (fake *FakeAckShipper) AckedCalls(stub func(context.Context, []int64) (map[int64]bool, error)) {
+	fake.ackedMutex.Lock()
+	defer fake.ackedMutex.Unlock()
+	fake.AckedStub = stub
+}
+
+func (fake *FakeAckShipper) AckedArgsForCall(i int) (context.Context, []int64) {
+	fake.ackedMutex.RLock()
+	defer fake.ackedMutex.RUnlock()
+	argsForCall := fake.ackedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAckShipper) AckedReturns(result1 map[int64]bool, result2 error) {
+	fake.ackedMutex.Lock()
+	defer fake.ackedMutex.Unlock()
+	fake.AckedStub = nil
+	fake.ackedReturns = struct {
+		result1 map[int64]bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) AckedReturnsOnCall(i int, result1 map[int64]bool, result2 error) {
+	fake.ackedMutex.Lock()
+	defer fake.ackedMutex.Unlock()
+	fake.AckedStub = nil
+	if fake.ackedReturnsOnCall == nil {
+		fake.ackedReturnsOnCall = make(map[int]struct {
+			result1 map[int64]bool
+			result2 error
+		})
+	}
+	fake.ackedReturnsOnCall[i] = struct {
+		result1 map[int64]bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) Encode(arg1 db.CFAuditEvent) ([]byte, error) {
+	fake.encodeMutex.Lock()
+	ret, specificReturn := fake.encodeReturnsOnCall[len(fake.encodeArgsForCall)]
+	fake.encodeArgsForCall = append(fake.encodeArgsForCall, struct {
+		arg1 db.CFAuditEvent
+	}{arg1})
+	fake.recordInvocation("Encode", []interface{}{arg1})
+	fake.encodeMutex.Unlock()
+	if fake.EncodeStub != nil {
+		return fake.EncodeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.encodeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAckShipper) EncodeCallCount() int {
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	return len(fake.encodeArgsForCall)
+}
+
+func (fake *FakeAckShipper) EncodeCalls(stub func(db.CFAuditEvent) ([]byte, error)) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = stub
+}
+
+func (fake *FakeAckShipper) EncodeArgsForCall(i int) db.CFAuditEvent {
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	argsForCall := fake.encodeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAckShipper) EncodeReturns(result1 []byte, result2 error) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = nil
+	fake.encodeReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) EncodeReturnsOnCall(i int, result1 []byte, result2 error) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = nil
+	if fake.encodeReturnsOnCall == nil {
+		fake.encodeReturnsOnCall = make(map[int]struct {
+			result1 []byte
+			result2 error
+		})
+	}
+	fake.encodeReturnsOnCall[i] = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) Send(arg1 context.Context, arg2 [][]byte) error {
+	var arg2Copy [][]byte
+	if arg2 != nil {
+		arg2Copy = make([][]byte, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.sendMutex.Lock()
+	ret, specificReturn := fake.sendReturnsOnCall[len(fake.sendArgsForCall)]
+	fake.sendArgsForCall = append(fake.sendArgsForCall, struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}{arg1, arg2Copy})
+	fake.recordInvocation("Send", []interface{}{arg1, arg2Copy})
+	fake.sendMutex.Unlock()
+	if fake.SendStub != nil {
+		return fake.SendStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.sendReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeAckShipper) SendCallCount() int {
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	return len(fake.sendArgsForCall)
+}
+
+func (fake *FakeAckShipper) SendCalls(stub func(context.Context, [][]byte) error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = stub
+}
+
+func (fake *FakeAckShipper) SendArgsForCall(i int) (context.Context, [][]byte) {
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	argsForCall := fake.sendArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAckShipper) SendReturns(result1 error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = nil
+	fake.sendReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAckShipper) SendReturnsOnCall(i int, result1 error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = nil
+	if fake.sendReturnsOnCall == nil {
+		fake.sendReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.sendReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAckShipper) SendForAck(arg1 context.Context, arg2 [][]byte) (int64, error) {
+	var arg2Copy [][]byte
+	if arg2 != nil {
+		arg2Copy = make([][]byte, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.sendForAckMutex.Lock()
+	ret, specificReturn := fake.sendForAckReturnsOnCall[len(fake.sendForAckArgsForCall)]
+	fake.sendForAckArgsForCall = append(fake.sendForAckArgsForCall, struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}{arg1, arg2Copy})
+	fake.recordInvocation("SendForAck", []interface{}{arg1, arg2Copy})
+	fake.sendForAckMutex.Unlock()
+	if fake.SendForAckStub != nil {
+		return fake.SendForAckStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.sendForAckReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAckShipper) SendForAckCallCount() int {
+	fake.sendForAckMutex.RLock()
+	defer fake.sendForAckMutex.RUnlock()
+	return len(fake.sendForAckArgsForCall)
+}
+
+func (fake *FakeAckShipper) SendForAckCalls(stub func(context.Context, [][]byte) (int64, error)) {
+	fake.sendForAckMutex.Lock()
+	defer fake.sendForAckMutex.Unlock()
+	fake.SendForAckStub = stub
+}
+
+func (fake *FakeAckShipper) SendForAckArgsForCall(i int) (context.Context, [][]byte) {
+	fake.sendForAckMutex.RLock()
+	defer fake.sendForAckMutex.RUnlock()
+	argsForCall := fake.sendForAckArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAckShipper) SendForAckReturns(result1 int64, result2 error) {
+	fake.sendForAckMutex.Lock()
+	defer fake.sendForAckMutex.Unlock()
+	fake.SendForAckStub = nil
+	fake.sendForAckReturns = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) SendForAckReturnsOnCall(i int, result1 int64, result2 error) {
+	fake.sendForAckMutex.Lock()
+	defer fake.sendForAckMutex.Unlock()
+	fake.SendForAckStub = nil
+	if fake.sendForAckReturnsOnCall == nil {
+		fake.sendForAckReturnsOnCall = make(map[int]struct {
+			result1 int64
+			result2 error
+		})
+	}
+	fake.sendForAckReturnsOnCall[i] = struct {
+		result1 int64
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAckShipper) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.ackPolicyMutex.RLock()
+	defer fake.ackPolicyMutex.RUnlock()
+	fake.ackedMutex.RLock()
+	defer fake.ackedMutex.RUnlock()
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	fake.sendForAckMutex.RLock()
+	defer fake.sendForAckMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeAckShipper) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ shippers.AckShipper = new(FakeAckShipper)
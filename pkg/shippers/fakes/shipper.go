@@ -0,0 +1,197 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
+)
+
+type FakeShipper struct {
+	EncodeStub        func(db.CFAuditEvent) ([]byte, error)
+	encodeMutex       sync.RWMutex
+	encodeArgsForCall []struct {
+		arg1 db.CFAuditEvent
+	}
+	encodeReturns struct {
+		result1 []byte
+		result2 error
+	}
+	encodeReturnsOnCall map[int]struct {
+		result1 []byte
+		result2 error
+	}
+	SendStub        func(context.Context, [][]byte) error
+	sendMutex       sync.RWMutex
+	sendArgsForCall []struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}
+	sendReturns struct {
+		result1 error
+	}
+	sendReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeShipper) Encode(arg1 db.CFAuditEvent) ([]byte, error) {
+	fake.encodeMutex.Lock()
+	ret, specificReturn := fake.encodeReturnsOnCall[len(fake.encodeArgsForCall)]
+	fake.encodeArgsForCall = append(fake.encodeArgsForCall, struct {
+		arg1 db.CFAuditEvent
+	}{arg1})
+	fake.recordInvocation("Encode", []interface{}{arg1})
+	fake.encodeMutex.Unlock()
+	if fake.EncodeStub != nil {
+		return fake.EncodeStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.encodeReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeShipper) EncodeCallCount() int {
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	return len(fake.encodeArgsForCall)
+}
+
+func (fake *FakeShipper) EncodeCalls(stub func(db.CFAuditEvent) ([]byte, error)) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = stub
+}
+
+func (fake *FakeShipper) EncodeArgsForCall(i int) db.CFAuditEvent {
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	argsForCall := fake.encodeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeShipper) EncodeReturns(result1 []byte, result2 error) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = nil
+	fake.encodeReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeShipper) EncodeReturnsOnCall(i int, result1 []byte, result2 error) {
+	fake.encodeMutex.Lock()
+	defer fake.encodeMutex.Unlock()
+	fake.EncodeStub = nil
+	if fake.encodeReturnsOnCall == nil {
+		fake.encodeReturnsOnCall = make(map[int]struct {
+			result1 []byte
+			result2 error
+		})
+	}
+	fake.encodeReturnsOnCall[i] = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeShipper) Send(arg1 context.Context, arg2 [][]byte) error {
+	var arg2Copy [][]byte
+	if arg2 != nil {
+		arg2Copy = make([][]byte, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.sendMutex.Lock()
+	ret, specificReturn := fake.sendReturnsOnCall[len(fake.sendArgsForCall)]
+	fake.sendArgsForCall = append(fake.sendArgsForCall, struct {
+		arg1 context.Context
+		arg2 [][]byte
+	}{arg1, arg2Copy})
+	fake.recordInvocation("Send", []interface{}{arg1, arg2Copy})
+	fake.sendMutex.Unlock()
+	if fake.SendStub != nil {
+		return fake.SendStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.sendReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeShipper) SendCallCount() int {
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	return len(fake.sendArgsForCall)
+}
+
+func (fake *FakeShipper) SendCalls(stub func(context.Context, [][]byte) error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = stub
+}
+
+func (fake *FakeShipper) SendArgsForCall(i int) (context.Context, [][]byte) {
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	argsForCall := fake.sendArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeShipper) SendReturns(result1 error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = nil
+	fake.sendReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeShipper) SendReturnsOnCall(i int, result1 error) {
+	fake.sendMutex.Lock()
+	defer fake.sendMutex.Unlock()
+	fake.SendStub = nil
+	if fake.sendReturnsOnCall == nil {
+		fake.sendReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.sendReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeShipper) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.encodeMutex.RLock()
+	defer fake.encodeMutex.RUnlock()
+	fake.sendMutex.RLock()
+	defer fake.sendMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeShipper) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ shippers.Shipper = new(FakeShipper)
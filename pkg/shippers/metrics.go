@@ -5,30 +5,42 @@ import (
 )
 
 var (
-	CFAuditEventsToSplunkShipperErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "cf_audit_events_to_splunk_shipper_errors_total",
-		Help: "Number of errors encountered by CF Audit Events to Splunk shipper",
-	})
-
-	CFAuditEventsToSplunkShipperEventsShippedTotal = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "cf_audit_events_to_splunk_shipper_events_shipped_total",
-		Help: "Number of CF audit events shipped to Splunk by CF Audit Events to Splunk shipper",
-	})
-
-	CFAuditEventsToSplunkShipperLatestEventTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "cf_audit_events_to_splunk_shipper_latest_event_timestamp",
-		Help: "Unix epoch seconds of most recent event shipped to Splunk",
-	})
-
-	CFAuditEventsToSplunkShipperShipDurationTotal = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "cf_audit_events_to_splunk_shipper_ship_duration_total",
-		Help: "Number of seconds spent shipping events by CF Audit Events to Splunk Shipper",
-	})
+	ShipperErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_events_shipper_errors_total",
+		Help: "Number of errors encountered by a CF audit events shipper",
+	}, []string{"shipper"})
+
+	ShipperEventsShippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_events_shipper_events_shipped_total",
+		Help: "Number of CF audit events from each foundation shipped to a sink",
+	}, []string{"shipper", "foundation"})
+
+	ShipperEventsSkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_events_shipper_events_skipped_total",
+		Help: "Number of CF audit events from each foundation skipped by a sink because they could not be encoded",
+	}, []string{"shipper", "foundation"})
+
+	ShipperLatestEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_events_shipper_latest_event_timestamp",
+		Help: "Unix epoch seconds of most recent event from each foundation shipped to a sink",
+	}, []string{"shipper", "foundation"})
+
+	ShipperShipDurationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cf_audit_events_shipper_ship_duration_total",
+		Help: "Number of seconds spent shipping events to a sink",
+	}, []string{"shipper"})
+
+	ShipperUnconfirmedBatches = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cf_audit_events_shipper_unconfirmed_batches",
+		Help: "Number of batches sent to a sink which are waiting for the sink to confirm them",
+	}, []string{"shipper"})
 )
 
 func initMetrics() {
-	prometheus.MustRegister(CFAuditEventsToSplunkShipperErrorsTotal)
-	prometheus.MustRegister(CFAuditEventsToSplunkShipperEventsShippedTotal)
-	prometheus.MustRegister(CFAuditEventsToSplunkShipperLatestEventTimestamp)
-	prometheus.MustRegister(CFAuditEventsToSplunkShipperShipDurationTotal)
+	prometheus.MustRegister(ShipperErrorsTotal)
+	prometheus.MustRegister(ShipperEventsShippedTotal)
+	prometheus.MustRegister(ShipperEventsSkippedTotal)
+	prometheus.MustRegister(ShipperLatestEventTimestamp)
+	prometheus.MustRegister(ShipperShipDurationTotal)
+	prometheus.MustRegister(ShipperUnconfirmedBatches)
 }
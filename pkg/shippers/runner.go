@@ -0,0 +1,410 @@
+package shippers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/gojektech/heimdall"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/redaction"
+)
+
+// unshippedPageSize is the least number of events read from the database at a
+// time. The events are shipped after they have been read, so that no read
+// transaction is open while batches are sent.
+const unshippedPageSize = 1000
+
+// Runner periodically ships unshipped events to a sink in batches. A batch is
+// limited both by the number of events and by the size of their encoded
+// payloads. The sink's cursor is advanced after each batch that is sent
+// successfully or, for an AckShipper, once the batch and every batch before
+// it have been confirmed. An event which cannot be encoded is skipped: it is
+// logged and counted, and the cursor moves past it with the rest of its
+// batch.
+type Runner struct {
+	name       string
+	schedule   time.Duration
+	batchSize  int
+	batchBytes int
+	maxRetries int
+	logger     lager.Logger
+	eventDB    db.EventDB
+	shipper    Shipper
+	redactor   *redaction.Redactor
+	retrier    heimdall.Retriable
+
+	// ackShipper is set if the sink confirms batches after accepting them
+	ackShipper AckShipper
+	ackPolicy  AckPolicy
+	unacked    []unackedBatch
+
+	// skipped are the IDs of events in batches which could not be encoded,
+	// which are not counted as shipped when the cursor moves past them
+	skipped map[int64]bool
+
+	eventsShipped int
+}
+
+// unackedBatch is a batch which has been sent, waiting for the sink to
+// confirm it
+type unackedBatch struct {
+	events []db.CFAuditEvent
+	ackID  int64
+	sentAt time.Time
+	acked  bool
+}
+
+func NewRunner(
+	cfg SinkConfig,
+	schedule time.Duration,
+	logger lager.Logger,
+	eventDB db.EventDB,
+	shipper Shipper,
+) *Runner {
+	logger = logger.Session("shipper", lager.Data{"shipper": cfg.Name})
+
+	var (
+		initalTimeout         = 100 * time.Millisecond
+		maxTimeout            = 2 * time.Second
+		exponent      float64 = 2
+		jitter                = 500 * time.Millisecond
+
+		backoff = heimdall.NewExponentialBackoff(
+			initalTimeout, maxTimeout,
+			exponent, jitter,
+		)
+
+		retrier = heimdall.NewRetrier(backoff)
+	)
+
+	r := &Runner{
+		name:       cfg.Name,
+		schedule:   schedule,
+		batchSize:  cfg.BatchSize,
+		batchBytes: cfg.BatchBytes,
+		maxRetries: cfg.MaxRetries,
+		logger:     logger,
+		eventDB:    eventDB,
+		shipper:    shipper,
+		redactor:   redaction.NewRedactor(cfg.Redaction),
+		retrier:    retrier,
+		skipped:    map[int64]bool{},
+	}
+	if ackShipper, ok := shipper.(AckShipper); ok {
+		if policy, ok := ackShipper.AckPolicy(); ok {
+			r.ackShipper = ackShipper
+			r.ackPolicy = policy
+		}
+	}
+	return r
+}
+
+func (r *Runner) Run(ctx context.Context) error {
+	lsession := r.logger.Session("run")
+
+	lsession.Info("start")
+	defer lsession.Info("end")
+
+	for {
+		select {
+		case <-ctx.Done():
+			lsession.Info("done")
+			return nil
+		case <-time.After(r.schedule):
+			r.ship(ctx, lsession)
+		}
+	}
+}
+
+func (r *Runner) ship(ctx context.Context, lsession lager.Logger) {
+	startTime := time.Now()
+	errorsTotal := ShipperErrorsTotal.WithLabelValues(r.name)
+
+	var (
+		eventsShipped = 0
+		batch         = r.newBatch()
+	)
+
+	shipBatch := func() error {
+		shipped, err := r.shipBatch(ctx, lsession, batch.events, batch.payloads)
+		eventsShipped += shipped
+		if err != nil {
+			return err
+		}
+		batch = r.newBatch()
+		return nil
+	}
+
+	// Events are read a page at a time, and each page is shipped before the
+	// next is read, so that only one page is held in memory
+	pageSize := unshippedPageSize
+	if r.batchSize > pageSize {
+		pageSize = r.batchSize
+	}
+	var err error
+	for ctx.Err() == nil {
+		var events []db.CFAuditEvent
+		events, err = r.eventDB.GetUnshippedCFAuditEventsForShipper(r.name, pageSize)
+		if err != nil {
+			lsession.Error("err-get-unshipped-cf-audit-events-for-shipper", err)
+			break
+		}
+		for _, event := range events {
+			var payload []byte
+			payload, err = r.shipper.Encode(r.redactor.Redact(event))
+			if err != nil {
+				// The event would fail to encode on every run, so it is
+				// skipped rather than holding up every event after it
+				lsession.Error("err-encode-event", err, lager.Data{"id": event.ID, "guid": event.GUID})
+				ShipperEventsSkippedTotal.WithLabelValues(r.name, event.Foundation).Inc()
+				r.skipped[event.ID] = true
+				batch.skip(event)
+				err = nil
+				continue
+			}
+			if batch.full(payload) {
+				if err = shipBatch(); err != nil {
+					break
+				}
+			}
+			batch.add(event, payload)
+		}
+		// The next page is read from the sink's cursor, so the rest of this
+		// page is shipped, and confirmed, first
+		if err == nil && len(batch.events) > 0 {
+			err = shipBatch()
+		}
+		if err == nil {
+			var shipped int
+			shipped, err = r.waitForAcks(ctx, lsession, 0)
+			eventsShipped += shipped
+		}
+		if err != nil || len(events) < pageSize {
+			break
+		}
+	}
+	if err != nil {
+		errorsTotal.Inc()
+		// Batches which were not confirmed are sent again on the next run
+		r.unacked = nil
+		r.skipped = map[int64]bool{}
+		ShipperUnconfirmedBatches.WithLabelValues(r.name).Set(0)
+	}
+
+	duration := time.Since(startTime)
+	lsession.Info(
+		"shipped-events",
+		lager.Data{
+			"duration":             duration,
+			"events-shipped":       eventsShipped,
+			"total-events-shipped": r.eventsShipped,
+			"all-events-shipped":   err == nil,
+		},
+	)
+	ShipperShipDurationTotal.WithLabelValues(r.name).Add(duration.Seconds())
+}
+
+// batch is a batch of events being built up to be shipped, with their
+// encoded payloads. It is limited both by the number of events and by the
+// total size of their payloads. Events which were skipped have no payload,
+// but are kept so that the cursor moves past them.
+type batch struct {
+	maxEvents int
+	maxBytes  int
+
+	events   []db.CFAuditEvent
+	payloads [][]byte
+	bytes    int
+}
+
+func (r *Runner) newBatch() *batch {
+	return &batch{maxEvents: r.batchSize, maxBytes: r.batchBytes}
+}
+
+// full says whether payload would not fit in the batch. A batch always has
+// at least one event, even if it is larger than maxBytes on its own.
+func (b *batch) full(payload []byte) bool {
+	if len(b.payloads) == 0 {
+		return false
+	}
+	// Allow a byte per event for a separator
+	return len(b.payloads) == b.maxEvents || b.bytes+len(payload)+1 > b.maxBytes
+}
+
+func (b *batch) add(event db.CFAuditEvent, payload []byte) {
+	b.events = append(b.events, event)
+	b.payloads = append(b.payloads, payload)
+	b.bytes += len(payload) + 1
+}
+
+func (b *batch) skip(event db.CFAuditEvent) {
+	b.events = append(b.events, event)
+}
+
+// shipBatch sends a batch. The sink's cursor is advanced past it once it is
+// sent or, for an AckShipper, it joins the batches waiting to be confirmed,
+// and shipBatch waits until there is room for another. It returns the number
+// of events the cursor was advanced past.
+func (r *Runner) shipBatch(ctx context.Context, lsession lager.Logger, batch []db.CFAuditEvent, payloads [][]byte) (int, error) {
+	if len(payloads) == 0 {
+		// Every event in the batch was skipped, so there is nothing to send
+		if r.ackShipper == nil {
+			if err := r.shipped(lsession, batch); err != nil {
+				return 0, err
+			}
+			return len(batch), nil
+		}
+		r.unacked = append(r.unacked, unackedBatch{events: batch, sentAt: time.Now(), acked: true})
+		return r.waitForAcks(ctx, lsession, r.ackPolicy.Window-1)
+	}
+
+	if r.ackShipper == nil {
+		err := r.send(ctx, lsession, func() error {
+			return r.shipper.Send(ctx, payloads)
+		})
+		if err != nil {
+			lsession.Error("err-send-batch", err)
+			return 0, err
+		}
+		if err := r.shipped(lsession, batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+
+	var ackID int64
+	err := r.send(ctx, lsession, func() (err error) {
+		ackID, err = r.ackShipper.SendForAck(ctx, payloads)
+		return err
+	})
+	if err != nil {
+		lsession.Error("err-send-batch", err)
+		return 0, err
+	}
+	r.unacked = append(r.unacked, unackedBatch{events: batch, ackID: ackID, sentAt: time.Now()})
+	ShipperUnconfirmedBatches.WithLabelValues(r.name).Set(float64(len(r.unacked)))
+	return r.waitForAcks(ctx, lsession, r.ackPolicy.Window-1)
+}
+
+// waitForAcks asks the sink about every batch waiting to be confirmed at
+// once, every poll interval, until no more than max are waiting. The sink's
+// cursor is advanced past the batches at the front which have been
+// confirmed. It returns the number of events the cursor was advanced past.
+func (r *Runner) waitForAcks(ctx context.Context, lsession lager.Logger, max int) (int, error) {
+	shipped := 0
+	for len(r.unacked) > max {
+		select {
+		case <-ctx.Done():
+			return shipped, ctx.Err()
+		case <-time.After(r.ackPolicy.PollInterval):
+		}
+
+		ackIDs := []int64{}
+		for _, unacked := range r.unacked {
+			if !unacked.acked {
+				ackIDs = append(ackIDs, unacked.ackID)
+			}
+		}
+		acked := map[int64]bool{}
+		if len(ackIDs) > 0 {
+			var err error
+			acked, err = r.ackShipper.Acked(ctx, ackIDs)
+			if err != nil {
+				// Batches are only sent again once they time out
+				lsession.Info("poll-acks-failed", lager.Data{"error": err.Error()})
+			}
+		}
+		for i := range r.unacked {
+			if acked[r.unacked[i].ackID] {
+				r.unacked[i].acked = true
+			}
+		}
+
+		confirmed := []db.CFAuditEvent{}
+		for len(r.unacked) > 0 && r.unacked[0].acked {
+			confirmed = append(confirmed, r.unacked[0].events...)
+			r.unacked = r.unacked[1:]
+		}
+		ShipperUnconfirmedBatches.WithLabelValues(r.name).Set(float64(len(r.unacked)))
+		if len(confirmed) > 0 {
+			if err := r.shipped(lsession, confirmed); err != nil {
+				return shipped, err
+			}
+			shipped += len(confirmed)
+		}
+
+		if len(r.unacked) > 0 && time.Since(r.unacked[0].sentAt) > r.ackPolicy.Timeout {
+			err := fmt.Errorf("waiting for acknowledgement of ackId %d: timed out after %s", r.unacked[0].ackID, r.ackPolicy.Timeout)
+			lsession.Error("err-wait-for-ack", err)
+			return shipped, err
+		}
+	}
+	return shipped, nil
+}
+
+// shipped advances the sink's cursor past events, which have been shipped or
+// skipped. The events are only counted once the cursor has moved, so that
+// events which are shipped again after the cursor fails to move are not
+// counted twice.
+func (r *Runner) shipped(lsession lager.Logger, events []db.CFAuditEvent) error {
+	lastEvent := events[len(events)-1]
+	err := r.eventDB.UpdateShipperCursor(r.name, lastEvent)
+	if err != nil {
+		lsession.Error("err-update-shipper-cursor", err)
+		return err
+	}
+
+	// A batch can hold events from several foundations, which are counted
+	// separately
+	lastEvents := map[string]db.CFAuditEvent{}
+	for _, event := range events {
+		if r.skipped[event.ID] {
+			delete(r.skipped, event.ID)
+			continue
+		}
+		r.eventsShipped++
+		ShipperEventsShippedTotal.WithLabelValues(r.name, event.Foundation).Inc()
+		lastEvents[event.Foundation] = event
+	}
+
+	for foundation, event := range lastEvents {
+		createdAt, err := time.Parse(time.RFC3339, event.CreatedAt)
+		if err != nil {
+			// Not fatal
+			lsession.Error("err-parse-event-time", err, lager.Data{
+				"raw-created-at": event.CreatedAt,
+			})
+			ShipperErrorsTotal.WithLabelValues(r.name).Inc()
+			continue
+		}
+		ShipperLatestEventTimestamp.WithLabelValues(r.name, foundation).Set(
+			float64(createdAt.Unix()),
+		)
+	}
+	return nil
+}
+
+// send calls send, which sends a batch, retrying with backoff up to
+// maxRetries times
+func (r *Runner) send(ctx context.Context, lsession lager.Logger, send func() error) error {
+	var err error
+	for attempt := 0; attempt <= r.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.retrier.NextInterval(attempt - 1)):
+			}
+		}
+
+		err = send()
+		if err == nil {
+			return nil
+		}
+		lsession.Info("send-batch-failed", lager.Data{"attempt": attempt, "error": err.Error()})
+	}
+	return err
+}
@@ -0,0 +1,564 @@
+package shippers_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	dbfakes "github.com/alphagov/paas-auditor/pkg/db/fakes"
+	"github.com/alphagov/paas-auditor/pkg/redaction"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
+	"github.com/alphagov/paas-auditor/pkg/shippers/fakes"
+	h "github.com/alphagov/paas-auditor/pkg/testhelpers"
+)
+
+var _ = Describe("Runner Run", func() {
+	const shipperName = "test-sink"
+
+	var (
+		runner  *shippers.Runner
+		logger  lager.Logger
+		eventDB *dbfakes.FakeEventDB
+		shipper *fakes.FakeShipper
+
+		unshipped []db.CFAuditEvent
+
+		shipperErrorsTotal         float64
+		shipperEventsShippedTotalA float64
+		shipperEventsShippedTotalB float64
+	)
+
+	BeforeEach(func() {
+		logger = lager.NewLogger("shipper-test")
+		logger.RegisterSink(lager.NewWriterSink(GinkgoWriter, lager.INFO))
+
+		By("checking the value of the metrics to test against them later")
+		shipperErrorsTotal = h.CurrentMetricValue(
+			shippers.ShipperErrorsTotal.WithLabelValues(shipperName),
+		)
+		shipperEventsShippedTotalA = h.CurrentMetricValue(
+			shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a"),
+		)
+		shipperEventsShippedTotalB = h.CurrentMetricValue(
+			shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b"),
+		)
+
+		eventDB = &dbfakes.FakeEventDB{}
+		// efgh was collected late, after events created after it
+		unshipped = []db.CFAuditEvent{
+			db.CFAuditEvent{ID: 7, Foundation: "foundation-a", Event: cfclient.Event{GUID: "abcd", CreatedAt: "2006-01-02T15:04:05Z"}},
+			db.CFAuditEvent{ID: 8, Foundation: "foundation-b", Event: cfclient.Event{GUID: "efgh", CreatedAt: "2006-01-02T15:04:01Z"}},
+			db.CFAuditEvent{ID: 9, Foundation: "foundation-a", Event: cfclient.Event{GUID: "ijkl", CreatedAt: "2006-01-02T15:04:07Z"}},
+		}
+		eventDB.GetUnshippedCFAuditEventsForShipperStub = func(string, int) ([]db.CFAuditEvent, error) {
+			// Only the first run finds any events
+			if eventDB.GetUnshippedCFAuditEventsForShipperCallCount() > 1 {
+				return nil, nil
+			}
+			return unshipped, nil
+		}
+
+		shipper = &fakes.FakeShipper{}
+		shipper.EncodeStub = func(event db.CFAuditEvent) ([]byte, error) {
+			return []byte(event.GUID), nil
+		}
+
+		runner = shippers.NewRunner(
+			shippers.SinkConfig{Name: shipperName, BatchSize: 2, BatchBytes: 1000, MaxRetries: 3},
+			10*time.Millisecond,
+			logger,
+			eventDB,
+			shipper,
+		)
+	})
+
+	run := func(ctx context.Context) (wait func() error) {
+		var (
+			runError error
+			runWG    sync.WaitGroup
+		)
+		runWG.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			runError = runner.Run(ctx)
+			runWG.Done()
+		}()
+		return func() error {
+			runWG.Wait()
+			return runError
+		}
+	}
+
+	It("ships events in batches and advances the cursor after each batch", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		By("running the shipper")
+		wait := run(ctx)
+
+		By("waiting for events to be shipped")
+		Eventually(shipper.SendCallCount, "100ms", "1ms").Should(Equal(2))
+		_, firstBatch := shipper.SendArgsForCall(0)
+		Expect(firstBatch).To(Equal([][]byte{[]byte("abcd"), []byte("efgh")}))
+		_, secondBatch := shipper.SendArgsForCall(1)
+		Expect(secondBatch).To(Equal([][]byte{[]byte("ijkl")}))
+
+		By("checking the cursor was advanced per batch")
+		Eventually(eventDB.UpdateShipperCursorCallCount).Should(Equal(2))
+		name, lastShipped := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(name).To(Equal(shipperName))
+		Expect(lastShipped.ID).To(Equal(int64(8)))
+		Expect(lastShipped.GUID).To(Equal("efgh"))
+		name, lastShipped = eventDB.UpdateShipperCursorArgsForCall(1)
+		Expect(name).To(Equal(shipperName))
+		Expect(lastShipped.ID).To(Equal(int64(9)))
+		Expect(lastShipped.GUID).To(Equal("ijkl"))
+
+		By("checking the foundations are passed to the shipper")
+		Expect(shipper.EncodeArgsForCall(1).Foundation).To(Equal("foundation-b"))
+
+		By("checking the metrics of each foundation")
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 2),
+		)
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalB, "==", 1),
+		)
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
+			h.MetricIncrementedBy(shipperErrorsTotal, "==", 0),
+		)
+		Expect(h.CurrentMetricValue(shippers.ShipperLatestEventTimestamp.WithLabelValues(shipperName, "foundation-a"))).To(
+			BeNumerically("==", time.Date(2006, 1, 2, 15, 4, 7, 0, time.UTC).Unix()),
+		)
+		Expect(h.CurrentMetricValue(shippers.ShipperLatestEventTimestamp.WithLabelValues(shipperName, "foundation-b"))).To(
+			BeNumerically("==", time.Date(2006, 1, 2, 15, 4, 1, 0, time.UTC).Unix()),
+		)
+
+		By("cleaning up")
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("reads events a page at a time, shipping each page before reading the next", func() {
+		page := []db.CFAuditEvent{}
+		for i := 0; i < 1000; i++ {
+			page = append(page, db.CFAuditEvent{ID: int64(i + 1), Foundation: "foundation-a", Event: cfclient.Event{
+				GUID:      fmt.Sprintf("guid-%d", i+1),
+				CreatedAt: "2006-01-02T15:04:05Z",
+			}})
+		}
+		sentBeforeSecondPage := make(chan int, 1)
+		eventDB.GetUnshippedCFAuditEventsForShipperStub = func(string, int) ([]db.CFAuditEvent, error) {
+			switch eventDB.GetUnshippedCFAuditEventsForShipperCallCount() {
+			case 1:
+				return page, nil
+			case 2:
+				sentBeforeSecondPage <- shipper.SendCallCount()
+				return unshipped, nil
+			default:
+				return nil, nil
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(shipper.SendCallCount, "1s", "1ms").Should(Equal(502))
+		Expect(sentBeforeSecondPage).To(Receive(Equal(500)))
+		name, limit := eventDB.GetUnshippedCFAuditEventsForShipperArgsForCall(0)
+		Expect(name).To(Equal(shipperName))
+		Expect(limit).To(Equal(1000))
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
+			h.MetricIncrementedBy(shipperErrorsTotal, "==", 0),
+		)
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("limits the size of each batch in bytes", func() {
+		runner = shippers.NewRunner(
+			shippers.SinkConfig{Name: shipperName, BatchSize: 100, BatchBytes: 10, MaxRetries: 3},
+			10*time.Millisecond,
+			logger,
+			eventDB,
+			shipper,
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		// Each payload is 4 bytes plus a separator
+		Eventually(shipper.SendCallCount, "100ms", "1ms").Should(Equal(2))
+		_, firstBatch := shipper.SendArgsForCall(0)
+		Expect(firstBatch).To(Equal([][]byte{[]byte("abcd"), []byte("efgh")}))
+		_, secondBatch := shipper.SendArgsForCall(1)
+		Expect(secondBatch).To(Equal([][]byte{[]byte("ijkl")}))
+		Eventually(eventDB.UpdateShipperCursorCallCount).Should(Equal(2))
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("redacts events before encoding them", func() {
+		runner = shippers.NewRunner(
+			shippers.SinkConfig{
+				Name:       shipperName,
+				BatchSize:  100,
+				BatchBytes: 1000,
+				MaxRetries: 3,
+				Redaction: redaction.Policy{
+					Rules:   []redaction.Rule{{Field: "actor_name", Action: redaction.ActionHMAC}},
+					HMACKey: []byte("some-key"),
+				},
+			},
+			10*time.Millisecond,
+			logger,
+			eventDB,
+			shipper,
+		)
+		shipper.EncodeStub = func(event db.CFAuditEvent) ([]byte, error) {
+			return []byte(event.ActorName), nil
+		}
+		unshipped[0].ActorName = "someone@example.com"
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(shipper.SendCallCount, "100ms", "1ms").Should(Equal(1))
+		_, batch := shipper.SendArgsForCall(0)
+		Expect(string(batch[0])).To(Equal(redaction.HMAC([]byte("some-key"), "someone@example.com")))
+		Expect(unshipped[0].ActorName).To(Equal("someone@example.com"))
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("retries a batch which fails to send", func() {
+		shipper.SendReturnsOnCall(0, fmt.Errorf("sadpanda"))
+		shipper.SendReturnsOnCall(1, fmt.Errorf("sadpanda"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(shipper.SendCallCount, "10s", "1ms").Should(Equal(4))
+		Eventually(eventDB.UpdateShipperCursorCallCount).Should(Equal(2))
+
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 2),
+		)
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalB, "==", 1),
+		)
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
+			h.MetricIncrementedBy(shipperErrorsTotal, "==", 0),
+		)
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("skips an event which cannot be encoded, and moves the cursor past it", func() {
+		shipperEventsSkippedTotalB := h.CurrentMetricValue(
+			shippers.ShipperEventsSkippedTotal.WithLabelValues(shipperName, "foundation-b"),
+		)
+		shipper.EncodeStub = func(event db.CFAuditEvent) ([]byte, error) {
+			if event.GUID == "efgh" {
+				return nil, fmt.Errorf("unsupported value")
+			}
+			return []byte(event.GUID), nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.UpdateShipperCursorCallCount, "100ms", "1ms").Should(Equal(1))
+		Expect(shipper.SendCallCount()).To(Equal(1))
+		_, batch := shipper.SendArgsForCall(0)
+		Expect(batch).To(Equal([][]byte{[]byte("abcd"), []byte("ijkl")}))
+		_, lastShipped := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(lastShipped.ID).To(Equal(int64(9)))
+
+		Expect(shippers.ShipperEventsSkippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+			h.MetricIncrementedBy(shipperEventsSkippedTotalB, "==", 1),
+		)
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 2),
+		)
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalB, "==", 0),
+		)
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("moves the cursor past a batch in which no event could be encoded", func() {
+		shipper.EncodeReturns(nil, fmt.Errorf("unsupported value"))
+		shipper.EncodeStub = nil
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.UpdateShipperCursorCallCount, "100ms", "1ms").Should(Equal(1))
+		_, lastShipped := eventDB.UpdateShipperCursorArgsForCall(0)
+		Expect(lastShipped.ID).To(Equal(int64(9)))
+		Expect(shipper.SendCallCount()).To(Equal(0))
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("only counts events as shipped once the cursor has moved past them", func() {
+		eventDB.UpdateShipperCursorReturnsOnCall(0, fmt.Errorf("connection refused"))
+		eventDB.GetUnshippedCFAuditEventsForShipperStub = func(string, int) ([]db.CFAuditEvent, error) {
+			// The events are read again after the cursor fails to move
+			if eventDB.GetUnshippedCFAuditEventsForShipperCallCount() > 2 {
+				return nil, nil
+			}
+			return unshipped, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.UpdateShipperCursorCallCount, "1s", "1ms").Should(Equal(3))
+		Expect(shipper.SendCallCount()).To(Equal(3))
+
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 2),
+		)
+		Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+			h.MetricIncrementedBy(shipperEventsShippedTotalB, "==", 1),
+		)
+		Expect(shippers.ShipperErrorsTotal.WithLabelValues(shipperName)).To(
+			h.MetricIncrementedBy(shipperErrorsTotal, "==", 1),
+		)
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("stops reading events when a batch cannot be sent", func() {
+		shipper.SendReturns(fmt.Errorf("sadpanda"))
+		runner = shippers.NewRunner(
+			shippers.SinkConfig{Name: shipperName, BatchSize: 1, BatchBytes: 1000, MaxRetries: 0},
+			10*time.Millisecond,
+			logger,
+			eventDB,
+			shipper,
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(eventDB.GetUnshippedCFAuditEventsForShipperCallCount, "1s", "1ms").Should(
+			BeNumerically(">=", 2),
+		)
+		Expect(shipper.SendCallCount()).To(Equal(1))
+		Expect(shipper.EncodeCallCount()).To(Equal(2))
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("counts an error if it cannot read events", func() {
+		eventDB.GetUnshippedCFAuditEventsForShipperReturns(nil, fmt.Errorf("connection refused"))
+		eventDB.GetUnshippedCFAuditEventsForShipperStub = nil
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(shippers.ShipperErrorsTotal.WithLabelValues(shipperName))
+		}, "1s", "1ms").Should(BeNumerically(">=", shipperErrorsTotal+1))
+		Expect(shipper.SendCallCount()).To(Equal(0))
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+
+	It("stops without advancing the cursor when a batch cannot be sent", func() {
+		shipper.SendReturns(fmt.Errorf("sadpanda"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := run(ctx)
+
+		By("giving up after the retries")
+		Eventually(func() float64 {
+			return h.CurrentMetricValue(shippers.ShipperErrorsTotal.WithLabelValues(shipperName))
+		}, "10s", "1ms").Should(BeNumerically("==", shipperErrorsTotal+1))
+		Expect(shipper.SendCallCount()).To(Equal(4))
+		Expect(eventDB.UpdateShipperCursorCallCount()).To(Equal(0))
+
+		By("trying again on the next run")
+		Eventually(eventDB.GetUnshippedCFAuditEventsForShipperCallCount, "1s", "1ms").Should(
+			BeNumerically(">=", 2),
+		)
+
+		cancel()
+		Expect(wait()).NotTo(HaveOccurred())
+	})
+	Context("with a sink which confirms batches", func() {
+		var (
+			ackShipper *fakes.FakeAckShipper
+			confirmed  map[int64]bool
+			confirmMu  sync.Mutex
+		)
+
+		BeforeEach(func() {
+			confirmed = map[int64]bool{}
+			ackShipper = &fakes.FakeAckShipper{}
+			ackShipper.EncodeStub = shipper.EncodeStub
+			ackShipper.AckPolicyReturns(shippers.AckPolicy{
+				Window:       2,
+				PollInterval: time.Millisecond,
+				Timeout:      time.Second,
+			}, true)
+			ackShipper.SendForAckStub = func(context.Context, [][]byte) (int64, error) {
+				return int64(ackShipper.SendForAckCallCount()), nil
+			}
+			ackShipper.AckedStub = func(_ context.Context, ackIDs []int64) (map[int64]bool, error) {
+				confirmMu.Lock()
+				defer confirmMu.Unlock()
+				acked := map[int64]bool{}
+				for _, ackID := range ackIDs {
+					acked[ackID] = confirmed[ackID]
+				}
+				return acked, nil
+			}
+
+			// Each event is a batch of its own
+			unshipped = append(unshipped, db.CFAuditEvent{ID: 10, Foundation: "foundation-a", Event: cfclient.Event{GUID: "mnop", CreatedAt: "2006-01-02T15:04:09Z"}})
+			runner = shippers.NewRunner(
+				shippers.SinkConfig{Name: shipperName, BatchSize: 1, BatchBytes: 1000, MaxRetries: 0},
+				10*time.Millisecond,
+				logger,
+				eventDB,
+				ackShipper,
+			)
+		})
+
+		It("keeps sending batches up to the window, and advances the cursor past those confirmed in order", func() {
+			confirm := func(ackID int64) {
+				confirmMu.Lock()
+				defer confirmMu.Unlock()
+				confirmed[ackID] = true
+			}
+
+			// The batches are confirmed out of order
+			go func() {
+				defer GinkgoRecover()
+				Eventually(ackShipper.SendForAckCallCount, "1s", "1ms").Should(Equal(2))
+				Consistently(ackShipper.SendForAckCallCount, "20ms", "1ms").Should(Equal(2))
+				confirm(2)
+				Consistently(ackShipper.SendForAckCallCount, "20ms", "1ms").Should(Equal(2))
+				confirm(1)
+				Eventually(ackShipper.SendForAckCallCount, "1s", "1ms").Should(Equal(4))
+				confirm(4)
+				confirm(3)
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wait := run(ctx)
+
+			Eventually(eventDB.UpdateShipperCursorCallCount, "1s", "1ms").Should(Equal(2))
+			_, lastShipped := eventDB.UpdateShipperCursorArgsForCall(0)
+			Expect(lastShipped.ID).To(Equal(int64(8)))
+			_, lastShipped = eventDB.UpdateShipperCursorArgsForCall(1)
+			Expect(lastShipped.ID).To(Equal(int64(10)))
+
+			Expect(ackShipper.SendCallCount()).To(Equal(0))
+			Expect(ackShipper.SendForAckCallCount()).To(Equal(4))
+
+			By("asking about every batch waiting to be confirmed at once")
+			_, ackIDs := ackShipper.AckedArgsForCall(0)
+			Expect(ackIDs).To(Equal([]int64{1, 2}))
+
+			Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+				h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 3),
+			)
+			Expect(h.CurrentMetricValue(shippers.ShipperUnconfirmedBatches.WithLabelValues(shipperName))).To(
+				BeNumerically("==", 0),
+			)
+
+			cancel()
+			Expect(wait()).NotTo(HaveOccurred())
+		})
+
+		It("moves the cursor past a batch which was skipped once the batches before it are confirmed", func() {
+			ackShipper.EncodeStub = func(event db.CFAuditEvent) ([]byte, error) {
+				if event.GUID == "efgh" {
+					return nil, fmt.Errorf("unsupported value")
+				}
+				return []byte(event.GUID), nil
+			}
+			ackShipper.AckedStub = func(_ context.Context, ackIDs []int64) (map[int64]bool, error) {
+				acked := map[int64]bool{}
+				for _, ackID := range ackIDs {
+					acked[ackID] = true
+				}
+				return acked, nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wait := run(ctx)
+
+			Eventually(func() int64 {
+				n := eventDB.UpdateShipperCursorCallCount()
+				if n == 0 {
+					return 0
+				}
+				_, lastShipped := eventDB.UpdateShipperCursorArgsForCall(n - 1)
+				return lastShipped.ID
+			}, "1s", "1ms").Should(Equal(int64(10)))
+			Expect(ackShipper.SendForAckCallCount()).To(Equal(3))
+			Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-a")).To(
+				h.MetricIncrementedBy(shipperEventsShippedTotalA, "==", 3),
+			)
+			Expect(shippers.ShipperEventsShippedTotal.WithLabelValues(shipperName, "foundation-b")).To(
+				h.MetricIncrementedBy(shipperEventsShippedTotalB, "==", 0),
+			)
+
+			cancel()
+			Expect(wait()).NotTo(HaveOccurred())
+		})
+
+		It("sends batches again on the next run if they are not confirmed in time", func() {
+			ackShipper.AckPolicyReturns(shippers.AckPolicy{
+				Window:       2,
+				PollInterval: time.Millisecond,
+				Timeout:      20 * time.Millisecond,
+			}, true)
+			runner = shippers.NewRunner(
+				shippers.SinkConfig{Name: shipperName, BatchSize: 1, BatchBytes: 1000, MaxRetries: 0},
+				10*time.Millisecond,
+				logger,
+				eventDB,
+				ackShipper,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wait := run(ctx)
+
+			Eventually(func() float64 {
+				return h.CurrentMetricValue(shippers.ShipperErrorsTotal.WithLabelValues(shipperName))
+			}, "1s", "1ms").Should(BeNumerically("==", shipperErrorsTotal+1))
+			Expect(ackShipper.SendForAckCallCount()).To(Equal(2))
+			Expect(eventDB.UpdateShipperCursorCallCount()).To(Equal(0))
+			Expect(h.CurrentMetricValue(shippers.ShipperUnconfirmedBatches.WithLabelValues(shipperName))).To(
+				BeNumerically("==", 0),
+			)
+
+			cancel()
+			Expect(wait()).NotTo(HaveOccurred())
+		})
+	})
+})
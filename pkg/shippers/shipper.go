@@ -0,0 +1,166 @@
+package shippers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/redaction"
+)
+
+const (
+	SplunkShipperType = "splunk"
+
+	DefaultBatchSize  = 100
+	DefaultBatchBytes = 1000000
+	DefaultMaxRetries = 3
+)
+
+// Shipper sends audit events to a sink. The Runner takes care of reading
+// unshipped events, batching, retries, cursors and metrics, so a new sink
+// only needs to say how to encode an event and how to send a batch.
+type Shipper interface {
+	// Encode turns a single event into the payload the sink expects. It
+	// should include the foundation the event was collected from.
+	Encode(event db.CFAuditEvent) ([]byte, error)
+
+	// Send delivers a batch of encoded events. The batch should only be
+	// reported as sent once the sink has accepted all of it. Sinks which
+	// accept many events in one request should send the batch in one go.
+	Send(ctx context.Context, batch [][]byte) error
+}
+
+// AckPolicy is how the Runner waits for a sink to confirm batches
+type AckPolicy struct {
+	// Window is the most batches which can be waiting to be confirmed at once
+	Window int
+
+	// PollInterval is how often to ask the sink which batches are confirmed
+	PollInterval time.Duration
+
+	// Timeout is how long a batch can wait to be confirmed before it is sent
+	// again
+	Timeout time.Duration
+}
+
+// AckShipper is a Shipper whose sink confirms each batch some time after
+// accepting it, such as Splunk HEC with indexer acknowledgement. The Runner
+// keeps sending batches while earlier ones wait to be confirmed, up to the
+// policy's window, and asks about all of them at once. The sink's cursor only
+// moves past a batch once it and every batch before it have been confirmed.
+type AckShipper interface {
+	Shipper
+
+	// AckPolicy returns how to wait for batches to be confirmed, or false if
+	// the sink is not configured to confirm them, in which case Send is used
+	AckPolicy() (AckPolicy, bool)
+
+	// SendForAck delivers a batch without waiting for it to be confirmed,
+	// and returns the ID to ask about it with
+	SendForAck(ctx context.Context, batch [][]byte) (int64, error)
+
+	// Acked returns which of ackIDs have been confirmed
+	Acked(ctx context.Context, ackIDs []int64) (map[int64]bool, error)
+}
+
+// SinkConfig configures a named sink. The name identifies the sink's cursor in
+// the database, so renaming a sink will ship every event to it again.
+type SinkConfig struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	BatchSize  int    `json:"batch_size"`
+	BatchBytes int    `json:"batch_bytes"`
+	MaxRetries int    `json:"max_retries"`
+
+	// Redaction is applied to events before they are encoded for the sink.
+	// The events in the database are not changed.
+	Redaction redaction.Policy `json:"redaction"`
+
+	Splunk SplunkConfig `json:"splunk"`
+}
+
+// LegacySplunkShipperName is the name of the Splunk sink configured by
+// SPLUNK_API_KEY and SPLUNK_HEC_ENDPOINT_URL. It was the name of the shipper's
+// cursor before there were named sinks.
+const LegacySplunkShipperName = "cf-audit-events-to-splunk"
+
+// LegacySplunkSinkConfig returns the configuration of the Splunk sink
+// configured by SPLUNK_API_KEY and SPLUNK_HEC_ENDPOINT_URL
+func LegacySplunkSinkConfig(splunkURL, apiKey string) SinkConfig {
+	return SinkConfig{
+		Name: LegacySplunkShipperName,
+		Type: SplunkShipperType,
+		Splunk: SplunkConfig{
+			URL:       splunkURL,
+			APIKeyEnv: "SPLUNK_API_KEY",
+			APIKey:    apiKey,
+		},
+	}
+}
+
+// NewShipper creates the Shipper for a sink of the configured type
+func NewShipper(cfg SinkConfig, deployEnv string) (Shipper, error) {
+	switch cfg.Type {
+	case SplunkShipperType:
+		if cfg.Splunk.URL == "" || cfg.Splunk.APIKey == "" {
+			return nil, fmt.Errorf("sink %q: splunk url and a token in the environment variable named by api_key_env are required", cfg.Name)
+		}
+		return NewSplunkShipper(cfg.Name, cfg.Splunk, deployEnv), nil
+	default:
+		return nil, fmt.Errorf("sink %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// ValidateSinkConfigs checks that every sink has a unique name and fills in
+// defaults for optional settings
+func ValidateSinkConfigs(cfgs []SinkConfig) ([]SinkConfig, error) {
+	validated := make([]SinkConfig, len(cfgs))
+	names := map[string]bool{}
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("sink %d: name is required", i)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("sink %q: name is used more than once", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		if cfg.BatchSize <= 0 {
+			cfg.BatchSize = DefaultBatchSize
+		}
+		if cfg.BatchBytes <= 0 {
+			cfg.BatchBytes = DefaultBatchBytes
+		}
+		if cfg.MaxRetries < 0 {
+			return nil, fmt.Errorf("sink %q: max_retries must not be negative", cfg.Name)
+		} else if cfg.MaxRetries == 0 {
+			cfg.MaxRetries = DefaultMaxRetries
+		}
+		if err := cfg.Redaction.Validate(); err != nil {
+			return nil, fmt.Errorf("sink %q: %s", cfg.Name, err)
+		}
+		validated[i] = cfg
+	}
+	return validated, nil
+}
+
+// Duration is a time.Duration which is configured in JSON as a string such as
+// "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
@@ -0,0 +1,298 @@
+package shippers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+)
+
+const (
+	DefaultSplunkAckWindow       = 10
+	DefaultSplunkAckPollInterval = 1 * time.Second
+	DefaultSplunkAckTimeout      = 2 * time.Minute
+)
+
+type SplunkConfig struct {
+	URL string `json:"url"`
+
+	// APIKeyEnv names the environment variable holding the HEC token, so
+	// that the token is not part of the configuration
+	APIKeyEnv string `json:"api_key_env"`
+
+	// APIKey is read from APIKeyEnv when the configuration is loaded
+	APIKey string `json:"-"`
+
+	Gzip bool `json:"gzip"`
+
+	// Ack turns on indexer acknowledgement. A batch only counts as sent once
+	// Splunk confirms that it has been indexed. The HEC token must have
+	// indexer acknowledgement enabled. Up to AckWindow batches are sent
+	// while waiting for earlier ones to be indexed.
+	Ack             bool     `json:"ack"`
+	AckURL          string   `json:"ack_url"`
+	AckWindow       int      `json:"ack_window"`
+	AckPollInterval Duration `json:"ack_poll_interval"`
+	AckTimeout      Duration `json:"ack_timeout"`
+}
+
+type splunkEvent struct {
+	SourceType string      `json:"sourcetype"`
+	Source     string      `json:"source"`
+	Event      interface{} `json:"event"`
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+type splunkAckRequest struct {
+	Acks []int64 `json:"acks"`
+}
+
+type splunkAckResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// SplunkShipper sends events to a Splunk HTTP Event Collector (HEC) endpoint.
+// HEC accepts many event objects concatenated in one request, so each batch
+// is sent as a single request, optionally gzipped.
+type SplunkShipper struct {
+	name      string
+	client    *http.Client
+	splunkURL string
+	apiKey    string
+	gzip      bool
+	deployEnv string
+
+	ack             bool
+	ackURL          string
+	ackWindow       int
+	ackPollInterval time.Duration
+	ackTimeout      time.Duration
+	channel         string
+}
+
+func NewSplunkShipper(name string, cfg SplunkConfig, deployEnv string) *SplunkShipper {
+	s := &SplunkShipper{
+		name:      name,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		splunkURL: cfg.URL,
+		apiKey:    cfg.APIKey,
+		gzip:      cfg.Gzip,
+		deployEnv: deployEnv,
+
+		ack:             cfg.Ack,
+		ackURL:          cfg.AckURL,
+		ackWindow:       cfg.AckWindow,
+		ackPollInterval: cfg.AckPollInterval.Duration,
+		ackTimeout:      cfg.AckTimeout.Duration,
+		channel:         uuid.NewV4().String(),
+	}
+
+	if s.ackURL == "" {
+		s.ackURL = defaultSplunkAckURL(cfg.URL)
+	}
+	if s.ackWindow <= 0 {
+		s.ackWindow = DefaultSplunkAckWindow
+	}
+	if s.ackPollInterval <= 0 {
+		s.ackPollInterval = DefaultSplunkAckPollInterval
+	}
+	if s.ackTimeout <= 0 {
+		s.ackTimeout = DefaultSplunkAckTimeout
+	}
+
+	return s
+}
+
+func (s *SplunkShipper) Encode(event db.CFAuditEvent) ([]byte, error) {
+	return json.Marshal(splunkEvent{
+		SourceType: "cf-audit-event",
+		Source:     s.deployEnv,
+		Event:      db.NewFoundationEvent(event),
+	})
+}
+
+// Send sends the batch and, if indexer acknowledgement is on, waits until
+// Splunk has indexed it
+func (s *SplunkShipper) Send(ctx context.Context, batch [][]byte) error {
+	if !s.ack {
+		req, err := s.newEventRequest(ctx, batch)
+		if err != nil {
+			return err
+		}
+		return s.do(req, nil)
+	}
+
+	ackID, err := s.SendForAck(ctx, batch)
+	if err != nil {
+		return err
+	}
+	return s.waitForAck(ctx, ackID)
+}
+
+// AckPolicy returns how to wait for Splunk to index batches, if indexer
+// acknowledgement is on
+func (s *SplunkShipper) AckPolicy() (AckPolicy, bool) {
+	return AckPolicy{
+		Window:       s.ackWindow,
+		PollInterval: s.ackPollInterval,
+		Timeout:      s.ackTimeout,
+	}, s.ack
+}
+
+// SendForAck sends the batch and returns the ackId to poll for its indexer
+// acknowledgement with
+func (s *SplunkShipper) SendForAck(ctx context.Context, batch [][]byte) (int64, error) {
+	req, err := s.newEventRequest(ctx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	var splunkResp splunkResponse
+	if err := s.do(req, &splunkResp); err != nil {
+		return 0, err
+	}
+
+	if splunkResp.AckID == nil {
+		return 0, fmt.Errorf("no ackId in response, check indexer acknowledgement is enabled for the HEC token")
+	}
+	return *splunkResp.AckID, nil
+}
+
+// Acked asks the ack endpoint which of ackIDs have been indexed, in one
+// request
+func (s *SplunkShipper) Acked(ctx context.Context, ackIDs []int64) (map[int64]bool, error) {
+	ackBody, err := json.Marshal(splunkAckRequest{Acks: ackIDs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.ackURL, bytes.NewReader(ackBody))
+	if err != nil {
+		return nil, err
+	}
+
+	var ackResp splunkAckResponse
+	if err := s.do(req, &ackResp); err != nil {
+		return nil, err
+	}
+
+	acked := map[int64]bool{}
+	for _, ackID := range ackIDs {
+		acked[ackID] = ackResp.Acks[strconv.FormatInt(ackID, 10)]
+	}
+	return acked, nil
+}
+
+// newEventRequest returns a request to send the batch to the HEC event
+// endpoint, gzipped if configured to be
+func (s *SplunkShipper) newEventRequest(ctx context.Context, batch [][]byte) (*http.Request, error) {
+	body := bytes.Join(batch, []byte("\n"))
+
+	if s.gzip {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(body); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		body = compressed.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.splunkURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+// waitForAck polls the ack endpoint until Splunk confirms the request with
+// ackID has been indexed, or until ackTimeout
+func (s *SplunkShipper) waitForAck(ctx context.Context, ackID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, s.ackTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for indexer acknowledgement of ackId %d: %w", ackID, ctx.Err())
+		case <-time.After(s.ackPollInterval):
+		}
+
+		acked, err := s.Acked(ctx, []int64{ackID})
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+		if acked[ackID] {
+			return nil
+		}
+	}
+}
+
+// do sends an authenticated request on this shipper's channel and, if v is
+// not nil, decodes the JSON response into it
+func (s *SplunkShipper) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Splunk %s", s.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+	if s.ack {
+		req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("Status: %d Body: %s", resp.StatusCode, respBody)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(respBody, v); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w: Body: %s", err, respBody)
+	}
+	return nil
+}
+
+// defaultSplunkAckURL returns the ack endpoint on the same host as the HEC
+// event endpoint
+func defaultSplunkAckURL(splunkURL string) string {
+	u, err := url.Parse(splunkURL)
+	if err != nil {
+		return ""
+	}
+	u.Path = "/services/collector/ack"
+	u.RawQuery = ""
+	return u.String()
+}
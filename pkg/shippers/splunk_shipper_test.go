@@ -0,0 +1,318 @@
+package shippers_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	"github.com/jarcoal/httpmock"
+
+	"github.com/alphagov/paas-auditor/pkg/db"
+	"github.com/alphagov/paas-auditor/pkg/redaction"
+	"github.com/alphagov/paas-auditor/pkg/shippers"
+)
+
+const (
+	splunkURL = "http://splunk.api/hec-endpoint"
+)
+
+var _ = Describe("SplunkShipper", func() {
+	var shipper *shippers.SplunkShipper
+
+	BeforeEach(func() {
+		httpmock.Activate()
+
+		shipper = shippers.NewSplunkShipper(
+			"splunk",
+			shippers.SplunkConfig{URL: splunkURL, APIKey: "splunk-key"},
+			"dev",
+		)
+	})
+
+	AfterEach(func() {
+		httpmock.DeactivateAndReset()
+	})
+
+	It("encodes events for HEC", func() {
+		payload, err := shipper.Encode(db.CFAuditEvent{
+			ID:         1,
+			Foundation: "foundation-a",
+			Event:      cfclient.Event{GUID: "abcd", Type: "audit.app.create"},
+			EventNames: db.EventNames{OrganizationName: "some-org", ActorEmail: "someone@example.com"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(payload, &decoded)).To(Succeed())
+		Expect(decoded).To(HaveKeyWithValue("sourcetype", "cf-audit-event"))
+		Expect(decoded).To(HaveKeyWithValue("source", "dev"))
+		Expect(decoded).To(HaveKeyWithValue("event", HaveKeyWithValue("guid", "abcd")))
+		Expect(decoded).To(HaveKeyWithValue("event", HaveKeyWithValue("foundation", "foundation-a")))
+		Expect(decoded).To(HaveKeyWithValue("event", HaveKeyWithValue("organization_name", "some-org")))
+		Expect(decoded).To(HaveKeyWithValue("event", HaveKeyWithValue("actor_email", "someone@example.com")))
+		Expect(decoded).To(HaveKeyWithValue("event", Not(HaveKey("app_name"))))
+	})
+
+	It("leaves out the foundation of events from no particular foundation", func() {
+		payload, err := shipper.Encode(db.CFAuditEvent{ID: 1, Event: cfclient.Event{GUID: "abcd"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(payload, &decoded)).To(Succeed())
+		Expect(decoded).To(HaveKeyWithValue("event", Not(HaveKey("foundation"))))
+	})
+
+	It("sends a batch of events in one request with the API key", func() {
+		var bodies []string
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			func(req *http.Request) (*http.Response, error) {
+				defer GinkgoRecover()
+				Expect(req.Header.Get("Authorization")).To(Equal("Splunk splunk-key"))
+				Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+
+				body, err := ioutil.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				bodies = append(bodies, string(body))
+
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"text": "Success", "code": 0,
+				})
+			},
+		)
+
+		err := shipper.Send(context.Background(), [][]byte{
+			[]byte(`{"event":1}`), []byte(`{"event":2}`),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bodies).To(Equal([]string{"{\"event\":1}\n{\"event\":2}"}))
+	})
+
+	It("gzips the request body when configured to", func() {
+		shipper = shippers.NewSplunkShipper(
+			"splunk",
+			shippers.SplunkConfig{URL: splunkURL, APIKey: "splunk-key", Gzip: true},
+			"dev",
+		)
+
+		var body string
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			func(req *http.Request) (*http.Response, error) {
+				defer GinkgoRecover()
+				Expect(req.Header.Get("Content-Encoding")).To(Equal("gzip"))
+
+				gz, err := gzip.NewReader(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				decompressed, err := ioutil.ReadAll(gz)
+				Expect(err).NotTo(HaveOccurred())
+				body = string(decompressed)
+
+				return httpmock.NewJsonResponse(200, map[string]interface{}{
+					"text": "Success", "code": 0,
+				})
+			},
+		)
+
+		err := shipper.Send(context.Background(), [][]byte{
+			[]byte(`{"event":1}`), []byte(`{"event":2}`),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(Equal("{\"event\":1}\n{\"event\":2}"))
+	})
+
+	Context("with indexer acknowledgement", func() {
+		const splunkAckURL = "http://splunk.api/services/collector/ack"
+
+		BeforeEach(func() {
+			shipper = shippers.NewSplunkShipper(
+				"splunk",
+				shippers.SplunkConfig{
+					URL:             splunkURL,
+					APIKey:          "splunk-key",
+					Ack:             true,
+					AckPollInterval: shippers.Duration{Duration: time.Millisecond},
+					AckTimeout:      shippers.Duration{Duration: 100 * time.Millisecond},
+				},
+				"dev",
+			)
+		})
+
+		It("waits until the batch has been indexed", func() {
+			var channel string
+			httpmock.RegisterResponder(
+				"POST", splunkURL,
+				func(req *http.Request) (*http.Response, error) {
+					defer GinkgoRecover()
+					channel = req.Header.Get("X-Splunk-Request-Channel")
+					Expect(channel).NotTo(BeEmpty())
+
+					return httpmock.NewJsonResponse(200, map[string]interface{}{
+						"text": "Success", "code": 0, "ackId": 7,
+					})
+				},
+			)
+
+			ackPolls := 0
+			httpmock.RegisterResponder(
+				"POST", splunkAckURL,
+				func(req *http.Request) (*http.Response, error) {
+					defer GinkgoRecover()
+					Expect(req.Header.Get("X-Splunk-Request-Channel")).To(Equal(channel))
+					Expect(req.Header.Get("Authorization")).To(Equal("Splunk splunk-key"))
+
+					var ackReq map[string][]int
+					Expect(json.NewDecoder(req.Body).Decode(&ackReq)).To(Succeed())
+					Expect(ackReq).To(Equal(map[string][]int{"acks": {7}}))
+
+					ackPolls++
+					return httpmock.NewJsonResponse(200, map[string]interface{}{
+						"acks": map[string]bool{"7": ackPolls >= 3},
+					})
+				},
+			)
+
+			err := shipper.Send(context.Background(), [][]byte{[]byte(`{"event":1}`)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ackPolls).To(Equal(3))
+		})
+
+		It("asks about many batches in one request", func() {
+			httpmock.RegisterResponder(
+				"POST", splunkAckURL,
+				func(req *http.Request) (*http.Response, error) {
+					defer GinkgoRecover()
+					var ackReq map[string][]int
+					Expect(json.NewDecoder(req.Body).Decode(&ackReq)).To(Succeed())
+					Expect(ackReq).To(Equal(map[string][]int{"acks": {7, 8, 9}}))
+
+					return httpmock.NewJsonResponse(200, map[string]interface{}{
+						"acks": map[string]bool{"7": true, "8": false},
+					})
+				},
+			)
+
+			policy, ok := shipper.AckPolicy()
+			Expect(ok).To(BeTrue())
+			Expect(policy.Window).To(Equal(shippers.DefaultSplunkAckWindow))
+			Expect(policy.Timeout).To(Equal(100 * time.Millisecond))
+
+			acked, err := shipper.Acked(context.Background(), []int64{7, 8, 9})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(acked).To(Equal(map[int64]bool{7: true, 8: false, 9: false}))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+
+		It("returns an error if the batch is not indexed in time", func() {
+			httpmock.RegisterResponder(
+				"POST", splunkURL,
+				httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+					"text": "Success", "code": 0, "ackId": 7,
+				}),
+			)
+			httpmock.RegisterResponder(
+				"POST", splunkAckURL,
+				httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+					"acks": map[string]bool{"7": false},
+				}),
+			)
+
+			err := shipper.Send(context.Background(), [][]byte{[]byte(`{"event":1}`)})
+			Expect(err).To(MatchError(ContainSubstring("ackId 7")))
+		})
+
+		It("returns an error if the token does not have acknowledgement enabled", func() {
+			httpmock.RegisterResponder(
+				"POST", splunkURL,
+				httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+					"text": "Success", "code": 0,
+				}),
+			)
+
+			err := shipper.Send(context.Background(), [][]byte{[]byte(`{"event":1}`)})
+			Expect(err).To(MatchError(ContainSubstring("no ackId")))
+		})
+	})
+
+	It("returns an error when HEC does not accept an event", func() {
+		httpmock.RegisterResponder(
+			"POST", splunkURL,
+			httpmock.NewJsonResponderOrPanic(500, map[string]interface{}{
+				"text": "Internal server error", "code": 8,
+			}),
+		)
+
+		err := shipper.Send(context.Background(), [][]byte{[]byte(`{"event":1}`)})
+		Expect(err).To(MatchError(ContainSubstring("Status: 500")))
+	})
+})
+
+var _ = Describe("ValidateSinkConfigs", func() {
+	It("fills in defaults", func() {
+		cfgs, err := shippers.ValidateSinkConfigs([]shippers.SinkConfig{
+			{Name: "splunk", Type: shippers.SplunkShipperType},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfgs[0].BatchSize).To(Equal(shippers.DefaultBatchSize))
+		Expect(cfgs[0].BatchBytes).To(Equal(shippers.DefaultBatchBytes))
+		Expect(cfgs[0].MaxRetries).To(Equal(shippers.DefaultMaxRetries))
+	})
+
+	It("requires unique names", func() {
+		_, err := shippers.ValidateSinkConfigs([]shippers.SinkConfig{
+			{Name: "splunk", Type: shippers.SplunkShipperType},
+			{Name: "splunk", Type: shippers.SplunkShipperType},
+		})
+		Expect(err).To(MatchError(ContainSubstring("more than once")))
+	})
+
+	It("checks the redaction policy", func() {
+		_, err := shippers.ValidateSinkConfigs([]shippers.SinkConfig{{
+			Name: "splunk",
+			Type: shippers.SplunkShipperType,
+			Redaction: redaction.Policy{
+				Rules: []redaction.Rule{{Field: "actor_name", Action: redaction.ActionHMAC}},
+			},
+		}})
+		Expect(err).To(MatchError(ContainSubstring(`sink "splunk": redaction rule 0: hmac needs a key`)))
+	})
+})
+
+var _ = Describe("SinkConfig", func() {
+	It("reads redaction rules", func() {
+		var cfg shippers.SinkConfig
+		err := json.Unmarshal([]byte(`{"redaction": {
+			"hmac_key_env": "SPLUNK_HMAC_KEY",
+			"rules": [{"metadata": "request.email", "action": "hmac"}]
+		}}`), &cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Redaction.HMACKeyEnv).To(Equal("SPLUNK_HMAC_KEY"))
+		Expect(cfg.Redaction.Rules).To(Equal([]redaction.Rule{{Metadata: "request.email", Action: "hmac"}}))
+	})
+
+	It("reads durations from strings", func() {
+		var cfg shippers.SinkConfig
+		err := json.Unmarshal([]byte(`{"splunk": {"ack_timeout": "90s"}}`), &cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Splunk.AckTimeout.Duration).To(Equal(90 * time.Second))
+	})
+})
+
+var _ = Describe("NewShipper", func() {
+	It("rejects unknown sink types", func() {
+		_, err := shippers.NewShipper(shippers.SinkConfig{Name: "x", Type: "carrier-pigeon"}, "dev")
+		Expect(err).To(MatchError(ContainSubstring("carrier-pigeon")))
+	})
+
+	It("requires the Splunk URL and API key", func() {
+		_, err := shippers.NewShipper(shippers.SinkConfig{Name: "x", Type: shippers.SplunkShipperType}, "dev")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,219 @@
+package testhelpers
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	uuid "github.com/satori/go.uuid"
+)
+
+type generatedUser struct {
+	guid  string
+	email string
+}
+
+type generatedOrg struct {
+	guid string
+	name string
+}
+
+type generatedSpace struct {
+	guid    string
+	name    string
+	orgGUID string
+	apps    []generatedApp
+}
+
+type generatedApp struct {
+	guid string
+	name string
+}
+
+// generatedEventTypes are weighted roughly by how often Cloud Controller
+// records them
+var generatedEventTypes = []struct {
+	eventType string
+	weight    int
+}{
+	{"audit.app.update", 20},
+	{"audit.app.start", 12},
+	{"audit.app.stop", 8},
+	{"audit.app.restage", 6},
+	{"audit.app.ssh-authorized", 10},
+	{"audit.app.create", 5},
+	{"audit.app.delete-request", 3},
+	{"audit.app.droplet.create", 8},
+	{"audit.app.process.crash", 4},
+	{"audit.service_instance.create", 3},
+	{"audit.service_binding.create", 3},
+	{"audit.user.space_developer_add", 2},
+	{"audit.user.organization_user_add", 1},
+	{"audit.space.create", 1},
+}
+
+// EventGenerator makes a corpus of audit events which look like those from a
+// real foundation: a fixed set of users acting on the apps, services and roles
+// of a fixed set of organizations and spaces. The same seed always gives the
+// same events.
+type EventGenerator struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	users  []generatedUser
+	orgs   []generatedOrg
+	spaces []generatedSpace
+}
+
+func NewEventGenerator(seed int64) *EventGenerator {
+	g := &EventGenerator{rand: rand.New(rand.NewSource(seed))}
+	for i := 0; i < 20; i++ {
+		g.users = append(g.users, generatedUser{
+			guid:  g.guid(),
+			email: fmt.Sprintf("user-%d@example.com", i),
+		})
+	}
+	for org := 0; org < 5; org++ {
+		orgGUID := g.guid()
+		g.orgs = append(g.orgs, generatedOrg{orgGUID, fmt.Sprintf("org-%d", org)})
+		for space := 0; space < 3; space++ {
+			s := generatedSpace{
+				guid:    g.guid(),
+				name:    fmt.Sprintf("org-%d-space-%d", org, space),
+				orgGUID: orgGUID,
+			}
+			for app := 0; app < 4; app++ {
+				s.apps = append(s.apps, generatedApp{g.guid(), fmt.Sprintf("%s-app-%d", s.name, app)})
+			}
+			g.spaces = append(g.spaces, s)
+		}
+	}
+	return g
+}
+
+// Resources returns the organizations, spaces, apps and users which the
+// events are about, for a FakeCF to serve
+func (g *EventGenerator) Resources() []FakeCFResource {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	resources := []FakeCFResource{}
+	for _, user := range g.users {
+		resources = append(resources, FakeCFResource{"user", user.guid, user.email})
+	}
+	for _, org := range g.orgs {
+		resources = append(resources, FakeCFResource{"organization", org.guid, org.name})
+	}
+	for _, space := range g.spaces {
+		resources = append(resources, FakeCFResource{"space", space.guid, space.name})
+		for _, app := range space.apps {
+			resources = append(resources, FakeCFResource{"app", app.guid, app.name})
+		}
+	}
+	return resources
+}
+
+// Generate makes count events, the first created at start and each after it
+// about interval later, to the second. With an interval of less than a second
+// several events share a created_at, as they do in Cloud Controller.
+func (g *EventGenerator) Generate(count int, start time.Time, interval time.Duration) []cfclient.Event {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	events := make([]cfclient.Event, count)
+	for i := range events {
+		createdAt := start.Add(time.Duration(i) * interval).UTC().Truncate(time.Second)
+		events[i] = g.event(createdAt)
+	}
+	return events
+}
+
+func (g *EventGenerator) event(createdAt time.Time) cfclient.Event {
+	actor := g.users[g.rand.Intn(len(g.users))]
+	space := g.spaces[g.rand.Intn(len(g.spaces))]
+	app := space.apps[g.rand.Intn(len(space.apps))]
+
+	event := cfclient.Event{
+		GUID:             g.guid(),
+		Type:             g.eventType(),
+		CreatedAt:        createdAt.Format(time.RFC3339),
+		Actor:            actor.guid,
+		ActorType:        "user",
+		ActorName:        actor.email,
+		ActorUsername:    actor.email,
+		Actee:            app.guid,
+		ActeeType:        "app",
+		ActeeName:        app.name,
+		OrganizationGUID: space.orgGUID,
+		SpaceGUID:        space.guid,
+		Metadata:         map[string]interface{}{},
+	}
+
+	switch event.Type {
+	case "audit.app.create":
+		event.Metadata["request"] = map[string]interface{}{
+			"name":       app.name,
+			"space_guid": space.guid,
+			"instances":  float64(1 + g.rand.Intn(3)),
+			"memory":     float64(128 * (1 + g.rand.Intn(8))),
+			"state":      "STOPPED",
+		}
+	case "audit.app.update":
+		event.Metadata["request"] = map[string]interface{}{
+			"instances": float64(1 + g.rand.Intn(5)),
+		}
+	case "audit.app.ssh-authorized", "audit.app.process.crash":
+		event.Metadata["index"] = float64(g.rand.Intn(3))
+	case "audit.app.delete-request":
+		event.Metadata["request"] = map[string]interface{}{"recursive": true}
+	case "audit.service_instance.create":
+		event.Actee, event.ActeeType = g.guid(), "service_instance"
+		event.ActeeName = fmt.Sprintf("%s-db", app.name)
+		event.Metadata["request"] = map[string]interface{}{
+			"name":              event.ActeeName,
+			"service_plan_guid": g.guid(),
+		}
+	case "audit.service_binding.create":
+		event.Actee, event.ActeeType, event.ActeeName = g.guid(), "service_binding", ""
+		event.Metadata["request"] = map[string]interface{}{"app_guid": app.guid}
+	case "audit.user.space_developer_add", "audit.user.organization_user_add":
+		user := g.users[g.rand.Intn(len(g.users))]
+		event.Actee, event.ActeeType, event.ActeeName = user.guid, "user", user.email
+		event.Metadata["request"] = map[string]interface{}{"username": user.email}
+		if event.Type == "audit.user.organization_user_add" {
+			event.SpaceGUID = ""
+		}
+	case "audit.space.create":
+		event.Actee, event.ActeeType, event.ActeeName = space.guid, "space", space.name
+		event.Metadata["request"] = map[string]interface{}{
+			"name":              space.name,
+			"organization_guid": space.orgGUID,
+		}
+	}
+	return event
+}
+
+func (g *EventGenerator) eventType() string {
+	total := 0
+	for _, t := range generatedEventTypes {
+		total += t.weight
+	}
+	n := g.rand.Intn(total)
+	for _, t := range generatedEventTypes {
+		if n < t.weight {
+			return t.eventType
+		}
+		n -= t.weight
+	}
+	panic("unreachable")
+}
+
+func (g *EventGenerator) guid() string {
+	var b [16]byte
+	g.rand.Read(b[:])
+	u := uuid.FromBytesOrNil(b[:])
+	u.SetVersion(uuid.V4)
+	u.SetVariant(uuid.VariantRFC4122)
+	return u.String()
+}
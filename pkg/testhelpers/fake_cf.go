@@ -0,0 +1,651 @@
+package testhelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfclient "github.com/cloudfoundry-community/go-cfclient"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Fault is a failure which FakeCF can give instead of a page of events
+type Fault string
+
+const (
+	// FaultRateLimited is a 429 with a CF-RateLimitExceeded error
+	FaultRateLimited Fault = "rate-limited"
+
+	// FaultServerError is a 502 from the router, which is not JSON
+	FaultServerError Fault = "server-error"
+
+	// FaultMalformedJSON is a 200 with a truncated body
+	FaultMalformedJSON Fault = "malformed-json"
+
+	// FaultTokenExpired is a 401 with a CF-InvalidAuthToken error, as when a
+	// token expires before the client expects it to. The token is revoked.
+	FaultTokenExpired Fault = "token-expired"
+
+	// FaultConnectionDropped closes the connection part way through the
+	// response's headers
+	FaultConnectionDropped Fault = "connection-dropped"
+
+	// FaultUnexpectedStatus is a 204 with no body, which is a success but not
+	// a page of events
+	FaultUnexpectedStatus Fault = "unexpected-status"
+
+	// FaultNone serves a request as normal. It can be injected before another
+	// fault to let some requests succeed first.
+	FaultNone Fault = ""
+)
+
+var Faults = []Fault{
+	FaultRateLimited, FaultServerError, FaultMalformedJSON, FaultTokenExpired,
+	FaultConnectionDropped, FaultUnexpectedStatus,
+}
+
+const (
+	fakeCFMaxResultsPerPageV2 = 100
+	fakeCFMaxResultsPerPageV3 = 5000
+)
+
+// FakeCF is a stand-in for Cloud Controller and UAA, which serves audit events
+// from memory on /v2/events and /v3/audit_events, with the pagination and
+// filtering used by the fetchers. It also serves the organizations, spaces,
+// apps and users it has been given, on /v3/organizations/:guid,
+// /v3/spaces/:guid, /v3/apps/:guid and UAA's /Users/:guid. Requests other than
+// for tokens need a token from its /oauth/token endpoint, which it issues to
+// its client with client credentials.
+//
+// The exported fields can be changed before making requests.
+type FakeCF struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// Latency delays every response
+	Latency time.Duration
+
+	// TokenTTL is how long tokens are valid for
+	TokenTTL time.Duration
+
+	// FaultRate is the chance of a request for events failing with one of
+	// RandomFaults, if no faults have been injected
+	FaultRate    float64
+	RandomFaults []Fault
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	events    []cfclient.Event
+	resources map[string]FakeCFResource
+	faults    []Fault
+	tokens    map[string]time.Time
+	requests  map[string]int
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+// NewFakeCF starts a FakeCF on a local port
+func NewFakeCF(clientID string, clientSecret string) *FakeCF {
+	f := newFakeCF(clientID, clientSecret)
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// NewFakeCFWithListener starts a FakeCF on listener, eg to run it on a fixed
+// address
+func NewFakeCFWithListener(listener net.Listener, clientID string, clientSecret string) *FakeCF {
+	f := newFakeCF(clientID, clientSecret)
+	f.Server = httptest.NewUnstartedServer(http.HandlerFunc(f.serveHTTP))
+	f.Server.Listener.Close()
+	f.Server.Listener = listener
+	f.Server.Start()
+	return f
+}
+
+func newFakeCF(clientID string, clientSecret string) *FakeCF {
+	return &FakeCF{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenTTL:     time.Hour,
+		RandomFaults: Faults,
+		rand:         rand.New(rand.NewSource(1)),
+		resources:    map[string]FakeCFResource{},
+		tokens:       map[string]time.Time{},
+		requests:     map[string]int{},
+		stop:         make(chan struct{}),
+	}
+}
+
+// NewClient returns a CF client which uses the FakeCF's client credentials
+func (f *FakeCF) NewClient() (*cfclient.Client, error) {
+	return cfclient.NewClient(&cfclient.Config{
+		ApiAddress:   f.URL,
+		ClientID:     f.ClientID,
+		ClientSecret: f.ClientSecret,
+		HttpClient:   &http.Client{Timeout: 10 * time.Second},
+	})
+}
+
+// Close stops events arriving and shuts the server down
+func (f *FakeCF) Close() {
+	close(f.stop)
+	f.stopped.Wait()
+	f.Server.Close()
+}
+
+// AddEvents adds events to be served, in the order of their created_at, which
+// must be RFC3339 in UTC, like 2020-01-02T03:04:05Z
+func (f *FakeCF) AddEvents(events ...cfclient.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, events...)
+	sort.SliceStable(f.events, func(i, j int) bool {
+		return f.events[i].CreatedAt < f.events[j].CreatedAt
+	})
+}
+
+// Events returns every event which is served, oldest first
+func (f *FakeCF) Events() []cfclient.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]cfclient.Event{}, f.events...)
+}
+
+// FakeCFResource is an organization, space, app or user which FakeCF serves
+type FakeCFResource struct {
+	// Type is organization, space, app or user
+	Type string
+	GUID string
+
+	// Name is the email address of a user
+	Name string
+}
+
+func (r FakeCFResource) key() string {
+	return r.Type + "/" + r.GUID
+}
+
+// AddResources adds resources to be served, replacing any with the same type
+// and GUID, eg to rename them
+func (f *FakeCF) AddResources(resources ...FakeCFResource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, resource := range resources {
+		f.resources[resource.key()] = resource
+	}
+}
+
+// DeleteResource stops a resource being served, as if it had been deleted
+func (f *FakeCF) DeleteResource(resourceType string, guid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.resources, FakeCFResource{Type: resourceType, GUID: guid}.key())
+}
+
+// InjectFaults makes the next requests for events fail, one for each fault,
+// in order
+func (f *FakeCF) InjectFaults(faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, faults...)
+}
+
+// Requests returns how many requests there have been for path
+func (f *FakeCF) Requests(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+// StartArrivals adds count events from generator every interval, created at
+// the time they arrive, until the FakeCF is closed
+func (f *FakeCF) StartArrivals(generator *EventGenerator, interval time.Duration, count int) {
+	f.stopped.Add(1)
+	go func() {
+		defer f.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				f.AddEvents(generator.Generate(count, now, 0)...)
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (f *FakeCF) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.URL.Path]++
+	f.mu.Unlock()
+
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if resourceType, guid, ok := fakeCFResourcePath(r.URL.Path); ok {
+		f.serveResource(w, r, resourceType, guid)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v2/info":
+		writeFakeCFJSON(w, http.StatusOK, map[string]interface{}{
+			"name":                   "fake-cf",
+			"api_version":            "2.150.0",
+			"authorization_endpoint": f.URL,
+			"token_endpoint":         f.URL,
+		})
+	case "/oauth/token":
+		f.serveToken(w, r)
+	case "/v2/events":
+		f.serveEvents(w, r, false)
+	case "/v3/audit_events":
+		f.serveEvents(w, r, true)
+	default:
+		writeFakeCFError(w, strings.HasPrefix(r.URL.Path, "/v3/"), http.StatusNotFound, 10000, "CF-NotFound", "Unknown request")
+	}
+}
+
+func (f *FakeCF) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" || clientID != f.ClientID || clientSecret != f.ClientSecret {
+		writeFakeCFJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "unauthorized",
+			"error_description": "Bad credentials",
+		})
+		return
+	}
+
+	token := strings.Replace(uuid.NewV4().String(), "-", "", -1)
+	f.mu.Lock()
+	f.tokens[token] = time.Now().Add(f.TokenTTL)
+	f.mu.Unlock()
+	writeFakeCFJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(f.TokenTTL.Seconds()),
+		"scope":        "cloud_controller.admin_read_only",
+		"jti":          token,
+	})
+}
+
+// fakeCFResourcePath returns the type and GUID of the resource path is for,
+// if it is for one
+func fakeCFResourcePath(path string) (string, string, bool) {
+	for prefix, resourceType := range map[string]string{
+		"/v3/organizations/": "organization",
+		"/v3/spaces/":        "space",
+		"/v3/apps/":          "app",
+		"/Users/":            "user",
+	} {
+		if guid := strings.TrimPrefix(path, prefix); guid != path && guid != "" && !strings.Contains(guid, "/") {
+			return resourceType, guid, true
+		}
+	}
+	return "", "", false
+}
+
+func (f *FakeCF) serveResource(w http.ResponseWriter, r *http.Request, resourceType string, guid string) {
+	f.mu.Lock()
+	authorized := f.validToken(bearerToken(r))
+	resource, ok := f.resources[FakeCFResource{Type: resourceType, GUID: guid}.key()]
+	f.mu.Unlock()
+
+	if resourceType == "user" {
+		switch {
+		case !authorized:
+			writeFakeCFJSON(w, http.StatusUnauthorized, map[string]string{
+				"error":             "invalid_token",
+				"error_description": "Invalid access token",
+			})
+		case !ok:
+			writeFakeCFJSON(w, http.StatusNotFound, map[string]string{
+				"error":             "scim_resource_not_found",
+				"error_description": "User " + guid + " does not exist",
+			})
+		default:
+			writeFakeCFJSON(w, http.StatusOK, map[string]interface{}{
+				"id":       resource.GUID,
+				"userName": resource.Name,
+				"emails":   []map[string]interface{}{{"value": resource.Name, "primary": true}},
+			})
+		}
+		return
+	}
+
+	switch {
+	case !authorized:
+		writeFakeCFError(w, true, http.StatusUnauthorized, 1000, "CF-InvalidAuthToken", "Invalid Auth Token")
+	case !ok:
+		writeFakeCFError(w, true, http.StatusNotFound, 10010, "CF-ResourceNotFound", resourceType+" not found")
+	default:
+		writeFakeCFJSON(w, http.StatusOK, map[string]interface{}{
+			"guid": resource.GUID,
+			"name": resource.Name,
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	if parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		return parts[1]
+	}
+	return ""
+}
+
+// validToken must be called with f.mu held
+func (f *FakeCF) validToken(token string) bool {
+	expiry, ok := f.tokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+func (f *FakeCF) serveEvents(w http.ResponseWriter, r *http.Request, v3 bool) {
+	token := bearerToken(r)
+	f.mu.Lock()
+	fault := FaultTokenExpired
+	if f.validToken(token) {
+		fault = f.nextFault()
+	}
+	if fault == FaultTokenExpired {
+		delete(f.tokens, token)
+	}
+	f.mu.Unlock()
+	if fault == FaultTokenExpired {
+		writeFakeCFError(w, v3, http.StatusUnauthorized, 1000, "CF-InvalidAuthToken", "Invalid Auth Token")
+		return
+	}
+
+	switch fault {
+	case FaultRateLimited:
+		writeFakeCFError(w, v3, http.StatusTooManyRequests, 10013, "CF-RateLimitExceeded", "Rate Limit Exceeded")
+		return
+	case FaultServerError:
+		http.Error(w, "502 Bad Gateway: Registered endpoint failed to handle the request.", http.StatusBadGateway)
+		return
+	case FaultConnectionDropped:
+		// Some of the response is written, as a client retries a request on a
+		// reused connection which is closed before it reads anything
+		if conn, buf, err := w.(http.Hijacker).Hijack(); err == nil {
+			buf.WriteString("HTTP/1.1 200 OK\r\n")
+			buf.Flush()
+			conn.Close()
+		}
+		return
+	case FaultUnexpectedStatus:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var body interface{}
+	var err error
+	if v3 {
+		body, err = f.pageV3(r.URL.Query())
+	} else {
+		body, err = f.pageV2(r.URL.Query())
+	}
+	if err != nil {
+		writeFakeCFError(w, v3, http.StatusBadRequest, 1001, "CF-BadQueryParameter", err.Error())
+		return
+	}
+
+	if fault == FaultMalformedJSON {
+		encoded, _ := json.Marshal(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(encoded[:len(encoded)/2])
+		return
+	}
+	writeFakeCFJSON(w, http.StatusOK, body)
+}
+
+// nextFault must be called with f.mu held
+func (f *FakeCF) nextFault() Fault {
+	if len(f.faults) > 0 {
+		fault := f.faults[0]
+		f.faults = f.faults[1:]
+		return fault
+	}
+	if f.FaultRate > 0 && len(f.RandomFaults) > 0 && f.rand.Float64() < f.FaultRate {
+		return f.RandomFaults[f.rand.Intn(len(f.RandomFaults))]
+	}
+	return ""
+}
+
+func (f *FakeCF) pageV2(query url.Values) (cfclient.EventsResponse, error) {
+	filter := eventTimeFilter{}
+	for _, q := range query["q"] {
+		var bound *string
+		var value string
+		switch {
+		case strings.HasPrefix(q, "timestamp>="):
+			bound, value = &filter.from, strings.TrimPrefix(q, "timestamp>=")
+		case strings.HasPrefix(q, "timestamp>"):
+			bound, value = &filter.after, strings.TrimPrefix(q, "timestamp>")
+		case strings.HasPrefix(q, "timestamp<"):
+			bound, value = &filter.before, strings.TrimPrefix(q, "timestamp<")
+		default:
+			return cfclient.EventsResponse{}, fmt.Errorf("unsupported query %q", q)
+		}
+		timestamp, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return cfclient.EventsResponse{}, fmt.Errorf("invalid timestamp in %q", q)
+		}
+		*bound = timestamp.UTC().Format(time.RFC3339)
+	}
+	perPage, page, err := pagination(query, "results-per-page", fakeCFMaxResultsPerPageV2)
+	if err != nil {
+		return cfclient.EventsResponse{}, err
+	}
+
+	events, total := f.page(filter, perPage, page)
+	resources := make([]cfclient.EventResource, len(events))
+	for i, event := range events {
+		meta := cfclient.Meta{
+			Guid:      event.GUID,
+			Url:       "/v2/events/" + event.GUID,
+			CreatedAt: event.CreatedAt,
+			UpdatedAt: event.CreatedAt,
+		}
+		event.GUID = ""
+		event.CreatedAt = ""
+		resources[i] = cfclient.EventResource{Meta: meta, Entity: event}
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(perPage)))
+	nextURL := ""
+	if page < totalPages {
+		next := url.Values{}
+		for key, values := range query {
+			next[key] = values
+		}
+		next.Set("page", strconv.Itoa(page+1))
+		nextURL = "/v2/events?" + next.Encode()
+	}
+	return cfclient.EventsResponse{
+		TotalResults: total,
+		Pages:        totalPages,
+		NextURL:      nextURL,
+		Resources:    resources,
+	}, nil
+}
+
+func (f *FakeCF) pageV3(query url.Values) (map[string]interface{}, error) {
+	filter := eventTimeFilter{}
+	for param, bound := range map[string]*string{
+		"created_ats[gt]":  &filter.after,
+		"created_ats[gte]": &filter.from,
+		"created_ats[lt]":  &filter.before,
+	} {
+		if createdAt := query.Get(param); createdAt != "" {
+			timestamp, err := time.Parse(time.RFC3339, createdAt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", param, createdAt)
+			}
+			*bound = timestamp.UTC().Format(time.RFC3339)
+		}
+	}
+	if orderBy := query.Get("order_by"); orderBy != "" && orderBy != "created_at" {
+		return nil, fmt.Errorf("unsupported order_by %q", orderBy)
+	}
+	perPage, page, err := pagination(query, "per_page", fakeCFMaxResultsPerPageV3)
+	if err != nil {
+		return nil, err
+	}
+
+	events, total := f.page(filter, perPage, page)
+	resources := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		resources[i] = map[string]interface{}{
+			"guid":         event.GUID,
+			"created_at":   event.CreatedAt,
+			"updated_at":   event.CreatedAt,
+			"type":         event.Type,
+			"actor":        map[string]string{"guid": event.Actor, "type": event.ActorType, "name": event.ActorName},
+			"target":       map[string]string{"guid": event.Actee, "type": event.ActeeType, "name": event.ActeeName},
+			"data":         event.Metadata,
+			"space":        v3Parent(event.SpaceGUID),
+			"organization": v3Parent(event.OrganizationGUID),
+			"links": map[string]interface{}{
+				"self": map[string]string{"href": f.URL + "/v3/audit_events/" + event.GUID},
+			},
+		}
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(perPage)))
+	link := func(page int) interface{} {
+		if page < 1 || page > totalPages {
+			return nil
+		}
+		linkQuery := url.Values{}
+		for key, values := range query {
+			linkQuery[key] = values
+		}
+		linkQuery.Set("page", strconv.Itoa(page))
+		return map[string]string{"href": f.URL + "/v3/audit_events?" + linkQuery.Encode()}
+	}
+	return map[string]interface{}{
+		"pagination": map[string]interface{}{
+			"total_results": total,
+			"total_pages":   totalPages,
+			"first":         link(1),
+			"last":          link(totalPages),
+			"next":          link(page + 1),
+			"previous":      link(page - 1),
+		},
+		"resources": resources,
+	}, nil
+}
+
+// eventTimeFilter selects the events created after after, at or after from,
+// and before before, each of which is RFC3339 in UTC, or empty for no bound
+type eventTimeFilter struct {
+	after  string
+	from   string
+	before string
+}
+
+// page returns a page of the events selected by filter, and how many events
+// there are in all the pages
+func (f *FakeCF) page(filter eventTimeFilter, perPage int, page int) ([]cfclient.Event, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Events are sorted by created_at, which is always RFC3339 in UTC
+	first := sort.Search(len(f.events), func(i int) bool {
+		createdAt := f.events[i].CreatedAt
+		return createdAt > filter.after && createdAt >= filter.from
+	})
+	last := sort.Search(len(f.events), func(i int) bool {
+		return filter.before != "" && f.events[i].CreatedAt >= filter.before
+	})
+	if last < first {
+		last = first
+	}
+	matching := f.events[first:last]
+
+	start := (page - 1) * perPage
+	if start > len(matching) {
+		start = len(matching)
+	}
+	end := start + perPage
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return append([]cfclient.Event{}, matching[start:end]...), len(matching)
+}
+
+func pagination(query url.Values, perPageParam string, maxPerPage int) (int, int, error) {
+	perPage, page := 50, 1
+	if value := query.Get(perPageParam); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPerPage {
+			return 0, 0, fmt.Errorf("%s must be between 1 and %d", perPageParam, maxPerPage)
+		}
+		perPage = n
+	}
+	if value := query.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("page must be greater than 0")
+		}
+		page = n
+	}
+	return perPage, page, nil
+}
+
+func v3Parent(guid string) interface{} {
+	if guid == "" {
+		return nil
+	}
+	return map[string]string{"guid": guid}
+}
+
+func writeFakeCFError(w http.ResponseWriter, v3 bool, status int, code int, errorCode string, description string) {
+	if v3 {
+		writeFakeCFJSON(w, status, map[string]interface{}{
+			"errors": []map[string]interface{}{{"code": code, "title": errorCode, "detail": description}},
+		})
+		return
+	}
+	writeFakeCFJSON(w, status, map[string]interface{}{
+		"code":        code,
+		"error_code":  errorCode,
+		"description": description,
+	})
+}
+
+func writeFakeCFJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,209 @@
+package testhelpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeS3 is a stand-in for an S3 compatible object store, which keeps objects
+// in memory. It only accepts requests signed with its access key, and checks
+// the payload hash, but not the signature. Objects can be uploaded in one
+// request, or in parts with a multipart upload.
+type FakeS3 struct {
+	*httptest.Server
+
+	Bucket      string
+	AccessKeyID string
+
+	mu           sync.Mutex
+	objects      map[string][]byte
+	uploads      map[string]*fakeUpload
+	nextUploadID int
+
+	// Corrupt, if set, changes objects as they are downloaded
+	Corrupt func(key string, body []byte) []byte
+
+	// FailPart, if set, fails the upload of parts for which it returns true
+	FailPart func(key string, partNumber int) bool
+}
+
+type fakeUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+func NewFakeS3(bucket string, accessKeyID string) *FakeS3 {
+	s := &FakeS3{
+		Bucket:      bucket,
+		AccessKeyID: accessKeyID,
+		objects:     map[string][]byte{},
+		uploads:     map[string]*fakeUpload{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *FakeS3) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.objects[key]
+	return body, ok
+}
+
+func (s *FakeS3) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Uploads returns the number of parts of each multipart upload which has been
+// started but not completed or aborted
+func (s *FakeS3) Uploads() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := []int{}
+	for _, upload := range s.uploads {
+		uploads = append(uploads, len(upload.parts))
+	}
+	return uploads
+}
+
+func (s *FakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + s.Bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if _, ok := query["uploads"]; ok || query.Get("uploadId") != "" {
+		s.serveUpload(w, r, key, body)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.mu.Lock()
+		s.objects[key] = body
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		body, ok := s.Object(key)
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if s.Corrupt != nil {
+			body = s.Corrupt(key, body)
+		}
+		w.Write(body)
+	default:
+		http.Error(w, "<Error><Code>MethodNotAllowed</Code></Error>", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveUpload serves the requests of a multipart upload: creating it,
+// uploading a part, and completing or aborting it
+func (s *FakeS3) serveUpload(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	if _, ok := query["uploads"]; ok && r.Method == http.MethodPost {
+		s.nextUploadID++
+		uploadID := fmt.Sprintf("upload-%d", s.nextUploadID)
+		s.uploads[uploadID] = &fakeUpload{key: key, parts: map[int][]byte{}}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", s.Bucket, key, uploadID)
+		return
+	}
+
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if !ok || upload.key != key {
+		http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || partNumber < 1 {
+			http.Error(w, "<Error><Code>InvalidArgument</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		if s.FailPart != nil && s.FailPart(key, partNumber) {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		upload.parts[partNumber] = body
+		w.Header().Set("ETag", fakeETag(body))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		complete := struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, "<Error><Code>MalformedXML</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		var object bytes.Buffer
+		for i, part := range complete.Parts {
+			partBody, ok := upload.parts[part.PartNumber]
+			if part.PartNumber != i+1 || !ok || part.ETag != fakeETag(partBody) {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			object.Write(partBody)
+		}
+		s.objects[key] = object.Bytes()
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>", key)
+	case http.MethodDelete:
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "<Error><Code>MethodNotAllowed</Code></Error>", http.StatusMethodNotAllowed)
+	}
+}
+
+func fakeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,203 @@
+package testhelpers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SMTPMessage is a message accepted by FakeSMTP
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// FakeSMTP is a stand-in for an SMTP server, which keeps the messages it
+// accepts in memory. If it has a username, it only accepts messages from
+// clients which have authenticated with AUTH PLAIN. It does not offer
+// STARTTLS.
+type FakeSMTP struct {
+	Username string
+	Password string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+	failures int
+}
+
+func NewFakeSMTP(username string, password string) *FakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &FakeSMTP{
+		Username: username,
+		Password: password,
+		listener: listener,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *FakeSMTP) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (s *FakeSMTP) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *FakeSMTP) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *FakeSMTP) Messages() []SMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMTPMessage{}, s.messages...)
+}
+
+// FailNext rejects the next count messages with a temporary failure
+func (s *FakeSMTP) FailNext(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = count
+}
+
+func (s *FakeSMTP) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *FakeSMTP) handle(conn *textproto.Conn) {
+	var (
+		authenticated = s.Username == ""
+		message       *SMTPMessage
+	)
+	reply := func(code int, text string) {
+		conn.PrintfLine("%d %s", code, text)
+	}
+
+	reply(220, "fake-smtp ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			conn.PrintfLine("250-fake-smtp")
+			if s.Username != "" {
+				conn.PrintfLine("250-AUTH PLAIN")
+			}
+			reply(250, "8BITMIME")
+		case "HELO":
+			reply(250, "fake-smtp")
+		case "AUTH":
+			fields := strings.Fields(arg)
+			if len(fields) != 2 || strings.ToUpper(fields[0]) != "PLAIN" {
+				reply(504, "Unrecognized authentication type")
+				continue
+			}
+			credentials, err := base64.StdEncoding.DecodeString(fields[1])
+			parts := bytes.Split(credentials, []byte{0})
+			if err != nil || len(parts) != 3 || string(parts[1]) != s.Username || string(parts[2]) != s.Password {
+				reply(535, "Authentication credentials invalid")
+				continue
+			}
+			authenticated = true
+			reply(235, "Authentication successful")
+		case "MAIL":
+			if !authenticated {
+				reply(530, "Authentication required")
+				continue
+			}
+			message = &SMTPMessage{From: smtpAddress(arg, "FROM:")}
+			reply(250, "OK")
+		case "RCPT":
+			if message == nil {
+				reply(503, "Need MAIL command")
+				continue
+			}
+			message.To = append(message.To, smtpAddress(arg, "TO:"))
+			reply(250, "OK")
+		case "DATA":
+			if message == nil || len(message.To) == 0 {
+				reply(503, "Need RCPT command")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.Data = data
+			if s.accept(*message) {
+				reply(250, "OK: queued")
+			} else {
+				reply(451, "Temporary failure, try again")
+			}
+			message = nil
+		case "RSET":
+			message = nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented: "+strconv.Quote(verb))
+		}
+	}
+}
+
+func (s *FakeSMTP) accept(message SMTPMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return false
+	}
+	s.messages = append(s.messages, message)
+	return true
+}
+
+// smtpAddress gets the address from a MAIL or RCPT argument such as
+// FROM:<someone@example.com> BODY=8BITMIME
+func smtpAddress(arg string, prefix string) string {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	if fields := strings.Fields(arg); len(fields) > 0 {
+		arg = fields[0]
+	}
+	return strings.Trim(arg, "<>")
+}